@@ -0,0 +1,293 @@
+// Package agent keeps safnari resident: it runs scans on a cron schedule,
+// writes each run to its own output files and takes commands over a local
+// control socket.
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"safnari/config"
+	"safnari/logger"
+	"safnari/output"
+	"safnari/scanner"
+	"safnari/schedule"
+	"safnari/systeminfo"
+)
+
+// Agent states reported by Status.
+const (
+	StateIdle    = "idle"
+	StateRunning = "running"
+	StatePaused  = "paused"
+)
+
+// Run results reported in RunStatus.Result.
+const (
+	ResultCompleted = "completed"
+	ResultCancelled = "cancelled"
+	ResultFailed    = "failed"
+)
+
+// ErrNotRunning is returned when a command needs a running scan.
+var ErrNotRunning = errors.New("no scan is running")
+
+// ErrBusy is returned when a scan is triggered while one is running.
+var ErrBusy = errors.New("a scan is already running")
+
+// Status is the agent's state as reported by the control API.
+type Status struct {
+	State   string     `json:"state"`
+	NextRun string     `json:"next_run,omitempty"`
+	Current *RunStatus `json:"current,omitempty"`
+	Last    *RunStatus `json:"last,omitempty"`
+}
+
+// RunStatus describes a running or finished scan.
+type RunStatus struct {
+	Output         string `json:"output"`
+	Trigger        string `json:"trigger"`
+	StartTime      string `json:"start_time"`
+	EndTime        string `json:"end_time,omitempty"`
+	FilesScanned   int    `json:"files_scanned"`
+	FilesProcessed int    `json:"files_processed"`
+	TotalFiles     int    `json:"total_files,omitempty"`
+	Result         string `json:"result,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// Agent runs scheduled and triggered scans one at a time.
+type Agent struct {
+	cfg      *config.Config
+	schedule *schedule.Schedule
+	cache    *scanner.DeltaChunkCache
+	gate     scanner.PauseGate
+	trigger  chan struct{}
+	// lastStart is when the previous run started; only the Run loop uses it.
+	lastStart time.Time
+
+	mu      sync.Mutex
+	current *activeRun
+	last    *RunStatus
+	next    time.Time
+}
+
+type activeRun struct {
+	status    RunStatus
+	writer    *output.Writer
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+// New prepares an agent for cfg. The delta chunk cache, when delta scans use
+// it, is opened once and shared by every run.
+func New(cfg *config.Config) (*Agent, error) {
+	if cfg.AgentSchedule == "" {
+		return nil, errors.New("agent needs agent_schedule in the config file or --agent-schedule")
+	}
+	sched, err := schedule.Parse(cfg.AgentSchedule)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := scanner.OpenDeltaChunkCache(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Agent{cfg: cfg, schedule: sched, cache: cache, trigger: make(chan struct{}, 1)}, nil
+}
+
+// Run runs scans on schedule and on Trigger until ctx ends. A scan in
+// progress is cancelled when ctx ends.
+func (a *Agent) Run(ctx context.Context) error {
+	defer func() {
+		if err := a.cache.Close(); err != nil {
+			logger.Warnf("Failed to save delta cache: %v", err)
+		}
+	}()
+	for {
+		next := a.schedule.Next(time.Now())
+		a.mu.Lock()
+		a.next = next
+		a.mu.Unlock()
+
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if !next.IsZero() {
+			logger.Infof("Next scheduled scan at %s", next.Format(time.RFC3339))
+			timer = time.NewTimer(time.Until(next))
+			fire = timer.C
+		}
+		trigger := "schedule"
+		select {
+		case <-ctx.Done():
+		case <-fire:
+		case <-a.trigger:
+			trigger = "manual"
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		a.runScan(ctx, trigger)
+	}
+}
+
+// Trigger starts a scan now.
+func (a *Agent) Trigger() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.current != nil {
+		return ErrBusy
+	}
+	select {
+	case a.trigger <- struct{}{}:
+		return nil
+	default:
+		return ErrBusy
+	}
+}
+
+// Pause holds the running scan between files.
+func (a *Agent) Pause() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.current == nil {
+		return ErrNotRunning
+	}
+	a.gate.Pause()
+	return nil
+}
+
+// Resume continues a paused scan.
+func (a *Agent) Resume() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.current == nil {
+		return ErrNotRunning
+	}
+	a.gate.Resume()
+	return nil
+}
+
+// Cancel stops the running scan. Its output is closed with what was written
+// so far.
+func (a *Agent) Cancel() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.current == nil {
+		return ErrNotRunning
+	}
+	a.current.cancelled = true
+	a.current.cancel()
+	return nil
+}
+
+// Status reports the agent's state and the progress of the running scan.
+func (a *Agent) Status() Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status := Status{State: StateIdle, Last: a.last}
+	if !a.next.IsZero() {
+		status.NextRun = a.next.Format(time.RFC3339)
+	}
+	if a.current != nil {
+		status.State = StateRunning
+		if a.gate.Paused() {
+			status.State = StatePaused
+		}
+		current := a.current.status
+		current.FilesScanned = a.current.writer.FilesScanned()
+		current.FilesProcessed = a.current.writer.FilesProcessed()
+		status.Current = &current
+	}
+	return status
+}
+
+// runScan runs one scan into output files named after the run's start time.
+func (a *Agent) runScan(ctx context.Context, trigger string) {
+	start := time.Now()
+	// Runs are named to the second, so a run in the same second as the
+	// previous one waits for the next.
+	if wait := a.lastStart.Truncate(time.Second).Add(time.Second).Sub(start); wait > 0 {
+		time.Sleep(wait)
+		start = time.Now()
+	}
+	a.lastStart = start
+	cfg := *a.cfg
+	cfg.RunStamp = start.UTC().Format(config.RunStampLayout)
+	base, ext := config.OutputNameParts(&cfg)
+	status := RunStatus{Output: base + ext, Trigger: trigger, StartTime: start.Format(time.RFC3339)}
+	logger.Infof("Starting %s scan into %s", trigger, status.Output)
+
+	metrics := output.Metrics{StartTime: status.StartTime}
+	var sysInfo *systeminfo.SystemInfo
+	if cfg.CollectSystemInfo || cfg.ScanProcesses {
+		var err error
+		if sysInfo, err = systeminfo.GetSystemInfo(&cfg); err != nil {
+			logger.Errorf("Failed to gather system information: %v", err)
+		}
+	}
+	columns := output.FileColumns{SensitiveTypes: scanner.SensitiveTypeNames(&cfg)}
+	writer, err := output.NewWithColumns(&cfg, sysInfo, &metrics, columns)
+	if err != nil {
+		a.finish(status, ResultFailed, err)
+		return
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	run := &activeRun{status: status, writer: writer, cancel: cancel}
+	a.mu.Lock()
+	a.current = run
+	a.mu.Unlock()
+
+	if cfg.ScanFiles || cfg.ScanSensitive {
+		err = scanner.ScanFilesWithOptions(runCtx, &cfg, &metrics, writer, scanner.RunOptions{
+			DeltaCache:   a.cache,
+			Pause:        &a.gate,
+			HideProgress: true,
+		})
+	}
+	metrics.EndTime = time.Now().Format(time.RFC3339)
+	writer.SetMetrics(metrics)
+	err = errors.Join(err, writer.Close())
+	if flushErr := a.cache.Flush(); flushErr != nil {
+		logger.Warnf("Failed to save delta cache: %v", flushErr)
+	}
+
+	status.EndTime = metrics.EndTime
+	status.FilesScanned = writer.FilesScanned()
+	status.FilesProcessed = writer.FilesProcessed()
+	status.TotalFiles = metrics.TotalFiles
+	a.mu.Lock()
+	a.current = nil
+	a.gate.Resume()
+	cancelled := run.cancelled || ctx.Err() != nil
+	a.mu.Unlock()
+
+	result := ResultCompleted
+	switch {
+	case err != nil:
+		result = ResultFailed
+	case cancelled:
+		result = ResultCancelled
+	}
+	a.finish(status, result, err)
+}
+
+func (a *Agent) finish(status RunStatus, result string, err error) {
+	status.Result = result
+	if err != nil {
+		status.Error = err.Error()
+		logger.Errorf("Scan into %s failed: %v", status.Output, err)
+	} else {
+		logger.Infof("Scan into %s %s: %d files scanned", status.Output, result, status.FilesScanned)
+	}
+	a.mu.Lock()
+	a.last = &status
+	a.mu.Unlock()
+}
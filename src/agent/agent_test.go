@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"safnari/config"
+	"safnari/logger"
+)
+
+// controlClient talks to the control API over the agent socket.
+func controlClient(socket string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+}
+
+func call(t *testing.T, client *http.Client, method, path string) (int, Status) {
+	t.Helper()
+	req, err := http.NewRequest(method, "http://agent"+path, nil)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	var status Status
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatalf("decode status: %v", err)
+		}
+	}
+	return resp.StatusCode, status
+}
+
+// waitForRun polls the status until a run other than previous has finished.
+func waitForRun(t *testing.T, client *http.Client, previous string) *RunStatus {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, status := call(t, client, http.MethodGet, "/status"); status.Last != nil && status.Last.Output != previous && status.State == StateIdle {
+			return status.Last
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for the scan to finish")
+	return nil
+}
+
+func TestAgentRunsTriggeredScansIntoSeparateOutputs(t *testing.T) {
+	logger.Init("error")
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("hello "+name), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	cfg := &config.Config{
+		StartPaths:     []string{dir},
+		OutputFileName: filepath.Join(dir, "scan.ndjson"),
+		OutputFormat:   "json",
+		NiceLevel:      "low",
+		MaxIOPerSecond: 1000,
+		ScanFiles:      true,
+		MaxFileSize:    1024,
+		SkipCount:      true,
+		AgentSchedule:  "0 0 1 1 *",
+		AgentSocket:    socket,
+	}
+	a, err := New(cfg)
+	if err != nil {
+		t.Fatalf("new agent: %v", err)
+	}
+	ln, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected a private control socket, got %v %v", info, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- a.Serve(ctx, ln) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	}()
+
+	client := controlClient(socket)
+	code, status := call(t, client, http.MethodGet, "/status")
+	if code != http.StatusOK || status.State != StateIdle || status.NextRun == "" {
+		t.Fatalf("unexpected initial status %d %+v", code, status)
+	}
+	for _, path := range []string{"/pause", "/resume", "/cancel"} {
+		if code, _ := call(t, client, http.MethodPost, path); code != http.StatusConflict {
+			t.Fatalf("expected %s to conflict while idle, got %d", path, code)
+		}
+	}
+
+	if code, _ := call(t, client, http.MethodPost, "/trigger"); code != http.StatusOK {
+		t.Fatalf("trigger: %d", code)
+	}
+	first := waitForRun(t, client, "")
+	if first.Result != ResultCompleted || first.Trigger != "manual" || first.FilesScanned != 2 {
+		t.Fatalf("unexpected first run %+v", first)
+	}
+	if _, err := os.Stat(first.Output); err != nil {
+		t.Fatalf("expected run output: %v", err)
+	}
+
+	if code, _ := call(t, client, http.MethodPost, "/trigger"); code != http.StatusOK {
+		t.Fatalf("trigger: %d", code)
+	}
+	second := waitForRun(t, client, first.Output)
+	if second.Output == first.Output || second.FilesScanned != 2 {
+		t.Fatalf("expected a separate output that skips the first run's files, got %+v", second)
+	}
+
+	if _, err := Listen(socket); err == nil {
+		t.Fatal("expected a second agent to refuse a socket in use")
+	}
+}
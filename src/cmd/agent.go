@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"safnari/agent"
+	"safnari/config"
+	"safnari/logger"
+)
+
+// runAgent implements "safnari agent", which stays resident and runs scans
+// on the configured schedule. It takes the same flags as a scan.
+func runAgent(args []string, stdout, stderr io.Writer) error {
+	cfg, err := config.LoadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	logger.Init(cfg.LogLevel)
+
+	a, err := agent.New(cfg)
+	if err != nil {
+		return err
+	}
+	ln, err := agent.Listen(cfg.AgentSocket)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger.Infof("Agent running on schedule %q, control socket %s", cfg.AgentSchedule, cfg.AgentSocket)
+	return a.Serve(ctx, ln)
+}
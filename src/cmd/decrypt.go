@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+
+	"safnari/output"
+)
+
+// runDecrypt implements "safnari decrypt", which turns encrypted output files
+// back into plaintext with an age identity file.
+func runDecrypt(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("decrypt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	identityFile := fs.String("identity", "", "age identity file holding the private key (required).")
+	outputName := fs.String("output", "", "Plaintext file for a single input; - writes to stdout (default: input name without .age).")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage:")
+		fmt.Fprintln(stderr, "  safnari decrypt --identity key.txt [--output file] file.age...")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Options:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	inputs := fs.Args()
+	if *identityFile == "" {
+		return errors.New("--identity is required")
+	}
+	if len(inputs) == 0 {
+		return errors.New("no encrypted files given")
+	}
+	if *outputName != "" && len(inputs) > 1 {
+		return errors.New("--output needs exactly one input file")
+	}
+
+	identities, err := readIdentities(*identityFile)
+	if err != nil {
+		return err
+	}
+	if *outputName == "-" {
+		return output.DecryptTo(stdout, inputs[0], identities)
+	}
+	for _, src := range inputs {
+		dst := *outputName
+		if dst == "" {
+			if !strings.HasSuffix(src, ".age") {
+				return fmt.Errorf("%s has no .age suffix; use --output to name the plaintext file", src)
+			}
+			dst = strings.TrimSuffix(src, ".age")
+		}
+		if err := output.DecryptFile(dst, src, identities); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readIdentities(name string) ([]age.Identity, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open identity file: %v", err)
+	}
+	defer f.Close()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity file: %v", err)
+	}
+	return identities, nil
+}
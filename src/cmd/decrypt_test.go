@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestRunDecrypt(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(keyFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatalf("write identity: %v", err)
+	}
+	var encrypted bytes.Buffer
+	enc, err := age.Encrypt(&encrypted, identity.Recipient())
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+	enc.Write([]byte("{\"record_type\":\"file\"}\n"))
+	if err := enc.Close(); err != nil {
+		t.Fatalf("finish encryption: %v", err)
+	}
+	src := filepath.Join(dir, "scan.ndjson.age")
+	if err := os.WriteFile(src, encrypted.Bytes(), 0600); err != nil {
+		t.Fatalf("write encrypted: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if err := runDecrypt([]string{"--identity", keyFile, "--output", "-", src}, &stdout, &stderr); err != nil {
+		t.Fatalf("decrypt to stdout: %v", err)
+	}
+	if stdout.String() != "{\"record_type\":\"file\"}\n" {
+		t.Fatalf("unexpected plaintext %q", stdout.String())
+	}
+	if err := runDecrypt([]string{"--identity", keyFile, src}, &stdout, &stderr); err != nil {
+		t.Fatalf("decrypt to file: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "scan.ndjson")); err != nil || string(data) != stdout.String() {
+		t.Fatalf("unexpected plaintext file %q (%v)", data, err)
+	}
+	if err := runDecrypt([]string{src}, &stdout, &stderr); err == nil {
+		t.Fatal("expected a missing identity to be rejected")
+	}
+}
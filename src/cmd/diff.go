@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"safnari/diff"
+	"safnari/internal/securefile"
+)
+
+// runDiff implements "safnari diff", which compares two NDJSON scans and
+// writes the changes between them as NDJSON change records.
+func runDiff(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	outputName := fs.String("output", "", "File to write change records to (default: stdout).")
+	tempDir := fs.String("temp-dir", "", "Directory for sorting scans that do not fit in memory (default: system temp directory).")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage:")
+		fmt.Fprintln(stderr, "  safnari diff [--output changes.ndjson] old.ndjson new.ndjson")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Options:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("diff needs an old and a new scan file")
+	}
+
+	w := stdout
+	var f *os.File
+	if *outputName != "" {
+		var err error
+		if f, err = securefile.OpenPrivateNoSymlink(*outputName); err != nil {
+			return err
+		}
+		w = f
+	}
+	stats, err := diff.Scans(w, fs.Arg(0), fs.Arg(1), diff.Options{TempDir: *tempDir})
+	if f != nil {
+		err = errors.Join(err, f.Close())
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stderr, "%d added, %d removed, %d modified, %d acl changed, %d new sensitive, %d processes started\n",
+		stats[diff.FileAdded], stats[diff.FileRemoved], stats[diff.FileModified],
+		stats[diff.ACLChanged], stats[diff.SensitiveNew], stats[diff.ProcessStarted])
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"safnari/fuzzy"
+)
+
+// runFuzzyCompare implements "safnari fuzzy-compare", which scores how alike
+// the content behind two fuzzy digests of the same algorithm is.
+func runFuzzyCompare(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("fuzzy-compare", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	algorithm := fs.String("algorithm", "", fmt.Sprintf("Fuzzy hash algorithm of the digests: %s (default: detected from the digests).", strings.Join(fuzzy.Available(), ", ")))
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage:")
+		fmt.Fprintln(stderr, "  safnari fuzzy-compare [--algorithm name] digest-a digest-b")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Options:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("fuzzy-compare needs exactly two digests")
+	}
+	a, b := fs.Arg(0), fs.Arg(1)
+
+	var hasher fuzzy.Hasher
+	var score fuzzy.Score
+	if *algorithm != "" {
+		var ok bool
+		if hasher, ok = fuzzy.Lookup(*algorithm); !ok {
+			return fmt.Errorf("unknown fuzzy hash algorithm %q", *algorithm)
+		}
+		var err error
+		if score, err = hasher.Compare(a, b); err != nil {
+			return err
+		}
+	} else {
+		for _, name := range fuzzy.Available() {
+			candidate, _ := fuzzy.Lookup(name)
+			if s, err := candidate.Compare(a, b); err == nil {
+				hasher, score = candidate, s
+				break
+			}
+		}
+		if hasher == nil {
+			return errors.New("the digests are not of one known fuzzy hash algorithm; pass --algorithm to see why")
+		}
+	}
+
+	if score.Distance {
+		fmt.Fprintf(stdout, "%s distance %d (0 is identical, higher is less alike)\n", hasher.Name(), score.Value)
+	} else {
+		fmt.Fprintf(stdout, "%s similarity %d (100 is identical, 0 is unrelated)\n", hasher.Name(), score.Value)
+	}
+	return nil
+}
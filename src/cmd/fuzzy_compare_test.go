@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunFuzzyCompare(t *testing.T) {
+	a := "24:YDVLfsT1ds/1H9Wpgq7n4XMijV6h4Z3QCw4qat:YD51H9CiMuV6uACwVat"
+	b := "24:YDVLfyvDj+C+opg8DV0Mdle6hPZ3QCw4qat:YDMvDj+C+kBOM+6HACwVat"
+	var stdout, stderr bytes.Buffer
+	if err := runFuzzyCompare([]string{a, b}, &stdout, &stderr); err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	if !strings.HasPrefix(stdout.String(), "ssdeep similarity 54 ") {
+		t.Fatalf("unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+	if err := runFuzzyCompare([]string{"--algorithm", "tlsh", a, b}, &stdout, &stderr); err == nil {
+		t.Fatal("expected ssdeep digests to be rejected as TLSH")
+	}
+	if err := runFuzzyCompare([]string{a, "not-a-digest"}, &stdout, &stderr); err == nil {
+		t.Fatal("expected digests of no known algorithm to be rejected")
+	}
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
@@ -20,7 +23,28 @@ import (
 	"safnari/version"
 )
 
+// subcommands run instead of a scan when named as the first argument.
+var subcommands = map[string]func(args []string, stdout, stderr io.Writer) error{
+	"agent":         runAgent,
+	"decrypt":       runDecrypt,
+	"diff":          runDiff,
+	"fuzzy-compare": runFuzzyCompare,
+	"report":        runReport,
+	"verify":        runVerify,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			err := run(os.Args[2:], os.Stdout, os.Stderr)
+			if err != nil && !errors.Is(err, flag.ErrHelp) {
+				fmt.Fprintf(os.Stderr, "Error: safnari %s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	if err := tracing.Start(); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to start trace: %v\n", err)
 	} else {
@@ -38,7 +62,7 @@ func main() {
 	logger.Init(cfg.LogLevel)
 
 	if cfg.ScanSensitive && cfg.RedactSensitive == "" {
-		logger.Warn("Sensitive data matches will be stored unredacted. Consider --redact-sensitive mask or hash.")
+		logger.Warn("Sensitive data matches will be stored unredacted. Consider --redact-sensitive mask, hmac or token.")
 	}
 
 	if cfg.TraceFlight {
@@ -82,7 +106,8 @@ func main() {
 	}
 
 	// Prepare output
-	writer, err := output.New(cfg, sysInfo, &metrics)
+	columns := output.FileColumns{SensitiveTypes: scanner.SensitiveTypeNames(cfg)}
+	writer, err := output.NewWithColumns(cfg, sysInfo, &metrics, columns)
 	if err != nil {
 		logger.Fatalf("Failed to initialize output: %v", err)
 	}
@@ -114,7 +139,11 @@ func main() {
 
 	// Start scanning
 	if cfg.ScanFiles || cfg.ScanSensitive {
-		err = scanner.ScanFiles(ctx, cfg, &metrics, writer)
+		if cfg.Watch {
+			err = scanner.WatchFiles(ctx, cfg, &metrics, writer)
+		} else {
+			err = scanner.ScanFiles(ctx, cfg, &metrics, writer)
+		}
 		if err != nil {
 			logger.Fatalf("Scanning failed: %v", err)
 		}
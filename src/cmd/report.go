@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"safnari/internal/securefile"
+	"safnari/report"
+)
+
+// runReport implements "safnari report", which summarizes one or more
+// finished NDJSON scans.
+func runReport(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "text", "Report format: "+strings.Join(report.Formats, ", ")+".")
+	outputName := fs.String("output", "", "File to write the report to (default: stdout).")
+	top := fs.Int("top", 10, "Entries in each ranked list.")
+	tlshDistance := fs.Int("tlsh-distance", 30, "Largest TLSH distance at which files count as near duplicates.")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage:")
+		fmt.Fprintln(stderr, "  safnari report [--format text|json|html] [--output report.html] scan.ndjson [scan.ndjson ...]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Options:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !slices.Contains(report.Formats, *format) {
+		return fmt.Errorf("unsupported --format %q (expected %s)", *format, strings.Join(report.Formats, ", "))
+	}
+	if *top <= 0 {
+		return errors.New("--top must be positive")
+	}
+	if *tlshDistance <= 0 {
+		return errors.New("--tlsh-distance must be positive")
+	}
+	if fs.NArg() == 0 {
+		return errors.New("report needs at least one scan file")
+	}
+
+	r, err := report.Scans(fs.Args(), report.Options{Top: *top, TLSHDistance: *tlshDistance})
+	if err != nil {
+		return err
+	}
+	if *outputName == "" {
+		return r.Write(stdout, *format)
+	}
+	f, err := securefile.OpenPrivateNoSymlink(*outputName)
+	if err != nil {
+		return err
+	}
+	return errors.Join(r.Write(f, *format), f.Close())
+}
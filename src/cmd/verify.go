@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+
+	"safnari/output"
+)
+
+// runVerify implements "safnari verify", which checks a signed scan output
+// against its manifest offline.
+func runVerify(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	publicKeyFile := fs.String("public-key", "", "PEM Ed25519 public key the manifest was signed with (required).")
+	identityFile := fs.String("identity", "", "age identity file to read the records of encrypted output (default: none).")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage:")
+		fmt.Fprintln(stderr, "  safnari verify --public-key key.pub [--identity key.txt] scan.manifest.json")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "Options:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *publicKeyFile == "" {
+		return errors.New("--public-key is required")
+	}
+	if fs.NArg() != 1 {
+		return errors.New("verify needs exactly one manifest file")
+	}
+
+	key, err := readPublicKey(*publicKeyFile)
+	if err != nil {
+		return err
+	}
+	var identities []age.Identity
+	if *identityFile != "" {
+		if identities, err = readIdentities(*identityFile); err != nil {
+			return err
+		}
+	}
+	report, err := output.VerifyManifest(fs.Arg(0), key, identities)
+	if err != nil {
+		return err
+	}
+	for _, problem := range report.Problems {
+		fmt.Fprintf(stdout, "FAIL %s\n", problem)
+	}
+	for _, file := range report.Unchecked {
+		fmt.Fprintf(stdout, "SKIP records in %s not checked; pass --identity to decrypt it\n", file)
+	}
+	if !report.OK() {
+		return fmt.Errorf("verification failed with %d problems", len(report.Problems))
+	}
+	fmt.Fprintf(stdout, "OK %d records in %d segments\n", report.Records, report.Segments)
+	return nil
+}
+
+func readPublicKey(name string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key file: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("public key file %s holds no PEM public key", name)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key must be an Ed25519 key, got %T", key)
+	}
+	return publicKey, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"safnari/config"
+	"safnari/logger"
+	"safnari/output"
+	"safnari/systeminfo"
+)
+
+func TestRunVerify(t *testing.T) {
+	logger.Init("error")
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "sign.pub")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	cfg := &config.Config{OutputFileName: filepath.Join(dir, "scan.ndjson"), OutputFormat: "json", SignKey: private}
+	w, err := output.New(cfg, &systeminfo.SystemInfo{}, &output.Metrics{})
+	if err != nil {
+		t.Fatalf("output init: %v", err)
+	}
+	if err := w.WriteData(map[string]any{"path": "/etc/passwd"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	manifestPath := filepath.Join(dir, "scan"+output.ManifestSuffix)
+
+	var stdout, stderr bytes.Buffer
+	if err := runVerify([]string{"--public-key", keyFile, manifestPath}, &stdout, &stderr); err != nil {
+		t.Fatalf("verify: %v (%s)", err, stdout.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "OK 3 records in 1 segments") {
+		t.Fatalf("unexpected output %q", stdout.String())
+	}
+
+	data, err := os.ReadFile(cfg.OutputFileName)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	tampered := bytes.Replace(data, []byte("/etc/passwd"), []byte("/etc/shadow"), 1)
+	if err := os.WriteFile(cfg.OutputFileName, tampered, 0600); err != nil {
+		t.Fatalf("write output: %v", err)
+	}
+	stdout.Reset()
+	if err := runVerify([]string{"--public-key", keyFile, manifestPath}, &stdout, &stderr); err == nil {
+		t.Fatal("expected tampered output to fail verification")
+	}
+	if !strings.Contains(stdout.String(), "FAIL record 2 (scan.ndjson line 2) is altered") {
+		t.Fatalf("expected the altered record to be reported, got %q", stdout.String())
+	}
+}
@@ -1,7 +1,14 @@
 package config
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -11,6 +18,10 @@ import (
 	"strings"
 	"time"
 
+	"filippo.io/age"
+
+	"safnari/container"
+	"safnari/schedule"
 	"safnari/version"
 )
 
@@ -21,6 +32,9 @@ const (
 	maxSensitiveScanBytes    = 256 * 1024 * 1024
 	maxSensitiveWindowBytes  = 16 * 1024 * 1024
 	maxTraceFlightBufferSize = 512 * 1024 * 1024
+	minRedactKeyBytes        = 16
+	redactKeyEnv             = "SAFNARI_REDACT_KEY"
+	encryptedExt             = ".age"
 )
 
 type Config struct {
@@ -41,6 +55,7 @@ type Config struct {
 	ExcludePatterns         []string          `json:"exclude_patterns"`
 	MaxFileSize             int64             `json:"max_file_size"`
 	ContentScanMaxBytes     int64             `json:"content_scan_max_bytes"`
+	ExtractText             bool              `json:"extract_text"`
 	MaxOutputFileSize       int64             `json:"max_output_file_size"`
 	LogLevel                string            `json:"log_level"`
 	MaxIOPerSecond          int               `json:"max_io_per_second"`
@@ -64,6 +79,12 @@ type Config struct {
 	SensitiveMaxTotal       int               `json:"sensitive_max_total_matches"`
 	MetadataMaxBytes        int64             `json:"metadata_max_bytes"`
 	RedactSensitive         string            `json:"redact_sensitive"`
+	RedactKeyFile           string            `json:"redact_key_file"`
+	RedactKey               []byte            `json:"-"`
+	RedactKeyID             string            `json:"-"`
+	EncryptRecipients       []string          `json:"encrypt_recipients"`
+	SignKeyFile             string            `json:"sign_key_file"`
+	SignKey                 []byte            `json:"-"`
 	CollectXattrs           bool              `json:"collect_xattrs"`
 	XattrMaxValueSize       int               `json:"xattr_max_value_size"`
 	CollectACL              bool              `json:"collect_acl"`
@@ -72,6 +93,12 @@ type Config struct {
 	CollectGroups           bool              `json:"collect_groups"`
 	CollectAdmins           bool              `json:"collect_admins"`
 	ScanADS                 bool              `json:"scan_ads"`
+	ScanArchives            bool              `json:"scan_archives"`
+	ArchiveMaxDepth         int               `json:"archive_max_depth"`
+	ArchiveMaxMembers       int               `json:"archive_max_members"`
+	ArchiveMaxBytes         int64             `json:"archive_max_bytes"`
+	ExternalModules         []ExternalModule  `json:"external_modules"`
+	RuleFiles               []string          `json:"rule_files"`
 	AutoTune                bool              `json:"auto_tune"`
 	AutoTuneInterval        time.Duration     `json:"auto_tune_interval"`
 	AutoTuneTargetCPU       float64           `json:"auto_tune_target_cpu"`
@@ -83,6 +110,12 @@ type Config struct {
 	SensitiveLongtail       string            `json:"sensitive_longtail"`
 	SensitiveMatchMode      string            `json:"sensitive_match_mode"`
 	SensitiveWindowBytes    int               `json:"sensitive_window_bytes"`
+	SensitiveEntropyBits    float64           `json:"sensitive_entropy_threshold"`
+	SensitiveEntropyHexBits float64           `json:"sensitive_entropy_hex_threshold"`
+	SensitiveEntropyMinLen  int               `json:"sensitive_entropy_min_length"`
+	SensitiveMinConfidence  float64           `json:"sensitive_min_confidence"`
+	SensitiveProximity      bool              `json:"sensitive_keyword_proximity"`
+	MatchLocations          bool              `json:"match_locations"`
 	ContentReadMode         string            `json:"content_read_mode"`
 	StreamChunkSize         int               `json:"stream_chunk_size"`
 	StreamOverlapBytes      int               `json:"stream_overlap_bytes"`
@@ -104,13 +137,92 @@ type Config struct {
 	TraceFlightFile         string            `json:"trace_flight_file"`
 	TraceFlightMaxBytes     uint64            `json:"trace_flight_max_bytes"`
 	TraceFlightMinAge       time.Duration     `json:"trace_flight_min_age"`
+	AgentSchedule           string            `json:"agent_schedule"`
+	AgentSocket             string            `json:"agent_socket"`
+	Watch                   bool              `json:"watch"`
+	WatchBackend            string            `json:"watch_backend"`
+	WatchDebounce           time.Duration     `json:"watch_debounce"`
+	Duplicates              bool              `json:"duplicates"`
+	DuplicateHash           string            `json:"duplicate_hash"`
+	SimilarityDistance      int               `json:"similarity_distance"`
+	HashSets                map[string]string `json:"hash_sets"`
+	HashSetAllowlist        []string          `json:"hash_set_allowlist"`
+	ScanContainers          bool              `json:"scan_containers"`
+	ContainerImages         []string          `json:"container_images"`
+	DockerRoot              string            `json:"docker_root"`
+	ContainerdRoot          string            `json:"containerd_root"`
+	RunStamp                string            `json:"-"`
 	ConcurrencySet          bool              `json:"-"`
 	MaxIOSet                bool              `json:"-"`
 }
 
+// ExternalModule describes an executable that is run once per file and
+// returns JSON that is stored under the record's extensions map. A response
+// larger than MaxResponseBytes (1 MiB when zero) fails the call.
+type ExternalModule struct {
+	Name             string   `json:"name"`
+	Command          string   `json:"command"`
+	Args             []string `json:"args"`
+	TimeoutMs        int      `json:"timeout_ms"`
+	MaxContentBytes  int64    `json:"max_content_bytes"`
+	MaxResponseBytes int64    `json:"max_response_bytes"`
+}
+
+// outputExtensions lists the supported output formats and the extension each
+// uses when no output file name is given.
+var outputExtensions = map[string]string{
+	"json":    ".ndjson",
+	"sqlite":  ".sqlite",
+	"csv":     ".csv",
+	"parquet": ".parquet",
+}
+
+// OutputExtension returns the default file extension for an output format.
+func OutputExtension(format string) string {
+	if ext, ok := outputExtensions[format]; ok {
+		return ext
+	}
+	return outputExtensions["json"]
+}
+
+// OutputNameParts splits the output file name into the base that rotated
+// files and the manifest are named after, and the extension every output file
+// ends in, including .age when output is encrypted. The base of an agent run
+// ends in "-" and the run's RunStamp.
+func OutputNameParts(cfg *Config) (base, ext string) {
+	name := cfg.OutputFileName
+	encrypted := len(cfg.EncryptRecipients) > 0
+	if encrypted {
+		name = strings.TrimSuffix(name, encryptedExt)
+	}
+	ext = filepath.Ext(name)
+	base = strings.TrimSuffix(name, ext)
+	if ext == "" {
+		ext = OutputExtension(cfg.OutputFormat)
+	}
+	if encrypted {
+		ext += encryptedExt
+	}
+	if cfg.RunStamp != "" {
+		base += "-" + cfg.RunStamp
+	}
+	return base, ext
+}
+
+// RunStampLayout is the time layout of Config.RunStamp.
+const RunStampLayout = "20060102T150405Z"
+
+// LoadConfig builds the configuration from the command line arguments.
 func LoadConfig() (*Config, error) {
+	return LoadConfigArgs(os.Args[1:])
+}
+
+// LoadConfigArgs builds the configuration from args, the flags of a scan
+// without the program name.
+func LoadConfigArgs(args []string) (*Config, error) {
 	now := time.Now().UTC()
 	timestamp := now.Format("20060102-150405")
+	defaultOutput := fmt.Sprintf("safnari-%s-%d.ndjson", timestamp, now.Unix())
 	cfg := &Config{
 		StartPaths:              []string{"."},
 		ScanFiles:               true,
@@ -119,7 +231,7 @@ func LoadConfig() (*Config, error) {
 		CollectSystemInfo:       false,
 		CheckUpdates:            false,
 		OutputFormat:            "json",
-		OutputFileName:          fmt.Sprintf("safnari-%s-%d.ndjson", timestamp, now.Unix()),
+		OutputFileName:          defaultOutput,
 		ConcurrencyLevel:        runtime.NumCPU(),
 		NiceLevel:               "medium",
 		HashAlgorithms:          []string{"md5", "sha1", "sha256"},
@@ -145,6 +257,7 @@ func LoadConfig() (*Config, error) {
 		SensitiveMaxTotal:       1000,
 		MetadataMaxBytes:        1 * 1024 * 1024,
 		RedactSensitive:         "mask",
+		EncryptRecipients:       []string{},
 		CollectXattrs:           true,
 		XattrMaxValueSize:       1024,
 		CollectACL:              true,
@@ -153,6 +266,10 @@ func LoadConfig() (*Config, error) {
 		CollectGroups:           true,
 		CollectAdmins:           true,
 		ScanADS:                 false,
+		ScanArchives:            false,
+		ArchiveMaxDepth:         3,
+		ArchiveMaxMembers:       10000,
+		ArchiveMaxBytes:         256 * 1024 * 1024,
 		AutoTune:                true,
 		AutoTuneInterval:        5 * time.Second,
 		AutoTuneTargetCPU:       60,
@@ -164,6 +281,9 @@ func LoadConfig() (*Config, error) {
 		SensitiveLongtail:       "sampled",
 		SensitiveMatchMode:      "all",
 		SensitiveWindowBytes:    4096,
+		SensitiveEntropyBits:    4.0,
+		SensitiveEntropyHexBits: 3.0,
+		SensitiveEntropyMinLen:  20,
 		ContentReadMode:         "auto",
 		StreamChunkSize:         256 * 1024,
 		StreamOverlapBytes:      512,
@@ -185,6 +305,13 @@ func LoadConfig() (*Config, error) {
 		TraceFlightFile:         "trace-flight.out",
 		TraceFlightMaxBytes:     0,
 		TraceFlightMinAge:       0,
+		AgentSocket:             "safnari-agent.sock",
+		WatchBackend:            "auto",
+		WatchDebounce:           500 * time.Millisecond,
+		DockerRoot:              container.DefaultDockerRoot,
+		ContainerdRoot:          container.DefaultContainerdRoot,
+		DuplicateHash:           "sha256",
+		SimilarityDistance:      30,
 	}
 
 	startPath := flag.String("path", strings.Join(cfg.StartPaths, ","), fmt.Sprintf("Comma-separated list of start paths to scan (default: %s).", strings.Join(cfg.StartPaths, ",")))
@@ -194,7 +321,7 @@ func LoadConfig() (*Config, error) {
 	scanProcesses := flag.Bool("scan-processes", cfg.ScanProcesses, fmt.Sprintf("Enable process scanning (default: %t).", cfg.ScanProcesses))
 	collectSystemInfo := flag.Bool("collect-system-info", cfg.CollectSystemInfo, fmt.Sprintf("Collect system information (default: %t).", cfg.CollectSystemInfo))
 	checkUpdates := flag.Bool("check-updates", cfg.CheckUpdates, fmt.Sprintf("Check GitHub for newer releases on startup (default: %t).", cfg.CheckUpdates))
-	format := flag.String("format", cfg.OutputFormat, fmt.Sprintf("Output format: json (default: %s).", cfg.OutputFormat))
+	format := flag.String("format", cfg.OutputFormat, fmt.Sprintf("Output format: json, sqlite, csv or parquet (default: %s).", cfg.OutputFormat))
 	output := flag.String("output", cfg.OutputFileName, "Output file name (default: safnari-<timestamp>-<unix>.ndjson).")
 	concurrency := flag.Int("concurrency", cfg.ConcurrencyLevel, fmt.Sprintf("Concurrency level (default: %d).", cfg.ConcurrencyLevel))
 	nice := flag.String("nice", cfg.NiceLevel, fmt.Sprintf("Nice level: high, medium, or low (default: %s).", cfg.NiceLevel))
@@ -211,6 +338,7 @@ func LoadConfig() (*Config, error) {
 			cfg.ContentScanMaxBytes,
 		),
 	)
+	extractText := flag.Bool("extract-text", cfg.ExtractText, fmt.Sprintf("Extract plain text from DOCX, XLSX, PPTX and PDF files for content search and sensitive scans (default: %t).", cfg.ExtractText))
 	maxOutputFileSize := flag.Int64("max-output-file-size", cfg.MaxOutputFileSize, fmt.Sprintf("Maximum output file size before rotation in bytes (default: %d).", cfg.MaxOutputFileSize))
 	logLevel := flag.String("log-level", cfg.LogLevel, fmt.Sprintf("Log level: debug, info, warn, error, fatal, or panic (default: %s).", cfg.LogLevel))
 	maxIO := flag.Int("max-io-per-second", cfg.MaxIOPerSecond, fmt.Sprintf("Maximum disk I/O operations per second (default: %d).", cfg.MaxIOPerSecond))
@@ -244,8 +372,10 @@ func LoadConfig() (*Config, error) {
 	includeDataTypes := flag.String("include-sensitive-data-types", "", "Comma-separated list of sensitive data types to include when scanning (default: none). Use 'all' to include all built-in types.")
 	excludeDataTypes := flag.String("exclude-sensitive-data-types", "", "Comma-separated list of sensitive data types to exclude when scanning.")
 	customPatterns := flag.String("custom-patterns", "", "Custom sensitive data patterns as a JSON object mapping names to regexes")
+	ruleFiles := flag.String("rules", "", "Comma-separated list of signature rule files to evaluate against each file (default: none).")
+	externalModules := flag.String("external-modules", "", "External file modules as a JSON array of {name, command, args, timeout_ms, max_content_bytes, max_response_bytes} objects")
 	fuzzyHash := flag.Bool("fuzzy-hash", cfg.FuzzyHash, fmt.Sprintf("Enable fuzzy hashing (default: %t).", cfg.FuzzyHash))
-	fuzzyAlgorithms := flag.String("fuzzy-algorithms", strings.Join(cfg.FuzzyAlgorithms, ","), "Comma-separated list of fuzzy hash algorithms (default: tlsh when fuzzy hashing enabled).")
+	fuzzyAlgorithms := flag.String("fuzzy-algorithms", strings.Join(cfg.FuzzyAlgorithms, ","), "Comma-separated list of fuzzy hash algorithms: tlsh, ssdeep, sdsim (default: tlsh when fuzzy hashing enabled).")
 	fuzzyMinSize := flag.Int64("fuzzy-min-size", cfg.FuzzyMinSize, fmt.Sprintf("Minimum file size in bytes for fuzzy hashing (default: %d).", cfg.FuzzyMinSize))
 	fuzzyMaxSize := flag.Int64("fuzzy-max-size", cfg.FuzzyMaxSize, fmt.Sprintf("Maximum file size in bytes for fuzzy hashing (default: %d).", cfg.FuzzyMaxSize))
 	deltaScan := flag.Bool("delta-scan", cfg.DeltaScan, fmt.Sprintf("Only scan files modified since the last run (default: %t).", cfg.DeltaScan))
@@ -254,15 +384,22 @@ func LoadConfig() (*Config, error) {
 	deltaCacheMaxBytes := flag.Int64("delta-cache-max-bytes", cfg.DeltaCacheMaxBytes, fmt.Sprintf("Maximum on-disk bytes used by the delta cache (default: %d).", cfg.DeltaCacheMaxBytes))
 	lastScanFile := flag.String("last-scan-file", cfg.LastScanFile, fmt.Sprintf("Path to timestamp file for delta scans (default: %s).", cfg.LastScanFile))
 	lastScanTime := flag.String("last-scan", cfg.LastScanTime, "Timestamp of last scan in RFC3339 format (default: none).")
-	redactSensitive := flag.String("redact-sensitive", cfg.RedactSensitive, "Redact sensitive data in output: mask or hash (default: none).")
+	redactSensitive := flag.String("redact-sensitive", cfg.RedactSensitive, "Redact sensitive data in output: mask, hash, hmac or token (default: none).")
+	redactKeyFile := flag.String("redact-key-file", cfg.RedactKeyFile, fmt.Sprintf("File holding the key for --redact-sensitive hmac; %s is used when unset (default: none).", redactKeyEnv))
+	encryptRecipients := flag.String("encrypt-recipients", strings.Join(cfg.EncryptRecipients, ","), "Comma-separated age X25519 recipients to encrypt output files to (default: none).")
+	signKeyFile := flag.String("sign-key-file", cfg.SignKeyFile, "PEM Ed25519 private key to hash-chain records and sign the output manifest with (default: none).")
 	collectXattrs := flag.Bool("collect-xattrs", cfg.CollectXattrs, fmt.Sprintf("Collect extended attributes (default: %t).", cfg.CollectXattrs))
 	xattrMaxValueSize := flag.Int("xattr-max-value-size", cfg.XattrMaxValueSize, fmt.Sprintf("Max bytes of xattr values to capture (default: %d).", cfg.XattrMaxValueSize))
 	collectACL := flag.Bool("collect-acl", cfg.CollectACL, fmt.Sprintf("Collect ACLs (default: %t).", cfg.CollectACL))
 	collectScheduled := flag.Bool("collect-scheduled-tasks", cfg.CollectScheduled, fmt.Sprintf("Collect scheduled tasks (default: %t).", cfg.CollectScheduled))
 	collectUsers := flag.Bool("collect-users", cfg.CollectUsers, fmt.Sprintf("Collect local users (default: %t).", cfg.CollectUsers))
 	collectGroups := flag.Bool("collect-groups", cfg.CollectGroups, fmt.Sprintf("Collect local groups (default: %t).", cfg.CollectGroups))
-	collectAdmins := flag.Bool("collect-admins", cfg.CollectAdmins, fmt.Sprintf("Collect admin users/groups (default: %t).", cfg.CollectAdmins))
+	collectAdmins := flag.Bool("collect-admins", cfg.CollectAdmins, fmt.Sprintf("Collect accounts with administrative or sudo rights (default: %t).", cfg.CollectAdmins))
 	scanADS := flag.Bool("scan-ads", cfg.ScanADS, fmt.Sprintf("Scan Windows alternate data streams (default: %t).", cfg.ScanADS))
+	scanArchives := flag.Bool("scan-archives", cfg.ScanArchives, fmt.Sprintf("Scan members of ZIP, TAR and gzip archives (default: %t).", cfg.ScanArchives))
+	archiveMaxDepth := flag.Int("archive-max-depth", cfg.ArchiveMaxDepth, fmt.Sprintf("Maximum nesting depth for archive scanning (default: %d).", cfg.ArchiveMaxDepth))
+	archiveMaxMembers := flag.Int("archive-max-members", cfg.ArchiveMaxMembers, fmt.Sprintf("Maximum members scanned per top-level archive (default: %d).", cfg.ArchiveMaxMembers))
+	archiveMaxBytes := flag.Int64("archive-max-bytes", cfg.ArchiveMaxBytes, fmt.Sprintf("Maximum decompressed bytes read per top-level archive (default: %d).", cfg.ArchiveMaxBytes))
 	autoTune := flag.Bool("auto-tune", cfg.AutoTune, fmt.Sprintf("Auto-tune resource usage (default: %t).", cfg.AutoTune))
 	autoTuneInterval := flag.Duration("auto-tune-interval", cfg.AutoTuneInterval, "Auto-tune interval (default: 5s).")
 	autoTuneTargetCPU := flag.Float64("auto-tune-target-cpu", cfg.AutoTuneTargetCPU, "Auto-tune target CPU percent (default: 60).")
@@ -302,6 +439,12 @@ func LoadConfig() (*Config, error) {
 		cfg.SensitiveWindowBytes,
 		"Window size in bytes for long-tail hybrid scans (default: 4096).",
 	)
+	entropyBits := flag.Float64("sensitive-entropy-threshold", cfg.SensitiveEntropyBits, fmt.Sprintf("Minimum Shannon entropy in bits per character for base64-like high_entropy_string tokens (default: %.1f).", cfg.SensitiveEntropyBits))
+	entropyHexBits := flag.Float64("sensitive-entropy-hex-threshold", cfg.SensitiveEntropyHexBits, fmt.Sprintf("Minimum Shannon entropy in bits per character for hex high_entropy_string tokens (default: %.1f).", cfg.SensitiveEntropyHexBits))
+	entropyMinLen := flag.Int("sensitive-entropy-min-length", cfg.SensitiveEntropyMinLen, fmt.Sprintf("Minimum token length for high_entropy_string matches (default: %d).", cfg.SensitiveEntropyMinLen))
+	minConfidence := flag.Float64("sensitive-min-confidence", cfg.SensitiveMinConfidence, fmt.Sprintf("Drop sensitive matches scoring below this confidence, 0 to 1, before they count against limits; 0.3 drops matches failing checksum or structural checks (default: %g).", cfg.SensitiveMinConfidence))
+	keywordProximity := flag.Bool("sensitive-keyword-proximity", cfg.SensitiveProximity, "Raise or lower sensitive match confidence based on type keywords just before the match (default: false).")
+	matchLocations := flag.Bool("match-locations", cfg.MatchLocations, "Record offset, line, column and a redacted context snippet for each sensitive match and search hit (default: false).")
 	contentReadMode := flag.String("content-read-mode", cfg.ContentReadMode, "Content read mode: auto, stream, or mmap (default: auto).")
 	streamChunkSize := flag.Int("stream-chunk-size", cfg.StreamChunkSize, "Streaming chunk size in bytes (default: 262144).")
 	streamOverlapBytes := flag.Int("stream-overlap-bytes", cfg.StreamOverlapBytes, "Streaming overlap in bytes between chunks (default: 512).")
@@ -335,10 +478,24 @@ func LoadConfig() (*Config, error) {
 	traceFlightFile := flag.String("trace-flight-file", cfg.TraceFlightFile, fmt.Sprintf("Flight recorder output file (default: %s).", cfg.TraceFlightFile))
 	traceFlightMaxBytes := flag.Uint64("trace-flight-max-bytes", cfg.TraceFlightMaxBytes, "Max bytes for flight recorder buffer (default: 0 for runtime default).")
 	traceFlightMinAge := flag.Duration("trace-flight-min-age", cfg.TraceFlightMinAge, "Minimum age of trace events to retain (default: 0).")
+	agentSchedule := flag.String("agent-schedule", cfg.AgentSchedule, "Cron expression for scans run by safnari agent (default: none).")
+	agentSocket := flag.String("agent-socket", cfg.AgentSocket, fmt.Sprintf("Unix socket for the safnari agent control API (default: %s).", cfg.AgentSocket))
+	watch := flag.Bool("watch", cfg.Watch, fmt.Sprintf("After the scan, keep watching the paths and record changes as they happen; Linux only (default: %t).", cfg.Watch))
+	watchBackend := flag.String("watch-backend", cfg.WatchBackend, fmt.Sprintf("Watch backend: auto, inotify or fanotify (default: %s).", cfg.WatchBackend))
+	watchDebounce := flag.Duration("watch-debounce", cfg.WatchDebounce, fmt.Sprintf("Quiet period before a changed path is processed (default: %s).", cfg.WatchDebounce))
+	duplicates := flag.Bool("duplicates", cfg.Duplicates, fmt.Sprintf("Group duplicate files and cluster near-duplicates by TLSH at the end of the scan (default: %t).", cfg.Duplicates))
+	duplicateHash := flag.String("duplicate-hash", cfg.DuplicateHash, fmt.Sprintf("Hash algorithm that identifies duplicate files (default: %s).", cfg.DuplicateHash))
+	similarityDistance := flag.Int("similarity-distance", cfg.SimilarityDistance, fmt.Sprintf("Largest TLSH distance at which files count as near-duplicates (default: %d).", cfg.SimilarityDistance))
+	hashSets := flag.String("hash-sets", "", "Known-file hash sets as comma-separated name=path pairs; each file may be a hex digest list, an NSRL RDS CSV file or an NSRL RDS SQLite database (default: none).")
+	hashSetAllowlist := flag.String("hash-set-allowlist", "", "Comma-separated names of hash sets holding known-good files; matching files are hashed but not content-scanned (default: none).")
+	scanContainers := flag.Bool("scan-containers", cfg.ScanContainers, fmt.Sprintf("Scan the root filesystems of local Docker and containerd containers, layer by layer (default: %t).", cfg.ScanContainers))
+	containerImages := flag.String("container-images", "", "Comma-separated OCI image layouts or image tarballs, as directories or tar files, to scan layer by layer (default: none).")
+	dockerRoot := flag.String("docker-root", cfg.DockerRoot, fmt.Sprintf("Docker data root read by --scan-containers (default: %s).", cfg.DockerRoot))
+	containerdRoot := flag.String("containerd-root", cfg.ContainerdRoot, fmt.Sprintf("containerd data root read by --scan-containers (default: %s).", cfg.ContainerdRoot))
 	showVersion := flag.Bool("version", false, "Print version and exit")
 
 	flag.Usage = displayHelp
-	flag.Parse()
+	_ = flag.CommandLine.Parse(args)
 
 	if *showVersion {
 		fmt.Printf("Safnari version %s\n", version.Version)
@@ -352,10 +509,13 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	var parseErr error
+	pathSet := false
 	flag.Visit(func(f *flag.Flag) {
 		switch f.Name {
 		case "path":
 			cfg.StartPaths = parseCommaSeparated(*startPath)
+			pathSet = true
 		case "all-drives":
 			cfg.AllDrives = *allDrives
 		case "scan-files":
@@ -389,6 +549,8 @@ func LoadConfig() (*Config, error) {
 			cfg.MaxFileSize = *maxFileSize
 		case "content-scan-max-bytes":
 			cfg.ContentScanMaxBytes = *contentScanMaxBytes
+		case "extract-text":
+			cfg.ExtractText = *extractText
 		case "max-output-file-size":
 			cfg.MaxOutputFileSize = *maxOutputFileSize
 		case "log-level":
@@ -404,6 +566,14 @@ func LoadConfig() (*Config, error) {
 			cfg.ExcludeDataTypes = parseCommaSeparated(*excludeDataTypes)
 		case "custom-patterns":
 			cfg.CustomPatterns = parseCustomPatterns(*customPatterns)
+		case "rules":
+			cfg.RuleFiles = parseCommaSeparated(*ruleFiles)
+		case "external-modules":
+			modules, err := parseExternalModules(*externalModules)
+			if err != nil {
+				parseErr = err
+			}
+			cfg.ExternalModules = modules
 		case "fuzzy-hash":
 			cfg.FuzzyHash = *fuzzyHash
 		case "fuzzy-algorithms":
@@ -434,6 +604,12 @@ func LoadConfig() (*Config, error) {
 			cfg.MetadataMaxBytes = *metadataMaxBytes
 		case "redact-sensitive":
 			cfg.RedactSensitive = strings.ToLower(*redactSensitive)
+		case "redact-key-file":
+			cfg.RedactKeyFile = *redactKeyFile
+		case "encrypt-recipients":
+			cfg.EncryptRecipients = parseCommaSeparated(*encryptRecipients)
+		case "sign-key-file":
+			cfg.SignKeyFile = *signKeyFile
 		case "collect-xattrs":
 			cfg.CollectXattrs = *collectXattrs
 		case "xattr-max-value-size":
@@ -450,6 +626,14 @@ func LoadConfig() (*Config, error) {
 			cfg.CollectAdmins = *collectAdmins
 		case "scan-ads":
 			cfg.ScanADS = *scanADS
+		case "scan-archives":
+			cfg.ScanArchives = *scanArchives
+		case "archive-max-depth":
+			cfg.ArchiveMaxDepth = *archiveMaxDepth
+		case "archive-max-members":
+			cfg.ArchiveMaxMembers = *archiveMaxMembers
+		case "archive-max-bytes":
+			cfg.ArchiveMaxBytes = *archiveMaxBytes
 		case "auto-tune":
 			cfg.AutoTune = *autoTune
 		case "auto-tune-interval":
@@ -472,6 +656,18 @@ func LoadConfig() (*Config, error) {
 			cfg.SensitiveMatchMode = strings.ToLower(strings.TrimSpace(*sensitiveMatchMode))
 		case "sensitive-window-bytes":
 			cfg.SensitiveWindowBytes = *sensitiveWindowBytes
+		case "sensitive-entropy-threshold":
+			cfg.SensitiveEntropyBits = *entropyBits
+		case "sensitive-entropy-hex-threshold":
+			cfg.SensitiveEntropyHexBits = *entropyHexBits
+		case "sensitive-entropy-min-length":
+			cfg.SensitiveEntropyMinLen = *entropyMinLen
+		case "sensitive-min-confidence":
+			cfg.SensitiveMinConfidence = *minConfidence
+		case "sensitive-keyword-proximity":
+			cfg.SensitiveProximity = *keywordProximity
+		case "match-locations":
+			cfg.MatchLocations = *matchLocations
 		case "content-read-mode":
 			cfg.ContentReadMode = strings.ToLower(strings.TrimSpace(*contentReadMode))
 		case "stream-chunk-size":
@@ -514,9 +710,50 @@ func LoadConfig() (*Config, error) {
 			cfg.TraceFlightMaxBytes = *traceFlightMaxBytes
 		case "trace-flight-min-age":
 			cfg.TraceFlightMinAge = *traceFlightMinAge
+		case "agent-schedule":
+			cfg.AgentSchedule = *agentSchedule
+		case "agent-socket":
+			cfg.AgentSocket = *agentSocket
+		case "watch":
+			cfg.Watch = *watch
+		case "watch-backend":
+			cfg.WatchBackend = *watchBackend
+		case "watch-debounce":
+			cfg.WatchDebounce = *watchDebounce
+		case "duplicates":
+			cfg.Duplicates = *duplicates
+		case "duplicate-hash":
+			cfg.DuplicateHash = *duplicateHash
+		case "similarity-distance":
+			cfg.SimilarityDistance = *similarityDistance
+		case "hash-sets":
+			sets, err := parseHashSets(*hashSets)
+			if err != nil {
+				parseErr = err
+			}
+			cfg.HashSets = sets
+		case "hash-set-allowlist":
+			cfg.HashSetAllowlist = parseCommaSeparated(*hashSetAllowlist)
+		case "scan-containers":
+			cfg.ScanContainers = *scanContainers
+		case "container-images":
+			cfg.ContainerImages = parseCommaSeparated(*containerImages)
+		case "docker-root":
+			cfg.DockerRoot = *dockerRoot
+		case "containerd-root":
+			cfg.ContainerdRoot = *containerdRoot
 		}
 	})
+	if parseErr != nil {
+		return nil, parseErr
+	}
 	cfg.OutputFormat = strings.ToLower(cfg.OutputFormat)
+	if ext, ok := outputExtensions[cfg.OutputFormat]; ok && cfg.OutputFileName == defaultOutput {
+		cfg.OutputFileName = strings.TrimSuffix(defaultOutput, ".ndjson") + ext
+	}
+	if len(cfg.EncryptRecipients) > 0 && !strings.HasSuffix(cfg.OutputFileName, encryptedExt) {
+		cfg.OutputFileName += encryptedExt
+	}
 	cfg.RedactSensitive = strings.ToLower(strings.TrimSpace(cfg.RedactSensitive))
 	cfg.PerfProfile = strings.ToLower(strings.TrimSpace(cfg.PerfProfile))
 	cfg.SensitiveEngine = strings.ToLower(strings.TrimSpace(cfg.SensitiveEngine))
@@ -524,6 +761,8 @@ func LoadConfig() (*Config, error) {
 	cfg.SensitiveMatchMode = strings.ToLower(strings.TrimSpace(cfg.SensitiveMatchMode))
 	cfg.ContentReadMode = strings.ToLower(strings.TrimSpace(cfg.ContentReadMode))
 	cfg.JSONLayout = strings.ToLower(strings.TrimSpace(cfg.JSONLayout))
+	cfg.WatchBackend = strings.ToLower(strings.TrimSpace(cfg.WatchBackend))
+	cfg.DuplicateHash = strings.ToLower(strings.TrimSpace(cfg.DuplicateHash))
 	if cfg.RedactSensitive == "none" {
 		cfg.RedactSensitive = ""
 	}
@@ -579,12 +818,32 @@ func LoadConfig() (*Config, error) {
 	if !containsString(cfg.HashAlgorithms, "sha256") {
 		cfg.HashAlgorithms = append(cfg.HashAlgorithms, "sha256")
 	}
+	if cfg.Duplicates && cfg.DuplicateHash != "" && !containsString(cfg.HashAlgorithms, cfg.DuplicateHash) {
+		cfg.HashAlgorithms = append(cfg.HashAlgorithms, cfg.DuplicateHash)
+	}
 	if cfg.TraceFlight && cfg.TraceFlightFile == "" {
 		cfg.TraceFlightFile = "trace-flight.out"
 	}
 	if len(cfg.StartPaths) == 0 {
 		cfg.StartPaths = []string{"."}
 	}
+	// Scanning containers or images replaces the default start path rather
+	// than adding the working directory to the scan.
+	if cfg.ScansContainers() && !pathSet && len(cfg.StartPaths) == 1 && cfg.StartPaths[0] == "." {
+		cfg.StartPaths = nil
+	}
+
+	if cfg.RedactSensitive == "hmac" {
+		if err := cfg.loadRedactKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.SignKeyFile != "" {
+		if err := cfg.loadSignKey(); err != nil {
+			return nil, err
+		}
+	}
 
 	if err := cfg.validate(); err != nil {
 		return nil, err
@@ -593,6 +852,62 @@ func LoadConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// loadRedactKey reads the HMAC redaction key from RedactKeyFile, or from the
+// environment when no file is set, and derives the key identifier that is
+// stamped into the output.
+func (cfg *Config) loadRedactKey() error {
+	var key []byte
+	if cfg.RedactKeyFile != "" {
+		data, err := os.ReadFile(cfg.RedactKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read redact key file: %v", err)
+		}
+		key = bytes.TrimSpace(data)
+	} else {
+		key = []byte(strings.TrimSpace(os.Getenv(redactKeyEnv)))
+	}
+	if len(key) == 0 {
+		return nil
+	}
+	if len(key) < minRedactKeyBytes {
+		return fmt.Errorf("redact key must be at least %d bytes", minRedactKeyBytes)
+	}
+	cfg.RedactKey = key
+	cfg.RedactKeyID = RedactKeyID(key)
+	return nil
+}
+
+// loadSignKey reads the Ed25519 manifest signing key from SignKeyFile, a
+// PKCS #8 PEM file such as "openssl genpkey -algorithm ed25519" writes.
+func (cfg *Config) loadSignKey() error {
+	data, err := os.ReadFile(cfg.SignKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read sign key file: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return fmt.Errorf("sign key file %s holds no PEM private key", cfg.SignKeyFile)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse sign key: %v", err)
+	}
+	signKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return fmt.Errorf("sign key must be an Ed25519 key, got %T", key)
+	}
+	cfg.SignKey = signKey
+	return nil
+}
+
+// RedactKeyID identifies an HMAC redaction key without revealing it, so
+// outputs redacted with the same key can be recognized as correlatable.
+func RedactKeyID(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("safnari redact key id"))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
 func displayHelp() {
 	fmt.Println("Safnari - Advanced Cybersecurity Scanner")
 	fmt.Println()
@@ -606,6 +921,7 @@ func displayHelp() {
 	fmt.Println("  safnari --path \"/tmp\"")
 	fmt.Println("  safnari --path \"/home,/var\"")
 	fmt.Println("  safnari --all-drives --scan-files=false --scan-processes=true")
+	fmt.Println("  safnari --scan-containers --scan-sensitive")
 }
 
 func (cfg *Config) loadFromFile(path string) error {
@@ -630,6 +946,12 @@ func (cfg *Config) loadFromFile(path string) error {
 	return nil
 }
 
+// ScansContainers reports whether the scan covers local containers or image
+// files in addition to, or instead of, the start paths.
+func (cfg *Config) ScansContainers() bool {
+	return cfg.ScanContainers || len(cfg.ContainerImages) > 0
+}
+
 func (cfg *Config) validate() error {
 	if strings.TrimSpace(cfg.PerfProfile) == "" {
 		cfg.PerfProfile = "adaptive"
@@ -671,16 +993,33 @@ func (cfg *Config) validate() error {
 	if !cfg.ScanFiles && !cfg.ScanProcesses && !cfg.ScanSensitive && !cfg.CollectSystemInfo {
 		return fmt.Errorf("at least one of --collect-system-info, --scan-files, --scan-sensitive, or --scan-processes must be enabled")
 	}
-	if len(cfg.StartPaths) == 0 && !cfg.AllDrives && (cfg.ScanFiles || cfg.ScanSensitive) {
+	if len(cfg.StartPaths) == 0 && !cfg.AllDrives && !cfg.ScansContainers() && (cfg.ScanFiles || cfg.ScanSensitive) {
 		return fmt.Errorf("either start path(s) or --all-drives must be specified for file or sensitive scanning")
 	}
 	if cfg.AllDrives && runtime.GOOS != "windows" {
 		return fmt.Errorf("--all-drives flag is only supported on Windows")
 	}
-	if cfg.OutputFormat != "json" {
-		return fmt.Errorf("invalid output format: %s (only json is supported)", cfg.OutputFormat)
+	if _, ok := outputExtensions[cfg.OutputFormat]; !ok {
+		return fmt.Errorf("invalid output format: %s (expected json, sqlite, csv or parquet)", cfg.OutputFormat)
 	}
-	if cfg.RedactSensitive != "" && cfg.RedactSensitive != "mask" && cfg.RedactSensitive != "hash" {
+	for _, recipient := range cfg.EncryptRecipients {
+		if _, err := age.ParseX25519Recipient(recipient); err != nil {
+			return fmt.Errorf("invalid encryption recipient %q: %v", recipient, err)
+		}
+	}
+	if len(cfg.EncryptRecipients) > 0 && cfg.OutputFormat == "sqlite" {
+		return fmt.Errorf("encrypted output is not supported with sqlite output format")
+	}
+	if cfg.SignKeyFile != "" && cfg.OutputFormat != "json" {
+		return fmt.Errorf("signed output requires json output format")
+	}
+	switch cfg.RedactSensitive {
+	case "", "mask", "hash", "token":
+	case "hmac":
+		if len(cfg.RedactKey) == 0 {
+			return fmt.Errorf("--redact-sensitive hmac requires --redact-key-file or %s", redactKeyEnv)
+		}
+	default:
 		return fmt.Errorf("invalid redact-sensitive value: %s", cfg.RedactSensitive)
 	}
 	if cfg.FuzzyMinSize < 0 || cfg.FuzzyMaxSize < 0 {
@@ -745,15 +1084,100 @@ func (cfg *Config) validate() error {
 	if cfg.SensitiveWindowBytes > maxSensitiveWindowBytes {
 		return fmt.Errorf("sensitive-window-bytes must be at most %d", maxSensitiveWindowBytes)
 	}
+	if cfg.SensitiveEntropyBits < 0 || cfg.SensitiveEntropyHexBits < 0 || cfg.SensitiveEntropyMinLen < 0 {
+		return fmt.Errorf("sensitive entropy settings must be zero or positive")
+	}
+	if cfg.SensitiveMinConfidence < 0 || cfg.SensitiveMinConfidence > 1 {
+		return fmt.Errorf("sensitive-min-confidence must be between 0 and 1")
+	}
 	if cfg.DiagSlowScanThreshold < 0 {
 		return fmt.Errorf("diag-slow-scan-threshold must be zero or positive")
 	}
 	if cfg.XattrMaxValueSize < 0 {
 		return fmt.Errorf("xattr-max-value-size must be zero or positive")
 	}
+	if cfg.ScanArchives {
+		if cfg.ArchiveMaxDepth <= 0 {
+			return fmt.Errorf("archive-max-depth must be positive when archive scanning is enabled")
+		}
+		if cfg.ArchiveMaxMembers <= 0 {
+			return fmt.Errorf("archive-max-members must be positive when archive scanning is enabled")
+		}
+		if cfg.ArchiveMaxBytes <= 0 {
+			return fmt.Errorf("archive-max-bytes must be positive when archive scanning is enabled")
+		}
+	}
+	moduleNames := make(map[string]struct{}, len(cfg.ExternalModules))
+	for i := range cfg.ExternalModules {
+		module := &cfg.ExternalModules[i]
+		module.Name = strings.TrimSpace(module.Name)
+		if module.Name == "" {
+			return fmt.Errorf("external module %d is missing a name", i)
+		}
+		if _, ok := moduleNames[module.Name]; ok {
+			return fmt.Errorf("duplicate external module name: %s", module.Name)
+		}
+		moduleNames[module.Name] = struct{}{}
+		if strings.TrimSpace(module.Command) == "" {
+			return fmt.Errorf("external module %s is missing a command", module.Name)
+		}
+		if module.TimeoutMs < 0 || module.MaxContentBytes < 0 || module.MaxResponseBytes < 0 {
+			return fmt.Errorf("external module %s limits must be zero or positive", module.Name)
+		}
+	}
 	if cfg.TraceFlightMinAge < 0 {
 		return fmt.Errorf("trace-flight-min-age must be zero or positive")
 	}
+	if cfg.AgentSchedule != "" {
+		if _, err := schedule.Parse(cfg.AgentSchedule); err != nil {
+			return fmt.Errorf("invalid agent-schedule: %v", err)
+		}
+	}
+	if cfg.Watch && runtime.GOOS != "linux" {
+		return fmt.Errorf("watch mode is only supported on Linux")
+	}
+	// Watch mode records deletions and renames as file_deleted and
+	// file_renamed records, which the tabular formats have no rows for.
+	if cfg.Watch && (cfg.OutputFormat == "csv" || cfg.OutputFormat == "parquet") {
+		return fmt.Errorf("watch mode requires json or sqlite output format")
+	}
+	switch cfg.WatchBackend {
+	case "", "auto", "inotify", "fanotify":
+	default:
+		return fmt.Errorf("invalid watch-backend: %s", cfg.WatchBackend)
+	}
+	if cfg.WatchDebounce < 0 {
+		return fmt.Errorf("watch-debounce must be zero or positive")
+	}
+	switch cfg.DuplicateHash {
+	case "", "md5", "sha1", "sha256", "blake3":
+	default:
+		return fmt.Errorf("invalid duplicate-hash: %s", cfg.DuplicateHash)
+	}
+	if cfg.SimilarityDistance < 0 {
+		return fmt.Errorf("similarity-distance must be zero or positive")
+	}
+	for name, path := range cfg.HashSets {
+		if strings.TrimSpace(name) == "" || strings.TrimSpace(path) == "" {
+			return fmt.Errorf("hash sets need both a name and a path")
+		}
+	}
+	for _, name := range cfg.HashSetAllowlist {
+		if _, ok := cfg.HashSets[name]; !ok {
+			return fmt.Errorf("hash-set-allowlist names unknown hash set: %s", name)
+		}
+	}
+	for _, image := range cfg.ContainerImages {
+		if _, err := os.Stat(image); err != nil {
+			return fmt.Errorf("invalid container image: %v", err)
+		}
+	}
+	if cfg.ScanContainers && (strings.TrimSpace(cfg.DockerRoot) == "" || strings.TrimSpace(cfg.ContainerdRoot) == "") {
+		return fmt.Errorf("docker-root and containerd-root must not be empty")
+	}
+	if cfg.Watch && len(cfg.StartPaths) == 0 && !cfg.AllDrives {
+		return fmt.Errorf("--watch needs start paths; containers and images are not watched")
+	}
 	if cfg.OtelTimeout < 0 {
 		return fmt.Errorf("otel-timeout must be zero or positive")
 	}
@@ -833,6 +1257,40 @@ func parseCustomPatterns(input string) map[string]string {
 	return patterns
 }
 
+func parseExternalModules(input string) ([]ExternalModule, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+	var modules []ExternalModule
+	if err := json.Unmarshal([]byte(input), &modules); err != nil {
+		return nil, fmt.Errorf("invalid external modules: %v", err)
+	}
+	return modules, nil
+}
+
+// parseHashSets parses name=path pairs. Paths may not contain commas.
+func parseHashSets(input string) (map[string]string, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, nil
+	}
+	sets := make(map[string]string)
+	for _, item := range parseCommaSeparated(input) {
+		if item == "" {
+			continue
+		}
+		name, path, ok := strings.Cut(item, "=")
+		name, path = strings.TrimSpace(name), strings.TrimSpace(path)
+		if !ok || name == "" || path == "" {
+			return nil, fmt.Errorf("invalid hash set %q: expected name=path", item)
+		}
+		if _, ok := sets[name]; ok {
+			return nil, fmt.Errorf("duplicate hash set name: %s", name)
+		}
+		sets[name] = path
+	}
+	return sets, nil
+}
+
 func defaultDeltaCacheDir() string {
 	base, err := os.UserCacheDir()
 	if err != nil || strings.TrimSpace(base) == "" {
@@ -1,11 +1,20 @@
 package config
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
 	"flag"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
+
+	"filippo.io/age"
 )
 
 func TestParseCommaSeparated(t *testing.T) {
@@ -84,6 +93,12 @@ func TestValidate(t *testing.T) {
 	if err := cfg.validate(); err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
+	for _, format := range []string{"csv", "parquet"} {
+		cfg = &Config{ScanFiles: true, StartPaths: []string{"/"}, OutputFormat: format, ConcurrencyLevel: 1, NiceLevel: "high", LogLevel: "info", Watch: true}
+		if err := cfg.validate(); err == nil {
+			t.Fatalf("expected watch mode with %s output to be rejected", format)
+		}
+	}
 }
 
 func TestFuzzyHashFlagDefaultsAlgorithm(t *testing.T) {
@@ -281,6 +296,9 @@ func TestDefaultSkipCountEnabled(t *testing.T) {
 	if cfg.ScanSensitive {
 		t.Fatal("expected scan-sensitive default to be disabled")
 	}
+	if cfg.ExtractText {
+		t.Fatal("expected extract-text default to be disabled")
+	}
 	if cfg.ScanProcesses {
 		t.Fatal("expected scan-processes default to be disabled")
 	}
@@ -559,3 +577,452 @@ func TestValidateRejectsResourceExhaustionKnobs(t *testing.T) {
 		t.Fatal("expected excessive sensitive window size to fail validation")
 	}
 }
+
+func TestArchiveFlags(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	defer func() { flag.CommandLine = oldFlag }()
+
+	os.Args = []string{
+		"cmd",
+		"--scan-archives",
+		"--archive-max-depth", "2",
+		"--archive-max-members", "50",
+		"--archive-max-bytes", "8192",
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !cfg.ScanArchives {
+		t.Fatal("expected scan-archives enabled")
+	}
+	if cfg.ArchiveMaxDepth != 2 || cfg.ArchiveMaxMembers != 50 || cfg.ArchiveMaxBytes != 8192 {
+		t.Fatalf("unexpected archive limits: depth=%d members=%d bytes=%d", cfg.ArchiveMaxDepth, cfg.ArchiveMaxMembers, cfg.ArchiveMaxBytes)
+	}
+
+	cfg.ArchiveMaxBytes = 0
+	if err := cfg.validate(); err == nil {
+		t.Fatal("expected validation error for zero archive-max-bytes")
+	}
+}
+
+func TestExternalModulesFlag(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	defer func() { flag.CommandLine = oldFlag }()
+
+	os.Args = []string{
+		"cmd",
+		"--external-modules", `[{"name":"classifier","command":"/usr/local/bin/classify","args":["--json"],"timeout_ms":500,"max_content_bytes":4096,"max_response_bytes":8192}]`,
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.ExternalModules) != 1 {
+		t.Fatalf("expected one external module, got %v", cfg.ExternalModules)
+	}
+	module := cfg.ExternalModules[0]
+	if module.Name != "classifier" || module.Command != "/usr/local/bin/classify" || len(module.Args) != 1 ||
+		module.TimeoutMs != 500 || module.MaxContentBytes != 4096 || module.MaxResponseBytes != 8192 {
+		t.Fatalf("unexpected external module: %+v", module)
+	}
+
+	cfg.ExternalModules = append(cfg.ExternalModules, ExternalModule{Name: "classifier", Command: "other"})
+	if err := cfg.validate(); err == nil {
+		t.Fatal("expected validation error for duplicate external module name")
+	}
+	cfg.ExternalModules = []ExternalModule{{Name: "empty"}}
+	if err := cfg.validate(); err == nil {
+		t.Fatal("expected validation error for missing command")
+	}
+
+	if _, err := parseExternalModules(`{"name":"x"}`); err == nil {
+		t.Fatal("expected error for non-array external modules")
+	}
+}
+
+func TestRulesFlag(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	defer func() { flag.CommandLine = oldFlag }()
+
+	os.Args = []string{"cmd", "--rules", "ir.rules, extra.rules"}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(cfg.RuleFiles) != 2 || cfg.RuleFiles[1] != "extra.rules" {
+		t.Fatalf("unexpected rule files: %v", cfg.RuleFiles)
+	}
+}
+
+func TestSensitiveConfidenceFlags(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd"}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.SensitiveMinConfidence != 0 || cfg.SensitiveProximity {
+		t.Fatalf("unexpected defaults: min=%v proximity=%v", cfg.SensitiveMinConfidence, cfg.SensitiveProximity)
+	}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "--sensitive-min-confidence", "0.6", "--sensitive-keyword-proximity"}
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.SensitiveMinConfidence != 0.6 || !cfg.SensitiveProximity {
+		t.Fatalf("flags not applied: min=%v proximity=%v", cfg.SensitiveMinConfidence, cfg.SensitiveProximity)
+	}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "--sensitive-min-confidence", "1.5"}
+	if _, err := LoadConfig(); err == nil {
+		t.Fatal("expected out-of-range confidence to be rejected")
+	}
+}
+
+func TestMatchLocationsFlag(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd"}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.MatchLocations {
+		t.Fatal("expected match locations to be off by default")
+	}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "--match-locations"}
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !cfg.MatchLocations {
+		t.Fatal("expected --match-locations to enable locations")
+	}
+}
+
+func TestSQLiteFormatDefaultsOutputExtension(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "--format", "sqlite"}
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.OutputFormat != "sqlite" || !strings.HasSuffix(cfg.OutputFileName, ".sqlite") {
+		t.Fatalf("unexpected sqlite output: format=%s file=%s", cfg.OutputFormat, cfg.OutputFileName)
+	}
+
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	os.Args = []string{"cmd", "--format", "sqlite", "--output", "scan.db"}
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.OutputFileName != "scan.db" {
+		t.Fatalf("explicit output name changed: %s", cfg.OutputFileName)
+	}
+}
+
+func TestColumnarFormatsDefaultOutputExtension(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+
+	for _, format := range []string{"csv", "parquet"} {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = []string{"cmd", "--format", strings.ToUpper(format)}
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("load %s: %v", format, err)
+		}
+		if cfg.OutputFormat != format || !strings.HasSuffix(cfg.OutputFileName, "."+format) {
+			t.Fatalf("unexpected %s output: format=%s file=%s", format, cfg.OutputFormat, cfg.OutputFileName)
+		}
+	}
+}
+
+func TestRedactHMACKeySources(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+	load := func(args ...string) (*Config, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = append([]string{"cmd"}, args...)
+		return LoadConfig()
+	}
+
+	t.Setenv(redactKeyEnv, "")
+	if _, err := load("--redact-sensitive", "hmac"); err == nil {
+		t.Fatal("expected hmac without a key to be rejected")
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "redact.key")
+	if err := os.WriteFile(keyFile, []byte("file-key-0123456789\n"), 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	t.Setenv(redactKeyEnv, "env-key-0123456789")
+	cfg, err := load("--redact-sensitive", "hmac", "--redact-key-file", keyFile)
+	if err != nil {
+		t.Fatalf("load with key file: %v", err)
+	}
+	if string(cfg.RedactKey) != "file-key-0123456789" || cfg.RedactKeyID != RedactKeyID(cfg.RedactKey) {
+		t.Fatalf("expected the key file to take precedence, got key %q id %q", cfg.RedactKey, cfg.RedactKeyID)
+	}
+	if len(cfg.RedactKeyID) != 16 || strings.Contains(cfg.RedactKeyID, "key") {
+		t.Fatalf("unexpected key id %q", cfg.RedactKeyID)
+	}
+
+	cfg, err = load("--redact-sensitive", "HMAC")
+	if err != nil {
+		t.Fatalf("load with env key: %v", err)
+	}
+	if string(cfg.RedactKey) != "env-key-0123456789" {
+		t.Fatalf("expected the environment key, got %q", cfg.RedactKey)
+	}
+
+	t.Setenv(redactKeyEnv, "short")
+	if _, err := load("--redact-sensitive", "hmac"); err == nil {
+		t.Fatal("expected a short key to be rejected")
+	}
+	if cfg, err := load("--redact-sensitive", "token"); err != nil || cfg.RedactKey != nil {
+		t.Fatalf("expected token mode to load without a key, got %v", err)
+	}
+}
+
+func TestEncryptRecipients(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+	load := func(args ...string) (*Config, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = append([]string{"cmd"}, args...)
+		return LoadConfig()
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	recipient := identity.Recipient().String()
+	cfg, err := load("--encrypt-recipients", recipient)
+	if err != nil {
+		t.Fatalf("load with recipient: %v", err)
+	}
+	if len(cfg.EncryptRecipients) != 1 || !strings.HasSuffix(cfg.OutputFileName, ".ndjson.age") {
+		t.Fatalf("expected encrypted ndjson output, got %v %q", cfg.EncryptRecipients, cfg.OutputFileName)
+	}
+	cfg, err = load("--encrypt-recipients", recipient, "--format", "csv", "--output", "scan.csv.age")
+	if err != nil {
+		t.Fatalf("load csv with recipient: %v", err)
+	}
+	if cfg.OutputFileName != "scan.csv.age" {
+		t.Fatalf("expected a single .age suffix, got %q", cfg.OutputFileName)
+	}
+	if _, err := load("--encrypt-recipients", "age1notakey"); err == nil {
+		t.Fatal("expected an invalid recipient to be rejected")
+	}
+	if _, err := load("--encrypt-recipients", recipient, "--format", "sqlite"); err == nil {
+		t.Fatal("expected encrypted sqlite output to be rejected")
+	}
+}
+
+func TestSignKeyFile(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+	load := func(args ...string) (*Config, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		os.Args = append([]string{"cmd"}, args...)
+		return LoadConfig()
+	}
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "sign.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	cfg, err := load("--sign-key-file", keyFile)
+	if err != nil {
+		t.Fatalf("load with sign key: %v", err)
+	}
+	if !bytes.Equal(cfg.SignKey, private) {
+		t.Fatal("expected the signing key to be loaded")
+	}
+	if _, err := load("--sign-key-file", keyFile, "--format", "csv"); err == nil {
+		t.Fatal("expected signed csv output to be rejected")
+	}
+	notKey := filepath.Join(dir, "not-a-key.pem")
+	if err := os.WriteFile(notKey, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := load("--sign-key-file", notKey); err == nil {
+		t.Fatal("expected a file without a PEM key to be rejected")
+	}
+}
+
+func TestAgentSchedule(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+	load := func(args ...string) (*Config, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		return LoadConfigArgs(args)
+	}
+
+	cfg, err := load("--agent-schedule", "*/30 * * * *", "--agent-socket", "/run/safnari.sock", "--output", "scan.ndjson")
+	if err != nil {
+		t.Fatalf("load with agent schedule: %v", err)
+	}
+	if cfg.AgentSchedule != "*/30 * * * *" || cfg.AgentSocket != "/run/safnari.sock" {
+		t.Fatalf("unexpected agent settings %q %q", cfg.AgentSchedule, cfg.AgentSocket)
+	}
+	cfg.RunStamp = "20261016T120000Z"
+	if base, ext := OutputNameParts(cfg); base != "scan-20261016T120000Z" || ext != ".ndjson" {
+		t.Fatalf("unexpected run output name %s%s", base, ext)
+	}
+	if _, err := load("--agent-schedule", "every hour"); err == nil {
+		t.Fatal("expected an invalid schedule to be rejected")
+	}
+}
+
+func TestDuplicatesAddsTheirHashAlgorithm(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+	load := func(args ...string) (*Config, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		return LoadConfigArgs(args)
+	}
+
+	cfg, err := load("--duplicates", "--duplicate-hash", "BLAKE3", "--hashes", "md5", "--similarity-distance", "50")
+	if err != nil {
+		t.Fatalf("load with duplicates: %v", err)
+	}
+	if cfg.DuplicateHash != "blake3" || !containsString(cfg.HashAlgorithms, "blake3") || cfg.SimilarityDistance != 50 {
+		t.Fatalf("unexpected duplicate settings %q %v %d", cfg.DuplicateHash, cfg.HashAlgorithms, cfg.SimilarityDistance)
+	}
+	if _, err := load("--duplicates", "--duplicate-hash", "crc32"); err == nil {
+		t.Fatal("expected an unknown duplicate hash to be rejected")
+	}
+	if _, err := load("--similarity-distance", "-1"); err == nil {
+		t.Fatal("expected a negative similarity distance to be rejected")
+	}
+}
+
+func TestHashSetsAndAllowlist(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+	load := func(args ...string) (*Config, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		return LoadConfigArgs(args)
+	}
+
+	cfg, err := load("--hash-sets", "nsrl=/data/RDS.db, ioc=/data/ioc.txt", "--hash-set-allowlist", "nsrl")
+	if err != nil {
+		t.Fatalf("load with hash sets: %v", err)
+	}
+	if cfg.HashSets["nsrl"] != "/data/RDS.db" || cfg.HashSets["ioc"] != "/data/ioc.txt" || len(cfg.HashSetAllowlist) != 1 {
+		t.Fatalf("unexpected hash set settings %v %v", cfg.HashSets, cfg.HashSetAllowlist)
+	}
+	if _, err := load("--hash-sets", "nsrl"); err == nil {
+		t.Fatal("expected a hash set without a path to be rejected")
+	}
+	if _, err := load("--hash-sets", "a=/x,a=/y"); err == nil {
+		t.Fatal("expected a repeated hash set name to be rejected")
+	}
+	if _, err := load("--hash-sets", "ioc=/data/ioc.txt", "--hash-set-allowlist", "nsrl"); err == nil {
+		t.Fatal("expected an allowlist naming an unknown set to be rejected")
+	}
+}
+
+func TestContainerScanSettings(t *testing.T) {
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	oldFlag := flag.CommandLine
+	defer func() { flag.CommandLine = oldFlag }()
+	load := func(args ...string) (*Config, error) {
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		return LoadConfigArgs(args)
+	}
+
+	cfg, err := load()
+	if err != nil {
+		t.Fatalf("load defaults: %v", err)
+	}
+	if cfg.ScansContainers() || cfg.DockerRoot != "/var/lib/docker" || cfg.ContainerdRoot != "/var/lib/containerd" {
+		t.Fatalf("unexpected container defaults %t %q %q", cfg.ScansContainers(), cfg.DockerRoot, cfg.ContainerdRoot)
+	}
+
+	image := filepath.Join(t.TempDir(), "app.tar")
+	if err := os.WriteFile(image, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = load("--scan-containers", "--container-images", image, "--docker-root", "/srv/docker")
+	if err != nil {
+		t.Fatalf("load with containers: %v", err)
+	}
+	if !cfg.ScansContainers() || len(cfg.ContainerImages) != 1 || cfg.DockerRoot != "/srv/docker" {
+		t.Fatalf("unexpected container settings %v %q", cfg.ContainerImages, cfg.DockerRoot)
+	}
+	if len(cfg.StartPaths) != 0 {
+		t.Fatalf("expected container mode to drop the default start path, got %v", cfg.StartPaths)
+	}
+	cfg, err = load("--scan-containers", "--path", "/etc")
+	if err != nil {
+		t.Fatalf("load with containers and a path: %v", err)
+	}
+	if len(cfg.StartPaths) != 1 || cfg.StartPaths[0] != "/etc" {
+		t.Fatalf("expected an explicit path to be kept, got %v", cfg.StartPaths)
+	}
+	if _, err := load("--container-images", filepath.Join(t.TempDir(), "missing.tar")); err == nil {
+		t.Fatal("expected a missing image to be rejected")
+	}
+	if _, err := load("--scan-containers", "--watch"); err == nil {
+		t.Fatal("expected watch mode without start paths to be rejected")
+	}
+}
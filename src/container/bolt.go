@@ -0,0 +1,249 @@
+package container
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+)
+
+// containerd keeps its metadata in bbolt databases. boltDB reads just enough
+// of that format to look up keys: it never writes, takes no lock, and picks
+// the newest meta page whose checksum is valid, so a database that is in use
+// can still be read.
+
+const (
+	boltMagic        = 0xED0CDAED
+	boltVersion      = 2
+	boltPageHeader   = 16
+	boltElementSize  = 16
+	boltBucketHeader = 16
+	boltMetaSize     = 64
+	boltBranchPage   = 0x01
+	boltLeafPage     = 0x02
+	boltMetaPage     = 0x04
+	boltBucketLeaf   = 0x01
+	// boltMaxDepth bounds the tree descent so a corrupt file with a page
+	// cycle cannot recurse forever.
+	boltMaxDepth = 64
+)
+
+var errBoltCorrupt = errors.New("corrupt bolt database")
+
+type boltDB struct {
+	data     []byte
+	pageSize uint64
+	root     uint64
+}
+
+// boltBucket is a bucket's root page, either a page of the file or, for a
+// small bucket, a page stored inline in its parent's value.
+type boltBucket struct {
+	db     *boltDB
+	pgid   uint64
+	inline []byte
+}
+
+func openBolt(name string) (*boltDB, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseBolt(data)
+}
+
+func parseBolt(data []byte) (*boltDB, error) {
+	if len(data) < boltPageHeader+boltMetaSize {
+		return nil, errBoltCorrupt
+	}
+	db := &boltDB{data: data}
+	var txid uint64
+	found := false
+	// Both meta pages sit at the start of the file; the second one's offset
+	// depends on the page size recorded in the first, or the usual 4096
+	// when the first is torn.
+	offsets := []uint64{0, 4096}
+	if ps, ok := boltMetaPageSize(data[boltPageHeader:]); ok {
+		offsets[1] = ps
+	}
+	for _, off := range offsets {
+		if off+boltPageHeader+boltMetaSize > uint64(len(data)) {
+			continue
+		}
+		page := data[off:]
+		if binary.LittleEndian.Uint16(page[8:10])&boltMetaPage == 0 {
+			continue
+		}
+		meta := page[boltPageHeader : boltPageHeader+boltMetaSize]
+		if !validBoltMeta(meta) {
+			continue
+		}
+		if id := binary.LittleEndian.Uint64(meta[48:56]); !found || id > txid {
+			found, txid = true, id
+			db.pageSize = uint64(binary.LittleEndian.Uint32(meta[8:12]))
+			db.root = binary.LittleEndian.Uint64(meta[16:24])
+		}
+	}
+	if !found || db.pageSize < boltPageHeader {
+		return nil, fmt.Errorf("%w: no valid meta page", errBoltCorrupt)
+	}
+	return db, nil
+}
+
+func boltMetaPageSize(meta []byte) (uint64, bool) {
+	if !validBoltMeta(meta[:boltMetaSize]) {
+		return 0, false
+	}
+	return uint64(binary.LittleEndian.Uint32(meta[8:12])), true
+}
+
+// validBoltMeta checks the magic, version and the FNV-64a checksum that
+// covers every meta field before it.
+func validBoltMeta(meta []byte) bool {
+	if binary.LittleEndian.Uint32(meta[0:4]) != boltMagic || binary.LittleEndian.Uint32(meta[4:8]) != boltVersion {
+		return false
+	}
+	h := fnv.New64a()
+	h.Write(meta[:56])
+	return h.Sum64() == binary.LittleEndian.Uint64(meta[56:64])
+}
+
+// Bucket follows a path of nested buckets from the root, returning nil if
+// any of them is missing.
+func (db *boltDB) Bucket(names ...string) *boltBucket {
+	b := &boltBucket{db: db, pgid: db.root}
+	for _, name := range names {
+		b = b.Bucket(name)
+	}
+	return b
+}
+
+// Bucket returns the named child bucket, or nil.
+func (b *boltBucket) Bucket(name string) *boltBucket {
+	var child *boltBucket
+	b.ForEach(func(k, v []byte, bucket bool) error {
+		if !bucket || string(k) != name {
+			return nil
+		}
+		child = b.db.openBucket(v)
+		return errStopIteration
+	})
+	return child
+}
+
+// Get returns the value stored under key, or nil if it is missing or names
+// a bucket.
+func (b *boltBucket) Get(key string) []byte {
+	var value []byte
+	b.ForEach(func(k, v []byte, bucket bool) error {
+		if bucket || string(k) != key {
+			return nil
+		}
+		value = v
+		return errStopIteration
+	})
+	return value
+}
+
+// Buckets lists the names of the child buckets in key order.
+func (b *boltBucket) Buckets() []string {
+	var names []string
+	b.ForEach(func(k, v []byte, bucket bool) error {
+		if bucket {
+			names = append(names, string(k))
+		}
+		return nil
+	})
+	return names
+}
+
+var errStopIteration = errors.New("stop iteration")
+
+// ForEach calls fn for each key in order. For child buckets v is the raw
+// bucket value and bucket is true. A nil bucket has no keys, so lookups can
+// be chained without checks.
+func (b *boltBucket) ForEach(fn func(k, v []byte, bucket bool) error) error {
+	if b == nil {
+		return nil
+	}
+	var err error
+	if b.inline != nil {
+		err = b.db.walkPage(b.inline, 0, fn)
+	} else {
+		err = b.db.walk(b.pgid, 0, fn)
+	}
+	if errors.Is(err, errStopIteration) {
+		return nil
+	}
+	return err
+}
+
+func (db *boltDB) openBucket(value []byte) *boltBucket {
+	if len(value) < boltBucketHeader {
+		return nil
+	}
+	root := binary.LittleEndian.Uint64(value[0:8])
+	if root == 0 {
+		return &boltBucket{db: db, inline: value[boltBucketHeader:]}
+	}
+	return &boltBucket{db: db, pgid: root}
+}
+
+func (db *boltDB) page(pgid uint64) ([]byte, error) {
+	start := pgid * db.pageSize
+	if pgid == 0 || start/db.pageSize != pgid || start+boltPageHeader > uint64(len(db.data)) {
+		return nil, errBoltCorrupt
+	}
+	overflow := uint64(binary.LittleEndian.Uint32(db.data[start+12 : start+16]))
+	end := start + (overflow+1)*db.pageSize
+	if end > uint64(len(db.data)) || end < start {
+		end = uint64(len(db.data))
+	}
+	return db.data[start:end], nil
+}
+
+func (db *boltDB) walk(pgid uint64, depth int, fn func(k, v []byte, bucket bool) error) error {
+	page, err := db.page(pgid)
+	if err != nil {
+		return err
+	}
+	return db.walkPage(page, depth, fn)
+}
+
+func (db *boltDB) walkPage(page []byte, depth int, fn func(k, v []byte, bucket bool) error) error {
+	if depth > boltMaxDepth || len(page) < boltPageHeader {
+		return errBoltCorrupt
+	}
+	flags := binary.LittleEndian.Uint16(page[8:10])
+	count := int(binary.LittleEndian.Uint16(page[10:12]))
+	if boltPageHeader+count*boltElementSize > len(page) {
+		return errBoltCorrupt
+	}
+	for i := 0; i < count; i++ {
+		off := boltPageHeader + i*boltElementSize
+		elem := page[off : off+boltElementSize]
+		switch {
+		case flags&boltBranchPage != 0:
+			if err := db.walk(binary.LittleEndian.Uint64(elem[8:16]), depth+1, fn); err != nil {
+				return err
+			}
+		case flags&boltLeafPage != 0:
+			pos := uint64(off) + uint64(binary.LittleEndian.Uint32(elem[4:8]))
+			ksize := uint64(binary.LittleEndian.Uint32(elem[8:12]))
+			vsize := uint64(binary.LittleEndian.Uint32(elem[12:16]))
+			if pos+ksize+vsize > uint64(len(page)) {
+				return errBoltCorrupt
+			}
+			key := page[pos : pos+ksize]
+			value := page[pos+ksize : pos+ksize+vsize]
+			bucket := binary.LittleEndian.Uint32(elem[0:4])&boltBucketLeaf != 0
+			if err := fn(key, value, bucket); err != nil {
+				return err
+			}
+		default:
+			return errBoltCorrupt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package container
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const testBoltPageSize = 4096
+
+// boltTree describes a bolt database for tests: string or []byte values are
+// keys, boltTree values are nested buckets.
+type boltTree map[string]any
+
+// writeBolt encodes tree as a bolt file. Buckets with a few plain keys are
+// stored inline and larger ones are split across two leaves under a branch
+// page, so that every page layout the reader handles is exercised.
+func writeBolt(t *testing.T, name string, tree boltTree) {
+	t.Helper()
+	w := &boltWriter{}
+	root := w.bucket(tree, false)
+	rootPgid := binary.LittleEndian.Uint64(root[0:8])
+	data := make([]byte, 2*testBoltPageSize)
+	// The older meta page points at a page that is not a tree, so reading
+	// it instead of the newer one would fail.
+	putBoltMeta(data[0:], 0, 1, 1)
+	putBoltMeta(data[testBoltPageSize:], 1, rootPgid, 2)
+	for _, page := range w.pages {
+		padded := make([]byte, testBoltPageSize)
+		copy(padded, page)
+		data = append(data, padded...)
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func putBoltMeta(page []byte, id, root, txid uint64) {
+	binary.LittleEndian.PutUint64(page[0:8], id)
+	binary.LittleEndian.PutUint16(page[8:10], boltMetaPage)
+	meta := page[boltPageHeader : boltPageHeader+boltMetaSize]
+	binary.LittleEndian.PutUint32(meta[0:4], boltMagic)
+	binary.LittleEndian.PutUint32(meta[4:8], boltVersion)
+	binary.LittleEndian.PutUint32(meta[8:12], testBoltPageSize)
+	binary.LittleEndian.PutUint64(meta[16:24], root)
+	binary.LittleEndian.PutUint64(meta[48:56], txid)
+	h := fnv.New64a()
+	h.Write(meta[:56])
+	binary.LittleEndian.PutUint64(meta[56:64], h.Sum64())
+}
+
+type boltWriter struct {
+	pages [][]byte
+}
+
+type boltTestElement struct {
+	key, value []byte
+	bucket     bool
+}
+
+func (w *boltWriter) bucket(tree boltTree, inline bool) []byte {
+	keys := make([]string, 0, len(tree))
+	for key := range tree {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var elements []boltTestElement
+	nested := false
+	for _, key := range keys {
+		switch v := tree[key].(type) {
+		case boltTree:
+			nested = true
+			elements = append(elements, boltTestElement{key: []byte(key), value: w.bucket(v, len(v) <= 2), bucket: true})
+		case string:
+			elements = append(elements, boltTestElement{key: []byte(key), value: []byte(v)})
+		case []byte:
+			elements = append(elements, boltTestElement{key: []byte(key), value: v})
+		}
+	}
+	header := make([]byte, boltBucketHeader)
+	if inline && !nested {
+		return append(header, boltLeaf(0, elements)...)
+	}
+	var root uint64
+	if len(elements) > 2 {
+		half := len(elements) / 2
+		left := w.add(boltLeaf(w.next(), elements[:half]))
+		right := w.add(boltLeaf(w.next(), elements[half:]))
+		root = w.add(boltBranch(w.next(), []boltTestElement{elements[0], elements[half]}, []uint64{left, right}))
+	} else {
+		root = w.add(boltLeaf(w.next(), elements))
+	}
+	binary.LittleEndian.PutUint64(header[0:8], root)
+	return header
+}
+
+func (w *boltWriter) next() uint64 { return uint64(len(w.pages)) + 2 }
+
+func (w *boltWriter) add(page []byte) uint64 {
+	w.pages = append(w.pages, page)
+	return w.next() - 1
+}
+
+func boltLeaf(id uint64, elements []boltTestElement) []byte {
+	page := boltPageStart(id, boltLeafPage, len(elements))
+	for i, e := range elements {
+		off := boltPageHeader + i*boltElementSize
+		if e.bucket {
+			binary.LittleEndian.PutUint32(page[off:off+4], boltBucketLeaf)
+		}
+		binary.LittleEndian.PutUint32(page[off+4:off+8], uint32(len(page)-off))
+		binary.LittleEndian.PutUint32(page[off+8:off+12], uint32(len(e.key)))
+		binary.LittleEndian.PutUint32(page[off+12:off+16], uint32(len(e.value)))
+		page = append(append(page, e.key...), e.value...)
+	}
+	return page
+}
+
+func boltBranch(id uint64, elements []boltTestElement, children []uint64) []byte {
+	page := boltPageStart(id, boltBranchPage, len(elements))
+	for i, e := range elements {
+		off := boltPageHeader + i*boltElementSize
+		binary.LittleEndian.PutUint32(page[off:off+4], uint32(len(page)-off))
+		binary.LittleEndian.PutUint32(page[off+4:off+8], uint32(len(e.key)))
+		binary.LittleEndian.PutUint64(page[off+8:off+16], children[i])
+		page = append(page, e.key...)
+	}
+	return page
+}
+
+func boltPageStart(id uint64, flags uint16, count int) []byte {
+	page := make([]byte, boltPageHeader+count*boltElementSize)
+	binary.LittleEndian.PutUint64(page[0:8], id)
+	binary.LittleEndian.PutUint16(page[8:10], flags)
+	binary.LittleEndian.PutUint16(page[10:12], uint16(count))
+	return page
+}
+
+func TestBoltReadsNestedBuckets(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "meta.db")
+	writeBolt(t, name, boltTree{
+		"v1": boltTree{
+			"default": boltTree{
+				"containers": boltTree{
+					"a": boltTree{"image": "alpine:3.20"},
+					"b": boltTree{"image": "nginx:1.27", "snapshotter": "overlayfs"},
+					"c": boltTree{"image": "redis:7", "labels": boltTree{"nerdctl/name": "cache"}},
+				},
+			},
+			"version": "3",
+		},
+	})
+	db, err := openBolt(name)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	containers := db.Bucket("v1", "default", "containers")
+	if got := containers.Buckets(); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Fatalf("Buckets = %v", got)
+	}
+	if got := string(containers.Bucket("c").Bucket("labels").Get("nerdctl/name")); got != "cache" {
+		t.Fatalf("label = %q", got)
+	}
+	if got := string(db.Bucket("v1").Get("version")); got != "3" {
+		t.Fatalf("version = %q", got)
+	}
+	if db.Bucket("v1").Get("default") != nil {
+		t.Fatal("Get returned a bucket value")
+	}
+	if db.Bucket("v1", "missing", "containers") != nil {
+		t.Fatal("expected a missing bucket to be nil")
+	}
+}
+
+func TestBoltRejectsCorruptFiles(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "meta.db")
+	writeBolt(t, name, boltTree{"v1": boltTree{"k": "v"}})
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Point the root at a page past the end of the file.
+	meta := data[testBoltPageSize+boltPageHeader:]
+	binary.LittleEndian.PutUint64(meta[16:24], 1<<40)
+	h := fnv.New64a()
+	h.Write(meta[:56])
+	binary.LittleEndian.PutUint64(meta[56:64], h.Sum64())
+	db, err := parseBolt(data)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if err := db.Bucket().ForEach(func(k, v []byte, bucket bool) error { return nil }); !errors.Is(err, errBoltCorrupt) {
+		t.Fatalf("ForEach error = %v", err)
+	}
+	if _, err := parseBolt(data[:boltPageHeader+8]); !errors.Is(err, errBoltCorrupt) {
+		t.Fatalf("truncated file error = %v", err)
+	}
+}
@@ -0,0 +1,384 @@
+// Package container finds the filesystems of local containers and the layers
+// of container images so they can be scanned as logical roots. It reads the
+// Docker and containerd on-disk layouts, OCI image layouts and image
+// tarballs directly, without talking to a container runtime.
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Runtimes a Target can come from.
+const (
+	RuntimeDocker     = "docker"
+	RuntimeContainerd = "containerd"
+	RuntimeImage      = "image"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Target is a container or image whose layers make up one filesystem.
+type Target struct {
+	// Root is the logical root its files are reported under:
+	// docker://<id>, containerd://<namespace>/<id>, or the image tarball or
+	// layout path followed by @ and the image digest.
+	Root    string
+	Runtime string
+	// ID and Name identify a container; they are empty for images.
+	ID   string
+	Name string
+	// Image is the image reference, such as nginx:1.27, when known.
+	Image string
+	// ImageID is the digest of the image config, which Docker shows as the
+	// image ID. ImageDigest is the digest of the image manifest, which
+	// registries show, when the source records it.
+	ImageID     string
+	ImageDigest string
+	// Layers run from the base layer up, as in the image config, with a
+	// container's writable layer last.
+	Layers []Layer
+}
+
+// Layer is one layer of a Target, either unpacked on disk or read as a tar
+// stream.
+type Layer struct {
+	// Digest is the layer's diff ID, the digest of its uncompressed tar. It
+	// is empty for a container's writable layer.
+	Digest string
+	// Dir holds the unpacked layer, with overlayfs whiteouts.
+	Dir string
+	// Open returns the uncompressed layer tar when Dir is empty.
+	Open func() (io.ReadCloser, error)
+}
+
+// OnDisk reports whether every layer is unpacked on disk, so that files can
+// be read from their host paths.
+func (t *Target) OnDisk() bool {
+	for _, layer := range t.Layers {
+		if layer.Dir == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Entry is one regular file found in a layer.
+type Entry struct {
+	// Path is the slash-separated path inside the target, starting with /.
+	Path  string
+	Layer *Layer
+	Info  fs.FileInfo
+	// HostPath is where the file is on disk, for unpacked layers.
+	HostPath string
+	// Content reads a tar layer file. It is only valid during the callback.
+	Content io.Reader
+	// Shadowed is set when a higher layer replaces or deletes the file, so
+	// it is in the image but not in the filesystem a container sees.
+	Shadowed bool
+}
+
+// Walk calls fn for every regular file of every layer, from the top layer
+// down, so that files hidden by a higher layer are reported as shadowed. A
+// layer that cannot be read is skipped and its error returned at the end,
+// unless fn fails first.
+func (t *Target) Walk(ctx context.Context, fn func(Entry) error) error {
+	v := newVisibility()
+	var errs []error
+	for i := len(t.Layers) - 1; i >= 0; i-- {
+		layer := &t.Layers[i]
+		var err error
+		if layer.Dir != "" {
+			err = v.walkDir(ctx, layer, fn)
+		} else {
+			err = v.walkTar(ctx, layer, fn)
+		}
+		var cbErr callbackError
+		if errors.As(err, &cbErr) {
+			return cbErr.err
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("layer %s: %w", layerName(layer), err))
+		}
+		v.endLayer()
+	}
+	return errors.Join(errs...)
+}
+
+func layerName(layer *Layer) string {
+	switch {
+	case layer.Digest != "":
+		return layer.Digest
+	case layer.Dir != "":
+		return layer.Dir
+	default:
+		return "writable"
+	}
+}
+
+// callbackError marks an error returned by the Walk callback, which stops
+// the walk instead of skipping the layer.
+type callbackError struct{ err error }
+
+func (e callbackError) Error() string { return e.err.Error() }
+
+// visibility tracks what the layers walked so far hide from those below.
+type visibility struct {
+	// covered holds paths present or deleted in a higher layer; they hide
+	// the same path and everything below it.
+	covered map[string]bool
+	// opaque holds directories whose lower contents a higher layer hides.
+	opaque map[string]bool
+	// dirs holds directories of higher layers, which merge with lower
+	// directories but replace lower files of the same name.
+	dirs map[string]bool
+	// pending collects the current layer's paths, which only take effect
+	// for the layers below it.
+	pendingCovered []string
+	pendingOpaque  []string
+	pendingDirs    []string
+}
+
+func newVisibility() *visibility {
+	return &visibility{covered: map[string]bool{}, opaque: map[string]bool{}, dirs: map[string]bool{}}
+}
+
+func (v *visibility) shadowed(p string) bool {
+	if v.covered[p] || v.dirs[p] {
+		return true
+	}
+	for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+		if v.covered[dir] || v.opaque[dir] {
+			return true
+		}
+	}
+	return v.opaque["/"]
+}
+
+func (v *visibility) endLayer() {
+	for _, p := range v.pendingCovered {
+		v.covered[p] = true
+	}
+	for _, p := range v.pendingOpaque {
+		v.opaque[p] = true
+	}
+	for _, p := range v.pendingDirs {
+		v.dirs[p] = true
+	}
+	v.pendingCovered = v.pendingCovered[:0]
+	v.pendingOpaque = v.pendingOpaque[:0]
+	v.pendingDirs = v.pendingDirs[:0]
+}
+
+// note records a path of the current layer. It reports whether the path is
+// an ordinary file rather than a whiteout.
+func (v *visibility) note(p string) bool {
+	dir, name := path.Split(p)
+	dir = path.Clean(dir)
+	switch {
+	case name == whiteoutOpaque:
+		v.pendingOpaque = append(v.pendingOpaque, dir)
+		return false
+	case strings.HasPrefix(name, whiteoutPrefix):
+		v.pendingCovered = append(v.pendingCovered, path.Join(dir, strings.TrimPrefix(name, whiteoutPrefix)))
+		return false
+	}
+	v.pendingCovered = append(v.pendingCovered, p)
+	return true
+}
+
+func (v *visibility) walkDir(ctx context.Context, layer *Layer, fn func(Entry) error) error {
+	return filepath.WalkDir(layer.Dir, func(hostPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if hostPath == layer.Dir {
+				return err
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(layer.Dir, hostPath)
+		if err != nil {
+			return nil
+		}
+		p := path.Clean("/" + filepath.ToSlash(rel))
+		if d.IsDir() {
+			if p != "/" {
+				v.pendingDirs = append(v.pendingDirs, p)
+				if isOpaqueDir(hostPath) {
+					v.pendingOpaque = append(v.pendingOpaque, p)
+				}
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if isWhiteoutDevice(info) {
+			v.pendingCovered = append(v.pendingCovered, p)
+			return nil
+		}
+		shadowed := v.shadowed(p)
+		if !v.note(p) || !info.Mode().IsRegular() {
+			return nil
+		}
+		entry := Entry{Path: p, Layer: layer, Info: info, HostPath: hostPath, Shadowed: shadowed}
+		if err := fn(entry); err != nil {
+			return callbackError{err}
+		}
+		return nil
+	})
+}
+
+func (v *visibility) walkTar(ctx context.Context, layer *Layer, fn func(Entry) error) error {
+	if layer.Open == nil {
+		return fmt.Errorf("layer has no content")
+	}
+	rc, err := layer.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	reader := tar.NewReader(rc)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p := path.Clean("/" + hdr.Name)
+		if p == "/" {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			v.pendingDirs = append(v.pendingDirs, p)
+			continue
+		}
+		shadowed := v.shadowed(p)
+		if !v.note(p) || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		entry := Entry{Path: p, Layer: layer, Info: hdr.FileInfo(), Content: reader, Shadowed: shadowed}
+		if err := fn(entry); err != nil {
+			return callbackError{err}
+		}
+	}
+}
+
+// decompressed wraps a layer blob in a decompressor chosen by its leading
+// bytes. Layers are plain or gzip-compressed tars; zstd is not supported.
+func decompressed(rc io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(rc)
+	header, _ := buffered.Peek(4)
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			rc.Close()
+			return nil, err
+		}
+		return readCloser{Reader: gz, close: func() error {
+			gz.Close()
+			return rc.Close()
+		}}, nil
+	case bytes.HasPrefix(header, zstdMagic):
+		rc.Close()
+		return nil, fmt.Errorf("zstd-compressed layers are not supported")
+	default:
+		return readCloser{Reader: buffered, close: rc.Close}, nil
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error { return r.close() }
+
+// chainIDs returns the chain ID of each layer, which identifies the layer
+// together with every layer below it, as runtimes name unpacked layers.
+func chainIDs(diffIDs []string) []string {
+	ids := make([]string, len(diffIDs))
+	for i, diffID := range diffIDs {
+		if i == 0 {
+			ids[i] = diffID
+			continue
+		}
+		sum := sha256.Sum256([]byte(ids[i-1] + " " + diffID))
+		ids[i] = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return ids
+}
+
+// readFileLimited reads a small document, refusing anything over limit
+// bytes so a corrupt store cannot exhaust memory.
+func readFileLimited(name string, limit int64) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readLimited(f, limit)
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("document larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// maxDocumentBytes bounds the manifests, configs and metadata files read.
+const maxDocumentBytes = 16 << 20
+
+// digestHex returns the hex part of an algorithm:hex digest, rejecting
+// anything that could escape a blob directory.
+func digestHex(digest string) (string, string, error) {
+	algorithm, encoded, ok := strings.Cut(digest, ":")
+	if !ok || algorithm == "" || encoded == "" || strings.ContainsAny(algorithm+encoded, `/\.`) {
+		return "", "", fmt.Errorf("invalid digest %q", digest)
+	}
+	return algorithm, encoded, nil
+}
+
+// isPlainName reports whether name is a single path element, so that IDs
+// read from runtime metadata cannot point outside the runtime's directories.
+func isPlainName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
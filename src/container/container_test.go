@@ -0,0 +1,172 @@
+package container
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// tarBytes builds a tar from name, content pairs; names ending in / are
+// directories.
+func tarBytes(t *testing.T, pairs ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		hdr := &tar.Header{Name: pairs[i], Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(pairs[i+1]))}
+		if strings.HasSuffix(pairs[i], "/") {
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeDir, 0755, 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(pairs[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeTestFile(t *testing.T, root, name string, data []byte) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tarLayer(digest string, data []byte) Layer {
+	return Layer{Digest: digest, Open: func() (io.ReadCloser, error) {
+		return decompressed(io.NopCloser(bytes.NewReader(data)))
+	}}
+}
+
+// walkSummary lists the entries of a walk as layer:path=content, with a
+// trailing (shadowed) for hidden files.
+func walkSummary(t *testing.T, target *Target) []string {
+	t.Helper()
+	var got []string
+	err := target.Walk(context.Background(), func(e Entry) error {
+		var data []byte
+		var err error
+		if e.Content != nil {
+			data, err = io.ReadAll(e.Content)
+		} else {
+			data, err = os.ReadFile(e.HostPath)
+		}
+		if err != nil {
+			return err
+		}
+		line := fmt.Sprintf("%s:%s=%s", e.Layer.Digest, e.Path, data)
+		if e.Shadowed {
+			line += " (shadowed)"
+		}
+		got = append(got, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	return got
+}
+
+func TestWalkAppliesWhiteouts(t *testing.T) {
+	target := &Target{Layers: []Layer{
+		tarLayer("sha256:base", gzipBytes(t, tarBytes(t,
+			"etc/", "",
+			"etc/passwd", "root:x:0:0",
+			"app/secret.env", "TOKEN=1",
+			"app/config", "v1",
+			"cache/a", "x",
+			"opt/tool", "file",
+		))),
+		tarLayer("sha256:mid", tarBytes(t,
+			"app/", "",
+			"app/.wh.secret.env", "",
+			"cache/.wh..wh..opq", "",
+			"cache/b", "y",
+			"opt/tool/", "",
+		)),
+		tarLayer("sha256:top", tarBytes(t, "./app/config", "v2")),
+	}}
+	want := []string{
+		"sha256:top:/app/config=v2",
+		"sha256:mid:/cache/b=y",
+		"sha256:base:/etc/passwd=root:x:0:0",
+		"sha256:base:/app/secret.env=TOKEN=1 (shadowed)",
+		"sha256:base:/app/config=v1 (shadowed)",
+		"sha256:base:/cache/a=x (shadowed)",
+		"sha256:base:/opt/tool=file (shadowed)",
+	}
+	if got := walkSummary(t, target); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected walk:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestWalkReportsUnreadableLayers(t *testing.T) {
+	target := &Target{Layers: []Layer{
+		tarLayer("sha256:ok", tarBytes(t, "a", "1")),
+		{Digest: "sha256:zstd", Open: func() (io.ReadCloser, error) {
+			return decompressed(io.NopCloser(bytes.NewReader([]byte{0x28, 0xb5, 0x2f, 0xfd, 0})))
+		}},
+	}}
+	var paths []string
+	err := target.Walk(context.Background(), func(e Entry) error {
+		paths = append(paths, e.Path)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "sha256:zstd") || !strings.Contains(err.Error(), "zstd") {
+		t.Fatalf("expected a zstd layer error, got %v", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/a"}) {
+		t.Fatalf("expected the readable layer to be walked, got %v", paths)
+	}
+
+	stop := fmt.Errorf("stop")
+	if err := target.Walk(context.Background(), func(Entry) error { return stop }); err != stop {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+}
+
+func TestChainIDs(t *testing.T) {
+	diffIDs := []string{"sha256:aaaa", "sha256:bbbb", "sha256:cccc"}
+	second := sha256.Sum256([]byte("sha256:aaaa sha256:bbbb"))
+	third := sha256.Sum256([]byte("sha256:" + hex.EncodeToString(second[:]) + " sha256:cccc"))
+	want := []string{
+		"sha256:aaaa",
+		"sha256:" + hex.EncodeToString(second[:]),
+		"sha256:" + hex.EncodeToString(third[:]),
+	}
+	if got := chainIDs(diffIDs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("chainIDs = %v, want %v", got, want)
+	}
+}
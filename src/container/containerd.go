@@ -0,0 +1,164 @@
+package container
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultContainerdRoot is where containerd keeps its data.
+const DefaultContainerdRoot = "/var/lib/containerd"
+
+const (
+	containerdMetadataDB  = "io.containerd.metadata.v1.bolt/meta.db"
+	containerdContentDir  = "io.containerd.content.v1.content"
+	containerdOverlayDir  = "io.containerd.snapshotter.v1.overlayfs"
+	containerdSnapshotter = "overlayfs"
+)
+
+// containerNameLabels hold a readable container name, as set by nerdctl and
+// the Kubernetes CRI plugin.
+var containerNameLabels = []string{"nerdctl/name", "io.kubernetes.container.name"}
+
+// DiscoverContainerd lists the containers in every namespace of a containerd
+// data root that use the overlayfs snapshotter, with their image layers and
+// writable layer. A missing root yields no targets. Containers that cannot
+// be read are skipped and reported in the returned error.
+func DiscoverContainerd(root string) ([]Target, error) {
+	meta, err := openBolt(filepath.Join(root, filepath.FromSlash(containerdMetadataDB)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	namespaces := meta.Bucket("v1")
+	if namespaces == nil {
+		return nil, nil
+	}
+	var snapshots *boltDB
+	var targets []Target
+	var errs []error
+	for _, ns := range namespaces.Buckets() {
+		containers := namespaces.Bucket(ns).Bucket("containers")
+		if containers == nil {
+			continue
+		}
+		for _, id := range containers.Buckets() {
+			c := containers.Bucket(id)
+			key := string(c.Get("snapshotKey"))
+			// Containers created without a root filesystem, such as the
+			// task records Docker keeps for overlay2 containers, have none.
+			if key == "" {
+				continue
+			}
+			if snapshotter := string(c.Get("snapshotter")); snapshotter != containerdSnapshotter {
+				errs = append(errs, fmt.Errorf("containerd container %s/%s: unsupported snapshotter %q", ns, id, snapshotter))
+				continue
+			}
+			if snapshots == nil {
+				snapshots, err = openBolt(filepath.Join(root, containerdOverlayDir, "metadata.db"))
+				if err != nil {
+					return targets, errors.Join(append(errs, err)...)
+				}
+			}
+			target, err := containerdContainer(root, meta, snapshots, ns, id, c)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("containerd container %s/%s: %w", ns, id, err))
+				continue
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets, errors.Join(errs...)
+}
+
+func containerdContainer(root string, meta, snapshots *boltDB, ns, id string, c *boltBucket) (Target, error) {
+	target := Target{
+		Root:    "containerd://" + ns + "/" + id,
+		Runtime: RuntimeContainerd,
+		ID:      id,
+		Image:   string(c.Get("image")),
+	}
+	if labels := c.Bucket("labels"); labels != nil {
+		for _, label := range containerNameLabels {
+			if name := labels.Get(label); name != nil {
+				target.Name = string(name)
+				break
+			}
+		}
+	}
+	// The namespace's snapshot record maps the container's snapshot key to
+	// the snapshotter's own key, under which the parent chain is kept.
+	record := meta.Bucket("v1", ns, "snapshots", containerdSnapshotter, string(c.Get("snapshotKey")))
+	if record == nil {
+		return Target{}, fmt.Errorf("snapshot %s not found", c.Get("snapshotKey"))
+	}
+	diffIDs := map[string]string{}
+	if target.Image != "" {
+		if image := meta.Bucket("v1", ns, "images", target.Image, "target"); image != nil {
+			target.ImageDigest = string(image.Get("digest"))
+			if resolved, err := resolveImage(containerdBlobs(root), ociDescriptor{Digest: target.ImageDigest}); err == nil {
+				target.ImageID = resolved.ImageID
+				diffIDs = layerChainDiffIDs(resolved.Layers)
+			}
+		}
+	}
+	var layers []Layer
+	key := string(record.Get("name"))
+	for depth := 0; key != ""; depth++ {
+		if depth > maxLayers {
+			return Target{}, fmt.Errorf("snapshot chain longer than %d", maxLayers)
+		}
+		snapshot := snapshots.Bucket("v1", "snapshots", key)
+		if snapshot == nil {
+			return Target{}, fmt.Errorf("snapshot %s not found", key)
+		}
+		snapshotID, n := binary.Uvarint(snapshot.Get("id"))
+		if n <= 0 {
+			return Target{}, fmt.Errorf("snapshot %s has no id", key)
+		}
+		layer := Layer{Dir: filepath.Join(root, containerdOverlayDir, "snapshots", strconv.FormatUint(snapshotID, 10), "fs")}
+		// Committed layers are keyed <namespace>/<txid>/<chain ID>; the
+		// container's active snapshot is not and keeps an empty digest.
+		if depth > 0 {
+			layer.Digest = diffIDs[key[strings.LastIndex(key, "/")+1:]]
+		}
+		layers = append(layers, layer)
+		key = string(snapshot.Get("parent"))
+	}
+	slices.Reverse(layers)
+	target.Layers = layers
+	return target, nil
+}
+
+// containerdBlobs opens blobs of containerd's content store, which is shared
+// by all namespaces.
+func containerdBlobs(root string) func(string) (io.ReadCloser, error) {
+	return func(digest string) (io.ReadCloser, error) {
+		algorithm, encoded, err := digestHex(digest)
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(filepath.Join(root, containerdContentDir, "blobs", algorithm, encoded))
+	}
+}
+
+// layerChainDiffIDs maps the chain ID of each layer to its diff ID.
+func layerChainDiffIDs(layers []Layer) map[string]string {
+	diffIDs := make([]string, len(layers))
+	for i, layer := range layers {
+		diffIDs[i] = layer.Digest
+	}
+	byChain := map[string]string{}
+	for i, chainID := range chainIDs(diffIDs) {
+		byChain[chainID] = diffIDs[i]
+	}
+	return byChain
+}
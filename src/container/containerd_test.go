@@ -0,0 +1,92 @@
+package container
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func uvarint(v uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return buf[:binary.PutUvarint(buf, v)]
+}
+
+func TestDiscoverContainerd(t *testing.T) {
+	root := t.TempDir()
+	content := filepath.Join(root, containerdContentDir)
+	base := tarBytes(t, "etc/os-release", "ID=debian")
+	app := tarBytes(t, "srv/app", "bin")
+	diffIDs := []string{digestOf(base), digestOf(app)}
+	chain := chainIDs(diffIDs)
+	config := writeJSONBlob(t, content, map[string]any{"rootfs": map[string]any{"diff_ids": diffIDs}})
+	manifest := writeJSONBlob(t, content, map[string]any{
+		"config": map[string]any{"digest": config},
+		"layers": []map[string]any{{"digest": writeBlob(t, content, gzipBytes(t, base))}, {"digest": writeBlob(t, content, app)}},
+	})
+	const image = "registry.example/app:1.0"
+	writeBolt(t, filepath.Join(root, filepath.FromSlash(containerdMetadataDB)), boltTree{
+		"v1": boltTree{
+			"k8s.io": boltTree{
+				"containers": boltTree{
+					"4a1f": boltTree{
+						"image":       image,
+						"snapshotter": "overlayfs",
+						"snapshotKey": "4a1f",
+						"labels":      boltTree{"io.kubernetes.container.name": "api"},
+					},
+					"9c2e": boltTree{"image": image, "snapshotter": "native", "snapshotKey": "9c2e"},
+					"task": boltTree{"image": image},
+				},
+				"snapshots": boltTree{
+					"overlayfs": boltTree{
+						"4a1f":   boltTree{"name": "k8s.io/7/4a1f"},
+						chain[0]: boltTree{"name": "k8s.io/3/" + chain[0]},
+						chain[1]: boltTree{"name": "k8s.io/5/" + chain[1]},
+					},
+				},
+				"images": boltTree{
+					image: boltTree{"target": boltTree{"digest": manifest, "mediatype": "application/vnd.oci.image.manifest.v1+json"}},
+				},
+			},
+			"version": "3",
+		},
+	})
+	writeBolt(t, filepath.Join(root, containerdOverlayDir, "metadata.db"), boltTree{
+		"v1": boltTree{
+			"snapshots": boltTree{
+				"k8s.io/7/4a1f":        boltTree{"id": uvarint(7), "parent": "k8s.io/5/" + chain[1]},
+				"k8s.io/5/" + chain[1]: boltTree{"id": uvarint(5), "parent": "k8s.io/3/" + chain[0]},
+				"k8s.io/3/" + chain[0]: boltTree{"id": uvarint(3)},
+			},
+		},
+	})
+
+	targets, err := DiscoverContainerd(root)
+	if err == nil || !strings.Contains(err.Error(), "k8s.io/9c2e") || !strings.Contains(err.Error(), `"native"`) {
+		t.Fatalf("expected the native snapshotter container to be reported, got %v", err)
+	}
+	snapshots := filepath.Join(root, containerdOverlayDir, "snapshots")
+	want := []Target{{
+		Root:        "containerd://k8s.io/4a1f",
+		Runtime:     RuntimeContainerd,
+		ID:          "4a1f",
+		Name:        "api",
+		Image:       image,
+		ImageID:     config,
+		ImageDigest: manifest,
+		Layers: []Layer{
+			{Digest: diffIDs[0], Dir: filepath.Join(snapshots, "3", "fs")},
+			{Digest: diffIDs[1], Dir: filepath.Join(snapshots, "5", "fs")},
+			{Dir: filepath.Join(snapshots, "7", "fs")},
+		},
+	}}
+	if !reflect.DeepEqual(targets, want) {
+		t.Fatalf("unexpected targets:\n got %+v\nwant %+v", targets, want)
+	}
+
+	if targets, err := DiscoverContainerd(filepath.Join(root, "missing")); err != nil || targets != nil {
+		t.Fatalf("expected nothing for a missing root, got %v, %v", targets, err)
+	}
+}
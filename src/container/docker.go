@@ -0,0 +1,170 @@
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DefaultDockerRoot is where the Docker daemon keeps its data.
+const DefaultDockerRoot = "/var/lib/docker"
+
+var errContainerdManaged = errors.New("layers managed by containerd")
+
+type dockerContainerConfig struct {
+	ID     string `json:"ID"`
+	Name   string `json:"Name"`
+	Image  string `json:"Image"`
+	Driver string `json:"Driver"`
+	Config struct {
+		Image string `json:"Image"`
+	} `json:"Config"`
+}
+
+type dockerRepositories struct {
+	Repositories map[string]map[string]string `json:"Repositories"`
+}
+
+// DiscoverDocker lists the containers under a Docker data root that use the
+// overlay2 storage driver, with the image layers and the writable layer of
+// each. A missing root yields no targets. Containers that cannot be read are
+// skipped and reported in the returned error.
+func DiscoverDocker(root string) ([]Target, error) {
+	entries, err := os.ReadDir(filepath.Join(root, "containers"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	digests := dockerImageDigests(root)
+	var targets []Target
+	var errs []error
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		target, err := dockerContainer(root, entry.Name(), digests)
+		if errors.Is(err, errContainerdManaged) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("docker container %s: %w", entry.Name(), err))
+			continue
+		}
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].ID < targets[j].ID })
+	return targets, errors.Join(errs...)
+}
+
+func dockerContainer(root, id string, digests map[string]string) (Target, error) {
+	data, err := readFileLimited(filepath.Join(root, "containers", id, "config.v2.json"), maxDocumentBytes)
+	if err != nil {
+		return Target{}, err
+	}
+	var cfg dockerContainerConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Target{}, fmt.Errorf("parse config.v2.json: %w", err)
+	}
+	if cfg.ID == "" {
+		cfg.ID = id
+	}
+	switch cfg.Driver {
+	case "overlay2":
+	case "overlayfs":
+		// Docker's containerd image store keeps the layers in containerd,
+		// under the moby namespace, where DiscoverContainerd finds them.
+		return Target{}, errContainerdManaged
+	default:
+		return Target{}, fmt.Errorf("unsupported storage driver %q", cfg.Driver)
+	}
+	layerDB := filepath.Join(root, "image", "overlay2", "layerdb")
+	mount := filepath.Join(layerDB, "mounts", cfg.ID)
+	mountID, err := readTrimmed(filepath.Join(mount, "mount-id"))
+	if err != nil {
+		return Target{}, err
+	}
+	if !isPlainName(mountID) {
+		return Target{}, fmt.Errorf("invalid mount-id %q", mountID)
+	}
+	var layers []Layer
+	// The parent file names the chain ID of the image's top layer; each
+	// layer names its own parent down to the base layer.
+	chainID, _ := readTrimmed(filepath.Join(mount, "parent"))
+	for depth := 0; chainID != ""; depth++ {
+		if depth > maxLayers {
+			return Target{}, fmt.Errorf("layer chain longer than %d", maxLayers)
+		}
+		_, encoded, err := digestHex(chainID)
+		if err != nil {
+			return Target{}, err
+		}
+		dir := filepath.Join(layerDB, "sha256", encoded)
+		diffID, err := readTrimmed(filepath.Join(dir, "diff"))
+		if err != nil {
+			return Target{}, err
+		}
+		cacheID, err := readTrimmed(filepath.Join(dir, "cache-id"))
+		if err != nil {
+			return Target{}, err
+		}
+		if !isPlainName(cacheID) {
+			return Target{}, fmt.Errorf("invalid cache-id %q", cacheID)
+		}
+		layers = append(layers, Layer{Digest: diffID, Dir: filepath.Join(root, "overlay2", cacheID, "diff")})
+		chainID, _ = readTrimmed(filepath.Join(dir, "parent"))
+	}
+	slices.Reverse(layers)
+	layers = append(layers, Layer{Dir: filepath.Join(root, "overlay2", mountID, "diff")})
+	return Target{
+		Root:        "docker://" + cfg.ID,
+		Runtime:     RuntimeDocker,
+		ID:          cfg.ID,
+		Name:        strings.TrimPrefix(cfg.Name, "/"),
+		Image:       cfg.Config.Image,
+		ImageID:     cfg.Image,
+		ImageDigest: digests[cfg.Image],
+		Layers:      layers,
+	}, nil
+}
+
+// dockerImageDigests maps image IDs to the manifest digest of the
+// repository@digest reference Docker recorded when the image was pulled.
+func dockerImageDigests(root string) map[string]string {
+	digests := map[string]string{}
+	data, err := readFileLimited(filepath.Join(root, "image", "overlay2", "repositories.json"), maxDocumentBytes)
+	if err != nil {
+		return digests
+	}
+	var repos dockerRepositories
+	if json.Unmarshal(data, &repos) != nil {
+		return digests
+	}
+	for _, refs := range repos.Repositories {
+		for ref, imageID := range refs {
+			if _, digest, ok := strings.Cut(ref, "@"); ok {
+				if prev, seen := digests[imageID]; !seen || digest < prev {
+					digests[imageID] = digest
+				}
+			}
+		}
+	}
+	return digests
+}
+
+// maxLayers bounds layer chains; images are limited to 127 layers.
+const maxLayers = 256
+
+func readTrimmed(name string) (string, error) {
+	data, err := readFileLimited(name, 4096)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
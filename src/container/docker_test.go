@@ -0,0 +1,64 @@
+package container
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscoverDocker(t *testing.T) {
+	root := t.TempDir()
+	const (
+		id       = "3f4e8c2a9b1d"
+		imageID  = "sha256:5ef79149e0ec84a7a9f9284c3f91aa3c20608f8391f5445eabe92ef07dbda03c"
+		manifest = "sha256:0f4a2f9c6a1b5d1e4bb3e7a3b1b7a64e2d7d2cf4a3c1f6b0e2a9d8c7b6a5f4e3"
+		baseDiff = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		appDiff  = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	)
+	chain := chainIDs([]string{baseDiff, appDiff})
+	writeTestFile(t, root, "containers/"+id+"/config.v2.json", []byte(`{"ID":"`+id+`","Name":"/web","Image":"`+imageID+`","Driver":"overlay2","Config":{"Image":"nginx:1.27"}}`))
+	writeTestFile(t, root, "containers/0000aaaa/config.v2.json", []byte(`{"ID":"0000aaaa","Driver":"vfs"}`))
+	writeTestFile(t, root, "containers/1111bbbb/config.v2.json", []byte(`{"ID":"1111bbbb","Driver":"overlayfs"}`))
+	mounts := "image/overlay2/layerdb/mounts/" + id + "/"
+	writeTestFile(t, root, mounts+"mount-id", []byte("rw0"))
+	writeTestFile(t, root, mounts+"parent", []byte(chain[1]))
+	for i, layer := range []struct{ diff, cache, parent string }{
+		{baseDiff, "ro0", ""},
+		{appDiff, "ro1", chain[0]},
+	} {
+		dir := "image/overlay2/layerdb/sha256/" + strings.TrimPrefix(chain[i], "sha256:") + "/"
+		writeTestFile(t, root, dir+"diff", []byte(layer.diff))
+		writeTestFile(t, root, dir+"cache-id", []byte(layer.cache+"\n"))
+		if layer.parent != "" {
+			writeTestFile(t, root, dir+"parent", []byte(layer.parent))
+		}
+	}
+	writeTestFile(t, root, "image/overlay2/repositories.json", []byte(`{"Repositories":{"nginx":{"nginx:1.27":"`+imageID+`","nginx@`+manifest+`":"`+imageID+`"}}}`))
+
+	targets, err := DiscoverDocker(root)
+	if err == nil || !strings.Contains(err.Error(), "0000aaaa") || !strings.Contains(err.Error(), `"vfs"`) || strings.Contains(err.Error(), "1111bbbb") {
+		t.Fatalf("expected only the vfs container to be reported, got %v", err)
+	}
+	want := []Target{{
+		Root:        "docker://" + id,
+		Runtime:     RuntimeDocker,
+		ID:          id,
+		Name:        "web",
+		Image:       "nginx:1.27",
+		ImageID:     imageID,
+		ImageDigest: manifest,
+		Layers: []Layer{
+			{Digest: baseDiff, Dir: filepath.Join(root, "overlay2", "ro0", "diff")},
+			{Digest: appDiff, Dir: filepath.Join(root, "overlay2", "ro1", "diff")},
+			{Dir: filepath.Join(root, "overlay2", "rw0", "diff")},
+		},
+	}}
+	if !reflect.DeepEqual(targets, want) {
+		t.Fatalf("unexpected targets:\n got %+v\nwant %+v", targets, want)
+	}
+
+	if targets, err := DiscoverDocker(filepath.Join(root, "missing")); err != nil || targets != nil {
+		t.Fatalf("expected nothing for a missing root, got %v, %v", targets, err)
+	}
+}
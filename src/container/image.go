@@ -0,0 +1,323 @@
+package container
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	annotationRefName        = "org.opencontainers.image.ref.name"
+	annotationContainerdName = "io.containerd.image.name"
+	// annotationReferenceType marks the attestation manifests BuildKit adds
+	// to an index; their layers are in-toto statements, not filesystems.
+	annotationReferenceType = "vnd.docker.reference.type"
+)
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *struct {
+		Architecture string `json:"architecture"`
+		OS           string `json:"os"`
+	} `json:"platform,omitempty"`
+}
+
+// ociDocument covers both image indexes and image manifests, which are told
+// apart by which lists they carry.
+type ociDocument struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+type imageConfig struct {
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// dockerSaveEntry is one image in the manifest.json written by docker save.
+type dockerSaveEntry struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// imageSource opens files of an image layout by their slash-separated
+// relative name.
+type imageSource interface {
+	open(name string) (io.ReadCloser, error)
+}
+
+// OpenImage reads an OCI image layout or a docker save archive, given as a
+// directory or a tar file, and returns one target per image it holds. Layers
+// are read lazily while a target is walked.
+func OpenImage(imagePath string) ([]Target, error) {
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	var src imageSource
+	if info.IsDir() {
+		src = dirSource(imagePath)
+	} else {
+		src, err = newTarSource(imagePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if data, err := readSource(src, "index.json"); err == nil {
+		return ociTargets(imagePath, src, data)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	data, err := readSource(src, "manifest.json")
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s: no index.json or manifest.json", imagePath)
+		}
+		return nil, err
+	}
+	return dockerSaveTargets(imagePath, src, data)
+}
+
+func ociTargets(imagePath string, src imageSource, data []byte) ([]Target, error) {
+	var index ociDocument
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("parse index.json: %w", err)
+	}
+	blobs := func(digest string) (io.ReadCloser, error) {
+		algorithm, encoded, err := digestHex(digest)
+		if err != nil {
+			return nil, err
+		}
+		return src.open("blobs/" + algorithm + "/" + encoded)
+	}
+	var targets []Target
+	var errs []error
+	for _, desc := range index.Manifests {
+		if desc.Annotations[annotationReferenceType] != "" {
+			continue
+		}
+		target, err := resolveImage(blobs, desc)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", desc.Digest, err))
+			continue
+		}
+		target.Root = imagePath + "@" + desc.Digest
+		target.Image = desc.Annotations[annotationContainerdName]
+		if target.Image == "" {
+			target.Image = desc.Annotations[annotationRefName]
+		}
+		targets = append(targets, target)
+	}
+	return targets, errors.Join(errs...)
+}
+
+// resolveImage follows a manifest or index descriptor to the manifest for
+// this host's platform and returns an image target for it. ImageDigest is
+// the digest of desc, as a registry would report it for a multi-platform
+// image.
+func resolveImage(blobs func(string) (io.ReadCloser, error), desc ociDescriptor) (Target, error) {
+	target := Target{Runtime: RuntimeImage, ImageDigest: desc.Digest}
+	var manifest ociDocument
+	for depth := 0; ; depth++ {
+		if depth > 8 {
+			return Target{}, fmt.Errorf("index nesting too deep")
+		}
+		data, err := readBlob(blobs, desc.Digest)
+		if err != nil {
+			return Target{}, err
+		}
+		manifest = ociDocument{}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return Target{}, fmt.Errorf("parse %s: %w", desc.Digest, err)
+		}
+		if len(manifest.Manifests) == 0 {
+			break
+		}
+		next, ok := platformManifest(manifest.Manifests)
+		if !ok {
+			return Target{}, fmt.Errorf("index %s lists no image manifests", desc.Digest)
+		}
+		desc = next
+	}
+	target.ImageID = manifest.Config.Digest
+	data, err := readBlob(blobs, manifest.Config.Digest)
+	if err != nil {
+		return Target{}, fmt.Errorf("config: %w", err)
+	}
+	var cfg imageConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Target{}, fmt.Errorf("parse config %s: %w", manifest.Config.Digest, err)
+	}
+	for i, layer := range manifest.Layers {
+		diffID := layer.Digest
+		if i < len(cfg.RootFS.DiffIDs) {
+			diffID = cfg.RootFS.DiffIDs[i]
+		}
+		target.Layers = append(target.Layers, Layer{Digest: diffID, Open: func() (io.ReadCloser, error) {
+			rc, err := blobs(layer.Digest)
+			if err != nil {
+				return nil, err
+			}
+			return decompressed(rc)
+		}})
+	}
+	return target, nil
+}
+
+// platformManifest picks the entry of an index for this host's platform,
+// falling back to the first image manifest.
+func platformManifest(manifests []ociDescriptor) (ociDescriptor, bool) {
+	var first *ociDescriptor
+	for i := range manifests {
+		desc := &manifests[i]
+		if desc.Annotations[annotationReferenceType] != "" {
+			continue
+		}
+		if desc.Platform != nil && desc.Platform.OS == runtime.GOOS && desc.Platform.Architecture == runtime.GOARCH {
+			return *desc, true
+		}
+		if first == nil {
+			first = desc
+		}
+	}
+	if first == nil {
+		return ociDescriptor{}, false
+	}
+	return *first, true
+}
+
+func dockerSaveTargets(imagePath string, src imageSource, data []byte) ([]Target, error) {
+	var entries []dockerSaveEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse manifest.json: %w", err)
+	}
+	var targets []Target
+	var errs []error
+	for _, entry := range entries {
+		config, err := readSource(src, entry.Config)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config %s: %w", entry.Config, err))
+			continue
+		}
+		var cfg imageConfig
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			errs = append(errs, fmt.Errorf("parse config %s: %w", entry.Config, err))
+			continue
+		}
+		// Older archives name the config <hex>.json, newer ones store it as
+		// blobs/sha256/<hex>; either way the hex is the image ID.
+		imageID := "sha256:" + strings.TrimSuffix(path.Base(entry.Config), ".json")
+		target := Target{Root: imagePath + "@" + imageID, Runtime: RuntimeImage, ImageID: imageID}
+		if len(entry.RepoTags) > 0 {
+			target.Image = entry.RepoTags[0]
+		}
+		for i, name := range entry.Layers {
+			var diffID string
+			if i < len(cfg.RootFS.DiffIDs) {
+				diffID = cfg.RootFS.DiffIDs[i]
+			}
+			target.Layers = append(target.Layers, Layer{Digest: diffID, Open: func() (io.ReadCloser, error) {
+				rc, err := src.open(name)
+				if err != nil {
+					return nil, err
+				}
+				return decompressed(rc)
+			}})
+		}
+		targets = append(targets, target)
+	}
+	return targets, errors.Join(errs...)
+}
+
+func readSource(src imageSource, name string) ([]byte, error) {
+	rc, err := src.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return readLimited(rc, maxDocumentBytes)
+}
+
+func readBlob(blobs func(string) (io.ReadCloser, error), digest string) ([]byte, error) {
+	rc, err := blobs(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return readLimited(rc, maxDocumentBytes)
+}
+
+type dirSource string
+
+func (d dirSource) open(name string) (io.ReadCloser, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return nil, fmt.Errorf("invalid path %q", name)
+	}
+	return os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// tarSource reads members of an uncompressed image archive in place. Their
+// offsets are indexed once so layers can be opened in any order.
+type tarSource struct {
+	path    string
+	members map[string]tarMember
+}
+
+type tarMember struct {
+	offset int64
+	size   int64
+}
+
+func newTarSource(name string) (*tarSource, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	src := &tarSource{path: name, members: map[string]tarMember{}}
+	reader := tar.NewReader(f)
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			return src, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// The tar reader consumes headers without reading ahead, so the
+		// file offset is now the start of this member's content.
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		src.members[path.Clean(strings.TrimPrefix(hdr.Name, "./"))] = tarMember{offset: offset, size: hdr.Size}
+	}
+}
+
+func (s *tarSource) open(name string) (io.ReadCloser, error) {
+	member, ok := s.members[path.Clean(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	return readCloser{Reader: io.NewSectionReader(f, member.offset, member.size), close: f.Close}, nil
+}
@@ -0,0 +1,176 @@
+package container
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// writeBlob stores data in an OCI layout's blob directory.
+func writeBlob(t *testing.T, layout string, data []byte) string {
+	t.Helper()
+	digest := digestOf(data)
+	writeTestFile(t, layout, "blobs/sha256/"+digest[len("sha256:"):], data)
+	return digest
+}
+
+func writeJSONBlob(t *testing.T, layout string, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeBlob(t, layout, data)
+}
+
+// tarDir archives a directory, as docker save and skopeo write image
+// tarballs.
+func tarDir(t *testing.T, dir, name string) {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenImageOCILayout(t *testing.T) {
+	layout := t.TempDir()
+	base := tarBytes(t, "etc/os-release", "ID=alpine", "app/.env", "API_KEY=old")
+	app := tarBytes(t, "app/.wh..env", "", "app/server", "bin")
+	baseBlob := writeBlob(t, layout, gzipBytes(t, base))
+	appBlob := writeBlob(t, layout, app)
+	config := writeJSONBlob(t, layout, map[string]any{
+		"rootfs": map[string]any{"type": "layers", "diff_ids": []string{digestOf(base), digestOf(app)}},
+	})
+	manifest := writeJSONBlob(t, layout, map[string]any{
+		"schemaVersion": 2,
+		"config":        map[string]any{"digest": config},
+		"layers":        []map[string]any{{"digest": baseBlob}, {"digest": appBlob}},
+	})
+	other := writeJSONBlob(t, layout, map[string]any{"schemaVersion": 2, "config": map[string]any{"digest": "sha256:missing"}})
+	index := writeJSONBlob(t, layout, map[string]any{
+		"schemaVersion": 2,
+		"manifests": []map[string]any{
+			{"digest": other, "platform": map[string]string{"os": "plan9", "architecture": "mips"}},
+			{"digest": other, "annotations": map[string]string{annotationReferenceType: "attestation-manifest"}},
+			{"digest": manifest, "platform": map[string]string{"os": runtime.GOOS, "architecture": runtime.GOARCH}},
+		},
+	})
+	indexJSON, _ := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"manifests": []map[string]any{{
+			"digest":      index,
+			"annotations": map[string]string{annotationContainerdName: "registry.example/app:1.0", annotationRefName: "1.0"},
+		}},
+	})
+	writeTestFile(t, layout, "index.json", indexJSON)
+	archive := filepath.Join(t.TempDir(), "app.tar")
+	tarDir(t, layout, archive)
+
+	for _, path := range []string{layout, archive} {
+		targets, err := OpenImage(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if len(targets) != 1 {
+			t.Fatalf("%s: expected one image, got %d", path, len(targets))
+		}
+		got := targets[0]
+		if got.Root != path+"@"+index || got.Runtime != RuntimeImage || got.Image != "registry.example/app:1.0" ||
+			got.ImageID != config || got.ImageDigest != index || len(got.Layers) != 2 {
+			t.Fatalf("%s: unexpected target %+v", path, got)
+		}
+		want := []string{
+			digestOf(app) + ":/app/server=bin",
+			digestOf(base) + ":/etc/os-release=ID=alpine",
+			digestOf(base) + ":/app/.env=API_KEY=old (shadowed)",
+		}
+		if summary := walkSummary(t, &got); !reflect.DeepEqual(summary, want) {
+			t.Fatalf("%s: unexpected walk:\n got %q\nwant %q", path, summary, want)
+		}
+	}
+}
+
+func TestOpenImageDockerSave(t *testing.T) {
+	dir := t.TempDir()
+	layer := tarBytes(t, "root/.aws/credentials", "aws_secret_access_key=x")
+	config, _ := json.Marshal(map[string]any{"rootfs": map[string]any{"diff_ids": []string{digestOf(layer)}}})
+	configName := digestOf(config)[len("sha256:"):] + ".json"
+	writeTestFile(t, dir, configName, config)
+	writeTestFile(t, dir, "5d1c/layer.tar", layer)
+	manifest, _ := json.Marshal([]map[string]any{{"Config": configName, "RepoTags": []string{"tools:latest"}, "Layers": []string{"5d1c/layer.tar"}}})
+	writeTestFile(t, dir, "manifest.json", manifest)
+	archive := filepath.Join(t.TempDir(), "tools.tar")
+	tarDir(t, dir, archive)
+
+	targets, err := OpenImage(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 {
+		t.Fatalf("expected one image, got %d", len(targets))
+	}
+	got := targets[0]
+	if got.Root != archive+"@"+digestOf(config) || got.Image != "tools:latest" || got.ImageID != digestOf(config) || got.ImageDigest != "" {
+		t.Fatalf("unexpected target %+v", got)
+	}
+	want := []string{digestOf(layer) + ":/root/.aws/credentials=aws_secret_access_key=x"}
+	if summary := walkSummary(t, &got); !reflect.DeepEqual(summary, want) {
+		t.Fatalf("unexpected walk:\n got %q\nwant %q", summary, want)
+	}
+}
+
+func TestOpenImageRejectsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "readme.txt", []byte("hello"))
+	if _, err := OpenImage(dir); err == nil {
+		t.Fatal("expected an error for a directory without an image")
+	}
+	if _, err := OpenImage(filepath.Join(dir, "readme.txt")); err == nil {
+		t.Fatal("expected an error for a file that is not a tar")
+	}
+}
@@ -0,0 +1,39 @@
+//go:build linux
+// +build linux
+
+package container
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestWalkAppliesOverlayWhiteouts(t *testing.T) {
+	lower, upper := t.TempDir(), t.TempDir()
+	writeTestFile(t, lower, "app/secret.env", []byte("TOKEN=1"))
+	writeTestFile(t, lower, "app/main", []byte("v1"))
+	writeTestFile(t, lower, "cache/a", []byte("x"))
+	writeTestFile(t, upper, "cache/b", []byte("y"))
+	writeTestFile(t, upper, "app/main", []byte("v2"))
+	if err := unix.Mknod(filepath.Join(upper, "app", "secret.env"), unix.S_IFCHR, 0); err != nil {
+		t.Skipf("cannot create whiteout device: %v", err)
+	}
+	if err := unix.Lsetxattr(filepath.Join(upper, "cache"), "user.overlay.opaque", []byte("y"), 0); err != nil {
+		t.Skipf("cannot set opaque xattr: %v", err)
+	}
+
+	target := &Target{Layers: []Layer{{Digest: "sha256:lower", Dir: lower}, {Dir: upper}}}
+	want := []string{
+		":/app/main=v2",
+		":/cache/b=y",
+		"sha256:lower:/app/main=v1 (shadowed)",
+		"sha256:lower:/app/secret.env=TOKEN=1 (shadowed)",
+		"sha256:lower:/cache/a=x (shadowed)",
+	}
+	if got := walkSummary(t, target); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected walk:\n got %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+// +build !windows
+
+package container
+
+import (
+	"io/fs"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// opaqueXattrs mark an overlayfs directory whose lower contents are hidden;
+// rootless setups use the user namespace.
+var opaqueXattrs = []string{"trusted.overlay.opaque", "user.overlay.opaque"}
+
+// isWhiteoutDevice reports whether info is an overlayfs whiteout, a character
+// device with device number 0/0 that deletes the same path in lower layers.
+func isWhiteoutDevice(info fs.FileInfo) bool {
+	if info.Mode()&fs.ModeCharDevice == 0 {
+		return false
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && uint64(st.Rdev) == 0
+}
+
+func isOpaqueDir(path string) bool {
+	buf := make([]byte, 1)
+	for _, name := range opaqueXattrs {
+		if n, err := unix.Lgetxattr(path, name, buf); err == nil && n == 1 && buf[0] == 'y' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package container
+
+import "io/fs"
+
+// Overlayfs layers only exist on Linux hosts; Windows containers use a
+// different layer format that is not read here.
+func isWhiteoutDevice(info fs.FileInfo) bool { return false }
+
+func isOpaqueDir(path string) bool { return false }
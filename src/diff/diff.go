@@ -0,0 +1,438 @@
+// Package diff compares two NDJSON scans and reports what changed between
+// them as typed change records.
+package diff
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"safnari/output"
+)
+
+// Change record types.
+const (
+	FileAdded      = "file_added"
+	FileRemoved    = "file_removed"
+	FileModified   = "file_modified"
+	ACLChanged     = "acl_changed"
+	SensitiveNew   = "sensitive_new"
+	ProcessStarted = "process_started"
+)
+
+// Options tune how a diff uses memory.
+type Options struct {
+	// TempDir holds the sorted runs of file states that do not fit in
+	// memory. The system temporary directory is used when empty.
+	TempDir string
+	// RunBytes is roughly how many bytes of file records are sorted in
+	// memory at a time (default 64 MiB).
+	RunBytes int
+}
+
+// Stats counts the change records written, by record type.
+type Stats map[string]int
+
+// FileSummary identifies a file in an added or removed record.
+type FileSummary struct {
+	Path    string            `json:"path"`
+	FileID  string            `json:"file_id,omitempty"`
+	Size    int64             `json:"size,omitempty"`
+	ModTime string            `json:"mod_time,omitempty"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+// FileContent is the content side of a modified file.
+type FileContent struct {
+	Path    string            `json:"path"`
+	Size    int64             `json:"size,omitempty"`
+	ModTime string            `json:"mod_time,omitempty"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+// FileModification is the payload of a file_modified record. Changes names
+// the fields that differ: path, size, mod_time and hashes.
+type FileModification struct {
+	Path    string      `json:"path"`
+	FileID  string      `json:"file_id,omitempty"`
+	Changes []string    `json:"changes"`
+	Old     FileContent `json:"old"`
+	New     FileContent `json:"new"`
+}
+
+// FileAccess is the permission side of an acl_changed record.
+type FileAccess struct {
+	Permissions string `json:"permissions,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	ACL         string `json:"acl,omitempty"`
+}
+
+// AccessChange is the payload of an acl_changed record.
+type AccessChange struct {
+	Path   string     `json:"path"`
+	FileID string     `json:"file_id,omitempty"`
+	Old    FileAccess `json:"old"`
+	New    FileAccess `json:"new"`
+}
+
+// SensitiveMatches is the payload of a sensitive_new record: the values per
+// data type found in the new scan but not in the old one. Values compare as
+// written, so hash and hmac redaction keep them comparable across scans.
+type SensitiveMatches struct {
+	Path          string              `json:"path"`
+	FileID        string              `json:"file_id,omitempty"`
+	SensitiveData map[string][]string `json:"sensitive_data"`
+}
+
+// Process is the payload of a process_started record.
+type Process struct {
+	PID       int32  `json:"pid"`
+	PPID      int32  `json:"ppid,omitempty"`
+	Name      string `json:"name"`
+	Cmdline   string `json:"cmdline,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Exe       string `json:"exe,omitempty"`
+	StartTime string `json:"start_time,omitempty"`
+}
+
+// identity is what makes two processes the same program across scans; PIDs
+// and start times change with every restart.
+func (p Process) identity() string {
+	return strings.Join([]string{p.Name, p.Exe, p.Cmdline, p.Username}, "\x00")
+}
+
+type changeRecord struct {
+	RecordType    string `json:"record_type"`
+	SchemaVersion string `json:"schema_version"`
+	Payload       any    `json:"payload"`
+}
+
+// differ writes change records as NDJSON. Files left unpaired by path are
+// collected in oldRenamed and newRenamed to be paired by file ID.
+type differ struct {
+	enc        *json.Encoder
+	stats      Stats
+	oldRenamed *sorter
+	newRenamed *sorter
+}
+
+func (d *differ) emit(recordType string, payload any) error {
+	d.stats[recordType]++
+	return d.enc.Encode(changeRecord{RecordType: recordType, SchemaVersion: output.SchemaVersion, Payload: payload})
+}
+
+// Scans compares the scan written to oldPath with the one written to newPath
+// and writes change records to w as NDJSON. Rotated segments of each scan
+// (scan.1.ndjson, ...) are read after the base file. File records are sorted
+// through temporary files when they do not fit in opts.RunBytes, so scans
+// larger than memory can be compared.
+func Scans(w io.Writer, oldPath, newPath string, opts Options) (Stats, error) {
+	tempDir, err := os.MkdirTemp(opts.TempDir, "safnari-diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	buf := bufio.NewWriterSize(w, 256*1024)
+	d := &differ{
+		enc:        json.NewEncoder(buf),
+		stats:      Stats{},
+		oldRenamed: newSorter(tempDir, "old-renamed", opts.RunBytes),
+		newRenamed: newSorter(tempDir, "new-renamed", opts.RunBytes),
+	}
+	d.enc.SetEscapeHTML(false)
+
+	oldFiles := newSorter(tempDir, "old", opts.RunBytes)
+	oldProcesses := make(map[string]struct{})
+	err = output.ReadRecords(oldPath, func(recordType string, payload json.RawMessage) error {
+		switch recordType {
+		case "file":
+			state, size, err := newFileState(payload)
+			if err != nil {
+				return err
+			}
+			return oldFiles.add(state, size)
+		case "process":
+			var p Process
+			if err := json.Unmarshal(payload, &p); err != nil {
+				return err
+			}
+			oldProcesses[p.identity()] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	newFiles := newSorter(tempDir, "new", opts.RunBytes)
+	err = output.ReadRecords(newPath, func(recordType string, payload json.RawMessage) error {
+		switch recordType {
+		case "file":
+			state, size, err := newFileState(payload)
+			if err != nil {
+				return err
+			}
+			return newFiles.add(state, size)
+		case "process":
+			var p Process
+			if err := json.Unmarshal(payload, &p); err != nil {
+				return err
+			}
+			if _, ok := oldProcesses[p.identity()]; !ok {
+				oldProcesses[p.identity()] = struct{}{}
+				return d.emit(ProcessStarted, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := joinSorted(oldFiles, newFiles, d.comparePaths); err != nil {
+		return nil, err
+	}
+	if err := joinSorted(d.oldRenamed, d.newRenamed, d.compareRenamed); err != nil {
+		return nil, err
+	}
+	if err := buf.Flush(); err != nil {
+		return nil, err
+	}
+	return d.stats, nil
+}
+
+// groupReader reads runs of states that share a key.
+type groupReader struct {
+	it   stateIterator
+	head *fileState
+}
+
+func newGroupReader(it stateIterator) (*groupReader, error) {
+	head, err := it.next()
+	if err != nil {
+		return nil, err
+	}
+	return &groupReader{it: it, head: head}, nil
+}
+
+func (g *groupReader) next() ([]*fileState, error) {
+	if g.head == nil {
+		return nil, nil
+	}
+	group := []*fileState{g.head}
+	for {
+		state, err := g.it.next()
+		if err != nil {
+			return nil, err
+		}
+		if state == nil || state.Key != group[0].Key {
+			g.head = state
+			return group, nil
+		}
+		group = append(group, state)
+	}
+}
+
+// joinSorted finishes both sorters and joins their states.
+func joinSorted(oldFiles, newFiles *sorter, compare func(olds, news []*fileState) error) error {
+	oldIter, err := oldFiles.finish()
+	if err != nil {
+		return err
+	}
+	defer oldIter.close()
+	newIter, err := newFiles.finish()
+	if err != nil {
+		return err
+	}
+	defer newIter.close()
+	return join(oldIter, newIter, compare)
+}
+
+// join merges the sorted old and new states key by key and passes each pair
+// of groups to compare; either group may be empty.
+func join(oldIter, newIter stateIterator, compare func(olds, news []*fileState) error) error {
+	olds, err := newGroupReader(oldIter)
+	if err != nil {
+		return err
+	}
+	news, err := newGroupReader(newIter)
+	if err != nil {
+		return err
+	}
+	for olds.head != nil || news.head != nil {
+		var oldGroup, newGroup []*fileState
+		switch {
+		case news.head == nil || (olds.head != nil && olds.head.Key < news.head.Key):
+			oldGroup, err = olds.next()
+		case olds.head == nil || news.head.Key < olds.head.Key:
+			newGroup, err = news.next()
+		default:
+			if oldGroup, err = olds.next(); err == nil {
+				newGroup, err = news.next()
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if err := compare(oldGroup, newGroup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// comparePaths compares the files that share a path, whatever their file
+// IDs. Files found in only one scan are set aside to be paired as renames,
+// or reported as removed or added when the scan could not read a file ID.
+func (d *differ) comparePaths(olds, news []*fileState) error {
+	for len(olds) > 0 && len(news) > 0 {
+		if err := d.compareFile(olds[0], news[0]); err != nil {
+			return err
+		}
+		olds, news = olds[1:], news[1:]
+	}
+	var removed, added []*fileState
+	for _, old := range olds {
+		if old.FileID == "" {
+			removed = append(removed, old)
+		} else if err := setAside(d.oldRenamed, old); err != nil {
+			return err
+		}
+	}
+	for _, state := range news {
+		if state.FileID == "" {
+			added = append(added, state)
+		} else if err := setAside(d.newRenamed, state); err != nil {
+			return err
+		}
+	}
+	return d.removedAdded(removed, added)
+}
+
+// setAside adds state to renamed keyed by its file ID.
+func setAside(renamed *sorter, state *fileState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	state.Key = state.FileID
+	return renamed.add(state, len(data))
+}
+
+// compareRenamed compares the files whose paths are gone from one scan but
+// share a file ID. A group usually holds one file per scan; hard links are
+// paired in order, and leftovers are reported as removed or added.
+func (d *differ) compareRenamed(olds, news []*fileState) error {
+	for len(olds) > 0 && len(news) > 0 {
+		if err := d.compareFile(olds[0], news[0]); err != nil {
+			return err
+		}
+		olds, news = olds[1:], news[1:]
+	}
+	return d.removedAdded(olds, news)
+}
+
+// removedAdded reports files found in only one scan.
+func (d *differ) removedAdded(olds, news []*fileState) error {
+	for _, old := range olds {
+		if err := d.emit(FileRemoved, summary(old)); err != nil {
+			return err
+		}
+	}
+	for _, state := range news {
+		if err := d.emit(FileAdded, summary(state)); err != nil {
+			return err
+		}
+		if err := d.emitSensitive(state, newSensitive(nil, state.Sensitive)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *differ) compareFile(old, state *fileState) error {
+	var changes []string
+	if old.Path != state.Path {
+		changes = append(changes, "path")
+	}
+	if old.Size != state.Size {
+		changes = append(changes, "size")
+	}
+	if old.ModTime != state.ModTime {
+		changes = append(changes, "mod_time")
+	}
+	if hashesDiffer(old.Hashes, state.Hashes) {
+		changes = append(changes, "hashes")
+	}
+	if len(changes) > 0 {
+		err := d.emit(FileModified, FileModification{
+			Path:    state.Path,
+			FileID:  state.FileID,
+			Changes: changes,
+			Old:     content(old),
+			New:     content(state),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	oldAccess, newAccess := access(old), access(state)
+	if oldAccess != newAccess {
+		err := d.emit(ACLChanged, AccessChange{Path: state.Path, FileID: state.FileID, Old: oldAccess, New: newAccess})
+		if err != nil {
+			return err
+		}
+	}
+	return d.emitSensitive(state, newSensitive(old.Sensitive, state.Sensitive))
+}
+
+func (d *differ) emitSensitive(state *fileState, matches map[string][]string) error {
+	if len(matches) == 0 {
+		return nil
+	}
+	return d.emit(SensitiveNew, SensitiveMatches{Path: state.Path, FileID: state.FileID, SensitiveData: matches})
+}
+
+// hashesDiffer reports whether any algorithm both scans hashed with gave a
+// different digest.
+func hashesDiffer(old, cur map[string]string) bool {
+	for algorithm, digest := range cur {
+		if prev, ok := old[algorithm]; ok && prev != digest {
+			return true
+		}
+	}
+	return false
+}
+
+// newSensitive returns the values per data type in cur that old lacks.
+func newSensitive(old, cur map[string][]string) map[string][]string {
+	var found map[string][]string
+	for dataType, values := range cur {
+		for _, value := range values {
+			if slices.Contains(old[dataType], value) || slices.Contains(found[dataType], value) {
+				continue
+			}
+			if found == nil {
+				found = make(map[string][]string)
+			}
+			found[dataType] = append(found[dataType], value)
+		}
+	}
+	return found
+}
+
+func summary(state *fileState) FileSummary {
+	return FileSummary{Path: state.Path, FileID: state.FileID, Size: state.Size, ModTime: state.ModTime, Hashes: state.Hashes}
+}
+
+func content(state *fileState) FileContent {
+	return FileContent{Path: state.Path, Size: state.Size, ModTime: state.ModTime, Hashes: state.Hashes}
+}
+
+func access(state *fileState) FileAccess {
+	return FileAccess{Permissions: state.Permissions, Owner: state.Owner, ACL: state.ACL}
+}
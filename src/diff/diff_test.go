@@ -0,0 +1,249 @@
+package diff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testRecord struct {
+	recordType string
+	payload    any
+}
+
+func file(payload map[string]any) testRecord {
+	return testRecord{recordType: "file", payload: payload}
+}
+
+func process(name string, pid int) testRecord {
+	return testRecord{recordType: "process", payload: map[string]any{"pid": pid, "name": name, "exe": "/usr/bin/" + name}}
+}
+
+// writeScan writes records as a schema v2 scan, one segment per slice.
+func writeScan(t *testing.T, base string, segments ...[]testRecord) {
+	t.Helper()
+	ext := filepath.Ext(base)
+	for i, records := range segments {
+		name := base
+		if i > 0 {
+			name = strings.TrimSuffix(base, ext) + "." + strconv.Itoa(i) + ext
+		}
+		var buf bytes.Buffer
+		for _, record := range records {
+			line, err := json.Marshal(map[string]any{"record_type": record.recordType, "schema_version": "3", "payload": record.payload})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			buf.Write(append(line, '\n'))
+		}
+		if err := os.WriteFile(name, buf.Bytes(), 0600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+type change struct {
+	RecordType string          `json:"record_type"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+func readChanges(t *testing.T, data []byte) map[string][]map[string]any {
+	t.Helper()
+	changes := make(map[string][]map[string]any)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var c change
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			t.Fatalf("parse change %q: %v", scanner.Text(), err)
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(c.Payload, &payload); err != nil {
+			t.Fatalf("parse payload: %v", err)
+		}
+		changes[c.RecordType] = append(changes[c.RecordType], payload)
+	}
+	return changes
+}
+
+func paths(payloads []map[string]any) []string {
+	var out []string
+	for _, p := range payloads {
+		if path, ok := p["path"].(string); ok {
+			out = append(out, path)
+		} else {
+			out = append(out, p["name"].(string))
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+func TestScansReportsTypedChanges(t *testing.T) {
+	dir := t.TempDir()
+	oldScan := filepath.Join(dir, "old.ndjson")
+	newScan := filepath.Join(dir, "new.ndjson")
+	writeScan(t, oldScan, []testRecord{
+		{recordType: "system_info", payload: map[string]any{}},
+		process("sshd", 10),
+		file(map[string]any{"path": "/srv/a", "file_id": "dev=1,inode=1", "size": 10, "hashes": map[string]string{"sha256": "aaa"}}),
+		file(map[string]any{"path": "/srv/b", "file_id": "dev=1,inode=2", "size": 20}),
+		file(map[string]any{"path": "/srv/c", "size": 30}),
+		file(map[string]any{"path": "/srv/d", "file_id": "dev=1,inode=4", "permissions": "-rw-r--r--", "owner": "root"}),
+		file(map[string]any{"path": "/srv/e", "file_id": "dev=1,inode=5", "sensitive_data": map[string][]string{"email": {"a@example.com"}}}),
+		file(map[string]any{"path": "/srv/g", "file_id": "dev=1,inode=7", "size": 70}),
+		{recordType: "metrics", payload: map[string]any{}},
+	})
+	writeScan(t, newScan, []testRecord{
+		process("sshd", 11),
+		process("nc", 12),
+		file(map[string]any{"path": "/srv/a", "file_id": "dev=1,inode=1", "size": 10, "hashes": map[string]string{"sha256": "bbb"}}),
+		file(map[string]any{"path": "/srv/c", "size": 30}),
+		file(map[string]any{"path": "/srv/d", "file_id": "dev=1,inode=4", "permissions": "-rw-rw-rw-", "owner": "root"}),
+	}, []testRecord{
+		file(map[string]any{"path": "/srv/e", "file_id": "dev=1,inode=5", "sensitive_data": map[string][]string{"email": {"a@example.com", "b@example.com"}}}),
+		file(map[string]any{"path": "/srv/f", "file_id": "dev=1,inode=6", "sensitive_data": map[string][]string{"ssn": {"***-**-1234"}}}),
+		file(map[string]any{"path": "/srv/h", "file_id": "dev=1,inode=7", "size": 70}),
+		{recordType: "metrics", payload: map[string]any{}},
+	})
+
+	for _, runBytes := range []int{0, 1} {
+		var out bytes.Buffer
+		stats, err := Scans(&out, oldScan, newScan, Options{TempDir: dir, RunBytes: runBytes})
+		if err != nil {
+			t.Fatalf("diff (run bytes %d): %v", runBytes, err)
+		}
+		changes := readChanges(t, out.Bytes())
+		want := map[string][]string{
+			FileAdded:      {"/srv/f"},
+			FileRemoved:    {"/srv/b"},
+			FileModified:   {"/srv/a", "/srv/h"},
+			ACLChanged:     {"/srv/d"},
+			SensitiveNew:   {"/srv/e", "/srv/f"},
+			ProcessStarted: {"nc"},
+		}
+		for recordType, wantPaths := range want {
+			if got := paths(changes[recordType]); !slices.Equal(got, wantPaths) {
+				t.Fatalf("run bytes %d: %s = %v, want %v", runBytes, recordType, got, wantPaths)
+			}
+			if stats[recordType] != len(wantPaths) {
+				t.Fatalf("run bytes %d: stats[%s] = %d, want %d", runBytes, recordType, stats[recordType], len(wantPaths))
+			}
+		}
+		if len(changes) != len(want) {
+			t.Fatalf("run bytes %d: unexpected change types %v", runBytes, changes)
+		}
+
+		for _, modified := range changes[FileModified] {
+			changed := modified["changes"].([]any)
+			switch modified["path"] {
+			case "/srv/a":
+				if len(changed) != 1 || changed[0] != "hashes" {
+					t.Fatalf("expected a hash change for /srv/a, got %v", changed)
+				}
+			case "/srv/h":
+				if len(changed) != 1 || changed[0] != "path" || modified["old"].(map[string]any)["path"] != "/srv/g" {
+					t.Fatalf("expected /srv/g renamed to /srv/h, got %v", modified)
+				}
+			}
+		}
+		for _, sensitive := range changes[SensitiveNew] {
+			if sensitive["path"] != "/srv/e" {
+				continue
+			}
+			emails := sensitive["sensitive_data"].(map[string]any)["email"].([]any)
+			if len(emails) != 1 || emails[0] != "b@example.com" {
+				t.Fatalf("expected only the new email match, got %v", emails)
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "safnari-diff-") {
+			t.Fatalf("temporary sort directory %s was left behind", entry.Name())
+		}
+	}
+}
+
+func TestScansPairsHardLinksByPath(t *testing.T) {
+	dir := t.TempDir()
+	oldScan := filepath.Join(dir, "old.ndjson")
+	newScan := filepath.Join(dir, "new.ndjson")
+	writeScan(t, oldScan, []testRecord{
+		file(map[string]any{"path": "/srv/link1", "file_id": "dev=1,inode=9", "size": 5}),
+		file(map[string]any{"path": "/srv/link2", "file_id": "dev=1,inode=9", "size": 5}),
+	})
+	writeScan(t, newScan, []testRecord{
+		file(map[string]any{"path": "/srv/link2", "file_id": "dev=1,inode=9", "size": 5}),
+		file(map[string]any{"path": "/srv/link1", "file_id": "dev=1,inode=9", "size": 5}),
+	})
+	var out bytes.Buffer
+	if _, err := Scans(&out, oldScan, newScan, Options{TempDir: dir}); err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected no changes for unchanged hard links, got %s", out.String())
+	}
+}
+
+func TestScansRejectsOtherSchemaVersions(t *testing.T) {
+	dir := t.TempDir()
+	oldScan := filepath.Join(dir, "old.ndjson")
+	if err := os.WriteFile(oldScan, []byte(`{"record_type":"file","schema_version":"1","payload":{"path":"/a"}}`+"\n"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	var out bytes.Buffer
+	if _, err := Scans(&out, oldScan, oldScan, Options{TempDir: dir}); err == nil || !strings.Contains(err.Error(), "schema version") {
+		t.Fatalf("expected a schema version error, got %v", err)
+	}
+}
+
+func TestScansPairsReplacedFilesByPath(t *testing.T) {
+	dir := t.TempDir()
+	oldScan := filepath.Join(dir, "old.ndjson")
+	newScan := filepath.Join(dir, "new.ndjson")
+	writeScan(t, oldScan, []testRecord{
+		file(map[string]any{"path": "/etc/app.conf", "file_id": "dev=1,inode=1", "size": 5, "permissions": "-rw-r--r--"}),
+		file(map[string]any{"path": "/srv/a", "file_id": "dev=1,inode=5", "size": 5}),
+		file(map[string]any{"path": "/srv/b", "file_id": "dev=1,inode=6", "size": 6}),
+		file(map[string]any{"path": "/srv/c", "size": 7}),
+	})
+	writeScan(t, newScan, []testRecord{
+		// An editor wrote the new contents to a temporary file and renamed
+		// it over the old one, so the path has a new inode.
+		file(map[string]any{"path": "/etc/app.conf", "file_id": "dev=1,inode=2", "size": 9, "permissions": "-rw-------"}),
+		// /srv/a was deleted and /srv/b's inode was reused for a new /srv/a.
+		file(map[string]any{"path": "/srv/a", "file_id": "dev=1,inode=6", "size": 5}),
+		file(map[string]any{"path": "/srv/d", "size": 7}),
+	})
+	for _, runBytes := range []int{0, 1} {
+		var out bytes.Buffer
+		if _, err := Scans(&out, oldScan, newScan, Options{TempDir: dir, RunBytes: runBytes}); err != nil {
+			t.Fatalf("diff (run bytes %d): %v", runBytes, err)
+		}
+		changes := readChanges(t, out.Bytes())
+		want := map[string][]string{
+			FileModified: {"/etc/app.conf"},
+			ACLChanged:   {"/etc/app.conf"},
+			FileRemoved:  {"/srv/b", "/srv/c"},
+			FileAdded:    {"/srv/d"},
+		}
+		for recordType, wantPaths := range want {
+			if got := paths(changes[recordType]); !slices.Equal(got, wantPaths) {
+				t.Fatalf("run bytes %d: %s = %v, want %v", runBytes, recordType, got, wantPaths)
+			}
+		}
+		if len(changes) != len(want) {
+			t.Fatalf("run bytes %d: unexpected change types %v", runBytes, changes)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package diff
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultRunBytes is how much file state is sorted in memory before it is
+// spilled to a temporary run file.
+const defaultRunBytes = 64 << 20
+
+// fileState is the part of a file record a diff compares. States are sorted
+// by key, then path, so both scans can be merged in a single pass: first
+// keyed by path, then, for the files left unpaired, by file ID.
+type fileState struct {
+	Key         string              `json:"key"`
+	Path        string              `json:"path"`
+	FileID      string              `json:"file_id,omitempty"`
+	Size        int64               `json:"size,omitempty"`
+	ModTime     string              `json:"mod_time,omitempty"`
+	Permissions string              `json:"permissions,omitempty"`
+	Owner       string              `json:"owner,omitempty"`
+	ACL         string              `json:"acl,omitempty"`
+	Hashes      map[string]string   `json:"hashes,omitempty"`
+	Sensitive   map[string][]string `json:"sensitive_data,omitempty"`
+}
+
+// newFileState decodes a file record payload keyed by path. File IDs are
+// only trusted for files whose path disappeared: editors replace files
+// through a temporary file and a rename, and filesystems reuse inodes.
+func newFileState(payload json.RawMessage) (*fileState, int, error) {
+	var state fileState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return nil, 0, err
+	}
+	state.Key = state.Path
+	return &state, len(payload), nil
+}
+
+func compareStates(a, b *fileState) int {
+	if c := strings.Compare(a.Key, b.Key); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Path, b.Path)
+}
+
+// stateIterator yields file states in sorted order and nil at the end.
+type stateIterator interface {
+	next() (*fileState, error)
+	close() error
+}
+
+// sorter sorts file states that may not fit in memory. States are buffered
+// up to runBytes, then sorted and written to a run file in dir; finish merges
+// the runs.
+type sorter struct {
+	dir      string
+	name     string
+	runBytes int
+	buf      []*fileState
+	bufBytes int
+	runs     []string
+}
+
+func newSorter(dir, name string, runBytes int) *sorter {
+	if runBytes <= 0 {
+		runBytes = defaultRunBytes
+	}
+	return &sorter{dir: dir, name: name, runBytes: runBytes}
+}
+
+func (s *sorter) add(state *fileState, size int) error {
+	s.buf = append(s.buf, state)
+	s.bufBytes += size
+	if s.bufBytes >= s.runBytes {
+		return s.spill()
+	}
+	return nil
+}
+
+func (s *sorter) spill() error {
+	slices.SortFunc(s.buf, compareStates)
+	name := filepath.Join(s.dir, s.name+"-"+strconv.Itoa(len(s.runs)))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(f, 256*1024)
+	enc := json.NewEncoder(w)
+	for _, state := range s.buf {
+		if err := enc.Encode(state); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := errors.Join(w.Flush(), f.Close()); err != nil {
+		return err
+	}
+	s.runs = append(s.runs, name)
+	s.buf = s.buf[:0]
+	s.bufBytes = 0
+	return nil
+}
+
+// finish returns the sorted states. Without spilled runs they never leave
+// memory.
+func (s *sorter) finish() (stateIterator, error) {
+	if len(s.runs) == 0 {
+		slices.SortFunc(s.buf, compareStates)
+		return &sliceIterator{states: s.buf}, nil
+	}
+	if len(s.buf) > 0 {
+		if err := s.spill(); err != nil {
+			return nil, err
+		}
+	}
+	m := &mergeIterator{}
+	for _, name := range s.runs {
+		f, err := os.Open(name)
+		if err != nil {
+			_ = m.close()
+			return nil, err
+		}
+		r := &runReader{file: f, dec: json.NewDecoder(bufio.NewReaderSize(f, 256*1024))}
+		m.readers = append(m.readers, r)
+		if err := r.advance(); err != nil {
+			_ = m.close()
+			return nil, err
+		}
+		if r.head != nil {
+			m.heap = append(m.heap, r)
+		}
+	}
+	heap.Init(&m.heap)
+	return m, nil
+}
+
+type sliceIterator struct {
+	states []*fileState
+}
+
+func (it *sliceIterator) next() (*fileState, error) {
+	if len(it.states) == 0 {
+		return nil, nil
+	}
+	state := it.states[0]
+	it.states = it.states[1:]
+	return state, nil
+}
+
+func (it *sliceIterator) close() error {
+	return nil
+}
+
+// runReader reads one sorted run file.
+type runReader struct {
+	file *os.File
+	dec  *json.Decoder
+	head *fileState
+}
+
+func (r *runReader) advance() error {
+	var state fileState
+	if err := r.dec.Decode(&state); err != nil {
+		r.head = nil
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	r.head = &state
+	return nil
+}
+
+type runHeap []*runReader
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return compareStates(h[i].head, h[j].head) < 0 }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*runReader)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
+
+// mergeIterator merges sorted run files.
+type mergeIterator struct {
+	readers []*runReader
+	heap    runHeap
+}
+
+func (m *mergeIterator) next() (*fileState, error) {
+	if len(m.heap) == 0 {
+		return nil, nil
+	}
+	r := m.heap[0]
+	state := r.head
+	if err := r.advance(); err != nil {
+		return nil, err
+	}
+	if r.head == nil {
+		heap.Pop(&m.heap)
+	} else {
+		heap.Fix(&m.heap, 0)
+	}
+	return state, nil
+}
+
+func (m *mergeIterator) close() error {
+	var err error
+	for _, r := range m.readers {
+		err = errors.Join(err, r.file.Close())
+	}
+	return err
+}
@@ -1,11 +1,39 @@
 package fuzzy
 
-import "strings"
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
 
 // Hasher defines a fuzzy hashing implementation.
 type Hasher interface {
 	Name() string
 	HashFile(path string) (string, error)
+	// New returns a Digest that hashes content written to it in pieces, so
+	// files never need to be held in memory whole.
+	New() Digest
+	// Compare scores two digests made by this hasher. It fails when either
+	// digest is not one of its own.
+	Compare(a, b string) (Score, error)
+}
+
+// Digest is the running state of a fuzzy hash.
+type Digest interface {
+	io.Writer
+	// Sum returns the digest of everything written so far, or "" when the
+	// content is too short or too uniform to hash.
+	Sum() (string, error)
+}
+
+// Score is the result of comparing two digests. TLSH reports a distance,
+// where 0 means identical and larger values mean less alike; the other
+// algorithms report a similarity from 0 to 100, where 100 means identical.
+type Score struct {
+	Value    int
+	Distance bool
 }
 
 var registry = map[string]Hasher{}
@@ -24,11 +52,27 @@ func Lookup(name string) (Hasher, bool) {
 	return hasher, ok
 }
 
-// Available returns the names of registered hashers.
+// Available returns the names of registered hashers in sorted order.
 func Available() []string {
 	names := make([]string, 0, len(registry))
 	for name := range registry {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
+
+// hashFile streams the file at path through a new digest of hasher.
+func hashFile(hasher Hasher, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	digest := hasher.New()
+	if _, err := io.Copy(digest, bufio.NewReader(f)); err != nil {
+		return "", err
+	}
+	return digest.Sum()
+}
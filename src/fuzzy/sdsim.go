@@ -0,0 +1,276 @@
+package fuzzy
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// The similarity digest parameters are those of sdhash: 64 byte features,
+// chosen for being the most distinctive of their neighbourhood, hashed five
+// times into 2048 bit Bloom filters of at most 160 features each.
+const (
+	sdFeatureSize    = 64
+	sdPopularWindow  = 64
+	sdPopularMinWins = 16
+	sdFilterBytes    = 256
+	sdFilterBits     = sdFilterBytes * 8
+	sdFilterMaxElems = 160
+	sdFilterMinElems = 16
+	sdHashCount      = 5
+	// Features scoring outside these bounds, out of 1000, are too uniform
+	// or too close to random to say anything about the content.
+	sdEntropyMin = 100
+	sdEntropyMax = 990
+	// sdEntropyScale is the fixed point scale of the entropy terms, so
+	// scores do not depend on floating point rounding as the window moves.
+	sdEntropyScale = 1 << 20
+	sdDigestPrefix = "sdsim:1:"
+)
+
+// sdEntropyTerms holds -p*log2(p) for a byte seen n times in a feature,
+// where p = n/64.
+var sdEntropyTerms = func() (terms [sdFeatureSize + 1]int64) {
+	for n := 1; n <= sdFeatureSize; n++ {
+		p := float64(n) / sdFeatureSize
+		terms[n] = int64(math.Round(-p * math.Log2(p) * sdEntropyScale))
+	}
+	return terms
+}()
+
+// SDSimHasher computes Bloom filter similarity digests modelled on sdhash.
+// The features are picked by an entropy score of its own rather than the
+// sdhash precedence table and the digests use a format of their own, so
+// they are not sdhash digests: they only compare with other sdsim digests.
+type SDSimHasher struct{}
+
+func (h SDSimHasher) Name() string {
+	return "sdsim"
+}
+
+func (h SDSimHasher) HashFile(path string) (string, error) {
+	return hashFile(h, path)
+}
+
+func (h SDSimHasher) New() Digest {
+	return &sdDigest{}
+}
+
+// Compare scores a and b from 0 to 100: for each filter of the digest with
+// fewer filters, the best match among the filters of the other, averaged.
+func (h SDSimHasher) Compare(a, b string) (Score, error) {
+	fa, err := parseSDSim(a)
+	if err != nil {
+		return Score{}, err
+	}
+	fb, err := parseSDSim(b)
+	if err != nil {
+		return Score{}, err
+	}
+	if len(fa) > len(fb) {
+		fa, fb = fb, fa
+	}
+	var total float64
+	var counted int
+	for i := range fa {
+		if fa[i].elems < sdFilterMinElems && len(fa) > 1 {
+			continue
+		}
+		var best float64
+		for j := range fb {
+			best = max(best, fa[i].similarity(&fb[j]))
+		}
+		total += best
+		counted++
+	}
+	if counted == 0 {
+		return Score{}, nil
+	}
+	return Score{Value: int(math.Round(100 * total / float64(counted)))}, nil
+}
+
+type sdFilter struct {
+	elems int
+	bits  [sdFilterBytes]byte
+}
+
+func (f *sdFilter) setBits() int {
+	n := 0
+	for i := 0; i < sdFilterBytes; i += 8 {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(f.bits[i:]))
+	}
+	return n
+}
+
+// add sets the five bits of a feature digest and reports whether any of
+// them were new. Features whose bits are all set already add nothing.
+func (f *sdFilter) add(sum [sha1.Size]byte) bool {
+	added := false
+	for i := 0; i < sdHashCount; i++ {
+		bit := binary.LittleEndian.Uint32(sum[i*4:]) % sdFilterBits
+		if f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			f.bits[bit/8] |= 1 << (bit % 8)
+			added = true
+		}
+	}
+	if added {
+		f.elems++
+	}
+	return added
+}
+
+// similarity measures the overlap of two filters beyond what filters of
+// random features with the same number of bits set would share.
+func (f *sdFilter) similarity(o *sdFilter) float64 {
+	overlap := 0
+	for i := 0; i < sdFilterBytes; i += 8 {
+		overlap += bits.OnesCount64(binary.LittleEndian.Uint64(f.bits[i:]) & binary.LittleEndian.Uint64(o.bits[i:]))
+	}
+	s1, s2 := float64(f.setBits()), float64(o.setBits())
+	minEst := s1 * s2 / sdFilterBits
+	maxEst := min(s1, s2)
+	cutoff := 0.3*(maxEst-minEst) + minEst
+	if float64(overlap) <= cutoff || maxEst <= cutoff {
+		return 0
+	}
+	return (float64(overlap) - cutoff) / (maxEst - cutoff)
+}
+
+// sdDigest scores each 64 byte feature as it completes, and gives a win to
+// the best scored feature of every run of 64 consecutive features. A
+// feature is selected once it has 16 wins. The last bytes are kept in a
+// ring so selected features can still be hashed.
+type sdDigest struct {
+	n       uint64
+	ring    [256]byte
+	counts  [256]uint8
+	entropy int64
+
+	ranks  [128]int
+	wins   [128]int
+	window []uint64
+
+	filters []sdFilter
+}
+
+func (d *sdDigest) Write(p []byte) (int, error) {
+	for _, c := range p {
+		d.step(c)
+	}
+	return len(p), nil
+}
+
+func (d *sdDigest) step(c byte) {
+	n := d.n
+	d.n++
+	d.ring[n%uint64(len(d.ring))] = c
+	if n >= sdFeatureSize {
+		d.count(d.ring[(n-sdFeatureSize)%uint64(len(d.ring))], -1)
+	}
+	d.count(c, 1)
+	if n < sdFeatureSize-1 {
+		return
+	}
+
+	pos := n - (sdFeatureSize - 1)
+	slot := pos % uint64(len(d.ranks))
+	d.ranks[slot] = d.rank()
+	d.wins[slot] = 0
+	for len(d.window) > 0 && d.ranks[d.window[len(d.window)-1]%uint64(len(d.ranks))] < d.ranks[slot] {
+		d.window = d.window[:len(d.window)-1]
+	}
+	d.window = append(d.window, pos)
+	if pos < sdPopularWindow-1 {
+		return
+	}
+	for d.window[0] < pos-(sdPopularWindow-1) {
+		d.window = d.window[1:]
+	}
+	best := d.window[0]
+	bestSlot := best % uint64(len(d.ranks))
+	if d.ranks[bestSlot] == 0 {
+		return
+	}
+	d.wins[bestSlot]++
+	if d.wins[bestSlot] == sdPopularMinWins {
+		d.addFeature(best)
+	}
+}
+
+func (d *sdDigest) count(c byte, delta int) {
+	d.entropy -= sdEntropyTerms[d.counts[c]]
+	d.counts[c] = uint8(int(d.counts[c]) + delta)
+	d.entropy += sdEntropyTerms[d.counts[c]]
+}
+
+// rank scores the current feature by its entropy, out of 1000 for the six
+// bits a 64 byte feature holds at most, or 0 when it is out of bounds.
+func (d *sdDigest) rank() int {
+	score := int(d.entropy * 1000 / (6 * sdEntropyScale))
+	if score < sdEntropyMin || score > sdEntropyMax {
+		return 0
+	}
+	return score
+}
+
+func (d *sdDigest) addFeature(pos uint64) {
+	var feature [sdFeatureSize]byte
+	for i := range feature {
+		feature[i] = d.ring[(pos+uint64(i))%uint64(len(d.ring))]
+	}
+	sum := sha1.Sum(feature[:])
+	if len(d.filters) == 0 || d.filters[len(d.filters)-1].elems >= sdFilterMaxElems {
+		d.filters = append(d.filters, sdFilter{})
+	}
+	d.filters[len(d.filters)-1].add(sum)
+}
+
+// Sum returns "" when fewer than 16 features were selected, too few for a
+// meaningful comparison.
+func (d *sdDigest) Sum() (string, error) {
+	elems := 0
+	for i := range d.filters {
+		elems += d.filters[i].elems
+	}
+	if elems < sdFilterMinElems {
+		return "", nil
+	}
+	raw := make([]byte, 0, len(d.filters)*(1+sdFilterBytes))
+	for i := range d.filters {
+		raw = append(raw, byte(d.filters[i].elems))
+		raw = append(raw, d.filters[i].bits[:]...)
+	}
+	return sdDigestPrefix + strconv.Itoa(len(d.filters)) + ":" + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+func parseSDSim(digest string) ([]sdFilter, error) {
+	rest, ok := strings.CutPrefix(digest, sdDigestPrefix)
+	count, encoded, found := strings.Cut(rest, ":")
+	if !ok || !found {
+		return nil, fmt.Errorf("not an sdsim digest: %q", digest)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("not an sdsim digest: %q", digest)
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) != n*(1+sdFilterBytes) {
+		return nil, fmt.Errorf("not an sdsim digest: %q", digest)
+	}
+	filters := make([]sdFilter, n)
+	for i := range filters {
+		chunk := raw[i*(1+sdFilterBytes):]
+		filters[i].elems = int(chunk[0])
+		copy(filters[i].bits[:], chunk[1:])
+	}
+	return filters, nil
+}
+
+func init() {
+	Register(SDSimHasher{})
+}
@@ -0,0 +1,66 @@
+package fuzzy
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func sdsimOf(t *testing.T, content []byte) string {
+	t.Helper()
+	digest := SDSimHasher{}.New()
+	for len(content) > 0 {
+		n := min(len(content), 4096)
+		digest.Write(content[:n])
+		content = content[n:]
+	}
+	sum, err := digest.Sum()
+	if err != nil {
+		t.Fatalf("sum: %v", err)
+	}
+	return sum
+}
+
+func TestSDSimCompare(t *testing.T) {
+	source := rand.New(rand.NewSource(7))
+	base := make([]byte, 200*1024)
+	source.Read(base)
+	edited := append([]byte(nil), base...)
+	source.Read(edited[50*1024 : 70*1024])
+	other := make([]byte, len(base))
+	source.Read(other)
+
+	digest := sdsimOf(t, base)
+	if !strings.HasPrefix(digest, "sdsim:1:") {
+		t.Fatalf("unexpected digest %.20s", digest)
+	}
+	score := func(content []byte) int {
+		t.Helper()
+		s, err := SDSimHasher{}.Compare(digest, sdsimOf(t, content))
+		if err != nil || s.Distance {
+			t.Fatalf("compare: %+v, %v", s, err)
+		}
+		return s.Value
+	}
+	if got := score(base); got != 100 {
+		t.Fatalf("expected identical content to score 100, got %d", got)
+	}
+	if got := score(edited); got < 50 || got == 100 {
+		t.Fatalf("expected an edited copy to score high but below 100, got %d", got)
+	}
+	if got := score(base[:len(base)/2]); got < 90 {
+		t.Fatalf("expected content contained in the other to score high, got %d", got)
+	}
+	if got := score(other); got > 10 {
+		t.Fatalf("expected unrelated content to score low, got %d", got)
+	}
+}
+
+func TestSDSimSkipsUniformContent(t *testing.T) {
+	if got := sdsimOf(t, []byte(strings.Repeat("a", 64*1024))); got != "" {
+		t.Fatalf("expected no digest for uniform content, got %.20s", got)
+	}
+	if _, err := (SDSimHasher{}).Compare("sdsim:1:1:AAAA", "3::"); err == nil {
+		t.Fatal("expected malformed digests to be rejected")
+	}
+}
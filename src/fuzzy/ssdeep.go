@@ -0,0 +1,332 @@
+package fuzzy
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The ssdeep constants, as in the reference fuzzy.c.
+const (
+	ssdeepRollingWindow = 7
+	ssdeepMinBlockSize  = 3
+	ssdeepSpamSumLength = 64
+	ssdeepBlockHashes   = 31
+	ssdeepHashPrime     = 0x01000193
+	ssdeepHashInit      = 0x28021967
+	// ssdeepMaxInput is the largest input the largest block size covers.
+	ssdeepMaxInput = uint64(ssdeepMinBlockSize) << (ssdeepBlockHashes - 1) * ssdeepSpamSumLength
+)
+
+const ssdeepAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// SSDeepHasher computes context triggered piecewise hashes compatible with
+// the ssdeep tool, in the form "blocksize:hash:hash".
+type SSDeepHasher struct{}
+
+func (h SSDeepHasher) Name() string {
+	return "ssdeep"
+}
+
+func (h SSDeepHasher) HashFile(path string) (string, error) {
+	return hashFile(h, path)
+}
+
+func (h SSDeepHasher) New() Digest {
+	d := &ssdeepDigest{bhEnd: 1}
+	d.bh[0].h = ssdeepHashInit
+	d.bh[0].halfh = ssdeepHashInit
+	return d
+}
+
+// Compare scores a and b from 0 to 100 as ssdeep does. Digests whose block
+// sizes are neither equal nor a factor of two apart score 0.
+func (h SSDeepHasher) Compare(a, b string) (Score, error) {
+	da, err := parseSSDeep(a)
+	if err != nil {
+		return Score{}, err
+	}
+	db, err := parseSSDeep(b)
+	if err != nil {
+		return Score{}, err
+	}
+	return Score{Value: da.compare(db)}, nil
+}
+
+// ssdeepRoll is the rolling hash over the last seven bytes that decides
+// where a piece ends.
+type ssdeepRoll struct {
+	window     [ssdeepRollingWindow]byte
+	h1, h2, h3 uint32
+	n          uint32
+}
+
+func (r *ssdeepRoll) add(c byte) {
+	r.h2 -= r.h1
+	r.h2 += ssdeepRollingWindow * uint32(c)
+	r.h1 += uint32(c)
+	r.h1 -= uint32(r.window[r.n%ssdeepRollingWindow])
+	r.window[r.n%ssdeepRollingWindow] = c
+	r.n++
+	r.h3 <<= 5
+	r.h3 ^= uint32(c)
+}
+
+func (r *ssdeepRoll) sum() uint32 {
+	return r.h1 + r.h2 + r.h3
+}
+
+// ssdeepBlockHash is the digest being built for one block size. halfh and
+// halfdigest track the hash of the pieces past the first 32, which end up
+// folded into the last character of a truncated digest.
+type ssdeepBlockHash struct {
+	h, halfh   uint32
+	digest     [ssdeepSpamSumLength]byte
+	halfdigest byte
+	dlen       int
+}
+
+// ssdeepDigest hashes the input at every block size that may still be
+// chosen. A block size is only added once the previous one has ended its
+// first piece, and dropped once the next one holds enough pieces and the
+// input has outgrown it.
+type ssdeepDigest struct {
+	total          uint64
+	bhStart, bhEnd int
+	bh             [ssdeepBlockHashes]ssdeepBlockHash
+	roll           ssdeepRoll
+}
+
+func ssdeepBlockSize(index int) uint64 {
+	return uint64(ssdeepMinBlockSize) << index
+}
+
+func (d *ssdeepDigest) Write(p []byte) (int, error) {
+	d.total += uint64(len(p))
+	for _, c := range p {
+		d.step(c)
+	}
+	return len(p), nil
+}
+
+func (d *ssdeepDigest) step(c byte) {
+	d.roll.add(c)
+	h := uint64(d.roll.sum())
+	for i := d.bhStart; i < d.bhEnd; i++ {
+		d.bh[i].h = (d.bh[i].h * ssdeepHashPrime) ^ uint32(c)
+		d.bh[i].halfh = (d.bh[i].halfh * ssdeepHashPrime) ^ uint32(c)
+	}
+	for i := d.bhStart; i < d.bhEnd; i++ {
+		// A trigger for a block size is also one for every smaller size.
+		bs := ssdeepBlockSize(i)
+		if h%bs != bs-1 {
+			break
+		}
+		bh := &d.bh[i]
+		if bh.dlen == 0 {
+			d.fork()
+		}
+		bh.digest[bh.dlen] = ssdeepAlphabet[bh.h%64]
+		bh.halfdigest = ssdeepAlphabet[bh.halfh%64]
+		if bh.dlen < ssdeepSpamSumLength-1 {
+			// Once the digest is full the hash is no longer reset, so the
+			// last character covers all remaining pieces.
+			bh.dlen++
+			bh.digest[bh.dlen] = 0
+			bh.h = ssdeepHashInit
+			if bh.dlen < ssdeepSpamSumLength/2 {
+				bh.halfh = ssdeepHashInit
+				bh.halfdigest = 0
+			}
+		} else {
+			d.reduce()
+		}
+	}
+}
+
+func (d *ssdeepDigest) fork() {
+	if d.bhEnd >= ssdeepBlockHashes {
+		return
+	}
+	prev := &d.bh[d.bhEnd-1]
+	d.bh[d.bhEnd] = ssdeepBlockHash{h: prev.h, halfh: prev.halfh}
+	d.bhEnd++
+}
+
+func (d *ssdeepDigest) reduce() {
+	if d.bhEnd-d.bhStart < 2 {
+		return
+	}
+	if ssdeepBlockSize(d.bhStart)*ssdeepSpamSumLength >= d.total {
+		return
+	}
+	if d.bh[d.bhStart+1].dlen < ssdeepSpamSumLength/2 {
+		return
+	}
+	d.bhStart++
+}
+
+// Sum picks the smallest block size that would fit the input in 64 pieces,
+// then halves it while the digest holds fewer than 32, and writes that
+// digest followed by the one for twice the block size, cut to 32
+// characters.
+func (d *ssdeepDigest) Sum() (string, error) {
+	if d.total > ssdeepMaxInput {
+		return "", errors.New("ssdeep: input too large")
+	}
+	bi := d.bhStart
+	for ssdeepBlockSize(bi)*ssdeepSpamSumLength < d.total {
+		bi++
+	}
+	for bi >= d.bhEnd {
+		bi--
+	}
+	for bi > d.bhStart && d.bh[bi].dlen < ssdeepSpamSumLength/2 {
+		bi--
+	}
+	rolling := d.roll.sum() != 0
+
+	var b strings.Builder
+	b.WriteString(strconv.FormatUint(ssdeepBlockSize(bi), 10))
+	b.WriteByte(':')
+	bh := &d.bh[bi]
+	b.Write(bh.digest[:bh.dlen])
+	if rolling {
+		b.WriteByte(ssdeepAlphabet[bh.h%64])
+	} else if bh.dlen < ssdeepSpamSumLength && bh.digest[bh.dlen] != 0 {
+		b.WriteByte(bh.digest[bh.dlen])
+	}
+	b.WriteByte(':')
+	if bi < d.bhEnd-1 {
+		bh = &d.bh[bi+1]
+		b.Write(bh.digest[:min(bh.dlen, ssdeepSpamSumLength/2-1)])
+		if rolling {
+			b.WriteByte(ssdeepAlphabet[bh.halfh%64])
+		} else if bh.halfdigest != 0 {
+			b.WriteByte(bh.halfdigest)
+		}
+	} else if rolling {
+		b.WriteByte(ssdeepAlphabet[bh.h%64])
+	}
+	return b.String(), nil
+}
+
+type ssdeepHash struct {
+	blockSize    uint64
+	part1, part2 string
+}
+
+// parseSSDeep reads "blocksize:hash:hash", ignoring the ",filename" suffix
+// ssdeep prints.
+func parseSSDeep(digest string) (ssdeepHash, error) {
+	fields := strings.SplitN(digest, ":", 3)
+	if len(fields) != 3 {
+		return ssdeepHash{}, fmt.Errorf("not an ssdeep digest: %q", digest)
+	}
+	blockSize, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil || blockSize < ssdeepMinBlockSize {
+		return ssdeepHash{}, fmt.Errorf("not an ssdeep digest: %q", digest)
+	}
+	part2, _, _ := strings.Cut(fields[2], ",")
+	h := ssdeepHash{blockSize: blockSize, part1: fields[1], part2: part2}
+	for _, part := range []string{h.part1, h.part2} {
+		if len(part) > ssdeepSpamSumLength || strings.Trim(part, ssdeepAlphabet) != "" {
+			return ssdeepHash{}, fmt.Errorf("not an ssdeep digest: %q", digest)
+		}
+	}
+	h.part1 = eliminateSequences(h.part1)
+	h.part2 = eliminateSequences(h.part2)
+	return h, nil
+}
+
+// eliminateSequences cuts runs of a character down to three, which keeps
+// long runs of uniform content from dominating the score.
+func eliminateSequences(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if i >= 3 && s[i] == s[i-1] && s[i] == s[i-2] && s[i] == s[i-3] {
+			continue
+		}
+		out = append(out, s[i])
+	}
+	return string(out)
+}
+
+func (a ssdeepHash) compare(b ssdeepHash) int {
+	switch {
+	case a.blockSize == b.blockSize:
+		if a.part1 == b.part1 && a.part2 == b.part2 {
+			return 100
+		}
+		return max(scoreSSDeep(a.part1, b.part1, a.blockSize), scoreSSDeep(a.part2, b.part2, a.blockSize*2))
+	case a.blockSize*2 == b.blockSize:
+		return scoreSSDeep(a.part2, b.part1, b.blockSize)
+	case b.blockSize*2 == a.blockSize:
+		return scoreSSDeep(a.part1, b.part2, a.blockSize)
+	}
+	return 0
+}
+
+// scoreSSDeep turns the weighted edit distance between two hashes of the
+// same block size into a score. Hashes without a common run of seven
+// characters score 0, and small block sizes cannot score more than the
+// content they cover warrants.
+func scoreSSDeep(s1, s2 string, blockSize uint64) int {
+	if !hasCommonSubstring(s1, s2) {
+		return 0
+	}
+	score := uint64(editDistance(s1, s2))
+	score = score * ssdeepSpamSumLength / uint64(len(s1)+len(s2))
+	score = 100 * score / ssdeepSpamSumLength
+	if score >= 100 {
+		return 0
+	}
+	score = 100 - score
+	if blockSize >= (99+ssdeepRollingWindow)/ssdeepRollingWindow*ssdeepMinBlockSize {
+		return int(score)
+	}
+	return int(min(score, blockSize/ssdeepMinBlockSize*uint64(min(len(s1), len(s2)))))
+}
+
+func hasCommonSubstring(s1, s2 string) bool {
+	if len(s1) < ssdeepRollingWindow || len(s2) < ssdeepRollingWindow {
+		return false
+	}
+	windows := make(map[string]struct{}, len(s1))
+	for i := 0; i+ssdeepRollingWindow <= len(s1); i++ {
+		windows[s1[i:i+ssdeepRollingWindow]] = struct{}{}
+	}
+	for i := 0; i+ssdeepRollingWindow <= len(s2); i++ {
+		if _, ok := windows[s2[i:i+ssdeepRollingWindow]]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance is the Levenshtein distance with substitutions costing two,
+// as a delete and an insert.
+func editDistance(s1, s2 string) int {
+	prev := make([]int, len(s2)+1)
+	cur := make([]int, len(s2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s1); i++ {
+		cur[0] = i
+		for j := 1; j <= len(s2); j++ {
+			substitute := prev[j-1]
+			if s1[i-1] != s2[j-1] {
+				substitute += 2
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, substitute)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(s2)]
+}
+
+func init() {
+	Register(SSDeepHasher{})
+}
@@ -0,0 +1,80 @@
+package fuzzy
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSSDeepMatchesReferenceDigests(t *testing.T) {
+	// The digests are those ssdeep gives for the first bytes math/rand
+	// yields with seed 1.
+	source := rand.New(rand.NewSource(1))
+	for _, tc := range []struct {
+		size int
+		want string
+	}{
+		{4097, "96:yNDH/iNQaSXRLmOSxu1aQP4iWgC8JbkiA5Ix:yNLaNQhSxEgVYkiA5Ix"},
+		{45056, "768:mlHmRZnCRFRwSuK/UiwY37TMbsDEsb1Jqi6dcXoWpKXIUxpQDOAvWpPK:mqhCJwjmJD31DzbDwd+oGo9AvOi"},
+	} {
+		content := make([]byte, tc.size)
+		source.Read(content)
+		digest := SSDeepHasher{}.New()
+		// Odd write sizes must not change the digest.
+		for len(content) > 0 {
+			n := min(len(content), 1000+len(content)%777)
+			digest.Write(content[:n])
+			content = content[n:]
+		}
+		got, err := digest.Sum()
+		if err != nil || got != tc.want {
+			t.Fatalf("size %d: got %q, %v, want %q", tc.size, got, err, tc.want)
+		}
+	}
+
+	digest := SSDeepHasher{}.New()
+	if got, _ := digest.Sum(); got != "3::" {
+		t.Fatalf("unexpected digest of no content %q", got)
+	}
+}
+
+func TestSSDeepCompare(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{
+			"192:MUPMinqP6+wNQ7Q40L/iB3n2rIBrP0GZKF4jsef+0FVQLSwbLbj41iH8nFVYv980:x0CllivQiFmt",
+			"192:JkjRcePWsNVQza3ntZStn5VfsoXMhRD9+xJMinqF6+wNQ7Q40L/i737rPVt:JkjlQyIrx+kll2",
+			35,
+		},
+		{
+			"196608:pDSC8olnoL1v/uawvbQD7XlZUFYzYyMb615NktYHF7dREN/JNnQrmhnUPI+/n2Yr:5DHoJXv7XOq7Mb2TwYHXREN/3QrmktPd",
+			"196608:7DSC8olnoL1v/uawvbQD7XlZUFYzYyMb615NktYHF7dREN/JNnQrmhnUPI+/n2Y7:3DHoJXv7XOq7Mb2TwYHXREN/3QrmktPt",
+			97,
+		},
+		{
+			"24:YDVLfsT1ds/1H9Wpgq7n4XMijV6h4Z3QCw4qat:YD51H9CiMuV6uACwVat",
+			"24:YDVLfyvDj+C+opg8DV0Mdle6hPZ3QCw4qat:YDMvDj+C+kBOM+6HACwVat,\"sample.bin\"",
+			54,
+		},
+		{
+			"24:YDVLfsT1ds/1H9Wpgq7n4XMijV6h4Z3QCw4qat:YD51H9CiMuV6uACwVat",
+			"24:YDVLfsT1ds/1H9Wpgq7n4XMijV6h4Z3QCw4qat:YD51H9CiMuV6uACwVat",
+			100,
+		},
+		{
+			"24:YDVLfsT1ds/1H9Wpgq7n4XMijV6h4Z3QCw4qat:YD51H9CiMuV6uACwVat",
+			"96:yNDH/iNQaSXRLmOSxu1aQP4iWgC8JbkiA5Ix:yNLaNQhSxEgVYkiA5Ix",
+			0,
+		},
+	} {
+		score, err := SSDeepHasher{}.Compare(tc.a, tc.b)
+		if err != nil || score.Value != tc.want || score.Distance {
+			t.Fatalf("compare %s %s: got %+v, %v, want %d", tc.a, tc.b, score, err, tc.want)
+		}
+	}
+
+	if _, err := (SSDeepHasher{}).Compare("192:asdasd", "3::"); err == nil {
+		t.Fatal("expected a digest without two hashes to be rejected")
+	}
+}
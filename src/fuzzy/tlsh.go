@@ -2,6 +2,7 @@ package fuzzy
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 
 	"github.com/glaslos/tlsh"
@@ -39,6 +40,43 @@ func (h TLSHHasher) HashBytes(content []byte) (string, error) {
 	return hash.String(), nil
 }
 
+func (h TLSHHasher) New() Digest {
+	return tlshDigest{hash: tlsh.New()}
+}
+
+// Compare returns the TLSH distance between a and b, counting the
+// difference in content length.
+func (h TLSHHasher) Compare(a, b string) (Score, error) {
+	da, ok := ParseTLSHDigest(a)
+	if !ok {
+		return Score{}, fmt.Errorf("not a TLSH digest: %q", a)
+	}
+	db, ok := ParseTLSHDigest(b)
+	if !ok {
+		return Score{}, fmt.Errorf("not a TLSH digest: %q", b)
+	}
+	return Score{Value: da.Distance(&db), Distance: true}, nil
+}
+
+type tlshDigest struct {
+	hash *tlsh.TLSH
+}
+
+func (d tlshDigest) Write(p []byte) (int, error) {
+	return d.hash.Write(p)
+}
+
+// Sum returns "" for content under 50 bytes or with too few distinct
+// byte triplets, for which TLSH yields an all-zero hash.
+func (d tlshDigest) Sum() (string, error) {
+	for _, b := range d.hash.Sum(nil) {
+		if b != 0 {
+			return d.hash.String(), nil
+		}
+	}
+	return "", nil
+}
+
 func init() {
 	Register(TLSHHasher{})
 }
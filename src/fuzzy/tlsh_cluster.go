@@ -0,0 +1,274 @@
+package fuzzy
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/hex"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+// TLSHDigest is a TLSH digest reduced to what its distance needs. The TLSH
+// library's type also carries the hashing state, about 2 KiB per digest,
+// which does not scale to millions of files.
+type TLSHDigest struct {
+	checksum, lValue, q1, q2 byte
+	body                     [32]byte
+}
+
+// tlshHexLen is the length of a hex TLSH digest: a checksum, length and
+// quartile byte followed by the 32 byte body.
+const tlshHexLen = 70
+
+// ParseTLSHDigest parses the hex digests written to fuzzy_hashes.
+func ParseTLSHDigest(s string) (TLSHDigest, bool) {
+	var d TLSHDigest
+	if len(s) != tlshHexLen {
+		return d, false
+	}
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return d, false
+	}
+	d.checksum = swapNibbles(raw[0])
+	d.lValue = swapNibbles(raw[1])
+	d.q1 = raw[2] >> 4
+	d.q2 = raw[2] & 0x0f
+	copy(d.body[:], raw[3:])
+	return d, true
+}
+
+func swapNibbles(b byte) byte {
+	return b<<4 | b>>4
+}
+
+// tlshPairDiff holds the body distance between two digest bytes: the sum
+// over their four 2-bit buckets of the bucket difference, with a difference
+// of 3 counting 6.
+var tlshPairDiff = func() (table [256][256]uint8) {
+	for x := range 256 {
+		for y := range 256 {
+			for shift := 0; shift < 8; shift += 2 {
+				a, b := x>>shift&3, y>>shift&3
+				d := uint8(max(a-b, b-a))
+				if d == 3 {
+					d = 6
+				}
+				table[x][y] += d
+			}
+		}
+	}
+	return table
+}()
+
+// Distance is the TLSH distance between two digests, including the length
+// difference, as computed by the reference implementation.
+func (a *TLSHDigest) Distance(b *TLSHDigest) int {
+	diff := circularDiff(int(a.lValue), int(b.lValue), 256)
+	if diff > 1 {
+		diff *= 12
+	}
+	for _, q := range [2]int{circularDiff(int(a.q1), int(b.q1), 16), circularDiff(int(a.q2), int(b.q2), 16)} {
+		if q <= 1 {
+			diff += q
+		} else {
+			diff += (q - 1) * 12
+		}
+	}
+	if a.checksum != b.checksum {
+		diff++
+	}
+	for i := range a.body {
+		diff += int(tlshPairDiff[a.body[i]][b.body[i]])
+	}
+	return diff
+}
+
+func circularDiff(x, y, size int) int {
+	d := max(x-y, y-x)
+	return min(d, size-d)
+}
+
+func compareTLSHDigests(a, b TLSHDigest) int {
+	if c := bytes.Compare(a.body[:], b.body[:]); c != 0 {
+		return c
+	}
+	return bytes.Compare(
+		[]byte{a.checksum, a.lValue, a.q1, a.q2},
+		[]byte{b.checksum, b.lValue, b.q1, b.q2},
+	)
+}
+
+// The body of a TLSH digest is 128 2-bit buckets. Digests within the usual
+// thresholds differ in at most a few dozen of them, while unrelated digests
+// agree on about a quarter, so digests are bucketed by a few sampled
+// positions at a time (locality-sensitive hashing): close digests share a
+// bucket in at least one band with high probability, and only digests that
+// do are compared. TLSH bodies look uniformly random to an index, so exact
+// search structures such as vantage-point trees degrade to comparing every
+// pair at these thresholds.
+const (
+	tlshBands     = 32
+	tlshBandWidth = 10
+	// tlshBucketPairs is the largest bucket whose digests are all compared
+	// pairwise. In larger buckets, which hold many near-identical files,
+	// each digest is compared with at most tlshBucketReps representatives,
+	// one per cluster found there, so a bucket of k digests costs at most
+	// k*tlshBucketReps distances rather than k*k.
+	tlshBucketPairs = 64
+	tlshBucketReps  = 32
+)
+
+// tlshBandPositions are the body buckets each band samples, drawn once from a
+// fixed seed so clusters are the same from run to run.
+var tlshBandPositions = func() (bands [tlshBands][tlshBandWidth]uint8) {
+	rnd := rand.New(rand.NewPCG(0x746c7368, 0x62616e64))
+	for i := range bands {
+		for j, position := range rnd.Perm(128)[:tlshBandWidth] {
+			bands[i][j] = uint8(position)
+		}
+	}
+	return bands
+}()
+
+func (d *TLSHDigest) bandKey(band int) uint32 {
+	var key uint32
+	for _, position := range tlshBandPositions[band] {
+		key = key<<2 | uint32(d.body[position/4]>>(position%4*2)&3)
+	}
+	return key
+}
+
+// tlshCluster is a set of digests linked by distances of at most the
+// threshold, with the largest distance among the links that joined it.
+type tlshCluster struct {
+	members     []int32
+	maxDistance int
+}
+
+type tlshBandEntry struct {
+	key   uint32
+	index int32
+}
+
+// clusterTLSH links digests at most threshold apart and returns every
+// group, single digests included. Pairs are found through the LSH bands, so
+// a pair close to the threshold is occasionally missed; it usually still
+// joins its cluster through another member. Buckets larger than
+// tlshBucketPairs are compared through representatives.
+func clusterTLSH(digests []TLSHDigest, threshold int) []tlshCluster {
+	parent := make([]int32, len(digests))
+	for i := range parent {
+		parent[i] = int32(i)
+	}
+	find := func(i int32) int32 {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	maxDistance := make(map[int32]int)
+	link := func(i, j int32) {
+		a, b := find(i), find(j)
+		if a == b {
+			return
+		}
+		distance := digests[i].Distance(&digests[j])
+		if distance > threshold {
+			return
+		}
+		parent[b] = a
+		maxDistance[a] = max(maxDistance[a], maxDistance[b], distance)
+		delete(maxDistance, b)
+	}
+	entries := make([]tlshBandEntry, len(digests))
+	var reps []int32
+	for band := range tlshBands {
+		for i := range digests {
+			entries[i] = tlshBandEntry{key: digests[i].bandKey(band), index: int32(i)}
+		}
+		slices.SortFunc(entries, func(a, b tlshBandEntry) int {
+			if a.key != b.key {
+				return cmp.Compare(a.key, b.key)
+			}
+			return cmp.Compare(a.index, b.index)
+		})
+		for start := 0; start < len(entries); {
+			end := start + 1
+			for end < len(entries) && entries[end].key == entries[start].key {
+				end++
+			}
+			bucket := entries[start:end]
+			start = end
+			if len(bucket) <= tlshBucketPairs {
+				for i := range bucket {
+					for j := i + 1; j < len(bucket); j++ {
+						link(bucket[i].index, bucket[j].index)
+					}
+				}
+				continue
+			}
+			reps = reps[:0]
+			for _, entry := range bucket {
+				for _, rep := range reps {
+					link(rep, entry.index)
+				}
+				if len(reps) < tlshBucketReps && !slices.ContainsFunc(reps, func(rep int32) bool {
+					return find(rep) == find(entry.index)
+				}) {
+					reps = append(reps, entry.index)
+				}
+			}
+		}
+	}
+	groups := make(map[int32][]int32)
+	for i := range digests {
+		root := find(int32(i))
+		groups[root] = append(groups[root], int32(i))
+	}
+	clusters := make([]tlshCluster, 0, len(groups))
+	for root, members := range groups {
+		clusters = append(clusters, tlshCluster{members: members, maxDistance: maxDistance[root]})
+	}
+	return clusters
+}
+
+// TLSHCluster lists paths whose TLSH digests are linked by distances of at
+// most the threshold, with the largest distance among those links.
+type TLSHCluster struct {
+	Paths       []string
+	MaxDistance int
+}
+
+// ClusterTLSHPaths clusters the paths of files by their TLSH digests and
+// returns the clusters of two or more paths, largest first. Paths sharing a
+// digest are clustered once, and the digests are sorted first so the
+// clusters are the same from run to run.
+func ClusterTLSHPaths(paths map[TLSHDigest][]string, threshold int) []TLSHCluster {
+	digests := make([]TLSHDigest, 0, len(paths))
+	for digest := range paths {
+		digests = append(digests, digest)
+	}
+	slices.SortFunc(digests, compareTLSHDigests)
+	var clusters []TLSHCluster
+	for _, c := range clusterTLSH(digests, threshold) {
+		var members []string
+		for _, member := range c.members {
+			members = append(members, paths[digests[member]]...)
+		}
+		if len(members) < 2 {
+			continue
+		}
+		slices.Sort(members)
+		clusters = append(clusters, TLSHCluster{Paths: members, MaxDistance: c.maxDistance})
+	}
+	slices.SortFunc(clusters, func(a, b TLSHCluster) int {
+		if len(a.Paths) != len(b.Paths) {
+			return cmp.Compare(len(b.Paths), len(a.Paths))
+		}
+		return strings.Compare(a.Paths[0], b.Paths[0])
+	})
+	return clusters
+}
@@ -0,0 +1,191 @@
+package fuzzy
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+
+	"github.com/glaslos/tlsh"
+)
+
+// sampleText returns deterministic prose-like content for TLSH.
+func sampleText(seed uint64, words int) string {
+	rnd := rand.New(rand.NewPCG(seed, seed))
+	vocabulary := strings.Fields("alpha bravo charlie delta echo foxtrot golf hotel india juliet kilo lima mike november oscar papa quebec romeo sierra tango uniform victor whiskey xray yankee zulu")
+	var b strings.Builder
+	for i := range words {
+		b.WriteString(vocabulary[rnd.IntN(len(vocabulary))])
+		if i%12 == 11 {
+			b.WriteString(".\n")
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// mutate replaces every nth word of text.
+func mutate(text string, n int, word string) string {
+	words := strings.Split(text, " ")
+	for i := n - 1; i < len(words); i += n {
+		words[i] = word
+	}
+	return strings.Join(words, " ")
+}
+
+func TestTLSHDigestDistanceMatchesLibrary(t *testing.T) {
+	var parsed []*tlsh.TLSH
+	var digests []TLSHDigest
+	for seed := range uint64(8) {
+		for _, text := range []string{sampleText(seed, 200), mutate(sampleText(seed, 200), 7, "zebra"), sampleText(seed, 2000)} {
+			hash, err := tlsh.HashBytes([]byte(text))
+			if err != nil {
+				t.Fatalf("tlsh: %v", err)
+			}
+			lib, err := tlsh.ParseStringToTlsh(hash.String())
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			digest, ok := ParseTLSHDigest(hash.String())
+			if !ok {
+				t.Fatalf("failed to parse %s", hash.String())
+			}
+			parsed = append(parsed, lib)
+			digests = append(digests, digest)
+		}
+	}
+	for i := range digests {
+		for j := range digests {
+			if got, want := digests[i].Distance(&digests[j]), parsed[i].Diff(parsed[j]); got != want {
+				t.Fatalf("distance(%d, %d) = %d, library says %d", i, j, got, want)
+			}
+		}
+	}
+	if _, ok := ParseTLSHDigest("T1AB"); ok {
+		t.Fatal("expected a short digest to be rejected")
+	}
+}
+
+func TestClusterTLSHFindsClosePairs(t *testing.T) {
+	var digests []TLSHDigest
+	for family := range uint64(40) {
+		base := sampleText(family, 300)
+		for variant := range 5 {
+			text := base
+			if variant > 0 {
+				text = mutate(base, 40-variant*5, fmt.Sprintf("w%d", variant))
+			}
+			hash, err := tlsh.HashBytes([]byte(text))
+			if err != nil {
+				t.Fatalf("tlsh: %v", err)
+			}
+			digest, _ := ParseTLSHDigest(hash.String())
+			digests = append(digests, digest)
+		}
+	}
+	const threshold = 40
+	// Brute-force union-find over every pair.
+	parent := make([]int, len(digests))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range digests {
+		for j := i + 1; j < len(digests); j++ {
+			if digests[i].Distance(&digests[j]) <= threshold {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	clusterOf := make([]int, len(digests))
+	linked := 0
+	for n, c := range clusterTLSH(digests, threshold) {
+		root := find(int(c.members[0]))
+		for _, m := range c.members {
+			clusterOf[m] = n
+			if find(int(m)) != root {
+				t.Fatalf("digest %d was clustered with %d although no chain of close pairs links them", m, c.members[0])
+			}
+		}
+		if len(c.members) > 1 {
+			linked++
+			if c.maxDistance > threshold {
+				t.Fatalf("unexpected max distance %d", c.maxDistance)
+			}
+		}
+	}
+	if linked == 0 {
+		t.Fatal("expected some digests to be clustered")
+	}
+	closePairs := 0
+	for i := range digests {
+		for j := i + 1; j < len(digests); j++ {
+			if digests[i].Distance(&digests[j]) > threshold/2 {
+				continue
+			}
+			closePairs++
+			if clusterOf[i] != clusterOf[j] {
+				t.Fatalf("digests %d and %d are %d apart but were not clustered", i, j, digests[i].Distance(&digests[j]))
+			}
+		}
+	}
+	if closePairs == 0 {
+		t.Fatal("expected the sample to contain close pairs")
+	}
+}
+
+func TestClusterTLSHBoundsBucketComparisons(t *testing.T) {
+	// Every digest shares a body, and so a bucket in every band; only the
+	// length byte sets apart two pairs and a thousand copies.
+	digests := []TLSHDigest{{lValue: 0}, {lValue: 1}, {lValue: 100}, {lValue: 101}}
+	for range 1000 {
+		digests = append(digests, TLSHDigest{lValue: 50})
+	}
+	clusters := clusterTLSH(digests, 30)
+	sizes := make(map[int]int)
+	for _, c := range clusters {
+		sizes[len(c.members)]++
+	}
+	if len(clusters) != 3 || sizes[2] != 2 || sizes[1000] != 1 {
+		t.Fatalf("expected two pairs and the copies together, got sizes %v", sizes)
+	}
+}
+
+func TestClusterTLSHPathsGroupsSharedDigests(t *testing.T) {
+	text := sampleText(3, 400)
+	original, err := tlsh.HashBytes([]byte(text))
+	if err != nil {
+		t.Fatalf("tlsh: %v", err)
+	}
+	edited, err := tlsh.HashBytes([]byte(mutate(text, 50, "zebra")))
+	if err != nil {
+		t.Fatalf("tlsh: %v", err)
+	}
+	unrelated, err := tlsh.HashBytes([]byte(sampleText(99, 400)))
+	if err != nil {
+		t.Fatalf("tlsh: %v", err)
+	}
+	paths := make(map[TLSHDigest][]string)
+	for path, hash := range map[string]*tlsh.TLSH{"/b": original, "/a": original, "/c": edited, "/d": unrelated} {
+		digest, ok := ParseTLSHDigest(hash.String())
+		if !ok {
+			t.Fatalf("failed to parse %s", hash.String())
+		}
+		paths[digest] = append(paths[digest], path)
+	}
+	clusters := ClusterTLSHPaths(paths, 30)
+	if len(clusters) != 1 || strings.Join(clusters[0].Paths, ",") != "/a,/b,/c" {
+		t.Fatalf("unexpected clusters %+v", clusters)
+	}
+	if want := original.Diff(edited); clusters[0].MaxDistance != want {
+		t.Fatalf("max distance %d, want %d", clusters[0].MaxDistance, want)
+	}
+}
@@ -0,0 +1,351 @@
+// Package hashset loads reference hash sets, such as the NSRL RDS or a list
+// of indicator hashes, into compact membership sets that file digests can be
+// checked against.
+package hashset
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/FastFilter/xorfilter"
+	"github.com/cespare/xxhash/v2"
+	_ "modernc.org/sqlite"
+)
+
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// Set holds the digests of one hash set. A binary fuse filter answers most
+// lookups for files outside the set; the sorted digest keys confirm the rest,
+// so a file is only reported as a member when its digest is in the set. Each
+// digest costs about nine bytes, whatever its algorithm.
+type Set struct {
+	Name       string
+	algorithms []string
+	filter     *xorfilter.BinaryFuse8
+	keys       []uint64
+}
+
+// Load reads the hash set at path. The format is detected from the content:
+//
+//   - NSRL RDS SQLite databases, reading the md5, sha1 and sha256 columns of
+//     the FILE table.
+//   - CSV files with a header row, such as the NSRL RDS NSRLFile.txt, reading
+//     the columns named MD5, SHA-1 or SHA-256.
+//   - Anything else as a digest list with one hex digest per line, the
+//     format md5sum and sha256sum write. Blank lines and lines starting with
+//     # are ignored.
+//
+// Digests are told apart by their length: 32 hex digits for MD5, 40 for SHA-1
+// and 64 for SHA-256 or BLAKE3. Values of other lengths are skipped.
+func Load(name, path string) (*Set, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header := make([]byte, len(sqliteMagic))
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	var b builder
+	if bytes.Equal(header[:n], sqliteMagic) {
+		err = b.readSQLite(path)
+	} else if _, err = f.Seek(0, io.SeekStart); err == nil {
+		err = b.readText(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("hash set %s: %w", name, err)
+	}
+	if len(b.keys) == 0 {
+		return nil, fmt.Errorf("hash set %s: no md5, sha1 or sha256 digests in %s", name, path)
+	}
+	return b.build(name)
+}
+
+// Len returns the number of distinct digests in the set.
+func (s *Set) Len() int {
+	return len(s.keys)
+}
+
+// Algorithms returns the hash algorithms the set's digests were made with.
+// Lists of 64 digit digests are reported as sha256.
+func (s *Set) Algorithms() []string {
+	return s.algorithms
+}
+
+// Contains reports whether the hex digest is in the set.
+func (s *Set) Contains(digest string) bool {
+	key, ok := digestKey([]byte(digest))
+	if !ok || !s.filter.Contains(key) {
+		return false
+	}
+	_, found := slices.BinarySearch(s.keys, key)
+	return found
+}
+
+// digestKey hashes the raw bytes of a hex digest, so digests match whatever
+// the case of their hex digits.
+func digestKey(digest []byte) (uint64, bool) {
+	if digestAlgorithm(len(digest)) == "" {
+		return 0, false
+	}
+	var raw [32]byte
+	n, err := hex.Decode(raw[:], digest)
+	if err != nil {
+		return 0, false
+	}
+	return xxhash.Sum64(raw[:n]), true
+}
+
+func digestAlgorithm(hexLen int) string {
+	switch hexLen {
+	case 32:
+		return "md5"
+	case 40:
+		return "sha1"
+	case 64:
+		return "sha256"
+	}
+	return ""
+}
+
+type builder struct {
+	keys       []uint64
+	algorithms map[string]struct{}
+}
+
+func (b *builder) add(digest []byte) {
+	digest = bytes.TrimSpace(digest)
+	key, ok := digestKey(digest)
+	if !ok {
+		return
+	}
+	if b.algorithms == nil {
+		b.algorithms = make(map[string]struct{}, 3)
+	}
+	b.algorithms[digestAlgorithm(len(digest))] = struct{}{}
+	b.keys = append(b.keys, key)
+}
+
+func (b *builder) build(name string) (*Set, error) {
+	slices.Sort(b.keys)
+	keys := slices.Clip(slices.Compact(b.keys))
+	filter, err := xorfilter.PopulateBinaryFuse8(keys)
+	if err != nil {
+		return nil, fmt.Errorf("hash set %s: %w", name, err)
+	}
+	algorithms := make([]string, 0, len(b.algorithms))
+	for algorithm := range b.algorithms {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return &Set{Name: name, algorithms: algorithms, filter: filter, keys: keys}, nil
+}
+
+// readText reads a CSV file when the first line that is not blank or a
+// comment holds a comma and does not start with a digest, and a digest list
+// otherwise.
+func (b *builder) readText(r io.Reader) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+	peek, err := br.Peek(64 * 1024)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return err
+	}
+	for _, line := range bytes.Split(peek, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if _, ok := digestKey(firstField(line)); !ok && bytes.IndexByte(line, ',') >= 0 {
+			return b.readCSV(br)
+		}
+		break
+	}
+	return b.readList(br)
+}
+
+func (b *builder) readList(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		b.add(firstField(line))
+	}
+	return scanner.Err()
+}
+
+// firstField returns line up to its first space or tab, dropping the file
+// name md5sum and sha256sum write after the digest.
+func firstField(line []byte) []byte {
+	if end := bytes.IndexAny(line, " \t"); end >= 0 {
+		return line[:end]
+	}
+	return line
+}
+
+func (b *builder) readCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = true
+	reader.Comment = '#'
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("read CSV header: %w", err)
+	}
+	columns := hashColumns(header)
+	if len(columns) == 0 {
+		return fmt.Errorf("CSV header has no MD5, SHA-1 or SHA-256 column")
+	}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			if column < len(record) {
+				b.add([]byte(record[column]))
+			}
+		}
+	}
+}
+
+// hashColumns returns the indexes of the md5, sha1 and sha256 columns,
+// matching names such as "SHA-1" or "sha_256".
+func hashColumns(names []string) []int {
+	var columns []int
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch strings.NewReplacer("-", "", "_", "").Replace(name) {
+		case "md5", "sha1", "sha256":
+			columns = append(columns, i)
+		}
+	}
+	return columns
+}
+
+// readSQLite reads the FILE table of an NSRL RDS v3 database, or the only
+// table with hash columns in other databases.
+func (b *builder) readSQLite(path string) error {
+	uri := url.URL{Scheme: "file", Opaque: (&url.URL{Path: path}).EscapedPath(), RawQuery: "mode=ro"}
+	db, err := sql.Open("sqlite", uri.String())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	table, columns, err := sqliteHashTable(db)
+	if err != nil {
+		return err
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(column)
+	}
+	rows, err := db.Query("SELECT " + strings.Join(quoted, ", ") + " FROM " + quoteIdentifier(table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for _, value := range values {
+			b.add(value)
+		}
+	}
+	return rows.Err()
+}
+
+func sqliteHashTable(db *sql.DB) (string, []string, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name")
+	if err != nil {
+		return "", nil, err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return "", nil, err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", nil, err
+	}
+
+	var candidates []string
+	var candidateColumns []string
+	for _, table := range tables {
+		columns, err := sqliteColumns(db, table)
+		if err != nil {
+			return "", nil, err
+		}
+		var hashes []string
+		for _, i := range hashColumns(columns) {
+			hashes = append(hashes, columns[i])
+		}
+		if len(hashes) == 0 {
+			continue
+		}
+		if strings.EqualFold(table, "FILE") {
+			return table, hashes, nil
+		}
+		candidates = append(candidates, table)
+		candidateColumns = hashes
+	}
+	switch len(candidates) {
+	case 0:
+		return "", nil, fmt.Errorf("no table with md5, sha1 or sha256 columns")
+	case 1:
+		return candidates[0], candidateColumns, nil
+	default:
+		return "", nil, fmt.Errorf("several tables have hash columns (%s) and none is named FILE", strings.Join(candidates, ", "))
+	}
+}
+
+func sqliteColumns(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
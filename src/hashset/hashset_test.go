@@ -0,0 +1,110 @@
+package hashset
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func digests(content string) (md5sum, sha1sum, sha256sum string) {
+	m := md5.Sum([]byte(content))
+	s1 := sha1.Sum([]byte(content))
+	s256 := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(m[:]), hex.EncodeToString(s1[:]), hex.EncodeToString(s256[:])
+}
+
+func TestLoadDigestList(t *testing.T) {
+	_, _, known := digests("known")
+	md5sum, _, _ := digests("legacy")
+	path := filepath.Join(t.TempDir(), "ioc.txt")
+	list := "# indicators\n\n" + strings.ToUpper(known) + "  dropper,v2.exe\n" + md5sum + "\nnot-a-digest\n"
+	if err := os.WriteFile(path, []byte(list), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := Load("ioc", path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if set.Len() != 2 || strings.Join(set.Algorithms(), ",") != "md5,sha256" {
+		t.Fatalf("unexpected set: %d digests, algorithms %v", set.Len(), set.Algorithms())
+	}
+	if !set.Contains(known) || !set.Contains(md5sum) {
+		t.Fatal("expected both listed digests to be members")
+	}
+	_, _, other := digests("other")
+	if set.Contains(other) || set.Contains("xyz") {
+		t.Fatal("unexpected member")
+	}
+}
+
+func TestLoadNSRLCSV(t *testing.T) {
+	_, sha1sum, _ := digests("kernel32.dll")
+	md5sum, _, _ := digests("kernel32.dll")
+	path := filepath.Join(t.TempDir(), "NSRLFile.txt")
+	csv := `"SHA-1","MD5","CRC32","FileName","FileSize","ProductCode","OpSystemCode","SpecialCode"` + "\n" +
+		`"` + strings.ToUpper(sha1sum) + `","` + strings.ToUpper(md5sum) + `","FFFFFFFF","kernel32, copy.dll",4109,1,"358",""` + "\n"
+	if err := os.WriteFile(path, []byte(csv), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := Load("nsrl", path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !set.Contains(sha1sum) || !set.Contains(md5sum) || set.Len() != 2 {
+		t.Fatalf("expected the SHA-1 and MD5 columns to be loaded, got %d digests", set.Len())
+	}
+}
+
+func TestLoadNSRLSQLite(t *testing.T) {
+	md5sum, sha1sum, sha256sum := digests("notepad.exe")
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite", filepath.Join(dir, "RDS.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE PKG (package_id INTEGER, name TEXT)`,
+		`CREATE TABLE FILE (sha256 TEXT, sha1 TEXT, md5 TEXT, crc32 TEXT, file_name TEXT, file_size INTEGER, package_id INTEGER)`,
+		`INSERT INTO FILE VALUES ('` + strings.ToUpper(sha256sum) + `', '` + sha1sum + `', '` + md5sum + `', '0', 'notepad.exe', 1, 1)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	db.Close()
+	// A ? in the path must not be taken for the start of the SQLite URI
+	// parameters.
+	path := filepath.Join(dir, "RDS?v3.db")
+	if err := os.Rename(filepath.Join(dir, "RDS.db"), path); err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := Load("nsrl", path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !set.Contains(sha256sum) || !set.Contains(sha1sum) || !set.Contains(md5sum) {
+		t.Fatal("expected every hash column of the FILE table to be loaded")
+	}
+	if strings.Join(set.Algorithms(), ",") != "md5,sha1,sha256" {
+		t.Fatalf("unexpected algorithms %v", set.Algorithms())
+	}
+}
+
+func TestLoadRejectsFilesWithoutDigests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(path, []byte("# nothing here\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load("empty", path); err == nil {
+		t.Fatal("expected a set without digests to be rejected")
+	}
+}
@@ -0,0 +1,87 @@
+package parquet
+
+import "encoding/binary"
+
+// Thrift compact protocol type ids used by the Parquet metadata structs.
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactEncoder writes the subset of the Thrift compact protocol that the
+// Parquet page headers and footer need.
+type compactEncoder struct {
+	buf    []byte
+	lastID int16
+	stack  []int16
+}
+
+func (e *compactEncoder) uvarint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *compactEncoder) varint(v int64) {
+	e.uvarint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (e *compactEncoder) field(id int16, typ byte) {
+	if delta := id - e.lastID; delta > 0 && delta <= 15 {
+		e.buf = append(e.buf, byte(delta)<<4|typ)
+	} else {
+		e.buf = append(e.buf, typ)
+		e.varint(int64(id))
+	}
+	e.lastID = id
+}
+
+func (e *compactEncoder) i32(id int16, v int32) {
+	e.field(id, compactI32)
+	e.varint(int64(v))
+}
+
+func (e *compactEncoder) i64(id int16, v int64) {
+	e.field(id, compactI64)
+	e.varint(v)
+}
+
+func (e *compactEncoder) binary(id int16, v string) {
+	e.field(id, compactBinary)
+	e.bytes(v)
+}
+
+func (e *compactEncoder) bytes(v string) {
+	e.uvarint(uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+// list starts a list field of n elements; the caller writes the elements.
+func (e *compactEncoder) list(id int16, elemType byte, n int) {
+	e.field(id, compactList)
+	if n < 15 {
+		e.buf = append(e.buf, byte(n)<<4|elemType)
+		return
+	}
+	e.buf = append(e.buf, 0xf0|elemType)
+	e.uvarint(uint64(n))
+}
+
+// beginStruct starts a nested struct, either a struct field or a list
+// element, whose field ids restart from zero.
+func (e *compactEncoder) beginStruct() {
+	e.stack = append(e.stack, e.lastID)
+	e.lastID = 0
+}
+
+func (e *compactEncoder) structField(id int16) {
+	e.field(id, compactStruct)
+	e.beginStruct()
+}
+
+func (e *compactEncoder) endStruct() {
+	e.buf = append(e.buf, 0)
+	e.lastID = e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+}
@@ -0,0 +1,314 @@
+// Package parquet writes flat Parquet files of optional string, int64 and
+// boolean columns. It covers only what the columnar export needs: each row
+// group holds one PLAIN encoded, Snappy compressed data page per column, and
+// the footer is written on Close.
+package parquet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+
+	"safnari/version"
+)
+
+// Kind is the type of a column's values.
+type Kind int
+
+const (
+	String Kind = iota
+	Int64
+	Bool
+)
+
+// Column describes one top-level optional column.
+type Column struct {
+	Name string
+	Kind Kind
+}
+
+// DefaultRowGroupSize bounds the encoded row data buffered in memory before
+// a row group is written.
+const DefaultRowGroupSize = 64 << 20
+
+var magic = []byte("PAR1")
+
+// Parquet enum values from parquet.thrift.
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeByteArray = 6
+
+	repetitionOptional = 1
+	convertedUTF8      = 0
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecSnappy        = 1
+	pageData           = 0
+)
+
+type columnBuffer struct {
+	// defs holds one definition level per row: 1 for a value, 0 for null.
+	defs   []byte
+	values []byte
+	// bools counts the bit-packed values of a Bool column.
+	bools int
+}
+
+type chunkMeta struct {
+	offset       int64
+	values       int64
+	uncompressed int64
+	compressed   int64
+}
+
+type rowGroupMeta struct {
+	chunks []chunkMeta
+	rows   int64
+}
+
+// Writer streams rows to w as a Parquet file.
+type Writer struct {
+	w            io.Writer
+	offset       int64
+	columns      []Column
+	buffers      []columnBuffer
+	rowGroupSize int64
+	// buffered approximates the encoded size of the open row group.
+	buffered int64
+	rows     int64
+	numRows  int64
+	groups   []rowGroupMeta
+}
+
+// NewWriter writes the file header to w. Row groups are cut once about
+// rowGroupSize bytes of encoded values are buffered; zero or less uses
+// DefaultRowGroupSize.
+func NewWriter(w io.Writer, columns []Column, rowGroupSize int64) (*Writer, error) {
+	if rowGroupSize <= 0 {
+		rowGroupSize = DefaultRowGroupSize
+	}
+	pw := &Writer{
+		w:            w,
+		columns:      columns,
+		buffers:      make([]columnBuffer, len(columns)),
+		rowGroupSize: rowGroupSize,
+	}
+	if err := pw.write(magic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// WriteRow buffers one row. values holds one entry per column: nil, or a
+// string, int64 or bool matching the column's kind.
+func (w *Writer) WriteRow(values []any) error {
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("parquet: row has %d values for %d columns", len(values), len(w.columns))
+	}
+	for i, value := range values {
+		if !w.columns[i].accepts(value) {
+			return fmt.Errorf("parquet: column %s cannot hold %T", w.columns[i].Name, value)
+		}
+	}
+	for i, value := range values {
+		w.buffers[i].add(value)
+	}
+	w.buffered = 0
+	for i := range w.buffers {
+		w.buffered += int64(len(w.buffers[i].values) + len(w.buffers[i].defs)/8)
+	}
+	w.rows++
+	if w.buffered >= w.rowGroupSize {
+		return w.flushRowGroup()
+	}
+	return nil
+}
+
+func (c Column) accepts(value any) bool {
+	switch value.(type) {
+	case nil:
+		return true
+	case string:
+		return c.Kind == String
+	case int64:
+		return c.Kind == Int64
+	case bool:
+		return c.Kind == Bool
+	}
+	return false
+}
+
+func (b *columnBuffer) add(value any) {
+	switch v := value.(type) {
+	case nil:
+		b.defs = append(b.defs, 0)
+		return
+	case string:
+		b.values = binary.LittleEndian.AppendUint32(b.values, uint32(len(v)))
+		b.values = append(b.values, v...)
+	case int64:
+		b.values = binary.LittleEndian.AppendUint64(b.values, uint64(v))
+	case bool:
+		if b.bools%8 == 0 {
+			b.values = append(b.values, 0)
+		}
+		if v {
+			b.values[len(b.values)-1] |= 1 << (b.bools % 8)
+		}
+		b.bools++
+	}
+	b.defs = append(b.defs, 1)
+}
+
+// Close writes any buffered rows and the footer. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.rows > 0 {
+		if err := w.flushRowGroup(); err != nil {
+			return err
+		}
+	}
+	footer := w.footer()
+	if err := w.write(footer); err != nil {
+		return err
+	}
+	if err := w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))); err != nil {
+		return err
+	}
+	return w.write(magic)
+}
+
+func (w *Writer) flushRowGroup() error {
+	group := rowGroupMeta{chunks: make([]chunkMeta, len(w.columns)), rows: w.rows}
+	for i := range w.buffers {
+		b := &w.buffers[i]
+		page := encodeDefinitionLevels(b.defs)
+		page = append(page, b.values...)
+		compressed := snappy.Encode(nil, page)
+		header := pageHeader(len(b.defs), len(page), len(compressed))
+		group.chunks[i] = chunkMeta{
+			offset:       w.offset,
+			values:       int64(len(b.defs)),
+			uncompressed: int64(len(header) + len(page)),
+			compressed:   int64(len(header) + len(compressed)),
+		}
+		if err := w.write(header); err != nil {
+			return err
+		}
+		if err := w.write(compressed); err != nil {
+			return err
+		}
+		*b = columnBuffer{defs: b.defs[:0], values: b.values[:0]}
+	}
+	w.groups = append(w.groups, group)
+	w.numRows += w.rows
+	w.rows = 0
+	w.buffered = 0
+	return nil
+}
+
+func (w *Writer) write(p []byte) error {
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	return err
+}
+
+// encodeDefinitionLevels encodes bit-width 1 levels as RLE runs behind the
+// 4-byte length prefix that v1 data pages use.
+func encodeDefinitionLevels(defs []byte) []byte {
+	out := make([]byte, 4, 16)
+	for i := 0; i < len(defs); {
+		j := i + 1
+		for j < len(defs) && defs[j] == defs[i] {
+			j++
+		}
+		out = binary.AppendUvarint(out, uint64(j-i)<<1)
+		out = append(out, defs[i])
+		i = j
+	}
+	binary.LittleEndian.PutUint32(out, uint32(len(out)-4))
+	return out
+}
+
+func pageHeader(values, uncompressed, compressed int) []byte {
+	var e compactEncoder
+	e.beginStruct()
+	e.i32(1, pageData)
+	e.i32(2, int32(uncompressed))
+	e.i32(3, int32(compressed))
+	e.structField(5)
+	e.i32(1, int32(values))
+	e.i32(2, encodingPlain)
+	e.i32(3, encodingRLE)
+	e.i32(4, encodingRLE)
+	e.endStruct()
+	e.endStruct()
+	return e.buf
+}
+
+func (w *Writer) footer() []byte {
+	var e compactEncoder
+	e.beginStruct()
+	e.i32(1, 1)
+	e.list(2, compactStruct, len(w.columns)+1)
+	e.beginStruct()
+	e.binary(4, "schema")
+	e.i32(5, int32(len(w.columns)))
+	e.endStruct()
+	for _, col := range w.columns {
+		e.beginStruct()
+		e.i32(1, physicalType(col.Kind))
+		e.i32(3, repetitionOptional)
+		e.binary(4, col.Name)
+		if col.Kind == String {
+			e.i32(6, convertedUTF8)
+		}
+		e.endStruct()
+	}
+	e.i64(3, w.numRows)
+	e.list(4, compactStruct, len(w.groups))
+	for _, group := range w.groups {
+		var size int64
+		e.beginStruct()
+		e.list(1, compactStruct, len(group.chunks))
+		for i, chunk := range group.chunks {
+			size += chunk.uncompressed
+			e.beginStruct()
+			e.i64(2, chunk.offset)
+			e.structField(3)
+			e.i32(1, physicalType(w.columns[i].Kind))
+			e.list(2, compactI32, 2)
+			e.varint(encodingPlain)
+			e.varint(encodingRLE)
+			e.list(3, compactBinary, 1)
+			e.bytes(w.columns[i].Name)
+			e.i32(4, codecSnappy)
+			e.i64(5, chunk.values)
+			e.i64(6, chunk.uncompressed)
+			e.i64(7, chunk.compressed)
+			e.i64(9, chunk.offset)
+			e.endStruct()
+			e.endStruct()
+		}
+		e.i64(2, size)
+		e.i64(3, group.rows)
+		e.endStruct()
+	}
+	e.binary(6, "safnari version "+version.Version)
+	e.endStruct()
+	return e.buf
+}
+
+func physicalType(kind Kind) int32 {
+	switch kind {
+	case Int64:
+		return typeInt64
+	case Bool:
+		return typeBoolean
+	default:
+		return typeByteArray
+	}
+}
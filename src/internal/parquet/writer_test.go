@@ -0,0 +1,259 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+// compactDecoder reads any Thrift compact struct into field id maps so the
+// tests check the encoding without sharing code with the writer.
+type compactDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *compactDecoder) byte() byte {
+	b := d.data[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *compactDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	d.pos += n
+	return v
+}
+
+func (d *compactDecoder) varint() int64 {
+	v := d.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *compactDecoder) readStruct() map[int16]any {
+	fields := make(map[int16]any)
+	var last int16
+	for {
+		header := d.byte()
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(d.varint())
+		}
+		last = id
+		fields[id] = d.value(header & 0x0f)
+	}
+}
+
+func (d *compactDecoder) value(typ byte) any {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case compactI32, compactI64:
+		return d.varint()
+	case compactBinary:
+		n := int(d.uvarint())
+		d.pos += n
+		return string(d.data[d.pos-n : d.pos])
+	case compactList:
+		header := d.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(d.uvarint())
+		}
+		items := make([]any, n)
+		for i := range items {
+			items[i] = d.value(header & 0x0f)
+		}
+		return items
+	case compactStruct:
+		return d.readStruct()
+	}
+	panic(fmt.Sprintf("unexpected compact type %d", typ))
+}
+
+type decodedFile struct {
+	columns   []string
+	rows      [][]any
+	rowGroups int
+}
+
+func decodeFile(t *testing.T, data []byte) decodedFile {
+	t.Helper()
+	if !bytes.HasPrefix(data, magic) || !bytes.HasSuffix(data, magic) {
+		t.Fatal("missing PAR1 magic")
+	}
+	size := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := (&compactDecoder{data: data[len(data)-8-size : len(data)-8]}).readStruct()
+
+	var out decodedFile
+	for _, elem := range footer[2].([]any)[1:] {
+		out.columns = append(out.columns, elem.(map[int16]any)[4].(string))
+	}
+	numRows := int(footer[3].(int64))
+	groups := footer[4].([]any)
+	out.rowGroups = len(groups)
+	for _, g := range groups {
+		group := g.(map[int16]any)
+		rows := int(group[3].(int64))
+		start := len(out.rows)
+		for i := 0; i < rows; i++ {
+			out.rows = append(out.rows, make([]any, len(out.columns)))
+		}
+		for c, chunk := range group[1].([]any) {
+			meta := chunk.(map[int16]any)[3].(map[int16]any)
+			if meta[4].(int64) != codecSnappy {
+				t.Fatalf("unexpected codec %v", meta[4])
+			}
+			for i, value := range decodePage(t, data, meta[9].(int64), meta[1].(int64)) {
+				out.rows[start+i][c] = value
+			}
+		}
+	}
+	if len(out.rows) != numRows {
+		t.Fatalf("footer reports %d rows, row groups hold %d", numRows, len(out.rows))
+	}
+	return out
+}
+
+func decodePage(t *testing.T, data []byte, offset, physical int64) []any {
+	t.Helper()
+	d := &compactDecoder{data: data, pos: int(offset)}
+	header := d.readStruct()
+	compressed := int(header[3].(int64))
+	page, err := snappy.Decode(nil, data[d.pos:d.pos+compressed])
+	if err != nil {
+		t.Fatalf("snappy: %v", err)
+	}
+	if len(page) != int(header[2].(int64)) {
+		t.Fatalf("uncompressed size %d, header says %v", len(page), header[2])
+	}
+	numValues := int(header[5].(map[int16]any)[1].(int64))
+
+	levelsEnd := 4 + int(binary.LittleEndian.Uint32(page))
+	levels := &compactDecoder{data: page[:levelsEnd], pos: 4}
+	var defs []byte
+	for levels.pos < levelsEnd {
+		run := levels.uvarint()
+		if run&1 != 0 {
+			t.Fatal("unexpected bit-packed run")
+		}
+		defs = append(defs, bytes.Repeat([]byte{levels.byte()}, int(run>>1))...)
+	}
+	if len(defs) != numValues {
+		t.Fatalf("decoded %d levels for %d values", len(defs), numValues)
+	}
+
+	values := page[levelsEnd:]
+	out := make([]any, len(defs))
+	present := 0
+	for i, def := range defs {
+		if def == 0 {
+			continue
+		}
+		switch physical {
+		case typeByteArray:
+			n := int(binary.LittleEndian.Uint32(values))
+			out[i] = string(values[4 : 4+n])
+			values = values[4+n:]
+		case typeInt64:
+			out[i] = int64(binary.LittleEndian.Uint64(values))
+			values = values[8:]
+		case typeBoolean:
+			out[i] = values[present/8]&(1<<(present%8)) != 0
+		}
+		present++
+	}
+	return out
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	columns := []Column{{Name: "path", Kind: String}, {Name: "size", Kind: Int64}, {Name: "truncated", Kind: Bool}}
+	// Enough columns for the long list header form.
+	for i := 0; i < 15; i++ {
+		columns = append(columns, Column{Name: fmt.Sprintf("extra_%d", i), Kind: String})
+	}
+	var rows [][]any
+	for i := 0; i < 40; i++ {
+		row := make([]any, len(columns))
+		row[0] = fmt.Sprintf("/data/file-%d.txt", i)
+		if i%3 != 0 {
+			row[1] = int64(i * 1000)
+		}
+		if i%4 != 1 {
+			row[2] = i%2 == 0
+		}
+		if i%7 == 0 {
+			row[len(columns)-1] = `{"k":"v"}`
+		}
+		rows = append(rows, row)
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, columns, 512)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatalf("write row: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	got := decodeFile(t, buf.Bytes())
+	if got.rowGroups < 2 {
+		t.Fatalf("expected rows to span row groups, got %d", got.rowGroups)
+	}
+	if len(got.columns) != len(columns) || got.columns[2] != "truncated" {
+		t.Fatalf("unexpected columns %v", got.columns)
+	}
+	if !reflect.DeepEqual(got.rows, rows) {
+		t.Fatalf("rows mismatch:\n got %v\nwant %v", got.rows, rows)
+	}
+}
+
+func TestWriterEmptyFile(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []Column{{Name: "size", Kind: Int64}}, 0)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if got := decodeFile(t, buf.Bytes()); len(got.rows) != 0 || got.rowGroups != 0 {
+		t.Fatalf("expected an empty file, got %d rows in %d groups", len(got.rows), got.rowGroups)
+	}
+}
+
+func TestWriterRejectsMismatchedRowsWhole(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, []Column{{Name: "path", Kind: String}, {Name: "size", Kind: Int64}}, 0)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+	if err := w.WriteRow([]any{"/a", "12"}); err == nil {
+		t.Fatal("expected a string value to be rejected for an int64 column")
+	}
+	if err := w.WriteRow([]any{"/a"}); err == nil {
+		t.Fatal("expected a short row to be rejected")
+	}
+	if err := w.WriteRow([]any{"/b", int64(12)}); err != nil {
+		t.Fatalf("write row: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if got := decodeFile(t, buf.Bytes()); !reflect.DeepEqual(got.rows, [][]any{{"/b", int64(12)}}) {
+		t.Fatalf("rejected rows left partial values: %v", got.rows)
+	}
+}
@@ -85,6 +85,18 @@ func ExtractMetadataFromBytes(content []byte, mimeType string, path string) map[
 	return metadata
 }
 
+// Supported reports whether metadata extraction is implemented for mimeType.
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png",
+		"application/pdf",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return true
+	default:
+		return false
+	}
+}
+
 // extractImageMetadata extracts a subset of EXIF tags from images.
 func extractImageMetadata(path string, maxBytes int64) map[string]interface{} {
 	f, err := os.Open(path)
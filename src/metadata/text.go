@@ -0,0 +1,408 @@
+package metadata
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+const (
+	mimeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	mimeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	mimePPTX = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	mimePDF  = "application/pdf"
+)
+
+// errTextLimit stops extraction once the caller's output budget is spent.
+var errTextLimit = errors.New("text limit reached")
+
+// TextExtractionSupported reports whether ExtractText understands mimeType.
+func TextExtractionSupported(mimeType string) bool {
+	switch mimeType {
+	case mimeDOCX, mimeXLSX, mimePPTX, mimePDF:
+		return true
+	default:
+		return false
+	}
+}
+
+// ExtractText returns the plain text of an Office Open XML document or PDF.
+// At most maxBytes of text are returned when maxBytes is positive; the boolean
+// result reports whether the text was cut short. PDF text is recovered from
+// literal and hex string operands of the page content streams, so glyphs in
+// fonts with custom encodings may not round-trip.
+func ExtractText(r io.ReaderAt, size int64, mimeType string, maxBytes int64) ([]byte, bool, error) {
+	out := &textBuffer{limit: maxBytes}
+	var err error
+	switch mimeType {
+	case mimeDOCX:
+		err = extractOOXMLText(r, size, out, docxTextPart)
+	case mimeXLSX:
+		err = extractOOXMLText(r, size, out, xlsxTextPart)
+	case mimePPTX:
+		err = extractOOXMLText(r, size, out, pptxTextPart)
+	case mimePDF:
+		err = extractPDFText(io.NewSectionReader(r, 0, size), out)
+	default:
+		return nil, false, fmt.Errorf("text extraction not supported for %s", mimeType)
+	}
+	if errors.Is(err, errTextLimit) {
+		return out.buf.Bytes(), true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return out.buf.Bytes(), false, nil
+}
+
+type textBuffer struct {
+	buf   bytes.Buffer
+	limit int64
+}
+
+func (b *textBuffer) write(s string) error {
+	if s == "" {
+		return nil
+	}
+	if b.limit > 0 {
+		remaining := b.limit - int64(b.buf.Len())
+		if remaining <= 0 {
+			return errTextLimit
+		}
+		if int64(len(s)) > remaining {
+			b.buf.WriteString(s[:remaining])
+			return errTextLimit
+		}
+	}
+	b.buf.WriteString(s)
+	return nil
+}
+
+// separate writes sep unless the buffer is empty or already ends in whitespace.
+func (b *textBuffer) separate(sep string) error {
+	n := b.buf.Len()
+	if n == 0 {
+		return nil
+	}
+	switch b.buf.Bytes()[n-1] {
+	case '\n', '\t', ' ':
+		return nil
+	}
+	return b.write(sep)
+}
+
+func docxTextPart(name string) bool {
+	if !strings.HasPrefix(name, "word/") || path.Ext(name) != ".xml" {
+		return false
+	}
+	base := path.Base(name)
+	switch base {
+	case "document.xml", "footnotes.xml", "endnotes.xml", "comments.xml":
+		return true
+	}
+	return strings.HasPrefix(base, "header") || strings.HasPrefix(base, "footer")
+}
+
+func xlsxTextPart(name string) bool {
+	if name == "xl/sharedStrings.xml" {
+		return true
+	}
+	return strings.HasPrefix(name, "xl/worksheets/") && path.Ext(name) == ".xml" && !strings.Contains(name[len("xl/worksheets/"):], "/")
+}
+
+func pptxTextPart(name string) bool {
+	if path.Ext(name) != ".xml" {
+		return false
+	}
+	dir := path.Dir(name)
+	return dir == "ppt/slides" || dir == "ppt/notesSlides"
+}
+
+func extractOOXMLText(r io.ReaderAt, size int64, out *textBuffer, include func(string) bool) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if !include(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = extractOOXMLPartText(rc, out)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := out.separate("\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractOOXMLPartText collects run text from WordprocessingML, DrawingML and
+// SpreadsheetML parts. Shared-string cell indexes are skipped because the
+// strings themselves come from sharedStrings.xml.
+func extractOOXMLPartText(r io.Reader, out *textBuffer) error {
+	dec := xml.NewDecoder(r)
+	var (
+		inText      bool
+		inValue     bool
+		sharedIndex bool
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "v":
+				inValue = !sharedIndex
+			case "c":
+				sharedIndex = false
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "t" && attr.Value == "s" {
+						sharedIndex = true
+					}
+				}
+			case "tab":
+				err = out.write("\t")
+			case "br", "cr":
+				err = out.write("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "v":
+				inValue = false
+			case "c":
+				err = out.separate("\t")
+			case "p", "si", "row", "tr":
+				err = out.separate("\n")
+			}
+		case xml.CharData:
+			if inText || inValue {
+				err = out.write(string(t))
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractPDFText(rs io.ReadSeeker, out *textBuffer) error {
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	conf.Cmd = model.EXTRACTCONTENT
+	ctx, err := api.ReadAndValidate(rs, conf)
+	if err != nil {
+		return err
+	}
+	for page := 1; page <= ctx.PageCount; page++ {
+		content, err := pdfcpu.ExtractPageContent(ctx, page)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		if err := extractPDFContentText(data, out); err != nil {
+			return err
+		}
+		if err := out.separate("\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractPDFContentText walks a decoded content stream and emits the string
+// operands of the text-showing operators (Tj, TJ, ' and ").
+func extractPDFContentText(data []byte, out *textBuffer) error {
+	var operands []string
+	var inArray bool
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '%':
+			for i < len(data) && data[i] != '\n' && data[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, next := readPDFLiteralString(data, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(data) && data[i+1] == '<':
+			i += 2
+		case c == '>' && i+1 < len(data) && data[i+1] == '>':
+			i += 2
+		case c == '<':
+			s, next := readPDFHexString(data, i)
+			operands = append(operands, s)
+			i = next
+		case c == '[':
+			inArray = true
+			i++
+		case c == ']':
+			inArray = false
+			i++
+		case isPDFDelimiter(c) || isPDFSpace(c):
+			i++
+		default:
+			start := i
+			for i < len(data) && !isPDFSpace(data[i]) && !isPDFDelimiter(data[i]) {
+				i++
+			}
+			token := string(data[start:i])
+			if num, err := strconv.ParseFloat(token, 64); err == nil {
+				// Large negative TJ adjustments are how PDFs encode word gaps.
+				if inArray && num < -200 && len(operands) > 0 {
+					operands[len(operands)-1] += " "
+				}
+				continue
+			}
+			var err error
+			switch token {
+			case "Tj", "TJ":
+				err = out.write(strings.Join(operands, ""))
+			case "'", "\"":
+				if err = out.separate("\n"); err == nil {
+					err = out.write(strings.Join(operands, ""))
+				}
+			case "T*", "Td", "TD", "ET":
+				err = out.separate("\n")
+			case "ID":
+				i = skipPDFInlineImage(data, i)
+			}
+			if err != nil {
+				return err
+			}
+			if !strings.HasPrefix(token, "/") {
+				operands = operands[:0]
+			}
+		}
+	}
+	return nil
+}
+
+func readPDFLiteralString(data []byte, i int) (string, int) {
+	var sb strings.Builder
+	depth := 0
+	for i++; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '\\':
+			i++
+			if i >= len(data) {
+				return sb.String(), i
+			}
+			switch e := data[i]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				if e == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+					i++
+				}
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				v := 0
+				for n := 0; n < 3 && i < len(data) && data[i] >= '0' && data[i] <= '7'; n++ {
+					v = v*8 + int(data[i]-'0')
+					i++
+				}
+				i--
+				sb.WriteByte(byte(v))
+			default:
+				sb.WriteByte(e)
+			}
+		case '(':
+			depth++
+			sb.WriteByte(c)
+		case ')':
+			if depth == 0 {
+				return sb.String(), i + 1
+			}
+			depth--
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), i
+}
+
+func readPDFHexString(data []byte, i int) (string, int) {
+	end := bytes.IndexByte(data[i:], '>')
+	if end < 0 {
+		return "", len(data)
+	}
+	digits := make([]byte, 0, end)
+	for _, c := range data[i+1 : i+end] {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	decoded := make([]byte, hex.DecodedLen(len(digits)))
+	n, err := hex.Decode(decoded, digits)
+	if err != nil {
+		return "", i + end + 1
+	}
+	return string(decoded[:n]), i + end + 1
+}
+
+func skipPDFInlineImage(data []byte, i int) int {
+	for ; i+2 < len(data); i++ {
+		if isPDFSpace(data[i]) && data[i+1] == 'E' && data[i+2] == 'I' &&
+			(i+3 == len(data) || isPDFSpace(data[i+3])) {
+			return i + 3
+		}
+	}
+	return len(data)
+}
+
+func isPDFSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\f', 0:
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '%':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package metadata
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func ooxmlBytes(t *testing.T, parts [][2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, part := range parts {
+		w, err := zw.Create(part[0])
+		if err != nil {
+			t.Fatalf("zip create %s: %v", part[0], err)
+		}
+		if _, err := w.Write([]byte(part[1])); err != nil {
+			t.Fatalf("zip write %s: %v", part[0], err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractTextDOCX(t *testing.T) {
+	doc := ooxmlBytes(t, [][2]string{
+		{"word/document.xml", `<w:document xmlns:w="w"><w:body>` +
+			`<w:p><w:r><w:t>SSN </w:t></w:r><w:r><w:t>123-45-6789</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>second</w:t><w:tab/><w:t>line</w:t></w:r></w:p>` +
+			`</w:body></w:document>`},
+		{"word/styles.xml", `<w:styles xmlns:w="w"><w:t>ignored</w:t></w:styles>`},
+	})
+	text, truncated, err := ExtractText(bytes.NewReader(doc), int64(len(doc)), mimeDOCX, 0)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if truncated {
+		t.Fatal("unexpected truncation")
+	}
+	got := string(text)
+	if !strings.Contains(got, "SSN 123-45-6789\n") || !strings.Contains(got, "second\tline") {
+		t.Fatalf("unexpected docx text %q", got)
+	}
+	if strings.Contains(got, "ignored") {
+		t.Fatalf("styles part should not be extracted: %q", got)
+	}
+}
+
+func TestExtractTextXLSXSkipsSharedStringIndexes(t *testing.T) {
+	doc := ooxmlBytes(t, [][2]string{
+		{"xl/sharedStrings.xml", `<sst><si><t>alpha</t></si><si><t>beta</t></si></sst>`},
+		{"xl/worksheets/sheet1.xml", `<worksheet><sheetData><row>` +
+			`<c t="s"><v>0</v></c><c><v>42</v></c><c t="inlineStr"><is><t>gamma</t></is></c>` +
+			`</row></sheetData></worksheet>`},
+	})
+	text, _, err := ExtractText(bytes.NewReader(doc), int64(len(doc)), mimeXLSX, 0)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	got := string(text)
+	for _, want := range []string{"alpha", "beta", "42", "gamma"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in xlsx text %q", want, got)
+		}
+	}
+	if strings.Contains(got, "0\t") {
+		t.Fatalf("shared string index leaked into text %q", got)
+	}
+}
+
+func TestExtractTextPPTX(t *testing.T) {
+	doc := ooxmlBytes(t, [][2]string{
+		{"ppt/slides/slide1.xml", `<p:sld><a:p><a:r><a:t>Quarterly review</a:t></a:r></a:p></p:sld>`},
+		{"ppt/notesSlides/notesSlide1.xml", `<p:notes><a:p><a:r><a:t>speaker note</a:t></a:r></a:p></p:notes>`},
+		{"ppt/slideLayouts/slideLayout1.xml", `<p:sldLayout><a:t>layout</a:t></p:sldLayout>`},
+	})
+	text, _, err := ExtractText(bytes.NewReader(doc), int64(len(doc)), mimePPTX, 0)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	got := string(text)
+	if !strings.Contains(got, "Quarterly review") || !strings.Contains(got, "speaker note") || strings.Contains(got, "layout") {
+		t.Fatalf("unexpected pptx text %q", got)
+	}
+}
+
+func TestExtractTextLimit(t *testing.T) {
+	doc := ooxmlBytes(t, [][2]string{
+		{"word/document.xml", `<w:document><w:p><w:r><w:t>0123456789abcdef</w:t></w:r></w:p></w:document>`},
+	})
+	text, truncated, err := ExtractText(bytes.NewReader(doc), int64(len(doc)), mimeDOCX, 10)
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if !truncated || string(text) != "0123456789" {
+		t.Fatalf("expected truncated text, got %q truncated=%v", text, truncated)
+	}
+}
+
+func TestExtractPDFContentText(t *testing.T) {
+	content := []byte("BT /F1 12 Tf 72 712 Td (Hello \\(world\\)) Tj T* [(SSN) -300 (123-45-6789)] TJ <414243> Tj ET")
+	out := &textBuffer{}
+	if err := extractPDFContentText(content, out); err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	got := out.buf.String()
+	if !strings.Contains(got, "Hello (world)") || !strings.Contains(got, "SSN 123-45-6789") || !strings.Contains(got, "ABC") {
+		t.Fatalf("unexpected pdf text %q", got)
+	}
+}
+
+func TestTextExtractionSupported(t *testing.T) {
+	if !TextExtractionSupported(mimeDOCX) || !TextExtractionSupported(mimePDF) {
+		t.Fatal("expected docx and pdf to be supported")
+	}
+	if TextExtractionSupported("image/png") {
+		t.Fatal("did not expect png to be supported")
+	}
+}
@@ -0,0 +1,240 @@
+package output
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"safnari/config"
+)
+
+// FileColumns names the map keys that csv and parquet output flatten into
+// their own columns. Keys seen at scan time but not listed here land in the
+// matching *_other JSON column, so the schema stays the same for every row
+// and every rotated file of a scan.
+type FileColumns struct {
+	Hashes         []string
+	FuzzyHashes    []string
+	SensitiveTypes []string
+}
+
+// defaultFileColumns fills unset key lists from cfg. Sensitive types default
+// to the explicitly included and custom types, since the built-in list lives
+// in the scanner.
+func defaultFileColumns(cfg *config.Config, cols FileColumns) FileColumns {
+	if cols.Hashes == nil {
+		cols.Hashes = cfg.HashAlgorithms
+	}
+	if cols.FuzzyHashes == nil && cfg.FuzzyHash {
+		cols.FuzzyHashes = cfg.FuzzyAlgorithms
+	}
+	if cols.SensitiveTypes == nil {
+		excluded := make(map[string]bool, len(cfg.ExcludeDataTypes))
+		for _, name := range cfg.ExcludeDataTypes {
+			excluded[name] = true
+		}
+		for _, name := range cfg.IncludeDataTypes {
+			if name != "all" && !excluded[name] {
+				cols.SensitiveTypes = append(cols.SensitiveTypes, name)
+			}
+		}
+		for name := range cfg.CustomPatterns {
+			if !excluded[name] {
+				cols.SensitiveTypes = append(cols.SensitiveTypes, name)
+			}
+		}
+	}
+	return cols
+}
+
+type columnKind int
+
+const (
+	columnString columnKind = iota
+	columnInt
+	columnBool
+	// columnJSON holds the field's JSON encoding as a string.
+	columnJSON
+)
+
+// fileColumn is one column of the flattened file schema. Columns with a key
+// read that key from the map field; others read the field itself.
+type fileColumn struct {
+	name  string
+	field string
+	key   string
+	kind  columnKind
+}
+
+// fileSchema is the flattened column layout of a file record, in FileRecord
+// field order.
+type fileSchema struct {
+	columns []fileColumn
+	// keyed records the keys that have their own column, per map field.
+	keyed map[string]map[string]bool
+}
+
+func newFileSchema(cols FileColumns) *fileSchema {
+	s := &fileSchema{keyed: make(map[string]map[string]bool, 3)}
+	add := func(name, field string, kind columnKind) {
+		s.columns = append(s.columns, fileColumn{name: name, field: field, kind: kind})
+	}
+	for _, field := range []string{"path", "name"} {
+		add(field, field, columnString)
+	}
+	add("size", "size", columnInt)
+	for _, field := range []string{"mod_time", "creation_time", "access_time", "change_time"} {
+		add(field, field, columnString)
+	}
+	add("attributes", "attributes", columnJSON)
+	for _, field := range []string{"permissions", "owner", "file_id", "mime_type"} {
+		add(field, field, columnString)
+	}
+	s.addKeyed("hash_", "hashes", cols.Hashes, columnString)
+	s.addKeyed("fuzzy_hash_", "fuzzy_hashes", cols.FuzzyHashes, columnString)
+	add("hash_sets", "hash_sets", columnJSON)
+	add("metadata", "metadata", columnJSON)
+	add("xattrs", "xattrs", columnJSON)
+	add("acl", "acl", columnString)
+	add("alternate_data_streams", "alternate_data_streams", columnJSON)
+	add("sensitive_data", "sensitive_data", columnJSON)
+	s.addKeyed("sensitive_count_", "sensitive_data_match_counts", cols.SensitiveTypes, columnInt)
+	add("sensitive_data_confidence", "sensitive_data_confidence", columnJSON)
+	add("sensitive_data_truncated", "sensitive_data_truncated", columnBool)
+	for _, field := range []string{"sensitive_locations", "search_hits", "search_locations", "rule_matches"} {
+		add(field, field, columnJSON)
+	}
+	add("content_scan_bytes", "content_scan_bytes", columnInt)
+	add("content_scan_truncated", "content_scan_truncated", columnBool)
+	add("extracted_text_bytes", "extracted_text_bytes", columnInt)
+	add("collection_warnings", "collection_warnings", columnJSON)
+	add("extensions", "extensions", columnJSON)
+	add("container", "container", columnJSON)
+	return s
+}
+
+// addKeyed adds a column per key of a map field, sorted by name, followed by
+// a JSON column for the remaining keys. Keys whose column name is taken by
+// an earlier key also fall back to the JSON column.
+func (s *fileSchema) addKeyed(prefix, field string, keys []string, kind columnKind) {
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	keyed := make(map[string]bool, len(sorted))
+	names := make(map[string]bool, len(sorted))
+	for _, key := range sorted {
+		name := prefix + columnName(key)
+		if keyed[key] || names[name] {
+			continue
+		}
+		keyed[key] = true
+		names[name] = true
+		s.columns = append(s.columns, fileColumn{name: name, field: field, key: key, kind: kind})
+	}
+	s.keyed[field] = keyed
+	s.columns = append(s.columns, fileColumn{name: field + "_other", field: field, kind: columnJSON})
+}
+
+func (s *fileSchema) names() []string {
+	names := make([]string, len(s.columns))
+	for i, col := range s.columns {
+		names[i] = col.name
+	}
+	return names
+}
+
+// columnName lowercases key and replaces anything but letters, digits and
+// underscores so custom type names stay usable as column names.
+func columnName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		default:
+			return '_'
+		}
+	}, key)
+}
+
+// flatten decodes the JSON encoding of a file record into one value per
+// column: string, int64 or bool, or nil when the record has no value.
+func (s *fileSchema) flatten(data []byte) ([]any, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	maps := make(map[string]map[string]json.RawMessage, len(s.keyed))
+	for field := range s.keyed {
+		if raw, ok := fields[field]; ok {
+			var m map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &m); err != nil {
+				return nil, err
+			}
+			maps[field] = m
+		}
+	}
+
+	values := make([]any, len(s.columns))
+	for i, col := range s.columns {
+		var raw json.RawMessage
+		switch {
+		case col.key != "":
+			raw = maps[col.field][col.key]
+		case s.keyed[col.field] != nil:
+			other, err := s.otherKeys(col.field, maps[col.field])
+			if err != nil {
+				return nil, err
+			}
+			raw = other
+		default:
+			raw = fields[col.field]
+		}
+		value, err := columnValue(col.kind, raw)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// otherKeys encodes the entries of a map field that have no column of their
+// own, or returns nil when there are none.
+func (s *fileSchema) otherKeys(field string, m map[string]json.RawMessage) (json.RawMessage, error) {
+	var other map[string]json.RawMessage
+	for key, raw := range m {
+		if !s.keyed[field][key] {
+			if other == nil {
+				other = make(map[string]json.RawMessage)
+			}
+			other[key] = raw
+		}
+	}
+	if other == nil {
+		return nil, nil
+	}
+	return json.Marshal(other)
+}
+
+func columnValue(kind columnKind, raw json.RawMessage) (any, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	switch kind {
+	case columnString:
+		var v string
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case columnInt:
+		var v int64
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	case columnBool:
+		var v bool
+		err := json.Unmarshal(raw, &v)
+		return v, err
+	default:
+		return string(raw), nil
+	}
+}
@@ -0,0 +1,144 @@
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"safnari/config"
+	"safnari/systeminfo"
+)
+
+func readCSV(t *testing.T, path string) []map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open csv: %v", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) == 0 {
+		t.Fatalf("csv %s has no header", path)
+	}
+	var out []map[string]string
+	for _, row := range rows[1:] {
+		record := make(map[string]string, len(row))
+		for i, name := range rows[0] {
+			record[name] = row[i]
+		}
+		out = append(out, record)
+	}
+	return out
+}
+
+func TestCSVOutputFlattensFileRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.csv")
+	cfg := &config.Config{OutputFileName: path, OutputFormat: "csv", HashAlgorithms: []string{"sha256", "md5"}}
+	sysInfo := &systeminfo.SystemInfo{RunningProcesses: []systeminfo.ProcessInfo{{PID: 1, Name: "init"}}}
+	w, err := NewWithColumns(cfg, sysInfo, &Metrics{}, FileColumns{SensitiveTypes: []string{"email", "Custom-ID"}})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	record := map[string]any{
+		"path":                        "/srv/app/.env",
+		"size":                        120,
+		"hashes":                      map[string]string{"sha256": "abc123", "md5": "def456", "blake3": "fff"},
+		"sensitive_data_match_counts": map[string]int{"email": 2, "Custom-ID": 1, "ssn": 3},
+		"sensitive_data_truncated":    true,
+		"metadata":                    map[string]any{"owner_app": "demo, \"quoted\""},
+	}
+	if err := w.WriteData(record); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.WriteData(map[string]any{"path": "/srv/app/empty"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	rows := readCSV(t, path)
+	if len(rows) != 2 {
+		t.Fatalf("expected one row per file record, got %d", len(rows))
+	}
+	got := rows[0]
+	want := map[string]string{
+		"path":                              "/srv/app/.env",
+		"size":                              "120",
+		"hash_md5":                          "def456",
+		"hash_sha256":                       "abc123",
+		"hashes_other":                      `{"blake3":"fff"}`,
+		"sensitive_count_email":             "2",
+		"sensitive_count_custom_id":         "1",
+		"sensitive_data_match_counts_other": `{"ssn":3}`,
+		"sensitive_data_truncated":          "true",
+		"metadata":                          `{"owner_app":"demo, \"quoted\""}`,
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Fatalf("column %s = %q, want %q", name, got[name], value)
+		}
+	}
+	if empty := rows[1]; empty["size"] != "" || empty["hash_md5"] != "" || empty["hashes_other"] != "" || empty["sensitive_data_truncated"] != "" {
+		t.Fatalf("expected empty cells for missing values, got %v", empty)
+	}
+}
+
+func TestColumnarOutputRotation(t *testing.T) {
+	for _, format := range []string{"csv", "parquet"} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := &config.Config{
+				OutputFileName:    filepath.Join(dir, "out."+format),
+				OutputFormat:      format,
+				MaxOutputFileSize: 400,
+				HashAlgorithms:    []string{"sha256"},
+				IncludeDataTypes:  []string{"email"},
+			}
+			w, err := New(cfg, &systeminfo.SystemInfo{}, &Metrics{})
+			if err != nil {
+				t.Fatalf("init: %v", err)
+			}
+			large := strings.Repeat("a", 300)
+			for i := 0; i < 5; i++ {
+				if err := w.WriteData(map[string]any{"path": large, "hashes": map[string]string{"sha256": "abc"}}); err != nil {
+					t.Fatalf("write %d: %v", i, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+
+			files, err := filepath.Glob(filepath.Join(dir, "out*."+format))
+			if err != nil || len(files) < 3 {
+				t.Fatalf("expected rotated %s files, got %v (%v)", format, files, err)
+			}
+			rows := 0
+			for _, name := range files {
+				if format == "csv" {
+					rows += len(readCSV(t, name))
+					continue
+				}
+				data, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatalf("read %s: %v", name, err)
+				}
+				if !bytes.HasPrefix(data, []byte("PAR1")) || !bytes.HasSuffix(data, []byte("PAR1")) {
+					t.Fatalf("%s is not a complete parquet file", name)
+				}
+				if !bytes.Contains(data, []byte("sensitive_count_email")) || !bytes.Contains(data, []byte("hash_sha256")) {
+					t.Fatalf("%s footer is missing flattened columns", name)
+				}
+			}
+			if format == "csv" && rows != 5 {
+				t.Fatalf("expected 5 rows across rotated files, got %d", rows)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package output
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"strconv"
+)
+
+// csvSink writes one row per file record under a header of the flattened
+// file schema. Other record types have no rows in csv output.
+type csvSink struct {
+	file    *outputFile
+	buf     *bufio.Writer
+	counter *countingWriter
+	csv     *csv.Writer
+	schema  *fileSchema
+	row     []string
+}
+
+// countingWriter counts the bytes the csv encoder produces for a row.
+type countingWriter struct {
+	w *bufio.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+func newCSVSink(f *outputFile, schema *fileSchema) (*csvSink, error) {
+	buf := bufio.NewWriterSize(f, 1024*1024)
+	counter := &countingWriter{w: buf}
+	s := &csvSink{
+		file:    f,
+		buf:     buf,
+		counter: counter,
+		csv:     csv.NewWriter(counter),
+		schema:  schema,
+		row:     make([]string, len(schema.columns)),
+	}
+	if err := s.write(schema.names()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *csvSink) WriteRecord(recordType string, payload any) (int, error) {
+	if recordType != "file" {
+		return 0, nil
+	}
+	data, err := jsonMarshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	values, err := s.schema.flatten(data)
+	if err != nil {
+		return 0, err
+	}
+	for i, value := range values {
+		switch v := value.(type) {
+		case nil:
+			s.row[i] = ""
+		case string:
+			s.row[i] = v
+		case int64:
+			s.row[i] = strconv.FormatInt(v, 10)
+		case bool:
+			s.row[i] = strconv.FormatBool(v)
+		}
+	}
+	start := s.counter.n
+	err = s.write(s.row)
+	return s.counter.n - start, err
+}
+
+// write encodes one row straight through to the file buffer so the reported
+// size covers it.
+func (s *csvSink) write(row []string) error {
+	if err := s.csv.Write(row); err != nil {
+		return err
+	}
+	s.csv.Flush()
+	return s.csv.Error()
+}
+
+func (s *csvSink) Flush() error {
+	return s.buf.Flush()
+}
+
+func (s *csvSink) Close() error {
+	return errors.Join(s.buf.Flush(), s.file.Close())
+}
@@ -0,0 +1,113 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"filippo.io/age"
+)
+
+// encryptedExt is appended to each output file name when output is encrypted.
+const encryptedExt = ".age"
+
+func parseRecipients(keys []string) ([]age.Recipient, error) {
+	recipients := make([]age.Recipient, 0, len(keys))
+	for _, key := range keys {
+		recipient, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption recipient %q: %w", key, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// outputFile is a private, symlink-refusing output file. With recipients,
+// everything written is streamed through age encryption, so plaintext never
+// reaches the disk. A digest, when given, hashes the bytes as they reach the
+// file.
+type outputFile struct {
+	file *os.File
+	w    io.Writer
+	enc  io.WriteCloser
+}
+
+func openOutputFile(name string, recipients []age.Recipient, digest hash.Hash) (*outputFile, error) {
+	f, err := openPrivateFileNoSymlink(name)
+	if err != nil {
+		return nil, err
+	}
+	var disk io.Writer = f
+	if digest != nil {
+		disk = io.MultiWriter(f, digest)
+	}
+	out := &outputFile{file: f, w: disk}
+	if len(recipients) > 0 {
+		enc, err := age.Encrypt(disk, recipients...)
+		if err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("start output encryption: %w", err)
+		}
+		out.w = enc
+		out.enc = enc
+	}
+	return out, nil
+}
+
+func (f *outputFile) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+// Close finishes the encrypted stream, then syncs and closes the file.
+func (f *outputFile) Close() error {
+	var closeErr error
+	if f.enc != nil {
+		if err := f.enc.Close(); err != nil {
+			closeErr = errors.Join(closeErr, fmt.Errorf("finish output encryption: %w", err))
+		}
+	}
+	if err := f.file.Sync(); err != nil {
+		closeErr = errors.Join(closeErr, err)
+	}
+	if err := f.file.Close(); err != nil {
+		closeErr = errors.Join(closeErr, err)
+	}
+	return closeErr
+}
+
+// DecryptFile decrypts the encrypted output file src into dst, which is
+// created with the same private, symlink-refusing open as scan output. dst
+// is removed again if src fails to decrypt or authenticate.
+func DecryptFile(dst, src string, identities []age.Identity) error {
+	out, err := openOutputFile(dst, nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := DecryptTo(out, src, identities); err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// DecryptTo decrypts the encrypted output file src and writes the plaintext
+// to w.
+func DecryptTo(w io.Writer, src string, identities []age.Identity) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, err := age.Decrypt(in, identities...)
+	if err != nil {
+		return fmt.Errorf("decrypt %s: %w", src, err)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("decrypt %s: %w", src, err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package output
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"safnari/config"
+	"safnari/systeminfo"
+)
+
+func TestEncryptedOutputRotatesAndDecrypts(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	dir := t.TempDir()
+	cfg := &config.Config{
+		OutputFileName:    filepath.Join(dir, "out.ndjson.age"),
+		OutputFormat:      "json",
+		MaxOutputFileSize: 200,
+		EncryptRecipients: []string{identity.Recipient().String()},
+	}
+	w, err := New(cfg, &systeminfo.SystemInfo{}, &Metrics{})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	large := strings.Repeat("a", 150)
+	for i := 0; i < 5; i++ {
+		if err := w.WriteData(map[string]any{"data": large}); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "out*.ndjson.age"))
+	if err != nil || len(files) < 2 {
+		t.Fatalf("expected rotated encrypted files, got %v (%v)", files, err)
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if bytes.Contains(data, []byte(large)) {
+			t.Fatalf("%s holds plaintext", name)
+		}
+		if runtime.GOOS != "windows" {
+			info, err := os.Stat(name)
+			if err != nil {
+				t.Fatalf("stat %s: %v", name, err)
+			}
+			if perm := info.Mode().Perm(); perm != 0600 {
+				t.Fatalf("%s permissions = %o, want 600", name, perm)
+			}
+		}
+		if err := DecryptFile(strings.TrimSuffix(name, encryptedExt), name, []age.Identity{identity}); err != nil {
+			t.Fatalf("decrypt %s: %v", name, err)
+		}
+	}
+
+	records := readRotatedNDJSONRecords(t, filepath.Join(dir, "out.ndjson"))
+	if got := countRecordType(records, "file"); got != 5 {
+		t.Fatalf("expected 5 decrypted file records, got %d", got)
+	}
+	if records[len(records)-1].RecordType != "metrics" {
+		t.Fatalf("expected metrics record last, got %q", records[len(records)-1].RecordType)
+	}
+
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	dst := filepath.Join(dir, "wrong.ndjson")
+	if err := DecryptFile(dst, files[0], []age.Identity{other}); err == nil {
+		t.Fatal("expected decryption with the wrong identity to fail")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatalf("expected failed decryption to leave no plaintext file, got %v", err)
+	}
+}
+
+func TestEncryptedOutputRejectsSymlinkTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlink creation requires elevated privileges on many Windows systems")
+	}
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim.txt")
+	if err := os.WriteFile(victim, []byte("keep"), 0600); err != nil {
+		t.Fatalf("write victim: %v", err)
+	}
+	link := filepath.Join(dir, "out.ndjson.age")
+	if err := os.Symlink(victim, link); err != nil {
+		t.Skipf("symlink unavailable: %v", err)
+	}
+
+	cfg := &config.Config{OutputFileName: link, OutputFormat: "json", EncryptRecipients: []string{identity.Recipient().String()}}
+	if _, err := New(cfg, &systeminfo.SystemInfo{}, &Metrics{}); err == nil {
+		t.Fatal("expected symlink output target to be rejected")
+	}
+	if err := DecryptFile(link, victim, []age.Identity{identity}); err == nil {
+		t.Fatal("expected symlink decrypt target to be rejected")
+	}
+	data, err := os.ReadFile(victim)
+	if err != nil {
+		t.Fatalf("read victim: %v", err)
+	}
+	if string(data) != "keep" {
+		t.Fatalf("victim was modified: %q", string(data))
+	}
+}
@@ -0,0 +1,157 @@
+package output
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"time"
+)
+
+const (
+	manifestVersion = 1
+	// ManifestSuffix is appended to the output base name to name the manifest
+	// of a signed scan.
+	ManifestSuffix = ".manifest.json"
+)
+
+// recordChain links NDJSON records into a hash chain. Every record carries
+// its sequence number and the SHA-256 digest of the previous record's line,
+// across rotated files, so any edit, removal or reordering breaks the chain.
+type recordChain struct {
+	seq  uint64
+	last string
+
+	// The segment being written, i.e. the current output file.
+	digest  hash.Hash
+	segment manifestSegment
+}
+
+// startSegment begins a new output file whose bytes, as written to disk,
+// are hashed into the returned digest.
+func (c *recordChain) startSegment(file string) hash.Hash {
+	c.digest = sha256.New()
+	c.segment = manifestSegment{File: file}
+	return c.digest
+}
+
+// link stamps record with the next sequence number and the previous digest.
+func (c *recordChain) link(record *ndjsonRecord) {
+	record.Seq = c.seq + 1
+	record.PrevDigest = c.last
+}
+
+// append records line, the encoding of the record last passed to link.
+func (c *recordChain) append(line []byte) {
+	sum := sha256.Sum256(line)
+	c.seq++
+	c.last = hex.EncodeToString(sum[:])
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	if c.segment.Records == 0 {
+		c.segment.FirstSeq = c.seq
+		c.segment.FirstRecordAt = now
+	}
+	c.segment.Records++
+	c.segment.LastSeq = c.seq
+	c.segment.LastDigest = c.last
+	c.segment.LastRecordAt = now
+}
+
+// finishSegment returns the closed output file's manifest entry.
+func (c *recordChain) finishSegment() manifestSegment {
+	segment := c.segment
+	segment.SHA256 = hex.EncodeToString(c.digest.Sum(nil))
+	return segment
+}
+
+// manifest lists the output files of a signed scan in order. It is rewritten
+// each time a file is closed and marked complete once the writer closes.
+type manifest struct {
+	ManifestVersion int               `json:"manifest_version"`
+	SchemaVersion   string            `json:"schema_version"`
+	Complete        bool              `json:"complete"`
+	Records         uint64            `json:"records"`
+	LastDigest      string            `json:"last_digest"`
+	Segments        []manifestSegment `json:"segments"`
+	PublicKey       string            `json:"public_key"`
+	Signature       string            `json:"signature,omitempty"`
+}
+
+// manifestSegment describes one output file. SHA256 covers the file as
+// written, so it is the digest of the ciphertext when output is encrypted.
+type manifestSegment struct {
+	File          string `json:"file"`
+	SHA256        string `json:"sha256"`
+	Records       uint64 `json:"records"`
+	FirstSeq      uint64 `json:"first_seq,omitempty"`
+	LastSeq       uint64 `json:"last_seq,omitempty"`
+	LastDigest    string `json:"last_digest,omitempty"`
+	FirstRecordAt string `json:"first_record_at,omitempty"`
+	LastRecordAt  string `json:"last_record_at,omitempty"`
+}
+
+// signingPayload is the encoding the signature covers: the manifest without
+// its signature, always encoded with encoding/json so signer and verifier
+// agree byte for byte.
+func (m manifest) signingPayload() ([]byte, error) {
+	m.Signature = ""
+	return json.Marshal(m)
+}
+
+func (m *manifest) sign(key ed25519.PrivateKey) error {
+	m.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	payload, err := m.signingPayload()
+	if err != nil {
+		return err
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	return nil
+}
+
+func (m manifest) verifySignature(key ed25519.PublicKey) bool {
+	if len(key) != ed25519.PublicKeySize {
+		return false
+	}
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil {
+		return false
+	}
+	payload, err := m.signingPayload()
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(key, payload, signature)
+}
+
+// writeManifest signs m and replaces the manifest file at path. The new
+// manifest is written to a private temporary file first, so a crash never
+// leaves a half-written manifest behind.
+func writeManifest(path string, m *manifest, key ed25519.PrivateKey) error {
+	if err := m.sign(key); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := openPrivateFileNoSymlink(tmp)
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	_, err = f.Write(append(data, '\n'))
+	err = errors.Join(err, f.Sync(), f.Close())
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package output
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	"safnari/config"
+	"safnari/systeminfo"
+)
+
+// writeSignedScan writes a signed scan of a system info record, five file
+// records and metrics into dir, rotated into several segments, and returns
+// the manifest path and public key.
+func writeSignedScan(t *testing.T, dir string, recipients ...string) (string, ed25519.PublicKey) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	cfg := &config.Config{
+		OutputFileName:    filepath.Join(dir, "out.ndjson"),
+		OutputFormat:      "json",
+		MaxOutputFileSize: 200,
+		SignKey:           private,
+		EncryptRecipients: recipients,
+	}
+	w, err := New(cfg, &systeminfo.SystemInfo{}, &Metrics{})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := w.WriteData(map[string]any{"path": strings.Repeat("a", 150), "n": i}); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return filepath.Join(dir, "out"+ManifestSuffix), public
+}
+
+func readManifest(t *testing.T, path string) manifest {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("parse manifest: %v", err)
+	}
+	return m
+}
+
+func TestSignedOutputChainsRecordsAndVerifies(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath, public := writeSignedScan(t, dir)
+
+	m := readManifest(t, manifestPath)
+	if !m.Complete || len(m.Segments) < 3 || m.Records != 7 {
+		t.Fatalf("unexpected manifest: complete=%t segments=%d records=%d", m.Complete, len(m.Segments), m.Records)
+	}
+	if m.Segments[0].File != "out.ndjson" || m.Segments[1].File != "out.1.ndjson" {
+		t.Fatalf("unexpected segment order: %+v", m.Segments)
+	}
+	records := readRotatedNDJSONRecords(t, filepath.Join(dir, "out.ndjson"))
+	if len(records) != 7 || records[len(records)-1].RecordType != "metrics" {
+		t.Fatalf("expected system info, 5 file records and metrics, got %d records", len(records))
+	}
+
+	report, err := VerifyManifest(manifestPath, public, nil)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() || report.Records != 7 || report.Segments != len(m.Segments) {
+		t.Fatalf("expected clean verification, got %+v", report)
+	}
+
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	report, err = VerifyManifest(manifestPath, other, nil)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	expectProblem(t, report, "manifest signature does not verify")
+}
+
+func TestVerifyStopsAtForgedManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifestPath, public := writeSignedScan(t, dir)
+	m := readManifest(t, manifestPath)
+	m.Records = 1 << 62
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("marshal manifest: %v", err)
+	}
+	if err := os.WriteFile(manifestPath, data, 0600); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	report, err := VerifyManifest(manifestPath, public, nil)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(report.Problems) != 1 || report.Records != 0 {
+		t.Fatalf("expected only the signature problem and no records read, got %+v", report)
+	}
+	expectProblem(t, report, "manifest signature does not verify")
+}
+
+func expectProblem(t *testing.T, report *VerifyReport, want string) {
+	t.Helper()
+	for _, problem := range report.Problems {
+		if strings.Contains(problem, want) {
+			return
+		}
+	}
+	t.Fatalf("expected a problem containing %q, got %q", want, report.Problems)
+}
+
+// editLines rewrites the lines of an NDJSON segment.
+func editLines(t *testing.T, path string, edit func([][]byte) [][]byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	var out []byte
+	for _, line := range edit(lines) {
+		out = append(append(out, line...), '\n')
+	}
+	if err := os.WriteFile(path, out, 0600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+func TestVerifyReportsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, dir string)
+		want   []string
+		absent []string
+	}{
+		{
+			name: "altered record",
+			tamper: func(t *testing.T, dir string) {
+				editLines(t, filepath.Join(dir, "out.ndjson"), func(lines [][]byte) [][]byte {
+					lines[1] = bytes.Replace(lines[1], []byte(`"n":0`), []byte(`"n":9`), 1)
+					return lines
+				})
+			},
+			want: []string{"record 2 (out.ndjson line 2) is altered", "segment out.ndjson does not match its manifest digest"},
+		},
+		{
+			name: "reordered records",
+			tamper: func(t *testing.T, dir string) {
+				first, err := os.ReadFile(filepath.Join(dir, "out.ndjson"))
+				if err != nil {
+					t.Fatalf("read: %v", err)
+				}
+				second, err := os.ReadFile(filepath.Join(dir, "out.1.ndjson"))
+				if err != nil {
+					t.Fatalf("read: %v", err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "out.ndjson"), second, 0600); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, "out.1.ndjson"), first, 0600); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+			},
+			want:   []string{"is out of order"},
+			absent: []string{"missing", "altered"},
+		},
+		{
+			name: "duplicated record",
+			tamper: func(t *testing.T, dir string) {
+				editLines(t, filepath.Join(dir, "out.ndjson"), func(lines [][]byte) [][]byte {
+					return append(lines, lines[1])
+				})
+			},
+			want:   []string{"record 2 (out.ndjson line 3) appears more than once"},
+			absent: []string{"missing", "altered"},
+		},
+		{
+			name: "removed record",
+			tamper: func(t *testing.T, dir string) {
+				editLines(t, filepath.Join(dir, "out.1.ndjson"), func(lines [][]byte) [][]byte {
+					return lines[1:]
+				})
+			},
+			want: []string{"record 3 is missing", "segment out.1.ndjson holds 0 records, the manifest lists 1"},
+		},
+		{
+			name: "missing segment",
+			tamper: func(t *testing.T, dir string) {
+				if err := os.Remove(filepath.Join(dir, "out.2.ndjson")); err != nil {
+					t.Fatalf("remove: %v", err)
+				}
+			},
+			want: []string{"segment out.2.ndjson is missing (records 4-4)", "record 4 is missing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			manifestPath, public := writeSignedScan(t, dir)
+			tt.tamper(t, dir)
+			report, err := VerifyManifest(manifestPath, public, nil)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			for _, want := range tt.want {
+				expectProblem(t, report, want)
+			}
+			for _, problem := range report.Problems {
+				for _, absent := range tt.absent {
+					if strings.Contains(problem, absent) {
+						t.Fatalf("unexpected problem %q", problem)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyEncryptedSignedOutput(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("generate identity: %v", err)
+	}
+	dir := t.TempDir()
+	manifestPath, public := writeSignedScan(t, dir, identity.Recipient().String())
+	m := readManifest(t, manifestPath)
+	if m.Segments[0].File != "out.ndjson.age" {
+		t.Fatalf("expected encrypted segment names, got %q", m.Segments[0].File)
+	}
+
+	report, err := VerifyManifest(manifestPath, public, []age.Identity{identity})
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() || report.Records != 7 || len(report.Unchecked) != 0 {
+		t.Fatalf("expected clean verification, got %+v", report)
+	}
+
+	report, err = VerifyManifest(manifestPath, public, nil)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() || report.Records != 0 || len(report.Unchecked) != len(m.Segments) {
+		t.Fatalf("expected digest-only verification without an identity, got %+v", report)
+	}
+}
@@ -171,12 +171,20 @@ func sanitizePayload(recordType string, payload interface{}, policy otelPolicy)
 		sanitized := cloneMap(data)
 		if !policy.includePaths {
 			delete(sanitized, "path")
+			if ref, ok := sanitized["container"].(map[string]interface{}); ok {
+				ref = cloneMap(ref)
+				delete(ref, "path")
+				sanitized["container"] = ref
+			}
 		}
 		if !policy.includeSensitive {
 			delete(sanitized, "sensitive_data")
 			delete(sanitized, "sensitive_data_match_counts")
+			delete(sanitized, "sensitive_data_confidence")
 			delete(sanitized, "sensitive_data_truncated")
+			delete(sanitized, "sensitive_locations")
 			delete(sanitized, "search_hits")
+			delete(sanitized, "search_locations")
 			delete(sanitized, "metadata")
 			delete(sanitized, "xattrs")
 			delete(sanitized, "acl")
@@ -190,6 +198,13 @@ func sanitizePayload(recordType string, payload interface{}, policy otelPolicy)
 		}
 		if !policy.includePaths {
 			delete(sanitized, "exe")
+			delete(sanitized, "cwd")
+			delete(sanitized, "open_files")
+			delete(sanitized, "mapped_libraries")
+		}
+		if !policy.includeSensitive {
+			delete(sanitized, "sockets")
+			delete(sanitized, "environment")
 		}
 		return sanitized
 	case "system_info":
@@ -376,6 +391,18 @@ func fileSemanticAttributes(data map[string]interface{}, policy otelPolicy) []ot
 	kvs = appendStringAttr(kvs, "safnari.file.permissions", getStringField(data, "permissions"))
 	kvs = appendStringAttr(kvs, "safnari.file.owner", getStringField(data, "owner"))
 	kvs = appendStringAttr(kvs, "safnari.file.id", getStringField(data, "file_id"))
+	if ref, ok := data["container"].(map[string]interface{}); ok {
+		kvs = appendStringAttr(kvs, string(semconv.ContainerRuntimeNameKey), getStringField(ref, "runtime"))
+		kvs = appendStringAttr(kvs, string(semconv.ContainerIDKey), getStringField(ref, "id"))
+		kvs = appendStringAttr(kvs, string(semconv.ContainerNameKey), getStringField(ref, "name"))
+		kvs = appendStringAttr(kvs, string(semconv.ContainerImageNameKey), getStringField(ref, "image"))
+		kvs = appendStringAttr(kvs, string(semconv.ContainerImageIDKey), getStringField(ref, "image_id"))
+		kvs = appendStringAttr(kvs, "safnari.file.container.image_digest", getStringField(ref, "image_digest"))
+		kvs = appendStringAttr(kvs, "safnari.file.container.layer_digest", getStringField(ref, "layer_digest"))
+		if policy.includePaths {
+			kvs = appendStringAttr(kvs, "safnari.file.container.path", getStringField(ref, "path"))
+		}
+	}
 
 	if attrs := getStringSliceField(data, "attributes"); len(attrs) > 0 {
 		values := make([]otelLog.Value, 0, len(attrs))
@@ -442,6 +469,11 @@ func processSemanticAttributes(data map[string]interface{}, policy otelPolicy) [
 	}
 	kvs = appendStringAttr(kvs, string(semconv.ProcessOwnerKey), getStringField(data, "username"))
 	kvs = appendStringAttr(kvs, string(semconv.ProcessCreationTimeKey), getStringField(data, "start_time"))
+	kvs = appendStringAttr(kvs, string(semconv.ContainerIDKey), getStringField(data, "container_id"))
+	kvs = appendStringAttr(kvs, "safnari.process.sha256", getStringField(data, "sha256"))
+	if policy.includePaths {
+		kvs = appendStringAttr(kvs, string(semconv.ProcessWorkingDirectoryKey), getStringField(data, "cwd"))
+	}
 
 	if cpu, ok := getFloat64Field(data, "cpu_percent"); ok {
 		kvs = append(kvs, otelLog.Float64("safnari.process.cpu_percent", cpu))
@@ -592,27 +624,43 @@ func payloadToMap(payload interface{}) map[string]interface{} {
 			return nil
 		}
 		return map[string]interface{}{
-			"pid":            v.PID,
-			"ppid":           v.PPID,
-			"name":           v.Name,
-			"cpu_percent":    v.CPUPercent,
-			"memory_percent": v.MemoryPercent,
-			"cmdline":        v.Cmdline,
-			"username":       v.Username,
-			"exe":            v.Exe,
-			"start_time":     v.StartTime,
+			"pid":              v.PID,
+			"ppid":             v.PPID,
+			"name":             v.Name,
+			"cpu_percent":      v.CPUPercent,
+			"memory_percent":   v.MemoryPercent,
+			"cmdline":          v.Cmdline,
+			"username":         v.Username,
+			"exe":              v.Exe,
+			"start_time":       v.StartTime,
+			"sha256":           v.SHA256,
+			"cwd":              v.Cwd,
+			"open_files":       v.OpenFiles,
+			"mapped_libraries": v.MappedLibraries,
+			"sockets":          recordValues(v.Sockets),
+			"environment":      v.Environment,
+			"cgroup":           v.Cgroup,
+			"container_id":     v.ContainerID,
 		}
 	case systeminfo.ProcessInfo:
 		return map[string]interface{}{
-			"pid":            v.PID,
-			"ppid":           v.PPID,
-			"name":           v.Name,
-			"cpu_percent":    v.CPUPercent,
-			"memory_percent": v.MemoryPercent,
-			"cmdline":        v.Cmdline,
-			"username":       v.Username,
-			"exe":            v.Exe,
-			"start_time":     v.StartTime,
+			"pid":              v.PID,
+			"ppid":             v.PPID,
+			"name":             v.Name,
+			"cpu_percent":      v.CPUPercent,
+			"memory_percent":   v.MemoryPercent,
+			"cmdline":          v.Cmdline,
+			"username":         v.Username,
+			"exe":              v.Exe,
+			"start_time":       v.StartTime,
+			"sha256":           v.SHA256,
+			"cwd":              v.Cwd,
+			"open_files":       v.OpenFiles,
+			"mapped_libraries": v.MappedLibraries,
+			"sockets":          recordValues(v.Sockets),
+			"environment":      v.Environment,
+			"cgroup":           v.Cgroup,
+			"container_id":     v.ContainerID,
 		}
 	case *systeminfo.SystemInfo:
 		if v == nil {
@@ -620,32 +668,32 @@ func payloadToMap(payload interface{}) map[string]interface{} {
 		}
 		return map[string]interface{}{
 			"os_version":              v.OSVersion,
-			"installed_patches":       v.InstalledPatches,
+			"installed_patches":       recordValues(v.InstalledPatches),
 			"running_processes":       v.RunningProcesses,
-			"startup_programs":        v.StartupPrograms,
-			"installed_apps":          v.InstalledApps,
+			"startup_programs":        recordValues(v.StartupPrograms),
+			"installed_apps":          recordValues(v.InstalledApps),
 			"network_interfaces":      v.NetworkInterfaces,
 			"open_connections":        v.OpenConnections,
 			"running_services":        v.RunningServices,
-			"users":                   v.Users,
-			"groups":                  v.Groups,
-			"admins":                  v.Admins,
+			"users":                   recordValues(v.Users),
+			"groups":                  recordValues(v.Groups),
+			"admins":                  recordValues(v.Admins),
 			"scheduled_tasks":         v.ScheduledTasks,
 			"running_processes_count": len(v.RunningProcesses),
 		}
 	case systeminfo.SystemInfo:
 		return map[string]interface{}{
 			"os_version":              v.OSVersion,
-			"installed_patches":       v.InstalledPatches,
+			"installed_patches":       recordValues(v.InstalledPatches),
 			"running_processes":       v.RunningProcesses,
-			"startup_programs":        v.StartupPrograms,
-			"installed_apps":          v.InstalledApps,
+			"startup_programs":        recordValues(v.StartupPrograms),
+			"installed_apps":          recordValues(v.InstalledApps),
 			"network_interfaces":      v.NetworkInterfaces,
 			"open_connections":        v.OpenConnections,
 			"running_services":        v.RunningServices,
-			"users":                   v.Users,
-			"groups":                  v.Groups,
-			"admins":                  v.Admins,
+			"users":                   recordValues(v.Users),
+			"groups":                  recordValues(v.Groups),
+			"admins":                  recordValues(v.Admins),
 			"scheduled_tasks":         v.ScheduledTasks,
 			"running_processes_count": len(v.RunningProcesses),
 		}
@@ -662,6 +710,20 @@ func payloadToMap(payload interface{}) map[string]interface{} {
 	}
 }
 
+// recordValues lists typed system info records as maps so they are counted
+// and exported like untyped slices.
+func recordValues(records interface{}) []interface{} {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil
+	}
+	var values []interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil
+	}
+	return values
+}
+
 func getFieldValue(values map[string]interface{}, key string) interface{} {
 	if values == nil {
 		return nil
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"safnari/config"
+	"safnari/systeminfo"
 
 	otelLog "go.opentelemetry.io/otel/log"
 	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
@@ -63,6 +64,7 @@ func TestSanitizePayloadFileAndProcess(t *testing.T) {
 		"acl":                    "private-acl",
 		"alternate_data_streams": []string{"secret"},
 		"name":                   "secret.txt",
+		"container":              map[string]interface{}{"id": "c0ffee", "path": "/tmp/secret.txt"},
 	}
 	fileSanitized, ok := sanitizePayload("file", filePayload, otelPolicy{}).(map[string]interface{})
 	if !ok {
@@ -82,15 +84,26 @@ func TestSanitizePayloadFileAndProcess(t *testing.T) {
 			t.Fatalf("expected %s to be stripped", key)
 		}
 	}
+	if ref := fileSanitized["container"].(map[string]interface{}); ref["id"] != "c0ffee" || ref["path"] != nil {
+		t.Fatalf("expected container path to be stripped and its ID kept, got %#v", ref)
+	}
 	if _, ok := filePayload["path"]; !ok {
 		t.Fatal("expected original file payload to remain unchanged")
 	}
-
-	processPayload := map[string]interface{}{
-		"name":    "proc",
-		"exe":     "/usr/bin/proc",
-		"cmdline": "proc --secret",
+	if _, ok := filePayload["container"].(map[string]interface{})["path"]; !ok {
+		t.Fatal("expected original container reference to remain unchanged")
 	}
+
+	processPayload := payloadToMap(systeminfo.ProcessInfo{
+		Name:        "proc",
+		Exe:         "/usr/bin/proc",
+		Cmdline:     "proc --secret",
+		Cwd:         "/srv/app",
+		OpenFiles:   []string{"/srv/app/.env"},
+		Sockets:     []systeminfo.ConnectionInfo{{LocalAddr: "10.0.0.5:41000", RemoteAddr: "203.0.113.9:443", Status: "ESTABLISHED", PID: 7}},
+		Environment: []string{"HOME=/root"},
+		SHA256:      "abc123",
+	})
 	processSanitized, ok := sanitizePayload("process", processPayload, otelPolicy{}).(map[string]interface{})
 	if !ok {
 		t.Fatalf("expected sanitized process payload map")
@@ -101,6 +114,19 @@ func TestSanitizePayloadFileAndProcess(t *testing.T) {
 	if _, ok := processSanitized["cmdline"]; ok {
 		t.Fatal("expected cmdline to be stripped")
 	}
+	for _, key := range []string{"cwd", "open_files", "sockets", "environment"} {
+		if _, ok := processSanitized[key]; ok {
+			t.Fatalf("expected %s to be stripped", key)
+		}
+	}
+	if processSanitized["sha256"] != "abc123" {
+		t.Fatalf("expected executable hash to be kept, got %#v", processSanitized["sha256"])
+	}
+	full := sanitizePayload("process", processPayload, otelPolicy{includePaths: true, includeSensitive: true}).(map[string]interface{})
+	sockets, ok := full["sockets"].([]interface{})
+	if !ok || len(sockets) != 1 || sockets[0].(map[string]interface{})["remote_addr"] != "203.0.113.9:443" {
+		t.Fatalf("expected sockets to convert to record values, got %#v", full["sockets"])
+	}
 }
 
 func TestSanitizePayloadSystemInfo(t *testing.T) {
@@ -140,9 +166,16 @@ func TestSemanticAttributesFile(t *testing.T) {
 		"xattrs":         map[string]interface{}{"user.secret": "private"},
 		"acl":            "private-acl",
 		"sensitive_data": map[string]interface{}{"email": []string{"a@example.com"}},
+		"container":      map[string]interface{}{"runtime": "docker", "id": "c0ffee", "layer_digest": "sha256:aa", "path": "/report.txt"},
 	}
 
 	attrs := semanticAttributes("file", payload, otelPolicy{includePaths: true, includeSensitive: true})
+	if value, ok := findAttr(attrs, string(semconv.ContainerIDKey)); !ok || value.AsString() != "c0ffee" {
+		t.Fatalf("expected container id semantic attribute, got %#v", value)
+	}
+	if value, ok := findAttr(attrs, "safnari.file.container.layer_digest"); !ok || value.AsString() != "sha256:aa" {
+		t.Fatalf("expected layer digest attribute, got %#v", value)
+	}
 	if value, ok := findAttr(attrs, string(semconv.FilePathKey)); !ok || value.AsString() != "/tmp/dir/report.txt" {
 		t.Fatalf("expected file path semantic attribute, got %#v", value)
 	}
@@ -166,6 +199,9 @@ func TestSemanticAttributesFile(t *testing.T) {
 	if _, ok := findAttr(attrsNoPaths, string(semconv.FilePathKey)); ok {
 		t.Fatal("did not expect file path semantic attribute when paths are disabled")
 	}
+	if _, ok := findAttr(attrsNoPaths, "safnari.file.container.path"); ok {
+		t.Fatal("did not expect container path attribute when paths are disabled")
+	}
 	if _, ok := findAttr(attrsNoPaths, "safnari.file.sensitive_data"); ok {
 		t.Fatal("did not expect sensitive data semantic attribute when sensitive export is disabled")
 	}
@@ -220,6 +256,33 @@ func TestPayloadToMapFromStruct(t *testing.T) {
 	}
 }
 
+func TestSanitizePayloadSystemInfoPackages(t *testing.T) {
+	info := &systeminfo.SystemInfo{
+		InstalledApps: []systeminfo.PackageInfo{
+			{Name: "openssl", Version: "3.0.13-1", Architecture: "amd64", Source: "dpkg"},
+			{Name: "busybox", Source: "apk"},
+		},
+	}
+	sanitized, ok := sanitizePayload("system_info", info, otelPolicy{}).(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected sanitized system payload map")
+	}
+	if got := sanitized["installed_apps_count"]; got != 2 {
+		t.Fatalf("expected installed_apps_count=2, got %#v", got)
+	}
+	full := sanitizePayload("system_info", info, otelPolicy{includeSensitive: true})
+	if value := toLogValue(full); value.Kind() != otelLog.KindMap {
+		t.Fatalf("expected packages to convert to a map value, got %v", value.Kind())
+	}
+	apps := payloadToMap(info)["installed_apps"].([]interface{})
+	if first := apps[0].(map[string]interface{}); first["version"] != "3.0.13-1" || first["source"] != "dpkg" {
+		t.Fatalf("unexpected package value %#v", first)
+	}
+	if _, ok := apps[1].(map[string]interface{})["version"]; ok {
+		t.Fatal("expected empty version to be omitted")
+	}
+}
+
 func TestSemanticAttributesProcess(t *testing.T) {
 	payload := map[string]interface{}{
 		"pid":            int64(101),
@@ -231,6 +294,7 @@ func TestSemanticAttributesProcess(t *testing.T) {
 		"start_time":     "2026-02-18T00:00:00Z",
 		"cpu_percent":    12.5,
 		"memory_percent": 3.75,
+		"container_id":   "4f1c",
 	}
 
 	attrs := semanticAttributes("process", payload, otelPolicy{includePaths: true, includeCmdline: true})
@@ -246,6 +310,9 @@ func TestSemanticAttributesProcess(t *testing.T) {
 	if value, ok := findAttr(attrs, "safnari.process.cpu_percent"); !ok || value.AsFloat64() != 12.5 {
 		t.Fatalf("expected process cpu semantic attribute, got %#v", value)
 	}
+	if value, ok := findAttr(attrs, string(semconv.ContainerIDKey)); !ok || value.AsString() != "4f1c" {
+		t.Fatalf("expected container id semantic attribute, got %#v", value)
+	}
 
 	attrsNoPaths := semanticAttributes("process", payload, otelPolicy{})
 	if _, ok := findAttr(attrsNoPaths, string(semconv.ProcessExecutablePathKey)); ok {
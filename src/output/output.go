@@ -2,15 +2,17 @@ package output
 
 import (
 	"bufio"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
-	"os"
+	"hash"
 	"path/filepath"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"filippo.io/age"
+
 	"safnari/config"
 	"safnari/logger"
 	"safnari/systeminfo"
@@ -25,20 +27,37 @@ type Metrics struct {
 	TotalProcesses int    `json:"total_processes"`
 }
 
+// ScanConfig is the payload of the config record. It carries the settings
+// needed to interpret the file records, such as which key redacted them.
+type ScanConfig struct {
+	RedactSensitive string `json:"redact_sensitive"`
+	RedactKeyID     string `json:"redact_key_id,omitempty"`
+}
+
 type ndjsonRecord struct {
 	RecordType    string `json:"record_type"`
 	SchemaVersion string `json:"schema_version"`
+	Seq           uint64 `json:"seq,omitempty"`
+	PrevDigest    string `json:"prev_digest,omitempty"`
 	Payload       any    `json:"payload,omitempty"`
 }
 
 type writeRequest struct {
-	payload any
-	barrier chan struct{}
+	recordType string
+	payload    any
+	barrier    chan struct{}
+}
+
+// recordSink stores records in one output file. The writer rotates to a new
+// sink once the bytes it reports pass MaxOutputFileSize.
+type recordSink interface {
+	WriteRecord(recordType string, payload any) (int, error)
+	Flush() error
+	Close() error
 }
 
 type Writer struct {
-	file     *os.File
-	buf      *bufio.Writer
+	sink     recordSink
 	mu       sync.Mutex
 	closed   bool
 	writeErr error
@@ -46,9 +65,18 @@ type Writer struct {
 	cfg      *config.Config
 	sysInfo  *systeminfo.SystemInfo
 	otel     *otelLogger
-	base     string
-	ext      string
-	index    int
+	schema   *fileSchema
+	// recipients encrypt each output file when set.
+	recipients []age.Recipient
+	// chain, when set, hash-chains NDJSON records and keeps a signed
+	// manifest of the closed output files.
+	chain        *recordChain
+	signKey      ed25519.PrivateKey
+	manifest     manifest
+	manifestPath string
+	base         string
+	ext          string
+	index        int
 
 	queue     chan writeRequest
 	stopSends chan struct{}
@@ -75,25 +103,47 @@ var (
 )
 
 func New(cfg *config.Config, sysInfo *systeminfo.SystemInfo, m *Metrics) (*Writer, error) {
+	return NewWithColumns(cfg, sysInfo, m, FileColumns{})
+}
+
+// NewWithColumns is New with the map keys that csv and parquet output give
+// their own columns. Unset key lists are derived from cfg.
+func NewWithColumns(cfg *config.Config, sysInfo *systeminfo.SystemInfo, m *Metrics, cols FileColumns) (*Writer, error) {
 	if cfg == nil {
 		cfg = &config.Config{}
 	}
-	ext := filepath.Ext(cfg.OutputFileName)
-	base := strings.TrimSuffix(cfg.OutputFileName, ext)
-	if ext == "" {
-		ext = ".ndjson"
+	recipients, err := parseRecipients(cfg.EncryptRecipients)
+	if err != nil {
+		return nil, err
+	}
+	if len(recipients) > 0 && cfg.OutputFormat == "sqlite" {
+		return nil, errors.New("encrypted output is not supported with sqlite output format")
 	}
+	if len(cfg.SignKey) > 0 && cfg.OutputFormat != "" && cfg.OutputFormat != "json" {
+		return nil, errors.New("signed output requires json output format")
+	}
+	base, ext := config.OutputNameParts(cfg)
 
 	if sysInfo == nil {
 		sysInfo = &systeminfo.SystemInfo{}
 	}
 
 	w := &Writer{
-		metrics: m,
-		cfg:     cfg,
-		sysInfo: sysInfo,
-		base:    base,
-		ext:     ext,
+		metrics:    m,
+		cfg:        cfg,
+		sysInfo:    sysInfo,
+		recipients: recipients,
+		base:       base,
+		ext:        ext,
+	}
+	if cfg.OutputFormat == "csv" || cfg.OutputFormat == "parquet" {
+		w.schema = newFileSchema(defaultFileColumns(cfg, cols))
+	}
+	if len(cfg.SignKey) > 0 {
+		w.chain = &recordChain{}
+		w.signKey = ed25519.PrivateKey(cfg.SignKey)
+		w.manifestPath = base + ManifestSuffix
+		w.manifest = manifest{ManifestVersion: manifestVersion, SchemaVersion: SchemaVersion}
 	}
 	otel, err := newOtelLogger(cfg)
 	if err != nil {
@@ -106,7 +156,7 @@ func New(cfg *config.Config, sysInfo *systeminfo.SystemInfo, m *Metrics) (*Write
 		return nil, err
 	}
 	if err := w.emitInitialRecords(); err != nil {
-		_ = w.closeFile()
+		_ = w.closeFile(false)
 		return nil, err
 	}
 	w.startAsyncWriter()
@@ -123,39 +173,112 @@ func (w *Writer) openFile() error {
 	if w.index > 0 {
 		name = fmt.Sprintf("%s.%d%s", w.base, w.index, w.ext)
 	}
-	f, err := openPrivateFileNoSymlink(name)
+	var (
+		sink recordSink
+		err  error
+	)
+	if w.cfg.OutputFormat == "sqlite" {
+		sink, err = newSQLiteSink(name)
+	} else {
+		sink, err = w.openStreamSink(name)
+	}
 	if err != nil {
 		return err
 	}
-	w.file = f
-	w.buf = bufio.NewWriterSize(f, 1024*1024)
+	w.sink = sink
 	w.bytesWritten = 0
 	w.recordsSinceSync = 0
 	w.lastSyncAt = time.Now()
 	return nil
 }
 
+// openStreamSink opens a sink that writes its file front to back, which lets
+// it stream through encryption.
+func (w *Writer) openStreamSink(name string) (recordSink, error) {
+	var digest hash.Hash
+	if w.chain != nil {
+		digest = w.chain.startSegment(filepath.Base(name))
+	}
+	f, err := openOutputFile(name, w.recipients, digest)
+	if err != nil {
+		return nil, err
+	}
+	var sink recordSink
+	switch w.cfg.OutputFormat {
+	case "csv":
+		sink, err = newCSVSink(f, w.schema)
+	case "parquet":
+		sink, err = newParquetSink(f, w.schema, w.cfg.MaxOutputFileSize)
+	default:
+		sink = newNDJSONSink(f, w.chain)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return sink, nil
+}
+
 func (w *Writer) writeRecord(recordType string, payload any) error {
+	n, err := w.sink.WriteRecord(recordType, payload)
+	w.bytesWritten += int64(n)
+	return err
+}
+
+type ndjsonSink struct {
+	file  *outputFile
+	buf   *bufio.Writer
+	chain *recordChain
+}
+
+func newNDJSONSink(f *outputFile, chain *recordChain) *ndjsonSink {
+	return &ndjsonSink{file: f, buf: bufio.NewWriterSize(f, 1024*1024), chain: chain}
+}
+
+func (s *ndjsonSink) WriteRecord(recordType string, payload any) (int, error) {
 	record := ndjsonRecord{
 		RecordType:    recordType,
 		SchemaVersion: SchemaVersion,
 		Payload:       payload,
 	}
+	if s.chain != nil {
+		s.chain.link(&record)
+	}
 	data, err := jsonMarshal(record)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	n, err := w.buf.Write(data)
-	w.bytesWritten += int64(n)
+	if s.chain != nil {
+		s.chain.append(data)
+	}
+	n, err := s.buf.Write(data)
 	if err != nil {
-		return err
+		return n, err
 	}
-	n, err = w.buf.WriteString("\n")
-	w.bytesWritten += int64(n)
-	return err
+	m, err := s.buf.WriteString("\n")
+	return n + m, err
+}
+
+func (s *ndjsonSink) Flush() error {
+	return s.buf.Flush()
+}
+
+func (s *ndjsonSink) Close() error {
+	return errors.Join(s.buf.Flush(), s.file.Close())
 }
 
 func (w *Writer) WriteData(data any) error {
+	return w.enqueue("file", data)
+}
+
+// WriteEvent queues a record of another type than file, such as the
+// file_deleted and file_renamed records of watch mode. It does not count as
+// a processed file.
+func (w *Writer) WriteEvent(recordType string, payload any) error {
+	return w.enqueue(recordType, payload)
+}
+
+func (w *Writer) enqueue(recordType string, payload any) error {
 	if err := w.currentWriteErr(); err != nil {
 		return err
 	}
@@ -176,7 +299,7 @@ func (w *Writer) WriteData(data any) error {
 	}
 
 	select {
-	case queue <- writeRequest{payload: data}:
+	case queue <- writeRequest{recordType: recordType, payload: payload}:
 		return w.currentWriteErr()
 	case <-stopSends:
 		if err := w.currentWriteErr(); err != nil {
@@ -259,7 +382,7 @@ func (w *Writer) Close() error {
 	if err := w.emitMetricsLocked(); err != nil {
 		closeErr = errors.Join(closeErr, err)
 	}
-	if err := w.closeFile(); err != nil {
+	if err := w.closeFile(true); err != nil {
 		closeErr = errors.Join(closeErr, err)
 	}
 	if w.otel != nil {
@@ -269,41 +392,46 @@ func (w *Writer) Close() error {
 }
 
 func (w *Writer) rotate() error {
-	if err := w.closeFile(); err != nil {
+	if err := w.closeFile(false); err != nil {
 		return err
 	}
 	w.index++
 	return w.openFile()
 }
 
-func (w *Writer) closeFile() error {
-	var closeErr error
-	if err := w.flush(); err != nil {
-		closeErr = errors.Join(closeErr, err)
+// closeFile closes the current output file. With a record chain, the file is
+// added to the manifest, which is marked complete when final is set.
+func (w *Writer) closeFile(final bool) error {
+	if w.sink == nil {
+		return nil
 	}
-	if w.file != nil {
-		if err := w.file.Sync(); err != nil {
-			closeErr = errors.Join(closeErr, err)
-		}
-		if err := w.file.Close(); err != nil {
-			closeErr = errors.Join(closeErr, err)
-		}
-		w.file = nil
+	err := w.sink.Close()
+	w.sink = nil
+	if w.chain != nil {
+		w.manifest.Segments = append(w.manifest.Segments, w.chain.finishSegment())
+		w.manifest.Complete = final
+		w.manifest.Records = w.chain.seq
+		w.manifest.LastDigest = w.chain.last
+		err = errors.Join(err, writeManifest(w.manifestPath, &w.manifest, w.signKey))
 	}
-	w.buf = nil
-	return closeErr
+	return err
 }
 
 func (w *Writer) flush() error {
-	if w.buf != nil {
-		if err := w.buf.Flush(); err != nil {
-			return err
-		}
+	if w.sink != nil {
+		return w.sink.Flush()
 	}
 	return nil
 }
 
 func (w *Writer) emitInitialRecords() error {
+	if w.cfg.RedactSensitive != "" {
+		scanConfig := &ScanConfig{RedactSensitive: w.cfg.RedactSensitive, RedactKeyID: w.cfg.RedactKeyID}
+		if err := w.writeRecord("config", scanConfig); err != nil {
+			return err
+		}
+		w.emitRecord("config", scanConfig)
+	}
 	if w.sysInfo == nil {
 		return nil
 	}
@@ -393,12 +521,14 @@ func (w *Writer) startAsyncWriter() {
 			if err := w.currentWriteErr(); err != nil {
 				continue
 			}
-			if err := w.writeRecord("file", req.payload); err != nil {
+			if err := w.writeRecord(req.recordType, req.payload); err != nil {
 				w.setWriteErr(err)
 				continue
 			}
-			w.filesProcessed.Add(1)
-			w.emitRecord("file", req.payload)
+			if req.recordType == "file" {
+				w.filesProcessed.Add(1)
+			}
+			w.emitRecord(req.recordType, req.payload)
 
 			w.recordsSinceSync++
 			if w.shouldSync() {
@@ -87,6 +87,30 @@ func TestOutputLifecycle(t *testing.T) {
 	}
 }
 
+func TestConfigRecordStampsRedactKeyID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	cfg := &config.Config{OutputFileName: path, OutputFormat: "json", RedactSensitive: "hmac", RedactKeyID: "0123456789abcdef"}
+	w, err := New(cfg, &systeminfo.SystemInfo{}, &Metrics{})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	records := readNDJSONRecords(t, path)
+	if len(records) == 0 || records[0].RecordType != "config" {
+		t.Fatalf("expected config record first, got %+v", records)
+	}
+	var scanConfig ScanConfig
+	if err := json.Unmarshal(records[0].Payload, &scanConfig); err != nil {
+		t.Fatalf("decode config record: %v", err)
+	}
+	if scanConfig.RedactSensitive != "hmac" || scanConfig.RedactKeyID != "0123456789abcdef" {
+		t.Fatalf("unexpected config record %+v", scanConfig)
+	}
+}
+
 func TestWriteDataConcurrent(t *testing.T) {
 	tmp, err := os.CreateTemp("", "concurrent*.ndjson")
 	if err != nil {
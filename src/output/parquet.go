@@ -0,0 +1,78 @@
+package output
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+
+	"safnari/internal/parquet"
+)
+
+var parquetColumnKinds = map[columnKind]parquet.Kind{
+	columnString: parquet.String,
+	columnInt:    parquet.Int64,
+	columnBool:   parquet.Bool,
+	columnJSON:   parquet.String,
+}
+
+// parquetSink writes one row per file record with the flattened file schema.
+// Parquet keeps its footer until the file is closed, so a file becomes
+// readable once the writer rotates past it or closes. Other record types
+// have no rows in parquet output.
+type parquetSink struct {
+	file   *outputFile
+	buf    *bufio.Writer
+	pw     *parquet.Writer
+	schema *fileSchema
+}
+
+// newParquetSink starts parquet output in f. Row groups are cut at maxSize,
+// so a rotated file usually holds a single row group.
+func newParquetSink(f *outputFile, schema *fileSchema, maxSize int64) (*parquetSink, error) {
+	columns := make([]parquet.Column, len(schema.columns))
+	for i, col := range schema.columns {
+		columns[i] = parquet.Column{Name: col.name, Kind: parquetColumnKinds[col.kind]}
+	}
+	rowGroupSize := int64(parquet.DefaultRowGroupSize)
+	if maxSize > 0 && maxSize < rowGroupSize {
+		rowGroupSize = maxSize
+	}
+	buf := bufio.NewWriterSize(f, 1024*1024)
+	pw, err := parquet.NewWriter(buf, columns, rowGroupSize)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetSink{file: f, buf: buf, pw: pw, schema: schema}, nil
+}
+
+// WriteRecord buffers a file row and reports the size of the record's JSON
+// encoding, an upper bound on what the row adds to the compressed file.
+func (s *parquetSink) WriteRecord(recordType string, payload any) (int, error) {
+	if recordType != "file" {
+		return 0, nil
+	}
+	data, err := jsonMarshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	values, err := s.schema.flatten(data)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.pw.WriteRow(values); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (s *parquetSink) Flush() error {
+	return s.buf.Flush()
+}
+
+func (s *parquetSink) Close() error {
+	var closeErr error
+	if err := s.pw.Close(); err != nil {
+		closeErr = errors.Join(closeErr, fmt.Errorf("finish parquet file: %w", err))
+	}
+	return errors.Join(closeErr, s.buf.Flush(), s.file.Close())
+}
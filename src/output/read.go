@@ -0,0 +1,110 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SegmentPaths returns the rotated segments of the NDJSON scan written to
+// base, in the order they were written: base itself, then base.1, base.2 and
+// so on.
+func SegmentPaths(base string) ([]string, error) {
+	if _, err := os.Stat(base); err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	rotated, err := filepath.Glob(globEscape(stem) + ".*" + globEscape(ext))
+	if err != nil {
+		return nil, err
+	}
+	type segment struct {
+		path  string
+		index int
+	}
+	var segments []segment
+	for _, path := range rotated {
+		index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, stem+"."), ext))
+		if err != nil || index <= 0 {
+			continue
+		}
+		segments = append(segments, segment{path: path, index: index})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].index < segments[j].index })
+	paths := []string{base}
+	for _, s := range segments {
+		paths = append(paths, s.path)
+	}
+	return paths, nil
+}
+
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+type rawRecord struct {
+	RecordType    string          `json:"record_type"`
+	SchemaVersion string          `json:"schema_version"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// ReadRecords streams every record of the NDJSON scan written to base,
+// across its rotated segments, to fn. Records of another schema version are
+// rejected.
+func ReadRecords(base string, fn func(recordType string, payload json.RawMessage) error) error {
+	paths, err := SegmentPaths(base)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := readSegment(path, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSegment(path string, fn func(recordType string, payload json.RawMessage) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, 256*1024)
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			var record rawRecord
+			if jsonErr := json.Unmarshal(data, &record); jsonErr != nil {
+				return fmt.Errorf("%s line %d: %v", path, line, jsonErr)
+			}
+			if record.SchemaVersion != SchemaVersion {
+				return fmt.Errorf("%s line %d: unsupported schema version %q (expected %s)", path, line, record.SchemaVersion, SchemaVersion)
+			}
+			if fnErr := fn(record.RecordType, record.Payload); fnErr != nil {
+				return fmt.Errorf("%s line %d: %w", path, line, fnErr)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
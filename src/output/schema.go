@@ -1,3 +1,6 @@
 package output
 
-const SchemaVersion = "2"
+// SchemaVersion is the version of the record envelope and payloads. Version 3
+// made the system_info package, startup program, user, group and admin lists
+// arrays of objects instead of arrays of strings.
+const SchemaVersion = "3"
@@ -0,0 +1,540 @@
+package output
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema normalizes file records so analysts can join on path and hash.
+// Each file row also keeps the full record as JSON for fields without a table.
+var sqliteSchema = []string{
+	`CREATE TABLE scan_info (key TEXT PRIMARY KEY, value TEXT NOT NULL)`,
+	`CREATE TABLE system_info (id INTEGER PRIMARY KEY, os_version TEXT, record TEXT NOT NULL)`,
+	`CREATE TABLE processes (
+		id INTEGER PRIMARY KEY,
+		pid INTEGER NOT NULL,
+		ppid INTEGER,
+		name TEXT,
+		username TEXT,
+		exe TEXT,
+		cmdline TEXT,
+		start_time TEXT,
+		cpu_percent REAL,
+		memory_percent REAL,
+		sha256 TEXT,
+		cwd TEXT,
+		container_id TEXT,
+		record TEXT NOT NULL
+	)`,
+	`CREATE INDEX processes_sha256 ON processes (sha256)`,
+	`CREATE TABLE process_files (
+		process_id INTEGER NOT NULL REFERENCES processes (id),
+		kind TEXT NOT NULL,
+		path TEXT NOT NULL
+	)`,
+	`CREATE INDEX process_files_path ON process_files (path)`,
+	`CREATE TABLE process_sockets (
+		process_id INTEGER NOT NULL REFERENCES processes (id),
+		local_addr TEXT,
+		remote_addr TEXT,
+		status TEXT
+	)`,
+	`CREATE INDEX process_sockets_remote_addr ON process_sockets (remote_addr)`,
+	`CREATE TABLE metrics (
+		id INTEGER PRIMARY KEY,
+		start_time TEXT,
+		end_time TEXT,
+		total_files INTEGER,
+		files_scanned INTEGER,
+		files_processed INTEGER,
+		total_processes INTEGER
+	)`,
+	`CREATE TABLE files (
+		id INTEGER PRIMARY KEY,
+		path TEXT NOT NULL,
+		name TEXT,
+		size INTEGER,
+		mod_time TEXT,
+		creation_time TEXT,
+		access_time TEXT,
+		change_time TEXT,
+		permissions TEXT,
+		owner TEXT,
+		mime_type TEXT,
+		sensitive_data_truncated INTEGER NOT NULL DEFAULT 0,
+		container_id TEXT,
+		image_digest TEXT,
+		layer_digest TEXT,
+		record TEXT NOT NULL
+	)`,
+	`CREATE INDEX files_path ON files (path)`,
+	`CREATE INDEX files_container_id ON files (container_id)`,
+	`CREATE TABLE hashes (
+		file_id INTEGER NOT NULL REFERENCES files (id),
+		algorithm TEXT NOT NULL,
+		hash TEXT NOT NULL
+	)`,
+	`CREATE INDEX hashes_hash ON hashes (hash)`,
+	`CREATE INDEX hashes_file_id ON hashes (file_id)`,
+	`CREATE TABLE hash_set_matches (
+		file_id INTEGER NOT NULL REFERENCES files (id),
+		hash_set TEXT NOT NULL
+	)`,
+	`CREATE INDEX hash_set_matches_file_id ON hash_set_matches (file_id)`,
+	`CREATE INDEX hash_set_matches_hash_set ON hash_set_matches (hash_set)`,
+	`CREATE TABLE sensitive_matches (
+		file_id INTEGER NOT NULL REFERENCES files (id),
+		data_type TEXT NOT NULL,
+		value TEXT NOT NULL,
+		confidence REAL,
+		byte_offset INTEGER,
+		line_number INTEGER,
+		column_number INTEGER
+	)`,
+	`CREATE INDEX sensitive_matches_file_id ON sensitive_matches (file_id)`,
+	`CREATE INDEX sensitive_matches_data_type ON sensitive_matches (data_type)`,
+	`CREATE TABLE xattrs (
+		file_id INTEGER NOT NULL REFERENCES files (id),
+		name TEXT NOT NULL,
+		value TEXT
+	)`,
+	`CREATE INDEX xattrs_file_id ON xattrs (file_id)`,
+	`CREATE TABLE file_events (
+		id INTEGER PRIMARY KEY,
+		event TEXT NOT NULL,
+		path TEXT NOT NULL,
+		old_path TEXT,
+		event_time TEXT,
+		record TEXT NOT NULL
+	)`,
+	`CREATE INDEX file_events_path ON file_events (path)`,
+	`CREATE TABLE file_groups (
+		id INTEGER PRIMARY KEY,
+		kind TEXT NOT NULL,
+		algorithm TEXT NOT NULL,
+		hash TEXT,
+		size INTEGER,
+		max_distance INTEGER,
+		file_count INTEGER NOT NULL,
+		record TEXT NOT NULL
+	)`,
+	`CREATE TABLE file_group_members (
+		group_id INTEGER NOT NULL REFERENCES file_groups (id),
+		path TEXT NOT NULL
+	)`,
+	`CREATE INDEX file_group_members_group_id ON file_group_members (group_id)`,
+	`CREATE INDEX file_group_members_path ON file_group_members (path)`,
+}
+
+var sqliteInserts = map[string]string{
+	"scan_info":   `INSERT INTO scan_info (key, value) VALUES (?, ?)`,
+	"system_info": `INSERT INTO system_info (os_version, record) VALUES (?, ?)`,
+	"process": `INSERT INTO processes (pid, ppid, name, username, exe, cmdline, start_time, cpu_percent, memory_percent, sha256, cwd, container_id, record)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	"process_file":   `INSERT INTO process_files (process_id, kind, path) VALUES (?, ?, ?)`,
+	"process_socket": `INSERT INTO process_sockets (process_id, local_addr, remote_addr, status) VALUES (?, ?, ?, ?)`,
+	"metrics": `INSERT INTO metrics (start_time, end_time, total_files, files_scanned, files_processed, total_processes)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+	"file": `INSERT INTO files (path, name, size, mod_time, creation_time, access_time, change_time, permissions, owner, mime_type, sensitive_data_truncated,
+		container_id, image_digest, layer_digest, record)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	"hash":      `INSERT INTO hashes (file_id, algorithm, hash) VALUES (?, ?, ?)`,
+	"hash_set":  `INSERT INTO hash_set_matches (file_id, hash_set) VALUES (?, ?)`,
+	"sensitive": `INSERT INTO sensitive_matches (file_id, data_type, value, confidence, byte_offset, line_number, column_number) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	"xattr":     `INSERT INTO xattrs (file_id, name, value) VALUES (?, ?, ?)`,
+	"event":     `INSERT INTO file_events (event, path, old_path, event_time, record) VALUES (?, ?, ?, ?, ?)`,
+	"group":     `INSERT INTO file_groups (kind, algorithm, hash, size, max_distance, file_count, record) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+	"member":    `INSERT INTO file_group_members (group_id, path) VALUES (?, ?)`,
+}
+
+// sqliteFileRecord mirrors the FileRecord fields stored in their own columns
+// and tables; the output package cannot import the scanner.
+type sqliteFileRecord struct {
+	Path                   string                 `json:"path"`
+	Name                   string                 `json:"name"`
+	Size                   int64                  `json:"size"`
+	ModTime                string                 `json:"mod_time"`
+	CreationTime           string                 `json:"creation_time"`
+	AccessTime             string                 `json:"access_time"`
+	ChangeTime             string                 `json:"change_time"`
+	Permissions            string                 `json:"permissions"`
+	Owner                  string                 `json:"owner"`
+	MimeType               string                 `json:"mime_type"`
+	Hashes                 map[string]string      `json:"hashes"`
+	FuzzyHashes            map[string]string      `json:"fuzzy_hashes"`
+	HashSets               []string               `json:"hash_sets"`
+	Xattrs                 map[string]string      `json:"xattrs"`
+	SensitiveData          map[string][]string    `json:"sensitive_data"`
+	SensitiveConfidence    map[string][]float64   `json:"sensitive_data_confidence"`
+	SensitiveDataTruncated bool                   `json:"sensitive_data_truncated"`
+	SensitiveLocations     map[string][]sqliteLoc `json:"sensitive_locations"`
+	Container              *sqliteContainer       `json:"container"`
+}
+
+// sqliteContainer mirrors the container reference of files found in
+// container root filesystems and images.
+type sqliteContainer struct {
+	ID          string `json:"id"`
+	ImageDigest string `json:"image_digest"`
+	LayerDigest string `json:"layer_digest"`
+}
+
+type sqliteLoc struct {
+	Offset int64 `json:"offset"`
+	Line   int   `json:"line"`
+	Column int   `json:"column"`
+}
+
+// sqliteFileEvent mirrors the file_deleted and file_renamed records of watch
+// mode.
+type sqliteFileEvent struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path"`
+	Time    string `json:"time"`
+}
+
+// sqliteFileGroup mirrors the duplicate_group and similarity_cluster records
+// written at the end of a scan with --duplicates.
+type sqliteFileGroup struct {
+	Algorithm   string   `json:"algorithm"`
+	Hash        *string  `json:"hash"`
+	Size        *int64   `json:"size"`
+	MaxDistance *int     `json:"max_distance"`
+	Count       int      `json:"count"`
+	Paths       []string `json:"paths"`
+}
+
+type sqliteSystemInfo struct {
+	OSVersion string `json:"os_version"`
+}
+
+type sqliteProcess struct {
+	PID           int32   `json:"pid"`
+	PPID          int32   `json:"ppid"`
+	Name          string  `json:"name"`
+	Username      string  `json:"username"`
+	Exe           string  `json:"exe"`
+	Cmdline       string  `json:"cmdline"`
+	StartTime     string  `json:"start_time"`
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryPercent float64 `json:"memory_percent"`
+	SHA256        string  `json:"sha256"`
+	Cwd           string  `json:"cwd"`
+	ContainerID   string  `json:"container_id"`
+	// OpenFiles and MappedLibraries go to process_files, Sockets to
+	// process_sockets.
+	OpenFiles       []string `json:"open_files"`
+	MappedLibraries []string `json:"mapped_libraries"`
+	Sockets         []struct {
+		LocalAddr  string `json:"local_addr"`
+		RemoteAddr string `json:"remote_addr"`
+		Status     string `json:"status"`
+	} `json:"sockets"`
+}
+
+// sqliteSink writes records into a SQLite database. Records accumulate in a
+// transaction that Flush commits, so a flushed database is always readable.
+type sqliteSink struct {
+	file  *os.File
+	db    *sql.DB
+	conn  *sql.Conn
+	stmts map[string]*sql.Stmt
+}
+
+func newSQLiteSink(name string) (*sqliteSink, error) {
+	// Create the file through the private no-symlink open first, then check
+	// that SQLite attached to that same file.
+	f, err := openPrivateFileNoSymlink(name)
+	if err != nil {
+		return nil, err
+	}
+	s := &sqliteSink{file: f}
+	if err := s.open(name); err != nil {
+		_ = s.closeDB()
+		_ = f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *sqliteSink) open(name string) error {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", name)
+	if err != nil {
+		return err
+	}
+	s.db = db
+	db.SetMaxOpenConns(1)
+	if s.conn, err = db.Conn(ctx); err != nil {
+		return err
+	}
+	if err := s.checkSameFile(name); err != nil {
+		return err
+	}
+	// A write-ahead log with normal syncing keeps every committed flush
+	// intact through a crash of the process or the host, while only the
+	// checkpoints wait for the disk.
+	var mode string
+	if err := s.conn.QueryRowContext(ctx, `PRAGMA journal_mode = WAL`).Scan(&mode); err != nil {
+		return fmt.Errorf("set sqlite journal mode: %w", err)
+	}
+	if !strings.EqualFold(mode, "wal") {
+		return fmt.Errorf("set sqlite journal mode: got %q, want wal", mode)
+	}
+	if _, err := s.conn.ExecContext(ctx, `PRAGMA synchronous = NORMAL`); err != nil {
+		return fmt.Errorf("set sqlite synchronous mode: %w", err)
+	}
+	for _, stmt := range sqliteSchema {
+		if _, err := s.conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("create sqlite schema: %w", err)
+		}
+	}
+	if _, err := s.conn.ExecContext(ctx, `INSERT INTO scan_info (key, value) VALUES ('schema_version', ?)`, SchemaVersion); err != nil {
+		return err
+	}
+	s.stmts = make(map[string]*sql.Stmt, len(sqliteInserts))
+	for kind, query := range sqliteInserts {
+		stmt, err := s.conn.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		s.stmts[kind] = stmt
+	}
+	_, err = s.conn.ExecContext(ctx, "BEGIN")
+	return err
+}
+
+func (s *sqliteSink) checkSameFile(name string) error {
+	opened, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+	current, err := os.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(opened, current) {
+		return fmt.Errorf("output file %s was replaced while opening", name)
+	}
+	return nil
+}
+
+// WriteRecord stores payload and reports the size of its JSON encoding, which
+// approximates the growth of the database for rotation.
+func (s *sqliteSink) WriteRecord(recordType string, payload any) (int, error) {
+	data, err := jsonMarshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	switch recordType {
+	case "config":
+		var c ScanConfig
+		if err := json.Unmarshal(data, &c); err != nil {
+			return 0, err
+		}
+		err = s.exec("scan_info", "redact_sensitive", c.RedactSensitive)
+		if err == nil && c.RedactKeyID != "" {
+			err = s.exec("scan_info", "redact_key_id", c.RedactKeyID)
+		}
+	case "system_info":
+		var info sqliteSystemInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return 0, err
+		}
+		err = s.exec("system_info", info.OSVersion, string(data))
+	case "process":
+		err = s.writeProcess(data)
+	case "metrics":
+		var m Metrics
+		if err := json.Unmarshal(data, &m); err != nil {
+			return 0, err
+		}
+		err = s.exec("metrics", m.StartTime, m.EndTime, m.TotalFiles, m.FilesScanned, m.FilesProcessed, m.TotalProcesses)
+	case "file":
+		err = s.writeFile(data)
+	case "file_deleted", "file_renamed":
+		var e sqliteFileEvent
+		if err := json.Unmarshal(data, &e); err != nil {
+			return 0, err
+		}
+		var oldPath any
+		if e.OldPath != "" {
+			oldPath = e.OldPath
+		}
+		err = s.exec("event", recordType, e.Path, oldPath, e.Time, string(data))
+	case "duplicate_group", "similarity_cluster":
+		err = s.writeGroup(recordType, data)
+	default:
+		err = fmt.Errorf("unsupported sqlite record type: %s", recordType)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+func (s *sqliteSink) writeProcess(data []byte) error {
+	var p sqliteProcess
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	res, err := s.stmts["process"].Exec(
+		p.PID, p.PPID, p.Name, p.Username, p.Exe, p.Cmdline, p.StartTime, p.CPUPercent, p.MemoryPercent,
+		p.SHA256, p.Cwd, p.ContainerID, string(data),
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for kind, paths := range map[string][]string{"open": p.OpenFiles, "mapped": p.MappedLibraries} {
+		for _, path := range paths {
+			if err := s.exec("process_file", id, kind, path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, c := range p.Sockets {
+		if err := s.exec("process_socket", id, c.LocalAddr, c.RemoteAddr, c.Status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteSink) writeFile(data []byte) error {
+	var rec sqliteFileRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+	var containerID, imageDigest, layerDigest any
+	if c := rec.Container; c != nil {
+		containerID, imageDigest, layerDigest = c.ID, c.ImageDigest, c.LayerDigest
+	}
+	res, err := s.stmts["file"].Exec(
+		rec.Path, rec.Name, rec.Size, rec.ModTime, rec.CreationTime, rec.AccessTime, rec.ChangeTime,
+		rec.Permissions, rec.Owner, rec.MimeType, rec.SensitiveDataTruncated,
+		containerID, imageDigest, layerDigest, string(data),
+	)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, hashes := range []map[string]string{rec.Hashes, rec.FuzzyHashes} {
+		for algorithm, hash := range hashes {
+			if err := s.exec("hash", id, algorithm, hash); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range rec.HashSets {
+		if err := s.exec("hash_set", id, name); err != nil {
+			return err
+		}
+	}
+	for dataType, values := range rec.SensitiveData {
+		scores := rec.SensitiveConfidence[dataType]
+		locations := rec.SensitiveLocations[dataType]
+		for i, value := range values {
+			var confidence, offset, line, column any
+			if i < len(scores) {
+				confidence = scores[i]
+			}
+			if i < len(locations) {
+				offset, line, column = locations[i].Offset, locations[i].Line, locations[i].Column
+			}
+			if err := s.exec("sensitive", id, dataType, value, confidence, offset, line, column); err != nil {
+				return err
+			}
+		}
+	}
+	for name, value := range rec.Xattrs {
+		if err := s.exec("xattr", id, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteSink) writeGroup(kind string, data []byte) error {
+	var g sqliteFileGroup
+	if err := json.Unmarshal(data, &g); err != nil {
+		return err
+	}
+	res, err := s.stmts["group"].Exec(kind, g.Algorithm, g.Hash, g.Size, g.MaxDistance, g.Count, string(data))
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, path := range g.Paths {
+		if err := s.exec("member", id, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteSink) exec(kind string, args ...any) error {
+	_, err := s.stmts[kind].Exec(args...)
+	return err
+}
+
+func (s *sqliteSink) Flush() error {
+	if _, err := s.conn.ExecContext(context.Background(), "COMMIT"); err != nil {
+		return err
+	}
+	_, err := s.conn.ExecContext(context.Background(), "BEGIN")
+	return err
+}
+
+func (s *sqliteSink) Close() error {
+	var closeErr error
+	if _, err := s.conn.ExecContext(context.Background(), "COMMIT"); err != nil {
+		closeErr = errors.Join(closeErr, err)
+	}
+	if err := s.closeDB(); err != nil {
+		closeErr = errors.Join(closeErr, err)
+	}
+	if err := s.file.Sync(); err != nil {
+		closeErr = errors.Join(closeErr, err)
+	}
+	if err := s.file.Close(); err != nil {
+		closeErr = errors.Join(closeErr, err)
+	}
+	return closeErr
+}
+
+func (s *sqliteSink) closeDB() error {
+	var closeErr error
+	for _, stmt := range s.stmts {
+		if err := stmt.Close(); err != nil {
+			closeErr = errors.Join(closeErr, err)
+		}
+	}
+	if s.conn != nil {
+		if err := s.conn.Close(); err != nil {
+			closeErr = errors.Join(closeErr, err)
+		}
+	}
+	if s.db != nil {
+		if err := s.db.Close(); err != nil {
+			closeErr = errors.Join(closeErr, err)
+		}
+	}
+	return closeErr
+}
@@ -0,0 +1,244 @@
+package output
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"safnari/config"
+	"safnari/systeminfo"
+)
+
+func openTestSQLite(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func queryInt(t *testing.T, db *sql.DB, query string, args ...any) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return n
+}
+
+func TestSQLiteOutputNormalizesRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.sqlite")
+	cfg := &config.Config{OutputFileName: path, OutputFormat: "sqlite", RedactSensitive: "hmac", RedactKeyID: "0123456789abcdef"}
+	sysInfo := &systeminfo.SystemInfo{
+		OSVersion: "linux",
+		RunningProcesses: []systeminfo.ProcessInfo{{
+			PID:             42,
+			Name:            "init",
+			SHA256:          "abc123",
+			OpenFiles:       []string{"/srv/app/.env"},
+			MappedLibraries: []string{"/usr/lib/libc.so.6"},
+			Sockets:         []systeminfo.ConnectionInfo{{LocalAddr: "10.0.0.5:41000", RemoteAddr: "203.0.113.9:443", Status: "ESTABLISHED", PID: 42}},
+		}},
+	}
+	w, err := New(cfg, sysInfo, &Metrics{StartTime: "start"})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	record := map[string]any{
+		"path":                      "/srv/app/.env",
+		"size":                      120,
+		"hashes":                    map[string]string{"sha256": "abc123", "md5": "def456"},
+		"fuzzy_hashes":              map[string]string{"tlsh": "T1AB"},
+		"hash_sets":                 []string{"ioc"},
+		"xattrs":                    map[string]string{"user.tag": "secret"},
+		"sensitive_data":            map[string][]string{"email": {"a@example.com", "b@example.com"}},
+		"sensitive_data_confidence": map[string][]float64{"email": {0.8, 0.8}},
+		"sensitive_locations": map[string][]map[string]any{
+			"email": {{"offset": 10, "line": 2, "column": 5}, {"offset": 40, "line": 3, "column": 1}},
+		},
+		"metadata": map[string]any{"owner_app": "demo"},
+	}
+	if err := w.WriteData(record); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.WriteData(map[string]any{"path": "/srv/app/other", "hashes": map[string]string{"sha256": "abc123"}}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.WriteData(map[string]any{
+		"path":      "docker://c0ffee!/app/.env",
+		"container": map[string]any{"runtime": "docker", "id": "c0ffee", "layer_digest": "sha256:aa", "path": "/app/.env"},
+	}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.WriteEvent("file_renamed", map[string]any{"path": "/srv/app/new", "old_path": "/srv/app/old", "time": "now"}); err != nil {
+		t.Fatalf("write event: %v", err)
+	}
+	if err := w.WriteEvent("duplicate_group", map[string]any{"algorithm": "sha256", "hash": "abc123", "size": 5, "count": 2, "paths": []string{"/srv/app/.env", "/srv/app/other"}}); err != nil {
+		t.Fatalf("write group: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Fatalf("expected private database, got %v", perm)
+		}
+	}
+
+	db := openTestSQLite(t, path)
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM files`); got != 3 {
+		t.Fatalf("expected 3 files, got %d", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM files WHERE container_id = 'c0ffee' AND layer_digest = 'sha256:aa' AND image_digest = ''`); got != 1 {
+		t.Fatalf("expected container columns on the layer file, got %d", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM files WHERE container_id IS NULL`); got != 2 {
+		t.Fatalf("expected host files without a container, got %d", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM hashes WHERE hash = 'abc123'`); got != 2 {
+		t.Fatalf("expected hash shared by 2 files, got %d", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM hashes h JOIN files f ON f.id = h.file_id WHERE f.path = ? AND h.algorithm = 'tlsh'`, "/srv/app/.env"); got != 1 {
+		t.Fatalf("expected fuzzy hash row, got %d", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM hash_set_matches m JOIN files f ON f.id = m.file_id WHERE f.path = ? AND m.hash_set = 'ioc'`, "/srv/app/.env"); got != 1 {
+		t.Fatalf("expected hash set match row, got %d", got)
+	}
+	if got := queryInt(t, db, `SELECT line_number FROM sensitive_matches WHERE value = 'b@example.com'`); got != 3 {
+		t.Fatalf("expected location columns aligned with values, got line %d", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM xattrs WHERE name = 'user.tag'`); got != 1 {
+		t.Fatalf("expected xattr row, got %d", got)
+	}
+	var stored string
+	if err := db.QueryRow(`SELECT record FROM files WHERE path = ?`, "/srv/app/.env").Scan(&stored); err != nil || !strings.Contains(stored, "owner_app") {
+		t.Fatalf("expected full record JSON, got %q (%v)", stored, err)
+	}
+	if got := queryInt(t, db, `SELECT pid FROM processes`); got != 42 {
+		t.Fatalf("expected process row, got pid %d", got)
+	}
+	if got := queryInt(t, db, `SELECT p.pid FROM processes p
+		JOIN process_files f ON f.process_id = p.id
+		JOIN process_sockets c ON c.process_id = p.id
+		WHERE f.path = ? AND f.kind = 'open' AND c.remote_addr = ?`, "/srv/app/.env", "203.0.113.9:443"); got != 42 {
+		t.Fatalf("expected process joined to its file and socket, got pid %d", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM process_files WHERE kind = 'mapped'`); got != 1 {
+		t.Fatalf("expected mapped library row, got %d", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM file_events WHERE event = 'file_renamed' AND old_path = ?`, "/srv/app/old"); got != 1 {
+		t.Fatalf("expected file event row, got %d", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM file_group_members m JOIN file_groups g ON g.id = m.group_id WHERE g.kind = 'duplicate_group' AND g.hash = 'abc123' AND g.max_distance IS NULL`); got != 2 {
+		t.Fatalf("expected 2 duplicate group members, got %d", got)
+	}
+	if got := queryInt(t, db, `SELECT files_processed FROM metrics`); got != 3 {
+		t.Fatalf("expected metrics row, got files_processed %d", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM scan_info WHERE key = 'redact_key_id' AND value = ?`, cfg.RedactKeyID); got != 1 {
+		t.Fatalf("expected redact key id in scan_info, got %d rows", got)
+	}
+	if got := queryInt(t, db, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name IN ('files_path', 'hashes_hash')`); got != 2 {
+		t.Fatalf("expected path and hash indexes, got %d", got)
+	}
+}
+
+func TestSQLiteOutputUsesWriteAheadLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.sqlite")
+	s, err := newSQLiteSink(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	var mode string
+	var synchronous int
+	if err := s.conn.QueryRowContext(context.Background(), `PRAGMA journal_mode`).Scan(&mode); err != nil {
+		t.Fatalf("journal mode: %v", err)
+	}
+	if err := s.conn.QueryRowContext(context.Background(), `PRAGMA synchronous`).Scan(&synchronous); err != nil {
+		t.Fatalf("synchronous: %v", err)
+	}
+	if mode != "wal" || synchronous != 1 {
+		t.Fatalf("journal_mode=%s synchronous=%d, want wal and 1 (normal)", mode, synchronous)
+	}
+	if _, err := s.WriteRecord("file", map[string]any{"path": "/a"}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	// A flushed database is readable while the scan still writes to it.
+	reader := openTestSQLite(t, path)
+	if n := queryInt(t, reader, `SELECT COUNT(*) FROM files`); n != 1 {
+		t.Fatalf("expected the flushed row to be readable, got %d", n)
+	}
+	_ = reader.Close()
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := os.Stat(path + "-wal"); !os.IsNotExist(err) {
+		t.Fatalf("expected the log to be checkpointed and removed on close, got %v", err)
+	}
+}
+
+func TestSQLiteOutputRotation(t *testing.T) {
+	tmpDir := t.TempDir()
+	base := filepath.Join(tmpDir, "out.sqlite")
+	cfg := &config.Config{OutputFileName: base, OutputFormat: "sqlite", MaxOutputFileSize: 200}
+	w, err := New(cfg, &systeminfo.SystemInfo{RunningProcesses: []systeminfo.ProcessInfo{}}, &Metrics{})
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	large := strings.Repeat("a", 150)
+	for i := 0; i < 5; i++ {
+		if err := w.WriteData(map[string]any{"path": large}); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	total := 0
+	for _, name := range []string{base, filepath.Join(tmpDir, "out.1.sqlite"), filepath.Join(tmpDir, "out.2.sqlite")} {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatalf("missing rotated database %s: %v", name, err)
+		}
+		total += queryInt(t, openTestSQLite(t, name), `SELECT COUNT(*) FROM files`)
+	}
+	if total != 5 {
+		t.Fatalf("expected 5 file rows across rotated databases, got %d", total)
+	}
+}
+
+func TestSQLiteOutputRejectsSymlinkTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlink creation requires elevated privileges on many Windows systems")
+	}
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim.db")
+	if err := os.WriteFile(victim, []byte("keep"), 0600); err != nil {
+		t.Fatalf("write victim: %v", err)
+	}
+	link := filepath.Join(dir, "out.sqlite")
+	if err := os.Symlink(victim, link); err != nil {
+		t.Skipf("symlink unavailable: %v", err)
+	}
+	cfg := &config.Config{OutputFileName: link, OutputFormat: "sqlite"}
+	if _, err := New(cfg, &systeminfo.SystemInfo{}, &Metrics{}); err == nil {
+		t.Fatal("expected symlink output target to be rejected")
+	}
+	if data, _ := os.ReadFile(victim); string(data) != "keep" {
+		t.Fatalf("victim was modified: %q", string(data))
+	}
+}
@@ -0,0 +1,336 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// VerifyReport is the outcome of checking a signed scan output offline.
+type VerifyReport struct {
+	Segments int
+	Records  int
+	// Problems lists every sign of tampering or loss that was found.
+	Problems []string
+	// Unchecked lists encrypted segments whose records could not be read
+	// because no identity was given. Their file digests are still checked.
+	Unchecked []string
+}
+
+// OK reports whether the output verified without problems.
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *VerifyReport) problemf(format string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// chainWindow is how many of the most recent records, and of the open gaps
+// in the sequence, a chain check keeps to tell reordered records from
+// duplicated and missing ones.
+const chainWindow = 1024
+
+// chainedRecord is where a record was found and how it links into the chain.
+type chainedRecord struct {
+	seq     uint64
+	digest  string
+	prev    string
+	segment string
+	line    int
+	// linked is set once the digest was compared with the prev_digest of
+	// the record after it.
+	linked bool
+}
+
+// seqRange is a run of sequence numbers that no segment has held so far.
+type seqRange struct {
+	from, to uint64
+}
+
+// chainCheck checks the records of every segment as they are read in file
+// order, keeping only a window of recent records and open gaps.
+type chainCheck struct {
+	report *VerifyReport
+	// records is the count the manifest lists, and ends the digest of the
+	// last record of each segment, keyed by its sequence number.
+	records uint64
+	ends    map[uint64]string
+	recent  map[uint64]*chainedRecord
+	order   []uint64
+	gaps    []seqRange
+	maxSeq  uint64
+}
+
+// VerifyManifest checks the manifest at path against the Ed25519 key that
+// signed it, then reads each segment it lists from the manifest's directory
+// and reports missing segments, altered files and missing, reordered or
+// altered records. A manifest whose signature does not verify is not
+// trusted to describe the segments, so they are not read. Encrypted
+// segments are decrypted with identities when given. An error means the
+// manifest itself could not be read.
+func VerifyManifest(path string, key ed25519.PublicKey, identities []age.Identity) (*VerifyReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if m.ManifestVersion != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.ManifestVersion)
+	}
+
+	report := &VerifyReport{Segments: len(m.Segments)}
+	if !m.verifySignature(key) {
+		report.problemf("manifest signature does not verify with the given public key")
+		return report, nil
+	}
+	if !m.Complete {
+		report.problemf("manifest is not complete; the scan did not close its output")
+	}
+
+	check := &chainCheck{
+		report:  report,
+		records: m.Records,
+		ends:    make(map[uint64]string, len(m.Segments)),
+		recent:  make(map[uint64]*chainedRecord, chainWindow),
+	}
+	for _, segment := range m.Segments {
+		if segment.Records > 0 {
+			check.ends[segment.LastSeq] = segment.LastDigest
+		}
+	}
+	dir := filepath.Dir(path)
+	for _, segment := range m.Segments {
+		if segment.File == "" || filepath.Base(segment.File) != segment.File {
+			report.problemf("segment name %q is not a plain file name", segment.File)
+			continue
+		}
+		check.segment(filepath.Join(dir, segment.File), segment, identities)
+	}
+	check.finish()
+	return report, nil
+}
+
+// segment checks one segment file against its manifest entry and the chain
+// of its records.
+func (c *chainCheck) segment(name string, segment manifestSegment, identities []age.Identity) {
+	report := c.report
+	f, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		if segment.Records > 0 {
+			report.problemf("segment %s is missing (records %d-%d)", segment.File, segment.FirstSeq, segment.LastSeq)
+		} else {
+			report.problemf("segment %s is missing", segment.File)
+		}
+		return
+	}
+	if err != nil {
+		report.problemf("segment %s cannot be read: %v", segment.File, err)
+		return
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	disk := io.TeeReader(f, sum)
+	var plain io.Reader = disk
+	if strings.HasSuffix(segment.File, encryptedExt) {
+		plain = nil
+		if len(identities) == 0 {
+			report.Unchecked = append(report.Unchecked, segment.File)
+			if segment.Records > 0 {
+				c.skip(segment)
+			}
+		} else if r, err := age.Decrypt(disk, identities...); err != nil {
+			report.problemf("segment %s cannot be decrypted: %v", segment.File, err)
+		} else {
+			plain = r
+		}
+	}
+	if plain != nil {
+		count, err := c.readRecords(plain, segment.File)
+		if err != nil {
+			report.problemf("segment %s cannot be read: %v", segment.File, err)
+		} else if count != segment.Records {
+			report.problemf("segment %s holds %d records, the manifest lists %d", segment.File, count, segment.Records)
+		}
+	}
+	if _, err := io.Copy(io.Discard, disk); err != nil {
+		report.problemf("segment %s cannot be read: %v", segment.File, err)
+		return
+	}
+	if hex.EncodeToString(sum.Sum(nil)) != segment.SHA256 {
+		report.problemf("segment %s does not match its manifest digest", segment.File)
+	}
+}
+
+// readRecords reads the NDJSON records of one segment in file order.
+func (c *chainCheck) readRecords(r io.Reader, file string) (uint64, error) {
+	var (
+		count uint64
+		line  int
+	)
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		data, err := br.ReadBytes('\n')
+		if len(data) > 0 {
+			line++
+			if c.add(bytes.TrimSuffix(data, []byte("\n")), file, line) {
+				count++
+			}
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// add checks one record line against the records read before it, reporting
+// unchained, duplicated, out-of-order and altered records. It returns false
+// when data is not a chained record.
+func (c *chainCheck) add(data []byte, file string, line int) bool {
+	var link struct {
+		Seq        uint64 `json:"seq"`
+		PrevDigest string `json:"prev_digest"`
+	}
+	if err := json.Unmarshal(data, &link); err != nil || link.Seq == 0 {
+		c.report.problemf("%s line %d is not a chained record", file, line)
+		return false
+	}
+	c.report.Records++
+	seq := link.Seq
+	if seq > c.records {
+		c.report.problemf("record %d (%s line %d) is not listed in the manifest", seq, file, line)
+		return true
+	}
+	if _, dup := c.recent[seq]; dup {
+		c.report.problemf("record %d (%s line %d) appears more than once", seq, file, line)
+		return true
+	}
+	if seq > c.maxSeq {
+		c.gap(c.maxSeq+1, seq-1)
+		c.maxSeq = seq
+	} else {
+		c.report.problemf("record %d (%s line %d) is out of order", seq, file, line)
+		c.fill(seq, seq)
+	}
+	if seq == 1 && link.PrevDigest != "" {
+		c.report.problemf("record 1 (%s line %d) does not start the chain", file, line)
+	}
+
+	sum := sha256.Sum256(data)
+	rec := &chainedRecord{seq: seq, digest: hex.EncodeToString(sum[:]), prev: link.PrevDigest, segment: file, line: line}
+	if before, ok := c.recent[seq-1]; ok && !before.linked {
+		before.linked = true
+		if before.digest != rec.prev {
+			c.altered(before)
+		}
+	}
+	if after, ok := c.recent[seq+1]; ok {
+		rec.linked = true
+		if rec.digest != after.prev {
+			c.altered(rec)
+		}
+	}
+	c.recent[seq] = rec
+	c.order = append(c.order, seq)
+	if len(c.order) > chainWindow {
+		c.settle(c.order[0])
+		c.order = c.order[1:]
+	}
+	return true
+}
+
+func (c *chainCheck) altered(rec *chainedRecord) {
+	c.report.problemf("record %d (%s line %d) is altered", rec.seq, rec.segment, rec.line)
+}
+
+// settle drops a record from the window. A record whose successor was
+// never read is checked against the manifest when it ends a segment.
+func (c *chainCheck) settle(seq uint64) {
+	rec := c.recent[seq]
+	delete(c.recent, seq)
+	if end, ok := c.ends[seq]; ok && !rec.linked && end != rec.digest {
+		c.altered(rec)
+	}
+}
+
+// skip accounts for an unchecked segment, whose records are not missing
+// but unknown.
+func (c *chainCheck) skip(segment manifestSegment) {
+	if segment.FirstSeq > c.maxSeq {
+		c.gap(c.maxSeq+1, min(segment.FirstSeq-1, c.records))
+	}
+	c.fill(segment.FirstSeq, segment.LastSeq)
+	c.maxSeq = max(c.maxSeq, min(segment.LastSeq, c.records))
+}
+
+// gap records from-to as not read yet. The oldest gap is reported missing
+// once more than chainWindow are open.
+func (c *chainCheck) gap(from, to uint64) {
+	if from > to {
+		return
+	}
+	c.gaps = append(c.gaps, seqRange{from, to})
+	if len(c.gaps) > chainWindow {
+		c.missing(c.gaps[0])
+		c.gaps = c.gaps[1:]
+	}
+}
+
+// fill removes from-to from the open gaps.
+func (c *chainCheck) fill(from, to uint64) {
+	var open []seqRange
+	for _, g := range c.gaps {
+		if g.to < from || g.from > to {
+			open = append(open, g)
+			continue
+		}
+		if g.from < from {
+			open = append(open, seqRange{g.from, from - 1})
+		}
+		if g.to > to {
+			open = append(open, seqRange{to + 1, g.to})
+		}
+	}
+	c.gaps = open
+}
+
+func (c *chainCheck) missing(g seqRange) {
+	if g.from == g.to {
+		c.report.problemf("record %d is missing", g.from)
+	} else {
+		c.report.problemf("records %d-%d are missing", g.from, g.to)
+	}
+}
+
+// finish settles the records left in the window and reports the gaps that
+// were never filled as missing, along with any records past the last one
+// read.
+func (c *chainCheck) finish() {
+	for _, seq := range c.order {
+		c.settle(seq)
+	}
+	c.order = nil
+	c.gap(c.maxSeq+1, c.records)
+	for _, g := range c.gaps {
+		c.missing(g)
+	}
+	c.gaps = nil
+}
@@ -0,0 +1,166 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Formats lists the output formats Write accepts.
+var Formats = []string{"text", "json", "html"}
+
+// Write renders r to w as text, JSON or a self-contained HTML page.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case "text":
+		return r.writeText(w)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	case "html":
+		return htmlReport.Execute(w, r)
+	}
+	return fmt.Errorf("unsupported report format %q (expected %s)", format, strings.Join(Formats, ", "))
+}
+
+func (r *Report) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	section := func(title string) {
+		fmt.Fprintf(tw, "\n%s\n", title)
+	}
+
+	fmt.Fprintf(tw, "Safnari report: %d files, %s, %d with sensitive matches\n", r.Files, formatBytes(r.Bytes), r.FilesWithMatches)
+	for _, scan := range r.Scans {
+		fmt.Fprintf(tw, "  %s\t%d files", scan.Path, scan.Files)
+		if scan.Metrics != nil {
+			fmt.Fprintf(tw, "\t%s - %s", scan.Metrics.StartTime, scan.Metrics.EndTime)
+		}
+		fmt.Fprintln(tw)
+	}
+
+	section("Top directories by sensitive matches")
+	for _, d := range r.TopDirectories {
+		fmt.Fprintf(tw, "  %d\t%d files\t%s\n", d.Matches, d.Files, d.Directory)
+	}
+	section("Matches by type")
+	for _, t := range r.MatchesByType {
+		fmt.Fprintf(tw, "  %s\t%d\t%d files\n", t.Type, t.Matches, t.Files)
+	}
+	section("Largest files")
+	for _, f := range r.LargestFiles {
+		fmt.Fprintf(tw, "  %s\t%s\n", formatBytes(f.Size), f.Path)
+	}
+	section("Duplicate files")
+	for _, g := range r.Duplicates {
+		fmt.Fprintf(tw, "  %s wasted\t%d copies\t%s\n", formatBytes(g.Wasted), len(g.Paths), g.SHA256)
+		for _, path := range g.Paths {
+			fmt.Fprintf(tw, "    %s\n", path)
+		}
+	}
+	section("Near-duplicate clusters (TLSH)")
+	for _, c := range r.NearDuplicates {
+		fmt.Fprintf(tw, "  %d files\tmax distance %d\n", len(c.Paths), c.MaxDistance)
+		for _, path := range c.Paths {
+			fmt.Fprintf(tw, "    %s\n", path)
+		}
+	}
+	section(fmt.Sprintf("World-readable files with sensitive data (%d)", r.WorldReadableCount))
+	for _, f := range r.WorldReadableSensitive {
+		fmt.Fprintf(tw, "  %s\t%s\t%d\t%s\t%s\n", f.Permissions, f.Owner, f.Matches, strings.Join(f.Types, ","), f.Path)
+	}
+	section("Collection warnings")
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(tw, "  %d\t%s\t%s\n", warning.Count, warning.Source, warning.Category)
+	}
+	return tw.Flush()
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"join":  strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Safnari report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; border-bottom: 1px solid #ccc; }
+table { border-collapse: collapse; margin-top: .5em; }
+th, td { text-align: left; padding: .25em .75em; border-bottom: 1px solid #eee; vertical-align: top; }
+td.n { text-align: right; font-variant-numeric: tabular-nums; }
+code, .path { font-family: ui-monospace, monospace; font-size: .9em; word-break: break-all; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>Safnari report</h1>
+<p>{{.Files}} files, {{bytes .Bytes}}, {{.FilesWithMatches}} with sensitive matches.</p>
+<table>
+<tr><th>Scan</th><th>Files</th><th>Started</th><th>Ended</th></tr>
+{{range .Scans}}<tr><td class="path">{{.Path}}</td><td class="n">{{.Files}}</td>{{with .Metrics}}<td>{{.StartTime}}</td><td>{{.EndTime}}</td>{{else}}<td></td><td></td>{{end}}</tr>
+{{end}}</table>
+
+<h2>Top directories by sensitive matches</h2>
+<table>
+<tr><th>Matches</th><th>Files</th><th>Directory</th></tr>
+{{range .TopDirectories}}<tr><td class="n">{{.Matches}}</td><td class="n">{{.Files}}</td><td class="path">{{.Directory}}</td></tr>
+{{end}}</table>
+
+<h2>Matches by type</h2>
+<table>
+<tr><th>Type</th><th>Matches</th><th>Files</th></tr>
+{{range .MatchesByType}}<tr><td>{{.Type}}</td><td class="n">{{.Matches}}</td><td class="n">{{.Files}}</td></tr>
+{{end}}</table>
+
+<h2>Largest files</h2>
+<table>
+<tr><th>Size</th><th>Path</th></tr>
+{{range .LargestFiles}}<tr><td class="n">{{bytes .Size}}</td><td class="path">{{.Path}}</td></tr>
+{{end}}</table>
+
+<h2>Duplicate files</h2>
+<table>
+<tr><th>Wasted</th><th>Copies</th><th>Files</th></tr>
+{{range .Duplicates}}<tr><td class="n">{{bytes .Wasted}}</td><td class="n">{{len .Paths}}</td><td><code class="muted">{{.SHA256}}</code>{{range .Paths}}<br><span class="path">{{.}}</span>{{end}}</td></tr>
+{{end}}</table>
+
+<h2>Near-duplicate clusters (TLSH)</h2>
+<table>
+<tr><th>Files</th><th>Max distance</th><th>Paths</th></tr>
+{{range .NearDuplicates}}<tr><td class="n">{{len .Paths}}</td><td class="n">{{.MaxDistance}}</td><td>{{range $i, $p := .Paths}}{{if $i}}<br>{{end}}<span class="path">{{$p}}</span>{{end}}</td></tr>
+{{end}}</table>
+
+<h2>World-readable files with sensitive data ({{.WorldReadableCount}})</h2>
+<table>
+<tr><th>Permissions</th><th>Owner</th><th>Matches</th><th>Types</th><th>Path</th></tr>
+{{range .WorldReadableSensitive}}<tr><td><code>{{.Permissions}}</code></td><td>{{.Owner}}</td><td class="n">{{.Matches}}</td><td>{{join .Types ", "}}</td><td class="path">{{.Path}}</td></tr>
+{{end}}</table>
+
+<h2>Collection warnings</h2>
+<table>
+<tr><th>Count</th><th>Source</th><th>Category</th><th>Example</th></tr>
+{{range .Warnings}}<tr><td class="n">{{.Count}}</td><td>{{.Source}}</td><td>{{.Category}}</td><td class="muted">{{.Example}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
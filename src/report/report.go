@@ -0,0 +1,448 @@
+// Package report summarizes finished NDJSON scans: where sensitive data
+// sits, which files are large or duplicated, which exposed files hold
+// matches and what could not be collected.
+package report
+
+import (
+	"container/heap"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"safnari/fuzzy"
+	"safnari/output"
+)
+
+const (
+	defaultTop          = 10
+	defaultTLSHDistance = 30
+)
+
+// Options tune a report.
+type Options struct {
+	// Top caps the length of each ranked list (default 10).
+	Top int
+	// TLSHDistance is the largest TLSH distance at which two files count as
+	// near duplicates (default 30).
+	TLSHDistance int
+}
+
+// Report is the summary of one or more scans.
+type Report struct {
+	Scans                  []ScanSummary      `json:"scans"`
+	Files                  int                `json:"files"`
+	Bytes                  int64              `json:"bytes"`
+	FilesWithMatches       int                `json:"files_with_matches"`
+	TopDirectories         []DirectoryMatches `json:"top_directories"`
+	MatchesByType          []TypeMatches      `json:"matches_by_type"`
+	LargestFiles           []FileSize         `json:"largest_files"`
+	Duplicates             []DuplicateGroup   `json:"duplicates"`
+	NearDuplicates         []Cluster          `json:"near_duplicates"`
+	WorldReadableCount     int                `json:"world_readable_count"`
+	WorldReadableSensitive []ExposedFile      `json:"world_readable_sensitive"`
+	Warnings               []WarningCount     `json:"warnings"`
+}
+
+// ScanSummary describes one input scan.
+type ScanSummary struct {
+	Path    string          `json:"path"`
+	Files   int             `json:"files"`
+	Metrics *output.Metrics `json:"metrics,omitempty"`
+}
+
+// DirectoryMatches counts the sensitive matches of the files directly in a
+// directory.
+type DirectoryMatches struct {
+	Directory string `json:"directory"`
+	Matches   int    `json:"matches"`
+	Files     int    `json:"files"`
+}
+
+// TypeMatches counts the matches of one sensitive data type.
+type TypeMatches struct {
+	Type    string `json:"type"`
+	Matches int    `json:"matches"`
+	Files   int    `json:"files"`
+}
+
+// FileSize is a file in the largest files list.
+type FileSize struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// DuplicateGroup lists files with the same SHA-256 digest. Wasted is the
+// space taken by all copies but one.
+type DuplicateGroup struct {
+	SHA256 string   `json:"sha256"`
+	Size   int64    `json:"size"`
+	Wasted int64    `json:"wasted"`
+	Paths  []string `json:"paths"`
+}
+
+// Cluster lists files whose TLSH digests are linked by distances of at most
+// Options.TLSHDistance.
+type Cluster struct {
+	Paths       []string `json:"paths"`
+	MaxDistance int      `json:"max_distance"`
+}
+
+// ExposedFile is a file readable by everyone that holds sensitive data.
+type ExposedFile struct {
+	Path        string   `json:"path"`
+	Permissions string   `json:"permissions"`
+	Owner       string   `json:"owner,omitempty"`
+	Types       []string `json:"types"`
+	Matches     int      `json:"matches"`
+}
+
+// WarningCount counts collection warnings of one category. Source is "file"
+// for warnings on file records and "system_info" for host collection.
+type WarningCount struct {
+	Source   string `json:"source"`
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+	Example  string `json:"example"`
+}
+
+// fileRecord is the part of a file record a report reads.
+type fileRecord struct {
+	Path               string              `json:"path"`
+	Size               int64               `json:"size"`
+	Permissions        string              `json:"permissions"`
+	Owner              string              `json:"owner"`
+	Hashes             map[string]string   `json:"hashes"`
+	FuzzyHashes        map[string]string   `json:"fuzzy_hashes"`
+	SensitiveData      map[string][]string `json:"sensitive_data"`
+	MatchCounts        map[string]int      `json:"sensitive_data_match_counts"`
+	CollectionWarnings []string            `json:"collection_warnings"`
+}
+
+// matches returns the match count per type, preferring the counts the
+// scanner recorded, which survive sensitive value truncation.
+func (r *fileRecord) matches() map[string]int {
+	counts := make(map[string]int, len(r.SensitiveData))
+	for dataType, values := range r.SensitiveData {
+		counts[dataType] = len(values)
+	}
+	for dataType, n := range r.MatchCounts {
+		counts[dataType] = n
+	}
+	return counts
+}
+
+type systemInfo struct {
+	CollectionWarnings map[string]string `json:"collection_warnings"`
+}
+
+// builder accumulates a report while the scans stream past.
+type builder struct {
+	opts        Options
+	report      Report
+	directories map[string]*DirectoryMatches
+	types       map[string]*TypeMatches
+	largest     sizeHeap
+	exposed     exposedHeap
+	duplicates  map[string]*DuplicateGroup
+	similar     map[fuzzy.TLSHDigest][]string
+	warnings    map[[2]string]*WarningCount
+}
+
+// Scans reads the scans written to paths, each with its rotated segments,
+// and summarizes them together.
+func Scans(paths []string, opts Options) (*Report, error) {
+	if opts.Top <= 0 {
+		opts.Top = defaultTop
+	}
+	if opts.TLSHDistance <= 0 {
+		opts.TLSHDistance = defaultTLSHDistance
+	}
+	b := &builder{
+		opts:        opts,
+		directories: make(map[string]*DirectoryMatches),
+		types:       make(map[string]*TypeMatches),
+		duplicates:  make(map[string]*DuplicateGroup),
+		similar:     make(map[fuzzy.TLSHDigest][]string),
+		warnings:    make(map[[2]string]*WarningCount),
+	}
+	for _, path := range paths {
+		scan := ScanSummary{Path: path}
+		err := output.ReadRecords(path, func(recordType string, payload json.RawMessage) error {
+			switch recordType {
+			case "file":
+				var record fileRecord
+				if err := json.Unmarshal(payload, &record); err != nil {
+					return err
+				}
+				scan.Files++
+				b.addFile(&record)
+			case "system_info":
+				var info systemInfo
+				if err := json.Unmarshal(payload, &info); err != nil {
+					return err
+				}
+				for category, warning := range info.CollectionWarnings {
+					b.addWarning("system_info", category, warning)
+				}
+			case "metrics":
+				var metrics output.Metrics
+				if err := json.Unmarshal(payload, &metrics); err != nil {
+					return err
+				}
+				scan.Metrics = &metrics
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.report.Scans = append(b.report.Scans, scan)
+	}
+	return b.finish(), nil
+}
+
+func (b *builder) addFile(record *fileRecord) {
+	b.report.Files++
+	b.report.Bytes += record.Size
+
+	matches := record.matches()
+	total := 0
+	var types []string
+	for dataType, n := range matches {
+		if n <= 0 {
+			continue
+		}
+		total += n
+		types = append(types, dataType)
+		t := b.types[dataType]
+		if t == nil {
+			t = &TypeMatches{Type: dataType}
+			b.types[dataType] = t
+		}
+		t.Matches += n
+		t.Files++
+	}
+	if total > 0 {
+		b.report.FilesWithMatches++
+		dir := parentDir(record.Path)
+		d := b.directories[dir]
+		if d == nil {
+			d = &DirectoryMatches{Directory: dir}
+			b.directories[dir] = d
+		}
+		d.Matches += total
+		d.Files++
+		if worldReadable(record.Permissions) {
+			sort.Strings(types)
+			b.report.WorldReadableCount++
+			heap.Push(&b.exposed, ExposedFile{
+				Path:        record.Path,
+				Permissions: record.Permissions,
+				Owner:       record.Owner,
+				Types:       types,
+				Matches:     total,
+			})
+			if b.exposed.Len() > b.opts.Top {
+				heap.Pop(&b.exposed)
+			}
+		}
+	}
+
+	if record.Size > 0 {
+		heap.Push(&b.largest, FileSize{Path: record.Path, Size: record.Size})
+		if b.largest.Len() > b.opts.Top {
+			heap.Pop(&b.largest)
+		}
+	}
+	if digest := record.Hashes["sha256"]; digest != "" {
+		g := b.duplicates[digest]
+		if g == nil {
+			g = &DuplicateGroup{SHA256: digest, Size: record.Size}
+			b.duplicates[digest] = g
+		}
+		g.Paths = append(g.Paths, record.Path)
+	}
+	if digest, ok := fuzzy.ParseTLSHDigest(record.FuzzyHashes["tlsh"]); ok {
+		b.similar[digest] = append(b.similar[digest], record.Path)
+	}
+	for _, warning := range record.CollectionWarnings {
+		b.addWarning("file", warningCategory(warning), warning)
+	}
+}
+
+func (b *builder) addWarning(source, category, example string) {
+	key := [2]string{source, category}
+	w := b.warnings[key]
+	if w == nil {
+		w = &WarningCount{Source: source, Category: category, Example: example}
+		b.warnings[key] = w
+	}
+	w.Count++
+}
+
+func (b *builder) finish() *Report {
+	r := &b.report
+	top := b.opts.Top
+	r.TopDirectories = []DirectoryMatches{}
+	r.MatchesByType = []TypeMatches{}
+	r.Duplicates = []DuplicateGroup{}
+	r.Warnings = []WarningCount{}
+
+	for _, d := range b.directories {
+		r.TopDirectories = append(r.TopDirectories, *d)
+	}
+	sort.Slice(r.TopDirectories, func(i, j int) bool {
+		a, c := r.TopDirectories[i], r.TopDirectories[j]
+		if a.Matches != c.Matches {
+			return a.Matches > c.Matches
+		}
+		return a.Directory < c.Directory
+	})
+	r.TopDirectories = truncate(r.TopDirectories, top)
+
+	for _, t := range b.types {
+		r.MatchesByType = append(r.MatchesByType, *t)
+	}
+	sort.Slice(r.MatchesByType, func(i, j int) bool {
+		a, c := r.MatchesByType[i], r.MatchesByType[j]
+		if a.Matches != c.Matches {
+			return a.Matches > c.Matches
+		}
+		return a.Type < c.Type
+	})
+
+	r.LargestFiles = append([]FileSize{}, b.largest...)
+	sort.Slice(r.LargestFiles, func(i, j int) bool {
+		a, c := r.LargestFiles[i], r.LargestFiles[j]
+		if a.Size != c.Size {
+			return a.Size > c.Size
+		}
+		return a.Path < c.Path
+	})
+
+	for _, g := range b.duplicates {
+		if len(g.Paths) < 2 {
+			continue
+		}
+		g.Wasted = g.Size * int64(len(g.Paths)-1)
+		sort.Strings(g.Paths)
+		r.Duplicates = append(r.Duplicates, *g)
+	}
+	sort.Slice(r.Duplicates, func(i, j int) bool {
+		a, c := r.Duplicates[i], r.Duplicates[j]
+		if a.Wasted != c.Wasted {
+			return a.Wasted > c.Wasted
+		}
+		return a.SHA256 < c.SHA256
+	})
+	r.Duplicates = truncate(r.Duplicates, top)
+
+	r.NearDuplicates = []Cluster{}
+	for _, c := range fuzzy.ClusterTLSHPaths(b.similar, b.opts.TLSHDistance) {
+		r.NearDuplicates = append(r.NearDuplicates, Cluster{Paths: c.Paths, MaxDistance: c.MaxDistance})
+	}
+	r.NearDuplicates = truncate(r.NearDuplicates, top)
+
+	r.WorldReadableSensitive = append([]ExposedFile{}, b.exposed...)
+	sort.Slice(r.WorldReadableSensitive, func(i, j int) bool {
+		a, c := r.WorldReadableSensitive[i], r.WorldReadableSensitive[j]
+		if a.Matches != c.Matches {
+			return a.Matches > c.Matches
+		}
+		return a.Path < c.Path
+	})
+
+	for _, w := range b.warnings {
+		r.Warnings = append(r.Warnings, *w)
+	}
+	sort.Slice(r.Warnings, func(i, j int) bool {
+		a, c := r.Warnings[i], r.Warnings[j]
+		if a.Count != c.Count {
+			return a.Count > c.Count
+		}
+		if a.Source != c.Source {
+			return a.Source < c.Source
+		}
+		return a.Category < c.Category
+	})
+
+	return r
+}
+
+func truncate[T any](s []T, n int) []T {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// parentDir returns the directory of a scanned path. Scans may come from
+// another platform, so both separators are accepted.
+func parentDir(path string) string {
+	i := strings.LastIndexAny(path, `/\`)
+	switch {
+	case i < 0:
+		return "."
+	case i == 0:
+		return path[:1]
+	}
+	return path[:i]
+}
+
+// worldReadable reports whether a file mode string such as "-rw-r--r--"
+// grants read access to others.
+func worldReadable(permissions string) bool {
+	n := len(permissions)
+	return n >= 9 && permissions[n-3] == 'r'
+}
+
+var warningDigits = regexp.MustCompile(`[0-9]+`)
+
+// warningCategory reduces a file collection warning to its kind: the text
+// before any error detail, with numbers masked, so "content scan truncated
+// at 1048576 bytes" and "text extraction failed: EOF" group with their
+// peers.
+func warningCategory(warning string) string {
+	category, _, _ := strings.Cut(warning, ": ")
+	return warningDigits.ReplaceAllString(category, "N")
+}
+
+// sizeHeap is a min-heap of the largest files seen so far.
+type sizeHeap []FileSize
+
+func (h sizeHeap) Len() int { return len(h) }
+func (h sizeHeap) Less(i, j int) bool {
+	if h[i].Size != h[j].Size {
+		return h[i].Size < h[j].Size
+	}
+	return h[i].Path > h[j].Path
+}
+func (h sizeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *sizeHeap) Push(x any)   { *h = append(*h, x.(FileSize)) }
+func (h *sizeHeap) Pop() any {
+	old := *h
+	f := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return f
+}
+
+// exposedHeap is a min-heap of the world-readable files with the most
+// matches seen so far.
+type exposedHeap []ExposedFile
+
+func (h exposedHeap) Len() int { return len(h) }
+func (h exposedHeap) Less(i, j int) bool {
+	if h[i].Matches != h[j].Matches {
+		return h[i].Matches < h[j].Matches
+	}
+	return h[i].Path > h[j].Path
+}
+func (h exposedHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *exposedHeap) Push(x any)   { *h = append(*h, x.(ExposedFile)) }
+func (h *exposedHeap) Pop() any {
+	old := *h
+	f := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return f
+}
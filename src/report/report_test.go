@@ -0,0 +1,171 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/glaslos/tlsh"
+)
+
+// writeScan writes payloads as a schema v2 scan, one segment per slice.
+func writeScan(t *testing.T, base string, segments ...[]map[string]any) {
+	t.Helper()
+	ext := filepath.Ext(base)
+	for i, records := range segments {
+		name := base
+		if i > 0 {
+			name = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(base, ext), i, ext)
+		}
+		var buf bytes.Buffer
+		for _, record := range records {
+			recordType, _ := record["record_type"].(string)
+			if recordType == "" {
+				recordType = "file"
+			}
+			delete(record, "record_type")
+			line, err := json.Marshal(map[string]any{"record_type": recordType, "schema_version": "3", "payload": record})
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			buf.Write(append(line, '\n'))
+		}
+		if err := os.WriteFile(name, buf.Bytes(), 0600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func tlshOf(t *testing.T, text string) string {
+	t.Helper()
+	hash, err := tlsh.HashBytes([]byte(text))
+	if err != nil {
+		t.Fatalf("tlsh: %v", err)
+	}
+	return hash.String()
+}
+
+func TestScansSummarizesFileRecords(t *testing.T) {
+	var text strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&text, "line %d of the quarterly payroll export for department %d\n", i, i%7)
+	}
+	original := text.String()
+	edited := strings.Replace(original, "line 3 of", "row 3 in", 1)
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.ndjson")
+	second := filepath.Join(dir, "b.ndjson")
+	writeScan(t, first, []map[string]any{
+		{"record_type": "system_info", "collection_warnings": map[string]string{"processes": "permission denied"}},
+		{"path": "/srv/hr/payroll.csv", "size": 4000, "permissions": "-rw-r--r--", "owner": "hr",
+			"hashes":                      map[string]string{"sha256": "aaa"},
+			"fuzzy_hashes":                map[string]string{"tlsh": tlshOf(t, original)},
+			"sensitive_data":              map[string][]string{"ssn": {"***-**-1234"}},
+			"sensitive_data_match_counts": map[string]int{"ssn": 12}},
+		{"path": "/srv/hr/contacts.txt", "size": 100, "permissions": "-rw-------",
+			"sensitive_data": map[string][]string{"email": {"a@example.com", "b@example.com"}}},
+	}, []map[string]any{
+		{"path": "/srv/backup/payroll.csv", "size": 4000, "permissions": "-rw-------",
+			"hashes":       map[string]string{"sha256": "aaa"},
+			"fuzzy_hashes": map[string]string{"tlsh": tlshOf(t, original)},
+			"collection_warnings": []string{
+				"content scan truncated at 1048576 bytes",
+				"text extraction failed: unexpected EOF",
+			}},
+		{"record_type": "metrics", "start_time": "2026-01-01T00:00:00Z", "end_time": "2026-01-01T00:05:00Z", "total_files": 3},
+	})
+	writeScan(t, second, []map[string]any{
+		{"path": "/home/bob/payroll-draft.csv", "size": 9000, "permissions": "-rw-rw-r--",
+			"fuzzy_hashes":   map[string]string{"tlsh": tlshOf(t, edited)},
+			"sensitive_data": map[string][]string{"email": {"c@example.com"}}},
+		{"path": "/tmp/big.iso", "size": 1 << 30,
+			"collection_warnings": []string{"content scan truncated at 2097152 bytes"}},
+	})
+
+	r, err := Scans([]string{first, second}, Options{Top: 2})
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if r.Files != 5 || r.FilesWithMatches != 3 || len(r.Scans) != 2 || r.Scans[0].Files != 3 || r.Scans[0].Metrics == nil {
+		t.Fatalf("unexpected totals: %+v", r)
+	}
+	if len(r.TopDirectories) != 2 || r.TopDirectories[0] != (DirectoryMatches{Directory: "/srv/hr", Matches: 14, Files: 2}) {
+		t.Fatalf("unexpected top directories: %+v", r.TopDirectories)
+	}
+	wantTypes := []TypeMatches{{Type: "ssn", Matches: 12, Files: 1}, {Type: "email", Matches: 3, Files: 2}}
+	if !slices.Equal(r.MatchesByType, wantTypes) {
+		t.Fatalf("matches by type = %+v, want %+v", r.MatchesByType, wantTypes)
+	}
+	if len(r.LargestFiles) != 2 || r.LargestFiles[0].Path != "/tmp/big.iso" || r.LargestFiles[1].Path != "/home/bob/payroll-draft.csv" {
+		t.Fatalf("unexpected largest files: %+v", r.LargestFiles)
+	}
+	if len(r.Duplicates) != 1 || r.Duplicates[0].Wasted != 4000 ||
+		!slices.Equal(r.Duplicates[0].Paths, []string{"/srv/backup/payroll.csv", "/srv/hr/payroll.csv"}) {
+		t.Fatalf("unexpected duplicates: %+v", r.Duplicates)
+	}
+	if len(r.NearDuplicates) != 1 || len(r.NearDuplicates[0].Paths) != 3 || r.NearDuplicates[0].MaxDistance == 0 {
+		t.Fatalf("unexpected near duplicates: %+v", r.NearDuplicates)
+	}
+	if r.WorldReadableCount != 2 || r.WorldReadableSensitive[0].Path != "/srv/hr/payroll.csv" {
+		t.Fatalf("unexpected world-readable files: %+v", r.WorldReadableSensitive)
+	}
+	wantWarnings := []WarningCount{
+		{Source: "file", Category: "content scan truncated at N bytes", Count: 2, Example: "content scan truncated at 1048576 bytes"},
+		{Source: "file", Category: "text extraction failed", Count: 1, Example: "text extraction failed: unexpected EOF"},
+		{Source: "system_info", Category: "processes", Count: 1, Example: "permission denied"},
+	}
+	if !slices.Equal(r.Warnings, wantWarnings) {
+		t.Fatalf("warnings = %+v, want %+v", r.Warnings, wantWarnings)
+	}
+}
+
+func TestWriteFormats(t *testing.T) {
+	dir := t.TempDir()
+	scan := filepath.Join(dir, "scan.ndjson")
+	writeScan(t, scan, []map[string]any{
+		{"path": "/srv/<script>.txt", "size": 10, "permissions": "-rw-r--r--",
+			"sensitive_data": map[string][]string{"email": {"a@example.com"}}},
+	})
+	r, err := Scans([]string{scan}, Options{})
+	if err != nil {
+		t.Fatalf("report: %v", err)
+	}
+
+	var text bytes.Buffer
+	if err := r.Write(&text, "text"); err != nil {
+		t.Fatalf("text: %v", err)
+	}
+	if !strings.Contains(text.String(), "World-readable files with sensitive data (1)") {
+		t.Fatalf("unexpected text report:\n%s", text.String())
+	}
+
+	var out bytes.Buffer
+	if err := r.Write(&out, "json"); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("parse json: %v", err)
+	}
+	if decoded.Files != 1 || decoded.MatchesByType[0].Type != "email" {
+		t.Fatalf("unexpected json report: %s", out.String())
+	}
+
+	var page bytes.Buffer
+	if err := r.Write(&page, "html"); err != nil {
+		t.Fatalf("html: %v", err)
+	}
+	if !strings.Contains(page.String(), "/srv/&lt;script&gt;.txt") || strings.Contains(page.String(), "<script>") {
+		t.Fatalf("expected escaped paths in the html report")
+	}
+
+	if err := r.Write(&out, "xml"); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,344 @@
+package scanner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"safnari/config"
+)
+
+// archivePathSeparator joins an archive path and a member name into the
+// virtual path reported for member records, e.g. bundle.zip!/conf/app.env.
+const archivePathSeparator = "!/"
+
+type archiveKind int
+
+const (
+	archiveKindNone archiveKind = iota
+	archiveKindZip
+	archiveKindTar
+	archiveKindGzip
+)
+
+var errArchiveBudgetExhausted = errors.New("archive budget exhausted")
+
+func detectArchiveKind(mimeType string) archiveKind {
+	switch mimeType {
+	case "application/zip", "application/java-archive":
+		return archiveKindZip
+	case "application/x-tar":
+		return archiveKindTar
+	case "application/gzip":
+		return archiveKindGzip
+	default:
+		return archiveKindNone
+	}
+}
+
+// archiveBudget is shared by every nesting level below one on-disk archive so
+// that depth, member-count and decompressed-size limits apply to the whole
+// tree rather than to each nested archive separately.
+type archiveBudget struct {
+	maxMembers int
+	maxBytes   int64
+	members    int
+	bytes      int64
+}
+
+func newArchiveBudget(cfg *config.Config) *archiveBudget {
+	return &archiveBudget{
+		maxMembers: cfg.ArchiveMaxMembers,
+		maxBytes:   cfg.ArchiveMaxBytes,
+	}
+}
+
+func (b *archiveBudget) remainingBytes() int64 {
+	if b.maxBytes <= 0 {
+		return -1
+	}
+	remaining := b.maxBytes - b.bytes
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+type archiveMemberInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i archiveMemberInfo) Name() string       { return i.name }
+func (i archiveMemberInfo) Size() int64        { return i.size }
+func (i archiveMemberInfo) Mode() fs.FileMode  { return i.mode }
+func (i archiveMemberInfo) ModTime() time.Time { return i.modTime }
+func (i archiveMemberInfo) IsDir() bool        { return false }
+func (i archiveMemberInfo) Sys() any           { return nil }
+
+type archiveModule struct{}
+
+func (m archiveModule) Name() string { return "archive" }
+
+func (m archiveModule) Enabled(cfg *config.Config) bool { return cfg.ScanArchives }
+
+func (m archiveModule) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
+	kind := detectArchiveKind(fc.MimeType())
+	if kind == archiveKindNone || fc.allowlisted {
+		return nil
+	}
+	if fc.archiveDepth >= fc.Cfg.ArchiveMaxDepth {
+		fc.addWarning(fmt.Sprintf("archive nesting deeper than %d levels not scanned", fc.Cfg.ArchiveMaxDepth))
+		return nil
+	}
+	source, err := fc.Source()
+	if err != nil {
+		return err
+	}
+	if fc.archiveBudget == nil {
+		fc.archiveBudget = newArchiveBudget(fc.Cfg)
+	}
+
+	visit := func(name string, info archiveMemberInfo, r io.Reader) error {
+		return fc.collectArchiveMember(ctx, name, info, r)
+	}
+	switch kind {
+	case archiveKindZip:
+		err = walkZipArchive(fc, source, visit)
+	case archiveKindTar:
+		err = walkTarArchive(source.SectionReader(0), visit)
+	case archiveKindGzip:
+		err = walkGzipArchive(fc.Path, source.SectionReader(0), visit)
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		return err
+	case errors.Is(err, errArchiveBudgetExhausted):
+		if fc.archiveBudget.maxMembers > 0 && fc.archiveBudget.members >= fc.archiveBudget.maxMembers {
+			fc.addWarning(fmt.Sprintf("archive scan stopped after %d members", fc.archiveBudget.maxMembers))
+		} else {
+			fc.addWarning(fmt.Sprintf("archive scan stopped after %d decompressed bytes", fc.archiveBudget.maxBytes))
+		}
+	default:
+		fc.addWarning(fmt.Sprintf("archive could not be fully read: %v", err))
+	}
+	return nil
+}
+
+// collectArchiveMember reads one member into memory within the remaining
+// budget and runs the configured modules over it as a virtual file.
+func (fc *FileContext) collectArchiveMember(ctx context.Context, name string, info archiveMemberInfo, r io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	budget := fc.archiveBudget
+	if budget.maxMembers > 0 && budget.members >= budget.maxMembers {
+		return errArchiveBudgetExhausted
+	}
+	remaining := budget.remainingBytes()
+	if remaining == 0 {
+		return errArchiveBudgetExhausted
+	}
+	budget.members++
+
+	limit := archiveMemberReadLimit(fc.Cfg, remaining)
+	content, truncated, err := readArchiveMember(r, limit)
+	budget.bytes += int64(len(content))
+	if err != nil {
+		fc.addWarning(fmt.Sprintf("archive member %s could not be read: %v", name, err))
+		return nil
+	}
+	if !truncated || info.size < 0 {
+		info.size = int64(len(content))
+	}
+
+	memberPath := archiveMemberPath(fc.recordPath(), name)
+	member := &FileContext{
+		Path:              memberPath,
+		Info:              info,
+		Cfg:               fc.Cfg,
+		SensitivePatterns: fc.SensitivePatterns,
+		modules:           fc.modules,
+		archiveDepth:      fc.archiveDepth + 1,
+		archiveBudget:     budget,
+		archiveTruncated:  truncated,
+	}
+	source, err := newMemoryChunkSource(memberPath, info, fc.Cfg, content)
+	if err != nil {
+		fc.addWarning(fmt.Sprintf("archive member %s could not be read: %v", name, err))
+		return nil
+	}
+	member.source = source
+	if truncated {
+		member.addWarning(fmt.Sprintf("archive member truncated at %d bytes", len(content)))
+	}
+
+	record := &FileRecord{Path: memberPath}
+	err = collectWithModules(ctx, member, record, fc.modules)
+	member.applyRecordState(record)
+	_ = member.Close()
+	if err != nil {
+		return err
+	}
+	fc.archiveMembers = append(fc.archiveMembers, record)
+	fc.archiveMembers = append(fc.archiveMembers, member.archiveMembers...)
+	if budget.maxMembers > 0 && budget.members >= budget.maxMembers {
+		return errArchiveBudgetExhausted
+	}
+	return nil
+}
+
+func archiveMemberReadLimit(cfg *config.Config, remaining int64) int64 {
+	limit := remaining
+	if cfg.MaxFileSize > 0 && (limit < 0 || cfg.MaxFileSize < limit) {
+		limit = cfg.MaxFileSize
+	}
+	return limit
+}
+
+func readArchiveMember(r io.Reader, limit int64) ([]byte, bool, error) {
+	if limit < 0 {
+		content, err := io.ReadAll(r)
+		return content, false, err
+	}
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(content)) > limit {
+		return content[:limit], true, nil
+	}
+	return content, false, nil
+}
+
+func archiveMemberPath(archivePath, name string) string {
+	cleaned := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	return archivePath + archivePathSeparator + cleaned
+}
+
+type archiveVisitFunc func(name string, info archiveMemberInfo, r io.Reader) error
+
+func walkZipArchive(fc *FileContext, source *ChunkSource, visit archiveVisitFunc) error {
+	reader, err := zip.NewReader(source.reader, source.Size())
+	if err != nil {
+		return err
+	}
+	encrypted := 0
+	for _, f := range reader.File {
+		mode := f.Mode()
+		if !mode.IsRegular() {
+			continue
+		}
+		if f.Flags&0x1 != 0 {
+			encrypted++
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			fc.addWarning(fmt.Sprintf("archive member %s could not be read: %v", f.Name, err))
+			continue
+		}
+		info := archiveMemberInfo{
+			name:    path.Base(f.Name),
+			size:    int64(f.UncompressedSize64),
+			mode:    mode,
+			modTime: f.Modified,
+		}
+		err = visit(f.Name, info, rc)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	if encrypted > 0 {
+		fc.addWarning(fmt.Sprintf("%d encrypted archive members skipped", encrypted))
+	}
+	return nil
+}
+
+func walkTarArchive(r io.Reader, visit archiveVisitFunc) error {
+	reader := tar.NewReader(r)
+	for {
+		hdr, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		info := hdr.FileInfo()
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		member := archiveMemberInfo{
+			name:    info.Name(),
+			size:    hdr.Size,
+			mode:    info.Mode(),
+			modTime: hdr.ModTime,
+		}
+		if err := visit(hdr.Name, member, reader); err != nil {
+			return err
+		}
+	}
+}
+
+// walkGzipArchive treats a compressed tarball as its tar members and any other
+// gzip stream as a single member named after the original file.
+func walkGzipArchive(archivePath string, r io.Reader, visit archiveVisitFunc) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	buffered := bufio.NewReaderSize(gz, 4096)
+	if header, _ := buffered.Peek(512); isTarHeader(header) {
+		return walkTarArchive(buffered, visit)
+	}
+
+	name := path.Base(filepath.ToSlash(gz.Name))
+	if gz.Name == "" || name == "." || name == "/" {
+		name = gzipMemberName(archivePath)
+	}
+	info := archiveMemberInfo{
+		name:    name,
+		size:    -1,
+		mode:    0o644,
+		modTime: gz.ModTime,
+	}
+	return visit(name, info, buffered)
+}
+
+func isTarHeader(header []byte) bool {
+	if len(header) < 262 {
+		return false
+	}
+	return bytes.HasPrefix(header[257:], []byte("ustar"))
+}
+
+func gzipMemberName(archivePath string) string {
+	base := path.Base(filepath.ToSlash(archivePath))
+	lower := strings.ToLower(base)
+	switch {
+	case strings.HasSuffix(lower, ".tgz"):
+		return base[:len(base)-len(".tgz")] + ".tar"
+	case strings.HasSuffix(lower, ".gz"):
+		return base[:len(base)-len(".gz")]
+	default:
+		return base
+	}
+}
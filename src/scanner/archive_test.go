@@ -0,0 +1,209 @@
+package scanner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"safnari/config"
+)
+
+func archiveTestConfig() *config.Config {
+	return &config.Config{
+		ScanFiles:         true,
+		ScanSensitive:     true,
+		ScanArchives:      true,
+		ArchiveMaxDepth:   3,
+		ArchiveMaxMembers: 100,
+		ArchiveMaxBytes:   1 << 20,
+		HashAlgorithms:    []string{"sha256"},
+		MaxFileSize:       1 << 20,
+	}
+}
+
+func writeZipArchive(t *testing.T, path string, members map[string][]byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range members {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip create %s: %v", name, err)
+		}
+		if _, err := w.Write(content); err != nil {
+			t.Fatalf("zip write %s: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("write zip: %v", err)
+	}
+}
+
+func tarGzBytes(t *testing.T, members map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range members {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("tar header %s: %v", name, err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatalf("tar write %s: %v", name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar close: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func findRecord(records []*FileRecord, path string) *FileRecord {
+	for _, record := range records {
+		if record.Path == path {
+			return record
+		}
+	}
+	return nil
+}
+
+func TestCollectFileRecordsScansZipMembers(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "bundle.zip")
+	writeZipArchive(t, archive, map[string][]byte{
+		"conf/app.env": []byte("contact=ops@example.com\n"),
+		"README":       []byte("nothing to see"),
+	})
+	info, err := os.Stat(archive)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	cfg := archiveTestConfig()
+	patterns := GetPatterns([]string{"email"}, nil, nil)
+	parent, members, err := collectFileRecords(context.Background(), archive, info, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if parent.MimeType != "application/zip" {
+		t.Fatalf("expected zip parent record, got %q", parent.MimeType)
+	}
+	if len(members) != 2 {
+		t.Fatalf("expected 2 member records, got %d", len(members))
+	}
+	env := findRecord(members, archive+"!/conf/app.env")
+	if env == nil {
+		t.Fatalf("missing member record for conf/app.env: %+v", members)
+	}
+	if got := env.SensitiveData["email"]; len(got) != 1 || got[0] != "ops@example.com" {
+		t.Fatalf("expected email match in member, got %v", env.SensitiveData)
+	}
+	if env.Hashes["sha256"] == "" {
+		t.Fatal("expected member hash")
+	}
+	if env.Name != "app.env" || env.Size != int64(len("contact=ops@example.com\n")) {
+		t.Fatalf("unexpected member inventory: name=%q size=%d", env.Name, env.Size)
+	}
+}
+
+func TestCollectFileRecordsScansNestedTarGz(t *testing.T) {
+	dir := t.TempDir()
+	inner := tarGzBytes(t, map[string][]byte{"logs/app.log": []byte("token api_key=abcd1234\n")})
+	archive := filepath.Join(dir, "outer.zip")
+	writeZipArchive(t, archive, map[string][]byte{"inner.tar.gz": inner})
+	info, err := os.Stat(archive)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	cfg := archiveTestConfig()
+	patterns := GetPatterns([]string{"api_key"}, nil, nil)
+	_, members, err := collectFileRecords(context.Background(), archive, info, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	nested := findRecord(members, archive+"!/inner.tar.gz!/logs/app.log")
+	if nested == nil {
+		t.Fatalf("missing nested tar member: %d records", len(members))
+	}
+	if len(nested.SensitiveData["api_key"]) != 1 {
+		t.Fatalf("expected api_key match in nested member, got %v", nested.SensitiveData)
+	}
+
+	cfg.ArchiveMaxDepth = 1
+	parent, members, err := collectFileRecords(context.Background(), archive, info, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect depth-limited: %v", err)
+	}
+	if len(members) != 1 {
+		t.Fatalf("expected only the first nesting level, got %d records", len(members))
+	}
+	if len(members[0].CollectionWarnings) == 0 {
+		t.Fatalf("expected depth warning on nested archive record, parent warnings=%v", parent.CollectionWarnings)
+	}
+}
+
+func TestCollectFileRecordsArchiveLimits(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "many.zip")
+	members := make(map[string][]byte, 5)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt", "e.txt"} {
+		members[name] = []byte(strings.Repeat("x", 64))
+	}
+	writeZipArchive(t, archive, members)
+	info, err := os.Stat(archive)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	cfg := archiveTestConfig()
+	cfg.ArchiveMaxMembers = 2
+	parent, records, err := collectFileRecords(context.Background(), archive, info, cfg, nil, testFileModules(t, cfg, nil), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected member limit to cap records at 2, got %d", len(records))
+	}
+	if !strings.Contains(strings.Join(parent.CollectionWarnings, ";"), "archive scan stopped after 2 members") {
+		t.Fatalf("expected member limit warning, got %v", parent.CollectionWarnings)
+	}
+
+	cfg = archiveTestConfig()
+	cfg.ArchiveMaxBytes = 100
+	parent, records, err = collectFileRecords(context.Background(), archive, info, cfg, nil, testFileModules(t, cfg, nil), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected byte budget to stop after the second member, got %d", len(records))
+	}
+	if records[1].Hashes != nil {
+		t.Fatal("expected truncated member to skip full-file hashing")
+	}
+	if !strings.Contains(strings.Join(parent.CollectionWarnings, ";"), "decompressed bytes") {
+		t.Fatalf("expected byte budget warning, got %v", parent.CollectionWarnings)
+	}
+}
+
+func TestArchiveMemberPathNormalizesTraversal(t *testing.T) {
+	if got := archiveMemberPath("/tmp/a.zip", "../../etc/passwd"); got != "/tmp/a.zip!/etc/passwd" {
+		t.Fatalf("unexpected member path: %s", got)
+	}
+	if got := gzipMemberName("/tmp/backup.tgz"); got != "backup.tar" {
+		t.Fatalf("unexpected gzip member name: %s", got)
+	}
+}
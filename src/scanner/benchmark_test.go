@@ -45,7 +45,7 @@ func BenchmarkCollectFileData(b *testing.B) {
 	}
 	cfg := benchmarkScannerConfig()
 	patterns := GetPatterns([]string{"email"}, nil, nil)
-	prebuiltModules := buildFileModules(cfg, patterns)
+	prebuiltModules := testFileModules(b, cfg, patterns)
 	ctx := context.Background()
 
 	b.Run("build-modules-per-call", func(b *testing.B) {
@@ -77,7 +77,7 @@ func BenchmarkBuildFileModules(b *testing.B) {
 
 	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
-		benchmarkModulesSink = buildFileModules(cfg, patterns)
+		benchmarkModulesSink, _ = buildFileModules(cfg, patterns)
 	}
 }
 
@@ -106,7 +106,7 @@ func BenchmarkProcessFileStatOverhead(b *testing.B) {
 	}
 	w := &output.Writer{}
 	ctx := context.Background()
-	modules := buildFileModules(cfg, nil)
+	modules := testFileModules(b, cfg, nil)
 
 	b.Run("stat-inside-worker", func(b *testing.B) {
 		b.ReportAllocs()
@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -26,13 +27,16 @@ var chunkSourceBufferPool = sync.Pool{
 }
 
 // ChunkSource owns a single file descriptor and exposes reusable accessors for
-// header sampling, text detection, and forward-only chunk iteration.
+// header sampling, text detection, and forward-only chunk iteration. Archive
+// members are served from memory through the same accessors.
 type ChunkSource struct {
 	path string
 	info os.FileInfo
 	cfg  *config.Config
 
-	file *os.File
+	file   *os.File
+	reader io.ReaderAt
+	size   int64
 
 	header    []byte
 	mimeType  string
@@ -45,11 +49,17 @@ func openChunkSource(path string, info os.FileInfo, cfg *config.Config) (*ChunkS
 		return nil, err
 	}
 
+	size := int64(0)
+	if info != nil {
+		size = info.Size()
+	}
 	s := &ChunkSource{
-		path: path,
-		info: info,
-		cfg:  cfg,
-		file: file,
+		path:   path,
+		info:   info,
+		cfg:    cfg,
+		file:   file,
+		reader: file,
+		size:   size,
 	}
 	if err := s.initHeader(); err != nil {
 		_ = file.Close()
@@ -58,13 +68,29 @@ func openChunkSource(path string, info os.FileInfo, cfg *config.Config) (*ChunkS
 	return s, nil
 }
 
+// newMemoryChunkSource wraps already-decoded content, such as an archive
+// member, so it can flow through the regular content pipeline.
+func newMemoryChunkSource(path string, info os.FileInfo, cfg *config.Config, content []byte) (*ChunkSource, error) {
+	s := &ChunkSource{
+		path:   path,
+		info:   info,
+		cfg:    cfg,
+		reader: bytes.NewReader(content),
+		size:   int64(len(content)),
+	}
+	if err := s.initHeader(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 func (s *ChunkSource) initHeader() error {
-	if s == nil || s.file == nil {
+	if s == nil || s.reader == nil {
 		return fmt.Errorf("chunk source is not open")
 	}
 	size := chunkSourceHeaderBytes
-	if s.info != nil && s.info.Size() > 0 && s.info.Size() < int64(size) {
-		size = int(s.info.Size())
+	if s.size > 0 && s.size < int64(size) {
+		size = int(s.size)
 	}
 	if size < 0 {
 		size = 0
@@ -74,7 +100,7 @@ func (s *ChunkSource) initHeader() error {
 		s.mimeType = "unknown"
 		return nil
 	}
-	n, err := s.file.ReadAt(s.header, 0)
+	n, err := s.reader.ReadAt(s.header, 0)
 	if err != nil && err != io.EOF {
 		return err
 	}
@@ -90,7 +116,11 @@ func (s *ChunkSource) initHeader() error {
 }
 
 func (s *ChunkSource) Close() error {
-	if s == nil || s.file == nil {
+	if s == nil || s.reader == nil {
+		return nil
+	}
+	s.reader = nil
+	if s.file == nil {
 		return nil
 	}
 	err := s.file.Close()
@@ -98,6 +128,7 @@ func (s *ChunkSource) Close() error {
 	return err
 }
 
+// File returns the backing descriptor, or nil for in-memory sources.
 func (s *ChunkSource) File() *os.File {
 	if s == nil {
 		return nil
@@ -140,21 +171,25 @@ func (s *ChunkSource) ShouldSearchContent() bool {
 	return false
 }
 
+func (s *ChunkSource) Size() int64 {
+	if s == nil {
+		return 0
+	}
+	return s.size
+}
+
 func (s *ChunkSource) SectionReader(limit int64) *io.SectionReader {
-	if s == nil || s.file == nil {
+	if s == nil || s.reader == nil {
 		return io.NewSectionReader(strings.NewReader(""), 0, 0)
 	}
-	size := int64(0)
-	if s.info != nil {
-		size = s.info.Size()
-	}
+	size := s.size
 	if limit > 0 && (size == 0 || size > limit) {
 		size = limit
 	}
 	if size < 0 {
 		size = 0
 	}
-	return io.NewSectionReader(s.file, 0, size)
+	return io.NewSectionReader(s.reader, 0, size)
 }
 
 func (s *ChunkSource) ReadAll(limit int64) ([]byte, error) {
@@ -166,7 +201,7 @@ func (s *ChunkSource) ReadAll(limit int64) ([]byte, error) {
 }
 
 func (s *ChunkSource) ReadRange(start, length int64) ([]byte, error) {
-	if s == nil || s.file == nil {
+	if s == nil || s.reader == nil {
 		return nil, fmt.Errorf("chunk source is not open")
 	}
 	if start < 0 {
@@ -175,10 +210,7 @@ func (s *ChunkSource) ReadRange(start, length int64) ([]byte, error) {
 	if length < 0 {
 		length = 0
 	}
-	size := int64(0)
-	if s.info != nil {
-		size = s.info.Size()
-	}
+	size := s.size
 	if start > size {
 		start = size
 	}
@@ -188,11 +220,11 @@ func (s *ChunkSource) ReadRange(start, length int64) ([]byte, error) {
 	if length < 0 {
 		length = 0
 	}
-	return io.ReadAll(io.NewSectionReader(s.file, start, length))
+	return io.ReadAll(io.NewSectionReader(s.reader, start, length))
 }
 
 func (s *ChunkSource) Scan(limit int64, fn func(chunk []byte, offset int64) error) error {
-	if s == nil || s.file == nil {
+	if s == nil || s.reader == nil {
 		return fmt.Errorf("chunk source is not open")
 	}
 	if fn == nil {
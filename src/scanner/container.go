@@ -0,0 +1,298 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"safnari/config"
+	"safnari/container"
+	"safnari/logger"
+	"safnari/output"
+	"safnari/tracing"
+)
+
+// containerFile is a file of an unpacked container layer. It is read from
+// its host path and reported under the container's logical root.
+type containerFile struct {
+	path string
+	ref  *ContainerRef
+	// shared lists the other targets the layer file belongs to. The file is
+	// scanned once and its records written again under each of them.
+	shared []*containerFile
+}
+
+// sharedLayerFiles holds back the files of layers that several on-disk
+// targets use, such as the image layers of containers started from the same
+// image, until every target has been walked. Each file is then scanned once
+// for all the targets holding it.
+type sharedLayerFiles struct {
+	dirs  map[string]bool
+	files map[string]*containerFile
+	tasks []fileScanTask
+}
+
+func newSharedLayerFiles(targets []*container.Target) *sharedLayerFiles {
+	return &sharedLayerFiles{dirs: sharedLayerDirs(targets), files: make(map[string]*containerFile)}
+}
+
+// sharedLayerDirs returns the layer directories used by more than one
+// on-disk target.
+func sharedLayerDirs(targets []*container.Target) map[string]bool {
+	users := make(map[string]int)
+	for _, target := range targets {
+		if !target.OnDisk() {
+			continue
+		}
+		for _, layer := range target.Layers {
+			users[layer.Dir]++
+		}
+	}
+	dirs := make(map[string]bool)
+	for dir, n := range users {
+		if n > 1 {
+			dirs[dir] = true
+		}
+	}
+	return dirs
+}
+
+// add keeps file back if its layer is shared, attaching it to the first
+// target that reached the same host file, and reports whether it did.
+func (s *sharedLayerFiles) add(entry container.Entry, file *containerFile) bool {
+	if !s.dirs[entry.Layer.Dir] {
+		return false
+	}
+	if first, ok := s.files[entry.HostPath]; ok {
+		first.shared = append(first.shared, file)
+		return true
+	}
+	s.files[entry.HostPath] = file
+	s.tasks = append(s.tasks, fileScanTask{path: entry.HostPath, info: entry.Info, container: file})
+	return true
+}
+
+// discoverContainerTargets lists the containers and images the scan covers.
+// Runtimes or images that cannot be read are logged and skipped.
+func discoverContainerTargets(cfg *config.Config) []*container.Target {
+	var targets []*container.Target
+	add := func(source string, found []container.Target, err error) {
+		if err != nil {
+			logger.Warnf("Failed to read %s: %v", source, err)
+		}
+		for i := range found {
+			targets = append(targets, &found[i])
+		}
+	}
+	if cfg.ScanContainers {
+		found, err := container.DiscoverDocker(cfg.DockerRoot)
+		add("Docker containers in "+cfg.DockerRoot, found, err)
+		found, err = container.DiscoverContainerd(cfg.ContainerdRoot)
+		add("containerd containers in "+cfg.ContainerdRoot, found, err)
+	}
+	for _, image := range cfg.ContainerImages {
+		found, err := container.OpenImage(image)
+		add("container image "+image, found, err)
+	}
+	logger.Infof("Containers and images to scan: %d", len(targets))
+	return targets
+}
+
+// containerRecordPath is the path of a file inside a target as written to
+// its record, in the form used for archive members.
+func containerRecordPath(target *container.Target, entryPath string) string {
+	return target.Root + archivePathSeparator + strings.TrimPrefix(entryPath, "/")
+}
+
+func containerRef(target *container.Target, entry container.Entry) *ContainerRef {
+	return &ContainerRef{
+		Runtime:     target.Runtime,
+		ID:          target.ID,
+		Name:        target.Name,
+		Image:       target.Image,
+		ImageID:     target.ImageID,
+		ImageDigest: target.ImageDigest,
+		LayerDigest: entry.Layer.Digest,
+		Path:        entry.Path,
+		Shadowed:    entry.Shadowed,
+	}
+}
+
+// processContainerFile scans a file of an unpacked container layer in place.
+func processContainerFile(
+	ctx context.Context,
+	path string,
+	fileInfo os.FileInfo,
+	file *containerFile,
+	cfg *config.Config,
+	w *output.Writer,
+	sensitivePatterns map[string]*regexp.Regexp,
+	modules []FileModule,
+	deltaCache *DeltaChunkCache,
+) error {
+	ctx, endTask := tracing.StartTask(ctx, "process_container_file")
+	tracing.Log(ctx, "file", file.path)
+	defer endTask()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	w.IncrementScanned()
+	data, members, err := collectContextRecords(ctx, &FileContext{
+		Path:              path,
+		reportPath:        file.path,
+		Info:              fileInfo,
+		Cfg:               cfg,
+		SensitivePatterns: sensitivePatterns,
+		deltaCache:        deltaCache,
+	}, modules)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		logger.Warnf("Failed to process file %s: %v", file.path, err)
+		return nil
+	}
+	for _, other := range file.shared {
+		// The records are queued by reference, so each target writes its
+		// own copies.
+		otherData, otherMembers := relocateRecords(data, members, file.path, other.path)
+		if err := writeContainerRecords(cfg, w, other.ref, otherData, otherMembers); err != nil {
+			return err
+		}
+	}
+	return writeContainerRecords(cfg, w, file.ref, data, members)
+}
+
+// relocateRecords copies a file's records from one record path to another.
+// The copies share the collected fields of the originals.
+func relocateRecords(data *FileRecord, members []*FileRecord, from, to string) (*FileRecord, []*FileRecord) {
+	relocated := *data
+	relocated.Path = to
+	var relocatedMembers []*FileRecord
+	for _, member := range members {
+		copied := *member
+		copied.Path = to + strings.TrimPrefix(member.Path, from)
+		relocatedMembers = append(relocatedMembers, &copied)
+	}
+	return &relocated, relocatedMembers
+}
+
+// scanContainerImage scans the files of a target whose layers are tar
+// streams, such as an image tarball, reading each file into memory within
+// the archive limits. It returns the number of files scanned.
+func scanContainerImage(
+	ctx context.Context,
+	target *container.Target,
+	cfg *config.Config,
+	w *output.Writer,
+	sensitivePatterns map[string]*regexp.Regexp,
+	modules []FileModule,
+	include func(path string, info os.FileInfo) bool,
+) (int, error) {
+	ctx, endTask := tracing.StartTask(ctx, "scan_container_image")
+	tracing.Log(ctx, "image", target.Root)
+	defer endTask()
+
+	limit := archiveMemberReadLimit(cfg, -1)
+	if cfg.ArchiveMaxBytes > 0 {
+		limit = archiveMemberReadLimit(cfg, cfg.ArchiveMaxBytes)
+	}
+	scanned := 0
+	err := target.Walk(ctx, func(entry container.Entry) error {
+		path := containerRecordPath(target, entry.Path)
+		if !include(path, entry.Info) {
+			return nil
+		}
+		scanned++
+		w.IncrementScanned()
+		content, truncated, err := readArchiveMember(entry.Content, limit)
+		if err != nil {
+			logger.Warnf("Failed to read %s: %v", path, err)
+			return nil
+		}
+		source, err := newMemoryChunkSource(path, entry.Info, cfg, content)
+		if err != nil {
+			logger.Warnf("Failed to read %s: %v", path, err)
+			return nil
+		}
+		// Layer files have no host path, so they are handled like archive
+		// members: modules that read the host filesystem skip them.
+		fc := &FileContext{
+			Path:              path,
+			Info:              entry.Info,
+			Cfg:               cfg,
+			SensitivePatterns: sensitivePatterns,
+			source:            source,
+			archiveDepth:      1,
+			archiveTruncated:  truncated,
+		}
+		if truncated {
+			fc.addWarning(fmt.Sprintf("layer file truncated at %d bytes", len(content)))
+		}
+		data, members, err := collectContextRecords(ctx, fc, modules)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			logger.Warnf("Failed to process file %s: %v", path, err)
+			return nil
+		}
+		if err := writeContainerRecords(cfg, w, containerRef(target, entry), data, members); err != nil {
+			return &containerWriteError{err}
+		}
+		return nil
+	})
+	var writeErr *containerWriteError
+	switch {
+	case errors.As(err, &writeErr):
+		return scanned, writeErr.err
+	case err != nil && ctx.Err() != nil:
+		return scanned, ctx.Err()
+	case err != nil:
+		logger.Warnf("Failed to read image %s: %v", target.Root, err)
+	}
+	return scanned, nil
+}
+
+// containerWriteError carries a failure to write output out of a layer walk,
+// so it ends the scan instead of being logged as an unreadable layer.
+type containerWriteError struct{ err error }
+
+func (e *containerWriteError) Error() string { return e.err.Error() }
+
+// writeContainerRecords attaches the container reference to a file's record
+// and to those of its archive members, then writes them.
+func writeContainerRecords(cfg *config.Config, w *output.Writer, ref *ContainerRef, data *FileRecord, members []*FileRecord) error {
+	data.Container = ref
+	for _, member := range members {
+		member.Container = ref
+	}
+	return writeFileRecords(cfg, w, data, members)
+}
+
+// countContainerFiles counts the files of unpacked container layers for the
+// progress bar, counting a file of a shared layer once. Tar layers are not
+// read twice, so image files are not counted ahead.
+func countContainerFiles(ctx context.Context, targets []*container.Target, include func(path string, info os.FileInfo) bool) int {
+	count := 0
+	shared := newSharedLayerFiles(targets)
+	for _, target := range targets {
+		if !target.OnDisk() {
+			continue
+		}
+		_ = target.Walk(ctx, func(entry container.Entry) error {
+			if !include(containerRecordPath(target, entry.Path), entry.Info) {
+				return nil
+			}
+			if !shared.add(entry, &containerFile{}) {
+				count++
+			}
+			return nil
+		})
+	}
+	return count + len(shared.tasks)
+}
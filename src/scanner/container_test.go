@@ -0,0 +1,234 @@
+package scanner
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"safnari/config"
+	"safnari/output"
+	"safnari/systeminfo"
+)
+
+func containerTestTar(t *testing.T, pairs ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if err := tw.WriteHeader(&tar.Header{Name: pairs[i], Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(pairs[i+1]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(pairs[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func containerTestDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeContainerFixture(t *testing.T, root, name string, data []byte) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanFilesCoversContainersAndImages(t *testing.T) {
+	dir := t.TempDir()
+
+	// A docker save archive whose second layer deletes a secret the first
+	// one added.
+	imageDir := filepath.Join(dir, "image")
+	base := containerTestTar(t, "app/.env", "API_KEY=baked-in")
+	top := containerTestTar(t, "app/.wh..env", "", "app/main.py", "print(1)")
+	imageConfig, _ := json.Marshal(map[string]any{"rootfs": map[string]any{
+		"diff_ids": []string{"sha256:" + containerTestDigest(base), "sha256:" + containerTestDigest(top)},
+	}})
+	configName := containerTestDigest(imageConfig) + ".json"
+	writeContainerFixture(t, imageDir, configName, imageConfig)
+	writeContainerFixture(t, imageDir, "base/layer.tar", base)
+	writeContainerFixture(t, imageDir, "top/layer.tar", top)
+	manifest, _ := json.Marshal([]map[string]any{{"Config": configName, "RepoTags": []string{"app:1"}, "Layers": []string{"base/layer.tar", "top/layer.tar"}}})
+	writeContainerFixture(t, imageDir, "manifest.json", manifest)
+
+	// A Docker overlay2 container with one image layer and its writable
+	// layer.
+	dockerRoot := filepath.Join(dir, "docker")
+	const id = "c0ffee"
+	diffID := "sha256:" + containerTestDigest([]byte("layer"))
+	writeContainerFixture(t, dockerRoot, "containers/"+id+"/config.v2.json", []byte(`{"ID":"c0ffee","Name":"/web","Image":"sha256:abc","Driver":"overlay2","Config":{"Image":"nginx:1.27"}}`))
+	writeContainerFixture(t, dockerRoot, "image/overlay2/layerdb/mounts/"+id+"/mount-id", []byte("rw"))
+	writeContainerFixture(t, dockerRoot, "image/overlay2/layerdb/mounts/"+id+"/parent", []byte(diffID))
+	writeContainerFixture(t, dockerRoot, "image/overlay2/layerdb/sha256/"+diffID[len("sha256:"):]+"/diff", []byte(diffID))
+	writeContainerFixture(t, dockerRoot, "image/overlay2/layerdb/sha256/"+diffID[len("sha256:"):]+"/cache-id", []byte("ro"))
+	writeContainerFixture(t, dockerRoot, "overlay2/ro/diff/etc/nginx.conf", []byte("worker_processes 1;"))
+	writeContainerFixture(t, dockerRoot, "overlay2/rw/diff/tmp/dump.sql", []byte("insert"))
+
+	cfg := &config.Config{
+		OutputFileName:  filepath.Join(dir, "out.ndjson"),
+		OutputFormat:    "json",
+		NiceLevel:       "low",
+		ScanFiles:       true,
+		MaxFileSize:     1 << 20,
+		ArchiveMaxBytes: 1 << 20,
+		SkipCount:       false,
+		HashAlgorithms:  []string{"sha256"},
+		ScanContainers:  true,
+		ContainerImages: []string{imageDir},
+		DockerRoot:      dockerRoot,
+		ContainerdRoot:  filepath.Join(dir, "containerd"),
+	}
+	metrics := &output.Metrics{}
+	w, err := output.New(cfg, &systeminfo.SystemInfo{}, metrics)
+	if err != nil {
+		t.Fatalf("output init: %v", err)
+	}
+	if err := ScanFiles(context.Background(), cfg, metrics, w); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	var records []FileRecord
+	err = output.ReadRecords(cfg.OutputFileName, func(recordType string, payload json.RawMessage) error {
+		if recordType != "file" {
+			return nil
+		}
+		var record FileRecord
+		if err := json.Unmarshal(payload, &record); err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read records: %v", err)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Path < records[j].Path })
+
+	imageID := "sha256:" + containerTestDigest(imageConfig)
+	imageRoot := imageDir + "@" + imageID
+	type seen struct {
+		Path   string
+		SHA256 string
+		Ref    *ContainerRef
+	}
+	var got []seen
+	for _, record := range records {
+		got = append(got, seen{record.Path, record.Hashes["sha256"], record.Container})
+	}
+	image := ContainerRef{Runtime: "image", Image: "app:1", ImageID: imageID}
+	web := ContainerRef{Runtime: "docker", ID: id, Name: "web", Image: "nginx:1.27", ImageID: "sha256:abc"}
+	with := func(ref ContainerRef, layer, path string, shadowed bool) *ContainerRef {
+		ref.LayerDigest, ref.Path, ref.Shadowed = layer, path, shadowed
+		return &ref
+	}
+	// Sorted by path, which puts the absolute image paths first.
+	want := []seen{
+		{imageRoot + "!/app/.env", containerTestDigest([]byte("API_KEY=baked-in")), with(image, "sha256:"+containerTestDigest(base), "/app/.env", true)},
+		{imageRoot + "!/app/main.py", containerTestDigest([]byte("print(1)")), with(image, "sha256:"+containerTestDigest(top), "/app/main.py", false)},
+		{"docker://c0ffee!/etc/nginx.conf", containerTestDigest([]byte("worker_processes 1;")), with(web, diffID, "/etc/nginx.conf", false)},
+		{"docker://c0ffee!/tmp/dump.sql", containerTestDigest([]byte("insert")), with(web, "", "/tmp/dump.sql", false)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected records:\n got %+v\nwant %+v", got, want)
+	}
+	if metrics.FilesScanned != 4 {
+		t.Fatalf("expected 4 files scanned, got %d", metrics.FilesScanned)
+	}
+}
+
+func TestScanFilesScansSharedLayersOnce(t *testing.T) {
+	dir := t.TempDir()
+
+	// Two Docker overlay2 containers started from the same image share its
+	// layer directory and have a writable layer each.
+	dockerRoot := filepath.Join(dir, "docker")
+	diffID := "sha256:" + containerTestDigest([]byte("layer"))
+	writeContainerFixture(t, dockerRoot, "image/overlay2/layerdb/sha256/"+diffID[len("sha256:"):]+"/diff", []byte(diffID))
+	writeContainerFixture(t, dockerRoot, "image/overlay2/layerdb/sha256/"+diffID[len("sha256:"):]+"/cache-id", []byte("ro"))
+	writeContainerFixture(t, dockerRoot, "overlay2/ro/diff/etc/nginx.conf", []byte("worker_processes 1;"))
+	for id, name := range map[string]string{"c0ffee": "web", "beef": "api"} {
+		writeContainerFixture(t, dockerRoot, "containers/"+id+"/config.v2.json", []byte(`{"ID":"`+id+`","Name":"/`+name+`","Image":"sha256:abc","Driver":"overlay2","Config":{"Image":"nginx:1.27"}}`))
+		writeContainerFixture(t, dockerRoot, "image/overlay2/layerdb/mounts/"+id+"/mount-id", []byte("rw-"+id))
+		writeContainerFixture(t, dockerRoot, "image/overlay2/layerdb/mounts/"+id+"/parent", []byte(diffID))
+		writeContainerFixture(t, dockerRoot, "overlay2/rw-"+id+"/diff/tmp/"+name+".log", []byte(name))
+	}
+
+	cfg := &config.Config{
+		OutputFileName: filepath.Join(dir, "out.ndjson"),
+		OutputFormat:   "json",
+		NiceLevel:      "low",
+		ScanFiles:      true,
+		MaxFileSize:    1 << 20,
+		HashAlgorithms: []string{"sha256"},
+		ScanContainers: true,
+		DockerRoot:     dockerRoot,
+		ContainerdRoot: filepath.Join(dir, "containerd"),
+	}
+	metrics := &output.Metrics{}
+	w, err := output.New(cfg, &systeminfo.SystemInfo{}, metrics)
+	if err != nil {
+		t.Fatalf("output init: %v", err)
+	}
+	if err := ScanFiles(context.Background(), cfg, metrics, w); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	refs := map[string]*ContainerRef{}
+	err = output.ReadRecords(cfg.OutputFileName, func(recordType string, payload json.RawMessage) error {
+		if recordType != "file" {
+			return nil
+		}
+		var record FileRecord
+		if err := json.Unmarshal(payload, &record); err != nil {
+			return err
+		}
+		refs[record.Path] = record.Container
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read records: %v", err)
+	}
+	conf := func(id, name string) *ContainerRef {
+		return &ContainerRef{Runtime: "docker", ID: id, Name: name, Image: "nginx:1.27", ImageID: "sha256:abc", LayerDigest: diffID, Path: "/etc/nginx.conf"}
+	}
+	for path, want := range map[string]*ContainerRef{
+		"docker://c0ffee!/etc/nginx.conf": conf("c0ffee", "web"),
+		"docker://beef!/etc/nginx.conf":   conf("beef", "api"),
+	} {
+		if !reflect.DeepEqual(refs[path], want) {
+			t.Fatalf("record %s has container %+v, want %+v", path, refs[path], want)
+		}
+	}
+	if len(refs) != 4 {
+		t.Fatalf("expected a record per container file, got %v", refs)
+	}
+	// The shared file is read once for both containers.
+	if metrics.FilesScanned != 3 || metrics.TotalFiles != 3 {
+		t.Fatalf("expected 3 files counted and scanned, got %d and %d", metrics.TotalFiles, metrics.FilesScanned)
+	}
+}
@@ -33,27 +33,49 @@ type deltaCacheManifest struct {
 }
 
 type deltaCachedFile struct {
-	Key               string              `json:"key"`
-	Path              string              `json:"path"`
-	ConfigFingerprint string              `json:"config_fingerprint"`
-	ChunkSize         int                 `json:"chunk_size"`
-	ReadLimit         int64               `json:"read_limit"`
-	ChunkHashes       []string            `json:"chunk_hashes"`
-	Chunks            []deltaCachedChunk  `json:"chunks,omitempty"`
-	SearchHits        map[string]int      `json:"search_hits,omitempty"`
-	SensitiveMatches  map[string][]string `json:"sensitive_matches,omitempty"`
-	SensitiveCounts   map[string]int      `json:"sensitive_counts,omitempty"`
-	FuzzyHashes       map[string]string   `json:"fuzzy_hashes,omitempty"`
+	Key                 string               `json:"key"`
+	Path                string               `json:"path"`
+	ConfigFingerprint   string               `json:"config_fingerprint"`
+	ChunkSize           int                  `json:"chunk_size"`
+	ReadLimit           int64                `json:"read_limit"`
+	ChunkHashes         []string             `json:"chunk_hashes"`
+	Chunks              []deltaCachedChunk   `json:"chunks,omitempty"`
+	SearchHits          map[string]int       `json:"search_hits,omitempty"`
+	SensitiveMatches    map[string][]string  `json:"sensitive_matches,omitempty"`
+	SensitiveCounts     map[string]int       `json:"sensitive_counts,omitempty"`
+	SensitiveConfidence map[string][]float64 `json:"sensitive_confidence,omitempty"`
+	SensitiveLocations  MatchLocations       `json:"sensitive_locations,omitempty"`
+	SearchLocations     MatchLocations       `json:"search_locations,omitempty"`
+	FuzzyHashes         map[string]string    `json:"fuzzy_hashes,omitempty"`
 }
 
+// deltaCachedChunk holds the results for one chunk. Newlines and LastNewline
+// describe the chunk's own bytes so line numbers can be rebuilt when only
+// some chunks are reanalyzed.
 type deltaCachedChunk struct {
 	SearchCounts     map[string]int             `json:"search_counts,omitempty"`
+	SearchLocations  map[string][]deltaLocation `json:"search_locations,omitempty"`
 	SensitiveMatches map[string][]deltaValueRun `json:"sensitive_matches,omitempty"`
+	Newlines         int                        `json:"newlines,omitempty"`
+	LastNewline      int64                      `json:"last_newline"`
 }
 
 type deltaValueRun struct {
-	Value string `json:"value"`
-	Count int    `json:"count"`
+	Value      string          `json:"value"`
+	Count      int             `json:"count"`
+	Confidence float64         `json:"confidence,omitempty"`
+	Locations  []deltaLocation `json:"locations,omitempty"`
+}
+
+// deltaLocation places a match relative to its chunk. LineDelta counts the
+// newlines between the chunk start and the match, negative for matches that
+// start in the previous chunk. LineStart is the absolute offset of the
+// match's line, or -1 when that line began before the analysis window.
+type deltaLocation struct {
+	Offset    int64  `json:"offset"`
+	LineDelta int    `json:"line_delta"`
+	LineStart int64  `json:"line_start"`
+	Context   string `json:"context,omitempty"`
 }
 
 // DeltaChunkCache persists chunk fingerprints and content-analysis results for
@@ -70,7 +92,9 @@ type DeltaChunkCache struct {
 	filterDirty   bool
 }
 
-func openDeltaChunkCache(cfg *config.Config) (*DeltaChunkCache, error) {
+// OpenDeltaChunkCache opens the chunk cache in cfg.DeltaCacheDir. It returns
+// nil when delta scans or the chunk cache mode are off.
+func OpenDeltaChunkCache(cfg *config.Config) (*DeltaChunkCache, error) {
 	if cfg == nil || !cfg.DeltaScan || deltaCacheMode(cfg) != "chunk" {
 		return nil, nil
 	}
@@ -106,7 +130,14 @@ func deltaCacheMode(cfg *config.Config) string {
 	return mode
 }
 
+// Close saves the manifest if it changed.
 func (c *DeltaChunkCache) Close() error {
+	return c.Flush()
+}
+
+// Flush saves the manifest if it changed. The cache stays usable, so a
+// caller that keeps it across scans can persist it after each one.
+func (c *DeltaChunkCache) Flush() error {
 	if c == nil {
 		return nil
 	}
@@ -328,8 +359,16 @@ func deltaCacheFingerprint(cfg *config.Config, patterns map[string]*regexp.Regex
 		SensitiveMaxTotal    int      `json:"sensitive_max_total"`
 		ContentScanMaxBytes  int64    `json:"content_scan_max_bytes"`
 		PatternDefs          []string `json:"pattern_defs"`
+		MinConfidence        float64  `json:"sensitive_min_confidence"`
+		KeywordProximity     bool     `json:"sensitive_keyword_proximity"`
+		EntropyBits          float64  `json:"sensitive_entropy_threshold"`
+		EntropyHexBits       float64  `json:"sensitive_entropy_hex_threshold"`
+		EntropyMinLength     int      `json:"sensitive_entropy_min_length"`
+		MatchLocations       bool     `json:"match_locations"`
+		RedactSensitive      string   `json:"redact_sensitive"`
+		RedactKeyID          string   `json:"redact_key_id"`
 	}{
-		CacheFormatVersion:   3,
+		CacheFormatVersion:   9,
 		SearchTerms:          append([]string(nil), normalizeSearchTerms(cfg.SearchTerms)...),
 		SensitiveEngine:      cfg.SensitiveEngine,
 		SensitiveLongtail:    cfg.SensitiveLongtail,
@@ -339,6 +378,14 @@ func deltaCacheFingerprint(cfg *config.Config, patterns map[string]*regexp.Regex
 		SensitiveMaxTotal:    cfg.SensitiveMaxTotal,
 		ContentScanMaxBytes:  cfg.ContentScanMaxBytes,
 		PatternDefs:          sortedPatternDefs(patterns),
+		MinConfidence:        cfg.SensitiveMinConfidence,
+		KeywordProximity:     cfg.SensitiveProximity,
+		EntropyBits:          cfg.SensitiveEntropyBits,
+		EntropyHexBits:       cfg.SensitiveEntropyHexBits,
+		EntropyMinLength:     cfg.SensitiveEntropyMinLen,
+		MatchLocations:       cfg.MatchLocations,
+		RedactSensitive:      cfg.RedactSensitive,
+		RedactKeyID:          cfg.RedactKeyID,
 	}
 	data, _ := json.Marshal(payload)
 	sum := sha256.Sum256(data)
@@ -39,7 +39,7 @@ func TestDeltaChunkCacheReuseMatchesFreshCollection(t *testing.T) {
 		FuzzyHash:           false,
 	}
 	patterns := GetPatterns(cfg.IncludeDataTypes, nil, nil)
-	cache, err := openDeltaChunkCache(cfg)
+	cache, err := OpenDeltaChunkCache(cfg)
 	if err != nil {
 		t.Fatalf("open delta cache: %v", err)
 	}
@@ -49,7 +49,7 @@ func TestDeltaChunkCacheReuseMatchesFreshCollection(t *testing.T) {
 	if err != nil {
 		t.Fatalf("stat seed file: %v", err)
 	}
-	seed, err := collectFileData(context.Background(), path, info, cfg, patterns, buildFileModules(cfg, patterns), cache)
+	seed, err := collectFileData(context.Background(), path, info, cfg, patterns, testFileModules(t, cfg, patterns), cache)
 	if err != nil {
 		t.Fatalf("collect seed file: %v", err)
 	}
@@ -73,11 +73,11 @@ func TestDeltaChunkCacheReuseMatchesFreshCollection(t *testing.T) {
 	if err != nil {
 		t.Fatalf("stat mutated file: %v", err)
 	}
-	withCache, err := collectFileData(context.Background(), path, info, cfg, patterns, buildFileModules(cfg, patterns), cache)
+	withCache, err := collectFileData(context.Background(), path, info, cfg, patterns, testFileModules(t, cfg, patterns), cache)
 	if err != nil {
 		t.Fatalf("collect mutated file with cache: %v", err)
 	}
-	fresh, err := collectFileData(context.Background(), path, info, cfg, patterns, buildFileModules(cfg, patterns), nil)
+	fresh, err := collectFileData(context.Background(), path, info, cfg, patterns, testFileModules(t, cfg, patterns), nil)
 	if err != nil {
 		t.Fatalf("collect mutated file without cache: %v", err)
 	}
@@ -122,7 +122,7 @@ func TestDeltaChunkCacheBypassedWhenSensitiveOutputRedacted(t *testing.T) {
 		RedactSensitive:     "hash",
 	}
 	patterns := GetPatterns(cfg.IncludeDataTypes, nil, nil)
-	cache, err := openDeltaChunkCache(cfg)
+	cache, err := OpenDeltaChunkCache(cfg)
 	if err != nil {
 		t.Fatalf("open delta cache: %v", err)
 	}
@@ -132,7 +132,7 @@ func TestDeltaChunkCacheBypassedWhenSensitiveOutputRedacted(t *testing.T) {
 	if err != nil {
 		t.Fatalf("stat file: %v", err)
 	}
-	record, err := collectFileData(context.Background(), path, info, cfg, patterns, buildFileModules(cfg, patterns), cache)
+	record, err := collectFileData(context.Background(), path, info, cfg, patterns, testFileModules(t, cfg, patterns), cache)
 	if err != nil {
 		t.Fatalf("collect file: %v", err)
 	}
@@ -164,7 +164,7 @@ func TestOpenDeltaChunkCacheRejectsOversizedManifest(t *testing.T) {
 		DeltaCacheDir:      cacheDir,
 		DeltaCacheMaxBytes: 1 << 20,
 	}
-	if _, err := openDeltaChunkCache(cfg); err == nil {
+	if _, err := OpenDeltaChunkCache(cfg); err == nil {
 		t.Fatal("expected oversized manifest to be rejected")
 	}
 }
@@ -186,7 +186,7 @@ func TestOpenDeltaChunkCacheRejectsManifestTraversalEntry(t *testing.T) {
 		DeltaCacheDir:      cacheDir,
 		DeltaCacheMaxBytes: 1 << 20,
 	}
-	if _, err := openDeltaChunkCache(cfg); err == nil {
+	if _, err := OpenDeltaChunkCache(cfg); err == nil {
 		t.Fatal("expected traversal manifest entry to be rejected")
 	}
 }
@@ -209,6 +209,49 @@ func TestInternalArtifactFilterSkipsDeltaCacheDir(t *testing.T) {
 	}
 }
 
+func TestInternalArtifactFilterSkipsSignedEncryptedOutput(t *testing.T) {
+	root := t.TempDir()
+	cfg := &config.Config{
+		OutputFileName:    filepath.Join(root, "out.ndjson.age"),
+		OutputFormat:      "json",
+		EncryptRecipients: []string{"age1example"},
+	}
+	filter := newInternalArtifactFilter(cfg)
+	for _, name := range []string{"out.ndjson.age", "out.2.ndjson.age", "out.manifest.json"} {
+		if !filter.ShouldSkip(filepath.Join(root, name)) {
+			t.Fatalf("expected output artifact %s to be skipped", name)
+		}
+	}
+	if filter.ShouldSkip(filepath.Join(root, "out.ndjson")) {
+		t.Fatal("expected unrelated plaintext file to be scanned")
+	}
+}
+
+func TestInternalArtifactFilterSkipsEarlierAgentRuns(t *testing.T) {
+	root := t.TempDir()
+	cfg := &config.Config{
+		OutputFileName: filepath.Join(root, "out.ndjson"),
+		OutputFormat:   "json",
+		RunStamp:       "20261016T120000Z",
+	}
+	filter := newInternalArtifactFilter(cfg)
+	for _, name := range []string{
+		"out-20261016T120000Z.ndjson",
+		"out-20261015T020000Z.ndjson",
+		"out-20261015T020000Z.3.ndjson",
+		"out-20261015T020000Z.manifest.json",
+	} {
+		if !filter.ShouldSkip(filepath.Join(root, name)) {
+			t.Fatalf("expected agent run output %s to be skipped", name)
+		}
+	}
+	for _, name := range []string{"out-notes.ndjson", "out-20261015T020000Z.txt", "other-20261015T020000Z.ndjson"} {
+		if filter.ShouldSkip(filepath.Join(root, name)) {
+			t.Fatalf("expected unrelated file %s to be scanned", name)
+		}
+	}
+}
+
 func TestPickScheduledTaskPrefersAgedLargeWork(t *testing.T) {
 	lanes := map[schedulerLane][]scheduledTask{
 		schedulerLaneSmall: []scheduledTask{
@@ -243,7 +286,7 @@ func TestOpenDeltaChunkCacheDefaultsEmptyModeToChunk(t *testing.T) {
 		DeltaCacheDir:      filepath.Join(t.TempDir(), "delta-cache"),
 		DeltaCacheMaxBytes: 1 << 20,
 	}
-	cache, err := openDeltaChunkCache(cfg)
+	cache, err := OpenDeltaChunkCache(cfg)
 	if err != nil {
 		t.Fatalf("open delta cache: %v", err)
 	}
@@ -282,3 +325,20 @@ func TestDeltaCacheFingerprintIncludesPatternBodies(t *testing.T) {
 		t.Fatal("expected delta cache fingerprint to change when custom regex body changes")
 	}
 }
+
+func TestDeltaCacheFingerprintIncludesEntropySettings(t *testing.T) {
+	patterns := GetPatterns([]string{"high_entropy_string"}, nil, nil)
+	base := config.Config{SensitiveEntropyBits: 4, SensitiveEntropyHexBits: 3, SensitiveEntropyMinLen: 20}
+	want := deltaCacheFingerprint(&base, patterns)
+	for name, change := range map[string]func(*config.Config){
+		"threshold":     func(cfg *config.Config) { cfg.SensitiveEntropyBits = 4.5 },
+		"hex threshold": func(cfg *config.Config) { cfg.SensitiveEntropyHexBits = 3.5 },
+		"min length":    func(cfg *config.Config) { cfg.SensitiveEntropyMinLen = 32 },
+	} {
+		cfg := base
+		change(&cfg)
+		if deltaCacheFingerprint(&cfg, patterns) == want {
+			t.Fatalf("expected delta cache fingerprint to change with the entropy %s", name)
+		}
+	}
+}
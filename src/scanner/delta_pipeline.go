@@ -1,6 +1,7 @@
 package scanner
 
 import (
+	"bytes"
 	"regexp"
 	"sort"
 
@@ -49,8 +50,8 @@ func runContentPipelineWithDeltaCache(
 	if hashConsumer != nil {
 		results.hashes = hashConsumer.results
 	}
-	if fuzzyConsumer != nil && fuzzyConsumer.hash != "" {
-		results.fuzzyHashes = map[string]string{"tlsh": fuzzyConsumer.hash}
+	if fuzzyConsumer != nil {
+		results.fuzzyHashes = fuzzyConsumer.hashes
 	}
 
 	cached, cachedOK, err := fc.deltaCache.Load(fc.Path, fingerprint, analysisLimit)
@@ -62,6 +63,9 @@ func runContentPipelineWithDeltaCache(
 		results.searchHits = cloneIntMap(cached.SearchHits)
 		results.sensitiveMatches = cloneStringSliceMap(cached.SensitiveMatches)
 		results.sensitiveMatchCount = cloneIntMap(cached.SensitiveCounts)
+		results.sensitiveConfidence = cloneFloatSliceMap(cached.SensitiveConfidence)
+		results.sensitiveLocations = cloneMatchLocations(cached.SensitiveLocations)
+		results.searchLocations = cloneMatchLocations(cached.SearchLocations)
 		if len(results.fuzzyHashes) == 0 {
 			results.fuzzyHashes = cloneStringMap(cached.FuzzyHashes)
 		}
@@ -95,12 +99,16 @@ func runContentPipelineWithDeltaCache(
 		entry.Chunks = chunks
 		if searchEnabled {
 			results.searchHits = aggregateSearchChunkResults(chunks)
+			results.searchLocations = aggregateSearchChunkLocations(chunks)
 			entry.SearchHits = cloneIntMap(results.searchHits)
+			entry.SearchLocations = cloneMatchLocations(results.searchLocations)
 		}
 		if cacheableSensitive {
-			results.sensitiveMatches, results.sensitiveMatchCount = aggregateSensitiveChunkResults(chunks, fc.Cfg)
+			results.sensitiveMatches, results.sensitiveMatchCount, results.sensitiveConfidence, results.sensitiveLocations = aggregateSensitiveChunkResults(chunks, fc.Cfg)
 			entry.SensitiveMatches = cloneStringSliceMap(results.sensitiveMatches)
 			entry.SensitiveCounts = cloneIntMap(results.sensitiveMatchCount)
+			entry.SensitiveConfidence = cloneFloatSliceMap(results.sensitiveConfidence)
+			entry.SensitiveLocations = cloneMatchLocations(results.sensitiveLocations)
 		}
 	}
 
@@ -121,8 +129,12 @@ func runContentPipelineWithDeltaCache(
 		}
 		results.sensitiveMatches = sensitiveConsumer.matches
 		results.sensitiveMatchCount = sensitiveConsumer.counts
+		results.sensitiveConfidence = sensitiveConsumer.confidence
+		results.sensitiveLocations = sensitiveConsumer.locations
 		entry.SensitiveMatches = cloneStringSliceMap(results.sensitiveMatches)
 		entry.SensitiveCounts = cloneIntMap(results.sensitiveMatchCount)
+		entry.SensitiveConfidence = cloneFloatSliceMap(results.sensitiveConfidence)
+		entry.SensitiveLocations = cloneMatchLocations(results.sensitiveLocations)
 	}
 
 	_ = fc.deltaCache.Store(fc.Path, entry)
@@ -145,12 +157,13 @@ func buildDeltaCachedChunks(
 	}
 	chunks := make([]deltaCachedChunk, len(currentHashes))
 	patternNames := sortedPatternNames(patterns)
+	redaction := newLocationRedaction(cfg, patterns)
 	for i := range currentHashes {
 		if canReuseDeltaChunk(cached, currentHashes, i) {
 			chunks[i] = cloneDeltaCachedChunk(cached.Chunks[i])
 			continue
 		}
-		chunk, err := analyzeDeltaChunk(source, analysisSize, i, cfg, searchTerms, patternNames, searchEnabled, sensitiveEnabled)
+		chunk, err := analyzeDeltaChunk(source, analysisSize, i, cfg, searchTerms, patternNames, redaction, searchEnabled, sensitiveEnabled)
 		if err != nil {
 			return nil, err
 		}
@@ -166,6 +179,7 @@ func analyzeDeltaChunk(
 	cfg *config.Config,
 	searchTerms []string,
 	patternNames []string,
+	redaction locationRedaction,
 	searchEnabled bool,
 	sensitiveEnabled bool,
 ) (deltaCachedChunk, error) {
@@ -187,49 +201,98 @@ func analyzeDeltaChunk(
 	primaryStartInWindow := int(chunkStart - windowStart)
 	primaryLen := int(primaryEnd - chunkStart)
 	primaryEndInWindow := primaryStartInWindow + primaryLen
+	var locator *deltaChunkLocator
+	if locationsEnabled(cfg) {
+		primary := window[primaryStartInWindow:primaryEndInWindow]
+		chunk.Newlines = bytes.Count(primary, []byte{'\n'})
+		chunk.LastNewline = -1
+		if idx := bytes.LastIndexByte(primary, '\n'); idx >= 0 {
+			chunk.LastNewline = chunkStart + int64(idx)
+		}
+		locator = &deltaChunkLocator{
+			window:       window,
+			windowStart:  windowStart,
+			primaryStart: primaryStartInWindow,
+			redaction:    redaction,
+		}
+	}
 	if searchEnabled {
-		chunk.SearchCounts = collectSearchChunkCounts(window, searchTerms, primaryStartInWindow, primaryEndInWindow)
+		chunk.SearchCounts, chunk.SearchLocations = collectSearchChunk(window, searchTerms, primaryStartInWindow, primaryEndInWindow, locator)
 	}
 	if sensitiveEnabled {
 		sensitiveWindow := window[:primaryEndInWindow]
-		chunk.SensitiveMatches = collectCriticalSensitiveChunk(sensitiveWindow, patternNames, primaryStartInWindow, cfg)
+		chunk.SensitiveMatches = collectCriticalSensitiveChunk(sensitiveWindow, patternNames, primaryStartInWindow, cfg, locator)
 	}
 	return chunk, nil
 }
 
-func collectSearchChunkCounts(content []byte, terms []string, primaryStart, primaryEnd int) map[string]int {
+// deltaChunkLocator places matches found in a chunk's analysis window, which
+// starts one chunk before the chunk being analyzed.
+type deltaChunkLocator struct {
+	window       []byte
+	windowStart  int64
+	primaryStart int
+	redaction    locationRedaction
+}
+
+func (l *deltaChunkLocator) locate(start, end int, replacement string) deltaLocation {
+	loc := deltaLocation{
+		Offset:    l.windowStart + int64(start),
+		LineStart: -1,
+		Context:   locationSnippet(l.window, start, end, replacement, l.redaction),
+	}
+	if start >= l.primaryStart {
+		loc.LineDelta = bytes.Count(l.window[l.primaryStart:start], []byte{'\n'})
+	} else {
+		loc.LineDelta = -bytes.Count(l.window[start:l.primaryStart], []byte{'\n'})
+	}
+	if idx := bytes.LastIndexByte(l.window[:start], '\n'); idx >= 0 {
+		loc.LineStart = l.windowStart + int64(idx) + 1
+	}
+	return loc
+}
+
+func collectSearchChunk(content []byte, terms []string, primaryStart, primaryEnd int, locator *deltaChunkLocator) (map[string]int, map[string][]deltaLocation) {
 	if primaryEnd <= primaryStart || len(content) == 0 {
-		return nil
+		return nil, nil
 	}
 	terms = normalizeSearchTerms(terms)
 	if len(terms) == 0 {
-		return nil
+		return nil, nil
 	}
 	matcher := newStreamAhoMatcher(terms)
 	if matcher == nil || len(matcher.terms) == 0 {
-		return nil
+		return nil, nil
 	}
 	counts := make(map[string]int, len(terms))
+	var locations map[string][]deltaLocation
 	matcher.Consume(content, func(index int, start, end int64) {
 		if start < int64(primaryStart) || start >= int64(primaryEnd) {
 			return
 		}
-		counts[matcher.terms[index]]++
+		term := matcher.terms[index]
+		counts[term]++
+		if locator != nil && len(locations[term]) < maxSearchLocations {
+			if locations == nil {
+				locations = make(map[string][]deltaLocation, len(terms))
+			}
+			locations[term] = append(locations[term], locator.locate(int(start), int(end), term))
+		}
 	})
 	if len(counts) == 0 {
-		return nil
+		return nil, nil
 	}
-	return counts
+	return counts, locations
 }
 
-func collectCriticalSensitiveChunk(content []byte, patternNames []string, carryLen int, cfg *config.Config) map[string][]deltaValueRun {
+func collectCriticalSensitiveChunk(content []byte, patternNames []string, carryLen int, cfg *config.Config, locator *deltaChunkLocator) map[string][]deltaValueRun {
 	if carryLen < 0 || len(content) == 0 || len(patternNames) == 0 {
 		return nil
 	}
 	var out map[string][]deltaValueRun
 	counts := make(map[string]int, len(patternNames))
 	total := 0
-	sensitive.ScanDeterministicVisit(content, patternNames, nil, func(pattern string, start, end int) bool {
+	sensitive.ScanDeterministicVisit(content, patternNames, sensitiveOptions(cfg), nil, func(pattern string, start, end int, confidence float64) bool {
 		if end <= carryLen {
 			return true
 		}
@@ -244,12 +307,16 @@ func collectCriticalSensitiveChunk(content []byte, patternNames []string, carryL
 		}
 		value := string(content[start:end])
 		runs := out[pattern]
-		if n := len(runs); n > 0 && runs[n-1].Value == value {
+		if n := len(runs); n > 0 && runs[n-1].Value == value && runs[n-1].Confidence == confidence {
 			runs[n-1].Count++
-			out[pattern] = runs
 		} else {
-			out[pattern] = append(runs, deltaValueRun{Value: value, Count: 1})
+			runs = append(runs, deltaValueRun{Value: value, Count: 1, Confidence: confidence})
 		}
+		if locator != nil {
+			last := &runs[len(runs)-1]
+			last.Locations = append(last.Locations, locator.locate(start, end, redactLocationValue(cfg, value)))
+		}
+		out[pattern] = runs
 		counts[pattern]++
 		total++
 		if sensitiveCollectionSaturated(cfg, patternNames, counts, total) {
@@ -282,9 +349,74 @@ func aggregateSearchChunkResults(chunks []deltaCachedChunk) map[string]int {
 	return counts
 }
 
-func aggregateSensitiveChunkResults(chunks []deltaCachedChunk, cfg *config.Config) (map[string][]string, map[string]int) {
+// deltaLineBases records, for each chunk, how many lines precede it and where
+// the line containing its first byte starts.
+type deltaLineBases struct {
+	lines      []int
+	lineStarts []int64
+}
+
+func newDeltaLineBases(chunks []deltaCachedChunk) deltaLineBases {
+	bases := deltaLineBases{
+		lines:      make([]int, len(chunks)),
+		lineStarts: make([]int64, len(chunks)),
+	}
+	lines := 0
+	var lineStart int64
+	for i, chunk := range chunks {
+		bases.lines[i] = lines
+		bases.lineStarts[i] = lineStart
+		lines += chunk.Newlines
+		if chunk.Newlines > 0 {
+			lineStart = chunk.LastNewline + 1
+		}
+	}
+	return bases
+}
+
+// resolve turns a location cached for chunk index into an absolute one. A
+// match whose line began before the analysis window takes its line start
+// from the chunk before.
+func (b deltaLineBases) resolve(index int, loc deltaLocation) MatchLocation {
+	lineStart := loc.LineStart
+	if lineStart < 0 {
+		lineStart = b.lineStarts[maxInt(index-1, 0)]
+	}
+	return MatchLocation{
+		Offset:  loc.Offset,
+		Line:    b.lines[index] + loc.LineDelta + 1,
+		Column:  int(loc.Offset-lineStart) + 1,
+		Context: loc.Context,
+	}
+}
+
+func aggregateSearchChunkLocations(chunks []deltaCachedChunk) MatchLocations {
+	var (
+		bases     deltaLineBases
+		locations MatchLocations
+	)
+	for i, chunk := range chunks {
+		if len(chunk.SearchLocations) == 0 {
+			continue
+		}
+		if bases.lines == nil {
+			bases = newDeltaLineBases(chunks)
+		}
+		for term, locs := range chunk.SearchLocations {
+			for _, loc := range locs {
+				if len(locations[term]) >= maxSearchLocations {
+					break
+				}
+				locations = locations.add(term, bases.resolve(i, loc))
+			}
+		}
+	}
+	return locations
+}
+
+func aggregateSensitiveChunkResults(chunks []deltaCachedChunk, cfg *config.Config) (map[string][]string, map[string]int, map[string][]float64, MatchLocations) {
 	if len(chunks) == 0 {
-		return nil, nil
+		return nil, nil, nil, nil
 	}
 	var (
 		totalLimit   int
@@ -296,8 +428,13 @@ func aggregateSensitiveChunkResults(chunks []deltaCachedChunk, cfg *config.Confi
 	}
 	matches := make(map[string][]string)
 	counts := make(map[string]int)
+	confidence := make(map[string][]float64)
+	var (
+		bases     deltaLineBases
+		locations MatchLocations
+	)
 	total := 0
-	for _, chunk := range chunks {
+	for i, chunk := range chunks {
 		if len(chunk.SensitiveMatches) == 0 {
 			continue
 		}
@@ -315,14 +452,21 @@ func aggregateSensitiveChunkResults(chunks []deltaCachedChunk, cfg *config.Confi
 				for remaining > 0 {
 					if totalLimit > 0 && total >= totalLimit {
 						if len(matches) == 0 {
-							return nil, nil
+							return nil, nil, nil, nil
 						}
-						return matches, counts
+						return matches, counts, confidence, locations
 					}
 					if perTypeLimit > 0 && counts[pattern] >= perTypeLimit {
 						break
 					}
 					matches[pattern] = append(matches[pattern], run.Value)
+					confidence[pattern] = append(confidence[pattern], run.Confidence)
+					if k := run.Count - remaining; k < len(run.Locations) {
+						if bases.lines == nil {
+							bases = newDeltaLineBases(chunks)
+						}
+						locations = locations.add(pattern, bases.resolve(i, run.Locations[k]))
+					}
 					counts[pattern]++
 					total++
 					remaining--
@@ -331,9 +475,9 @@ func aggregateSensitiveChunkResults(chunks []deltaCachedChunk, cfg *config.Confi
 		}
 	}
 	if len(matches) == 0 {
-		return nil, nil
+		return nil, nil, nil, nil
 	}
-	return matches, counts
+	return matches, counts, confidence, locations
 }
 
 func allSensitivePatternsCritical(patterns map[string]*regexp.Regexp) bool {
@@ -413,7 +557,10 @@ func canReuseDeltaChunk(
 func cloneDeltaCachedChunk(in deltaCachedChunk) deltaCachedChunk {
 	return deltaCachedChunk{
 		SearchCounts:     cloneIntMap(in.SearchCounts),
+		SearchLocations:  cloneDeltaLocations(in.SearchLocations),
 		SensitiveMatches: cloneDeltaValueRuns(in.SensitiveMatches),
+		Newlines:         in.Newlines,
+		LastNewline:      in.LastNewline,
 	}
 }
 
@@ -450,13 +597,40 @@ func cloneStringSliceMap(in map[string][]string) map[string][]string {
 	return out
 }
 
+func cloneFloatSliceMap(in map[string][]float64) map[string][]float64 {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(map[string][]float64, len(in))
+	for key, values := range in {
+		out[key] = append([]float64(nil), values...)
+	}
+	return out
+}
+
 func cloneDeltaValueRuns(in map[string][]deltaValueRun) map[string][]deltaValueRun {
 	if len(in) == 0 {
 		return nil
 	}
 	out := make(map[string][]deltaValueRun, len(in))
 	for key, values := range in {
-		out[key] = append([]deltaValueRun(nil), values...)
+		runs := make([]deltaValueRun, len(values))
+		for i, run := range values {
+			run.Locations = append([]deltaLocation(nil), run.Locations...)
+			runs[i] = run
+		}
+		out[key] = runs
+	}
+	return out
+}
+
+func cloneDeltaLocations(in map[string][]deltaLocation) map[string][]deltaLocation {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(map[string][]deltaLocation, len(in))
+	for key, values := range in {
+		out[key] = append([]deltaLocation(nil), values...)
 	}
 	return out
 }
@@ -0,0 +1,118 @@
+package scanner
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"safnari/config"
+	"safnari/fuzzy"
+	"safnari/output"
+)
+
+// duplicateIndex is a file module that collects the digests of every file
+// scanned and, once the scan is done, writes duplicate_group records for
+// files with the same content and similarity_cluster records for files with
+// close TLSH digests.
+type duplicateIndex struct {
+	algorithm string
+	threshold int
+
+	mu      sync.Mutex
+	groups  map[string]*duplicateSet
+	similar map[fuzzy.TLSHDigest][]string
+}
+
+type duplicateSet struct {
+	size  int64
+	paths []string
+}
+
+// newDuplicateIndex returns nil unless cfg.Duplicates is set.
+func newDuplicateIndex(cfg *config.Config) *duplicateIndex {
+	if !cfg.Duplicates {
+		return nil
+	}
+	algorithm := cfg.DuplicateHash
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	return &duplicateIndex{
+		algorithm: algorithm,
+		threshold: cfg.SimilarityDistance,
+		groups:    make(map[string]*duplicateSet),
+		similar:   make(map[fuzzy.TLSHDigest][]string),
+	}
+}
+
+func (d *duplicateIndex) Name() string { return "duplicates" }
+
+func (d *duplicateIndex) Enabled(cfg *config.Config) bool { return cfg.Duplicates }
+
+func (d *duplicateIndex) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
+	size := fc.Info.Size()
+	digest := data.Hashes[d.algorithm]
+	similar, hasFuzzy := fuzzy.ParseTLSHDigest(data.FuzzyHashes["tlsh"])
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Empty files all share a digest and say nothing about duplication.
+	if digest != "" && size > 0 {
+		set := d.groups[digest]
+		if set == nil {
+			set = &duplicateSet{size: size}
+			d.groups[digest] = set
+		}
+		set.paths = append(set.paths, data.Path)
+	}
+	if hasFuzzy {
+		d.similar[similar] = append(d.similar[similar], data.Path)
+	}
+	return nil
+}
+
+// write emits the duplicate groups, most wasted space first, then the
+// similarity clusters, largest first.
+func (d *duplicateIndex) write(w *output.Writer) error {
+	var groups []DuplicateGroup
+	for hash, set := range d.groups {
+		if len(set.paths) < 2 {
+			continue
+		}
+		sort.Strings(set.paths)
+		groups = append(groups, DuplicateGroup{
+			Algorithm:   d.algorithm,
+			Hash:        hash,
+			Size:        set.size,
+			Count:       len(set.paths),
+			WastedBytes: set.size * int64(len(set.paths)-1),
+			Paths:       set.paths,
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].WastedBytes != groups[j].WastedBytes {
+			return groups[i].WastedBytes > groups[j].WastedBytes
+		}
+		return groups[i].Hash < groups[j].Hash
+	})
+	for _, group := range groups {
+		if err := w.WriteEvent(RecordDuplicateGroup, group); err != nil {
+			return err
+		}
+	}
+
+	var clusters []SimilarityCluster
+	for _, c := range fuzzy.ClusterTLSHPaths(d.similar, d.threshold) {
+		clusters = append(clusters, SimilarityCluster{
+			Algorithm:   "tlsh",
+			MaxDistance: c.MaxDistance,
+			Count:       len(c.Paths),
+			Paths:       c.Paths,
+		})
+	}
+	for _, cluster := range clusters {
+		if err := w.WriteEvent(RecordSimilarityCluster, cluster); err != nil {
+			return err
+		}
+	}
+	return nil
+}
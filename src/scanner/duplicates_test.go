@@ -0,0 +1,141 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"safnari/config"
+	"safnari/output"
+	"safnari/systeminfo"
+)
+
+// sampleText returns deterministic prose-like content for TLSH.
+func sampleText(seed uint64, words int) string {
+	rnd := rand.New(rand.NewPCG(seed, seed))
+	vocabulary := strings.Fields("alpha bravo charlie delta echo foxtrot golf hotel india juliet kilo lima mike november oscar papa quebec romeo sierra tango uniform victor whiskey xray yankee zulu")
+	var b strings.Builder
+	for i := range words {
+		b.WriteString(vocabulary[rnd.IntN(len(vocabulary))])
+		if i%12 == 11 {
+			b.WriteString(".\n")
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	return b.String()
+}
+
+// mutate replaces every nth word of text.
+func mutate(text string, n int, word string) string {
+	words := strings.Split(text, " ")
+	for i := n - 1; i < len(words); i += n {
+		words[i] = word
+	}
+	return strings.Join(words, " ")
+}
+
+func TestScanFilesWritesDuplicateGroupsAndSimilarityClusters(t *testing.T) {
+	dir := t.TempDir()
+	scanDir := filepath.Join(dir, "scan")
+	if err := os.Mkdir(scanDir, 0755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	report := sampleText(1, 400)
+	files := map[string]string{
+		"report.txt":       report,
+		"copy/report.txt":  report,
+		"report-v2.txt":    mutate(report, 50, "zebra"),
+		"unrelated.txt":    sampleText(99, 400),
+		"empty-a.txt":      "",
+		"empty-b.txt":      "",
+		"small-a.txt":      "tiny",
+		"copy/small-b.txt": "tiny",
+	}
+	for name, content := range files {
+		path := filepath.Join(scanDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	cfg := &config.Config{
+		StartPaths:         []string{scanDir},
+		OutputFileName:     filepath.Join(dir, "out.ndjson"),
+		OutputFormat:       "json",
+		NiceLevel:          "low",
+		ScanFiles:          true,
+		MaxFileSize:        1 << 20,
+		SkipCount:          true,
+		HashAlgorithms:     []string{"sha256"},
+		FuzzyHash:          true,
+		FuzzyAlgorithms:    []string{"tlsh"},
+		Duplicates:         true,
+		DuplicateHash:      "sha256",
+		SimilarityDistance: 60,
+	}
+	metrics := &output.Metrics{}
+	w, err := output.New(cfg, &systeminfo.SystemInfo{}, metrics)
+	if err != nil {
+		t.Fatalf("output init: %v", err)
+	}
+	if err := ScanFiles(context.Background(), cfg, metrics, w); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	var groups []DuplicateGroup
+	var clusters []SimilarityCluster
+	err = output.ReadRecords(cfg.OutputFileName, func(recordType string, payload json.RawMessage) error {
+		switch recordType {
+		case RecordDuplicateGroup:
+			var g DuplicateGroup
+			if err := json.Unmarshal(payload, &g); err != nil {
+				return err
+			}
+			groups = append(groups, g)
+		case RecordSimilarityCluster:
+			var c SimilarityCluster
+			if err := json.Unmarshal(payload, &c); err != nil {
+				return err
+			}
+			clusters = append(clusters, c)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("read records: %v", err)
+	}
+
+	if len(groups) != 2 {
+		t.Fatalf("expected the report and small copies as duplicate groups, got %+v", groups)
+	}
+	largest := groups[0]
+	if largest.Count != 2 || largest.Algorithm != "sha256" || largest.WastedBytes != int64(len(report)) ||
+		largest.Paths[0] != filepath.Join(scanDir, "copy", "report.txt") || largest.Paths[1] != filepath.Join(scanDir, "report.txt") {
+		t.Fatalf("unexpected largest group %+v", largest)
+	}
+	if groups[1].WastedBytes != 4 {
+		t.Fatalf("expected the small copies second, got %+v", groups[1])
+	}
+
+	if len(clusters) != 1 {
+		t.Fatalf("expected one similarity cluster, got %+v", clusters)
+	}
+	want := []string{
+		filepath.Join(scanDir, "copy", "report.txt"),
+		filepath.Join(scanDir, "report-v2.txt"),
+		filepath.Join(scanDir, "report.txt"),
+	}
+	if c := clusters[0]; c.Count != 3 || strings.Join(c.Paths, ",") != strings.Join(want, ",") || c.MaxDistance == 0 || c.MaxDistance > 60 {
+		t.Fatalf("unexpected cluster %+v", c)
+	}
+}
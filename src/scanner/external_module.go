@@ -0,0 +1,191 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"safnari/config"
+)
+
+const (
+	externalModuleProtocolVersion = 1
+	defaultExternalModuleTimeout  = 10 * time.Second
+	externalModuleMaxStderr       = 4096
+	// defaultExternalModuleMaxResponse caps a module's stdout when its
+	// max_response_bytes is unset.
+	defaultExternalModuleMaxResponse = 1 << 20
+)
+
+// externalModuleRequest is written to the module's stdin as one JSON object.
+type externalModuleRequest struct {
+	ProtocolVersion  int    `json:"protocol_version"`
+	Module           string `json:"module"`
+	Path             string `json:"path"`
+	Name             string `json:"name"`
+	Size             int64  `json:"size"`
+	ModTime          string `json:"mod_time"`
+	MimeType         string `json:"mime_type"`
+	Content          []byte `json:"content,omitempty"`
+	ContentTruncated bool   `json:"content_truncated,omitempty"`
+}
+
+// externalModuleResponse is read from the module's stdout. Data is stored
+// under the module name in FileRecord.Extensions.
+type externalModuleResponse struct {
+	Data     interface{} `json:"data"`
+	Warnings []string    `json:"warnings"`
+	Error    string      `json:"error"`
+}
+
+// externalModule adapts a configured executable to the FileModule interface.
+type externalModule struct {
+	spec config.ExternalModule
+}
+
+func buildExternalModules(cfg *config.Config) []FileModule {
+	modules := make([]FileModule, 0, len(cfg.ExternalModules))
+	for _, spec := range cfg.ExternalModules {
+		modules = append(modules, externalModule{spec: spec})
+	}
+	return modules
+}
+
+func (m externalModule) Name() string { return m.spec.Name }
+
+func (m externalModule) Enabled(cfg *config.Config) bool { return m.spec.Command != "" }
+
+func (m externalModule) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
+	req, err := m.buildRequest(fc)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	timeout := defaultExternalModuleTimeout
+	if m.spec.TimeoutMs > 0 {
+		timeout = time.Duration(m.spec.TimeoutMs) * time.Millisecond
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(runCtx, m.spec.Command, m.spec.Args...)
+	cmd.Stdin = bytes.NewReader(payload)
+	maxResponse := int64(defaultExternalModuleMaxResponse)
+	if m.spec.MaxResponseBytes > 0 {
+		maxResponse = m.spec.MaxResponseBytes
+	}
+	var stderr bytes.Buffer
+	stdout := &responseBuffer{limit: maxResponse, cancel: cancel}
+	cmd.Stdout = stdout
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: externalModuleMaxStderr}
+	if err := cmd.Run(); err != nil || stdout.overflow {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if stdout.overflow {
+			err = fmt.Errorf("response exceeded %d bytes", maxResponse)
+		} else if runCtx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		fc.addWarning(fmt.Sprintf("external module %s failed: %v", m.spec.Name, err))
+		return err
+	}
+
+	var resp externalModuleResponse
+	if err := json.Unmarshal(stdout.buf.Bytes(), &resp); err != nil {
+		fc.addWarning(fmt.Sprintf("external module %s returned invalid JSON", m.spec.Name))
+		return err
+	}
+	for _, warning := range resp.Warnings {
+		fc.addWarning(fmt.Sprintf("external module %s: %s", m.spec.Name, warning))
+	}
+	if resp.Error != "" {
+		fc.addWarning(fmt.Sprintf("external module %s failed: %s", m.spec.Name, resp.Error))
+		return fmt.Errorf("%s", resp.Error)
+	}
+	if resp.Data == nil {
+		return nil
+	}
+	if data.Extensions == nil {
+		data.Extensions = make(map[string]interface{}, 1)
+	}
+	data.Extensions[m.spec.Name] = resp.Data
+	return nil
+}
+
+func (m externalModule) buildRequest(fc *FileContext) (*externalModuleRequest, error) {
+	req := &externalModuleRequest{
+		ProtocolVersion: externalModuleProtocolVersion,
+		Module:          m.spec.Name,
+		Path:            fc.recordPath(),
+		Name:            fc.Info.Name(),
+		Size:            fc.Info.Size(),
+		ModTime:         fc.Info.ModTime().Format(time.RFC3339),
+		MimeType:        fc.MimeType(),
+	}
+	if m.spec.MaxContentBytes <= 0 {
+		return req, nil
+	}
+	source, err := fc.Source()
+	if err != nil {
+		return nil, err
+	}
+	content, err := source.ReadAll(m.spec.MaxContentBytes)
+	if err != nil {
+		return nil, err
+	}
+	req.Content = content
+	req.ContentTruncated = source.Size() > int64(len(content))
+	return req, nil
+}
+
+// limitedBuffer keeps the first limit bytes written and discards the rest so
+// a chatty module cannot grow memory without bound.
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.buf.Write(p[:remaining])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+var errResponseTooLarge = errors.New("response too large")
+
+// responseBuffer holds a module's stdout. Past limit bytes it stops the
+// module through cancel instead of growing, since the response is parsed as
+// a whole.
+type responseBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	cancel   context.CancelFunc
+	overflow bool
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	if int64(b.buf.Len())+int64(len(p)) > b.limit {
+		b.overflow = true
+		b.cancel()
+		return 0, errResponseTooLarge
+	}
+	return b.buf.Write(p)
+}
@@ -0,0 +1,185 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"safnari/config"
+)
+
+type stubFileModule struct{ name string }
+
+func (m stubFileModule) Name() string { return m.name }
+
+func (m stubFileModule) Enabled(cfg *config.Config) bool { return true }
+
+func (m stubFileModule) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
+	if data.Extensions == nil {
+		data.Extensions = map[string]interface{}{}
+	}
+	data.Extensions[m.name] = true
+	return nil
+}
+
+func TestRegisterFileModule(t *testing.T) {
+	RegisterFileModule(stubFileModule{name: "zz-stub"})
+	defer func() {
+		moduleRegistryMu.Lock()
+		delete(moduleRegistry, "zz-stub")
+		moduleRegistryMu.Unlock()
+	}()
+
+	cfg := &config.Config{ScanFiles: true}
+	modules := testFileModules(t, cfg, nil)
+	if modules[len(modules)-1].Name() != "archive" {
+		t.Fatalf("expected archive module to stay last, got %s", modules[len(modules)-1].Name())
+	}
+	found := false
+	for _, module := range modules {
+		if module.Name() == "zz-stub" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("registered module missing from module list")
+	}
+
+	path := filepath.Join(t.TempDir(), "note.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fi, _ := os.Stat(path)
+	data, err := collectFileData(context.Background(), path, fi, cfg, nil, modules, nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if data.Extensions["zz-stub"] != true {
+		t.Fatalf("expected registered module output, got %v", data.Extensions)
+	}
+}
+
+func writeModuleScript(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("external module test scripts require a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "module.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0700); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+	return path
+}
+
+func TestExternalModuleMergesResponse(t *testing.T) {
+	// The script echoes the request back so the test can inspect what was sent.
+	script := writeModuleScript(t, `req=$(cat)
+printf '{"data":{"request":%s},"warnings":["low confidence"]}' "$req"
+`)
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(path, []byte("top secret payload"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fi, _ := os.Stat(path)
+	cfg := &config.Config{
+		ScanFiles: true,
+		ExternalModules: []config.ExternalModule{
+			{Name: "classifier", Command: script, MaxContentBytes: 3},
+		},
+	}
+	data, err := collectFileData(context.Background(), path, fi, cfg, nil, testFileModules(t, cfg, nil), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	ext, ok := data.Extensions["classifier"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected classifier extension, got %v", data.Extensions)
+	}
+	req := ext["request"].(map[string]interface{})
+	if req["path"] != path || req["module"] != "classifier" || req["protocol_version"] != float64(1) {
+		t.Fatalf("unexpected request envelope: %v", req)
+	}
+	// "top" base64-encoded; content is capped at max_content_bytes.
+	if req["content"] != "dG9w" || req["content_truncated"] != true {
+		t.Fatalf("expected truncated content in request, got %v / %v", req["content"], req["content_truncated"])
+	}
+	if len(data.CollectionWarnings) != 1 || !strings.Contains(data.CollectionWarnings[0], "low confidence") {
+		t.Fatalf("expected module warning, got %v", data.CollectionWarnings)
+	}
+}
+
+func TestExternalModuleFailureIsWarning(t *testing.T) {
+	script := writeModuleScript(t, "echo boom >&2\nexit 3\n")
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fi, _ := os.Stat(path)
+	cfg := &config.Config{
+		ScanFiles:       true,
+		ExternalModules: []config.ExternalModule{{Name: "broken", Command: script}},
+	}
+	data, err := collectFileData(context.Background(), path, fi, cfg, nil, testFileModules(t, cfg, nil), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(data.Extensions) != 0 {
+		t.Fatalf("expected no extensions from failed module, got %v", data.Extensions)
+	}
+	if len(data.CollectionWarnings) != 1 || !strings.Contains(data.CollectionWarnings[0], "boom") {
+		t.Fatalf("expected failure warning with stderr, got %v", data.CollectionWarnings)
+	}
+}
+
+func TestExternalModuleReceivesRecordPath(t *testing.T) {
+	script := writeModuleScript(t, `req=$(cat)
+printf '{"data":%s}' "$req"
+`)
+	path := filepath.Join(t.TempDir(), "passwd")
+	if err := os.WriteFile(path, []byte("root:x:0:0"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fi, _ := os.Stat(path)
+	cfg := &config.Config{
+		ScanFiles:       true,
+		ExternalModules: []config.ExternalModule{{Name: "classifier", Command: script}},
+	}
+	fc := &FileContext{Path: path, reportPath: "docker://c0ffee!/etc/passwd", Info: fi, Cfg: cfg}
+	data, _, err := collectContextRecords(context.Background(), fc, testFileModules(t, cfg, nil))
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	req, ok := data.Extensions["classifier"].(map[string]interface{})
+	if !ok || req["path"] != "docker://c0ffee!/etc/passwd" {
+		t.Fatalf("expected the module to receive the record path, got %v", data.Extensions)
+	}
+}
+
+func TestExternalModuleResponseLimit(t *testing.T) {
+	// The module never stops writing; only the response cap ends it.
+	script := writeModuleScript(t, "cat >/dev/null\nexec yes '{\"data\":1}'\n")
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("x"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fi, _ := os.Stat(path)
+	cfg := &config.Config{
+		ScanFiles: true,
+		ExternalModules: []config.ExternalModule{
+			{Name: "chatty", Command: script, TimeoutMs: 60000, MaxResponseBytes: 1024},
+		},
+	}
+	data, err := collectFileData(context.Background(), path, fi, cfg, nil, testFileModules(t, cfg, nil), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(data.Extensions) != 0 {
+		t.Fatalf("expected no extensions from an oversized response, got %v", data.Extensions)
+	}
+	if len(data.CollectionWarnings) != 1 || !strings.Contains(data.CollectionWarnings[0], "exceeded 1024 bytes") {
+		t.Fatalf("expected a response limit warning, got %v", data.CollectionWarnings)
+	}
+}
@@ -25,14 +25,23 @@ type FileModule interface {
 }
 
 type FileContext struct {
-	Path              string
+	Path string
+	// reportPath, when set, is the path written to records in place of
+	// Path, which is where the file is read from.
+	reportPath        string
 	Info              os.FileInfo
 	Cfg               *config.Config
 	SensitivePatterns map[string]*regexp.Regexp
 	deltaCache        *DeltaChunkCache
+	modules           []FileModule
 
 	source *ChunkSource
 
+	archiveDepth     int
+	archiveBudget    *archiveBudget
+	archiveTruncated bool
+	archiveMembers   []*FileRecord
+
 	mimeLoaded  bool
 	mimeType    string
 	content     []byte
@@ -43,9 +52,13 @@ type FileContext struct {
 	analysisLoaded bool
 	analysisErr    error
 	analysis       *contentAnalysisResults
+	// allowlisted is set once the file's digests are found in a hash set
+	// named by --hash-set-allowlist; its content is not scanned.
+	allowlisted bool
 
 	contentScanBytes     int64
 	contentScanTruncated bool
+	extractedTextBytes   int64
 	warnings             []string
 	warningSet           map[string]struct{}
 	sizeLimitNoted       bool
@@ -109,10 +122,29 @@ func (fc *FileContext) ShouldSearchContent() bool {
 	return source.ShouldSearchContent()
 }
 
+// recordPath is the path the file is reported under: Path, unless the file
+// is read from a host path other than its logical one, as for files in the
+// layers of a container.
+func (fc *FileContext) recordPath() string {
+	if fc.reportPath != "" {
+		return fc.reportPath
+	}
+	return fc.Path
+}
+
+// IsArchiveMember reports whether the context describes a virtual file read
+// from inside an archive rather than a path on the host filesystem.
+func (fc *FileContext) IsArchiveMember() bool {
+	return fc != nil && fc.archiveDepth > 0
+}
+
 func (fc *FileContext) FullFileProcessingAllowed() bool {
 	if fc == nil || fc.Cfg == nil || fc.Info == nil {
 		return true
 	}
+	if fc.archiveTruncated {
+		return false
+	}
 	if fc.Cfg.MaxFileSize <= 0 {
 		return true
 	}
@@ -222,7 +254,7 @@ func (fc *FileContext) EnsureContentAnalysis() (*contentAnalysisResults, error)
 	return fc.analysis, fc.analysisErr
 }
 
-func buildFileModules(cfg *config.Config, patterns map[string]*regexp.Regexp) []FileModule {
+func buildFileModules(cfg *config.Config, patterns map[string]*regexp.Regexp) ([]FileModule, error) {
 	fuzzyHashers := buildFuzzyHashers(cfg)
 	searchCounter := prefilter.BuildSearchCounter(cfg.SearchTerms)
 	patternNames := make([]string, 0, len(patterns))
@@ -230,7 +262,7 @@ func buildFileModules(cfg *config.Config, patterns map[string]*regexp.Regexp) []
 		patternNames = append(patternNames, name)
 	}
 	sort.Strings(patternNames)
-	return []FileModule{
+	modules := []FileModule{
 		baseModule{},
 		xattrModule{},
 		aclModule{},
@@ -242,6 +274,23 @@ func buildFileModules(cfg *config.Config, patterns map[string]*regexp.Regexp) []
 		sensitiveModule{patternNames: patternNames},
 		searchModule{counter: searchCounter},
 	}
+	ruleMod, err := buildRuleModule(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if ruleMod != nil {
+		modules = append(modules, ruleMod)
+	}
+	setMod, err := buildHashSetModule(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if setMod != nil {
+		modules = append(modules, setMod)
+	}
+	modules = append(modules, RegisteredFileModules()...)
+	modules = append(modules, buildExternalModules(cfg)...)
+	return append(modules, archiveModule{}), nil
 }
 
 type baseModule struct{}
@@ -254,6 +303,11 @@ func (m baseModule) Collect(ctx context.Context, fc *FileContext, data *FileReco
 	data.Name = fc.Info.Name()
 	data.Size = fc.Info.Size()
 	data.ModTime = fc.Info.ModTime().Format(time.RFC3339)
+	if fc.IsArchiveMember() {
+		data.Attributes = getFileAttributes(fc.Info)
+		data.Permissions = fc.Info.Mode().Perm().String()
+		return nil
+	}
 
 	times, err := getFileTimes(fc.Path)
 	if err == nil {
@@ -290,6 +344,9 @@ func (m xattrModule) Name() string { return "xattrs" }
 func (m xattrModule) Enabled(cfg *config.Config) bool { return cfg.CollectXattrs }
 
 func (m xattrModule) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
+	if fc.IsArchiveMember() {
+		return nil
+	}
 	xattrs, err := getXattrs(fc.Path, fc.Cfg.XattrMaxValueSize)
 	if err == nil && len(xattrs) > 0 {
 		data.Xattrs = xattrs
@@ -304,6 +361,9 @@ func (m aclModule) Name() string { return "acl" }
 func (m aclModule) Enabled(cfg *config.Config) bool { return cfg.CollectACL }
 
 func (m aclModule) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
+	if fc.IsArchiveMember() {
+		return nil
+	}
 	acl, err := getFileACL(fc.Path)
 	if err == nil && acl != "" {
 		data.ACL = acl
@@ -318,6 +378,9 @@ func (m adsModule) Name() string { return "ads" }
 func (m adsModule) Enabled(cfg *config.Config) bool { return cfg.ScanADS }
 
 func (m adsModule) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
+	if fc.IsArchiveMember() {
+		return nil
+	}
 	streams, err := getAlternateDataStreams(fc.Path)
 	if err == nil && len(streams) > 0 {
 		data.AlternateDataStreams = streams
@@ -371,6 +434,20 @@ func (m metadataModule) Collect(ctx context.Context, fc *FileContext, data *File
 		return err
 	}
 	file := source.File()
+	if file == nil {
+		if !metadata.Supported(fc.MimeType()) {
+			return nil
+		}
+		if fc.Cfg.MetadataMaxBytes > 0 && source.Size() > fc.Cfg.MetadataMaxBytes {
+			return nil
+		}
+		content, err := source.ReadAll(0)
+		if err != nil {
+			return err
+		}
+		data.Metadata = metadata.ExtractMetadataFromBytes(content, fc.MimeType(), fc.Path)
+		return nil
+	}
 	size := int64(0)
 	if fc.Info != nil {
 		size = fc.Info.Size()
@@ -413,6 +490,17 @@ func (m fuzzyModule) Collect(ctx context.Context, fc *FileContext, data *FileRec
 	return nil
 }
 
+// fuzzyHashers returns the hashers of the fuzzy module attached to the
+// context's module list.
+func (fc *FileContext) fuzzyHashers() []fuzzy.Hasher {
+	for _, module := range fc.modules {
+		if m, ok := module.(fuzzyModule); ok {
+			return m.hashers
+		}
+	}
+	return nil
+}
+
 type sensitiveModule struct {
 	patternNames []string
 }
@@ -422,7 +510,7 @@ func (m sensitiveModule) Name() string { return "sensitive" }
 func (m sensitiveModule) Enabled(cfg *config.Config) bool { return cfg.ScanSensitive }
 
 func (m sensitiveModule) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
-	if !fc.ShouldSearchContent() || len(fc.SensitivePatterns) == 0 {
+	if (!fc.ShouldSearchContent() && !fc.ExtractsText()) || len(fc.SensitivePatterns) == 0 {
 		return nil
 	}
 	results, err := fc.EnsureContentAnalysis()
@@ -432,9 +520,11 @@ func (m sensitiveModule) Collect(ctx context.Context, fc *FileContext, data *Fil
 	matches := results.sensitiveMatches
 	counts := results.sensitiveMatchCount
 	if len(matches) > 0 {
-		matches = redactSensitiveData(matches, fc.Cfg.RedactSensitive)
+		matches = redactSensitiveData(matches, fc.Cfg.RedactSensitive, fc.Cfg.RedactKey)
 		data.SensitiveData = matches
 		data.SensitiveDataMatchCounts = counts
+		data.SensitiveDataConfidence = results.sensitiveConfidence
+		data.SensitiveLocations = results.sensitiveLocations
 		if sensitiveMatchMode(fc.Cfg) == "first" {
 			fc.addWarning("sensitive-match-mode=first stores only the first retained match for each matching type")
 		}
@@ -454,7 +544,7 @@ func (m searchModule) Name() string { return "search" }
 func (m searchModule) Enabled(cfg *config.Config) bool { return len(cfg.SearchTerms) > 0 }
 
 func (m searchModule) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
-	if !fc.ShouldSearchContent() {
+	if !fc.ShouldSearchContent() && !fc.ExtractsText() {
 		return nil
 	}
 	results, err := fc.EnsureContentAnalysis()
@@ -463,6 +553,7 @@ func (m searchModule) Collect(ctx context.Context, fc *FileContext, data *FileRe
 	}
 	if len(results.searchHits) > 0 {
 		data.SearchHits = results.searchHits
+		data.SearchLocations = results.searchLocations
 	}
 	return nil
 }
@@ -523,6 +614,9 @@ func (fc *FileContext) applyRecordState(data *FileRecord) {
 	if fc.contentScanTruncated {
 		data.ContentScanTruncated = true
 	}
+	if fc.extractedTextBytes > 0 {
+		data.ExtractedTextBytes = fc.extractedTextBytes
+	}
 	if len(fc.warnings) > 0 {
 		data.CollectionWarnings = append(data.CollectionWarnings, fc.warnings...)
 	}
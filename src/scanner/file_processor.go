@@ -2,7 +2,6 @@ package scanner
 
 import (
 	"context"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
@@ -72,7 +71,7 @@ func processFile(
 	w.IncrementScanned()
 
 	endRegion := tracing.StartRegion(ctx, "collect_file_data")
-	fileData, err := collectFileData(ctx, path, fileInfo, cfg, sensitivePatterns, modules, deltaCache)
+	fileData, members, err := collectFileRecords(ctx, path, fileInfo, cfg, sensitivePatterns, modules, deltaCache)
 	endRegion()
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
@@ -81,9 +80,23 @@ func processFile(
 		logger.Warnf("Failed to process file %s: %v", path, err)
 		return nil
 	}
-	if shouldWriteFileData(cfg, fileData) {
-		if err := w.WriteData(fileData); err != nil {
-			return fmt.Errorf("write file record %s: %w", path, err)
+	return writeFileRecords(cfg, w, fileData, members)
+}
+
+// writeFileRecords writes a file's record and those of its archive members,
+// leaving out records without signal data unless file records are wanted.
+func writeFileRecords(cfg *config.Config, w *output.Writer, data *FileRecord, members []*FileRecord) error {
+	if shouldWriteFileData(cfg, data) {
+		if err := w.WriteData(data); err != nil {
+			return fmt.Errorf("write file record %s: %w", data.Path, err)
+		}
+	}
+	for _, member := range members {
+		if !shouldWriteFileData(cfg, member) {
+			continue
+		}
+		if err := w.WriteData(member); err != nil {
+			return fmt.Errorf("write file record %s: %w", member.Path, err)
 		}
 	}
 	return nil
@@ -98,35 +111,65 @@ func collectFileData(
 	modules []FileModule,
 	deltaCache *DeltaChunkCache,
 ) (*FileRecord, error) {
-	data := &FileRecord{Path: path}
+	data, _, err := collectFileRecords(ctx, path, fileInfo, cfg, sensitivePatterns, modules, deltaCache)
+	return data, err
+}
 
-	fc := FileContext{
+// collectFileRecords returns the record for path along with one record per
+// archive member discovered beneath it.
+func collectFileRecords(
+	ctx context.Context,
+	path string,
+	fileInfo os.FileInfo,
+	cfg *config.Config,
+	sensitivePatterns map[string]*regexp.Regexp,
+	modules []FileModule,
+	deltaCache *DeltaChunkCache,
+) (*FileRecord, []*FileRecord, error) {
+	return collectContextRecords(ctx, &FileContext{
 		Path:              path,
 		Info:              fileInfo,
 		Cfg:               cfg,
 		SensitivePatterns: sensitivePatterns,
 		deltaCache:        deltaCache,
-	}
+	}, modules)
+}
+
+// collectContextRecords runs the modules over a prepared file context and
+// closes it.
+func collectContextRecords(ctx context.Context, fc *FileContext, modules []FileModule) (*FileRecord, []*FileRecord, error) {
+	data := &FileRecord{Path: fc.recordPath()}
 	defer func() {
 		_ = fc.Close()
 	}()
 	if len(modules) == 0 {
-		modules = buildFileModules(cfg, sensitivePatterns)
+		var err error
+		if modules, err = buildFileModules(fc.Cfg, fc.SensitivePatterns); err != nil {
+			return data, nil, err
+		}
+	}
+	fc.modules = modules
+	if err := collectWithModules(ctx, fc, data, modules); err != nil {
+		return data, nil, err
 	}
+	fc.applyRecordState(data)
+
+	return data, fc.archiveMembers, nil
+}
+
+func collectWithModules(ctx context.Context, fc *FileContext, data *FileRecord, modules []FileModule) error {
 	for _, module := range modules {
-		if !module.Enabled(cfg) {
+		if !module.Enabled(fc.Cfg) {
 			continue
 		}
-		if err := module.Collect(ctx, &fc, data); err != nil {
+		if err := module.Collect(ctx, fc, data); err != nil {
 			if errors.Is(err, context.Canceled) {
-				return data, err
+				return err
 			}
-			logger.Debugf("Module %s failed for %s: %v", module.Name(), path, err)
+			logger.Debugf("Module %s failed for %s: %v", module.Name(), fc.Path, err)
 		}
 	}
-	fc.applyRecordState(data)
-
-	return data, nil
+	return nil
 }
 
 func shouldWriteFileData(cfg *config.Config, data *FileRecord) bool {
@@ -350,8 +393,25 @@ func scanForSensitiveDataAdvanced(
 	windowBytes int,
 	patternNames []string,
 ) (map[string][]string, map[string]int) {
+	matches, matchCounts, _ := scanForSensitiveDataScored(content, patterns, maxPerType, maxTotal, engine, longtail, windowBytes, patternNames, sensitive.Options{})
+	return matches, matchCounts
+}
+
+// scanForSensitiveDataScored is scanForSensitiveDataAdvanced that also returns
+// the span and confidence of each match, aligned with the returned values.
+func scanForSensitiveDataScored(
+	content []byte,
+	patterns map[string]*regexp.Regexp,
+	maxPerType, maxTotal int,
+	engine string,
+	longtail string,
+	windowBytes int,
+	patternNames []string,
+	opts sensitive.Options,
+) (map[string][]string, map[string]int, map[string][]scoredSpan) {
 	var matches map[string][]string
 	var matchCounts map[string]int
+	var spans map[string][]scoredSpan
 	remaining := maxTotal
 	limitTotal := maxTotal > 0
 	if len(patternNames) == 0 {
@@ -378,26 +438,26 @@ func scanForSensitiveDataAdvanced(
 		if limitTotal {
 			deterministicTotalLimit = remaining
 		}
-		detMatches, detCounts := sensitive.ScanDeterministicAll(content, criticalPatternNames, perTypeLimit, deterministicTotalLimit)
+		detMatches := sensitive.ScanDeterministicMatches(content, criticalPatternNames, opts, perTypeLimit, deterministicTotalLimit)
 		if len(detMatches) > 0 {
 			if matches == nil {
-				matches = make(map[string][]string, len(detMatches))
-				matchCounts = make(map[string]int, len(detCounts))
+				matches = make(map[string][]string, len(criticalPatternNames))
+				matchCounts = make(map[string]int, len(criticalPatternNames))
+				spans = make(map[string][]scoredSpan, len(criticalPatternNames))
 			}
-			for kind, values := range detMatches {
-				matches[kind] = append(matches[kind], values...)
-			}
-			for kind, count := range detCounts {
-				matchCounts[kind] += count
+			for _, m := range detMatches {
+				matches[m.Pattern] = append(matches[m.Pattern], m.Value)
+				spans[m.Pattern] = append(spans[m.Pattern], scoredSpan{start: m.Start, end: m.End, confidence: m.Confidence})
+				matchCounts[m.Pattern]++
 				if limitTotal {
-					remaining -= count
+					remaining--
 				}
 			}
 		}
 	}
 
 	if engine == "deterministic" || longtail == "off" {
-		return matches, matchCounts
+		return matches, matchCounts, spans
 	}
 
 	safeGate := prefilter.BuildSensitiveGateBytes("safe", content, patternNames)
@@ -426,7 +486,7 @@ func scanForSensitiveDataAdvanced(
 			continue
 		}
 
-		values := regexSensitiveMatches(content, pattern, perTypeLimit, longtail, windowBytes)
+		values, found := regexSensitiveMatches(content, dataType, pattern, perTypeLimit, longtail, windowBytes, opts.Confidence)
 		if len(values) == 0 {
 			continue
 		}
@@ -434,14 +494,18 @@ func scanForSensitiveDataAdvanced(
 			matches = make(map[string][]string, 4)
 			matchCounts = make(map[string]int, 4)
 		}
+		if spans == nil {
+			spans = make(map[string][]scoredSpan, 4)
+		}
 		matches[dataType] = values
 		matchCounts[dataType] = len(values)
+		spans[dataType] = found
 		if limitTotal {
 			remaining -= len(values)
 		}
 	}
 
-	return matches, matchCounts
+	return matches, matchCounts, spans
 }
 
 func filterCriticalPatternNames(patternNames []string, patterns map[string]*regexp.Regexp) []string {
@@ -461,36 +525,36 @@ func filterCriticalPatternNames(patternNames []string, patterns map[string]*rege
 	return critical
 }
 
-func regexSensitiveMatches(content []byte, pattern *regexp.Regexp, limit int, longtail string, windowBytes int) []string {
+func regexSensitiveMatches(content []byte, dataType string, pattern *regexp.Regexp, limit int, longtail string, windowBytes int, opts sensitive.ConfidenceOptions) ([]string, []scoredSpan) {
 	switch longtail {
 	case "off":
-		return nil
+		return nil, nil
 	case "sampled":
-		return regexSensitiveMatchesSampled(content, pattern, limit, windowBytes)
+		return regexSensitiveMatchesSampled(content, dataType, pattern, limit, windowBytes, opts)
 	default:
-		return regexSensitiveMatchesFull(content, pattern, limit)
+		return regexSensitiveMatchesFull(content, dataType, pattern, limit, opts)
 	}
 }
 
-func regexSensitiveMatchesFull(content []byte, pattern *regexp.Regexp, limit int) []string {
-	foundIndexes := pattern.FindAllIndex(content, limit)
-	if len(foundIndexes) == 0 {
-		return nil
+func regexSensitiveMatchesFull(content []byte, dataType string, pattern *regexp.Regexp, limit int, opts sensitive.ConfidenceOptions) ([]string, []scoredSpan) {
+	found := confidentRegexMatches(content, 0, len(content), dataType, pattern, limit, opts)
+	if len(found) == 0 {
+		return nil, nil
 	}
-	values := make([]string, len(foundIndexes))
-	for i, idx := range foundIndexes {
-		values[i] = string(content[idx[0]:idx[1]])
+	values := make([]string, len(found))
+	for i, m := range found {
+		values[i] = string(content[m.start:m.end])
 	}
-	return values
+	return values, found
 }
 
-func regexSensitiveMatchesSampled(content []byte, pattern *regexp.Regexp, limit int, windowBytes int) []string {
+func regexSensitiveMatchesSampled(content []byte, dataType string, pattern *regexp.Regexp, limit int, windowBytes int, opts sensitive.ConfidenceOptions) ([]string, []scoredSpan) {
 	n := len(content)
 	if n == 0 {
-		return nil
+		return nil, nil
 	}
 	if windowBytes <= 0 || n <= windowBytes*3 {
-		return regexSensitiveMatchesFull(content, pattern, limit)
+		return regexSensitiveMatchesFull(content, dataType, pattern, limit, opts)
 	}
 
 	half := windowBytes / 2
@@ -503,21 +567,54 @@ func regexSensitiveMatchesSampled(content []byte, pattern *regexp.Regexp, limit
 	merged := mergeSpans(spans)
 	seen := make(map[string]struct{})
 	values := make([]string, 0, len(merged))
+	kept := make([]scoredSpan, 0, len(merged))
 	for _, s := range merged {
-		foundIndexes := pattern.FindAllIndex(content[s.start:s.end], limit)
-		for _, idx := range foundIndexes {
-			value := string(content[s.start+idx[0] : s.start+idx[1]])
+		for _, m := range confidentRegexMatches(content, s.start, s.end, dataType, pattern, limit, opts) {
+			value := string(content[m.start:m.end])
 			if _, ok := seen[value]; ok {
 				continue
 			}
 			seen[value] = struct{}{}
 			values = append(values, value)
+			kept = append(kept, m)
 			if limit > 0 && len(values) >= limit {
-				return values
+				return values, kept
+			}
+		}
+	}
+	return values, kept
+}
+
+type scoredSpan struct {
+	start      int
+	end        int
+	confidence float64
+}
+
+// confidentRegexMatches returns up to limit matches of pattern in
+// content[from:to] that reach the minimum confidence. Dropped matches do not
+// use up the limit, so the search widens until enough are kept.
+func confidentRegexMatches(content []byte, from, to int, dataType string, pattern *regexp.Regexp, limit int, opts sensitive.ConfidenceOptions) []scoredSpan {
+	n := limit
+	for {
+		found := pattern.FindAllIndex(content[from:to], n)
+		kept := make([]scoredSpan, 0, len(found))
+		for _, idx := range found {
+			start, end := from+idx[0], from+idx[1]
+			score := sensitive.Confidence(dataType, content, start, end, opts)
+			if score < opts.MinConfidence {
+				continue
 			}
+			kept = append(kept, scoredSpan{start: start, end: end, confidence: score})
+			if limit > 0 && len(kept) >= limit {
+				return kept
+			}
+		}
+		if n <= 0 || len(found) < n {
+			return kept
 		}
+		n *= 2
 	}
-	return values
 }
 
 type byteSpan struct {
@@ -552,34 +649,19 @@ func mergeSpans(spans []byteSpan) []byteSpan {
 	return merged
 }
 
-func redactSensitiveData(matches map[string][]string, mode string) map[string][]string {
+func redactSensitiveData(matches map[string][]string, mode string, key []byte) map[string][]string {
 	if mode == "" {
 		return matches
 	}
 	redacted := make(map[string][]string, len(matches))
 	for kind, values := range matches {
 		for _, value := range values {
-			redacted[kind] = append(redacted[kind], redactValue(value, mode))
+			redacted[kind] = append(redacted[kind], sensitive.Redact(value, mode, key))
 		}
 	}
 	return redacted
 }
 
-func redactValue(value, mode string) string {
-	switch mode {
-	case "hash":
-		sum := sha256.Sum256([]byte(value))
-		return fmt.Sprintf("%x", sum[:])
-	case "mask":
-		if len(value) <= 4 {
-			return "****"
-		}
-		return strings.Repeat("*", len(value)-4) + value[len(value)-4:]
-	default:
-		return value
-	}
-}
-
 func scanForSearchTerms(content string, terms []string) map[string]int {
 	counter := prefilter.BuildSearchCounter(terms)
 	return counter.CountBytes([]byte(content))
@@ -0,0 +1,113 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"safnari/config"
+	"safnari/hashset"
+	"safnari/logger"
+)
+
+// hashSetModule tags each file with the names of the known-file hash sets
+// holding one of its digests.
+type hashSetModule struct {
+	sets      []*hashset.Set
+	allowlist map[string]bool
+	// algorithms are --hashes plus the algorithms of the digests the sets
+	// hold, which are computed for every file even when --hashes leaves them
+	// out.
+	algorithms []string
+}
+
+// buildHashSetModule loads cfg.HashSets. A set that fails to load fails the
+// scan, since skipping it would silently turn off a denylist or let an
+// allowlist stop applying.
+func buildHashSetModule(cfg *config.Config) (*hashSetModule, error) {
+	if len(cfg.HashSets) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(cfg.HashSets))
+	for name := range cfg.HashSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	m := &hashSetModule{
+		allowlist:  make(map[string]bool, len(cfg.HashSetAllowlist)),
+		algorithms: append([]string(nil), cfg.HashAlgorithms...),
+	}
+	for _, name := range cfg.HashSetAllowlist {
+		m.allowlist[name] = true
+	}
+	for _, name := range names {
+		set, err := hashset.Load(name, cfg.HashSets[name])
+		if err != nil {
+			return nil, fmt.Errorf("load hash set %s: %w", name, err)
+		}
+		logger.Debugf("Loaded hash set %s with %d digests", name, set.Len())
+		m.sets = append(m.sets, set)
+		for _, algorithm := range set.Algorithms() {
+			if !slices.Contains(m.algorithms, algorithm) {
+				m.algorithms = append(m.algorithms, algorithm)
+			}
+		}
+	}
+	return m, nil
+}
+
+func (m *hashSetModule) Name() string { return "hash_sets" }
+
+func (m *hashSetModule) Enabled(cfg *config.Config) bool { return cfg.ScanFiles }
+
+func (m *hashSetModule) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
+	data.HashSets = m.match(data.Hashes)
+	return nil
+}
+
+// match returns the names of the sets holding any of hashes.
+func (m *hashSetModule) match(hashes map[string]string) []string {
+	if len(hashes) == 0 {
+		return nil
+	}
+	var names []string
+	for _, set := range m.sets {
+		for _, digest := range hashes {
+			if set.Contains(digest) {
+				names = append(names, set.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// allowlisted reports whether hashes are in a set named by
+// --hash-set-allowlist.
+func (m *hashSetModule) allowlisted(hashes map[string]string) bool {
+	for _, name := range m.match(hashes) {
+		if m.allowlist[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// hashSets returns the hash set module attached to the context's module list.
+func (fc *FileContext) hashSets() *hashSetModule {
+	for _, module := range fc.modules {
+		if m, ok := module.(*hashSetModule); ok {
+			return m
+		}
+	}
+	return nil
+}
+
+// hashAlgorithms returns --hashes plus the algorithms the hash sets need.
+func (fc *FileContext) hashAlgorithms() []string {
+	if m := fc.hashSets(); m != nil {
+		return m.algorithms
+	}
+	return fc.Cfg.HashAlgorithms
+}
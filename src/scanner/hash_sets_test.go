@@ -0,0 +1,96 @@
+package scanner
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"safnari/config"
+)
+
+func TestHashSetsTagFilesAndSkipAllowlistedContent(t *testing.T) {
+	dir := t.TempDir()
+	known := "contact admin@example.com for the stock image\n"
+	dropper := "payload from attacker@example.net\n"
+	other := "mail someone@example.org\n"
+	for name, content := range map[string]string{"known.txt": known, "dropper.txt": dropper, "other.txt": other} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	knownSum := sha256.Sum256([]byte(known))
+	dropperSum := md5.Sum([]byte(dropper))
+	osSet := filepath.Join(dir, "os.txt")
+	iocSet := filepath.Join(dir, "ioc.txt")
+	if err := os.WriteFile(osSet, []byte(hex.EncodeToString(knownSum[:])+"  known.txt\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(iocSet, []byte(hex.EncodeToString(dropperSum[:])+"\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	cfg := &config.Config{
+		ScanFiles:        true,
+		ScanSensitive:    true,
+		HashAlgorithms:   []string{"sha256"},
+		HashSets:         map[string]string{"os": osSet, "ioc": iocSet},
+		HashSetAllowlist: []string{"os"},
+	}
+	patterns := GetPatterns([]string{"email"}, nil, nil)
+	modules := testFileModules(t, cfg, patterns)
+	collect := func(name string) *FileRecord {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat: %v", err)
+		}
+		data, err := collectFileData(context.Background(), path, fi, cfg, patterns, modules, nil)
+		if err != nil {
+			t.Fatalf("collect %s: %v", name, err)
+		}
+		return data
+	}
+
+	data := collect("known.txt")
+	if !slices.Equal(data.HashSets, []string{"os"}) || len(data.SensitiveData) != 0 || data.Hashes["sha256"] == "" {
+		t.Fatalf("expected the allowlisted file to be hashed and tagged but not scanned, got sets %v, hashes %v, sensitive %v", data.HashSets, data.Hashes, data.SensitiveData)
+	}
+	if len(data.CollectionWarnings) != 1 || data.ContentScanBytes != 0 {
+		t.Fatalf("expected a note that the content scan was skipped and no scanned bytes, got %v, %d bytes", data.CollectionWarnings, data.ContentScanBytes)
+	}
+
+	// The IOC list holds MD5 digests, which are computed although --hashes
+	// leaves them out.
+	data = collect("dropper.txt")
+	if !slices.Equal(data.HashSets, []string{"ioc"}) || data.Hashes["md5"] == "" || len(data.SensitiveData["email"]) != 1 {
+		t.Fatalf("expected the IOC match to be tagged and scanned, got sets %v, hashes %v, sensitive %v", data.HashSets, data.Hashes, data.SensitiveData)
+	}
+
+	data = collect("other.txt")
+	if len(data.HashSets) != 0 || len(data.SensitiveData["email"]) != 1 || data.Hashes["sha256"] == "" || data.ContentScanBytes != int64(len(other)) {
+		t.Fatalf("expected an unknown file to be scanned as usual, got sets %v, hashes %v, sensitive %v", data.HashSets, data.Hashes, data.SensitiveData)
+	}
+}
+
+func TestBuildFileModulesRejectsUnreadableHashSets(t *testing.T) {
+	dir := t.TempDir()
+	known := filepath.Join(dir, "known.txt")
+	if err := os.WriteFile(known, []byte(strings.Repeat("a", 64)+"\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	cfg := &config.Config{
+		ScanFiles:        true,
+		HashSets:         map[string]string{"known": known, "ioc": filepath.Join(dir, "missing.txt")},
+		HashSetAllowlist: []string{"known"},
+	}
+	if _, err := buildFileModules(cfg, nil); err == nil || !strings.Contains(err.Error(), "ioc") {
+		t.Fatalf("expected the missing ioc set to fail module setup, got %v", err)
+	}
+}
@@ -3,9 +3,11 @@ package scanner
 import (
 	"path/filepath"
 	"strings"
+	"time"
 	"unicode"
 
 	"safnari/config"
+	"safnari/output"
 )
 
 type internalArtifactFilter struct {
@@ -13,6 +15,7 @@ type internalArtifactFilter struct {
 	outputDir  string
 	outputBase string
 	outputExt  string
+	runBase    string
 	diagDir    string
 	cacheDir   string
 }
@@ -25,20 +28,23 @@ func newInternalArtifactFilter(cfg *config.Config) *internalArtifactFilter {
 		return filter
 	}
 
-	if outputPath := normalizeArtifactPath(cfg.OutputFileName); outputPath != "" {
-		ext := filepath.Ext(outputPath)
-		if ext == "" {
-			ext = ".ndjson"
-			outputPath += ext
+	if strings.TrimSpace(cfg.OutputFileName) != "" {
+		base, ext := config.OutputNameParts(cfg)
+		if outputBase := normalizeArtifactPath(base); outputBase != "" {
+			filter.exactPaths[outputBase+ext] = struct{}{}
+			filter.exactPaths[outputBase+output.ManifestSuffix] = struct{}{}
+			filter.outputDir = filepath.Dir(outputBase)
+			filter.outputExt = ext
+			filter.outputBase = filepath.Base(outputBase)
+			if cfg.RunStamp != "" {
+				filter.runBase = strings.TrimSuffix(filter.outputBase, "-"+cfg.RunStamp)
+			}
 		}
-		filter.exactPaths[outputPath] = struct{}{}
-		filter.outputDir = filepath.Dir(outputPath)
-		filter.outputExt = ext
-		filter.outputBase = strings.TrimSuffix(filepath.Base(outputPath), ext)
 	}
 
 	for _, candidate := range []string{
 		cfg.LastScanFile,
+		cfg.AgentSocket,
 		cfg.TraceFlightFile,
 		"trace.out",
 	} {
@@ -77,7 +83,7 @@ func (f *internalArtifactFilter) ShouldSkip(path string) bool {
 	if f.cacheDir != "" && (absPath == f.cacheDir || strings.HasPrefix(absPath, f.cacheDir+string(filepath.Separator))) {
 		return true
 	}
-	if f.matchesRotatedOutput(absPath) {
+	if f.matchesRotatedOutput(absPath) || f.matchesAgentRunOutput(absPath) {
 		return true
 	}
 	return f.matchesDiagnosticArtifact(absPath)
@@ -106,6 +112,39 @@ func (f *internalArtifactFilter) matchesRotatedOutput(path string) bool {
 	return true
 }
 
+// matchesAgentRunOutput matches the output of earlier agent runs, which is
+// named after the same base with another run stamp.
+func (f *internalArtifactFilter) matchesAgentRunOutput(path string) bool {
+	if f.runBase == "" || filepath.Dir(path) != f.outputDir {
+		return false
+	}
+	name, ok := strings.CutPrefix(filepath.Base(path), f.runBase+"-")
+	if !ok {
+		return false
+	}
+	stamp := name
+	if len(stamp) > len(config.RunStampLayout) {
+		stamp = stamp[:len(config.RunStampLayout)]
+	}
+	if _, err := time.Parse(config.RunStampLayout, stamp); err != nil {
+		return false
+	}
+	rest := strings.TrimPrefix(name, stamp)
+	if rest == output.ManifestSuffix || rest == f.outputExt {
+		return true
+	}
+	index, ok := strings.CutSuffix(rest, f.outputExt)
+	if !ok || len(index) < 2 || index[0] != '.' {
+		return false
+	}
+	for _, r := range index[1:] {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
 func (f *internalArtifactFilter) matchesDiagnosticArtifact(path string) bool {
 	if f.diagDir == "" || filepath.Dir(path) != f.diagDir {
 		return false
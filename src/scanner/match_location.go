@@ -0,0 +1,379 @@
+package scanner
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+
+	"safnari/config"
+	"safnari/scanner/sensitive"
+)
+
+const (
+	// locationContextBytes is how much surrounding text a location snippet
+	// keeps on each side of the match.
+	locationContextBytes = 32
+	// locationRedactBytes is how far past each edge of a snippet its
+	// context is searched for sensitive values, so a value cut off by the
+	// edge is still recognized and redacted.
+	locationRedactBytes = 32
+	// locationWindowBytes is how much content a snippet needs on each side
+	// of its match.
+	locationWindowBytes = locationContextBytes + locationRedactBytes
+	// maxSearchLocations bounds the locations kept per search term; sensitive
+	// locations are already bounded by the match limits.
+	maxSearchLocations = 100
+)
+
+// MatchLocation pinpoints one match in the scanned content. Line and Column
+// are 1-based and Column counts bytes. Offsets refer to extracted text for
+// documents scanned through --extract-text.
+type MatchLocation struct {
+	Offset  int64  `json:"offset"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Context string `json:"context,omitempty"`
+}
+
+// MatchLocations maps a sensitive type or search term to its locations, in
+// the same order as the reported values.
+type MatchLocations map[string][]MatchLocation
+
+func (m MatchLocations) add(key string, loc MatchLocation) MatchLocations {
+	if m == nil {
+		m = make(MatchLocations, 4)
+	}
+	m[key] = append(m[key], loc)
+	return m
+}
+
+func cloneMatchLocations(in MatchLocations) MatchLocations {
+	if len(in) == 0 {
+		return nil
+	}
+	out := make(MatchLocations, len(in))
+	for key, locs := range in {
+		out[key] = append([]MatchLocation(nil), locs...)
+	}
+	return out
+}
+
+func locationsEnabled(cfg *config.Config) bool {
+	return cfg != nil && cfg.MatchLocations
+}
+
+// locationRedaction is how location snippets redact sensitive values, both
+// the match of a sensitive location and any found in the context around a
+// match. Snippets always redact, masking when no mode is set. The context
+// is searched with the critical patterns and every pattern of the scan,
+// custom ones included.
+type locationRedaction struct {
+	mode     string
+	key      []byte
+	patterns []*regexp.Regexp
+}
+
+func newLocationRedaction(cfg *config.Config, patterns map[string]*regexp.Regexp) locationRedaction {
+	redaction := locationRedaction{mode: "mask"}
+	if cfg != nil && cfg.RedactSensitive != "" {
+		redaction.mode, redaction.key = cfg.RedactSensitive, cfg.RedactKey
+	}
+	for _, name := range sortedPatternNames(patterns) {
+		if pattern := patterns[name]; pattern != nil {
+			redaction.patterns = append(redaction.patterns, pattern)
+		}
+	}
+	return redaction
+}
+
+// redactLocationValue renders a match inside a sensitive location snippet.
+func redactLocationValue(cfg *config.Config, value string) string {
+	redaction := newLocationRedaction(cfg, nil)
+	return sensitive.Redact(value, redaction.mode, redaction.key)
+}
+
+// lineTracker counts lines across streamed chunks so a match can be placed
+// without rescanning earlier content.
+type lineTracker struct {
+	lines       int
+	lastNewline int64
+}
+
+func newLineTracker() lineTracker {
+	return lineTracker{lastNewline: -1}
+}
+
+// locate returns the line and column of absolute offset pos. window holds
+// content from windowStart and must reach the current chunk at chunkStart;
+// the tracker must describe everything before chunkStart.
+func (t *lineTracker) locate(window []byte, windowStart, chunkStart, pos int64) (line, column int) {
+	rel := int(pos - windowStart)
+	chunkRel := int(chunkStart - windowStart)
+	line = t.lines + 1
+	if rel >= chunkRel {
+		line += bytes.Count(window[chunkRel:rel], []byte{'\n'})
+	} else {
+		line -= bytes.Count(window[rel:chunkRel], []byte{'\n'})
+	}
+	lineStart := windowStart
+	if idx := bytes.LastIndexByte(window[:rel], '\n'); idx >= 0 {
+		lineStart = windowStart + int64(idx) + 1
+	} else if t.lastNewline < pos {
+		lineStart = t.lastNewline + 1
+	}
+	return line, int(pos-lineStart) + 1
+}
+
+func (t *lineTracker) advance(chunk []byte, chunkStart int64) {
+	t.lines += bytes.Count(chunk, []byte{'\n'})
+	if idx := bytes.LastIndexByte(chunk, '\n'); idx >= 0 {
+		t.lastNewline = chunkStart + int64(idx)
+	}
+}
+
+type pendingLocation struct {
+	key         string
+	start, end  int64
+	replacement string
+	loc         MatchLocation
+}
+
+// locationRecorder builds locations for a streaming consumer. It keeps a
+// short tail of earlier chunks for leading context and defers snippets whose
+// trailing context lies in the next chunk.
+type locationRecorder struct {
+	lines       lineTracker
+	tailSize    int
+	maxPerKey   int
+	redaction   locationRedaction
+	window      []byte
+	windowStart int64
+	chunkStart  int64
+	pending     []pendingLocation
+	out         MatchLocations
+}
+
+// newLocationRecorder keeps enough history for matches that start up to
+// lookback bytes before the chunk they are reported in.
+func newLocationRecorder(lookback, maxPerKey int, redaction locationRedaction) *locationRecorder {
+	return &locationRecorder{
+		lines:     newLineTracker(),
+		tailSize:  lookback + locationWindowBytes,
+		maxPerKey: maxPerKey,
+		redaction: redaction,
+	}
+}
+
+// begin appends chunk to the recorder's window and completes any snippets
+// that were waiting for it. Leading context of pending snippets is kept.
+func (r *locationRecorder) begin(chunk []byte, offset int64) {
+	drop := len(r.window) - r.tailSize
+	for _, p := range r.pending {
+		drop = minInt(drop, int(p.start-r.windowStart)-locationWindowBytes)
+	}
+	if drop > 0 {
+		r.window = append(r.window[:0], r.window[drop:]...)
+		r.windowStart += int64(drop)
+	}
+	if len(r.window) == 0 {
+		r.windowStart = offset
+	}
+	r.window = append(r.window, chunk...)
+	r.chunkStart = offset
+	r.flush(false)
+}
+
+// add records a match at absolute [start, end). replacement is what the
+// snippet shows in place of the match.
+func (r *locationRecorder) add(key string, start, end int64, replacement string) {
+	if start < r.windowStart || (r.maxPerKey > 0 && r.count(key) >= r.maxPerKey) {
+		return
+	}
+	line, column := r.lines.locate(r.window, r.windowStart, r.chunkStart, start)
+	r.pending = append(r.pending, pendingLocation{
+		key:         key,
+		start:       start,
+		end:         end,
+		replacement: replacement,
+		loc:         MatchLocation{Offset: start, Line: line, Column: column},
+	})
+}
+
+// end advances line tracking past the chunk passed to begin.
+func (r *locationRecorder) end() {
+	r.lines.advance(r.window[r.chunkStart-r.windowStart:], r.chunkStart)
+	r.flush(false)
+}
+
+// finish completes every pending snippet with whatever context is left.
+func (r *locationRecorder) finish() MatchLocations {
+	r.flush(true)
+	return r.out
+}
+
+func (r *locationRecorder) count(key string) int {
+	n := len(r.out[key])
+	for _, p := range r.pending {
+		if p.key == key {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *locationRecorder) flush(final bool) {
+	windowEnd := r.windowStart + int64(len(r.window))
+	done := 0
+	for _, p := range r.pending {
+		// Stop at the first snippet still waiting so locations keep the order
+		// of the values they describe.
+		if !final && p.end+locationWindowBytes > windowEnd {
+			break
+		}
+		p.loc.Context = locationSnippet(r.window, int(p.start-r.windowStart), int(p.end-r.windowStart), p.replacement, r.redaction)
+		r.out = r.out.add(p.key, p.loc)
+		done++
+	}
+	r.pending = append(r.pending[:0], r.pending[done:]...)
+}
+
+// lineIndex holds the newline offsets of a complete buffer for locating many
+// matches in it.
+type lineIndex []int
+
+func newLineIndex(content []byte) lineIndex {
+	var idx lineIndex
+	for i, ch := range content {
+		if ch == '\n' {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// locate returns the line and column of pos within the indexed buffer.
+func (idx lineIndex) locate(pos int) (line, column int) {
+	before := sort.SearchInts(idx, pos)
+	lineStart := 0
+	if before > 0 {
+		lineStart = idx[before-1] + 1
+	}
+	return before + 1, pos - lineStart + 1
+}
+
+// location describes content[start:end], where content is the indexed buffer.
+func (idx lineIndex) location(content []byte, start, end int, replacement string, redaction locationRedaction) MatchLocation {
+	line, column := idx.locate(start)
+	return MatchLocation{
+		Offset:  int64(start),
+		Line:    line,
+		Column:  column,
+		Context: locationSnippet(content, start, end, replacement, redaction),
+	}
+}
+
+// locationSnippet renders the text around content[start:end] on the same
+// line, with the match replaced, sensitive values in the context redacted
+// and control bytes shown as '.'.
+func locationSnippet(content []byte, start, end int, replacement string, redaction locationRedaction) string {
+	if start < 0 || end > len(content) || end < start {
+		return ""
+	}
+	from := lineExtent(content, start, -locationContextBytes)
+	to := lineExtent(content, end, locationContextBytes)
+	var b bytes.Buffer
+	b.Grow(to - from - (end - start) + len(replacement))
+	redaction.writeContext(&b, content, from, start, 0)
+	b.WriteString(replacement)
+	redaction.writeContext(&b, content, end, to, start)
+	return b.String()
+}
+
+// lineExtent moves from pos by up to n bytes, backwards when n is negative,
+// without crossing a line break or the bounds of content.
+func lineExtent(content []byte, pos, n int) int {
+	if n < 0 {
+		for pos > 0 && n < 0 && !isLineBreak(content[pos-1]) {
+			pos--
+			n++
+		}
+		return pos
+	}
+	for pos < len(content) && n > 0 && !isLineBreak(content[pos]) {
+		pos++
+		n--
+	}
+	return pos
+}
+
+// writeContext writes content[from:to] with the sensitive values in it
+// redacted. The values are searched for in a margin around the range, so a
+// value that only starts or ends inside it is redacted whole, and values
+// that overlap are redacted as one. Values starting before written were
+// already written with the leading context, so only their bytes are
+// skipped.
+func (r locationRedaction) writeContext(b *bytes.Buffer, content []byte, from, to, written int) {
+	if from >= to {
+		return
+	}
+	scanFrom := lineExtent(content, from, -locationRedactBytes)
+	scanTo := lineExtent(content, to, locationRedactBytes)
+	pos := from
+	for _, span := range r.spans(content[scanFrom:scanTo]) {
+		start, end := scanFrom+span[0], scanFrom+span[1]
+		if end <= pos || start >= to {
+			continue
+		}
+		if start < written {
+			pos = end
+			continue
+		}
+		if start > pos {
+			writeSnippetBytes(b, content[pos:start])
+		}
+		b.WriteString(sensitive.Redact(string(content[start:end]), r.mode, r.key))
+		pos = end
+	}
+	if pos < to {
+		writeSnippetBytes(b, content[pos:to])
+	}
+}
+
+// spans returns the sensitive values in text as sorted, merged [start, end)
+// offsets.
+func (r locationRedaction) spans(text []byte) [][2]int {
+	var spans [][2]int
+	for _, m := range sensitive.ScanDeterministicMatches(text, sensitive.CriticalPatterns(), sensitive.Options{}, 0, 0) {
+		spans = append(spans, [2]int{m.Start, m.End})
+	}
+	for _, pattern := range r.patterns {
+		for _, loc := range pattern.FindAllIndex(text, -1) {
+			if loc[1] > loc[0] {
+				spans = append(spans, [2]int{loc[0], loc[1]})
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	merged := spans[:0]
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span[0] < merged[n-1][1] {
+			merged[n-1][1] = max(merged[n-1][1], span[1])
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+func writeSnippetBytes(b *bytes.Buffer, data []byte) {
+	for _, ch := range data {
+		if ch < 0x20 || ch == 0x7f {
+			ch = '.'
+		}
+		b.WriteByte(ch)
+	}
+}
+
+func isLineBreak(ch byte) bool {
+	return ch == '\n' || ch == '\r'
+}
@@ -0,0 +1,224 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"safnari/config"
+	"safnari/scanner/sensitive"
+)
+
+func TestStreamConsumersLocateMatchesAcrossChunks(t *testing.T) {
+	ssn := "123-45-6789"
+	content := "first line\nssn " + ssn + " end\n\n" +
+		strings.Repeat("x", 30) + " " + ssn + "\nlast " + ssn
+	cfg := &config.Config{
+		MatchLocations:     true,
+		RedactSensitive:    "mask",
+		SensitiveEngine:    "deterministic",
+		SensitiveLongtail:  "off",
+		StreamOverlapBytes: 24,
+	}
+	patternNames := []string{"ssn"}
+	sensitiveConsumer := newStreamSensitiveConsumer(cfg, GetPatterns(patternNames, nil, nil), patternNames, 0)
+	searchConsumer := newStreamSearchConsumer([]string{"45-6"}, 0)
+	searchConsumer.trackLocations(newLocationRedaction(cfg, nil))
+
+	data := []byte(content)
+	for offset := 0; offset < len(data); offset += 7 {
+		chunk := data[offset:minInt(offset+7, len(data))]
+		if err := sensitiveConsumer.Consume(chunk, int64(offset)); err != nil {
+			t.Fatalf("sensitive consume: %v", err)
+		}
+		if err := searchConsumer.Consume(chunk, int64(offset)); err != nil {
+			t.Fatalf("search consume: %v", err)
+		}
+	}
+	if err := sensitiveConsumer.Finalize(); err != nil {
+		t.Fatalf("sensitive finalize: %v", err)
+	}
+	if err := searchConsumer.Finalize(); err != nil {
+		t.Fatalf("search finalize: %v", err)
+	}
+
+	index := newLineIndex(data)
+	var wantSensitive, wantSearch []MatchLocation
+	for from := 0; ; {
+		idx := strings.Index(content[from:], ssn)
+		if idx < 0 {
+			break
+		}
+		start := from + idx
+		wantSensitive = append(wantSensitive, index.location(data, start, start+len(ssn), sensitive.Redact(ssn, "mask", nil), newLocationRedaction(cfg, nil)))
+		wantSearch = append(wantSearch, index.location(data, start+4, start+8, "45-6", newLocationRedaction(cfg, nil)))
+		from = start + len(ssn)
+	}
+	if len(wantSensitive) != 3 {
+		t.Fatalf("expected 3 fixtures, got %d", len(wantSensitive))
+	}
+	if !reflect.DeepEqual(sensitiveConsumer.locations["ssn"], wantSensitive) {
+		t.Fatalf("sensitive locations:\n got %+v\nwant %+v", sensitiveConsumer.locations["ssn"], wantSensitive)
+	}
+	if !reflect.DeepEqual(searchConsumer.locations["45-6"], wantSearch) {
+		t.Fatalf("search locations:\n got %+v\nwant %+v", searchConsumer.locations["45-6"], wantSearch)
+	}
+	if got := wantSensitive[0]; got.Line != 2 || got.Column != 5 || got.Context != "ssn *******6789 end" {
+		t.Fatalf("unexpected first location %+v", got)
+	}
+}
+
+func TestDeltaChunkCacheLocationsMatchFreshCollection(t *testing.T) {
+	root := t.TempDir()
+	cacheDir := filepath.Join(root, "delta-cache")
+	path := filepath.Join(root, "located.log")
+	var b strings.Builder
+	for i := 0; b.Len() < 10*deltaCacheChunkSize; i++ {
+		if i%997 == 0 {
+			b.WriteString("ALPHA contact test@example.com here\n")
+			continue
+		}
+		b.WriteString("filler text without any signal in it\n")
+	}
+	payload := []byte(b.String())
+	if err := os.WriteFile(path, payload, 0644); err != nil {
+		t.Fatalf("write seed file: %v", err)
+	}
+
+	cfg := &config.Config{
+		ScanFiles:           true,
+		ScanSensitive:       true,
+		DeltaScan:           true,
+		DeltaCacheMode:      "chunk",
+		DeltaCacheDir:       cacheDir,
+		DeltaCacheMaxBytes:  32 << 20,
+		HashAlgorithms:      []string{"md5"},
+		SearchTerms:         []string{"ALPHA"},
+		SensitiveEngine:     "deterministic",
+		SensitiveLongtail:   "off",
+		SensitiveMaxPerType: 1000,
+		SensitiveMaxTotal:   1000,
+		IncludeDataTypes:    []string{"email"},
+		MatchLocations:      true,
+	}
+	patterns := GetPatterns(cfg.IncludeDataTypes, nil, nil)
+	cache, err := OpenDeltaChunkCache(cfg)
+	if err != nil {
+		t.Fatalf("open delta cache: %v", err)
+	}
+	defer func() { _ = cache.Close() }()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat seed file: %v", err)
+	}
+	if _, err := collectFileData(context.Background(), path, info, cfg, patterns, testFileModules(t, cfg, patterns), cache); err != nil {
+		t.Fatalf("collect seed file: %v", err)
+	}
+
+	// Turn a space into a newline inside chunk 4 so every reused chunk after
+	// it moves down one line without changing its bytes.
+	mutated := append([]byte(nil), payload...)
+	pos := 4*deltaCacheChunkSize + 100
+	for mutated[pos] != ' ' {
+		pos++
+	}
+	mutated[pos] = '\n'
+	if err := os.WriteFile(path, mutated, 0644); err != nil {
+		t.Fatalf("rewrite mutated file: %v", err)
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat mutated file: %v", err)
+	}
+	withCache, err := collectFileData(context.Background(), path, info, cfg, patterns, testFileModules(t, cfg, patterns), cache)
+	if err != nil {
+		t.Fatalf("collect mutated file with cache: %v", err)
+	}
+	fresh, err := collectFileData(context.Background(), path, info, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect mutated file without cache: %v", err)
+	}
+
+	if len(fresh.SensitiveLocations["email"]) != fresh.SensitiveDataMatchCounts["email"] || len(fresh.SearchLocations["ALPHA"]) == 0 {
+		t.Fatalf("expected a location per match, got %d locations for %d emails", len(fresh.SensitiveLocations["email"]), fresh.SensitiveDataMatchCounts["email"])
+	}
+	if !reflect.DeepEqual(withCache.SensitiveLocations, fresh.SensitiveLocations) {
+		t.Fatalf("sensitive locations mismatch with delta cache: cached=%v fresh=%v", withCache.SensitiveLocations, fresh.SensitiveLocations)
+	}
+	if !reflect.DeepEqual(withCache.SearchLocations, fresh.SearchLocations) {
+		t.Fatalf("search locations mismatch with delta cache: cached=%v fresh=%v", withCache.SearchLocations, fresh.SearchLocations)
+	}
+	last := fresh.SensitiveLocations["email"][len(fresh.SensitiveLocations["email"])-1]
+	if line, column := newLineIndex(mutated).locate(int(last.Offset)); last.Line != line || last.Column != column {
+		t.Fatalf("last location %+v, want line %d column %d", last, line, column)
+	}
+}
+
+func TestLocationSnippetRedactsContext(t *testing.T) {
+	ssn, email := "123-45-6789", "bob@example.com"
+	mask := newLocationRedaction(nil, nil)
+	content := []byte("ssn " + ssn + " then ALPHA and mail " + email)
+	start := strings.Index(string(content), "ALPHA")
+	got := locationSnippet(content, start, start+5, "ALPHA", mask)
+	want := "ssn " + sensitive.Redact(ssn, "mask", nil) + " then ALPHA and mail " + sensitive.Redact(email, "mask", nil)
+	if got != want {
+		t.Fatalf("snippet %q, want %q", got, want)
+	}
+
+	// A value cut off by the edge of the context is still redacted whole.
+	content = []byte(ssn + strings.Repeat("x", 28) + " ALPHA")
+	start = strings.Index(string(content), "ALPHA")
+	got = locationSnippet(content, start, start+5, "ALPHA", mask)
+	if want := sensitive.Redact(ssn, "mask", nil) + strings.Repeat("x", 28) + " ALPHA"; got != want {
+		t.Fatalf("snippet %q, want %q", got, want)
+	}
+
+	// A value around the match is written once.
+	content = []byte("ssn " + ssn + " end")
+	start = strings.Index(string(content), "45-6")
+	got = locationSnippet(content, start, start+4, "45-6", mask)
+	if want := "ssn " + sensitive.Redact(ssn, "mask", nil) + "45-6 end"; got != want {
+		t.Fatalf("snippet %q, want %q", got, want)
+	}
+}
+
+func TestLocationContextRedactsSelectedPatterns(t *testing.T) {
+	first, second := "GB82WEST12345698765432", "DE89370400440532013000"
+	content := "pay " + first + " or " + second + " ref EMP-12345\n"
+	path := filepath.Join(t.TempDir(), "payments.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	cfg := &config.Config{
+		ScanSensitive:       true,
+		SensitiveMaxPerType: 10,
+		SensitiveMaxTotal:   10,
+		MatchLocations:      true,
+		IncludeDataTypes:    []string{"iban", "employee_id"},
+		CustomPatterns:      map[string]string{"employee_id": `EMP-[0-9]{5}`},
+	}
+	patterns := GetPatterns(cfg.IncludeDataTypes, cfg.CustomPatterns, nil)
+	data, err := collectFileData(context.Background(), path, info, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	locations := data.SensitiveLocations["iban"]
+	if len(locations) != 2 {
+		t.Fatalf("expected both IBANs located, got %+v", data.SensitiveLocations)
+	}
+	for _, loc := range locations {
+		for _, clear := range []string{first, second, "EMP-12345"} {
+			if strings.Contains(loc.Context, clear) {
+				t.Fatalf("context %q holds %q in clear", loc.Context, clear)
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package scanner
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	moduleRegistryMu sync.RWMutex
+	moduleRegistry   = map[string]FileModule{}
+)
+
+// RegisterFileModule adds a module that runs after the built-in file modules.
+// Registering a module with the same name replaces the earlier one.
+func RegisterFileModule(module FileModule) {
+	if module == nil {
+		return
+	}
+	moduleRegistryMu.Lock()
+	defer moduleRegistryMu.Unlock()
+	moduleRegistry[strings.ToLower(module.Name())] = module
+}
+
+// RegisteredFileModules returns the registered modules ordered by name.
+func RegisteredFileModules() []FileModule {
+	moduleRegistryMu.RLock()
+	defer moduleRegistryMu.RUnlock()
+	names := make([]string, 0, len(moduleRegistry))
+	for name := range moduleRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	modules := make([]FileModule, 0, len(names))
+	for _, name := range names {
+		modules = append(modules, moduleRegistry[name])
+	}
+	return modules
+}
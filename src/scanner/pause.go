@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"context"
+	"sync"
+)
+
+// PauseGate lets a caller pause a running scan. Workers wait at the gate
+// before each file, so a pause takes effect once the files in flight finish.
+// A nil gate never pauses.
+type PauseGate struct {
+	mu     sync.Mutex
+	paused chan struct{}
+}
+
+// Pause closes the gate and reports whether it was open.
+func (g *PauseGate) Pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused != nil {
+		return false
+	}
+	g.paused = make(chan struct{})
+	return true
+}
+
+// Resume opens the gate and reports whether it was closed.
+func (g *PauseGate) Resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused == nil {
+		return false
+	}
+	close(g.paused)
+	g.paused = nil
+	return true
+}
+
+// Paused reports whether the gate is closed.
+func (g *PauseGate) Paused() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused != nil
+}
+
+// Wait blocks while the gate is closed. It returns ctx's error if ctx ends
+// first.
+func (g *PauseGate) Wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	paused := g.paused
+	g.mu.Unlock()
+	if paused == nil {
+		return nil
+	}
+	select {
+	case <-paused:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
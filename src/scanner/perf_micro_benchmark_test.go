@@ -65,7 +65,7 @@ func BenchmarkDeltaChunkCache(b *testing.B) {
 		DeltaCacheMaxBytes: 8 << 20,
 		SearchTerms:        []string{"ALPHA"},
 	}
-	cache, err := openDeltaChunkCache(cfg)
+	cache, err := OpenDeltaChunkCache(cfg)
 	if err != nil {
 		b.Fatalf("open delta cache: %v", err)
 	}
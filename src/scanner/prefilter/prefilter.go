@@ -169,6 +169,16 @@ var safePatternTokens = map[string][]string{
 	"aws_access_key": {"akia"},
 	"jwt_token":      {"eyj"},
 	"street_address": {" street", " avenue", " road", " lane", " drive"},
+	// Vendor credential prefixes and markers.
+	"github_token":            {"ghp_", "gho_", "ghu_", "ghs_", "ghr_", "github_pat_"},
+	"slack_token":             {"xox", "xapp-"},
+	"stripe_key":              {"k_live_", "k_test_"},
+	"gcp_service_account":     {"service_account"},
+	"azure_connection_string": {"defaultendpointsprotocol="},
+	"pem_private_key":         {"private key-----"},
+	"ssh_private_key":         {"openssh private key", "putty-user-key-file-"},
+	"npm_token":               {"npm_"},
+	"pypi_token":              {"pypi-"},
 }
 
 var aggressivePatternTokens = map[string][]string{
@@ -186,6 +196,16 @@ var aggressivePatternTokens = map[string][]string{
 	"eu_vat":         {"at", "be", "bg", "cy", "cz", "de", "dk", "ee", "el", "es", "fi", "fr", "hr", "hu", "ie", "it", "lt", "lu", "lv", "mt", "nl", "pl", "pt", "ro", "se", "si", "sk"},
 	"india_aadhaar":  {" "},
 	"china_id":       {"x"},
+	// Vendor credential prefixes and markers.
+	"github_token":            {"ghp_", "gho_", "ghu_", "ghs_", "ghr_", "github_pat_"},
+	"slack_token":             {"xox", "xapp-"},
+	"stripe_key":              {"k_live_", "k_test_"},
+	"gcp_service_account":     {"service_account"},
+	"azure_connection_string": {"defaultendpointsprotocol="},
+	"pem_private_key":         {"private key-----"},
+	"ssh_private_key":         {"openssh private key", "putty-user-key-file-"},
+	"npm_token":               {"npm_"},
+	"pypi_token":              {"pypi-"},
 }
 
 var safePatternTokenBytes = normalizeTokenBytes(safePatternTokens)
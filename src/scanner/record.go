@@ -1,5 +1,51 @@
 package scanner
 
+// Record types written besides file records: the changes watch mode
+// reports, and the groups written at the end of a scan with --duplicates.
+const (
+	RecordFileDeleted       = "file_deleted"
+	RecordFileRenamed       = "file_renamed"
+	RecordDuplicateGroup    = "duplicate_group"
+	RecordSimilarityCluster = "similarity_cluster"
+)
+
+// FileDeleted is the payload of a file_deleted record.
+type FileDeleted struct {
+	Path  string `json:"path"`
+	IsDir bool   `json:"is_dir,omitempty"`
+	Time  string `json:"time"`
+}
+
+// FileRenamed is the payload of a file_renamed record. A renamed file also
+// gets a fresh file record under its new path.
+type FileRenamed struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path"`
+	IsDir   bool   `json:"is_dir,omitempty"`
+	Time    string `json:"time"`
+}
+
+// DuplicateGroup is the payload of a duplicate_group record: files whose
+// content has the same digest. WastedBytes is what all copies but one take.
+type DuplicateGroup struct {
+	Algorithm   string   `json:"algorithm"`
+	Hash        string   `json:"hash"`
+	Size        int64    `json:"size"`
+	Count       int      `json:"count"`
+	WastedBytes int64    `json:"wasted_bytes"`
+	Paths       []string `json:"paths"`
+}
+
+// SimilarityCluster is the payload of a similarity_cluster record: files
+// linked by TLSH distances of at most the similarity distance. MaxDistance
+// is the largest of those links.
+type SimilarityCluster struct {
+	Algorithm   string   `json:"algorithm"`
+	MaxDistance int      `json:"max_distance"`
+	Count       int      `json:"count"`
+	Paths       []string `json:"paths"`
+}
+
 // FileRecord is the canonical v2 scan result record.
 // It is intentionally typed to avoid hot-path map mutation costs.
 type FileRecord struct {
@@ -17,17 +63,45 @@ type FileRecord struct {
 	MimeType                 string                 `json:"mime_type,omitempty"`
 	Hashes                   map[string]string      `json:"hashes,omitempty"`
 	FuzzyHashes              map[string]string      `json:"fuzzy_hashes,omitempty"`
+	HashSets                 []string               `json:"hash_sets,omitempty"`
 	Metadata                 map[string]interface{} `json:"metadata,omitempty"`
 	Xattrs                   map[string]string      `json:"xattrs,omitempty"`
 	ACL                      string                 `json:"acl,omitempty"`
 	AlternateDataStreams     []string               `json:"alternate_data_streams,omitempty"`
 	SensitiveData            map[string][]string    `json:"sensitive_data,omitempty"`
 	SensitiveDataMatchCounts map[string]int         `json:"sensitive_data_match_counts,omitempty"`
+	SensitiveDataConfidence  map[string][]float64   `json:"sensitive_data_confidence,omitempty"`
 	SensitiveDataTruncated   bool                   `json:"sensitive_data_truncated,omitempty"`
+	SensitiveLocations       MatchLocations         `json:"sensitive_locations,omitempty"`
 	SearchHits               map[string]int         `json:"search_hits,omitempty"`
+	SearchLocations          MatchLocations         `json:"search_locations,omitempty"`
+	RuleMatches              []RuleMatch            `json:"rule_matches,omitempty"`
 	ContentScanBytes         int64                  `json:"content_scan_bytes,omitempty"`
 	ContentScanTruncated     bool                   `json:"content_scan_truncated,omitempty"`
+	ExtractedTextBytes       int64                  `json:"extracted_text_bytes,omitempty"`
 	CollectionWarnings       []string               `json:"collection_warnings,omitempty"`
+	Extensions               map[string]interface{} `json:"extensions,omitempty"`
+	Container                *ContainerRef          `json:"container,omitempty"`
+}
+
+// ContainerRef places a file found by --scan-containers or
+// --container-images in its container or image. The record's path is the
+// target's logical root, such as docker://<id>, followed by !/ and Path.
+type ContainerRef struct {
+	Runtime     string `json:"runtime"`
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Image       string `json:"image,omitempty"`
+	ImageID     string `json:"image_id,omitempty"`
+	ImageDigest string `json:"image_digest,omitempty"`
+	// LayerDigest is the diff ID of the layer holding the file; it is empty
+	// for a container's writable layer.
+	LayerDigest string `json:"layer_digest,omitempty"`
+	// Path is the file's path inside the container or image.
+	Path string `json:"path"`
+	// Shadowed is set for files a higher layer replaces or deletes: they
+	// ship in the image but are not visible in a running container.
+	Shadowed bool `json:"shadowed,omitempty"`
 }
 
 func (r *FileRecord) HasSignalData() bool {
@@ -36,10 +110,13 @@ func (r *FileRecord) HasSignalData() bool {
 	}
 	return len(r.SensitiveData) > 0 ||
 		len(r.SearchHits) > 0 ||
+		len(r.RuleMatches) > 0 ||
 		len(r.FuzzyHashes) > 0 ||
+		len(r.HashSets) > 0 ||
 		len(r.Xattrs) > 0 ||
 		r.ACL != "" ||
 		len(r.AlternateDataStreams) > 0 ||
 		r.ContentScanTruncated ||
-		len(r.CollectionWarnings) > 0
+		len(r.CollectionWarnings) > 0 ||
+		len(r.Extensions) > 0
 }
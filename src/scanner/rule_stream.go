@@ -0,0 +1,213 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+
+	"safnari/config"
+	"safnari/scanner/rules"
+)
+
+// maxRuleCandidates bounds how many wildcard-pattern atom hits are kept for
+// verification per file so a pathological atom cannot exhaust memory.
+const maxRuleCandidates = 1 << 16
+
+// RuleMatch records one rule whose condition held for a file.
+type RuleMatch struct {
+	Rule    string            `json:"rule"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	Strings map[string]int    `json:"strings,omitempty"`
+}
+
+type ruleModule struct {
+	index *ruleIndex
+}
+
+// buildRuleModule compiles cfg.RuleFiles. A rule file that cannot be read or
+// parsed fails the scan rather than leaving it without signatures.
+func buildRuleModule(cfg *config.Config) (*ruleModule, error) {
+	if len(cfg.RuleFiles) == 0 {
+		return nil, nil
+	}
+	loaded, err := rules.LoadFiles(cfg.RuleFiles)
+	if err != nil {
+		return nil, fmt.Errorf("load rules: %w", err)
+	}
+	if len(loaded) == 0 {
+		return nil, nil
+	}
+	return &ruleModule{index: newRuleIndex(loaded)}, nil
+}
+
+func (m *ruleModule) Name() string { return "rules" }
+
+func (m *ruleModule) Enabled(cfg *config.Config) bool { return m.index != nil }
+
+func (m *ruleModule) Collect(ctx context.Context, fc *FileContext, data *FileRecord) error {
+	if !fc.FullFileProcessingAllowed() {
+		fc.NoteFullFileProcessingSkipped()
+		return nil
+	}
+	results, err := fc.EnsureContentAnalysis()
+	if err != nil {
+		return err
+	}
+	data.RuleMatches = results.ruleMatches
+	return nil
+}
+
+// ruleIndex returns the compiled rules attached to the context's module list.
+func (fc *FileContext) ruleIndex() *ruleIndex {
+	for _, module := range fc.modules {
+		if m, ok := module.(*ruleModule); ok {
+			return m.index
+		}
+	}
+	return nil
+}
+
+type ruleAtomRef struct {
+	str     int
+	pattern *rules.Pattern
+}
+
+type ruleCandidate struct {
+	str     int
+	pattern *rules.Pattern
+	start   int64
+}
+
+// ruleIndex maps every distinct string atom across all rules to the rule
+// strings that contain it. It is built once and shared by all files.
+type ruleIndex struct {
+	rules      []*rules.Rule
+	matcher    *streamAhoMatcher
+	atomRefs   [][]ruleAtomRef
+	strIDs     []string
+	ruleStarts []int
+}
+
+func newRuleIndex(ruleList []*rules.Rule) *ruleIndex {
+	idx := &ruleIndex{
+		rules:      ruleList,
+		ruleStarts: make([]int, 0, len(ruleList)),
+	}
+	atomIndex := make(map[string]int)
+	var atoms []string
+	for _, rule := range ruleList {
+		idx.ruleStarts = append(idx.ruleStarts, len(idx.strIDs))
+		for _, str := range rule.Strings {
+			strIndex := len(idx.strIDs)
+			idx.strIDs = append(idx.strIDs, str.ID)
+			for _, pattern := range str.Patterns {
+				key := string(pattern.Atom)
+				atom, ok := atomIndex[key]
+				if !ok {
+					atom = len(atoms)
+					atomIndex[key] = atom
+					atoms = append(atoms, key)
+					idx.atomRefs = append(idx.atomRefs, nil)
+				}
+				idx.atomRefs[atom] = append(idx.atomRefs[atom], ruleAtomRef{str: strIndex, pattern: pattern})
+			}
+		}
+	}
+	// Rule strings count every occurrence, overlapping ones included, and
+	// each occurrence of an atom may start a wildcard or jump match.
+	idx.matcher = newStreamAhoPatternMatcher(atoms)
+	idx.matcher.overlapping = true
+	return idx
+}
+
+// streamRuleConsumer finds every rule string atom in one streaming pass,
+// verifies wildcard patterns against the source afterwards and evaluates rule
+// conditions from the resulting per-string counts.
+type streamRuleConsumer struct {
+	index    *ruleIndex
+	source   *ChunkSource
+	fileSize int64
+
+	matcher    *streamAhoMatcher
+	counts     []int
+	candidates []ruleCandidate
+	dropped    bool
+
+	matches []RuleMatch
+}
+
+func newStreamRuleConsumer(index *ruleIndex, source *ChunkSource, fileSize int64) *streamRuleConsumer {
+	return &streamRuleConsumer{
+		index:    index,
+		source:   source,
+		fileSize: fileSize,
+		matcher:  index.matcher.fork(),
+		counts:   make([]int, len(index.strIDs)),
+	}
+}
+
+func (c *streamRuleConsumer) Consume(chunk []byte, _ int64) error {
+	if c == nil || c.matcher == nil || len(chunk) == 0 {
+		return nil
+	}
+	c.matcher.Consume(chunk, func(index int, start, _ int64) {
+		for _, ref := range c.index.atomRefs[index] {
+			if ref.pattern.Literal() {
+				c.counts[ref.str]++
+				continue
+			}
+			begin := start - int64(ref.pattern.AtomOffset)
+			if begin < 0 || begin+int64(len(ref.pattern.Bytes)) > c.fileSize {
+				continue
+			}
+			if len(c.candidates) >= maxRuleCandidates {
+				c.dropped = true
+				continue
+			}
+			c.candidates = append(c.candidates, ruleCandidate{str: ref.str, pattern: ref.pattern, start: begin})
+		}
+	})
+	return nil
+}
+
+func (c *streamRuleConsumer) Finalize() error {
+	if c == nil {
+		return nil
+	}
+	for _, candidate := range c.candidates {
+		window, err := c.source.ReadRange(candidate.start, int64(len(candidate.pattern.Bytes)))
+		if err != nil {
+			return err
+		}
+		if candidate.pattern.MatchAt(window) {
+			c.counts[candidate.str]++
+		}
+	}
+	c.candidates = nil
+
+	for i, rule := range c.index.rules {
+		counts := make(map[string]int, len(rule.Strings))
+		for j := range rule.Strings {
+			idx := c.index.ruleStarts[i] + j
+			if c.counts[idx] > 0 {
+				counts[c.index.strIDs[idx]] = c.counts[idx]
+			}
+		}
+		if !rule.Eval(counts, c.fileSize) {
+			continue
+		}
+		match := RuleMatch{Rule: rule.Name, Tags: rule.Tags, Meta: rule.Meta}
+		if len(counts) > 0 {
+			match.Strings = counts
+		}
+		c.matches = append(c.matches, match)
+	}
+	return nil
+}
+
+func (c *streamRuleConsumer) warning() string {
+	if c == nil || !c.dropped {
+		return ""
+	}
+	return fmt.Sprintf("rule scan verified only the first %d wildcard pattern candidates", maxRuleCandidates)
+}
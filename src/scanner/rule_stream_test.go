@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"safnari/config"
+	"safnari/output"
+	"safnari/systeminfo"
+)
+
+func TestCollectFileDataRuleMatches(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "ir.rules")
+	if err := os.WriteFile(ruleFile, []byte(`
+rule Dropper : malware {
+	meta:
+		severity = "high"
+	strings:
+		$mz = { 4D 5A ?? 00 }
+		$url = "http://evil.example"
+	condition:
+		all of them and filesize < 1KB
+}
+
+rule NotPresent {
+	strings:
+		$x = "never-in-file"
+	condition:
+		$x
+}
+`), 0600); err != nil {
+		t.Fatalf("write rules: %v", err)
+	}
+
+	// Small chunks force atoms and wildcard verification across chunk borders.
+	content := "MZ\x90\x00" + strings.Repeat("A", 40) + "http://evil.example" + strings.Repeat("B", 40)
+	target := filepath.Join(dir, "sample.bin")
+	if err := os.WriteFile(target, []byte(content), 0600); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+	fi, _ := os.Stat(target)
+	cfg := &config.Config{
+		ScanFiles:       false,
+		RuleFiles:       []string{ruleFile},
+		ContentReadMode: "stream",
+		StreamChunkSize: 7,
+	}
+	data, err := collectFileData(context.Background(), target, fi, cfg, nil, testFileModules(t, cfg, nil), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(data.RuleMatches) != 1 {
+		t.Fatalf("expected one rule match, got %+v", data.RuleMatches)
+	}
+	match := data.RuleMatches[0]
+	if match.Rule != "Dropper" || match.Meta["severity"] != "high" || match.Tags[0] != "malware" {
+		t.Fatalf("unexpected match: %+v", match)
+	}
+	if match.Strings["$mz"] != 1 || match.Strings["$url"] != 1 {
+		t.Fatalf("unexpected string counts: %v", match.Strings)
+	}
+	if !shouldWriteFileData(cfg, data) {
+		t.Fatal("rule matches should count as signal data")
+	}
+}
+
+func TestBuildFileModulesRejectsInvalidRules(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "broken.rules")
+	if err := os.WriteFile(ruleFile, []byte(`rule broken { condition: $missing }`), 0600); err != nil {
+		t.Fatalf("write rules: %v", err)
+	}
+	for _, path := range []string{ruleFile, filepath.Join(dir, "missing.rules")} {
+		cfg := &config.Config{RuleFiles: []string{path}}
+		if _, err := buildFileModules(cfg, nil); err == nil {
+			t.Fatalf("expected %s to fail module setup", path)
+		}
+	}
+}
+
+func TestScanFilesFailsOnInvalidRules(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		StartPaths:     []string{dir},
+		OutputFileName: filepath.Join(t.TempDir(), "out.ndjson"),
+		OutputFormat:   "json",
+		NiceLevel:      "low",
+		ScanFiles:      true,
+		MaxFileSize:    1 << 20,
+		SkipCount:      true,
+		RuleFiles:      []string{filepath.Join(dir, "missing.rules")},
+	}
+	metrics := &output.Metrics{}
+	w, err := output.New(cfg, &systeminfo.SystemInfo{}, metrics)
+	if err != nil {
+		t.Fatalf("output init: %v", err)
+	}
+	defer w.Close()
+	if err := ScanFiles(context.Background(), cfg, metrics, w); err == nil || !strings.Contains(err.Error(), "missing.rules") {
+		t.Fatalf("expected the missing rule file to fail the scan, got %v", err)
+	}
+}
+
+func TestCollectFileDataRuleCountsOverlappingMatches(t *testing.T) {
+	dir := t.TempDir()
+	ruleFile := filepath.Join(dir, "overlap.rules")
+	if err := os.WriteFile(ruleFile, []byte(`
+rule Overlap {
+	strings:
+		$aa = "aa"
+		$wild = { 61 61 ?? }
+	condition:
+		#aa == 3 and #wild == 2
+}
+`), 0600); err != nil {
+		t.Fatalf("write rules: %v", err)
+	}
+	target := filepath.Join(dir, "sample.txt")
+	if err := os.WriteFile(target, []byte("aaaa"), 0600); err != nil {
+		t.Fatalf("write target: %v", err)
+	}
+	fi, _ := os.Stat(target)
+	cfg := &config.Config{
+		RuleFiles:       []string{ruleFile},
+		ContentReadMode: "stream",
+		StreamChunkSize: 3,
+	}
+	data, err := collectFileData(context.Background(), target, fi, cfg, nil, testFileModules(t, cfg, nil), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(data.RuleMatches) != 1 || data.RuleMatches[0].Strings["$aa"] != 3 || data.RuleMatches[0].Strings["$wild"] != 2 {
+		t.Fatalf("expected overlapping occurrences to count, got %+v", data.RuleMatches)
+	}
+}
@@ -0,0 +1,131 @@
+package rules
+
+import "strings"
+
+type evalContext struct {
+	rule     *Rule
+	counts   map[string]int
+	fileSize int64
+}
+
+type boolExpr interface {
+	eval(ctx *evalContext) bool
+}
+
+type intExpr interface {
+	value(ctx *evalContext) int64
+}
+
+type andExpr struct{ left, right boolExpr }
+
+func (e andExpr) eval(ctx *evalContext) bool { return e.left.eval(ctx) && e.right.eval(ctx) }
+
+type orExpr struct{ left, right boolExpr }
+
+func (e orExpr) eval(ctx *evalContext) bool { return e.left.eval(ctx) || e.right.eval(ctx) }
+
+type notExpr struct{ inner boolExpr }
+
+func (e notExpr) eval(ctx *evalContext) bool { return !e.inner.eval(ctx) }
+
+type constExpr bool
+
+func (e constExpr) eval(*evalContext) bool { return bool(e) }
+
+type stringPresentExpr struct{ id string }
+
+func (e stringPresentExpr) eval(ctx *evalContext) bool { return ctx.counts[e.id] > 0 }
+
+type compareExpr struct {
+	op          string
+	left, right intExpr
+}
+
+func (e compareExpr) eval(ctx *evalContext) bool {
+	l, r := e.left.value(ctx), e.right.value(ctx)
+	switch e.op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	}
+	return false
+}
+
+// quantifier values for ofExpr beyond a plain count.
+const (
+	quantAny  = -1
+	quantAll  = -2
+	quantNone = -3
+)
+
+// ofExpr implements "<quantifier> of <set>". A nil set means "them".
+type ofExpr struct {
+	quantifier int64
+	set        []string
+}
+
+func (e ofExpr) eval(ctx *evalContext) bool {
+	ids := e.resolve(ctx.rule)
+	matched := 0
+	for _, id := range ids {
+		if ctx.counts[id] > 0 {
+			matched++
+		}
+	}
+	switch e.quantifier {
+	case quantAny:
+		return matched > 0
+	case quantAll:
+		return len(ids) > 0 && matched == len(ids)
+	case quantNone:
+		return matched == 0
+	default:
+		return int64(matched) >= e.quantifier
+	}
+}
+
+func (e ofExpr) resolve(rule *Rule) []string {
+	ids := make([]string, 0, len(rule.Strings))
+	for _, s := range rule.Strings {
+		if e.set == nil || setContains(e.set, s.ID) {
+			ids = append(ids, s.ID)
+		}
+	}
+	return ids
+}
+
+func setContains(set []string, id string) bool {
+	for _, item := range set {
+		if strings.HasSuffix(item, "*") {
+			if strings.HasPrefix(id, strings.TrimSuffix(item, "*")) {
+				return true
+			}
+			continue
+		}
+		if item == id {
+			return true
+		}
+	}
+	return false
+}
+
+type intConst int64
+
+func (e intConst) value(*evalContext) int64 { return int64(e) }
+
+type fileSizeExpr struct{}
+
+func (fileSizeExpr) value(ctx *evalContext) int64 { return ctx.fileSize }
+
+type stringCountExpr struct{ id string }
+
+func (e stringCountExpr) value(ctx *evalContext) int64 { return int64(ctx.counts[e.id]) }
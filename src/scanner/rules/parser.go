@@ -0,0 +1,668 @@
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokStringID
+	tokCount
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  int64
+	line int
+}
+
+type lexer struct {
+	name   string
+	src    string
+	pos    int
+	line   int
+	peeked *token
+}
+
+func (l *lexer) errorf(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", l.name, line, fmt.Sprintf(format, args...))
+}
+
+func (l *lexer) skipSpace() error {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\n':
+			l.line++
+			l.pos++
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end < 0 {
+				return l.errorf(l.line, "unterminated comment")
+			}
+			l.line += strings.Count(l.src[l.pos:l.pos+2+end], "\n")
+			l.pos += end + 4
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (l *lexer) peek() (token, error) {
+	if l.peeked != nil {
+		return *l.peeked, nil
+	}
+	tok, err := l.scan()
+	if err != nil {
+		return token{}, err
+	}
+	l.peeked = &tok
+	return tok, nil
+}
+
+func (l *lexer) next() (token, error) {
+	if l.peeked != nil {
+		tok := *l.peeked
+		l.peeked = nil
+		return tok, nil
+	}
+	return l.scan()
+}
+
+func (l *lexer) scan() (token, error) {
+	if err := l.skipSpace(); err != nil {
+		return token{}, err
+	}
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, line: l.line}, nil
+	}
+	c := l.src[l.pos]
+	line := l.line
+	switch {
+	case c == '"':
+		return l.scanString()
+	case c == '$' || c == '#':
+		start := l.pos
+		l.pos++
+		for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+			l.pos++
+		}
+		if c == '$' && l.pos < len(l.src) && l.src[l.pos] == '*' {
+			l.pos++
+		}
+		text := l.src[start:l.pos]
+		if len(text) == 1 || text == "$*" {
+			return token{}, l.errorf(line, "anonymous strings are not supported")
+		}
+		if c == '#' {
+			return token{kind: tokCount, text: "$" + text[1:], line: line}, nil
+		}
+		return token{kind: tokStringID, text: text, line: line}, nil
+	case c >= '0' && c <= '9':
+		return l.scanNumber()
+	case isIdentChar(c):
+		start := l.pos
+		for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], line: line}, nil
+	}
+	for _, op := range []string{"<=", ">=", "==", "!=", "{", "}", "(", ")", ",", "=", ":", "<", ">"} {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokPunct, text: op, line: line}, nil
+		}
+	}
+	return token{}, l.errorf(line, "unexpected character %q", c)
+}
+
+func (l *lexer) scanString() (token, error) {
+	line := l.line
+	var sb strings.Builder
+	for l.pos++; l.pos < len(l.src); l.pos++ {
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return token{kind: tokString, text: sb.String(), line: line}, nil
+		case '\n':
+			return token{}, l.errorf(line, "unterminated string")
+		case '\\':
+			l.pos++
+			if l.pos >= len(l.src) {
+				return token{}, l.errorf(line, "unterminated string")
+			}
+			switch e := l.src[l.pos]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case '"', '\\':
+				sb.WriteByte(e)
+			case 'x':
+				if l.pos+2 >= len(l.src) {
+					return token{}, l.errorf(line, "invalid \\x escape")
+				}
+				v, err := strconv.ParseUint(l.src[l.pos+1:l.pos+3], 16, 8)
+				if err != nil {
+					return token{}, l.errorf(line, "invalid \\x escape")
+				}
+				sb.WriteByte(byte(v))
+				l.pos += 2
+			default:
+				return token{}, l.errorf(line, "unknown escape \\%c", e)
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return token{}, l.errorf(line, "unterminated string")
+}
+
+func (l *lexer) scanNumber() (token, error) {
+	line := l.line
+	start := l.pos
+	for l.pos < len(l.src) && isIdentChar(l.src[l.pos]) {
+		l.pos++
+	}
+	text := l.src[start:l.pos]
+	multiplier := int64(1)
+	upper := strings.ToUpper(text)
+	for suffix, mult := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(upper, suffix) && !strings.HasPrefix(upper, "0X") {
+			text = text[:len(text)-2]
+			multiplier = mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(text, 0, 64)
+	if err != nil {
+		return token{}, l.errorf(line, "invalid number %q", l.src[start:l.pos])
+	}
+	return token{kind: tokNumber, num: n * multiplier, line: line}, nil
+}
+
+// scanHex reads a hex string such as { 4D 5A ?? 00 }. Only whole-byte
+// wildcards are supported.
+func (l *lexer) scanHex() ([]byte, []bool, error) {
+	if err := l.skipSpace(); err != nil {
+		return nil, nil, err
+	}
+	line := l.line
+	if l.pos >= len(l.src) || l.src[l.pos] != '{' {
+		return nil, nil, l.errorf(line, "expected text or hex string")
+	}
+	end := strings.IndexByte(l.src[l.pos:], '}')
+	if end < 0 {
+		return nil, nil, l.errorf(line, "unterminated hex string")
+	}
+	body := l.src[l.pos+1 : l.pos+end]
+	l.line += strings.Count(body, "\n")
+	l.pos += end + 1
+
+	digits := strings.Join(strings.Fields(body), "")
+	if len(digits)%2 != 0 {
+		return nil, nil, l.errorf(line, "hex string has an odd number of digits")
+	}
+	data := make([]byte, 0, len(digits)/2)
+	mask := make([]bool, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		pair := digits[i : i+2]
+		if pair == "??" {
+			data = append(data, 0)
+			mask = append(mask, false)
+			continue
+		}
+		v, err := strconv.ParseUint(pair, 16, 8)
+		if err != nil {
+			return nil, nil, l.errorf(line, "unsupported hex token %q (only byte values and ?? are allowed)", pair)
+		}
+		data = append(data, byte(v))
+		mask = append(mask, true)
+	}
+	return data, mask, nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+type parser struct {
+	lex  *lexer
+	refs []token
+}
+
+func (p *parser) expect(kind tokenKind, text string) (token, error) {
+	tok, err := p.lex.next()
+	if err != nil {
+		return tok, err
+	}
+	if tok.kind != kind || (text != "" && tok.text != text) {
+		want := text
+		if want == "" {
+			want = "identifier"
+		}
+		return tok, p.lex.errorf(tok.line, "expected %s", want)
+	}
+	return tok, nil
+}
+
+func (p *parser) peekIs(kind tokenKind, text string) bool {
+	tok, err := p.lex.peek()
+	return err == nil && tok.kind == kind && tok.text == text
+}
+
+func (p *parser) parseRules() ([]*Rule, error) {
+	var parsed []*Rule
+	seen := make(map[string]struct{})
+	for {
+		tok, err := p.lex.peek()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind == tokEOF {
+			return parsed, nil
+		}
+		rule, err := p.parseRule()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[rule.Name]; ok {
+			return nil, p.lex.errorf(tok.line, "duplicate rule %s", rule.Name)
+		}
+		seen[rule.Name] = struct{}{}
+		parsed = append(parsed, rule)
+	}
+}
+
+func (p *parser) parseRule() (*Rule, error) {
+	if _, err := p.expect(tokIdent, "rule"); err != nil {
+		return nil, err
+	}
+	name, err := p.expect(tokIdent, "")
+	if err != nil {
+		return nil, err
+	}
+	rule := &Rule{Name: name.text}
+	if p.peekIs(tokPunct, ":") {
+		_, _ = p.lex.next()
+		for {
+			tok, err := p.lex.peek()
+			if err != nil {
+				return nil, err
+			}
+			if tok.kind != tokIdent {
+				break
+			}
+			_, _ = p.lex.next()
+			rule.Tags = append(rule.Tags, tok.text)
+		}
+	}
+	if _, err := p.expect(tokPunct, "{"); err != nil {
+		return nil, err
+	}
+	p.refs = p.refs[:0]
+	for {
+		section, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if section.kind != tokIdent {
+			return nil, p.lex.errorf(section.line, "expected meta, strings or condition section")
+		}
+		if _, err := p.expect(tokPunct, ":"); err != nil {
+			return nil, err
+		}
+		switch section.text {
+		case "meta":
+			if err := p.parseMeta(rule); err != nil {
+				return nil, err
+			}
+		case "strings":
+			if err := p.parseStrings(rule); err != nil {
+				return nil, err
+			}
+		case "condition":
+			cond, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			rule.condition = cond
+			if _, err := p.expect(tokPunct, "}"); err != nil {
+				return nil, err
+			}
+			return rule, p.checkRefs(rule)
+		default:
+			return nil, p.lex.errorf(section.line, "unknown section %s", section.text)
+		}
+	}
+}
+
+func (p *parser) parseMeta(rule *Rule) error {
+	for {
+		key, err := p.lex.peek()
+		if err != nil {
+			return err
+		}
+		if key.kind != tokIdent || key.text == "strings" || key.text == "condition" {
+			return nil
+		}
+		_, _ = p.lex.next()
+		if _, err := p.expect(tokPunct, "="); err != nil {
+			return err
+		}
+		value, err := p.lex.next()
+		if err != nil {
+			return err
+		}
+		if rule.Meta == nil {
+			rule.Meta = make(map[string]string)
+		}
+		switch value.kind {
+		case tokString, tokIdent:
+			rule.Meta[key.text] = value.text
+		case tokNumber:
+			rule.Meta[key.text] = strconv.FormatInt(value.num, 10)
+		default:
+			return p.lex.errorf(value.line, "invalid meta value for %s", key.text)
+		}
+	}
+}
+
+func (p *parser) parseStrings(rule *Rule) error {
+	for {
+		id, err := p.lex.peek()
+		if err != nil {
+			return err
+		}
+		if id.kind != tokStringID {
+			if len(rule.Strings) == 0 {
+				return p.lex.errorf(id.line, "strings section is empty")
+			}
+			return nil
+		}
+		_, _ = p.lex.next()
+		if strings.HasSuffix(id.text, "*") {
+			return p.lex.errorf(id.line, "invalid string identifier %s", id.text)
+		}
+		for _, existing := range rule.Strings {
+			if existing.ID == id.text {
+				return p.lex.errorf(id.line, "duplicate string %s", id.text)
+			}
+		}
+		if _, err := p.expect(tokPunct, "="); err != nil {
+			return err
+		}
+		str := &String{ID: id.text}
+		if err := p.lex.skipSpace(); err != nil {
+			return err
+		}
+		if p.lex.pos < len(p.lex.src) && p.lex.src[p.lex.pos] == '{' {
+			data, mask, err := p.lex.scanHex()
+			if err != nil {
+				return err
+			}
+			pattern, err := newPattern(data, mask)
+			if err != nil {
+				return p.lex.errorf(id.line, "%s: %v", id.text, err)
+			}
+			str.Patterns = []*Pattern{pattern}
+		} else {
+			text, err := p.expect(tokString, "")
+			if err != nil {
+				return p.lex.errorf(id.line, "%s: expected text or hex string", id.text)
+			}
+			if err := p.parseTextString(str, text); err != nil {
+				return err
+			}
+		}
+		rule.Strings = append(rule.Strings, str)
+	}
+}
+
+func (p *parser) parseTextString(str *String, text token) error {
+	var ascii, wide bool
+modifiers:
+	for {
+		tok, err := p.lex.peek()
+		if err != nil {
+			return err
+		}
+		if tok.kind != tokIdent {
+			break
+		}
+		switch tok.text {
+		case "ascii":
+			ascii = true
+		case "wide":
+			wide = true
+		case "nocase", "fullword", "xor", "base64", "base64wide", "private":
+			return p.lex.errorf(tok.line, "unsupported string modifier %s", tok.text)
+		default:
+			break modifiers
+		}
+		_, _ = p.lex.next()
+	}
+	if !wide {
+		ascii = true
+	}
+	variants := make([][]byte, 0, 2)
+	if ascii {
+		variants = append(variants, []byte(text.text))
+	}
+	if wide {
+		units := utf16.Encode([]rune(text.text))
+		encoded := make([]byte, 0, len(units)*2)
+		for _, u := range units {
+			encoded = append(encoded, byte(u), byte(u>>8))
+		}
+		variants = append(variants, encoded)
+	}
+	for _, data := range variants {
+		pattern, err := newPattern(data, nil)
+		if err != nil {
+			return p.lex.errorf(text.line, "%s: %v", str.ID, err)
+		}
+		str.Patterns = append(str.Patterns, pattern)
+	}
+	return nil
+}
+
+func (p *parser) checkRefs(rule *Rule) error {
+	for _, ref := range p.refs {
+		found := false
+		for _, s := range rule.Strings {
+			if setContains([]string{ref.text}, s.ID) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return p.lex.errorf(ref.line, "rule %s references undefined string %s", rule.Name, ref.text)
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (boolExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekIs(tokIdent, "or") {
+		_, _ = p.lex.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (boolExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekIs(tokIdent, "and") {
+		_, _ = p.lex.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (boolExpr, error) {
+	if p.peekIs(tokIdent, "not") {
+		_, _ = p.lex.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner: inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (boolExpr, error) {
+	tok, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	switch tok.kind {
+	case tokPunct:
+		if tok.text != "(" {
+			break
+		}
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokPunct, ")"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case tokStringID:
+		if strings.HasSuffix(tok.text, "*") {
+			return nil, p.lex.errorf(tok.line, "wildcard %s is only valid inside an of set", tok.text)
+		}
+		p.refs = append(p.refs, tok)
+		return stringPresentExpr{id: tok.text}, nil
+	case tokNumber:
+		if p.peekIs(tokIdent, "of") {
+			return p.parseOf(tok.num)
+		}
+		return p.parseComparison(intConst(tok.num))
+	case tokCount:
+		p.refs = append(p.refs, tok)
+		return p.parseComparison(stringCountExpr{id: tok.text})
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return constExpr(true), nil
+		case "false":
+			return constExpr(false), nil
+		case "any":
+			return p.parseOf(quantAny)
+		case "all":
+			return p.parseOf(quantAll)
+		case "none":
+			return p.parseOf(quantNone)
+		case "filesize":
+			return p.parseComparison(fileSizeExpr{})
+		}
+	case tokEOF:
+		return nil, p.lex.errorf(tok.line, "unexpected end of condition")
+	}
+	return nil, p.lex.errorf(tok.line, "unexpected %q in condition", tok.text)
+}
+
+func (p *parser) parseOf(quantifier int64) (boolExpr, error) {
+	if _, err := p.expect(tokIdent, "of"); err != nil {
+		return nil, err
+	}
+	tok, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	if tok.kind == tokIdent && tok.text == "them" {
+		return ofExpr{quantifier: quantifier}, nil
+	}
+	if tok.kind != tokPunct || tok.text != "(" {
+		return nil, p.lex.errorf(tok.line, "expected them or a string set")
+	}
+	var set []string
+	for {
+		id, err := p.expect(tokStringID, "")
+		if err != nil {
+			return nil, p.lex.errorf(id.line, "expected string identifier in set")
+		}
+		p.refs = append(p.refs, id)
+		set = append(set, id.text)
+		sep, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		if sep.kind == tokPunct && sep.text == ")" {
+			return ofExpr{quantifier: quantifier, set: set}, nil
+		}
+		if sep.kind != tokPunct || sep.text != "," {
+			return nil, p.lex.errorf(sep.line, "expected , or ) in string set")
+		}
+	}
+}
+
+func (p *parser) parseComparison(left intExpr) (boolExpr, error) {
+	op, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	switch op.text {
+	case "<", "<=", ">", ">=", "==", "!=":
+	default:
+		return nil, p.lex.errorf(op.line, "expected comparison operator")
+	}
+	if op.kind != tokPunct {
+		return nil, p.lex.errorf(op.line, "expected comparison operator")
+	}
+	tok, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	var right intExpr
+	switch {
+	case tok.kind == tokNumber:
+		right = intConst(tok.num)
+	case tok.kind == tokCount:
+		p.refs = append(p.refs, tok)
+		right = stringCountExpr{id: tok.text}
+	case tok.kind == tokIdent && tok.text == "filesize":
+		right = fileSizeExpr{}
+	default:
+		return nil, p.lex.errorf(tok.line, "expected number, filesize or string count")
+	}
+	return compareExpr{op: op.text, left: left, right: right}, nil
+}
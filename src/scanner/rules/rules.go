@@ -0,0 +1,142 @@
+// Package rules parses a YARA-style signature format and evaluates rule
+// conditions against per-string match counts. Matching itself is left to the
+// caller so rules can share a single streaming pass with other scanners.
+package rules
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Rule is one compiled signature.
+type Rule struct {
+	Name      string
+	Tags      []string
+	Meta      map[string]string
+	Strings   []*String
+	condition boolExpr
+}
+
+// String is a named rule string. Each pattern is an alternative encoding of
+// the same string (for example the ascii and wide forms of a text string).
+type String struct {
+	ID       string
+	Patterns []*Pattern
+}
+
+// Pattern is a byte sequence with optional single-byte wildcards. Atom is the
+// longest literal run of the pattern and starts AtomOffset bytes into it; it
+// is what a literal matcher should search for before verifying the rest.
+type Pattern struct {
+	Bytes      []byte
+	Mask       []bool
+	Atom       []byte
+	AtomOffset int
+}
+
+// Literal reports whether the pattern has no wildcards, in which case an
+// atom hit is a full match.
+func (p *Pattern) Literal() bool {
+	return p.Mask == nil
+}
+
+// MatchAt reports whether data, which must be len(p.Bytes) long, matches the
+// pattern.
+func (p *Pattern) MatchAt(data []byte) bool {
+	if len(data) != len(p.Bytes) {
+		return false
+	}
+	for i, b := range p.Bytes {
+		if p.Mask != nil && !p.Mask[i] {
+			continue
+		}
+		if data[i] != b {
+			return false
+		}
+	}
+	return true
+}
+
+// Eval reports whether the rule condition holds. counts maps string IDs
+// (including the leading $) to the number of matches found.
+func (r *Rule) Eval(counts map[string]int, fileSize int64) bool {
+	if r == nil || r.condition == nil {
+		return false
+	}
+	return r.condition.eval(&evalContext{rule: r, counts: counts, fileSize: fileSize})
+}
+
+// Parse compiles every rule in src. name is used in error messages.
+func Parse(name, src string) ([]*Rule, error) {
+	p := &parser{lex: &lexer{name: name, src: src, line: 1}}
+	return p.parseRules()
+}
+
+// LoadFiles parses each rule file and rejects duplicate rule names across
+// files.
+func LoadFiles(paths []string) ([]*Rule, error) {
+	var all []*Rule
+	seen := make(map[string]string)
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read rule file: %v", err)
+		}
+		parsed, err := Parse(path, string(data))
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range parsed {
+			if prev, ok := seen[rule.Name]; ok {
+				return nil, fmt.Errorf("%s: duplicate rule %s (first defined in %s)", path, rule.Name, prev)
+			}
+			seen[rule.Name] = path
+		}
+		all = append(all, parsed...)
+	}
+	return all, nil
+}
+
+func newPattern(data []byte, mask []bool) (*Pattern, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty string")
+	}
+	literal := true
+	for _, keep := range mask {
+		if !keep {
+			literal = false
+			break
+		}
+	}
+	if literal {
+		return &Pattern{Bytes: data, Atom: data}, nil
+	}
+	bestStart, bestLen := 0, 0
+	for i := 0; i < len(data); {
+		if !mask[i] {
+			i++
+			continue
+		}
+		start := i
+		for i < len(data) && mask[i] {
+			i++
+		}
+		if i-start > bestLen {
+			bestStart, bestLen = start, i-start
+		}
+	}
+	if bestLen == 0 {
+		return nil, fmt.Errorf("pattern has no literal bytes")
+	}
+	return &Pattern{
+		Bytes:      data,
+		Mask:       mask,
+		Atom:       data[bestStart : bestStart+bestLen],
+		AtomOffset: bestStart,
+	}, nil
+}
@@ -0,0 +1,125 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleRules = `
+// Sample rules exercising the supported syntax.
+rule SuspiciousDropper : malware dropper {
+	meta:
+		author = "ir-team"
+		severity = 3
+	strings:
+		$mz = { 4D 5A ?? 00 }
+		$url = "http://evil.example"
+		$cmd = "cmd.exe" ascii wide
+	condition:
+		$mz and 2 of ($url, $cmd) and filesize < 1MB
+}
+
+/* Counts and quantifiers */
+rule ManyTokens {
+	strings:
+		$tok_a = "token"
+		$tok_b = "secret"
+	condition:
+		#tok_a >= 3 or all of ($tok_*)
+}
+`
+
+func TestParseRules(t *testing.T) {
+	parsed, err := Parse("sample.rules", sampleRules)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(parsed) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(parsed))
+	}
+	dropper := parsed[0]
+	if dropper.Name != "SuspiciousDropper" || strings.Join(dropper.Tags, ",") != "malware,dropper" {
+		t.Fatalf("unexpected rule header: %s %v", dropper.Name, dropper.Tags)
+	}
+	if dropper.Meta["author"] != "ir-team" || dropper.Meta["severity"] != "3" {
+		t.Fatalf("unexpected meta: %v", dropper.Meta)
+	}
+	mz := dropper.Strings[0].Patterns[0]
+	if mz.Literal() || string(mz.Atom) != "MZ" || mz.AtomOffset != 0 {
+		t.Fatalf("unexpected hex atom: %+v", mz)
+	}
+	if !mz.MatchAt([]byte{0x4d, 0x5a, 0x90, 0x00}) || mz.MatchAt([]byte{0x4d, 0x5a, 0x90, 0x01}) {
+		t.Fatal("hex wildcard matching is wrong")
+	}
+	cmd := dropper.Strings[2]
+	if len(cmd.Patterns) != 2 || string(cmd.Patterns[1].Bytes) != "c\x00m\x00d\x00.\x00e\x00x\x00e\x00" {
+		t.Fatalf("expected ascii and wide variants, got %+v", cmd.Patterns)
+	}
+}
+
+func TestRuleEval(t *testing.T) {
+	parsed, err := Parse("sample.rules", sampleRules)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	dropper, tokens := parsed[0], parsed[1]
+
+	cases := []struct {
+		rule   *Rule
+		counts map[string]int
+		size   int64
+		want   bool
+	}{
+		{dropper, map[string]int{"$mz": 1, "$url": 1, "$cmd": 2}, 4096, true},
+		{dropper, map[string]int{"$mz": 1, "$url": 1}, 4096, false},
+		{dropper, map[string]int{"$mz": 1, "$url": 1, "$cmd": 1}, 2 << 20, false},
+		{tokens, map[string]int{"$tok_a": 3}, 10, true},
+		{tokens, map[string]int{"$tok_a": 1, "$tok_b": 1}, 10, true},
+		{tokens, map[string]int{"$tok_a": 2}, 10, false},
+	}
+	for i, tc := range cases {
+		if got := tc.rule.Eval(tc.counts, tc.size); got != tc.want {
+			t.Fatalf("case %d: %s eval = %v, want %v", i, tc.rule.Name, got, tc.want)
+		}
+	}
+}
+
+func TestParseRulesErrors(t *testing.T) {
+	cases := map[string]string{
+		"undefined string":   `rule a { strings: $a = "x" condition: $b }`,
+		"missing condition":  `rule a { strings: $a = "x" }`,
+		"nocase":             `rule a { strings: $a = "x" nocase condition: $a }`,
+		"all wildcards":      `rule a { strings: $a = { ?? ?? } condition: $a }`,
+		"jump":               `rule a { strings: $a = { 4D [2-4] 5A } condition: $a }`,
+		"duplicate rule":     `rule a { condition: true } rule a { condition: false }`,
+		"duplicate string":   `rule a { strings: $a = "x" $a = "y" condition: $a }`,
+		"bad operator":       `rule a { condition: filesize ~ 10 }`,
+		"unterminated":       `rule a { strings: $a = "x`,
+		"unterminated block": `rule a { /* oops`,
+	}
+	for name, src := range cases {
+		if _, err := Parse("bad.rules", src); err == nil {
+			t.Fatalf("%s: expected parse error", name)
+		}
+	}
+}
+
+func TestLoadFilesRejectsDuplicateRulesAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.rules")
+	second := filepath.Join(dir, "b.rules")
+	if err := os.WriteFile(first, []byte(`rule shared { condition: true }`), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.WriteFile(second, []byte(`rule shared { condition: false }`), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := LoadFiles([]string{first}); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, err := LoadFiles([]string{first, second}); err == nil {
+		t.Fatal("expected duplicate rule error")
+	}
+}
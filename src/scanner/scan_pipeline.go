@@ -7,10 +7,9 @@ import (
 	"strings"
 
 	"safnari/config"
+	"safnari/fuzzy"
 	"safnari/hasher"
 	"safnari/scanner/sensitive"
-
-	"github.com/glaslos/tlsh"
 )
 
 // ChunkConsumer is the streaming unit of work attached to a ScanPipeline.
@@ -73,50 +72,61 @@ func (c *streamHashConsumer) Finalize() error {
 	return nil
 }
 
+// streamFuzzyConsumer feeds the content to each configured fuzzy hasher.
 type streamFuzzyConsumer struct {
-	tlsh *tlsh.TLSH
-	hash string
+	names   []string
+	digests []fuzzy.Digest
+	hashes  map[string]string
 }
 
-func newStreamFuzzyConsumer() *streamFuzzyConsumer {
-	return &streamFuzzyConsumer{tlsh: tlsh.New()}
+func newStreamFuzzyConsumer(hashers []fuzzy.Hasher) *streamFuzzyConsumer {
+	c := &streamFuzzyConsumer{}
+	for _, hasher := range hashers {
+		c.names = append(c.names, hasher.Name())
+		c.digests = append(c.digests, hasher.New())
+	}
+	return c
 }
 
 func (c *streamFuzzyConsumer) Consume(chunk []byte, _ int64) error {
-	if c == nil || c.tlsh == nil {
+	if c == nil {
 		return nil
 	}
-	_, err := c.tlsh.Write(chunk)
-	return err
+	for _, digest := range c.digests {
+		if _, err := digest.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (c *streamFuzzyConsumer) Finalize() error {
-	if c == nil || c.tlsh == nil {
-		return nil
-	}
-	sum := c.tlsh.Sum(nil)
-	if len(sum) == 0 {
+	if c == nil {
 		return nil
 	}
-	allZero := true
-	for _, b := range sum {
-		if b != 0 {
-			allZero = false
-			break
+	for i, digest := range c.digests {
+		sum, err := digest.Sum()
+		if err != nil {
+			return err
 		}
+		if sum == "" {
+			continue
+		}
+		if c.hashes == nil {
+			c.hashes = make(map[string]string, len(c.digests))
+		}
+		c.hashes[c.names[i]] = sum
 	}
-	if allZero {
-		return nil
-	}
-	c.hash = c.tlsh.String()
 	return nil
 }
 
 type streamSearchConsumer struct {
-	limit    int64
-	consumed int64
-	counter  *streamAhoCounter
-	results  map[string]int
+	limit     int64
+	consumed  int64
+	counter   *streamAhoCounter
+	results   map[string]int
+	recorder  *locationRecorder
+	locations MatchLocations
 }
 
 func newStreamSearchConsumer(terms []string, limit int64) *streamSearchConsumer {
@@ -126,6 +136,16 @@ func newStreamSearchConsumer(terms []string, limit int64) *streamSearchConsumer
 	}
 }
 
+// trackLocations records where each hit occurs. A hit can start up to one
+// term length before the chunk that completes it.
+func (c *streamSearchConsumer) trackLocations(redaction locationRedaction) {
+	longest := 0
+	for _, term := range c.counter.matcher.terms {
+		longest = maxInt(longest, len(term))
+	}
+	c.recorder = newLocationRecorder(longest, maxSearchLocations, redaction)
+}
+
 func (c *streamSearchConsumer) Consume(chunk []byte, _ int64) error {
 	if c == nil || c.counter == nil || len(chunk) == 0 {
 		return nil
@@ -134,7 +154,15 @@ func (c *streamSearchConsumer) Consume(chunk []byte, _ int64) error {
 	if len(chunk) == 0 {
 		return nil
 	}
-	c.counter.Consume(chunk)
+	if c.recorder != nil {
+		c.recorder.begin(chunk, c.consumed)
+		c.counter.ConsumeEach(chunk, func(term string, start, end int64) {
+			c.recorder.add(term, start, end, term)
+		})
+		c.recorder.end()
+	} else {
+		c.counter.Consume(chunk)
+	}
 	c.consumed += int64(len(chunk))
 	return nil
 }
@@ -144,6 +172,9 @@ func (c *streamSearchConsumer) Finalize() error {
 		return nil
 	}
 	c.results = c.counter.Results()
+	if c.recorder != nil {
+		c.locations = c.recorder.finish()
+	}
 	return nil
 }
 
@@ -161,9 +192,14 @@ type streamSensitiveConsumer struct {
 	spanSeen             map[string]map[uint64]struct{}
 	matches              map[string][]string
 	counts               map[string]int
+	confidence           map[string][]float64
 	totalCount           int
 	saturated            bool
 
+	// recorder is set with --match-locations.
+	recorder  *locationRecorder
+	locations MatchLocations
+
 	regexBuffer []byte
 }
 
@@ -174,7 +210,7 @@ func newStreamSensitiveConsumer(
 	limit int64,
 ) *streamSensitiveConsumer {
 	critical := filterCriticalPatternNames(patternNames, patterns)
-	return &streamSensitiveConsumer{
+	consumer := &streamSensitiveConsumer{
 		cfg:                  cfg,
 		patterns:             patterns,
 		patternNames:         patternNames,
@@ -182,6 +218,10 @@ func newStreamSensitiveConsumer(
 		criticalPatternNames: critical,
 		spanSeen:             make(map[string]map[uint64]struct{}, len(patternNames)),
 	}
+	if locationsEnabled(cfg) {
+		consumer.recorder = newLocationRecorder(sensitiveCarryBytes(cfg), 0, newLocationRedaction(cfg, patterns))
+	}
+	return consumer
 }
 
 func (c *streamSensitiveConsumer) Consume(chunk []byte, offset int64) error {
@@ -192,11 +232,17 @@ func (c *streamSensitiveConsumer) Consume(chunk []byte, offset int64) error {
 	if len(chunk) == 0 {
 		return nil
 	}
+	if c.recorder != nil {
+		c.recorder.begin(chunk, offset)
+	}
 	if len(c.criticalPatternNames) > 0 {
 		if err := c.consumeDeterministic(chunk, offset); err != nil {
 			return err
 		}
 	}
+	if c.recorder != nil {
+		c.recorder.end()
+	}
 	if !c.saturated && c.needsRegexBuffer() {
 		c.regexBuffer = append(c.regexBuffer, chunk...)
 	}
@@ -225,8 +271,9 @@ func (c *streamSensitiveConsumer) consumeDeterministic(chunk []byte, offset int6
 	sensitive.ScanDeterministicVisit(
 		window,
 		activeCritical,
+		sensitiveOptions(c.cfg),
 		nil,
-		func(pattern string, start, end int) bool {
+		func(pattern string, start, end int, confidence float64) bool {
 			if end <= carryLimit {
 				return true
 			}
@@ -256,7 +303,15 @@ func (c *streamSensitiveConsumer) consumeDeterministic(chunk []byte, offset int6
 			if c.counts == nil {
 				c.counts = make(map[string]int, len(c.patternNames))
 			}
-			c.matches[pattern] = append(c.matches[pattern], string(window[start:end]))
+			if c.confidence == nil {
+				c.confidence = make(map[string][]float64, len(c.criticalPatternNames))
+			}
+			value := string(window[start:end])
+			c.matches[pattern] = append(c.matches[pattern], value)
+			c.confidence[pattern] = append(c.confidence[pattern], confidence)
+			if c.recorder != nil {
+				c.recorder.add(pattern, int64(absStart), int64(absEnd), redactLocationValue(c.cfg, value))
+			}
 			c.counts[pattern]++
 			c.totalCount++
 			if sensitiveCollectionSaturated(c.cfg, c.patternNames, c.counts, c.totalCount) {
@@ -271,13 +326,7 @@ func (c *streamSensitiveConsumer) consumeDeterministic(chunk []byte, offset int6
 }
 
 func (c *streamSensitiveConsumer) updateCarry(window []byte) error {
-	overlap := 0
-	if c.cfg != nil {
-		overlap = c.cfg.StreamOverlapBytes
-	}
-	if overlap <= 0 {
-		overlap = 512
-	}
+	overlap := sensitiveCarryBytes(c.cfg)
 	if len(window) <= overlap {
 		c.carry = append(c.carry[:0], window...)
 		return nil
@@ -286,6 +335,15 @@ func (c *streamSensitiveConsumer) updateCarry(window []byte) error {
 	return nil
 }
 
+// sensitiveCarryBytes is how much of each window the deterministic scan keeps
+// so matches spanning chunk boundaries are found.
+func sensitiveCarryBytes(cfg *config.Config) int {
+	if cfg != nil && cfg.StreamOverlapBytes > 0 {
+		return cfg.StreamOverlapBytes
+	}
+	return 512
+}
+
 func (c *streamSensitiveConsumer) needsRegexBuffer() bool {
 	if c == nil || c.cfg == nil {
 		return false
@@ -304,6 +362,9 @@ func (c *streamSensitiveConsumer) needsRegexBuffer() bool {
 }
 
 func (c *streamSensitiveConsumer) Finalize() error {
+	if c != nil && c.recorder != nil {
+		c.locations = c.recorder.finish()
+	}
 	if c == nil || c.saturated || !c.needsRegexBuffer() {
 		return nil
 	}
@@ -322,7 +383,7 @@ func (c *streamSensitiveConsumer) Finalize() error {
 	if remainingTotal == 0 && ((c.cfg != nil && c.cfg.SensitiveMaxTotal > 0) || sensitiveMatchMode(c.cfg) == "first") {
 		return nil
 	}
-	regexMatches, regexCounts := scanForSensitiveDataAdvanced(
+	regexMatches, regexCounts, regexSpans := scanForSensitiveDataScored(
 		c.regexBuffer,
 		c.patterns,
 		effectiveSensitivePerTypeLimit(c.cfg),
@@ -331,6 +392,7 @@ func (c *streamSensitiveConsumer) Finalize() error {
 		c.cfg.SensitiveLongtail,
 		c.cfg.SensitiveWindowBytes,
 		nonCritical,
+		sensitiveOptions(c.cfg),
 	)
 	if len(regexMatches) == 0 {
 		return nil
@@ -341,9 +403,26 @@ func (c *streamSensitiveConsumer) Finalize() error {
 	if c.counts == nil {
 		c.counts = make(map[string]int, len(regexCounts))
 	}
+	if c.confidence == nil {
+		c.confidence = make(map[string][]float64, len(regexSpans))
+	}
+	var index lineIndex
+	if c.recorder != nil {
+		index = newLineIndex(c.regexBuffer)
+	}
 	for name, values := range regexMatches {
 		c.matches[name] = append(c.matches[name], values...)
 	}
+	for name, spans := range regexSpans {
+		for _, span := range spans {
+			c.confidence[name] = append(c.confidence[name], span.confidence)
+			if c.recorder != nil {
+				value := string(c.regexBuffer[span.start:span.end])
+				loc := index.location(c.regexBuffer, span.start, span.end, redactLocationValue(c.cfg, value), newLocationRedaction(c.cfg, c.patterns))
+				c.locations = c.locations.add(name, loc)
+			}
+		}
+	}
 	for name, count := range regexCounts {
 		c.counts[name] += count
 	}
@@ -356,6 +435,10 @@ type contentAnalysisResults struct {
 	searchHits          map[string]int
 	sensitiveMatches    map[string][]string
 	sensitiveMatchCount map[string]int
+	sensitiveConfidence map[string][]float64
+	sensitiveLocations  MatchLocations
+	searchLocations     MatchLocations
+	ruleMatches         []RuleMatch
 }
 
 func runContentPipeline(fc *FileContext) (*contentAnalysisResults, error) {
@@ -372,56 +455,100 @@ func runContentPipeline(fc *FileContext) (*contentAnalysisResults, error) {
 	var consumers []ChunkConsumer
 
 	var hashConsumer *streamHashConsumer
-	if fc.Cfg.ScanFiles && fullFile && len(fc.Cfg.HashAlgorithms) > 0 {
-		hashConsumer = newStreamHashConsumer(fc.Cfg.HashAlgorithms)
+	if algorithms := fc.hashAlgorithms(); fc.Cfg.ScanFiles && fullFile && len(algorithms) > 0 {
+		hashConsumer = newStreamHashConsumer(algorithms)
 		if hashConsumer.set != nil && hashConsumer.set.Enabled() {
 			consumers = append(consumers, hashConsumer)
 		}
 	}
 
 	var fuzzyConsumer *streamFuzzyConsumer
-	if fc.Cfg.FuzzyHash && fullFile && fc.Info != nil {
+	if hashers := fc.fuzzyHashers(); fc.Cfg.FuzzyHash && fullFile && fc.Info != nil && len(hashers) > 0 {
 		size := fc.Info.Size()
 		if size >= fc.Cfg.FuzzyMinSize && (fc.Cfg.FuzzyMaxSize <= 0 || size <= fc.Cfg.FuzzyMaxSize) {
-			fuzzyConsumer = newStreamFuzzyConsumer()
+			fuzzyConsumer = newStreamFuzzyConsumer(hashers)
 			consumers = append(consumers, fuzzyConsumer)
 		}
 	}
 
+	// With an allowlist the digests come first, so files in it are read
+	// only once and never content scanned, which is what makes a large
+	// known-good set such as NSRL cheap. Other files are read again for the
+	// content scan, bounded by the content scan limit unless rules need the
+	// whole file.
+	var digests *contentAnalysisResults
+	if m := fc.hashSets(); m != nil && len(m.allowlist) > 0 && hashConsumer != nil && len(consumers) > 0 {
+		pipeline := &ScanPipeline{source: source, consumers: consumers}
+		if err := pipeline.Run(); err != nil {
+			return nil, err
+		}
+		digests = digestResults(hashConsumer, fuzzyConsumer)
+		if m.allowlisted(digests.hashes) {
+			fc.allowlisted = true
+			fc.addWarning("content scan skipped for a file in an allowlisted hash set")
+			return digests, nil
+		}
+		consumers, hashConsumer, fuzzyConsumer = nil, nil, nil
+	}
+
+	var ruleConsumer *streamRuleConsumer
+	if index := fc.ruleIndex(); index != nil && fullFile {
+		ruleConsumer = newStreamRuleConsumer(index, source, source.Size())
+		consumers = append(consumers, ruleConsumer)
+	}
+
+	// Documents with extractable text feed the text consumers from a second
+	// pipeline; hashing still covers the raw bytes.
+	extractText := fc.ExtractsText()
+	scanRaw := !extractText && source.ShouldSearchContent()
+	var textConsumers []ChunkConsumer
+
 	var searchConsumer *streamSearchConsumer
-	if len(fc.Cfg.SearchTerms) > 0 && source.ShouldSearchContent() {
+	if len(fc.Cfg.SearchTerms) > 0 && (scanRaw || extractText) {
 		searchConsumer = newStreamSearchConsumer(fc.Cfg.SearchTerms, contentLimit)
-		consumers = append(consumers, searchConsumer)
-		fc.markContentScan(contentLimit)
+		if locationsEnabled(fc.Cfg) {
+			searchConsumer.trackLocations(newLocationRedaction(fc.Cfg, fc.SensitivePatterns))
+		}
+		if scanRaw {
+			consumers = append(consumers, searchConsumer)
+			fc.markContentScan(contentLimit)
+		} else {
+			textConsumers = append(textConsumers, searchConsumer)
+		}
 	}
 
 	var sensitiveConsumer *streamSensitiveConsumer
-	if fc.Cfg.ScanSensitive && source.ShouldSearchContent() && len(fc.SensitivePatterns) > 0 {
+	if fc.Cfg.ScanSensitive && (scanRaw || extractText) && len(fc.SensitivePatterns) > 0 {
 		patternNames := make([]string, 0, len(fc.SensitivePatterns))
 		for name := range fc.SensitivePatterns {
 			patternNames = append(patternNames, name)
 		}
 		sort.Strings(patternNames)
 		sensitiveConsumer = newStreamSensitiveConsumer(fc.Cfg, fc.SensitivePatterns, patternNames, contentLimit)
-		consumers = append(consumers, sensitiveConsumer)
-		fc.markContentScan(contentLimit)
+		if scanRaw {
+			consumers = append(consumers, sensitiveConsumer)
+			fc.markContentScan(contentLimit)
+		} else {
+			textConsumers = append(textConsumers, sensitiveConsumer)
+		}
 	}
 
-	if len(consumers) == 0 {
-		return &contentAnalysisResults{}, nil
+	if len(consumers) == 0 && len(textConsumers) == 0 {
+		return (&contentAnalysisResults{}).withDigests(digests), nil
 	}
 
 	readLimit := contentLimit
-	if hashConsumer != nil || fuzzyConsumer != nil {
+	if hashConsumer != nil || fuzzyConsumer != nil || ruleConsumer != nil {
 		readLimit = 0
 	}
 
 	if fc.deltaCache != nil &&
+		ruleConsumer == nil &&
 		!(sensitiveConsumer != nil && fc.Cfg.RedactSensitive != "") &&
-		source.ShouldSearchContent() &&
+		scanRaw &&
 		(searchConsumer != nil || sensitiveConsumer != nil) &&
 		shouldUseDeltaChunkCacheForFile(fc, contentLimit, hashConsumer != nil || fuzzyConsumer != nil) {
-		return runContentPipelineWithDeltaCache(
+		results, err := runContentPipelineWithDeltaCache(
 			fc,
 			source,
 			contentLimit,
@@ -430,34 +557,67 @@ func runContentPipeline(fc *FileContext) (*contentAnalysisResults, error) {
 			searchConsumer != nil,
 			sensitiveConsumer != nil,
 		)
+		if err != nil {
+			return nil, err
+		}
+		return results.withDigests(digests), nil
 	}
 
-	pipeline := &ScanPipeline{
-		source:    source,
-		consumers: consumers,
-		limit:     readLimit,
+	if len(consumers) > 0 {
+		pipeline := &ScanPipeline{
+			source:    source,
+			consumers: consumers,
+			limit:     readLimit,
+		}
+		if err := pipeline.Run(); err != nil {
+			return nil, err
+		}
 	}
-	if err := pipeline.Run(); err != nil {
+	if err := fc.scanExtractedText(source, contentLimit, textConsumers); err != nil {
 		return nil, err
 	}
 
-	results := &contentAnalysisResults{}
-	if hashConsumer != nil {
-		results.hashes = hashConsumer.results
-	}
-	if fuzzyConsumer != nil && fuzzyConsumer.hash != "" {
-		results.fuzzyHashes = map[string]string{"tlsh": fuzzyConsumer.hash}
-	}
+	results := digestResults(hashConsumer, fuzzyConsumer).withDigests(digests)
 	if searchConsumer != nil {
 		results.searchHits = searchConsumer.results
+		results.searchLocations = searchConsumer.locations
 	}
 	if sensitiveConsumer != nil {
 		results.sensitiveMatches = sensitiveConsumer.matches
 		results.sensitiveMatchCount = sensitiveConsumer.counts
+		results.sensitiveConfidence = sensitiveConsumer.confidence
+		results.sensitiveLocations = sensitiveConsumer.locations
+	}
+	if ruleConsumer != nil {
+		results.ruleMatches = ruleConsumer.matches
+		fc.addWarning(ruleConsumer.warning())
 	}
 	return results, nil
 }
 
+func digestResults(hashConsumer *streamHashConsumer, fuzzyConsumer *streamFuzzyConsumer) *contentAnalysisResults {
+	results := &contentAnalysisResults{}
+	if hashConsumer != nil {
+		results.hashes = hashConsumer.results
+	}
+	if fuzzyConsumer != nil {
+		results.fuzzyHashes = fuzzyConsumer.hashes
+	}
+	return results
+}
+
+// withDigests copies in the digests of a pass run ahead of the content scan.
+func (r *contentAnalysisResults) withDigests(digests *contentAnalysisResults) *contentAnalysisResults {
+	if digests == nil {
+		return r
+	}
+	r.hashes = digests.hashes
+	if digests.fuzzyHashes != nil {
+		r.fuzzyHashes = digests.fuzzyHashes
+	}
+	return r
+}
+
 func truncateStreamChunk(chunk []byte, limit, consumed int64) []byte {
 	if limit <= 0 {
 		return chunk
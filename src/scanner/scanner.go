@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"safnari/config"
+	"safnari/container"
 	"safnari/logger"
 	"safnari/output"
 	"safnari/scanner/prefilter"
@@ -24,9 +25,30 @@ import (
 type fileScanTask struct {
 	path string
 	info os.FileInfo
+	// container is set for files of unpacked container layers, and image for
+	// a container or image whose layers are scanned as tar streams.
+	container *containerFile
+	image     *container.Target
+}
+
+// RunOptions carry state a long-running caller such as the agent shares
+// across scans.
+type RunOptions struct {
+	// DeltaCache is used instead of opening the cache in cfg.DeltaCacheDir.
+	// The caller flushes and closes it.
+	DeltaCache *DeltaChunkCache
+	// Pause holds the workers between files while paused.
+	Pause *PauseGate
+	// HideProgress turns off the progress bar.
+	HideProgress bool
 }
 
 func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics, w *output.Writer) error {
+	return ScanFilesWithOptions(ctx, cfg, metrics, w, RunOptions{})
+}
+
+// ScanFilesWithOptions is ScanFiles with state shared across runs.
+func ScanFilesWithOptions(ctx context.Context, cfg *config.Config, metrics *output.Metrics, w *output.Writer, opts RunOptions) error {
 	applyPerformanceProfile(cfg)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -56,22 +78,40 @@ func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics,
 		}
 		cfg.StartPaths = drives
 	}
+	var containerTargets []*container.Target
+	if cfg.ScansContainers() {
+		containerTargets = discoverContainerTargets(cfg)
+	}
 
 	totalFiles := 0
 	var bar *progressbar.ProgressBar
 
 	matcher := utils.NewPatternMatcher(cfg.IncludePatterns, cfg.ExcludePatterns)
+	includeContainerFile := func(path string, info os.FileInfo) bool {
+		if cfg.DeltaScan && info.ModTime().Before(lastScanTime) {
+			return false
+		}
+		return matcher.ShouldInclude(path)
+	}
 	artifactFilter := newInternalArtifactFilter(cfg)
 	setSIMDFastpathEnabled(cfg.SimdFastpath)
 	prefilter.SetSIMDFastpath(cfg.SimdFastpath)
 
+	// Prepare sensitive data patterns and modules before any file is
+	// counted, so an unusable rule file or hash set ends the scan up front.
+	sensitivePatterns := GetPatterns(cfg.IncludeDataTypes, cfg.CustomPatterns, cfg.ExcludeDataTypes)
+	fileModules, err := buildFileModules(cfg, sensitivePatterns)
+	if err != nil {
+		return err
+	}
+
 	if cfg.SkipCount {
 		logger.Info("Skipping total file count")
 		bar = progressbar.NewOptions(-1,
 			progressbar.OptionSetDescription("Scanning files"),
 			progressbar.OptionShowCount(),
 			progressbar.OptionSpinnerType(14),
-			progressbar.OptionSetVisibility(progressVisible()),
+			progressbar.OptionSetVisibility(progressVisible() && !opts.HideProgress),
 			progressbar.OptionFullWidth(),
 		)
 	} else {
@@ -85,6 +125,7 @@ func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics,
 			}
 			totalFiles += count
 		}
+		totalFiles += countContainerFiles(ctx, containerTargets, includeContainerFile)
 		logger.Infof("Total files to scan: %d", totalFiles)
 
 		// Update metrics with total file count
@@ -94,7 +135,7 @@ func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics,
 			progressbar.OptionSetDescription("Scanning files"),
 			progressbar.OptionShowCount(),
 			progressbar.OptionSetPredictTime(true),
-			progressbar.OptionSetVisibility(progressVisible()),
+			progressbar.OptionSetVisibility(progressVisible() && !opts.HideProgress),
 			progressbar.OptionFullWidth(),
 		)
 	}
@@ -110,15 +151,19 @@ func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics,
 		}
 	}()
 
-	// Prepare sensitive data patterns
-	sensitivePatterns := GetPatterns(cfg.IncludeDataTypes, cfg.CustomPatterns, cfg.ExcludeDataTypes)
-	fileModules := buildFileModules(cfg, sensitivePatterns)
-	deltaCache, err := openDeltaChunkCache(cfg)
-	if err != nil {
-		return err
+	duplicates := newDuplicateIndex(cfg)
+	if duplicates != nil {
+		fileModules = append(fileModules, duplicates)
 	}
-	if deltaCache != nil {
-		defer deltaCache.Close()
+	deltaCache := opts.DeltaCache
+	if deltaCache == nil {
+		var err error
+		if deltaCache, err = OpenDeltaChunkCache(cfg); err != nil {
+			return err
+		}
+		if deltaCache != nil {
+			defer deltaCache.Close()
+		}
 	}
 
 	// Implement I/O rate limiter
@@ -205,6 +250,45 @@ func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics,
 				logger.Warnf("Error walking path %s: %v", startPath, err)
 			}
 		}
+		shared := newSharedLayerFiles(containerTargets)
+		for _, target := range containerTargets {
+			if !target.OnDisk() {
+				if err := scheduler.Enqueue(ctx, fileScanTask{image: target}, cfg); err != nil {
+					return
+				}
+				continue
+			}
+			err := target.Walk(ctx, func(entry container.Entry) error {
+				path := containerRecordPath(target, entry.Path)
+				if !includeContainerFile(path, entry.Info) {
+					return nil
+				}
+				file := &containerFile{path: path, ref: containerRef(target, entry)}
+				if shared.add(entry, file) {
+					return nil
+				}
+				if err := scheduler.Enqueue(ctx, fileScanTask{path: entry.HostPath, info: entry.Info, container: file}, cfg); err != nil {
+					return err
+				}
+				if ioLimiter != nil {
+					return ioLimiter.Wait(ctx)
+				}
+				return nil
+			})
+			if err != nil && ctx.Err() == nil {
+				logger.Warnf("Error walking %s: %v", target.Root, err)
+			}
+		}
+		for _, task := range shared.tasks {
+			if err := scheduler.Enqueue(ctx, task, cfg); err != nil {
+				return
+			}
+			if ioLimiter != nil {
+				if err := ioLimiter.Wait(ctx); err != nil {
+					return
+				}
+			}
+		}
 	}()
 
 	// Start worker pool
@@ -231,12 +315,25 @@ func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics,
 				default:
 					// Continue processing
 				}
-				if err := processFile(ctx, task.path, task.info, cfg, w, sensitivePatterns, fileModules, deltaCache, true); err != nil {
+				if err := opts.Pause.Wait(ctx); err != nil {
+					return
+				}
+				processed := 1
+				var err error
+				switch {
+				case task.image != nil:
+					processed, err = scanContainerImage(ctx, task.image, cfg, w, sensitivePatterns, fileModules, includeContainerFile)
+				case task.container != nil:
+					err = processContainerFile(ctx, task.path, task.info, task.container, cfg, w, sensitivePatterns, fileModules, deltaCache)
+				default:
+					err = processFile(ctx, task.path, task.info, cfg, w, sensitivePatterns, fileModules, deltaCache, true)
+				}
+				if err != nil {
 					setScanError(err)
 					return
 				}
-				processedCounter.Add(1)
-				progressCh <- 1
+				processedCounter.Add(int64(processed))
+				progressCh <- processed
 			}
 		}()
 	}
@@ -244,6 +341,11 @@ func ScanFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics,
 	wg.Wait()
 	close(progressCh)
 	progressWG.Wait()
+	if duplicates != nil && firstErr == nil && ctx.Err() == nil {
+		if err := duplicates.write(w); err != nil {
+			return err
+		}
+	}
 	if err := w.WaitIdle(); err != nil {
 		return err
 	}
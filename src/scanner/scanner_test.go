@@ -3,17 +3,21 @@ package scanner
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"testing"
 	"time"
 
 	"safnari/config"
+	"safnari/fuzzy"
 	"safnari/logger"
 	"safnari/output"
+	"safnari/scanner/sensitive"
 	"safnari/systeminfo"
 	"safnari/utils"
 )
@@ -22,6 +26,15 @@ func init() {
 	logger.Init("error")
 }
 
+func testFileModules(tb testing.TB, cfg *config.Config, patterns map[string]*regexp.Regexp) []FileModule {
+	tb.Helper()
+	modules, err := buildFileModules(cfg, patterns)
+	if err != nil {
+		tb.Fatalf("build file modules: %v", err)
+	}
+	return modules
+}
+
 func TestIsHidden(t *testing.T) {
 	hidden, err := os.CreateTemp("", ".hidden")
 	if err != nil {
@@ -148,7 +161,7 @@ func TestRedactSensitiveMask(t *testing.T) {
 	matches := map[string][]string{
 		"email": {"test@example.com"},
 	}
-	redacted := redactSensitiveData(matches, "mask")
+	redacted := redactSensitiveData(matches, "mask", nil)
 	if redacted["email"][0] == "test@example.com" {
 		t.Fatal("expected masked value")
 	}
@@ -161,7 +174,7 @@ func TestRedactSensitiveHash(t *testing.T) {
 	matches := map[string][]string{
 		"email": {"test@example.com"},
 	}
-	redacted := redactSensitiveData(matches, "hash")
+	redacted := redactSensitiveData(matches, "hash", nil)
 	if len(redacted["email"][0]) != 64 {
 		t.Fatalf("expected sha256 hash length, got %d", len(redacted["email"][0]))
 	}
@@ -187,6 +200,91 @@ func TestDefaultPatternSelectionIncludesBuiltinsAndCustom(t *testing.T) {
 	}
 }
 
+func TestHighEntropyPatternIsOptIn(t *testing.T) {
+	if _, ok := GetPatterns(nil, nil, nil)["high_entropy_string"]; ok {
+		t.Fatal("high_entropy_string should not be selected by default")
+	}
+	if _, ok := GetPatterns([]string{"all"}, nil, nil)["high_entropy_string"]; ok {
+		t.Fatal("high_entropy_string should not be selected by all")
+	}
+	if _, ok := GetPatterns([]string{"high_entropy_string"}, nil, nil)["high_entropy_string"]; !ok {
+		t.Fatal("expected high_entropy_string when named explicitly")
+	}
+}
+
+func TestCollectFileDataHighEntropyRedacted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env.txt")
+	token := "Zx8Qp2LmN7vR4tYw9KjH3sDfG6aB1cE5"
+	if err := os.WriteFile(path, []byte("TOKEN="+token+"\n"), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fi, _ := os.Stat(path)
+	cfg := &config.Config{ScanSensitive: true, RedactSensitive: "mask"}
+	patterns := GetPatterns([]string{"high_entropy_string"}, nil, nil)
+	data, err := collectFileData(context.Background(), path, fi, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	got := data.SensitiveData["high_entropy_string"]
+	if len(got) != 1 || got[0] != strings.Repeat("*", len(token)-4)+token[len(token)-4:] {
+		t.Fatalf("expected one masked high entropy match, got %v", got)
+	}
+
+	// The settings come from each scan's config, so a stricter scan in the
+	// same process does not change the result of the default one.
+	strict := &config.Config{ScanSensitive: true, RedactSensitive: "mask", SensitiveEntropyMinLen: 40}
+	data, err = collectFileData(context.Background(), path, fi, strict, patterns, testFileModules(t, strict, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if got := data.SensitiveData["high_entropy_string"]; len(got) != 0 {
+		t.Fatalf("expected the minimum length to reject the token, got %v", got)
+	}
+	data, err = collectFileData(context.Background(), path, fi, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if got := data.SensitiveData["high_entropy_string"]; len(got) != 1 {
+		t.Fatalf("expected the default scan to still report the token, got %v", got)
+	}
+}
+
+func TestCollectFileDataDropsLowConfidenceBeforeLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payments.txt")
+	content := "bad GB82WEST12345698765433\ngood GB82WEST12345698765432\nssn 000-12-3456 and 123-45-6789\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fi, _ := os.Stat(path)
+	cfg := &config.Config{ScanSensitive: true, SensitiveMaxPerType: 1, SensitiveMinConfidence: sensitive.ValidatedMinConfidence}
+	patterns := GetPatterns([]string{"iban", "ssn"}, nil, nil)
+	data, err := collectFileData(context.Background(), path, fi, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	for pattern, want := range map[string]string{"iban": "GB82WEST12345698765432", "ssn": "123-45-6789"} {
+		got := data.SensitiveData[pattern]
+		if len(got) != 1 || got[0] != want {
+			t.Fatalf("expected only the valid %s to be kept, got %v", pattern, got)
+		}
+		scores := data.SensitiveDataConfidence[pattern]
+		if len(scores) != 1 || scores[0] < sensitive.ValidatedMinConfidence {
+			t.Fatalf("expected one confidence score for %s, got %v", pattern, scores)
+		}
+	}
+
+	// Without a threshold, as by default, every match is kept.
+	cfg.SensitiveMinConfidence = 0
+	cfg.SensitiveMaxPerType = 0
+	data, err = collectFileData(context.Background(), path, fi, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if got := data.SensitiveData["iban"]; len(got) != 2 {
+		t.Fatalf("expected the default threshold to keep the failing IBAN, got %v", got)
+	}
+}
+
 func TestGetFileAttributes(t *testing.T) {
 	tmp, _ := os.CreateTemp("", "attr")
 	tmp.Close()
@@ -207,7 +305,7 @@ func TestCollectFileData(t *testing.T) {
 	fi, _ := os.Stat(tmp.Name())
 	cfg := &config.Config{HashAlgorithms: []string{"md5"}, MaxFileSize: 1024, ScanFiles: true, ScanSensitive: true}
 	patterns := GetPatterns([]string{"email"}, nil, nil)
-	data, err := collectFileData(context.Background(), tmp.Name(), fi, cfg, patterns, buildFileModules(cfg, patterns), nil)
+	data, err := collectFileData(context.Background(), tmp.Name(), fi, cfg, patterns, testFileModules(t, cfg, patterns), nil)
 	if err != nil {
 		t.Fatalf("collect: %v", err)
 	}
@@ -232,7 +330,7 @@ func TestCollectFileDataSensitiveFirstMatchMode(t *testing.T) {
 		SensitiveMatchMode: "first",
 	}
 	patterns := GetPatterns([]string{"email", "api_key"}, nil, nil)
-	data, err := collectFileData(context.Background(), tmp.Name(), fi, cfg, patterns, buildFileModules(cfg, patterns), nil)
+	data, err := collectFileData(context.Background(), tmp.Name(), fi, cfg, patterns, testFileModules(t, cfg, patterns), nil)
 	if err != nil {
 		t.Fatalf("collect: %v", err)
 	}
@@ -267,7 +365,7 @@ func TestCollectFileDataLargeFileStillInventoried(t *testing.T) {
 		ScanFiles:      true,
 		ScanSensitive:  false,
 	}
-	data, err := collectFileData(context.Background(), tmp.Name(), fi, cfg, nil, buildFileModules(cfg, nil), nil)
+	data, err := collectFileData(context.Background(), tmp.Name(), fi, cfg, nil, testFileModules(t, cfg, nil), nil)
 	if err != nil {
 		t.Fatalf("collect: %v", err)
 	}
@@ -298,7 +396,7 @@ func TestCollectFileDataMarksContentTruncation(t *testing.T) {
 		ContentReadMode:     "stream",
 		StreamChunkSize:     4,
 	}
-	data, err := collectFileData(context.Background(), tmp.Name(), fi, cfg, nil, buildFileModules(cfg, nil), nil)
+	data, err := collectFileData(context.Background(), tmp.Name(), fi, cfg, nil, testFileModules(t, cfg, nil), nil)
 	if err != nil {
 		t.Fatalf("collect: %v", err)
 	}
@@ -597,6 +695,40 @@ func TestBuildFuzzyHashers(t *testing.T) {
 	}
 }
 
+func TestFuzzyHashersStreamTogether(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	var content strings.Builder
+	for i := 0; content.Len() < 64*1024; i++ {
+		fmt.Fprintf(&content, "line %d: the %x quick brown fox jumps over the lazy dog\n", i, i*7919)
+	}
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	cfg := &config.Config{
+		ScanFiles:       true,
+		FuzzyHash:       true,
+		FuzzyAlgorithms: []string{"tlsh", "ssdeep", "sdsim"},
+	}
+	data, err := collectFileData(context.Background(), path, fi, cfg, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	for _, name := range cfg.FuzzyAlgorithms {
+		hasher, _ := fuzzy.Lookup(name)
+		want, err := hasher.HashFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if data.FuzzyHashes[name] != want {
+			t.Fatalf("expected the streamed %s digest to match the file digest, got %q, want %q", name, data.FuzzyHashes[name], want)
+		}
+	}
+}
+
 func TestTraversalDiscoversExpectedSet(t *testing.T) {
 	root := t.TempDir()
 	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0755); err != nil {
@@ -770,3 +902,34 @@ func readFileRecords(t *testing.T, path string) []FileRecord {
 	}
 	return records
 }
+
+func TestPauseGateHoldsWaitersUntilResumed(t *testing.T) {
+	var gate PauseGate
+	if !gate.Pause() || gate.Pause() || !gate.Paused() {
+		t.Fatal("expected the first pause to close the gate")
+	}
+	done := make(chan error, 1)
+	go func() { done <- gate.Wait(context.Background()) }()
+	select {
+	case <-done:
+		t.Fatal("expected Wait to block while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if !gate.Resume() || gate.Resume() {
+		t.Fatal("expected the first resume to open the gate")
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+
+	gate.Pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := gate.Wait(ctx); err == nil {
+		t.Fatal("expected Wait to return when the context ends")
+	}
+	var none *PauseGate
+	if err := none.Wait(ctx); err != nil || none.Paused() {
+		t.Fatal("expected a nil gate to never pause")
+	}
+}
@@ -0,0 +1,358 @@
+package sensitive
+
+import (
+	"bytes"
+	"math"
+)
+
+// ConfidenceOptions controls match scoring. Matches scoring below
+// MinConfidence are dropped before they count against any limit; the zero
+// value keeps every match. With KeywordProximity set, a type-specific keyword
+// shortly before a match raises its score and its absence lowers it.
+type ConfidenceOptions struct {
+	MinConfidence    float64
+	KeywordProximity bool
+}
+
+// ValidatedMinConfidence is the threshold that drops matches failing a
+// checksum or structural check while keeping every match that merely has the
+// right shape.
+const ValidatedMinConfidence = 0.3
+
+// Scores assigned by the validators. Types without a validator get
+// shapeConfidence; credentials with a distinctive prefix get
+// validConfidence, and checksumConfidence is kept for values whose checksum
+// verified.
+const (
+	invalidConfidence   = 0.1
+	weakConfidence      = 0.2
+	shapeConfidence     = 0.5
+	plausibleConfidence = 0.6
+	validConfidence     = 0.8
+	checksumConfidence  = 0.9
+
+	keywordBonus   = 0.2
+	keywordPenalty = 0.1
+	keywordWindow  = 48
+)
+
+// Confidence scores the match content[start:end] for pattern between 0 and 1.
+func Confidence(pattern string, content []byte, start, end int, opts ConfidenceOptions) float64 {
+	if start < 0 || end > len(content) || end <= start {
+		return 0
+	}
+	score := valueConfidence(pattern, content[start:end])
+	if pattern == "ip_address" && score > weakConfidence && looksLikeVersion(content, start, end) {
+		score = weakConfidence
+	}
+	if opts.KeywordProximity && score > invalidConfidence {
+		if keywords, ok := contextKeywords[pattern]; ok {
+			if hasKeywordBefore(content, start, keywords) {
+				score += keywordBonus
+			} else {
+				score -= keywordPenalty
+			}
+		}
+	}
+	return math.Round(math.Min(1, math.Max(0, score))*100) / 100
+}
+
+func valueConfidence(pattern string, value []byte) float64 {
+	switch pattern {
+	case "email", "api_key", "jwt_token", "aws_access_key":
+		return validConfidence
+	case "github_token":
+		return githubTokenConfidence(value)
+	case "credit_card":
+		return pick(luhnValid(value), validConfidence)
+	case "ssn":
+		return pick(ssnValid(value), plausibleConfidence)
+	case "ip_address":
+		return ipv4Confidence(value)
+	case "phone_number":
+		return phoneConfidence(value)
+	case "iban":
+		return pick(ibanValid(value), checksumConfidence)
+	case "uk_nin":
+		return pick(ukNINValid(value), plausibleConfidence)
+	case "eu_vat":
+		return euVATConfidence(value)
+	case "india_aadhaar":
+		return pick(aadhaarValid(value), validConfidence)
+	case "china_id":
+		return pick(chinaIDValid(value), checksumConfidence)
+	default:
+		if isVendorCredentialPattern(pattern) {
+			return validConfidence
+		}
+		return shapeConfidence
+	}
+}
+
+func pick(valid bool, score float64) float64 {
+	if valid {
+		return score
+	}
+	return invalidConfidence
+}
+
+var contextKeywords = map[string][]string{
+	"credit_card":   {"card", "visa", "mastercard", "amex", "credit", "cc"},
+	"ssn":           {"ssn", "social security", "social sec"},
+	"ip_address":    {"ip", "host", "addr", "server", "remote", "client"},
+	"phone_number":  {"phone", "tel", "mobile", "cell", "fax", "call"},
+	"iban":          {"iban", "account", "bank"},
+	"uk_nin":        {"nino", "national insurance", "ni number", "nin"},
+	"eu_vat":        {"vat", "tax", "btw", "ust", "tva", "iva"},
+	"india_aadhaar": {"aadhaar", "aadhar", "uidai", "uid"},
+	"china_id":      {"id card", "resident", "citizen", "shenfenzheng", "身份证"},
+}
+
+// githubTokenConfidence gives gh*_ tokens, which carry a CRC32 checksum,
+// checksumConfidence when it verifies; fine-grained github_pat_ tokens have
+// no public checksum.
+func githubTokenConfidence(value []byte) float64 {
+	for _, prefix := range githubTokenPrefixes {
+		body, ok := bytes.CutPrefix(value, []byte(prefix))
+		if ok && len(body) == githubTokenBodyLen && githubChecksumValid(body) {
+			return checksumConfidence
+		}
+	}
+	return validConfidence
+}
+
+// hasKeywordBefore reports whether one of keywords appears as a whole word
+// shortly before start, so "cc" counts in "cc: 4111..." but not in
+// "access".
+func hasKeywordBefore(content []byte, start int, keywords []string) bool {
+	from := start - keywordWindow
+	if from < 0 {
+		from = 0
+	}
+	// Only ASCII is folded, so offsets in window match those in content.
+	window := []byte(string(content[from:start]))
+	for i, ch := range window {
+		if ch >= 'A' && ch <= 'Z' {
+			window[i] = ch + 'a' - 'A'
+		}
+	}
+	for _, keyword := range keywords {
+		for off := 0; off < len(window); {
+			i := bytes.Index(window[off:], []byte(keyword))
+			if i < 0 {
+				break
+			}
+			at := from + off + i
+			if wordBoundary(content, at) && wordBoundary(content, at+len(keyword)) {
+				return true
+			}
+			off += i + 1
+		}
+	}
+	return false
+}
+
+// wordBoundary reports whether a word starts or ends at content[i]: a
+// letter or digit on at most one side, or a case change as in creditCard.
+func wordBoundary(content []byte, i int) bool {
+	if i <= 0 || i >= len(content) {
+		return true
+	}
+	before, after := content[i-1], content[i]
+	if !isAlnum(before) || !isAlnum(after) {
+		return true
+	}
+	return before >= 'a' && before <= 'z' && after >= 'A' && after <= 'Z'
+}
+
+func digitsOf(value []byte) []byte {
+	out := make([]byte, 0, len(value))
+	for _, ch := range value {
+		if isDigit(ch) {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+// ssnValid applies the SSA allocation rules: area 000, 666 and 900-999,
+// group 00 and serial 0000 are never issued.
+func ssnValid(value []byte) bool {
+	digits := digitsOf(value)
+	if len(digits) != 9 {
+		return false
+	}
+	area := string(digits[:3])
+	if area == "000" || area == "666" || digits[0] == '9' {
+		return false
+	}
+	return string(digits[3:5]) != "00" && string(digits[5:]) != "0000"
+}
+
+// ipv4Confidence requires four octets no larger than 255.
+func ipv4Confidence(value []byte) float64 {
+	octets := bytes.Split(value, []byte("."))
+	if len(octets) != 4 {
+		return invalidConfidence
+	}
+	for _, octet := range octets {
+		if len(octet) == 0 || len(octet) > 3 {
+			return invalidConfidence
+		}
+		n := 0
+		for _, ch := range octet {
+			n = n*10 + int(ch-'0')
+		}
+		if n > 255 {
+			return invalidConfidence
+		}
+	}
+	return plausibleConfidence
+}
+
+// looksLikeVersion reports dotted runs such as v1.2.3.4 or 1.2.3.4.5 that
+// contain an IPv4-shaped match.
+func looksLikeVersion(content []byte, start, end int) bool {
+	if start > 0 {
+		switch content[start-1] {
+		case 'v', 'V', '.':
+			return true
+		}
+	}
+	return end+1 < len(content) && content[end] == '.' && isDigit(content[end+1])
+}
+
+// phoneConfidence checks the NANP rule that area and exchange codes start
+// with 2-9 and rejects runs of one repeated digit.
+func phoneConfidence(value []byte) float64 {
+	digits := digitsOf(value)
+	if len(digits) != 10 {
+		return invalidConfidence
+	}
+	if bytes.Count(digits, digits[:1]) == len(digits) {
+		return invalidConfidence
+	}
+	if digits[0] < '2' || digits[3] < '2' {
+		return weakConfidence
+	}
+	return shapeConfidence
+}
+
+// ibanValid performs the ISO 13616 mod-97 check.
+func ibanValid(value []byte) bool {
+	if len(value) < 15 || len(value) > 34 {
+		return false
+	}
+	rearranged := append(append([]byte{}, value[4:]...), value[:4]...)
+	remainder := 0
+	for _, ch := range rearranged {
+		switch {
+		case isDigit(ch):
+			remainder = (remainder*10 + int(ch-'0')) % 97
+		case ch >= 'A' && ch <= 'Z':
+			remainder = (remainder*100 + int(ch-'A') + 10) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+var ukNINInvalidPrefixes = [...]string{"BG", "GB", "KN", "NK", "NT", "TN", "ZZ"}
+
+func ukNINValid(value []byte) bool {
+	if len(value) < 2 {
+		return false
+	}
+	prefix := string(value[:2])
+	for _, invalid := range ukNINInvalidPrefixes {
+		if prefix == invalid {
+			return false
+		}
+	}
+	return true
+}
+
+var euVATCountries = map[string]bool{
+	"AT": true, "BE": true, "BG": true, "CY": true, "CZ": true, "DE": true, "DK": true, "EE": true,
+	"EL": true, "ES": true, "FI": true, "FR": true, "HR": true, "HU": true, "IE": true, "IT": true,
+	"LT": true, "LU": true, "LV": true, "MT": true, "NL": true, "PL": true, "PT": true, "RO": true,
+	"SE": true, "SI": true, "SK": true,
+}
+
+// euVATConfidence requires digits after the country code, since the pattern
+// alone also matches long upper-case words.
+func euVATConfidence(value []byte) float64 {
+	if len(value) < 3 || len(digitsOf(value[2:])) < 2 {
+		return invalidConfidence
+	}
+	if !euVATCountries[string(value[:2])] {
+		return weakConfidence
+	}
+	return shapeConfidence
+}
+
+var (
+	verhoeffMultiply = [10][10]byte{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+		{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+		{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+		{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffPermute = [8][10]byte{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+		{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+		{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+		{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+)
+
+// aadhaarValid checks the Verhoeff check digit. UIDAI never issues numbers
+// starting with 0 or 1.
+func aadhaarValid(value []byte) bool {
+	digits := digitsOf(value)
+	if len(digits) != 12 || digits[0] < '2' {
+		return false
+	}
+	var check byte
+	for i := 0; i < len(digits); i++ {
+		d := digits[len(digits)-1-i] - '0'
+		check = verhoeffMultiply[check][verhoeffPermute[i%8][d]]
+	}
+	return check == 0
+}
+
+var chinaIDWeights = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+const chinaIDCheckChars = "10X98765432"
+
+// chinaIDValid checks the ISO 7064 MOD 11-2 check character of a GB 11643
+// resident identity number.
+func chinaIDValid(value []byte) bool {
+	if len(value) != 18 {
+		return false
+	}
+	sum := 0
+	for i, weight := range chinaIDWeights {
+		if !isDigit(value[i]) {
+			return false
+		}
+		sum += int(value[i]-'0') * weight
+	}
+	want := chinaIDCheckChars[sum%11]
+	got := value[17]
+	if got == 'x' {
+		got = 'X'
+	}
+	return got == want
+}
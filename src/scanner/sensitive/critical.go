@@ -4,14 +4,20 @@ import "bytes"
 
 func IsCriticalPattern(name string) bool {
 	switch name {
-	case "email", "credit_card", "ssn", "api_key", "aws_access_key", "jwt_token":
+	case "email", "credit_card", "ssn", "api_key", "aws_access_key", "jwt_token", "high_entropy_string":
 		return true
 	default:
-		return false
+		return isVendorCredentialPattern(name)
 	}
 }
 
-func ScanDeterministic(content []byte, pattern string, limit int) []string {
+// CriticalPatterns lists every pattern IsCriticalPattern accepts.
+func CriticalPatterns() []string {
+	names := []string{"email", "credit_card", "ssn", "api_key", "aws_access_key", "jwt_token", "high_entropy_string"}
+	return append(names, vendorCredentialPatterns[:]...)
+}
+
+func ScanDeterministic(content []byte, pattern string, opts Options, limit int) []string {
 	if limit == 0 {
 		return nil
 	}
@@ -28,7 +34,12 @@ func ScanDeterministic(content []byte, pattern string, limit int) []string {
 		return scanAWSAccessKeys(content, limit)
 	case "jwt_token":
 		return scanJWT(content, limit)
+	case "high_entropy_string":
+		return scanHighEntropy(content, opts.Entropy, limit)
 	default:
+		if isVendorCredentialPattern(pattern) {
+			return scanVendorCredential(content, pattern, limit)
+		}
 		return nil
 	}
 }
@@ -234,6 +245,27 @@ func scanJWT(content []byte, limit int) []string {
 	return out
 }
 
+func scanHighEntropy(content []byte, opts EntropyOptions, limit int) []string {
+	var out []string
+	opts = opts.withDefaults()
+	for i := 0; i < len(content); i++ {
+		if !isEntropyTokenChar(content[i]) {
+			continue
+		}
+		end, ok := matchHighEntropyAt(content, i, opts)
+		if ok {
+			out = append(out, string(content[i:end]))
+			if limit > 0 && len(out) >= limit {
+				break
+			}
+		}
+		if end > i {
+			i = end - 1
+		}
+	}
+	return out
+}
+
 func scanJWTSegment(content []byte, start int) int {
 	i := start
 	for i < len(content) && isJWTChar(content[i]) {
@@ -1,18 +1,20 @@
 package sensitive
 
 type Match struct {
-	Pattern string
-	Value   string
-	Start   int
-	End     int
+	Pattern    string
+	Value      string
+	Start      int
+	End        int
+	Confidence float64
 }
 
 func ScanDeterministicAll(
 	content []byte,
 	patternNames []string,
+	opts Options,
 	maxPerType, maxTotal int,
 ) (map[string][]string, map[string]int) {
-	matches := ScanDeterministicMatches(content, patternNames, maxPerType, maxTotal)
+	matches := ScanDeterministicMatches(content, patternNames, opts, maxPerType, maxTotal)
 	if len(matches) == 0 {
 		return nil, nil
 	}
@@ -28,8 +30,9 @@ func ScanDeterministicAll(
 func ScanDeterministicVisit(
 	content []byte,
 	patternNames []string,
+	opts Options,
 	want func(pattern string) bool,
-	visit func(pattern string, start, end int) bool,
+	visit func(pattern string, start, end int, confidence float64) bool,
 ) {
 	if len(content) == 0 || len(patternNames) == 0 {
 		return
@@ -42,14 +45,26 @@ func ScanDeterministicVisit(
 
 	useWant := want != nil
 	if visit == nil {
-		visit = func(string, int, int) bool { return true }
+		visit = func(string, int, int, float64) bool { return true }
 	}
 
+	confidenceOpts := opts.Confidence
+	var entropyOpts EntropyOptions
+	if enabled.highEntropy {
+		entropyOpts = opts.Entropy.withDefaults()
+	}
+	allow := func(pattern string) bool { return !useWant || want(pattern) }
 	apiKeySeen := make(map[string]struct{}, 8)
 	emit := func(pattern string, start, end int) bool {
 		if start < 0 || end <= start || end > len(content) || (useWant && !want(pattern)) {
 			return true
 		}
+		// Low-confidence matches are dropped here so they never count
+		// against the caller's limits.
+		confidence := Confidence(pattern, content, start, end, confidenceOpts)
+		if confidence < confidenceOpts.MinConfidence {
+			return true
+		}
 		if pattern == "api_key" {
 			value := string(content[start:end])
 			if _, exists := apiKeySeen[value]; exists {
@@ -57,7 +72,7 @@ func ScanDeterministicVisit(
 			}
 			apiKeySeen[value] = struct{}{}
 		}
-		return visit(pattern, start, end)
+		return visit(pattern, start, end, confidence)
 	}
 
 	for i := 0; i < len(content); i++ {
@@ -83,6 +98,16 @@ func ScanDeterministicVisit(
 			}
 		}
 
+		if enabled.anyVendor() {
+			if pattern, end, ok := matchVendorCredentialAt(content, i, enabled, allow); ok {
+				if !emit(pattern, i, end) {
+					return
+				}
+				i = end - 1
+				continue
+			}
+		}
+
 		if enabled.email && (!useWant || want("email")) && ch == '@' {
 			if start, end, ok := matchEmailAroundAt(content, i); ok {
 				if !emit("email", start, end) {
@@ -103,6 +128,18 @@ func ScanDeterministicVisit(
 			}
 		}
 
+		// Labelled and structured detectors above take precedence; a token
+		// only becomes high_entropy_string when none of them claimed it.
+		if enabled.highEntropy && (!useWant || want("high_entropy_string")) && isEntropyTokenChar(ch) {
+			if end, ok := matchHighEntropyAt(content, i, entropyOpts); ok {
+				if !emit("high_entropy_string", i, end) {
+					return
+				}
+				i = end - 1
+				continue
+			}
+		}
+
 		if !isDigit(ch) {
 			continue
 		}
@@ -134,6 +171,7 @@ func ScanDeterministicVisit(
 func ScanDeterministicMatches(
 	content []byte,
 	patternNames []string,
+	opts Options,
 	maxPerType, maxTotal int,
 ) []Match {
 	if len(content) == 0 || len(patternNames) == 0 {
@@ -147,6 +185,7 @@ func ScanDeterministicMatches(
 	ScanDeterministicVisit(
 		content,
 		patternNames,
+		opts,
 		func(pattern string) bool {
 			if totalLimited && len(matches) >= maxTotal {
 				return false
@@ -156,12 +195,13 @@ func ScanDeterministicMatches(
 			}
 			return true
 		},
-		func(pattern string, start, end int) bool {
+		func(pattern string, start, end int, confidence float64) bool {
 			matches = append(matches, Match{
-				Pattern: pattern,
-				Value:   string(content[start:end]),
-				Start:   start,
-				End:     end,
+				Pattern:    pattern,
+				Value:      string(content[start:end]),
+				Start:      start,
+				End:        end,
+				Confidence: confidence,
 			})
 			perTypeCounts[pattern]++
 			if totalLimited && len(matches) >= maxTotal {
@@ -181,10 +221,27 @@ type criticalPatternSet struct {
 	apiKey       bool
 	awsAccessKey bool
 	jwtToken     bool
+	highEntropy  bool
+
+	githubToken       bool
+	slackToken        bool
+	stripeKey         bool
+	gcpServiceAccount bool
+	azureConnString   bool
+	pemPrivateKey     bool
+	sshPrivateKey     bool
+	npmToken          bool
+	pypiToken         bool
 }
 
 func (s criticalPatternSet) any() bool {
-	return s.email || s.creditCard || s.ssn || s.apiKey || s.awsAccessKey || s.jwtToken
+	return s.email || s.creditCard || s.ssn || s.apiKey || s.awsAccessKey || s.jwtToken || s.highEntropy ||
+		s.anyVendor()
+}
+
+func (s criticalPatternSet) anyVendor() bool {
+	return s.githubToken || s.slackToken || s.stripeKey || s.gcpServiceAccount || s.azureConnString ||
+		s.pemPrivateKey || s.sshPrivateKey || s.npmToken || s.pypiToken
 }
 
 func enabledCriticalPatterns(patternNames []string) criticalPatternSet {
@@ -203,6 +260,26 @@ func enabledCriticalPatterns(patternNames []string) criticalPatternSet {
 			enabled.awsAccessKey = true
 		case "jwt_token":
 			enabled.jwtToken = true
+		case "high_entropy_string":
+			enabled.highEntropy = true
+		case "github_token":
+			enabled.githubToken = true
+		case "slack_token":
+			enabled.slackToken = true
+		case "stripe_key":
+			enabled.stripeKey = true
+		case "gcp_service_account":
+			enabled.gcpServiceAccount = true
+		case "azure_connection_string":
+			enabled.azureConnString = true
+		case "pem_private_key":
+			enabled.pemPrivateKey = true
+		case "ssh_private_key":
+			enabled.sshPrivateKey = true
+		case "npm_token":
+			enabled.npmToken = true
+		case "pypi_token":
+			enabled.pypiToken = true
 		}
 	}
 	return enabled
@@ -16,9 +16,9 @@ func TestScanDeterministicAllParityWithPerPatternScans(t *testing.T) {
 	)
 	patterns := []string{"email", "credit_card", "ssn", "api_key", "aws_access_key", "jwt_token"}
 
-	allMatches, allCounts := ScanDeterministicAll(content, patterns, 100, 1000)
+	allMatches, allCounts := ScanDeterministicAll(content, patterns, Options{}, 100, 1000)
 	for _, pattern := range patterns {
-		want := ScanDeterministic(content, pattern, 100)
+		want := ScanDeterministic(content, pattern, Options{}, 100)
 		got := allMatches[pattern]
 		if !reflect.DeepEqual(got, want) {
 			t.Fatalf("deterministic all mismatch for %s: got=%v want=%v", pattern, got, want)
@@ -36,12 +36,12 @@ func TestScanDeterministicMatchesRespectsLimits(t *testing.T) {
 	)
 	patterns := []string{"email", "aws_access_key"}
 
-	matches := ScanDeterministicMatches(content, patterns, 1, 1)
+	matches := ScanDeterministicMatches(content, patterns, Options{}, 1, 1)
 	if len(matches) != 1 {
 		t.Fatalf("expected total limit to cap matches at 1, got %d", len(matches))
 	}
 
-	perType := ScanDeterministicMatches(content, patterns, 1, 0)
+	perType := ScanDeterministicMatches(content, patterns, Options{}, 1, 0)
 	var emailCount, awsCount int
 	for _, m := range perType {
 		switch m.Pattern {
@@ -61,7 +61,7 @@ func TestScanDeterministicVisitStopsOnVisitorDecision(t *testing.T) {
 	patterns := []string{"email"}
 	visited := 0
 
-	ScanDeterministicVisit(content, patterns, nil, func(pattern string, start, end int) bool {
+	ScanDeterministicVisit(content, patterns, Options{}, nil, func(pattern string, start, end int, _ float64) bool {
 		visited++
 		return false
 	})
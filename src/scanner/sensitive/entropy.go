@@ -0,0 +1,104 @@
+package sensitive
+
+import "math"
+
+// EntropyOptions tunes the high_entropy_string detector. Thresholds are
+// Shannon entropy in bits per character.
+type EntropyOptions struct {
+	MinLength       int
+	Base64Threshold float64
+	HexThreshold    float64
+}
+
+// DefaultEntropyOptions flags random-looking tokens of at least 20
+// characters. A random 20-character base64 token scores about 4.1 bits and
+// random hex about 3.6 bits, while identifiers and prose stay well below.
+var DefaultEntropyOptions = EntropyOptions{
+	MinLength:       20,
+	Base64Threshold: 4.0,
+	HexThreshold:    3.0,
+}
+
+// withDefaults fills zero fields from DefaultEntropyOptions.
+func (opts EntropyOptions) withDefaults() EntropyOptions {
+	if opts.MinLength <= 0 {
+		opts.MinLength = DefaultEntropyOptions.MinLength
+	}
+	if opts.Base64Threshold <= 0 {
+		opts.Base64Threshold = DefaultEntropyOptions.Base64Threshold
+	}
+	if opts.HexThreshold <= 0 {
+		opts.HexThreshold = DefaultEntropyOptions.HexThreshold
+	}
+	return opts
+}
+
+// matchHighEntropyAt scores the base64 or hex token starting at start. It
+// only fires at token boundaries and requires both a letter and a digit so
+// plain words and long numbers are left to the other detectors.
+func matchHighEntropyAt(content []byte, start int, opts EntropyOptions) (end int, ok bool) {
+	if start > 0 && isEntropyTokenChar(content[start-1]) {
+		return 0, false
+	}
+	end = start
+	hex := true
+	var letters, digits bool
+	for end < len(content) && isEntropyTokenChar(content[end]) {
+		ch := content[end]
+		switch {
+		case isDigit(ch):
+			digits = true
+		case isASCIILetter(ch):
+			letters = true
+			if !isHexLetter(ch) {
+				hex = false
+			}
+		default:
+			hex = false
+		}
+		end++
+	}
+	scored := end
+	for end < len(content) && content[end] == '=' && end-scored < 2 {
+		end++
+	}
+	if scored-start < opts.MinLength || !letters || !digits {
+		return scored, false
+	}
+	threshold := opts.Base64Threshold
+	if hex {
+		threshold = opts.HexThreshold
+	}
+	if shannonEntropy(content[start:scored]) < threshold {
+		return scored, false
+	}
+	return end, true
+}
+
+func shannonEntropy(token []byte) float64 {
+	if len(token) == 0 {
+		return 0
+	}
+	var freq [256]int
+	for _, ch := range token {
+		freq[ch]++
+	}
+	n := float64(len(token))
+	var bits float64
+	for _, count := range freq {
+		if count == 0 {
+			continue
+		}
+		p := float64(count) / n
+		bits -= p * math.Log2(p)
+	}
+	return bits
+}
+
+func isEntropyTokenChar(ch byte) bool {
+	return isASCIILetter(ch) || isDigit(ch) || ch == '+' || ch == '/' || ch == '_' || ch == '-'
+}
+
+func isHexLetter(ch byte) bool {
+	return (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
@@ -0,0 +1,63 @@
+package sensitive
+
+import (
+	"math"
+	"testing"
+)
+
+func TestShannonEntropy(t *testing.T) {
+	if got := shannonEntropy([]byte("aaaa")); got != 0 {
+		t.Fatalf("expected zero entropy for repeated byte, got %f", got)
+	}
+	if got := shannonEntropy([]byte("abcd")); math.Abs(got-2) > 1e-9 {
+		t.Fatalf("expected 2 bits for four distinct bytes, got %f", got)
+	}
+}
+
+func TestScanHighEntropy(t *testing.T) {
+	base64Token := "Zx8Qp2LmN7vR4tYw9KjH3sDfG6aB1cE5+/Q="
+	hexToken := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b"
+	content := []byte("Authorization: Bearer " + base64Token + "\n" +
+		"checksum=" + hexToken + "\n" +
+		"path=/usr/share/documentation/readme\n" +
+		"order 12345678901234567890123 shipped\n" +
+		"ThisIsAnOrdinaryIdentifierName\n")
+
+	got := ScanDeterministic(content, "high_entropy_string", Options{}, -1)
+	if len(got) != 2 || got[0] != base64Token || got[1] != hexToken {
+		t.Fatalf("unexpected high entropy matches: %q", got)
+	}
+
+	all, _ := ScanDeterministicAll(content, []string{"high_entropy_string"}, Options{}, 0, 0)
+	if len(all["high_entropy_string"]) != 2 {
+		t.Fatalf("one-pass scan disagrees with per-pattern scan: %q", all["high_entropy_string"])
+	}
+}
+
+func TestHighEntropyDefersToStructuredDetectors(t *testing.T) {
+	content := []byte("key AKIA" + "ABCDEFGHIJ234567XYZ9 end")
+	matches := ScanDeterministicMatches(content, []string{"aws_access_key", "high_entropy_string"}, Options{}, 0, 0)
+	if len(matches) != 1 || matches[0].Pattern != "aws_access_key" {
+		t.Fatalf("expected aws key to claim the token, got %+v", matches)
+	}
+}
+
+func TestEntropyOptions(t *testing.T) {
+	token := []byte("Zx8Qp2LmN7vR4tYw9KjH3sDfG6aB1cE5")
+	scan := func(opts EntropyOptions) []string {
+		return ScanDeterministic(token, "high_entropy_string", Options{Entropy: opts}, -1)
+	}
+	if got := scan(EntropyOptions{MinLength: 40}); len(got) != 0 {
+		t.Fatalf("expected min length to reject 32-char token, got %q", got)
+	}
+	if got := scan(EntropyOptions{Base64Threshold: 5.5}); len(got) != 0 {
+		t.Fatalf("expected threshold to reject token, got %q", got)
+	}
+	if got := scan(EntropyOptions{}); len(got) != 1 {
+		t.Fatalf("expected defaults to accept token, got %q", got)
+	}
+	matches := ScanDeterministicMatches(token, []string{"high_entropy_string"}, Options{Entropy: EntropyOptions{MinLength: 40}}, 0, 0)
+	if len(matches) != 0 {
+		t.Fatalf("expected the one-pass scan to use the same options, got %+v", matches)
+	}
+}
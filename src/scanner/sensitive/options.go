@@ -0,0 +1,9 @@
+package sensitive
+
+// Options carry the settings of one scan to the deterministic detectors, so
+// scans running in the same process do not share them. The zero value uses
+// the defaults.
+type Options struct {
+	Entropy    EntropyOptions
+	Confidence ConfidenceOptions
+}
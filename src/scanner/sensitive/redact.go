@@ -0,0 +1,89 @@
+package sensitive
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Redact renders value for output. hash is unsalted, so small value
+// spaces can be enumerated; hmac keys the digest instead. token keeps the
+// value's shape and its last four letters or digits.
+func Redact(value, mode string, key []byte) string {
+	switch mode {
+	case "hash":
+		sum := sha256.Sum256([]byte(value))
+		return fmt.Sprintf("%x", sum[:])
+	case "hmac":
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))
+	case "token":
+		return tokenizeValue(value)
+	case "mask":
+		if len(value) <= 4 {
+			return "****"
+		}
+		return strings.Repeat("*", len(value)-4) + value[len(value)-4:]
+	default:
+		return value
+	}
+}
+
+// tokenizeValue replaces every letter and digit except the last four with X,
+// so 123-45-6789 becomes XXX-XX-6789. Values with four or fewer letters and
+// digits are replaced entirely.
+func tokenizeValue(value string) string {
+	runes := []rune(value)
+	keep := 4
+	if countAlphanumeric(runes) <= keep {
+		keep = 0
+	}
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			continue
+		}
+		if keep > 0 {
+			keep--
+			continue
+		}
+		runes[i] = 'X'
+	}
+	return string(runes)
+}
+
+func countAlphanumeric(runes []rune) int {
+	n := 0
+	for _, r := range runes {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// RedactText replaces every critical pattern match in text with its redacted
+// form, leaving the text around the matches intact.
+func RedactText(text, mode string, key []byte) string {
+	matches := ScanDeterministicMatches([]byte(text), CriticalPatterns(), Options{}, 0, 0)
+	if len(matches) == 0 {
+		return text
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m.Start < last {
+			continue
+		}
+		b.WriteString(text[last:m.Start])
+		b.WriteString(Redact(m.Value, mode, key))
+		last = m.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
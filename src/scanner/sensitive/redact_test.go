@@ -0,0 +1,42 @@
+package sensitive
+
+import "testing"
+
+func TestRedactSensitiveHMAC(t *testing.T) {
+	key := []byte("0123456789abcdef0123")
+	value := "123-45-6789"
+	first := Redact(value, "hmac", key)
+	if len(first) != 64 || first == Redact(value, "hash", nil) {
+		t.Fatalf("expected a keyed digest distinct from the plain hash, got %q", first)
+	}
+	if again := Redact(value, "hmac", append([]byte(nil), key...)); again != first {
+		t.Fatal("expected the same key to keep matches correlatable")
+	}
+	if other := Redact(value, "hmac", []byte("another-key-0123456789")); other == first {
+		t.Fatal("expected a different key to produce a different digest")
+	}
+}
+
+func TestRedactSensitiveToken(t *testing.T) {
+	cases := map[string]string{
+		"123-45-6789":         "XXX-XX-6789",
+		"4111 1111 1111 1111": "XXXX XXXX XXXX 1111",
+		"test@example.com":    "XXXX@XXXXXXe.com",
+		"ab-1":                "XX-X",
+	}
+	for value, want := range cases {
+		if got := Redact(value, "token", nil); got != want {
+			t.Fatalf("token(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestRedactText(t *testing.T) {
+	got := RedactText("mail ops@example.com or 123-45-6789 today", "token", nil)
+	if want := "mail XXX@XXXXXXe.com or XXX-XX-6789 today"; got != want {
+		t.Fatalf("RedactText = %q, want %q", got, want)
+	}
+	if plain := "/usr/local/bin:/usr/bin"; RedactText(plain, "mask", nil) != plain {
+		t.Fatal("expected text without matches to be left alone")
+	}
+}
@@ -0,0 +1,427 @@
+package sensitive
+
+import (
+	"bytes"
+	"hash/crc32"
+)
+
+// vendorCredentialPatterns are the cloud and SaaS credential types recognised
+// by a fixed prefix or marker.
+var vendorCredentialPatterns = [...]string{
+	"github_token",
+	"slack_token",
+	"stripe_key",
+	"gcp_service_account",
+	"azure_connection_string",
+	"pem_private_key",
+	"ssh_private_key",
+	"npm_token",
+	"pypi_token",
+}
+
+func isVendorCredentialPattern(name string) bool {
+	for _, pattern := range vendorCredentialPatterns {
+		if pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// matchVendorCredentialAt dispatches on the byte at start to the vendor
+// matcher whose prefix begins with it. allow may veto a pattern before any
+// matching work is done.
+func matchVendorCredentialAt(
+	content []byte,
+	start int,
+	enabled criticalPatternSet,
+	allow func(pattern string) bool,
+) (pattern string, end int, ok bool) {
+	try := func(name string, on bool, match func([]byte, int) (int, bool)) bool {
+		if !on || (allow != nil && !allow(name)) {
+			return false
+		}
+		end, ok = match(content, start)
+		if ok {
+			pattern = name
+		}
+		return ok
+	}
+	switch content[start] {
+	case 'g':
+		try("github_token", enabled.githubToken, matchGitHubTokenAt)
+	case 'x':
+		try("slack_token", enabled.slackToken, matchSlackTokenAt)
+	case 's', 'r':
+		try("stripe_key", enabled.stripeKey, matchStripeKeyAt)
+	case '"':
+		try("gcp_service_account", enabled.gcpServiceAccount, matchGCPServiceAccountAt)
+	case 'D':
+		try("azure_connection_string", enabled.azureConnString, matchAzureConnectionStringAt)
+	case '-':
+		if !try("pem_private_key", enabled.pemPrivateKey, matchPEMPrivateKeyAt) {
+			try("ssh_private_key", enabled.sshPrivateKey, matchOpenSSHPrivateKeyAt)
+		}
+	case 'P':
+		try("ssh_private_key", enabled.sshPrivateKey, matchPuTTYPrivateKeyAt)
+	case 'n':
+		try("npm_token", enabled.npmToken, matchNPMTokenAt)
+	case 'p':
+		try("pypi_token", enabled.pypiToken, matchPyPITokenAt)
+	}
+	return pattern, end, ok
+}
+
+func scanVendorCredential(content []byte, pattern string, limit int) []string {
+	var out []string
+	enabled := enabledCriticalPatterns([]string{pattern})
+	for i := 0; i < len(content); i++ {
+		_, end, ok := matchVendorCredentialAt(content, i, enabled, nil)
+		if !ok {
+			continue
+		}
+		out = append(out, string(content[i:end]))
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+		i = end - 1
+	}
+	return out
+}
+
+var githubTokenPrefixes = [...]string{"ghp_", "gho_", "ghu_", "ghs_", "ghr_"}
+
+const (
+	githubPATPrefix     = "github_pat_"
+	githubPATBodyLen    = 82
+	githubTokenBodyLen  = 36
+	githubChecksumStart = 30
+)
+
+// matchGitHubTokenAt matches classic tokens (ghp_, gho_, ghu_, ghs_, ghr_),
+// whose last six characters are a base62 CRC32 of the preceding thirty, and
+// fine-grained github_pat_ tokens, which carry no public checksum.
+func matchGitHubTokenAt(content []byte, start int) (end int, ok bool) {
+	if !alnumBoundaryBefore(content, start) {
+		return 0, false
+	}
+	if hasPrefixAt(content, start, githubPATPrefix) {
+		body := start + len(githubPATPrefix)
+		end = body
+		for end < len(content) && isWordChar(content[end]) {
+			end++
+		}
+		if end-body != githubPATBodyLen {
+			return 0, false
+		}
+		return end, true
+	}
+	for _, prefix := range githubTokenPrefixes {
+		if !hasPrefixAt(content, start, prefix) {
+			continue
+		}
+		body := start + len(prefix)
+		end = body
+		for end < len(content) && isAlnum(content[end]) {
+			end++
+		}
+		if end-body != githubTokenBodyLen || (end < len(content) && content[end] == '_') {
+			return 0, false
+		}
+		if !githubChecksumValid(content[body:end]) {
+			return 0, false
+		}
+		return end, true
+	}
+	return 0, false
+}
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+func githubChecksumValid(body []byte) bool {
+	sum := crc32.ChecksumIEEE(body[:githubChecksumStart])
+	var encoded [githubTokenBodyLen - githubChecksumStart]byte
+	for i := len(encoded) - 1; i >= 0; i-- {
+		encoded[i] = base62Alphabet[sum%62]
+		sum /= 62
+	}
+	return bytes.Equal(encoded[:], body[githubChecksumStart:])
+}
+
+var slackTokenPrefixes = [...]string{"xoxb-", "xoxp-", "xoxa-", "xoxr-", "xoxs-", "xoxe-", "xapp-"}
+
+func matchSlackTokenAt(content []byte, start int) (end int, ok bool) {
+	if !alnumBoundaryBefore(content, start) {
+		return 0, false
+	}
+	for _, prefix := range slackTokenPrefixes {
+		if !hasPrefixAt(content, start, prefix) {
+			continue
+		}
+		body := start + len(prefix)
+		end = body
+		digits := false
+		for end < len(content) && (isAlnum(content[end]) || content[end] == '-') {
+			if isDigit(content[end]) {
+				digits = true
+			}
+			end++
+		}
+		for end > body && content[end-1] == '-' {
+			end--
+		}
+		if end-body < 20 || !digits {
+			return 0, false
+		}
+		return end, true
+	}
+	return 0, false
+}
+
+var stripeKeyPrefixes = [...]string{"sk_live_", "sk_test_", "rk_live_", "rk_test_"}
+
+// matchStripeKeyAt matches secret and restricted keys. Publishable pk_ keys
+// are meant to be public and are ignored.
+func matchStripeKeyAt(content []byte, start int) (end int, ok bool) {
+	if !alnumBoundaryBefore(content, start) {
+		return 0, false
+	}
+	for _, prefix := range stripeKeyPrefixes {
+		if !hasPrefixAt(content, start, prefix) {
+			continue
+		}
+		body := start + len(prefix)
+		end = body
+		for end < len(content) && isAlnum(content[end]) {
+			end++
+		}
+		if end-body < 24 {
+			return 0, false
+		}
+		return end, true
+	}
+	return 0, false
+}
+
+// matchGCPServiceAccountAt matches the "type": "service_account" marker of a
+// service-account key file. The embedded private key is reported separately
+// as pem_private_key.
+func matchGCPServiceAccountAt(content []byte, start int) (end int, ok bool) {
+	if !hasPrefixAt(content, start, `"type"`) {
+		return 0, false
+	}
+	pos := skipSpace(content, start+len(`"type"`))
+	if pos >= len(content) || content[pos] != ':' {
+		return 0, false
+	}
+	pos = skipSpace(content, pos+1)
+	if !hasPrefixAt(content, pos, `"service_account"`) {
+		return 0, false
+	}
+	return pos + len(`"service_account"`), true
+}
+
+const (
+	azureConnPrefix    = "DefaultEndpointsProtocol="
+	azureAccountKey    = "AccountKey="
+	azureConnMaxLen    = 512
+	azureAccountKeyMin = 40
+)
+
+// matchAzureConnectionStringAt matches a storage connection string from its
+// DefaultEndpointsProtocol= field to the last key=value pair. It only counts
+// when an AccountKey with a plausible base64 value is present.
+func matchAzureConnectionStringAt(content []byte, start int) (end int, ok bool) {
+	if !hasPrefixAt(content, start, azureConnPrefix) {
+		return 0, false
+	}
+	limit := start + azureConnMaxLen
+	if limit > len(content) {
+		limit = len(content)
+	}
+	end = start
+	for end < limit && !isSpaceTab(content[end]) && content[end] != '\n' && content[end] != '\r' &&
+		content[end] != '"' && content[end] != '\'' && content[end] != '<' {
+		end++
+	}
+	for end > start && content[end-1] == ';' {
+		end--
+	}
+	candidate := content[start:end]
+	idx := bytes.Index(candidate, []byte(azureAccountKey))
+	if idx < 0 {
+		return 0, false
+	}
+	keyStart := idx + len(azureAccountKey)
+	keyEnd := keyStart
+	for keyEnd < len(candidate) && isBase64Char(candidate[keyEnd]) {
+		keyEnd++
+	}
+	if keyEnd-keyStart < azureAccountKeyMin {
+		return 0, false
+	}
+	return end, true
+}
+
+// pemBodyProbe is how many base64 characters must follow a PEM header.
+const pemBodyProbe = 16
+
+var pemPrivateKeyLabels = [...]string{
+	"PRIVATE KEY",
+	"RSA PRIVATE KEY",
+	"EC PRIVATE KEY",
+	"DSA PRIVATE KEY",
+	"ENCRYPTED PRIVATE KEY",
+}
+
+// matchPEMPrivateKeyAt matches the BEGIN line of a PEM private key. Only the
+// header is reported so the key material never reaches the output, and the
+// match fits inside a streaming overlap window.
+func matchPEMPrivateKeyAt(content []byte, start int) (end int, ok bool) {
+	for _, label := range pemPrivateKeyLabels {
+		if end, ok = matchPEMHeaderAt(content, start, label); ok {
+			return end, true
+		}
+	}
+	return 0, false
+}
+
+func matchOpenSSHPrivateKeyAt(content []byte, start int) (end int, ok bool) {
+	return matchPEMHeaderAt(content, start, "OPENSSH PRIVATE KEY")
+}
+
+// matchPEMHeaderAt matches "-----BEGIN <label>-----" followed by a line break
+// (raw, or escaped as in JSON strings) and the start of a base64 body or an
+// encryption header.
+func matchPEMHeaderAt(content []byte, start int, label string) (end int, ok bool) {
+	pos := start
+	for _, part := range [...]string{"-----BEGIN ", label, "-----"} {
+		if !hasPrefixAt(content, pos, part) {
+			return 0, false
+		}
+		pos += len(part)
+	}
+	end = pos
+	breaks := 0
+	for pos < len(content) {
+		if content[pos] == '\r' || content[pos] == '\n' {
+			pos++
+		} else if hasPrefixAt(content, pos, `\n`) || hasPrefixAt(content, pos, `\r`) {
+			pos += 2
+		} else {
+			break
+		}
+		breaks++
+	}
+	if breaks == 0 {
+		return 0, false
+	}
+	if hasPrefixAt(content, pos, "Proc-Type:") {
+		return end, true
+	}
+	run := 0
+	for pos < len(content) && isBase64Char(content[pos]) && run < pemBodyProbe {
+		pos++
+		run++
+	}
+	if run < pemBodyProbe {
+		return 0, false
+	}
+	return end, true
+}
+
+// matchPuTTYPrivateKeyAt matches the first line of a PuTTY .ppk file.
+func matchPuTTYPrivateKeyAt(content []byte, start int) (end int, ok bool) {
+	const prefix = "PuTTY-User-Key-File-"
+	if !alnumBoundaryBefore(content, start) || !hasPrefixAt(content, start, prefix) {
+		return 0, false
+	}
+	pos := start + len(prefix)
+	if pos+2 >= len(content) || !isDigit(content[pos]) || content[pos+1] != ':' {
+		return 0, false
+	}
+	end = skipSpace(content, pos+2)
+	algStart := end
+	for end < len(content) && (isAlnum(content[end]) || content[end] == '-' || content[end] == '@' || content[end] == '.') {
+		end++
+	}
+	if end == algStart {
+		return 0, false
+	}
+	return end, true
+}
+
+const npmTokenBodyLen = 36
+
+func matchNPMTokenAt(content []byte, start int) (end int, ok bool) {
+	if !alnumBoundaryBefore(content, start) || !hasPrefixAt(content, start, "npm_") {
+		return 0, false
+	}
+	body := start + len("npm_")
+	end = body
+	for end < len(content) && isAlnum(content[end]) {
+		end++
+	}
+	if end-body != npmTokenBodyLen || (end < len(content) && content[end] == '_') {
+		return 0, false
+	}
+	return end, true
+}
+
+// PyPI API tokens are macaroons whose first caveat encodes the issuing index,
+// so the base64 prefix is fixed per index.
+var pypiTokenPrefixes = [...]string{
+	"pypi-AgEIcHlwaS5vcmc",
+	"pypi-AgENdGVzdC5weXBpLm9yZw",
+}
+
+func matchPyPITokenAt(content []byte, start int) (end int, ok bool) {
+	if !alnumBoundaryBefore(content, start) {
+		return 0, false
+	}
+	for _, prefix := range pypiTokenPrefixes {
+		if !hasPrefixAt(content, start, prefix) {
+			continue
+		}
+		body := start + len(prefix)
+		end = body
+		for end < len(content) && isWordLike(content[end]) {
+			end++
+		}
+		if end-body < 50 {
+			return 0, false
+		}
+		return end, true
+	}
+	return 0, false
+}
+
+func hasPrefixAt(content []byte, start int, prefix string) bool {
+	if start < 0 || start+len(prefix) > len(content) {
+		return false
+	}
+	return string(content[start:start+len(prefix)]) == prefix
+}
+
+func alnumBoundaryBefore(content []byte, start int) bool {
+	return start == 0 || !isAlnum(content[start-1])
+}
+
+func skipSpace(content []byte, pos int) int {
+	for pos < len(content) && (isSpaceTab(content[pos]) || content[pos] == '\n' || content[pos] == '\r') {
+		pos++
+	}
+	return pos
+}
+
+func isAlnum(ch byte) bool {
+	return isASCIILetter(ch) || isDigit(ch)
+}
+
+func isWordChar(ch byte) bool {
+	return isAlnum(ch) || ch == '_'
+}
+
+func isBase64Char(ch byte) bool {
+	return isAlnum(ch) || ch == '+' || ch == '/' || ch == '='
+}
@@ -1,6 +1,27 @@
 package scanner
 
-import "safnari/config"
+import (
+	"safnari/config"
+	"safnari/scanner/sensitive"
+)
+
+// sensitiveOptions are the detector settings of the scan cfg describes.
+func sensitiveOptions(cfg *config.Config) sensitive.Options {
+	if cfg == nil {
+		return sensitive.Options{}
+	}
+	return sensitive.Options{
+		Entropy: sensitive.EntropyOptions{
+			MinLength:       cfg.SensitiveEntropyMinLen,
+			Base64Threshold: cfg.SensitiveEntropyBits,
+			HexThreshold:    cfg.SensitiveEntropyHexBits,
+		},
+		Confidence: sensitive.ConfidenceOptions{
+			MinConfidence:    cfg.SensitiveMinConfidence,
+			KeywordProximity: cfg.SensitiveProximity,
+		},
+	}
+}
 
 func sensitiveMatchMode(cfg *config.Config) string {
 	if cfg == nil || cfg.SensitiveMatchMode == "" {
@@ -36,6 +36,7 @@ func scanSensitiveDataDeterministicStream(
 	path string,
 	patterns map[string]*regexp.Regexp,
 	patternNames []string,
+	opts sensitive.Options,
 	maxPerType int,
 	maxTotal int,
 	streamChunkSize int,
@@ -85,7 +86,7 @@ func scanSensitiveDataDeterministicStream(
 			}
 
 			windowStart := consumed - int64(len(carry))
-			chunkMatches := sensitive.ScanDeterministicMatches(window, patternNames, 0, 0)
+			chunkMatches := sensitive.ScanDeterministicMatches(window, patternNames, opts, 0, 0)
 			carryLimit := len(carry)
 			for _, m := range chunkMatches {
 				if totalLimited && totalCount >= maxTotal {
@@ -4,6 +4,8 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"safnari/scanner/sensitive"
 )
 
 func TestScanSensitiveDataDeterministicStreamBoundaryParity(t *testing.T) {
@@ -35,6 +37,7 @@ func TestScanSensitiveDataDeterministicStreamBoundaryParity(t *testing.T) {
 		tmp.Name(),
 		patterns,
 		patternNames,
+		sensitive.Options{},
 		100,
 		1000,
 		64,
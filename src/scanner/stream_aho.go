@@ -13,6 +13,10 @@ type streamAhoMatcher struct {
 	state     int
 	lastEnd   []int64
 	processed int64
+	// overlapping reports every occurrence of a pattern. Otherwise an
+	// occurrence that overlaps the previous one of the same pattern is
+	// skipped, as search terms are counted.
+	overlapping bool
 }
 
 type streamAhoCounter struct {
@@ -21,7 +25,13 @@ type streamAhoCounter struct {
 }
 
 func newStreamAhoMatcher(terms []string) *streamAhoMatcher {
-	normalized := normalizeSearchTerms(terms)
+	return newStreamAhoPatternMatcher(normalizeSearchTerms(terms))
+}
+
+// newStreamAhoPatternMatcher builds a matcher over patterns exactly as given,
+// so binary atoms keep their leading and trailing bytes. Pattern indexes in
+// emitted matches follow the input order.
+func newStreamAhoPatternMatcher(normalized []string) *streamAhoMatcher {
 	if len(normalized) == 0 {
 		return &streamAhoMatcher{}
 	}
@@ -48,6 +58,16 @@ func newStreamAhoCounter(terms []string) *streamAhoCounter {
 	}
 }
 
+// fork returns a matcher that shares m's automaton but starts with fresh
+// stream state, so one compiled matcher can serve concurrent files.
+func (m *streamAhoMatcher) fork() *streamAhoMatcher {
+	clone := *m
+	clone.state = 0
+	clone.processed = 0
+	clone.lastEnd = make([]int64, len(m.terms))
+	return &clone
+}
+
 func (m *streamAhoMatcher) addPattern(index int, pattern []byte) {
 	node := 0
 	for _, b := range pattern {
@@ -110,10 +130,12 @@ func (m *streamAhoMatcher) Consume(chunk []byte, emit func(index int, start, end
 		end := m.processed + int64(i) + 1
 		for _, matchIndex := range m.nodes[m.state].out {
 			start := end - int64(len(m.patterns[matchIndex]))
-			if start < m.lastEnd[matchIndex] {
-				continue
+			if !m.overlapping {
+				if start < m.lastEnd[matchIndex] {
+					continue
+				}
+				m.lastEnd[matchIndex] = end
 			}
-			m.lastEnd[matchIndex] = end
 			if emit != nil {
 				emit(matchIndex, start, end)
 			}
@@ -131,6 +153,18 @@ func (c *streamAhoCounter) Consume(chunk []byte) {
 	})
 }
 
+// ConsumeEach counts like Consume and also reports the term and absolute
+// span of every hit.
+func (c *streamAhoCounter) ConsumeEach(chunk []byte, each func(term string, start, end int64)) {
+	if c == nil || c.matcher == nil || len(c.matcher.terms) == 0 {
+		return
+	}
+	c.matcher.Consume(chunk, func(index int, start, end int64) {
+		c.counts[index]++
+		each(c.matcher.terms[index], start, end)
+	})
+}
+
 func (c *streamAhoCounter) Results() map[string]int {
 	if c == nil || c.matcher == nil || len(c.matcher.terms) == 0 {
 		return nil
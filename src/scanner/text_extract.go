@@ -0,0 +1,53 @@
+package scanner
+
+import (
+	"fmt"
+
+	"safnari/metadata"
+)
+
+// ExtractsText reports whether content search and sensitive scans should read
+// the plain text extracted from a document rather than its raw bytes.
+func (fc *FileContext) ExtractsText() bool {
+	if fc == nil || fc.Cfg == nil || !fc.Cfg.ExtractText {
+		return false
+	}
+	if len(fc.Cfg.SearchTerms) == 0 && !(fc.Cfg.ScanSensitive && len(fc.SensitivePatterns) > 0) {
+		return false
+	}
+	return metadata.TextExtractionSupported(fc.MimeType())
+}
+
+// scanExtractedText runs the text consumers over the document's extracted
+// text. The extracted size is tracked apart from ContentScanBytes, which
+// always describes raw file bytes.
+func (fc *FileContext) scanExtractedText(source *ChunkSource, limit int64, consumers []ChunkConsumer) error {
+	if len(consumers) == 0 {
+		return nil
+	}
+	if !fc.FullFileProcessingAllowed() {
+		fc.NoteFullFileProcessingSkipped()
+		return nil
+	}
+	text, truncated, err := metadata.ExtractText(source.reader, source.Size(), fc.MimeType(), limit)
+	if err != nil {
+		fc.addWarning(fmt.Sprintf("text extraction failed: %v", err))
+		return nil
+	}
+	fc.extractedTextBytes = int64(len(text))
+	if truncated {
+		fc.contentScanTruncated = true
+		fc.addWarning(fmt.Sprintf("extracted text truncated at %d bytes", limit))
+	}
+
+	textSource, err := newMemoryChunkSource(fc.Path, fc.Info, fc.Cfg, text)
+	if err != nil {
+		return err
+	}
+	defer textSource.Close()
+	pipeline := &ScanPipeline{
+		source:    textSource,
+		consumers: consumers,
+	}
+	return pipeline.Run()
+}
@@ -0,0 +1,82 @@
+package scanner
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"safnari/config"
+)
+
+func writeDOCX(t *testing.T, path, body string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	parts := [][2]string{
+		{"[Content_Types].xml", `<?xml version="1.0"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`},
+		{"_rels/.rels", `<?xml version="1.0"?><Relationships/>`},
+		{"word/document.xml", `<w:document><w:body><w:p><w:r><w:t>` + body + `</w:t></w:r></w:p></w:body></w:document>`},
+	}
+	for _, part := range parts {
+		w, err := zw.Create(part[0])
+		if err != nil {
+			t.Fatalf("zip create %s: %v", part[0], err)
+		}
+		if _, err := w.Write([]byte(part[1])); err != nil {
+			t.Fatalf("zip write %s: %v", part[0], err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("write docx: %v", err)
+	}
+}
+
+func TestCollectFileDataExtractsDocumentText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.docx")
+	body := "Employee SSN 123-45-6789 on file"
+	writeDOCX(t, path, body)
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+
+	cfg := &config.Config{
+		ScanFiles:     true,
+		ScanSensitive: true,
+		ExtractText:   true,
+		SearchTerms:   []string{"Employee"},
+		MaxFileSize:   1 << 20,
+	}
+	patterns := GetPatterns([]string{"ssn"}, nil, nil)
+	data, err := collectFileData(context.Background(), path, fi, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if got := data.SensitiveData["ssn"]; len(got) != 1 || got[0] != "123-45-6789" {
+		t.Fatalf("expected ssn from extracted text, got %v (mime %s)", data.SensitiveData, data.MimeType)
+	}
+	if data.SearchHits["Employee"] != 1 {
+		t.Fatalf("expected search hit from extracted text, got %v", data.SearchHits)
+	}
+	if data.ExtractedTextBytes < int64(len(body)) {
+		t.Fatalf("expected extracted text bytes to be recorded, got %d", data.ExtractedTextBytes)
+	}
+	if data.ContentScanBytes != 0 {
+		t.Fatalf("raw content scan bytes should not count extracted text, got %d", data.ContentScanBytes)
+	}
+
+	cfg.ExtractText = false
+	data, err = collectFileData(context.Background(), path, fi, cfg, patterns, testFileModules(t, cfg, patterns), nil)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if data.ExtractedTextBytes != 0 {
+		t.Fatalf("expected no extraction when disabled, got %d bytes", data.ExtractedTextBytes)
+	}
+}
@@ -0,0 +1,317 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"safnari/config"
+	"safnari/logger"
+	"safnari/output"
+	"safnari/utils"
+)
+
+// watchOp is the kind of change a watch backend reports.
+type watchOp int
+
+const (
+	// watchChanged covers files created, written, chmodded or moved in.
+	watchChanged watchOp = iota
+	// watchDeleted covers paths removed or moved out of the watched roots.
+	watchDeleted
+	// watchRenamed is a move within the watched roots.
+	watchRenamed
+	// watchRescan asks for every file below path to be scanned again,
+	// after the backend lost events.
+	watchRescan
+)
+
+type watchEvent struct {
+	op      watchOp
+	path    string
+	oldPath string
+	dir     bool
+}
+
+// fsWatcher delivers changes under the watched roots until it is closed,
+// then closes its event channel.
+type fsWatcher interface {
+	Name() string
+	Events() <-chan watchEvent
+	Close() error
+}
+
+// WatchFiles scans cfg.StartPaths and then keeps watching them until ctx
+// ends. Files created or changed get a fresh file record, and removals and
+// renames are written as file_deleted and file_renamed records. The watch
+// starts before the initial scan so changes made during it are not missed.
+func WatchFiles(ctx context.Context, cfg *config.Config, metrics *output.Metrics, w *output.Writer) error {
+	if cfg.AllDrives {
+		drives, err := utils.GetLocalDrives()
+		if err != nil {
+			return err
+		}
+		cfg.StartPaths = drives
+		cfg.AllDrives = false
+	}
+	watcher, err := newFSWatcher(cfg)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := ScanFiles(ctx, cfg, metrics, w); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	logger.Infof("Watching %s for changes with %s", strings.Join(cfg.StartPaths, ", "), watcher.Name())
+	return watchChanges(ctx, cfg, w, watcher)
+}
+
+// watchChanges feeds debounced changes from watcher through the scheduler
+// and workers used by a full scan.
+func watchChanges(ctx context.Context, cfg *config.Config, w *output.Writer, watcher fsWatcher) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	matcher := utils.NewPatternMatcher(cfg.IncludePatterns, cfg.ExcludePatterns)
+	artifactFilter := newInternalArtifactFilter(cfg)
+	sensitivePatterns := GetPatterns(cfg.IncludeDataTypes, cfg.CustomPatterns, cfg.ExcludeDataTypes)
+	fileModules, err := buildFileModules(cfg, sensitivePatterns)
+	if err != nil {
+		return err
+	}
+	deltaCache, err := OpenDeltaChunkCache(cfg)
+	if err != nil {
+		return err
+	}
+	if deltaCache != nil {
+		defer deltaCache.Close()
+	}
+
+	concurrency := maxInt(cfg.ConcurrencyLevel, 1)
+	filesChan := make(chan fileScanTask, concurrency)
+	scheduler := newSizeLaneScheduler(maxInt(concurrency*8, 64))
+	go scheduler.Run(ctx, filesChan)
+
+	var firstErr error
+	var firstErrOnce sync.Once
+	setWatchError := func(err error) {
+		if err == nil || errors.Is(err, context.Canceled) {
+			return
+		}
+		firstErrOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range filesChan {
+				if err := processFile(ctx, task.path, task.info, cfg, w, sensitivePatterns, fileModules, deltaCache, true); err != nil {
+					setWatchError(err)
+					return
+				}
+			}
+		}()
+	}
+
+	wanted := func(path string) bool {
+		return !artifactFilter.ShouldSkip(path) && matcher.ShouldInclude(path)
+	}
+	enqueue := func(path string) error {
+		if !wanted(path) {
+			return nil
+		}
+		info, err := os.Lstat(path)
+		if err != nil || info.IsDir() {
+			// Gone again before the debounce ran out; its removal follows.
+			return nil
+		}
+		return scheduler.Enqueue(ctx, fileScanTask{path: path, info: info}, cfg)
+	}
+	rescan := func(root string) error {
+		logger.Infof("Rescanning %s for changes missed by the watch", root)
+		return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				logger.Debugf("Failed to walk %s: %v", path, err)
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			return enqueue(path)
+		})
+	}
+	handle := func(ev watchEvent) error {
+		now := time.Now().Format(time.RFC3339)
+		switch ev.op {
+		case watchRescan:
+			return rescan(ev.path)
+		case watchDeleted:
+			if !wanted(ev.path) {
+				return nil
+			}
+			return w.WriteEvent(RecordFileDeleted, FileDeleted{Path: ev.path, IsDir: ev.dir, Time: now})
+		case watchRenamed:
+			if !wanted(ev.path) && !wanted(ev.oldPath) {
+				return nil
+			}
+			if err := w.WriteEvent(RecordFileRenamed, FileRenamed{Path: ev.path, OldPath: ev.oldPath, IsDir: ev.dir, Time: now}); err != nil {
+				return err
+			}
+			if ev.dir {
+				return nil
+			}
+		}
+		return enqueue(ev.path)
+	}
+
+	pending := newWatchDebouncer(cfg.WatchDebounce)
+	tick := maxDuration(cfg.WatchDebounce/2, 10*time.Millisecond)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	events := watcher.Events()
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case ev, ok := <-events:
+			if !ok {
+				break loop
+			}
+			pending.add(ev, time.Now())
+		case now := <-ticker.C:
+			for _, ev := range pending.ready(now) {
+				if err := handle(ev); err != nil {
+					setWatchError(err)
+					break
+				}
+			}
+		}
+	}
+	scheduler.Close()
+	wg.Wait()
+	if err := w.WaitIdle(); err != nil && firstErr == nil {
+		return err
+	}
+	return firstErr
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// watchDebouncer coalesces events per path and releases them once the path
+// has been quiet for the debounce interval, so a file written in several
+// chunks is scanned once.
+type watchDebouncer struct {
+	quiet   time.Duration
+	pending map[string]*pendingWatchEvent
+}
+
+type pendingWatchEvent struct {
+	ev   watchEvent
+	last time.Time
+}
+
+func newWatchDebouncer(quiet time.Duration) *watchDebouncer {
+	return &watchDebouncer{quiet: quiet, pending: make(map[string]*pendingWatchEvent)}
+}
+
+func (d *watchDebouncer) add(ev watchEvent, now time.Time) {
+	switch ev.op {
+	case watchRenamed:
+		if p, ok := d.pending[ev.oldPath]; ok {
+			delete(d.pending, ev.oldPath)
+			switch p.ev.op {
+			case watchRenamed:
+				// a -> b -> c is reported as a -> c.
+				ev.oldPath = p.ev.oldPath
+			case watchChanged:
+				// A file created and moved before it was reported is
+				// just a new file under its final name.
+				ev = watchEvent{op: watchChanged, path: ev.path, dir: ev.dir}
+			}
+		}
+		if ev.dir {
+			d.moveUnder(ev.oldPath, ev.path)
+		}
+	case watchDeleted:
+		if p, ok := d.pending[ev.path]; ok && p.ev.op == watchRenamed {
+			// The file was renamed and then removed: what disappeared is
+			// the original.
+			delete(d.pending, ev.path)
+			ev.path = p.ev.oldPath
+		}
+	case watchChanged:
+		if p, ok := d.pending[ev.path]; ok && p.ev.op == watchRenamed {
+			// Rescanning the new name is part of reporting the rename.
+			p.last = now
+			return
+		}
+	}
+	d.pending[ev.path] = &pendingWatchEvent{ev: ev, last: now}
+}
+
+// moveUnder rewrites pending paths below a renamed directory.
+func (d *watchDebouncer) moveUnder(oldDir, newDir string) {
+	prefix := oldDir + string(filepath.Separator)
+	for path, p := range d.pending {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		delete(d.pending, path)
+		p.ev.path = filepath.Join(newDir, strings.TrimPrefix(path, prefix))
+		d.pending[p.ev.path] = p
+	}
+}
+
+// ready removes and returns the events quiet since before now-quiet, oldest
+// first.
+func (d *watchDebouncer) ready(now time.Time) []watchEvent {
+	var due []*pendingWatchEvent
+	for path, p := range d.pending {
+		if now.Sub(p.last) >= d.quiet {
+			due = append(due, p)
+			delete(d.pending, path)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].last.Before(due[j].last) })
+	events := make([]watchEvent, len(due))
+	for i, p := range due {
+		events[i] = p.ev
+	}
+	return events
+}
+
+// walkWatchedFiles reports every file below dir as changed; used for
+// directories that appear in the watched roots with contents already in
+// them.
+func walkWatchedFiles(dir string, emit func(watchEvent)) {
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			logger.Debugf("Failed to walk %s: %v", path, err)
+			return nil
+		}
+		if !d.IsDir() {
+			emit(watchEvent{op: watchChanged, path: path})
+		}
+		return nil
+	})
+}
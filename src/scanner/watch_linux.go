@@ -0,0 +1,528 @@
+//go:build linux
+// +build linux
+
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"safnari/config"
+	"safnari/logger"
+)
+
+// newFSWatcher opens the backend cfg.WatchBackend names. "auto" prefers
+// fanotify, which needs CAP_SYS_ADMIN, and falls back to inotify.
+func newFSWatcher(cfg *config.Config) (fsWatcher, error) {
+	switch cfg.WatchBackend {
+	case "inotify":
+		return newInotifyWatcher(cfg.StartPaths)
+	case "fanotify":
+		return newFanotifyWatcher(cfg.StartPaths)
+	}
+	w, err := newFanotifyWatcher(cfg.StartPaths)
+	if err == nil {
+		return w, nil
+	}
+	logger.Debugf("fanotify unavailable, using inotify: %v", err)
+	return newInotifyWatcher(cfg.StartPaths)
+}
+
+const watchReadBuffer = 64 * 1024
+
+// watchMoveWindow is how long a MOVED_FROM waits for its MOVED_TO, which
+// can arrive in a later read, before it counts as a move out of the roots.
+const watchMoveWindow = 250 * time.Millisecond
+
+// watchPipe is the event channel both backends share. send gives up once
+// the watcher is closed so the reader never blocks on a consumer that left.
+type watchPipe struct {
+	events chan watchEvent
+	done   chan struct{}
+}
+
+func newWatchPipe() watchPipe {
+	return watchPipe{events: make(chan watchEvent, 256), done: make(chan struct{})}
+}
+
+func (p watchPipe) Events() <-chan watchEvent { return p.events }
+
+func (p watchPipe) send(ev watchEvent) {
+	select {
+	case p.events <- ev:
+	case <-p.done:
+	}
+}
+
+// readEvents reads f until it is closed, handing each read to handle. With
+// idle set, reads time out after idleAfter so idle runs while no events
+// arrive.
+func (p watchPipe) readEvents(f *os.File, name string, handle func([]byte), idle func(), idleAfter time.Duration) {
+	defer close(p.events)
+	buf := make([]byte, watchReadBuffer)
+	for {
+		if idle != nil {
+			_ = f.SetReadDeadline(time.Now().Add(idleAfter))
+		}
+		n, err := f.Read(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			idle()
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				logger.Warnf("Failed to read %s events: %v", name, err)
+			}
+			return
+		}
+		handle(buf[:n])
+	}
+}
+
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_ATTRIB | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+// inotifyWatcher watches every directory below the roots. Directories that
+// appear later are added as their events arrive.
+type inotifyWatcher struct {
+	watchPipe
+	file  *os.File
+	conn  syscall.RawConn
+	roots []string
+	// dirs and wds map watch descriptors to directories and back, and
+	// movedFrom holds the moves still waiting for their MOVED_TO; only the
+	// reader goroutine touches them once it runs.
+	dirs      map[int]string
+	wds       map[string]int
+	movedFrom map[uint32]pendingMove
+	cookies   []uint32
+}
+
+// pendingMove is a MOVED_FROM event and when it was read.
+type pendingMove struct {
+	ev watchEvent
+	at time.Time
+}
+
+func newInotifyWatcher(roots []string) (*inotifyWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify: %w", err)
+	}
+	file := os.NewFile(uintptr(fd), "inotify")
+	conn, err := file.SyscallConn()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	w := &inotifyWatcher{
+		watchPipe: newWatchPipe(),
+		file:      file,
+		conn:      conn,
+		roots:     roots,
+		dirs:      make(map[int]string),
+		wds:       make(map[string]int),
+		movedFrom: make(map[uint32]pendingMove),
+	}
+	for _, root := range roots {
+		if err := w.addTree(root, nil); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+	go w.readEvents(file, "inotify", w.handle, w.expireMoves, watchMoveWindow)
+	return w, nil
+}
+
+func (w *inotifyWatcher) Name() string { return "inotify" }
+
+func (w *inotifyWatcher) Close() error {
+	close(w.done)
+	return w.file.Close()
+}
+
+// addTree watches root and the directories below it. With emit set the
+// files found are reported as changed, for directories created or moved in
+// while watching.
+func (w *inotifyWatcher) addTree(root string, emit func(watchEvent)) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			logger.Warnf("Failed to access %s: %v", path, err)
+			return nil
+		}
+		if !d.IsDir() {
+			if emit != nil {
+				emit(watchEvent{op: watchChanged, path: path})
+			}
+			return nil
+		}
+		var wd int
+		var addErr error
+		if err := w.conn.Control(func(fd uintptr) {
+			wd, addErr = unix.InotifyAddWatch(int(fd), path, inotifyMask)
+		}); err != nil {
+			return err
+		}
+		if addErr != nil {
+			if errors.Is(addErr, unix.ENOSPC) {
+				return fmt.Errorf("inotify watch limit reached at %s; raise fs.inotify.max_user_watches: %w", path, addErr)
+			}
+			logger.Warnf("Failed to watch %s: %v", path, addErr)
+			return filepath.SkipDir
+		}
+		w.dirs[wd] = path
+		w.wds[path] = wd
+		return nil
+	})
+}
+
+// forgetTree drops the watches below a directory moved out of the roots.
+func (w *inotifyWatcher) forgetTree(dir string) {
+	for path, wd := range w.wds {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			_ = w.conn.Control(func(fd uintptr) {
+				_, _ = unix.InotifyRmWatch(int(fd), uint32(wd))
+			})
+			delete(w.wds, path)
+			delete(w.dirs, wd)
+		}
+	}
+}
+
+// moveTree updates the watched paths below a renamed directory.
+func (w *inotifyWatcher) moveTree(oldDir, newDir string) {
+	prefix := oldDir + string(filepath.Separator)
+	for path, wd := range w.wds {
+		if path != oldDir && !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		moved := newDir + strings.TrimPrefix(path, oldDir)
+		delete(w.wds, path)
+		w.wds[moved] = wd
+		w.dirs[wd] = moved
+	}
+}
+
+func (w *inotifyWatcher) handle(buf []byte) {
+	now := time.Now()
+	for off := 0; off+unix.SizeofInotifyEvent <= len(buf); {
+		wd := int(int32(binary.NativeEndian.Uint32(buf[off:])))
+		mask := binary.NativeEndian.Uint32(buf[off+4:])
+		cookie := binary.NativeEndian.Uint32(buf[off+8:])
+		nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+		off += unix.SizeofInotifyEvent
+		if off+nameLen > len(buf) {
+			break
+		}
+		name := string(bytes.TrimRight(buf[off:off+nameLen], "\x00"))
+		off += nameLen
+
+		if mask&unix.IN_Q_OVERFLOW != 0 {
+			w.rescan()
+			continue
+		}
+		dir, ok := w.dirs[wd]
+		if !ok {
+			continue
+		}
+		if mask&unix.IN_IGNORED != 0 {
+			delete(w.dirs, wd)
+			if w.wds[dir] == wd {
+				delete(w.wds, dir)
+			}
+			continue
+		}
+		path := filepath.Join(dir, name)
+		isDir := mask&unix.IN_ISDIR != 0
+		switch {
+		case mask&unix.IN_MOVED_FROM != 0:
+			w.movedFrom[cookie] = pendingMove{ev: watchEvent{op: watchDeleted, path: path, dir: isDir}, at: now}
+			w.cookies = append(w.cookies, cookie)
+		case mask&unix.IN_MOVED_TO != 0:
+			if move, ok := w.movedFrom[cookie]; ok {
+				from := move.ev
+				delete(w.movedFrom, cookie)
+				if isDir {
+					w.moveTree(from.path, path)
+				}
+				w.send(watchEvent{op: watchRenamed, path: path, oldPath: from.path, dir: isDir})
+			} else if isDir {
+				w.addNewTree(path)
+			} else {
+				w.send(watchEvent{op: watchChanged, path: path})
+			}
+		case mask&unix.IN_CREATE != 0 && isDir:
+			// Files may land in it before the watch is in place.
+			w.addNewTree(path)
+		case mask&unix.IN_DELETE != 0:
+			w.send(watchEvent{op: watchDeleted, path: path, dir: isDir})
+		case !isDir:
+			w.send(watchEvent{op: watchChanged, path: path})
+		}
+	}
+	w.expireMoves()
+}
+
+// expireMoves reports the moves whose MOVED_TO has not arrived within
+// watchMoveWindow as moves out of the roots. A move within the roots is a
+// MOVED_FROM and MOVED_TO pair sharing a cookie, which a read can split.
+func (w *inotifyWatcher) expireMoves() {
+	now := time.Now()
+	for len(w.cookies) > 0 {
+		move, ok := w.movedFrom[w.cookies[0]]
+		if ok && now.Sub(move.at) < watchMoveWindow {
+			return
+		}
+		if ok {
+			delete(w.movedFrom, w.cookies[0])
+			if move.ev.dir {
+				w.forgetTree(move.ev.path)
+			}
+			w.send(move.ev)
+		}
+		w.cookies = w.cookies[1:]
+	}
+}
+
+// rescan recovers from a queue overflow. Pending moves can no longer be
+// paired, directories created meanwhile may be unwatched, and any file may
+// have changed, so every root is watched again and scanned.
+func (w *inotifyWatcher) rescan() {
+	logger.Warnf("inotify event queue overflowed; rescanning the watched roots")
+	for _, move := range w.movedFrom {
+		if move.ev.dir {
+			w.forgetTree(move.ev.path)
+		}
+		w.send(move.ev)
+	}
+	clear(w.movedFrom)
+	w.cookies = nil
+	for _, root := range w.roots {
+		if err := w.addTree(root, nil); err != nil {
+			logger.Warnf("Failed to watch %s: %v", root, err)
+		}
+		w.send(watchEvent{op: watchRescan, path: root, dir: true})
+	}
+}
+
+func (w *inotifyWatcher) addNewTree(dir string) {
+	if err := w.addTree(dir, w.send); err != nil {
+		logger.Warnf("Failed to watch %s: %v", dir, err)
+	}
+}
+
+const fanotifyMask = unix.FAN_CLOSE_WRITE | unix.FAN_CREATE | unix.FAN_ATTRIB | unix.FAN_DELETE | unix.FAN_ONDIR
+
+// fanotifyWatcher marks the filesystems holding the roots, so one mark
+// covers every directory however deep, and reports only the events inside
+// the roots.
+type fanotifyWatcher struct {
+	watchPipe
+	file *os.File
+	// mounts holds a directory descriptor per marked filesystem for
+	// resolving the file handles events carry.
+	mounts map[unix.Fsid]int
+	roots  []fanotifyRoot
+}
+
+// fanotifyRoot pairs a start path with its resolved location, since events
+// resolve to paths without symlinks.
+type fanotifyRoot struct {
+	path, real string
+}
+
+func newFanotifyWatcher(roots []string) (*fanotifyWatcher, error) {
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK|unix.FAN_REPORT_DFID_NAME, unix.O_RDONLY|unix.O_CLOEXEC|unix.O_LARGEFILE)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify: %w", err)
+	}
+	w := &fanotifyWatcher{
+		watchPipe: newWatchPipe(),
+		file:      os.NewFile(uintptr(fd), "fanotify"),
+		mounts:    make(map[unix.Fsid]int),
+	}
+	for _, root := range roots {
+		if err := w.mark(fd, root); err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+	}
+	go w.readEvents(w.file, "fanotify", w.handle, nil, 0)
+	return w, nil
+}
+
+func (w *fanotifyWatcher) mark(fd int, root string) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return err
+	}
+	w.roots = append(w.roots, fanotifyRoot{path: filepath.Clean(root), real: real})
+	var st unix.Statfs_t
+	if err := unix.Statfs(real, &st); err != nil {
+		return err
+	}
+	if _, ok := w.mounts[st.Fsid]; ok {
+		return nil
+	}
+	// A move reported as one FAN_RENAME event carries both names.
+	if err := unix.FanotifyMark(fd, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, fanotifyMask|unix.FAN_RENAME, unix.AT_FDCWD, real); err != nil {
+		return fmt.Errorf("fanotify mark %s: %w", real, err)
+	}
+	mountFd, err := unix.Open(real, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	w.mounts[st.Fsid] = mountFd
+	return nil
+}
+
+func (w *fanotifyWatcher) Name() string { return "fanotify" }
+
+func (w *fanotifyWatcher) Close() error {
+	close(w.done)
+	for _, fd := range w.mounts {
+		_ = unix.Close(fd)
+	}
+	return w.file.Close()
+}
+
+const (
+	fanotifyMetadataLen = 24
+	fanotifyInfoHeader  = 4
+)
+
+func (w *fanotifyWatcher) handle(buf []byte) {
+	for len(buf) >= fanotifyMetadataLen {
+		eventLen := int(binary.NativeEndian.Uint32(buf))
+		metaLen := int(binary.NativeEndian.Uint16(buf[6:]))
+		mask := binary.NativeEndian.Uint64(buf[8:])
+		if eventLen < fanotifyMetadataLen || eventLen > len(buf) {
+			return
+		}
+		event := buf[metaLen:eventLen]
+		buf = buf[eventLen:]
+		if mask&unix.FAN_Q_OVERFLOW != 0 {
+			logger.Warnf("fanotify event queue overflowed; rescanning the watched roots")
+			for _, root := range w.roots {
+				w.send(watchEvent{op: watchRescan, path: root.path, dir: true})
+			}
+			continue
+		}
+
+		var path, oldPath, newPath string
+		for len(event) >= fanotifyInfoHeader {
+			infoType := event[0]
+			infoLen := int(binary.NativeEndian.Uint16(event[2:]))
+			if infoLen < fanotifyInfoHeader || infoLen > len(event) {
+				break
+			}
+			info := event[fanotifyInfoHeader:infoLen]
+			event = event[infoLen:]
+			switch infoType {
+			case unix.FAN_EVENT_INFO_TYPE_DFID_NAME:
+				path = w.resolve(info)
+			case unix.FAN_EVENT_INFO_TYPE_OLD_DFID_NAME:
+				oldPath = w.resolve(info)
+			case unix.FAN_EVENT_INFO_TYPE_NEW_DFID_NAME:
+				newPath = w.resolve(info)
+			}
+		}
+		w.dispatch(mask, path, oldPath, newPath)
+	}
+}
+
+func (w *fanotifyWatcher) dispatch(mask uint64, path, oldPath, newPath string) {
+	isDir := mask&unix.FAN_ONDIR != 0
+	if mask&unix.FAN_RENAME != 0 {
+		switch {
+		case oldPath != "" && newPath != "":
+			w.send(watchEvent{op: watchRenamed, path: newPath, oldPath: oldPath, dir: isDir})
+		case oldPath != "":
+			w.send(watchEvent{op: watchDeleted, path: oldPath, dir: isDir})
+		case newPath != "" && isDir:
+			walkWatchedFiles(newPath, w.send)
+		case newPath != "":
+			w.send(watchEvent{op: watchChanged, path: newPath})
+		}
+		return
+	}
+	if path == "" {
+		return
+	}
+	// Events for one name can arrive merged, such as a file created and
+	// removed again, so what is on disk now decides.
+	info, err := os.Lstat(path)
+	switch {
+	case err != nil:
+		if mask&unix.FAN_DELETE != 0 {
+			w.send(watchEvent{op: watchDeleted, path: path, dir: isDir})
+		}
+	case !info.IsDir():
+		w.send(watchEvent{op: watchChanged, path: path})
+	}
+}
+
+// resolve turns a directory file handle and entry name into a path under
+// the roots, or "" for anything outside them.
+func (w *fanotifyWatcher) resolve(info []byte) string {
+	// fsid, then struct file_handle (size, type, bytes), then the name.
+	if len(info) < 16 {
+		return ""
+	}
+	fsid := unix.Fsid{Val: [2]int32{int32(binary.NativeEndian.Uint32(info)), int32(binary.NativeEndian.Uint32(info[4:]))}}
+	size := int(binary.NativeEndian.Uint32(info[8:]))
+	handleType := int32(binary.NativeEndian.Uint32(info[12:]))
+	if 16+size > len(info) {
+		return ""
+	}
+	handle := info[16 : 16+size]
+	name := info[16+size:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	mountFd, ok := w.mounts[fsid]
+	if !ok {
+		return ""
+	}
+	dirFd, err := unix.OpenByHandleAt(mountFd, unix.NewFileHandle(handleType, handle), unix.O_PATH|unix.O_CLOEXEC)
+	if err != nil {
+		return ""
+	}
+	dir, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(dirFd))
+	_ = unix.Close(dirFd)
+	if err != nil {
+		return ""
+	}
+	path := dir
+	if len(name) > 0 && string(name) != "." {
+		path = filepath.Join(dir, string(name))
+	}
+	for _, root := range w.roots {
+		if path == root.real {
+			return root.path
+		}
+		prefix := root.real
+		if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+			prefix += string(filepath.Separator)
+		}
+		if rel, ok := strings.CutPrefix(path, prefix); ok {
+			return filepath.Join(root.path, rel)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package scanner
+
+import (
+	"errors"
+
+	"safnari/config"
+)
+
+func newFSWatcher(cfg *config.Config) (fsWatcher, error) {
+	return nil, errors.New("watch mode is only supported on Linux")
+}
@@ -0,0 +1,46 @@
+package scanner
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchDebouncerCoalescesEvents(t *testing.T) {
+	start := time.Now()
+	d := newWatchDebouncer(100 * time.Millisecond)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	dir := filepath.Join("root", "dir")
+
+	d.add(watchEvent{op: watchChanged, path: "root/a"}, at(0))
+	d.add(watchEvent{op: watchChanged, path: "root/a"}, at(50))
+	d.add(watchEvent{op: watchRenamed, path: "root/c", oldPath: "root/b"}, at(10))
+	d.add(watchEvent{op: watchRenamed, path: "root/d", oldPath: "root/c"}, at(20))
+	d.add(watchEvent{op: watchChanged, path: "root/new"}, at(20))
+	d.add(watchEvent{op: watchRenamed, path: "root/moved", oldPath: "root/new"}, at(30))
+	d.add(watchEvent{op: watchChanged, path: filepath.Join(dir, "f")}, at(35))
+	d.add(watchEvent{op: watchRenamed, path: "root/other", oldPath: dir, dir: true}, at(40))
+
+	if got := d.ready(at(100)); len(got) != 0 {
+		t.Fatalf("expected nothing before the debounce, got %+v", got)
+	}
+	want := []watchEvent{
+		{op: watchRenamed, path: "root/d", oldPath: "root/b"},
+		{op: watchChanged, path: "root/moved"},
+		{op: watchChanged, path: filepath.Join("root", "other", "f")},
+		{op: watchRenamed, path: "root/other", oldPath: dir, dir: true},
+	}
+	if got := d.ready(at(140)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ready = %+v, want %+v", got, want)
+	}
+	if got := d.ready(at(150)); !reflect.DeepEqual(got, []watchEvent{{op: watchChanged, path: "root/a"}}) {
+		t.Fatalf("expected the rewritten file last, got %+v", got)
+	}
+
+	d.add(watchEvent{op: watchRenamed, path: "root/y", oldPath: "root/x"}, at(200))
+	d.add(watchEvent{op: watchDeleted, path: "root/y"}, at(210))
+	if got := d.ready(at(400)); !reflect.DeepEqual(got, []watchEvent{{op: watchDeleted, path: "root/x"}}) {
+		t.Fatalf("expected a rename then removal to report the original path, got %+v", got)
+	}
+}
@@ -0,0 +1,56 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// 2026-10-16 is a Friday.
+	from := time.Date(2026, 10, 16, 10, 17, 42, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 16, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 16, 10, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2026, 10, 17, 2, 0, 0, 0, time.UTC)},
+		{"30 9 * * mon-fri", time.Date(2026, 10, 19, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1,20 * *", time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: either one matches.
+		{"0 0 31 * sat", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, 10, 16, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.spec, err)
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Fatalf("%q: next = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectsInvalidSpecs(t *testing.T) {
+	tests := map[string]string{
+		"* * * *":       "must have 5 fields",
+		"60 * * * *":    "invalid minute",
+		"* 5-2 * * *":   "invalid hour range",
+		"*/0 * * * *":   "invalid minute step",
+		"* * 0 * *":     "invalid day of month",
+		"* * * foo *":   "invalid month",
+		"* * * * 1-abc": "invalid day of week",
+	}
+	for spec, want := range tests {
+		if _, err := Parse(spec); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%q: expected an error containing %q, got %v", spec, want, err)
+		}
+	}
+}
@@ -0,0 +1,547 @@
+//go:build !windows
+// +build !windows
+
+package systeminfo
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// linuxPackageRoot is the directory the package databases and logs are read
+// under.
+var linuxPackageRoot = "/"
+
+// packageSource reads one package database or log under root. Sources
+// return an error wrapping fs.ErrNotExist when the host does not use them.
+type packageSource struct {
+	name string
+	read func(root string) ([]PackageInfo, error)
+}
+
+var linuxPackageSources = []packageSource{
+	{"dpkg", readDpkgStatus},
+	{"rpm", readRPMDatabase},
+	{"apk", readApkInstalled},
+	{"pacman", readPacmanLocal},
+	{"flatpak", readFlatpakDeployments},
+	{"snap", readSnaps},
+}
+
+var linuxUpdateLogs = []packageSource{
+	{"dpkg", readDpkgLog},
+	{"dnf", readDnfLog},
+	{"pacman", readPacmanLog},
+}
+
+// gatherLinuxPackages reads every source present on the host. A source that
+// fails does not stop the others; its error is returned with what was read.
+func gatherLinuxPackages(sources []packageSource) ([]PackageInfo, error) {
+	var packages []PackageInfo
+	var errs []error
+	for _, source := range sources {
+		found, err := source.read(linuxPackageRoot)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("%s: %w", source.name, err))
+		}
+		packages = append(packages, found...)
+	}
+	return packages, errors.Join(errs...)
+}
+
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func modTime(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return formatTimestamp(info.ModTime())
+}
+
+// readStanzas calls fn with the fields of each blank-line separated stanza
+// of a dpkg status or apk installed database. sep splits a line into its
+// key and value; continuation lines are skipped.
+func readStanzas(path string, sep string, fn func(fields map[string]string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	fields := map[string]string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(fields) > 0 {
+				fn(fields)
+				fields = map[string]string{}
+			}
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, sep); ok {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+	if len(fields) > 0 {
+		fn(fields)
+	}
+	return scanner.Err()
+}
+
+// readDpkgStatus reads the packages dpkg reports as installed. The install
+// time is when the installed version was unpacked, taken from its file list.
+func readDpkgStatus(root string) ([]PackageInfo, error) {
+	var packages []PackageInfo
+	err := readStanzas(filepath.Join(root, "var/lib/dpkg/status"), ":", func(fields map[string]string) {
+		status := strings.Fields(fields["Status"])
+		if len(status) != 3 || status[2] != "installed" || fields["Package"] == "" {
+			return
+		}
+		pkg := PackageInfo{
+			Name:         fields["Package"],
+			Version:      fields["Version"],
+			Architecture: fields["Architecture"],
+			Source:       "dpkg",
+		}
+		info := filepath.Join(root, "var/lib/dpkg/info")
+		pkg.InstallTime = modTime(filepath.Join(info, pkg.Name+":"+pkg.Architecture+".list"))
+		if pkg.InstallTime == "" {
+			pkg.InstallTime = modTime(filepath.Join(info, pkg.Name+".list"))
+		}
+		packages = append(packages, pkg)
+	})
+	return packages, err
+}
+
+// readApkInstalled reads the Alpine package database, which does not record
+// install times.
+func readApkInstalled(root string) ([]PackageInfo, error) {
+	var packages []PackageInfo
+	err := readStanzas(filepath.Join(root, "lib/apk/db/installed"), ":", func(fields map[string]string) {
+		if fields["P"] == "" {
+			return
+		}
+		packages = append(packages, PackageInfo{Name: fields["P"], Version: fields["V"], Architecture: fields["A"], Source: "apk"})
+	})
+	return packages, err
+}
+
+// readPacmanLocal reads the desc file pacman keeps for each installed
+// package.
+func readPacmanLocal(root string) ([]PackageInfo, error) {
+	dir := filepath.Join(root, "var/lib/pacman/local")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var packages []PackageInfo
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), "desc"))
+		if err != nil {
+			continue
+		}
+		sections := pacmanSections(data)
+		if sections["NAME"] == "" {
+			continue
+		}
+		pkg := PackageInfo{Name: sections["NAME"], Version: sections["VERSION"], Architecture: sections["ARCH"], Source: "pacman"}
+		if seconds, err := strconv.ParseInt(sections["INSTALLDATE"], 10, 64); err == nil {
+			pkg.InstallTime = formatTimestamp(time.Unix(seconds, 0))
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// pacmanSections returns the first line of each %NAME% section of a desc
+// file.
+func pacmanSections(data []byte) map[string]string {
+	sections := map[string]string{}
+	var current string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case len(line) > 2 && line[0] == '%' && line[len(line)-1] == '%':
+			current = line[1 : len(line)-1]
+		case line == "":
+			current = ""
+		case current != "":
+			if _, ok := sections[current]; !ok {
+				sections[current] = line
+			}
+		}
+	}
+	return sections
+}
+
+// readFlatpakDeployments reads the system-wide flatpak applications and
+// runtimes. The version is the newest release in the AppStream metadata, or
+// the branch when there is none, and the install time is when the active
+// commit was deployed.
+func readFlatpakDeployments(root string) ([]PackageInfo, error) {
+	base := filepath.Join(root, "var/lib/flatpak")
+	if _, err := os.Stat(base); err != nil {
+		return nil, err
+	}
+	var packages []PackageInfo
+	for _, kind := range []string{"app", "runtime"} {
+		ids, err := os.ReadDir(filepath.Join(base, kind))
+		if err != nil {
+			continue
+		}
+		for _, id := range ids {
+			arches, err := os.ReadDir(filepath.Join(base, kind, id.Name()))
+			if err != nil {
+				continue
+			}
+			for _, arch := range arches {
+				branches, err := os.ReadDir(filepath.Join(base, kind, id.Name(), arch.Name()))
+				if err != nil {
+					continue
+				}
+				for _, branch := range branches {
+					active := filepath.Join(base, kind, id.Name(), arch.Name(), branch.Name(), "active")
+					deployed, err := filepath.EvalSymlinks(active)
+					if err != nil {
+						continue
+					}
+					version := appStreamVersion(deployed, id.Name())
+					if version == "" {
+						version = branch.Name()
+					}
+					packages = append(packages, PackageInfo{
+						Name:         id.Name(),
+						Version:      version,
+						Architecture: arch.Name(),
+						Source:       "flatpak",
+						InstallTime:  modTime(deployed),
+					})
+				}
+			}
+		}
+	}
+	return packages, nil
+}
+
+func appStreamVersion(deployed, id string) string {
+	for _, name := range []string{"metainfo/" + id + ".metainfo.xml", "metainfo/" + id + ".appdata.xml", "appdata/" + id + ".appdata.xml"} {
+		f, err := os.Open(filepath.Join(deployed, "files/share", name))
+		if err != nil {
+			continue
+		}
+		version := firstReleaseVersion(f)
+		f.Close()
+		if version != "" {
+			return version
+		}
+	}
+	return ""
+}
+
+// firstReleaseVersion returns the version of the first <release> element,
+// which AppStream lists newest first.
+func firstReleaseVersion(r io.Reader) string {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "release" {
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "version" {
+					return attr.Value
+				}
+			}
+		}
+	}
+}
+
+// readSnaps reads the snap.yaml of the current revision of each snap. The
+// install time is when that revision was downloaded.
+func readSnaps(root string) ([]PackageInfo, error) {
+	dir := filepath.Join(root, "snap")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var packages []PackageInfo
+	for _, entry := range entries {
+		revision, err := os.Readlink(filepath.Join(dir, entry.Name(), "current"))
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name(), "current/meta/snap.yaml"))
+		if err != nil {
+			continue
+		}
+		pkg := parseSnapYAML(data)
+		if pkg.Name == "" {
+			pkg.Name = entry.Name()
+		}
+		pkg.Source = "snap"
+		pkg.InstallTime = modTime(filepath.Join(root, "var/lib/snapd/snaps", entry.Name()+"_"+filepath.Base(revision)+".snap"))
+		packages = append(packages, pkg)
+	}
+	return packages, nil
+}
+
+// parseSnapYAML reads the name, version and architectures keys of a
+// snap.yaml. Only top-level scalars and the architectures list are needed,
+// so the file is read line by line.
+func parseSnapYAML(data []byte) PackageInfo {
+	var pkg PackageInfo
+	var arches []string
+	inArches := false
+	for _, line := range strings.Split(string(data), "\n") {
+		if inArches {
+			if item, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok && (line[0] == ' ' || line[0] == '-') {
+				arches = append(arches, unquoteYAML(item))
+				continue
+			}
+			inArches = false
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "name":
+			pkg.Name = unquoteYAML(value)
+		case "version":
+			pkg.Version = unquoteYAML(value)
+		case "architectures":
+			if inline, ok := strings.CutPrefix(value, "["); ok {
+				for _, item := range strings.Split(strings.TrimSuffix(inline, "]"), ",") {
+					arches = append(arches, unquoteYAML(strings.TrimSpace(item)))
+				}
+			} else {
+				inArches = true
+			}
+		}
+	}
+	pkg.Architecture = strings.Join(arches, ",")
+	return pkg
+}
+
+func unquoteYAML(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// readLogLines calls fn with each line of the log at path and of its
+// rotations (path.1, path.2.gz, path-20240301, ...), oldest first. It
+// returns an error wrapping fs.ErrNotExist when none of them exist.
+func readLogLines(path string, fn func(line string)) error {
+	found := false
+	for _, name := range append(rotatedLogs(path), path) {
+		err := readLogFile(name, fn)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+// rotatedLogs lists the rotations of the log at path, oldest first: dated
+// rotations by date, then numbered ones from the highest number down.
+func rotatedLogs(path string) []string {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil
+	}
+	type rotation struct {
+		name string
+		date string
+		n    int
+	}
+	base := filepath.Base(path)
+	var rotations []rotation
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Name(), base)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		rest = strings.TrimSuffix(rest, ".gz")
+		if date, ok := strings.CutPrefix(rest, "-"); ok && len(date) == 8 && isDigits(date) {
+			rotations = append(rotations, rotation{name: entry.Name(), date: date})
+		} else if n, ok := strings.CutPrefix(rest, "."); ok && isDigits(n) {
+			number, _ := strconv.Atoi(n)
+			rotations = append(rotations, rotation{name: entry.Name(), n: number})
+		}
+	}
+	slices.SortFunc(rotations, func(a, b rotation) int {
+		if a.date != b.date {
+			// Dated rotations sort before numbered ones, which have none.
+			if a.date == "" || b.date == "" {
+				return strings.Compare(b.date, a.date)
+			}
+			return strings.Compare(a.date, b.date)
+		}
+		return b.n - a.n
+	})
+	names := make([]string, len(rotations))
+	for i, r := range rotations {
+		names[i] = filepath.Join(filepath.Dir(path), r.name)
+	}
+	return names
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// readLogFile calls fn with each line of one log file, decompressing it
+// when its name ends in .gz.
+func readLogFile(path string, fn func(line string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// readDpkgLog reads upgrades from lines such as
+// "2024-03-01 10:00:00 upgrade libssl3:amd64 3.0.11-1 3.0.13-1".
+func readDpkgLog(root string) ([]PackageInfo, error) {
+	var updates []PackageInfo
+	err := readLogLines(filepath.Join(root, "var/log/dpkg.log"), func(line string) {
+		fields := strings.Fields(line)
+		if len(fields) != 6 || fields[2] != "upgrade" {
+			return
+		}
+		name, arch, _ := strings.Cut(fields[3], ":")
+		update := PackageInfo{Name: name, Version: fields[5], Architecture: arch, Source: "dpkg"}
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05", fields[0]+" "+fields[1], time.Local); err == nil {
+			update.InstallTime = formatTimestamp(t)
+		}
+		updates = append(updates, update)
+	})
+	return updates, err
+}
+
+// readDnfLog reads upgrades from lines such as
+// "2024-03-01T10:00:00+0000 SUBDEBUG Upgrade: bash-5.2.26-1.fc39.x86_64".
+func readDnfLog(root string) ([]PackageInfo, error) {
+	var updates []PackageInfo
+	err := readLogLines(filepath.Join(root, "var/log/dnf.rpm.log"), func(line string) {
+		fields := strings.Fields(line)
+		if len(fields) != 4 || fields[2] != "Upgrade:" {
+			return
+		}
+		update, ok := parseNEVRA(fields[3])
+		if !ok {
+			return
+		}
+		update.Source = "dnf"
+		for _, layout := range []string{"2006-01-02T15:04:05-0700", time.RFC3339} {
+			if t, err := time.Parse(layout, fields[0]); err == nil {
+				update.InstallTime = formatTimestamp(t)
+				break
+			}
+		}
+		updates = append(updates, update)
+	})
+	return updates, err
+}
+
+// parseNEVRA splits an rpm package label such as
+// "bash-1:5.2.26-1.fc39.x86_64" into its name, version and architecture.
+func parseNEVRA(label string) (PackageInfo, bool) {
+	dot := strings.LastIndexByte(label, '.')
+	if dot < 0 {
+		return PackageInfo{}, false
+	}
+	nevr, arch := label[:dot], label[dot+1:]
+	releaseDash := strings.LastIndexByte(nevr, '-')
+	if releaseDash < 0 {
+		return PackageInfo{}, false
+	}
+	versionDash := strings.LastIndexByte(nevr[:releaseDash], '-')
+	if versionDash < 0 {
+		return PackageInfo{}, false
+	}
+	return PackageInfo{Name: nevr[:versionDash], Version: nevr[versionDash+1:], Architecture: arch}, true
+}
+
+// readPacmanLog reads upgrades from lines such as
+// "[2024-03-01T10:00:00+0100] [ALPM] upgraded linux (6.7.6-1 -> 6.7.8-1)".
+func readPacmanLog(root string) ([]PackageInfo, error) {
+	var updates []PackageInfo
+	err := readLogLines(filepath.Join(root, "var/log/pacman.log"), func(line string) {
+		stamp, rest, ok := strings.Cut(strings.TrimPrefix(line, "["), "] [ALPM] upgraded ")
+		if !ok {
+			return
+		}
+		name, versions, ok := strings.Cut(rest, " (")
+		_, version, arrow := strings.Cut(strings.TrimSuffix(versions, ")"), " -> ")
+		if !ok || !arrow {
+			return
+		}
+		update := PackageInfo{Name: name, Version: version, Source: "pacman"}
+		if t, err := time.Parse("2006-01-02T15:04:05-0700", stamp); err == nil {
+			update.InstallTime = formatTimestamp(t)
+		} else if t, err := time.ParseInLocation("2006-01-02 15:04", stamp, time.Local); err == nil {
+			update.InstallTime = formatTimestamp(t)
+		}
+		updates = append(updates, update)
+	})
+	return updates, err
+}
@@ -0,0 +1,302 @@
+//go:build !windows
+// +build !windows
+
+package systeminfo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeFixture(t *testing.T, root, name, content string) string {
+	t.Helper()
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func useLinuxPackageRoot(t *testing.T, root string) {
+	t.Helper()
+	orig := linuxPackageRoot
+	t.Cleanup(func() { linuxPackageRoot = orig })
+	linuxPackageRoot = root
+}
+
+func TestGatherLinuxPackages(t *testing.T) {
+	root := t.TempDir()
+	installed := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	writeFixture(t, root, "var/lib/dpkg/status", `Package: openssl
+Status: install ok installed
+Architecture: amd64
+Version: 3.0.11-1~deb12u2
+Description: Secure Sockets Layer toolkit
+ This package contains the openssl binary.
+
+Package: removed-tool
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0-1
+`)
+	list := writeFixture(t, root, "var/lib/dpkg/info/openssl:amd64.list", "/usr/bin/openssl\n")
+	if err := os.Chtimes(list, installed, installed); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	writeFixture(t, root, "lib/apk/db/installed", "C:Q1abc=\nP:musl\nV:1.2.4-r2\nA:x86_64\nT:the musl c library\n\nP:busybox\nV:1.36.1-r5\nA:x86_64\n")
+	writeFixture(t, root, "var/lib/pacman/local/linux-6.7.8-1/desc", "%NAME%\nlinux\n\n%VERSION%\n6.7.8-1\n\n%ARCH%\nx86_64\n\n%INSTALLDATE%\n1709287200\n")
+	deploy := filepath.Join(root, "var/lib/flatpak/app/org.mozilla.firefox/x86_64/stable/2f1c")
+	writeFixture(t, deploy, "files/share/metainfo/org.mozilla.firefox.metainfo.xml",
+		`<?xml version="1.0"?><component><id>org.mozilla.firefox</id><releases><release version="124.0" date="2024-03-19"/><release version="123.0.1"/></releases></component>`)
+	if err := os.Symlink("2f1c", filepath.Join(filepath.Dir(deploy), "active")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	writeFixture(t, root, "snap/core22/1380/meta/snap.yaml", "name: core22\nversion: '20240408'\narchitectures:\n  - amd64\ntype: base\n")
+	if err := os.Symlink("1380", filepath.Join(root, "snap/core22/current")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "snap/bin"), 0700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	useLinuxPackageRoot(t, root)
+
+	packages, err := gatherLinuxPackages(linuxPackageSources)
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	for i := range packages {
+		if packages[i].Source == "flatpak" {
+			packages[i].InstallTime = ""
+		}
+	}
+	want := []PackageInfo{
+		{Name: "openssl", Version: "3.0.11-1~deb12u2", Architecture: "amd64", Source: "dpkg", InstallTime: "2024-03-01T10:00:00Z"},
+		{Name: "musl", Version: "1.2.4-r2", Architecture: "x86_64", Source: "apk"},
+		{Name: "busybox", Version: "1.36.1-r5", Architecture: "x86_64", Source: "apk"},
+		{Name: "linux", Version: "6.7.8-1", Architecture: "x86_64", Source: "pacman", InstallTime: "2024-03-01T10:00:00Z"},
+		{Name: "org.mozilla.firefox", Version: "124.0", Architecture: "x86_64", Source: "flatpak"},
+		{Name: "core22", Version: "20240408", Architecture: "amd64", Source: "snap"},
+	}
+	if !reflect.DeepEqual(packages, want) {
+		t.Fatalf("unexpected packages:\n got %+v\nwant %+v", packages, want)
+	}
+}
+
+// rpmHeader builds a header blob with the given string and int32 tags.
+func rpmHeader(strs map[uint32]string, ints map[uint32]uint32) []byte {
+	var index, store []byte
+	add := func(tag, kind uint32, data []byte) {
+		for kind == rpmTypeInt32 && len(store)%4 != 0 {
+			store = append(store, 0)
+		}
+		index = binary.BigEndian.AppendUint32(index, tag)
+		index = binary.BigEndian.AppendUint32(index, kind)
+		index = binary.BigEndian.AppendUint32(index, uint32(len(store)))
+		index = binary.BigEndian.AppendUint32(index, 1)
+		store = append(store, data...)
+	}
+	for _, tag := range []uint32{rpmTagName, rpmTagVersion, rpmTagRelease, rpmTagArch} {
+		if value, ok := strs[tag]; ok {
+			add(tag, rpmTypeString, append([]byte(value), 0))
+		}
+	}
+	for _, tag := range []uint32{rpmTagEpoch, rpmTagInstallTime} {
+		if value, ok := ints[tag]; ok {
+			add(tag, rpmTypeInt32, binary.BigEndian.AppendUint32(nil, value))
+		}
+	}
+	blob := binary.BigEndian.AppendUint32(nil, uint32(len(index)/16))
+	blob = binary.BigEndian.AppendUint32(blob, uint32(len(store)))
+	return append(append(blob, index...), store...)
+}
+
+func TestReadRPMDatabases(t *testing.T) {
+	bash := rpmHeader(
+		map[uint32]string{rpmTagName: "bash", rpmTagVersion: "5.2.26", rpmTagRelease: "1.fc39", rpmTagArch: "x86_64"},
+		map[uint32]uint32{rpmTagInstallTime: 1709287200},
+	)
+	openssl := rpmHeader(
+		map[uint32]string{rpmTagName: "openssl", rpmTagVersion: "3.1.1", rpmTagRelease: "4.fc39", rpmTagArch: "x86_64"},
+		map[uint32]uint32{rpmTagEpoch: 1, rpmTagInstallTime: 1709287200},
+	)
+	key := rpmHeader(map[uint32]string{rpmTagName: "gpg-pubkey", rpmTagVersion: "18b8e74c"}, nil)
+	want := []PackageInfo{
+		{Name: "bash", Version: "5.2.26-1.fc39", Architecture: "x86_64", Source: "rpm", InstallTime: "2024-03-01T10:00:00Z"},
+		{Name: "openssl", Version: "1:3.1.1-4.fc39", Architecture: "x86_64", Source: "rpm", InstallTime: "2024-03-01T10:00:00Z"},
+	}
+
+	t.Run("sqlite", func(t *testing.T) {
+		root := t.TempDir()
+		path := filepath.Join(root, "var/lib/rpm/rpmdb.sqlite")
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`CREATE TABLE Packages (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)`); err != nil {
+			t.Fatal(err)
+		}
+		for _, blob := range [][]byte{bash, openssl, key} {
+			if _, err := db.Exec(`INSERT INTO Packages (blob) VALUES (?)`, blob); err != nil {
+				t.Fatal(err)
+			}
+		}
+		db.Close()
+		got, err := readRPMDatabase(root)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("berkeley", func(t *testing.T) {
+		// A metadata page, a hash page holding bash inline and openssl on
+		// two overflow pages.
+		const pageSize = 512
+		le := binary.LittleEndian
+		data := make([]byte, 4*pageSize)
+		le.PutUint32(data[12:], bdbHashMagic)
+		le.PutUint32(data[20:], pageSize)
+		hash := data[pageSize : 2*pageSize]
+		hash[25] = bdbPageTypeHash
+		le.PutUint16(hash[20:], 4)
+		items := [][]byte{
+			{bdbItemKeyData, 1, 0, 0, 0},
+			append([]byte{bdbItemKeyData}, bash...),
+			{bdbItemKeyData, 2, 0, 0, 0},
+			make([]byte, 12),
+		}
+		items[3][0] = bdbItemOffPage
+		le.PutUint32(items[3][4:], 2)
+		le.PutUint32(items[3][8:], uint32(len(openssl)))
+		end := pageSize
+		for i, item := range items {
+			end -= len(item)
+			copy(hash[end:], item)
+			le.PutUint16(hash[bdbPageHeaderSize+2*i:], uint16(end))
+		}
+		split := len(openssl) / 2
+		for n, chunk := range [][]byte{openssl[:split], openssl[split:]} {
+			page := data[(2+n)*pageSize : (3+n)*pageSize]
+			page[25] = bdbPageTypeOverflow
+			if n == 0 {
+				le.PutUint32(page[16:], 3)
+			}
+			le.PutUint16(page[22:], uint16(len(chunk)))
+			copy(page[bdbPageHeaderSize:], chunk)
+		}
+		root := t.TempDir()
+		writeFixture(t, root, "var/lib/rpm/Packages", string(data))
+		got, err := readRPMDatabase(root)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("ndb", func(t *testing.T) {
+		le := binary.LittleEndian
+		data := make([]byte, 4096)
+		le.PutUint32(data, ndbHeaderMagic)
+		le.PutUint32(data[12:], 1)
+		for i := 0; i < ndbSlotsPerPage-2; i++ {
+			le.PutUint32(data[32+16*i:], ndbSlotMagic)
+		}
+		for i, blob := range [][]byte{bash, openssl} {
+			slot := data[32+16*i:]
+			le.PutUint32(slot[4:], uint32(i+1))
+			le.PutUint32(slot[8:], uint32(len(data)/ndbBlockSize))
+			header := make([]byte, 16)
+			le.PutUint32(header, ndbBlobMagic)
+			le.PutUint32(header[4:], uint32(i+1))
+			le.PutUint32(header[12:], uint32(len(blob)))
+			data = append(append(data, header...), blob...)
+			for len(data)%ndbBlockSize != 0 {
+				data = append(data, 0)
+			}
+		}
+		root := t.TempDir()
+		writeFixture(t, root, "usr/lib/sysimage/rpm/Packages.db", string(data))
+		got, err := readRPMDatabase(root)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %+v, %v", got, err)
+		}
+	})
+}
+
+func TestGatherLinuxUpdates(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, "var/log/dpkg.log", "2024-03-01 10:00:00 install curl:amd64 <none> 7.88.1-10\n2024-03-01 10:00:05 upgrade libssl3:amd64 3.0.11-1 3.0.13-1\n")
+	writeFixture(t, root, "var/log/dnf.rpm.log", "2024-03-01T10:00:00+0000 SUBDEBUG Upgrade: bash-5.2.26-1.fc39.x86_64\n2024-03-01T10:00:00+0000 SUBDEBUG Upgraded: bash-5.2.15-5.fc39.x86_64\n")
+	writeFixture(t, root, "var/log/pacman.log", "[2024-03-01T11:00:00+0100] [ALPM] upgraded linux (6.7.6-1 -> 6.7.8-1)\n[2024-03-01T11:00:00+0100] [ALPM] installed git (2.44.0-1)\n")
+	useLinuxPackageRoot(t, root)
+
+	updates, err := gatherLinuxPackages(linuxUpdateLogs)
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	dpkgTime, _ := time.ParseInLocation("2006-01-02 15:04:05", "2024-03-01 10:00:05", time.Local)
+	want := []PackageInfo{
+		{Name: "libssl3", Version: "3.0.13-1", Architecture: "amd64", Source: "dpkg", InstallTime: dpkgTime.UTC().Format(time.RFC3339)},
+		{Name: "bash", Version: "5.2.26-1.fc39", Architecture: "x86_64", Source: "dnf", InstallTime: "2024-03-01T10:00:00Z"},
+		{Name: "linux", Version: "6.7.8-1", Source: "pacman", InstallTime: "2024-03-01T10:00:00Z"},
+	}
+	if !reflect.DeepEqual(updates, want) {
+		t.Fatalf("unexpected updates:\n got %+v\nwant %+v", updates, want)
+	}
+}
+
+func TestGatherLinuxUpdatesReadsRotatedLogs(t *testing.T) {
+	root := t.TempDir()
+	gzipped := func(content string) string {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write([]byte(content)); err != nil {
+			t.Fatalf("gzip: %v", err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatalf("gzip: %v", err)
+		}
+		return buf.String()
+	}
+	writeFixture(t, root, "var/log/dpkg.log.2.gz", gzipped("2024-01-01 10:00:00 upgrade a:amd64 1 2\n"))
+	writeFixture(t, root, "var/log/dpkg.log.1", "2024-02-01 10:00:00 upgrade b:amd64 1 2\n")
+	writeFixture(t, root, "var/log/dpkg.log", "2024-03-01 10:00:00 upgrade c:amd64 1 2\n")
+	writeFixture(t, root, "var/log/dpkg.log.bak", "2024-04-01 10:00:00 upgrade ignored:amd64 1 2\n")
+	// Only rotated dnf logs are left once the current one was rotated away.
+	writeFixture(t, root, "var/log/dnf.rpm.log.1", "2024-03-01T10:00:00+0000 SUBDEBUG Upgrade: bash-5.2.26-1.fc39.x86_64\n")
+	writeFixture(t, root, "var/log/pacman.log-20240201.gz", gzipped("[2024-02-01T10:00:00+0000] [ALPM] upgraded git (2.43.0-1 -> 2.44.0-1)\n"))
+	writeFixture(t, root, "var/log/pacman.log", "[2024-03-01T10:00:00+0000] [ALPM] upgraded linux (6.7.6-1 -> 6.7.8-1)\n")
+	useLinuxPackageRoot(t, root)
+
+	updates, err := gatherLinuxPackages(linuxUpdateLogs)
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	var got []string
+	for _, update := range updates {
+		got = append(got, update.Source+":"+update.Name)
+	}
+	want := []string{"dpkg:a", "dpkg:b", "dpkg:c", "dnf:bash", "pacman:git", "pacman:linux"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("updates = %v, want %v", got, want)
+	}
+}
+
+func TestParseSoftwareUpdateHistory(t *testing.T) {
+	out := []byte("Display Name                 Version    Date\n------------                 -------    ----\nmacOS Ventura 13.2.1         13.2.1     02/17/2023, 09:27:44\n")
+	updates := parseSoftwareUpdateHistory(out)
+	if len(updates) != 1 || updates[0].Name != "macOS Ventura 13.2.1" || updates[0].Version != "13.2.1" || updates[0].InstallTime == "" {
+		t.Fatalf("unexpected updates %+v", updates)
+	}
+}
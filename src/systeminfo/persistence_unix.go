@@ -0,0 +1,719 @@
+//go:build !windows
+// +build !windows
+
+package systeminfo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// persistenceRoot is the directory the persistence locations are read
+// under. Home directories are taken from usersFilePath.
+var persistenceRoot = "/"
+
+var (
+	// systemdSystemUnitDirs and systemdUserUnitDirs are the unit search
+	// paths, highest priority first.
+	systemdSystemUnitDirs = []string{
+		"etc/systemd/system",
+		"run/systemd/transient",
+		"run/systemd/generator.early",
+		"run/systemd/system",
+		"run/systemd/generator",
+		"usr/local/lib/systemd/system",
+		"usr/lib/systemd/system",
+		"lib/systemd/system",
+		"run/systemd/generator.late",
+	}
+	systemdUserUnitDirs = []string{
+		"etc/systemd/user",
+		"run/systemd/user",
+		"usr/local/lib/systemd/user",
+		"usr/lib/systemd/user",
+		"lib/systemd/user",
+	}
+
+	systemShellProfiles = []string{
+		"etc/profile", "etc/bash.bashrc", "etc/bashrc", "etc/environment",
+		"etc/zshenv", "etc/zprofile", "etc/zshrc", "etc/zlogin",
+		"etc/zsh/zshenv", "etc/zsh/zprofile", "etc/zsh/zshrc", "etc/zsh/zlogin",
+	}
+	userShellProfiles = []string{
+		".profile", ".bash_profile", ".bash_login", ".bashrc", ".bash_logout",
+		".zshenv", ".zprofile", ".zshrc", ".zlogin",
+	}
+
+	cronPeriodDirs = []struct{ dir, schedule string }{
+		{"etc/cron.hourly", "@hourly"},
+		{"etc/cron.daily", "@daily"},
+		{"etc/cron.weekly", "@weekly"},
+		{"etc/cron.monthly", "@monthly"},
+	}
+	// userCrontabDirs hold one crontab per user: Debian uses the first,
+	// Red Hat and Arch the second.
+	userCrontabDirs = []string{"var/spool/cron/crontabs", "var/spool/cron"}
+
+	commandSearchPath = []string{"usr/local/sbin", "usr/local/bin", "usr/sbin", "usr/bin", "sbin", "bin"}
+
+	darwinLaunchdDirs = []struct{ dir, owner string }{
+		{"Library/LaunchDaemons", "root"},
+		{"Library/LaunchAgents", ""},
+	}
+)
+
+// persistenceCollector gathers items and the errors worth reporting;
+// locations that do not exist are expected and ignored.
+type persistenceCollector struct {
+	items []PersistenceItem
+	errs  []error
+}
+
+func (c *persistenceCollector) note(err error) {
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		c.errs = append(c.errs, err)
+	}
+}
+
+func (c *persistenceCollector) readDir(rel string) []os.DirEntry {
+	entries, err := os.ReadDir(filepath.Join(persistenceRoot, rel))
+	c.note(err)
+	return entries
+}
+
+// home is a user's home directory, relative to persistenceRoot.
+type home struct {
+	user, dir string
+}
+
+func persistenceHomes() ([]home, error) {
+	users, err := readPasswd(usersFilePath)
+	if err != nil {
+		return nil, err
+	}
+	var homes []home
+	seen := map[string]bool{}
+	for _, u := range users {
+		dir := strings.TrimPrefix(filepath.Clean(u.Home), "/")
+		if u.Home == "" || dir == "." || seen[dir] {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(persistenceRoot, dir)); err != nil || !info.IsDir() {
+			continue
+		}
+		seen[dir] = true
+		homes = append(homes, home{user: u.Name, dir: dir})
+	}
+	return homes, nil
+}
+
+func gatherLinuxPersistence() ([]PersistenceItem, error) {
+	c := &persistenceCollector{}
+	homes, err := persistenceHomes()
+	c.note(err)
+
+	c.systemdUnits(systemdSystemUnitDirs, "root")
+	c.systemdUnits(systemdUserUnitDirs, "")
+	for _, h := range homes {
+		c.systemdUnits([]string{filepath.Join(h.dir, ".config/systemd/user")}, h.user)
+	}
+	c.autostart("etc/xdg/autostart", "")
+	for _, h := range homes {
+		c.autostart(filepath.Join(h.dir, ".config/autostart"), h.user)
+	}
+	c.rcLocal()
+	c.initScripts()
+	c.shellProfiles(homes)
+	c.cronJobs()
+
+	executableDigests(c.items, persistencePath)
+	return c.items, errors.Join(c.errs...)
+}
+
+// gatherDarwinPersistence reads the launchd jobs and shell profiles. Local
+// accounts live in Directory Services rather than /etc/passwd, so homes
+// are found under /Users.
+func gatherDarwinPersistence() ([]PersistenceItem, error) {
+	c := &persistenceCollector{}
+	var homes []home
+	for _, e := range c.readDir("Users") {
+		if e.IsDir() && e.Name() != "Shared" && !strings.HasPrefix(e.Name(), ".") {
+			homes = append(homes, home{user: e.Name(), dir: filepath.Join("Users", e.Name())})
+		}
+	}
+	for _, d := range darwinLaunchdDirs {
+		c.launchd(d.dir, d.owner)
+	}
+	for _, h := range homes {
+		c.launchd(filepath.Join(h.dir, "Library/LaunchAgents"), h.user)
+	}
+	c.shellProfiles(homes)
+	executableDigests(c.items, persistencePath)
+	return c.items, errors.Join(c.errs...)
+}
+
+// persistencePath returns where to read an executable from, or "" when it
+// is not an absolute path.
+func persistencePath(executable string) string {
+	if !filepath.IsAbs(executable) {
+		return ""
+	}
+	return filepath.Join(persistenceRoot, executable)
+}
+
+// resolveCommand looks a bare command name up in the standard binary
+// directories, returning the path as seen on the host.
+func resolveCommand(name string) string {
+	if name == "" || strings.Contains(name, "/") {
+		return name
+	}
+	for _, dir := range commandSearchPath {
+		if info, err := os.Stat(filepath.Join(persistenceRoot, dir, name)); err == nil && info.Mode().IsRegular() {
+			return "/" + filepath.Join(dir, name)
+		}
+	}
+	return name
+}
+
+// commandItem fills in the executable and arguments of an item from a
+// command line.
+func commandItem(item PersistenceItem, command string) PersistenceItem {
+	if args := splitCommandLine(command); len(args) > 0 {
+		item.Executable = resolveCommand(args[0])
+		if len(args) > 1 {
+			item.Arguments = args[1:]
+		}
+	}
+	return item
+}
+
+// splitCommandLine splits a command line into words as systemd and the
+// shell do for simple commands: on blanks, honouring single and double
+// quotes and backslash escapes.
+func splitCommandLine(s string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == '\'':
+			word.WriteByte(c)
+		case c == '\\' && i+1 < len(s):
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case quote == '"':
+			word.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// iniSections parses systemd unit files and desktop entries into their
+// sections, keeping every value of a key in order. An empty assignment
+// clears the values before it, as systemd does for list settings.
+type iniSections map[string]map[string][]string
+
+func (s iniSections) parse(data []byte) {
+	section := ""
+	var pending string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if cont, ok := strings.CutSuffix(line, `\`); ok {
+			pending += cont + " "
+			continue
+		}
+		line, pending = pending+line, ""
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if s[section] == nil {
+			s[section] = map[string][]string{}
+		}
+		if value == "" {
+			s[section][key] = nil
+			continue
+		}
+		s[section][key] = append(s[section][key], value)
+	}
+}
+
+func (s iniSections) first(section, key string) string {
+	if values := s[section][key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+type systemdUnit struct {
+	name, path string
+	state      string
+	sections   iniSections
+}
+
+// systemdUnits reads the service and timer units of one set of search
+// paths. A unit is defined by the highest priority file of its name, then
+// its drop-ins in name order, also taken from the highest priority
+// directory holding each.
+func (c *persistenceCollector) systemdUnits(dirs []string, owner string) {
+	units := map[string]*systemdUnit{}
+	var names []string
+	wanted := map[string]bool{}
+	for _, dir := range dirs {
+		for _, e := range c.readDir(dir) {
+			name := e.Name()
+			full := filepath.Join(persistenceRoot, dir, name)
+			if e.IsDir() {
+				if base, ok := cutAnySuffix(name, ".wants", ".requires", ".upholds"); ok && base != "" {
+					for _, link := range c.readDir(filepath.Join(dir, name)) {
+						wanted[link.Name()] = true
+						if prefix, _, ok := strings.Cut(link.Name(), "@"); ok {
+							wanted[prefix+"@"+filepath.Ext(link.Name())] = true
+						}
+					}
+				}
+				continue
+			}
+			if !strings.HasSuffix(name, ".service") && !strings.HasSuffix(name, ".timer") {
+				continue
+			}
+			if units[name] != nil {
+				continue
+			}
+			unit := &systemdUnit{name: name, path: "/" + filepath.Join(dir, name), sections: iniSections{}}
+			if target, err := os.Readlink(full); err == nil {
+				if target == "/dev/null" {
+					unit.state = "masked"
+				} else if filepath.Base(target) != name {
+					// An alias of another unit, listed under its own name.
+					continue
+				}
+			}
+			if unit.state == "" {
+				data, err := os.ReadFile(full)
+				if err != nil {
+					c.note(err)
+					continue
+				}
+				if len(bytes.TrimSpace(data)) == 0 {
+					unit.state = "masked"
+				}
+				unit.sections.parse(data)
+				switch {
+				case strings.HasPrefix(dir, "run/systemd/generator"):
+					unit.state = "generated"
+				case dir == "run/systemd/transient":
+					unit.state = "transient"
+				}
+			}
+			units[name] = unit
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		unit := units[name]
+		if unit.state == "masked" {
+			continue
+		}
+		dropIns := map[string]string{}
+		for _, dir := range dirs {
+			for _, e := range c.readDir(filepath.Join(dir, name+".d")) {
+				if strings.HasSuffix(e.Name(), ".conf") && dropIns[e.Name()] == "" {
+					dropIns[e.Name()] = filepath.Join(persistenceRoot, dir, name+".d", e.Name())
+				}
+			}
+		}
+		confs := make([]string, 0, len(dropIns))
+		for conf := range dropIns {
+			confs = append(confs, conf)
+		}
+		sort.Strings(confs)
+		for _, conf := range confs {
+			data, err := os.ReadFile(dropIns[conf])
+			c.note(err)
+			unit.sections.parse(data)
+		}
+		if unit.state == "" {
+			switch {
+			case wanted[name]:
+				unit.state = "enabled"
+			case len(unit.sections["Install"]) == 0:
+				unit.state = "static"
+			default:
+				unit.state = "disabled"
+			}
+		}
+	}
+
+	for _, name := range names {
+		unit := units[name]
+		item := PersistenceItem{Name: name, Path: unit.path, State: unit.state}
+		service := unit
+		if strings.HasSuffix(name, ".timer") {
+			item.Kind = "systemd-timer"
+			var schedule []string
+			for _, key := range []string{"OnCalendar", "OnBootSec", "OnStartupSec", "OnActiveSec", "OnUnitActiveSec", "OnUnitInactiveSec"} {
+				for _, value := range unit.sections["Timer"][key] {
+					schedule = append(schedule, key+"="+value)
+				}
+			}
+			item.Schedule = strings.Join(schedule, "; ")
+			target := unit.sections.first("Timer", "Unit")
+			if target == "" {
+				target = strings.TrimSuffix(name, ".timer") + ".service"
+			}
+			service = units[target]
+		} else {
+			item.Kind = "systemd-service"
+		}
+		if service != nil && service.state != "masked" {
+			item = commandItem(item, execCommand(service.sections.first("Service", "ExecStart")))
+			item.Owner = owner
+			if user := service.sections.first("Service", "User"); user != "" {
+				item.Owner = user
+			}
+		}
+		c.items = append(c.items, item)
+	}
+}
+
+// execCommand strips the prefixes systemd allows before an Exec command.
+// With "@" the second word is the process name rather than an argument.
+func execCommand(command string) string {
+	trimmed := strings.TrimLeft(command, "@-:+!|")
+	if strings.Contains(command[:len(command)-len(trimmed)], "@") {
+		if args := splitCommandLine(trimmed); len(args) > 1 {
+			_, rest, _ := strings.Cut(trimmed, args[1])
+			return args[0] + rest
+		}
+	}
+	return trimmed
+}
+
+func cutAnySuffix(s string, suffixes ...string) (string, bool) {
+	for _, suffix := range suffixes {
+		if base, ok := strings.CutSuffix(s, suffix); ok {
+			return base, true
+		}
+	}
+	return s, false
+}
+
+var desktopFieldCode = regexp.MustCompile(`%[fFuUdDnNickvm]`)
+
+// autostart reads the XDG autostart entries of a directory.
+func (c *persistenceCollector) autostart(dir, owner string) {
+	for _, e := range c.readDir(dir) {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".desktop") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(persistenceRoot, dir, e.Name()))
+		if err != nil {
+			c.note(err)
+			continue
+		}
+		entry := iniSections{}
+		entry.parse(data)
+		item := PersistenceItem{Kind: "autostart", Name: e.Name(), Path: "/" + filepath.Join(dir, e.Name()), Owner: owner, State: "enabled"}
+		if strings.EqualFold(entry.first("Desktop Entry", "Hidden"), "true") ||
+			strings.EqualFold(entry.first("Desktop Entry", "X-GNOME-Autostart-enabled"), "false") {
+			item.State = "disabled"
+		}
+		command := desktopFieldCode.ReplaceAllString(entry.first("Desktop Entry", "Exec"), "")
+		c.items = append(c.items, commandItem(item, strings.ReplaceAll(command, "%%", "%")))
+	}
+}
+
+func (c *persistenceCollector) rcLocal() {
+	for _, rel := range []string{"etc/rc.local", "etc/rc.d/rc.local"} {
+		info, err := os.Stat(filepath.Join(persistenceRoot, rel))
+		if err != nil {
+			c.note(err)
+			continue
+		}
+		state := "disabled"
+		if info.Mode()&0o111 != 0 {
+			state = "enabled"
+		}
+		path := "/" + rel
+		c.items = append(c.items, PersistenceItem{Kind: "rc.local", Name: "rc.local", Path: path, Executable: path, Owner: "root", State: state})
+	}
+}
+
+// initScripts lists SysV init scripts, enabled when a start link in a
+// multi-user runlevel points at them.
+func (c *persistenceCollector) initScripts() {
+	started := map[string]bool{}
+	for _, runlevel := range []string{"2", "3", "4", "5"} {
+		for _, base := range []string{"etc", "etc/rc.d"} {
+			entries, _ := os.ReadDir(filepath.Join(persistenceRoot, base, "rc"+runlevel+".d"))
+			for _, e := range entries {
+				if name := e.Name(); len(name) > 3 && name[0] == 'S' {
+					started[name[3:]] = true
+				}
+			}
+		}
+	}
+	for _, dir := range []string{"etc/init.d", "etc/rc.d/init.d"} {
+		for _, e := range c.readDir(dir) {
+			if e.IsDir() || e.Name() == "README" || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			state := "disabled"
+			if started[e.Name()] {
+				state = "enabled"
+			}
+			path := "/" + filepath.Join(dir, e.Name())
+			c.items = append(c.items, PersistenceItem{Kind: "init.d", Name: e.Name(), Path: path, Executable: path, Owner: "root", State: state})
+		}
+	}
+}
+
+// shellProfiles lists the startup files login and interactive shells
+// source, system wide and in each home directory.
+func (c *persistenceCollector) shellProfiles(homes []home) {
+	add := func(rel, owner string) {
+		info, err := os.Stat(filepath.Join(persistenceRoot, rel))
+		if err != nil || !info.Mode().IsRegular() {
+			c.note(err)
+			return
+		}
+		path := "/" + rel
+		c.items = append(c.items, PersistenceItem{Kind: "profile", Name: filepath.Base(rel), Path: path, Executable: path, Owner: owner, State: "enabled"})
+	}
+	for _, rel := range systemShellProfiles {
+		add(rel, "")
+	}
+	for _, e := range c.readDir("etc/profile.d") {
+		if strings.HasSuffix(e.Name(), ".sh") {
+			add(filepath.Join("etc/profile.d", e.Name()), "")
+		}
+	}
+	for _, h := range homes {
+		for _, name := range userShellProfiles {
+			add(filepath.Join(h.dir, name), h.user)
+		}
+	}
+}
+
+// cronJobs lists the jobs of the system crontabs, which name the user to
+// run as, of the per-user crontabs, and the scripts run-parts runs from
+// the periodic directories.
+func (c *persistenceCollector) cronJobs() {
+	c.crontab("etc/crontab", "")
+	for _, e := range c.readDir("etc/cron.d") {
+		if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			c.crontab(filepath.Join("etc/cron.d", e.Name()), "")
+		}
+	}
+	for _, dir := range userCrontabDirs {
+		for _, e := range c.readDir(dir) {
+			if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+				c.crontab(filepath.Join(dir, e.Name()), e.Name())
+			}
+		}
+	}
+	for _, period := range cronPeriodDirs {
+		for _, e := range c.readDir(period.dir) {
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			path := "/" + filepath.Join(period.dir, e.Name())
+			c.items = append(c.items, PersistenceItem{Kind: "cron", Name: e.Name(), Path: path, Executable: path, Owner: "root", State: "enabled", Schedule: period.schedule})
+		}
+	}
+}
+
+var cronVariable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*\s*=`)
+
+// crontab reads the jobs of a crontab. System crontabs have a user field
+// after the schedule; a user's crontab is passed the user as owner.
+func (c *persistenceCollector) crontab(rel, owner string) {
+	data, err := os.ReadFile(filepath.Join(persistenceRoot, rel))
+	if err != nil {
+		c.note(err)
+		return
+	}
+	for _, line := range parseCronLines(data) {
+		if cronVariable.MatchString(line) {
+			continue
+		}
+		schedule, command, ok := splitCronSchedule(line)
+		if !ok {
+			continue
+		}
+		item := PersistenceItem{Kind: "cron", Name: filepath.Base(rel), Path: "/" + rel, Owner: owner, State: "enabled", Schedule: schedule}
+		if owner == "" {
+			user, rest, _ := strings.Cut(command, " ")
+			item.Owner, command = user, rest
+		}
+		c.items = append(c.items, commandItem(item, command))
+	}
+}
+
+func splitCronSchedule(line string) (string, string, bool) {
+	fields := strings.Fields(line)
+	n := 5
+	if strings.HasPrefix(line, "@") {
+		n = 1
+	}
+	if len(fields) <= n {
+		return "", "", false
+	}
+	return strings.Join(fields[:n], " "), strings.Join(fields[n:], " "), true
+}
+
+// launchd reads the launchd jobs of a directory. Property lists in the
+// binary format are listed without their contents.
+func (c *persistenceCollector) launchd(dir, owner string) {
+	for _, e := range c.readDir(dir) {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".plist") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(persistenceRoot, dir, e.Name()))
+		if err != nil {
+			c.note(err)
+			continue
+		}
+		item := PersistenceItem{Kind: "launchd", Name: strings.TrimSuffix(e.Name(), ".plist"), Path: "/" + filepath.Join(dir, e.Name()), Owner: owner, State: "enabled"}
+		job := parsePlistDict(data)
+		if label, ok := job["Label"].(string); ok && label != "" {
+			item.Name = label
+		}
+		if user, ok := job["UserName"].(string); ok && user != "" {
+			item.Owner = user
+		}
+		if disabled, ok := job["Disabled"].(bool); ok && disabled {
+			item.State = "disabled"
+		}
+		args, _ := job["ProgramArguments"].([]interface{})
+		for _, arg := range args {
+			if s, ok := arg.(string); ok {
+				item.Arguments = append(item.Arguments, s)
+			}
+		}
+		if program, ok := job["Program"].(string); ok && program != "" {
+			item.Executable = program
+			if len(item.Arguments) > 0 {
+				item.Arguments = item.Arguments[1:]
+			}
+		} else if len(item.Arguments) > 0 {
+			item.Executable, item.Arguments = item.Arguments[0], item.Arguments[1:]
+		}
+		if len(item.Arguments) == 0 {
+			item.Arguments = nil
+		}
+		if _, ok := job["StartInterval"]; ok {
+			item.Schedule = "StartInterval"
+		} else if _, ok := job["StartCalendarInterval"]; ok {
+			item.Schedule = "StartCalendarInterval"
+		}
+		c.items = append(c.items, item)
+	}
+}
+
+// parsePlistDict decodes the top level dictionary of an XML property list
+// into strings, booleans, arrays and nested dictionaries. Other values,
+// and property lists it cannot read, decode to nothing.
+func parsePlistDict(data []byte) map[string]interface{} {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "dict" {
+			dict, _ := plistValue(d, start).(map[string]interface{})
+			return dict
+		}
+	}
+}
+
+func plistValue(d *xml.Decoder, start xml.StartElement) interface{} {
+	switch start.Name.Local {
+	case "dict":
+		dict := map[string]interface{}{}
+		var key string
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return dict
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					var k string
+					_ = d.DecodeElement(&k, &t)
+					key = k
+					continue
+				}
+				dict[key] = plistValue(d, t)
+			case xml.EndElement:
+				return dict
+			}
+		}
+	case "array":
+		var array []interface{}
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return array
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				array = append(array, plistValue(d, t))
+			case xml.EndElement:
+				return array
+			}
+		}
+	case "true", "false":
+		_ = d.Skip()
+		return start.Name.Local == "true"
+	default:
+		var s string
+		_ = d.DecodeElement(&s, &start)
+		if start.Name.Local == "string" {
+			return s
+		}
+		return nil
+	}
+}
@@ -0,0 +1,173 @@
+//go:build !windows
+// +build !windows
+
+package systeminfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func usePersistenceRoot(t *testing.T, root string) {
+	t.Helper()
+	origRoot, origUsers := persistenceRoot, usersFilePath
+	t.Cleanup(func() {
+		persistenceRoot, usersFilePath = origRoot, origUsers
+	})
+	persistenceRoot = root
+	usersFilePath = filepath.Join(root, "etc/passwd")
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(link), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGatherLinuxPersistence(t *testing.T) {
+	root := t.TempDir()
+	script := "#!/bin/sh\necho backup\n"
+	digest := sha256Hex(script)
+	writeFixture(t, root, "usr/local/bin/backup", script)
+	writeFixture(t, root, "etc/passwd", "root:x:0:0:root:/root:/bin/bash\nalice:x:1000:1000::/home/alice:/bin/bash\n")
+
+	// backup.service is overridden by a drop-in and enabled, the timer runs
+	// it, a vendor unit is masked in /etc and another is only an alias.
+	writeFixture(t, root, "usr/lib/systemd/system/backup.service", "[Service]\nExecStart=/usr/bin/true\n\n[Install]\nWantedBy=multi-user.target\n")
+	writeFixture(t, root, "etc/systemd/system/backup.service.d/override.conf", "[Service]\nExecStart=\nExecStart=-/usr/local/bin/backup --full \"/srv/my data\"\nUser=backup\n")
+	symlink(t, "/usr/lib/systemd/system/backup.service", filepath.Join(root, "etc/systemd/system/multi-user.target.wants/backup.service"))
+	writeFixture(t, root, "usr/lib/systemd/system/backup.timer", "[Timer]\nOnCalendar=daily\nOnBootSec=15min\n\n[Install]\nWantedBy=timers.target\n")
+	writeFixture(t, root, "usr/lib/systemd/system/cups.service", "[Service]\nExecStart=/usr/sbin/cupsd -l\n")
+	symlink(t, "/dev/null", filepath.Join(root, "etc/systemd/system/cups.service"))
+	symlink(t, "/usr/lib/systemd/system/backup.service", filepath.Join(root, "etc/systemd/system/nightly.service"))
+	writeFixture(t, root, "usr/lib/systemd/system/idle.service", "[Service]\nExecStart=backup\n\n[Install]\nWantedBy=multi-user.target\n")
+	writeFixture(t, root, "home/alice/.config/systemd/user/miner.service", "[Service]\nExecStart=/home/alice/.cache/miner\n")
+
+	writeFixture(t, root, "etc/xdg/autostart/tracker.desktop", "[Desktop Entry]\nName=Tracker\nExec=tracker daemon %U\nHidden=true\n")
+	writeFixture(t, root, "home/alice/.config/autostart/sync.desktop", "[Desktop Entry]\nExec=/opt/sync/sync --tray %f\n")
+	writeFixture(t, root, "etc/rc.local", "#!/bin/sh\n/usr/local/bin/backup\n")
+	if err := os.Chmod(filepath.Join(root, "etc/rc.local"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFixture(t, root, "etc/init.d/legacy", "#!/bin/sh\n")
+	symlink(t, "../init.d/legacy", filepath.Join(root, "etc/rc2.d/S01legacy"))
+	writeFixture(t, root, "etc/profile.d/proxy.sh", "export http_proxy=http://proxy:3128\n")
+	writeFixture(t, root, "home/alice/.bashrc", "alias ls='ls --color'\n")
+	writeFixture(t, root, "etc/crontab", "SHELL=/bin/sh\n# m h dom mon dow user command\n17 * * * * root cd / && run-parts --report /etc/cron.hourly\n")
+	writeFixture(t, root, "var/spool/cron/crontabs/alice", "@reboot /home/alice/.cache/miner --quiet\n")
+	writeFixture(t, root, "etc/cron.daily/logrotate", "#!/bin/sh\n")
+	usePersistenceRoot(t, root)
+
+	items, err := gatherLinuxPersistence()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	want := []PersistenceItem{
+		{Kind: "systemd-service", Name: "backup.service", Path: "/usr/lib/systemd/system/backup.service", Executable: "/usr/local/bin/backup", Arguments: []string{"--full", "/srv/my data"}, Owner: "backup", State: "enabled", SHA256: digest},
+		{Kind: "systemd-timer", Name: "backup.timer", Path: "/usr/lib/systemd/system/backup.timer", Executable: "/usr/local/bin/backup", Arguments: []string{"--full", "/srv/my data"}, Owner: "backup", State: "disabled", Schedule: "OnCalendar=daily; OnBootSec=15min", SHA256: digest},
+		{Kind: "systemd-service", Name: "cups.service", Path: "/etc/systemd/system/cups.service", State: "masked"},
+		{Kind: "systemd-service", Name: "idle.service", Path: "/usr/lib/systemd/system/idle.service", Executable: "/usr/local/bin/backup", Owner: "root", State: "disabled", SHA256: digest},
+		{Kind: "systemd-service", Name: "miner.service", Path: "/home/alice/.config/systemd/user/miner.service", Executable: "/home/alice/.cache/miner", Owner: "alice", State: "static"},
+		{Kind: "autostart", Name: "tracker.desktop", Path: "/etc/xdg/autostart/tracker.desktop", Executable: "tracker", Arguments: []string{"daemon"}, State: "disabled"},
+		{Kind: "autostart", Name: "sync.desktop", Path: "/home/alice/.config/autostart/sync.desktop", Executable: "/opt/sync/sync", Arguments: []string{"--tray"}, Owner: "alice", State: "enabled"},
+		{Kind: "rc.local", Name: "rc.local", Path: "/etc/rc.local", Executable: "/etc/rc.local", Owner: "root", State: "enabled", SHA256: sha256Hex("#!/bin/sh\n/usr/local/bin/backup\n")},
+		{Kind: "init.d", Name: "legacy", Path: "/etc/init.d/legacy", Executable: "/etc/init.d/legacy", Owner: "root", State: "enabled", SHA256: sha256Hex("#!/bin/sh\n")},
+		{Kind: "profile", Name: "proxy.sh", Path: "/etc/profile.d/proxy.sh", Executable: "/etc/profile.d/proxy.sh", State: "enabled", SHA256: sha256Hex("export http_proxy=http://proxy:3128\n")},
+		{Kind: "profile", Name: ".bashrc", Path: "/home/alice/.bashrc", Executable: "/home/alice/.bashrc", Owner: "alice", State: "enabled", SHA256: sha256Hex("alias ls='ls --color'\n")},
+		{Kind: "cron", Name: "crontab", Path: "/etc/crontab", Executable: "cd", Arguments: []string{"/", "&&", "run-parts", "--report", "/etc/cron.hourly"}, Owner: "root", State: "enabled", Schedule: "17 * * * *"},
+		{Kind: "cron", Name: "alice", Path: "/var/spool/cron/crontabs/alice", Executable: "/home/alice/.cache/miner", Arguments: []string{"--quiet"}, Owner: "alice", State: "enabled", Schedule: "@reboot"},
+		{Kind: "cron", Name: "logrotate", Path: "/etc/cron.daily/logrotate", Executable: "/etc/cron.daily/logrotate", Owner: "root", State: "enabled", Schedule: "@daily", SHA256: sha256Hex("#!/bin/sh\n")},
+	}
+	if !reflect.DeepEqual(items, want) {
+		for i := range max(len(items), len(want)) {
+			if i >= len(items) || i >= len(want) || !reflect.DeepEqual(items[i], want[i]) {
+				var got, exp PersistenceItem
+				if i < len(items) {
+					got = items[i]
+				}
+				if i < len(want) {
+					exp = want[i]
+				}
+				t.Errorf("item %d:\n got %+v\nwant %+v", i, got, exp)
+			}
+		}
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	cases := map[string][]string{
+		`/usr/bin/app --flag value`:           {"/usr/bin/app", "--flag", "value"},
+		`"/opt/my app/run" 'a b' c\ d`:        {"/opt/my app/run", "a b", "c d"},
+		`/bin/sh -c "echo \"hi\" > /tmp/out"`: {"/bin/sh", "-c", `echo "hi" > /tmp/out`},
+		"  /usr/bin/spaced\t arg  ":           {"/usr/bin/spaced", "arg"},
+		`/usr/bin/empty ""`:                   {"/usr/bin/empty", ""},
+	}
+	for line, want := range cases {
+		if got := splitCommandLine(line); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitCommandLine(%q) = %q, want %q", line, got, want)
+		}
+	}
+	if got := execCommand("@/usr/bin/daemon daemon-name --foreground"); got != "/usr/bin/daemon --foreground" {
+		t.Errorf("execCommand with @ = %q", got)
+	}
+}
+
+func TestGatherDarwinPersistence(t *testing.T) {
+	root := t.TempDir()
+	writeFixture(t, root, "Library/LaunchDaemons/com.example.agent.plist", `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>com.example.agent</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>/usr/local/bin/agent</string>
+		<string>--daemon</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>StartCalendarInterval</key>
+	<dict>
+		<key>Hour</key>
+		<integer>3</integer>
+	</dict>
+</dict>
+</plist>
+`)
+	writeFixture(t, root, "Users/alice/Library/LaunchAgents/com.example.updater.plist", `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>Label</key><string>com.example.updater</string>
+	<key>Program</key><string>/Users/alice/Library/updater</string>
+	<key>Disabled</key><true/>
+</dict>
+</plist>
+`)
+	usePersistenceRoot(t, root)
+
+	items, err := gatherDarwinPersistence()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	want := []PersistenceItem{
+		{Kind: "launchd", Name: "com.example.agent", Path: "/Library/LaunchDaemons/com.example.agent.plist", Executable: "/usr/local/bin/agent", Arguments: []string{"--daemon"}, Owner: "root", State: "enabled", Schedule: "StartCalendarInterval"},
+		{Kind: "launchd", Name: "com.example.updater", Path: "/Users/alice/Library/LaunchAgents/com.example.updater.plist", Executable: "/Users/alice/Library/updater", Owner: "alice", State: "disabled"},
+	}
+	if !reflect.DeepEqual(items, want) {
+		t.Fatalf("unexpected items:\n got %+v\nwant %+v", items, want)
+	}
+}
@@ -0,0 +1,143 @@
+//go:build !windows
+// +build !windows
+
+package systeminfo
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// procRoot is where the process filesystem is mounted.
+var procRoot = "/proc"
+
+// containerIDPattern matches the 64 hex digit IDs Docker, containerd,
+// CRI-O and Podman put in the cgroup paths of container processes.
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// gatherProcessDetails reads the open files, executable mappings,
+// environment, working directory and cgroup of a process from /proc, falling
+// back to gopsutil where there is no /proc, as on macOS.
+func gatherProcessDetails(p *process.Process, info *ProcessInfo) {
+	dir := filepath.Join(procRoot, strconv.Itoa(int(info.PID)))
+	if _, err := os.Stat(dir); err != nil {
+		gatherPortableProcessDetails(p, info)
+		return
+	}
+	info.OpenFiles = readProcFDs(dir)
+	info.MappedLibraries = readProcMaps(dir, info.Exe)
+	info.Environment = readProcEnviron(dir)
+	if cwd, err := os.Readlink(filepath.Join(dir, "cwd")); err == nil {
+		info.Cwd = cwd
+	}
+	info.Cgroup, info.ContainerID = readProcCgroup(dir)
+}
+
+// executableSource returns the file to hash for the executable of a process
+// and the key its digest is remembered under. Where there is /proc it is
+// /proc/<pid>/exe, which opens the file the process runs even when it lives
+// in another mount namespace, such as a container, or has been deleted; it
+// is keyed by device and inode so a binary shared by many processes is read
+// once. Elsewhere it is the executable path.
+func executableSource(pid int32, exe string) (path, key string) {
+	link := filepath.Join(procRoot, strconv.Itoa(int(pid)), "exe")
+	info, err := os.Stat(link)
+	if err != nil {
+		return exe, exe
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return link, fmt.Sprintf("inode:%d:%d:%d", st.Dev, st.Ino, info.ModTime().UnixNano())
+	}
+	return link, link
+}
+
+// readProcFDs resolves the file descriptor links of a process, keeping
+// files and devices. Sockets, pipes and anonymous inodes have no path.
+func readProcFDs(dir string) []string {
+	entries, err := os.ReadDir(filepath.Join(dir, "fd"))
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(dir, "fd", entry.Name()))
+		if err == nil && strings.HasPrefix(target, "/") {
+			files = append(files, target)
+		}
+	}
+	return sortedUnique(files)
+}
+
+// readProcMaps lists the files a process maps executable, other than exe.
+// A " (deleted)" suffix is kept, since code running from a removed file is
+// worth a look.
+func readProcMaps(dir, exe string) []string {
+	f, err := os.Open(filepath.Join(dir, "maps"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var libs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// address perms offset dev inode path, where the path may hold spaces.
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || !strings.Contains(fields[1], "x") {
+			continue
+		}
+		path := strings.Join(fields[5:], " ")
+		if strings.HasPrefix(path, "/") && path != exe {
+			libs = append(libs, path)
+		}
+	}
+	return sortedUnique(libs)
+}
+
+func readProcEnviron(dir string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, "environ"))
+	if err != nil {
+		return nil
+	}
+	var environ []string
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		if len(entry) > 0 {
+			environ = append(environ, string(entry))
+		}
+	}
+	return environ
+}
+
+// readProcCgroup returns the unified cgroup path of a process, or its first
+// cgroup v1 path, and the container ID found in any of them.
+func readProcCgroup(dir string) (string, string) {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup"))
+	if err != nil {
+		return "", ""
+	}
+	var cgroup, containerID string
+	for _, line := range strings.Split(string(data), "\n") {
+		// hierarchy-ID:controllers:path, with hierarchy 0 for cgroup v2.
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 || parts[2] == "" {
+			continue
+		}
+		if parts[0] == "0" || cgroup == "" {
+			cgroup = parts[2]
+		}
+		if containerID == "" {
+			if ids := containerIDPattern.FindAllString(parts[2], -1); len(ids) > 0 {
+				containerID = ids[len(ids)-1]
+			}
+		}
+	}
+	return cgroup, containerID
+}
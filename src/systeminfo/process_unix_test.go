@@ -0,0 +1,111 @@
+//go:build !windows
+// +build !windows
+
+package systeminfo
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGatherProcessDetailsFromProc(t *testing.T) {
+	root := t.TempDir()
+	origRoot := procRoot
+	t.Cleanup(func() { procRoot = origRoot })
+	procRoot = root
+
+	const id = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	dir := filepath.Join(root, "4242")
+	writeFixture(t, root, "srv/app/data.db", "")
+	symlink(t, filepath.Join(root, "srv/app/data.db"), filepath.Join(dir, "fd/3"))
+	symlink(t, "socket:[81234]", filepath.Join(dir, "fd/4"))
+	symlink(t, "/dev/null", filepath.Join(dir, "fd/0"))
+	symlink(t, "/srv/app", filepath.Join(dir, "cwd"))
+	writeFixture(t, dir, "maps", `55d0c0a00000-55d0c0a21000 r-xp 00002000 fd:01 1311 /usr/bin/app
+7f2a3c000000-7f2a3c1b6000 r-xp 00028000 fd:01 2632 /usr/lib/x86_64-linux-gnu/libc.so.6
+7f2a3c1b6000-7f2a3c20e000 r--p 001be000 fd:01 2632 /usr/lib/x86_64-linux-gnu/libc.so.6
+7f2a3c300000-7f2a3c301000 r-xp 00000000 00:01 7 /memfd:payload (deleted)
+7f2a3c400000-7f2a3c421000 rw-p 00000000 00:00 0 [heap]
+7ffd1e5f2000-7ffd1e5f4000 r-xp 00000000 00:00 0 [vdso]
+`)
+	writeFixture(t, dir, "environ", "PATH=/usr/bin\x00HOME=/srv/app\x00")
+	writeFixture(t, dir, "cgroup", "12:pids:/docker/"+id+"\n0::/system.slice/docker-"+id+".scope\n")
+
+	info := ProcessInfo{PID: 4242, Exe: "/usr/bin/app"}
+	gatherProcessDetails(nil, &info)
+	want := ProcessInfo{
+		PID:             4242,
+		Exe:             "/usr/bin/app",
+		Cwd:             "/srv/app",
+		OpenFiles:       []string{"/dev/null", filepath.Join(root, "srv/app/data.db")},
+		MappedLibraries: []string{"/memfd:payload (deleted)", "/usr/lib/x86_64-linux-gnu/libc.so.6"},
+		Environment:     []string{"PATH=/usr/bin", "HOME=/srv/app"},
+		Cgroup:          "/system.slice/docker-" + id + ".scope",
+		ContainerID:     id,
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("unexpected details:\n got %+v\nwant %+v", info, want)
+	}
+}
+
+func TestReadProcCgroupOutsideContainer(t *testing.T) {
+	dir := t.TempDir()
+	writeFixture(t, dir, "cgroup", "0::/user.slice/user-1000.slice/session-2.scope\n")
+	cgroup, id := readProcCgroup(dir)
+	if cgroup != "/user.slice/user-1000.slice/session-2.scope" || id != "" {
+		t.Fatalf("readProcCgroup = %q, %q", cgroup, id)
+	}
+}
+
+func TestExecutableSourcePrefersProcExe(t *testing.T) {
+	root := t.TempDir()
+	origRoot := procRoot
+	t.Cleanup(func() { procRoot = origRoot })
+	procRoot = root
+
+	binary := writeFixture(t, root, "ns/usr/bin/app", "container binary")
+	symlink(t, binary, filepath.Join(root, "4242", "exe"))
+	digests := map[string]string{}
+	path, key := executableSource(4242, "/usr/bin/app")
+	if path != filepath.Join(root, "4242", "exe") || key == "/usr/bin/app" {
+		t.Fatalf("executableSource = %q, %q", path, key)
+	}
+	want := fmt.Sprintf("%x", sha256.Sum256([]byte("container binary")))
+	if got := keyedFileDigest(path, key, digests); got != want {
+		t.Fatalf("digest = %q, want %q", got, want)
+	}
+
+	path, key = executableSource(4343, "/usr/bin/app")
+	if path != "/usr/bin/app" || key != "/usr/bin/app" {
+		t.Fatalf("executableSource without /proc entry = %q, %q", path, key)
+	}
+}
+
+func TestSystemdServicesFromProc(t *testing.T) {
+	root := t.TempDir()
+	origRoot := procRoot
+	t.Cleanup(func() { procRoot = origRoot })
+	procRoot = root
+
+	writeFixture(t, root, "1/cgroup", "0::/init.scope\n")
+	writeFixture(t, root, "310/cgroup", "0::/system.slice/nginx.service\n")
+	writeFixture(t, root, "311/cgroup", "0::/system.slice/nginx.service\n")
+	writeFixture(t, root, "420/cgroup", "0::/system.slice/docker.service/payload\n")
+	writeFixture(t, root, "900/cgroup", "0::/user.slice/user-1000.slice/user@1000.service/app.slice/sync.service\n")
+	writeFixture(t, root, "901/cgroup", "0::/user.slice/user-1000.slice/session-2.scope\n")
+	writeFixture(t, root, "950/cgroup", "12:cpuset:/\n1:name=systemd:/system.slice/cron.service\n0::/\n")
+	writeFixture(t, root, "self/cgroup", "0::/system.slice/ignored.service\n")
+
+	want := []ServiceInfo{
+		{Name: "cron.service", Status: "running"},
+		{Name: "docker.service", Status: "running"},
+		{Name: "nginx.service", Status: "running"},
+		{Name: "sync.service", Status: "running"},
+	}
+	if got := systemdServicesFromProc(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("services = %+v, want %+v", got, want)
+	}
+}
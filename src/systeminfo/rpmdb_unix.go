@@ -0,0 +1,311 @@
+//go:build !windows
+// +build !windows
+
+package systeminfo
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// readRPMDatabase reads the first RPM database found: SQLite on current
+// Fedora and RHEL, Berkeley DB on older releases and NDB on SUSE.
+func readRPMDatabase(root string) ([]PackageInfo, error) {
+	for _, db := range []struct {
+		path string
+		read func(string) ([][]byte, error)
+	}{
+		{"var/lib/rpm/rpmdb.sqlite", readRPMSQLite},
+		{"usr/lib/sysimage/rpm/rpmdb.sqlite", readRPMSQLite},
+		{"var/lib/rpm/Packages", readRPMBerkeleyDB},
+		{"usr/lib/sysimage/rpm/Packages.db", readRPMNDB},
+		{"var/lib/rpm/Packages.db", readRPMNDB},
+	} {
+		path := filepath.Join(root, db.path)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		blobs, err := db.read(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		var packages []PackageInfo
+		for _, blob := range blobs {
+			pkg, ok := parseRPMHeader(blob)
+			// gpg-pubkey entries are imported signing keys, not software.
+			if ok && pkg.Name != "gpg-pubkey" {
+				packages = append(packages, pkg)
+			}
+		}
+		return packages, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+// openSQLiteReadOnly opens a database another program owns without
+// creating, locking for write or recovering it.
+func openSQLiteReadOnly(path string) (*sql.DB, error) {
+	uri := url.URL{Scheme: "file", Opaque: (&url.URL{Path: path}).EscapedPath(), RawQuery: "mode=ro"}
+	return sql.Open("sqlite", uri.String())
+}
+
+func readRPMSQLite(path string) ([][]byte, error) {
+	db, err := openSQLiteReadOnly(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT blob FROM Packages")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var blobs [][]byte
+	for rows.Next() {
+		var blob []byte
+		if err := rows.Scan(&blob); err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, rows.Err()
+}
+
+// Berkeley DB hash database layout, as used by rpm before 4.16.
+const (
+	bdbHashMagic        = 0x061561
+	bdbPageHeaderSize   = 26
+	bdbPageTypeHash     = 13
+	bdbPageTypeUnsorted = 2
+	bdbPageTypeOverflow = 7
+	bdbItemKeyData      = 1
+	bdbItemOffPage      = 3
+)
+
+// readRPMBerkeleyDB returns the values of an rpm Berkeley DB hash database.
+// Headers are stored as values, usually on chains of overflow pages.
+func readRPMBerkeleyDB(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 512 {
+		return nil, errors.New("not a Berkeley DB file")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if order.Uint32(data[12:]) != bdbHashMagic {
+		order = binary.BigEndian
+		if order.Uint32(data[12:]) != bdbHashMagic {
+			return nil, errors.New("not a Berkeley DB hash database")
+		}
+	}
+	if data[24] != 0 {
+		return nil, errors.New("encrypted Berkeley DB databases are not supported")
+	}
+	pageSize := int(order.Uint32(data[20:]))
+	if pageSize < 512 || pageSize > 64*1024 {
+		return nil, fmt.Errorf("unexpected page size %d", pageSize)
+	}
+	page := func(n uint32) []byte {
+		start := int(n) * pageSize
+		if n == 0 || start+pageSize > len(data) {
+			return nil
+		}
+		return data[start : start+pageSize]
+	}
+
+	var values [][]byte
+	for n := 1; n*pageSize+pageSize <= len(data); n++ {
+		p := data[n*pageSize : (n+1)*pageSize]
+		if p[25] != bdbPageTypeHash && p[25] != bdbPageTypeUnsorted {
+			continue
+		}
+		entries := int(order.Uint16(p[20:]))
+		if bdbPageHeaderSize+2*entries > pageSize {
+			continue
+		}
+		offsets := make([]int, entries)
+		for i := range offsets {
+			offsets[i] = int(order.Uint16(p[bdbPageHeaderSize+2*i:]))
+		}
+		// Keys and values alternate; items fill the page from its end.
+		for i := 1; i < entries; i += 2 {
+			offset := offsets[i]
+			if offset >= pageSize {
+				continue
+			}
+			switch p[offset] {
+			case bdbItemOffPage:
+				if offset+12 > pageSize {
+					continue
+				}
+				value, err := bdbOverflow(page, order, order.Uint32(p[offset+4:]), int(order.Uint32(p[offset+8:])), len(data)/pageSize)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, value)
+			case bdbItemKeyData:
+				if end := offsets[i-1]; end > offset+1 && end <= pageSize {
+					values = append(values, p[offset+1:end])
+				}
+			}
+		}
+	}
+	return values, nil
+}
+
+func bdbOverflow(page func(uint32) []byte, order binary.ByteOrder, n uint32, length, pages int) ([]byte, error) {
+	value := make([]byte, 0, length)
+	for seen := 0; n != 0; seen++ {
+		p := page(n)
+		if p == nil || p[25] != bdbPageTypeOverflow || seen > pages {
+			return nil, fmt.Errorf("broken overflow chain at page %d", n)
+		}
+		used := int(order.Uint16(p[22:]))
+		if bdbPageHeaderSize+used > len(p) {
+			return nil, fmt.Errorf("broken overflow page %d", n)
+		}
+		value = append(value, p[bdbPageHeaderSize:bdbPageHeaderSize+used]...)
+		n = order.Uint32(p[16:])
+	}
+	if len(value) != length {
+		return nil, fmt.Errorf("overflow value is %d bytes, expected %d", len(value), length)
+	}
+	return value, nil
+}
+
+// NDB layout, as used by rpm on SUSE: a header, an array of slots locating
+// each package's blob, and the blobs in 16 byte blocks.
+const (
+	ndbHeaderMagic  = 'R' | 'p'<<8 | 'm'<<16 | 'P'<<24
+	ndbSlotMagic    = 'S' | 'l'<<8 | 'o'<<16 | 't'<<24
+	ndbBlobMagic    = 'B' | 'l'<<8 | 'b'<<16 | 'S'<<24
+	ndbBlockSize    = 16
+	ndbSlotsPerPage = 4096 / 16
+)
+
+func readRPMNDB(path string) ([][]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	if len(data) < 32 || le.Uint32(data) != ndbHeaderMagic {
+		return nil, errors.New("not an rpm NDB database")
+	}
+	// The header takes the place of the first two slots.
+	slots := int(le.Uint32(data[12:]))*ndbSlotsPerPage - 2
+	var blobs [][]byte
+	for i := 0; i < slots; i++ {
+		slot := 32 + 16*i
+		if slot+16 > len(data) {
+			break
+		}
+		if le.Uint32(data[slot:]) != ndbSlotMagic {
+			return nil, fmt.Errorf("bad slot %d", i)
+		}
+		index := le.Uint32(data[slot+4:])
+		if index == 0 {
+			continue
+		}
+		start := int(le.Uint32(data[slot+8:])) * ndbBlockSize
+		if start+16 > len(data) || le.Uint32(data[start:]) != ndbBlobMagic || le.Uint32(data[start+4:]) != index {
+			return nil, fmt.Errorf("bad blob for package %d", index)
+		}
+		length := int(le.Uint32(data[start+12:]))
+		if start+16+length > len(data) {
+			return nil, fmt.Errorf("truncated blob for package %d", index)
+		}
+		blobs = append(blobs, data[start+16:start+16+length])
+	}
+	return blobs, nil
+}
+
+// RPM header tags and types used to describe a package.
+const (
+	rpmTagName        = 1000
+	rpmTagVersion     = 1001
+	rpmTagRelease     = 1002
+	rpmTagEpoch       = 1003
+	rpmTagInstallTime = 1008
+	rpmTagArch        = 1022
+
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// parseRPMHeader reads a header blob as rpm stores it: the index and data
+// lengths, the index entries, then the data they point into, all big-endian.
+func parseRPMHeader(blob []byte) (PackageInfo, bool) {
+	be := binary.BigEndian
+	if len(blob) < 8 {
+		return PackageInfo{}, false
+	}
+	entries, size := int(be.Uint32(blob)), int(be.Uint32(blob[4:]))
+	if entries < 1 || entries > 0xffff || size < 0 || 8+16*entries+size > len(blob) {
+		return PackageInfo{}, false
+	}
+	store := blob[8+16*entries : 8+16*entries+size]
+	pkg := PackageInfo{Source: "rpm"}
+	var version, release string
+	epoch := -1
+	for i := 0; i < entries; i++ {
+		entry := blob[8+16*i:]
+		tag, kind, offset := be.Uint32(entry), be.Uint32(entry[4:]), int(be.Uint32(entry[8:]))
+		if offset < 0 || offset >= len(store) {
+			continue
+		}
+		switch kind {
+		case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+			value := store[offset:]
+			if end := bytes.IndexByte(value, 0); end >= 0 {
+				value = value[:end]
+			}
+			switch tag {
+			case rpmTagName:
+				pkg.Name = string(value)
+			case rpmTagVersion:
+				version = string(value)
+			case rpmTagRelease:
+				release = string(value)
+			case rpmTagArch:
+				pkg.Architecture = string(value)
+			}
+		case rpmTypeInt32:
+			if offset+4 > len(store) {
+				continue
+			}
+			value := be.Uint32(store[offset:])
+			switch tag {
+			case rpmTagEpoch:
+				epoch = int(value)
+			case rpmTagInstallTime:
+				pkg.InstallTime = formatTimestamp(time.Unix(int64(value), 0))
+			}
+		}
+	}
+	if pkg.Name == "" {
+		return PackageInfo{}, false
+	}
+	pkg.Version = version
+	if release != "" {
+		pkg.Version += "-" + release
+	}
+	if epoch >= 0 {
+		pkg.Version = strconv.Itoa(epoch) + ":" + pkg.Version
+	}
+	return pkg, true
+}
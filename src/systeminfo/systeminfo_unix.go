@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"time"
@@ -41,6 +42,8 @@ var (
 	}
 )
 
+var softwareUpdateColumns = regexp.MustCompile(`\s{2,}`)
+
 const trustedCommandPath = "/usr/sbin:/usr/bin:/sbin:/bin:/usr/local/bin:/opt/homebrew/bin"
 
 func gatherOSVersion(sysInfo *SystemInfo) error {
@@ -81,119 +84,95 @@ func gatherOSVersion(sysInfo *SystemInfo) error {
 func gatherInstalledPatches(sysInfo *SystemInfo) error {
 	switch runtime.GOOS {
 	case "linux":
-		if out, err := runCommandOutput("dpkg-query", "-f", "${Package}\n", "-W"); err == nil {
-			for _, line := range strings.Split(string(out), "\n") {
-				line = strings.TrimSpace(line)
-				if line != "" {
-					sysInfo.InstalledPatches = append(sysInfo.InstalledPatches, line)
-				}
-			}
-			return nil
-		}
-		if out, err := runCommandOutput("rpm", "-qa", "--qf", "%{NAME}\n"); err == nil {
-			for _, line := range strings.Split(string(out), "\n") {
-				line = strings.TrimSpace(line)
-				if line != "" {
-					sysInfo.InstalledPatches = append(sysInfo.InstalledPatches, line)
-				}
-			}
-		}
+		updates, err := gatherLinuxPackages(linuxUpdateLogs)
+		sysInfo.InstalledPatches = append(sysInfo.InstalledPatches, updates...)
+		return err
 	case "darwin":
 		if out, err := runCommandOutput("softwareupdate", "--history"); err == nil {
-			scanner := bufio.NewScanner(bytes.NewReader(out))
-			for scanner.Scan() {
-				line := strings.TrimSpace(scanner.Text())
-				if line != "" && !strings.HasPrefix(line, "Software Update Tool") {
-					sysInfo.InstalledPatches = append(sysInfo.InstalledPatches, line)
-				}
-			}
+			sysInfo.InstalledPatches = append(sysInfo.InstalledPatches, parseSoftwareUpdateHistory(out)...)
 		}
 	}
 	return nil
 }
 
 func gatherStartupPrograms(sysInfo *SystemInfo) error {
+	var items []PersistenceItem
+	var err error
 	switch runtime.GOOS {
 	case "linux":
-		dirs := []string{"/etc/init.d", "/etc/rc.d", "/etc/cron.d", "/etc/cron.daily", "/etc/cron.weekly", "/etc/cron.monthly"}
-		for _, d := range dirs {
-			entries, err := os.ReadDir(d)
-			if err != nil {
-				continue
-			}
-			for _, e := range entries {
-				sysInfo.StartupPrograms = append(sysInfo.StartupPrograms, e.Name())
-			}
-		}
+		items, err = gatherLinuxPersistence()
 	case "darwin":
-		dirs := []string{"/Library/LaunchAgents", "/Library/LaunchDaemons", filepath.Join(os.Getenv("HOME"), "Library", "LaunchAgents")}
-		for _, d := range dirs {
-			entries, err := os.ReadDir(d)
-			if err != nil {
-				continue
-			}
-			for _, e := range entries {
-				sysInfo.StartupPrograms = append(sysInfo.StartupPrograms, e.Name())
-			}
-		}
+		items, err = gatherDarwinPersistence()
 	}
-	return nil
+	sysInfo.StartupPrograms = append(sysInfo.StartupPrograms, items...)
+	return err
 }
 
 func gatherInstalledApps(sysInfo *SystemInfo) error {
 	switch runtime.GOOS {
 	case "linux":
-		if out, err := runCommandOutput("dpkg-query", "-f", "${Package}\n", "-W"); err == nil {
-			for _, line := range strings.Split(string(out), "\n") {
-				line = strings.TrimSpace(line)
-				if line != "" {
-					sysInfo.InstalledApps = append(sysInfo.InstalledApps, line)
-				}
-			}
-			return nil
-		}
-		if out, err := runCommandOutput("rpm", "-qa", "--qf", "%{NAME}\n"); err == nil {
-			for _, line := range strings.Split(string(out), "\n") {
-				line = strings.TrimSpace(line)
-				if line != "" {
-					sysInfo.InstalledApps = append(sysInfo.InstalledApps, line)
-				}
-			}
-		}
+		packages, err := gatherLinuxPackages(linuxPackageSources)
+		sysInfo.InstalledApps = append(sysInfo.InstalledApps, packages...)
+		return err
 	case "darwin":
 		if entries, err := os.ReadDir("/Applications"); err == nil {
 			for _, e := range entries {
 				if strings.HasSuffix(e.Name(), ".app") {
-					sysInfo.InstalledApps = append(sysInfo.InstalledApps, strings.TrimSuffix(e.Name(), ".app"))
+					sysInfo.InstalledApps = append(sysInfo.InstalledApps, PackageInfo{
+						Name:        strings.TrimSuffix(e.Name(), ".app"),
+						Source:      "applications",
+						InstallTime: modTime(filepath.Join("/Applications", e.Name())),
+					})
 				}
 			}
 		}
-		if out, err := runCommandOutput("brew", "list"); err == nil {
+		if out, err := runCommandOutput("brew", "list", "--versions"); err == nil {
 			for _, line := range strings.Split(string(out), "\n") {
-				line = strings.TrimSpace(line)
-				if line != "" {
-					sysInfo.InstalledApps = append(sysInfo.InstalledApps, line)
+				fields := strings.Fields(line)
+				if len(fields) == 0 {
+					continue
 				}
+				// Kegs with several versions installed list them oldest
+				// first.
+				sysInfo.InstalledApps = append(sysInfo.InstalledApps, PackageInfo{
+					Name:    fields[0],
+					Version: fields[len(fields)-1],
+					Source:  "brew",
+				})
 			}
 		}
 	}
 	return nil
 }
 
-func gatherRunningServices(sysInfo *SystemInfo) error {
-	switch runtime.GOOS {
-	case "linux":
-		out, err := runCommandOutput("systemctl", "list-units", "--type", "service", "--state", "running", "--no-legend", "--no-pager")
-		if err != nil {
-			return nil
+// parseSoftwareUpdateHistory reads the table "softwareupdate --history"
+// prints, whose name, version and date columns are separated by runs of
+// spaces.
+func parseSoftwareUpdateHistory(out []byte) []PackageInfo {
+	var updates []PackageInfo
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "Software Update Tool") || strings.HasPrefix(line, "Display Name") || strings.Trim(line, "- ") == "" {
+			continue
 		}
-		scanner := bufio.NewScanner(bytes.NewReader(out))
-		for scanner.Scan() {
-			fields := strings.Fields(scanner.Text())
-			if len(fields) >= 4 {
-				sysInfo.RunningServices = append(sysInfo.RunningServices, ServiceInfo{Name: fields[0], Status: fields[2]})
+		columns := softwareUpdateColumns.Split(line, -1)
+		update := PackageInfo{Name: columns[0], Source: "softwareupdate"}
+		if len(columns) >= 3 {
+			update.Version = columns[1]
+			if t, err := time.ParseInLocation("01/02/2006, 15:04:05", columns[2], time.Local); err == nil {
+				update.InstallTime = formatTimestamp(t)
 			}
 		}
+		updates = append(updates, update)
+	}
+	return updates
+}
+
+func gatherRunningServices(sysInfo *SystemInfo) error {
+	switch runtime.GOOS {
+	case "linux":
+		sysInfo.RunningServices = append(sysInfo.RunningServices, systemdServicesFromProc()...)
 	case "darwin":
 		out, err := runCommandOutput("launchctl", "list")
 		if err != nil {
@@ -218,35 +197,53 @@ func gatherRunningServices(sysInfo *SystemInfo) error {
 	return nil
 }
 
-func gatherUsers(sysInfo *SystemInfo) error {
-	users, err := readColonFile(usersFilePath)
+// systemdServicesFromProc lists the systemd services that have a live
+// process, read from the cgroup paths in /proc rather than from systemctl,
+// which may be missing, replaced or unable to reach the service manager. A
+// process belongs to the deepest .service component of its path, so user
+// services under user@<uid>.service are named for themselves, and a service
+// is running while any of its processes is.
+func systemdServicesFromProc() []ServiceInfo {
+	entries, err := os.ReadDir(procRoot)
 	if err != nil {
-		return err
+		return nil
 	}
-	sysInfo.Users = append(sysInfo.Users, users...)
-	return nil
-}
-
-func gatherGroups(sysInfo *SystemInfo) error {
-	groups, err := readColonFile(groupsFilePath)
-	if err != nil {
-		return err
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() || !isDigits(entry.Name()) {
+			continue
+		}
+		if name := systemdServiceOf(filepath.Join(procRoot, entry.Name(), "cgroup")); name != "" {
+			names = append(names, name)
+		}
 	}
-	sysInfo.Groups = append(sysInfo.Groups, groups...)
-	return nil
+	var services []ServiceInfo
+	for _, name := range sortedUnique(names) {
+		services = append(services, ServiceInfo{Name: name, Status: "running"})
+	}
+	return services
 }
 
-func gatherAdmins(sysInfo *SystemInfo) error {
-	groups, err := readColonFile(groupsFilePath)
+// systemdServiceOf returns the service a process runs under, from its
+// unified cgroup path or, on cgroup v1, its name=systemd hierarchy.
+func systemdServiceOf(cgroupPath string) string {
+	data, err := os.ReadFile(cgroupPath)
 	if err != nil {
-		return err
+		return ""
 	}
-	for _, g := range groups {
-		if g == "sudo" || g == "wheel" || g == "admin" {
-			sysInfo.Admins = append(sysInfo.Admins, g)
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 || (parts[0] != "0" && parts[1] != "name=systemd") {
+			continue
+		}
+		components := strings.Split(parts[2], "/")
+		for i := len(components) - 1; i >= 0; i-- {
+			if strings.HasSuffix(components[i], ".service") {
+				return components[i]
+			}
 		}
 	}
-	return nil
+	return ""
 }
 
 func gatherScheduledTasks(sysInfo *SystemInfo) error {
@@ -326,29 +323,6 @@ func runCommandOutput(name string, args ...string) ([]byte, error) {
 	return cmd.Output()
 }
 
-func readColonFile(path string) ([]string, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	lines := []string{}
-	scanner := bufio.NewScanner(bytes.NewReader(data))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) > 0 && parts[0] != "" {
-			lines = append(lines, parts[0])
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return lines, err
-	}
-	return lines, nil
-}
-
 func parseCronLines(data []byte) []string {
 	lines := []string{}
 	scanner := bufio.NewScanner(bytes.NewReader(data))
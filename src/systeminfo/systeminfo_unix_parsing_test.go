@@ -13,7 +13,7 @@ import (
 	"testing"
 )
 
-func TestReadColonFile(t *testing.T) {
+func TestReadColonRecords(t *testing.T) {
 	tmpDir := t.TempDir()
 	path := filepath.Join(tmpDir, "colon.txt")
 	content := "# comment\n\nroot:x:0:0:root:/root:/bin/bash\nuser1:x:1000:1000::/home/user1:/bin/zsh\ninvalidline\n"
@@ -21,11 +21,15 @@ func TestReadColonFile(t *testing.T) {
 		t.Fatalf("write temp file: %v", err)
 	}
 
-	got, err := readColonFile(path)
+	got, err := readColonRecords(path)
 	if err != nil {
-		t.Fatalf("readColonFile: %v", err)
+		t.Fatalf("readColonRecords: %v", err)
+	}
+	want := [][]string{
+		{"root", "x", "0", "0", "root", "/root", "/bin/bash"},
+		{"user1", "x", "1000", "1000", "", "/home/user1", "/bin/zsh"},
+		{"invalidline"},
 	}
-	want := []string{"root", "user1", "invalidline"}
 	if !reflect.DeepEqual(got, want) {
 		t.Fatalf("unexpected parsed values: got=%v want=%v", got, want)
 	}
@@ -91,48 +95,6 @@ func TestSafeCommandResolvesAgainstTrustedPath(t *testing.T) {
 	}
 }
 
-func TestGatherUsersGroupsAdminsWithInjectedFiles(t *testing.T) {
-	tmpDir := t.TempDir()
-	passwdPath := filepath.Join(tmpDir, "passwd")
-	groupPath := filepath.Join(tmpDir, "group")
-	if err := os.WriteFile(passwdPath, []byte("alice:x:1:1::/home/alice:/bin/sh\nbob:x:2:2::/home/bob:/bin/sh\n"), 0600); err != nil {
-		t.Fatalf("write passwd: %v", err)
-	}
-	if err := os.WriteFile(groupPath, []byte("staff:x:20:\nwheel:x:0:\nadmin:x:80:\n"), 0600); err != nil {
-		t.Fatalf("write group: %v", err)
-	}
-
-	origUsersPath := usersFilePath
-	origGroupsPath := groupsFilePath
-	t.Cleanup(func() {
-		usersFilePath = origUsersPath
-		groupsFilePath = origGroupsPath
-	})
-	usersFilePath = passwdPath
-	groupsFilePath = groupPath
-
-	sys := &SystemInfo{}
-	if err := gatherUsers(sys); err != nil {
-		t.Fatalf("gatherUsers: %v", err)
-	}
-	if err := gatherGroups(sys); err != nil {
-		t.Fatalf("gatherGroups: %v", err)
-	}
-	if err := gatherAdmins(sys); err != nil {
-		t.Fatalf("gatherAdmins: %v", err)
-	}
-
-	if !reflect.DeepEqual(sys.Users, []string{"alice", "bob"}) {
-		t.Fatalf("unexpected users: %v", sys.Users)
-	}
-	if !reflect.DeepEqual(sys.Groups, []string{"staff", "wheel", "admin"}) {
-		t.Fatalf("unexpected groups: %v", sys.Groups)
-	}
-	if !reflect.DeepEqual(sys.Admins, []string{"wheel", "admin"}) {
-		t.Fatalf("unexpected admins: %v", sys.Admins)
-	}
-}
-
 func TestGatherScheduledTasksWithInjectedSources(t *testing.T) {
 	tmpDir := t.TempDir()
 	dirA := filepath.Join(tmpDir, "a")
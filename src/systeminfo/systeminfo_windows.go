@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/shirou/gopsutil/v4/process"
 	"github.com/shirou/gopsutil/v4/winservices"
 	"golang.org/x/sys/windows/registry"
 	"golang.org/x/sys/windows/svc"
@@ -35,7 +36,7 @@ func gatherInstalledPatches(sysInfo *SystemInfo) error {
 		for _, line := range lines[1:] {
 			patch := strings.TrimSpace(line)
 			if patch != "" {
-				sysInfo.InstalledPatches = append(sysInfo.InstalledPatches, patch)
+				sysInfo.InstalledPatches = append(sysInfo.InstalledPatches, PackageInfo{Name: patch, Source: "hotfix"})
 			}
 		}
 		return nil
@@ -53,7 +54,7 @@ func gatherInstalledPatches(sysInfo *SystemInfo) error {
 	for _, line := range strings.Split(string(out), "\n") {
 		patch := strings.TrimSpace(line)
 		if patch != "" {
-			sysInfo.InstalledPatches = append(sysInfo.InstalledPatches, patch)
+			sysInfo.InstalledPatches = append(sysInfo.InstalledPatches, PackageInfo{Name: patch, Source: "hotfix"})
 		}
 	}
 	return nil
@@ -65,39 +66,76 @@ func gatherStartupPrograms(sysInfo *SystemInfo) error {
 		`Software\Microsoft\Windows\CurrentVersion\Run`,
 		`Software\Microsoft\Windows\CurrentVersion\RunOnce`,
 	}
+	roots := []struct {
+		key   registry.Key
+		name  string
+		owner string
+	}{
+		{registry.LOCAL_MACHINE, "HKLM", ""},
+		{registry.CURRENT_USER, "HKCU", os.Getenv("USERNAME")},
+	}
 
-	for _, keyPath := range keys {
-		k, err := registry.OpenKey(registry.LOCAL_MACHINE, keyPath, registry.READ)
-		if err == nil {
-			defer k.Close()
-			names, err := k.ReadValueNames(0)
-			if err == nil {
-				sysInfo.StartupPrograms = append(sysInfo.StartupPrograms, names...)
+	var items []PersistenceItem
+	for _, root := range roots {
+		for _, keyPath := range keys {
+			k, err := registry.OpenKey(root.key, keyPath, registry.READ)
+			if err != nil {
+				continue
 			}
-		}
-	}
-	for _, keyPath := range keys {
-		k, err := registry.OpenKey(registry.CURRENT_USER, keyPath, registry.READ)
-		if err == nil {
-			defer k.Close()
 			names, err := k.ReadValueNames(0)
 			if err == nil {
-				sysInfo.StartupPrograms = append(sysInfo.StartupPrograms, names...)
+				for _, name := range names {
+					item := PersistenceItem{Kind: "registry", Name: name, Path: root.name + `\` + keyPath, Owner: root.owner, State: "enabled"}
+					if command, _, err := k.GetStringValue(name); err == nil {
+						if expanded, err := registry.ExpandString(command); err == nil {
+							command = expanded
+						}
+						item.Executable, item.Arguments = splitWindowsCommand(command)
+					}
+					items = append(items, item)
+				}
 			}
+			k.Close()
 		}
 	}
+	executableDigests(items, func(executable string) string {
+		if filepath.IsAbs(executable) {
+			return executable
+		}
+		return ""
+	})
+	sysInfo.StartupPrograms = append(sysInfo.StartupPrograms, items...)
 	return nil
 }
 
+// splitWindowsCommand splits a Run key command into the program, which may
+// be quoted, and its arguments.
+func splitWindowsCommand(command string) (string, []string) {
+	command = strings.TrimSpace(command)
+	if rest, ok := strings.CutPrefix(command, `"`); ok {
+		program, args, _ := strings.Cut(rest, `"`)
+		return program, strings.Fields(args)
+	}
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	return fields[0], fields[1:]
+}
+
 func gatherInstalledApps(sysInfo *SystemInfo) error {
-	// Read installed applications from registry
-	uninstallPaths := []string{
-		`Software\Microsoft\Windows\CurrentVersion\Uninstall`,
-		`Software\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`,
+	// Read installed applications from registry. 32-bit applications on
+	// 64-bit Windows are listed under WOW6432Node.
+	uninstallPaths := []struct {
+		path string
+		arch string
+	}{
+		{`Software\Microsoft\Windows\CurrentVersion\Uninstall`, ""},
+		{`Software\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`, "x86"},
 	}
 
-	for _, path := range uninstallPaths {
-		k, err := registry.OpenKey(registry.LOCAL_MACHINE, path, registry.READ)
+	for _, uninstall := range uninstallPaths {
+		k, err := registry.OpenKey(registry.LOCAL_MACHINE, uninstall.path, registry.READ)
 		if err != nil {
 			continue
 		}
@@ -115,7 +153,14 @@ func gatherInstalledApps(sysInfo *SystemInfo) error {
 			}
 			name, _, err := appKey.GetStringValue("DisplayName")
 			if err == nil && name != "" {
-				sysInfo.InstalledApps = append(sysInfo.InstalledApps, name)
+				app := PackageInfo{Name: name, Architecture: uninstall.arch, Source: "registry"}
+				app.Version, _, _ = appKey.GetStringValue("DisplayVersion")
+				if date, _, err := appKey.GetStringValue("InstallDate"); err == nil {
+					if t, err := time.ParseInLocation("20060102", date, time.Local); err == nil {
+						app.InstallTime = t.UTC().Format(time.RFC3339)
+					}
+				}
+				sysInfo.InstalledApps = append(sysInfo.InstalledApps, app)
 			}
 			appKey.Close()
 		}
@@ -185,7 +230,9 @@ func gatherUsers(sysInfo *SystemInfo) error {
 	if err != nil {
 		return err
 	}
-	sysInfo.Users = append(sysInfo.Users, parseNetList(out)...)
+	for _, name := range parseNetList(out) {
+		sysInfo.Users = append(sysInfo.Users, UserInfo{Name: name})
+	}
 	return nil
 }
 
@@ -194,7 +241,9 @@ func gatherGroups(sysInfo *SystemInfo) error {
 	if err != nil {
 		return err
 	}
-	sysInfo.Groups = append(sysInfo.Groups, parseNetList(out)...)
+	for _, name := range parseNetList(out) {
+		sysInfo.Groups = append(sysInfo.Groups, GroupInfo{Name: name})
+	}
 	return nil
 }
 
@@ -203,7 +252,9 @@ func gatherAdmins(sysInfo *SystemInfo) error {
 	if err != nil {
 		return err
 	}
-	sysInfo.Admins = append(sysInfo.Admins, parseNetList(out)...)
+	for _, name := range parseNetList(out) {
+		sysInfo.Admins = append(sysInfo.Admins, AdminInfo{Name: name, Source: "group Administrators"})
+	}
 	return nil
 }
 
@@ -271,3 +322,15 @@ func serviceStateToString(state svc.State) string {
 		return fmt.Sprintf("Unknown(%d)", state)
 	}
 }
+
+// executableSource returns the executable path of a process to hash, keyed
+// by that path.
+func executableSource(pid int32, exe string) (path, key string) {
+	return exe, exe
+}
+
+// gatherProcessDetails fills the extended process details gopsutil reads
+// from the process environment block and handle table.
+func gatherProcessDetails(p *process.Process, info *ProcessInfo) {
+	gatherPortableProcessDetails(p, info)
+}
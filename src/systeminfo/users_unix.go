@@ -0,0 +1,498 @@
+//go:build !windows
+// +build !windows
+
+package systeminfo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	shadowFilePath = "/etc/shadow"
+	sudoersPath    = "/etc/sudoers"
+	wtmpPath       = "/var/log/wtmp"
+	lastlogPath    = "/var/log/lastlog"
+	lastlog2Path   = "/var/lib/lastlog/lastlog2.db"
+
+	// adminGroups conventionally grant sudo. They stand in for the sudoers
+	// policy when it cannot be read.
+	adminGroups = []string{"sudo", "wheel", "admin"}
+)
+
+func gatherUsers(sysInfo *SystemInfo) error {
+	users, err := readPasswd(usersFilePath)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if err := applyPasswordStatus(users, shadowFilePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, err)
+	}
+	if err := applyLastLogins(users); err != nil {
+		errs = append(errs, err)
+	}
+	sysInfo.Users = append(sysInfo.Users, users...)
+	return errors.Join(errs...)
+}
+
+func gatherGroups(sysInfo *SystemInfo) error {
+	groups, err := readGroups(groupsFilePath)
+	if err != nil {
+		return err
+	}
+	// Without the accounts, groups still list their supplementary members.
+	users, err := readPasswd(usersFilePath)
+	addPrimaryMembers(groups, users)
+	sysInfo.Groups = append(sysInfo.Groups, groups...)
+	return err
+}
+
+// gatherAdmins lists accounts with UID 0 and every account the sudoers
+// policy grants rules to. When sudoers cannot be read, members of the
+// conventional admin groups are listed instead and the error is returned.
+func gatherAdmins(sysInfo *SystemInfo) error {
+	users, err := readPasswd(usersFilePath)
+	if err != nil {
+		return err
+	}
+	groups, err := readGroups(groupsFilePath)
+	if err != nil {
+		return err
+	}
+	addPrimaryMembers(groups, users)
+
+	for _, u := range users {
+		if u.UID == "0" {
+			sysInfo.Admins = append(sysInfo.Admins, AdminInfo{Name: u.Name, Source: "uid 0"})
+		}
+	}
+	policy := newSudoersPolicy()
+	if err := policy.load(sudoersPath, 0); err != nil {
+		for _, name := range adminGroups {
+			for _, g := range groups {
+				if g.Name != name {
+					continue
+				}
+				for _, member := range g.Members {
+					sysInfo.Admins = append(sysInfo.Admins, AdminInfo{Name: member, Source: "group " + name})
+				}
+			}
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, rule := range policy.rules {
+		seen := map[string]bool{}
+		for _, item := range rule.users {
+			for _, name := range policy.resolve(item, users, groups, 0) {
+				if !seen[name] {
+					seen[name] = true
+					sysInfo.Admins = append(sysInfo.Admins, AdminInfo{Name: name, Source: rule.file, Rule: rule.line})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// readColonRecords splits each line of a colon separated account database
+// such as /etc/passwd into its fields.
+func readColonRecords(path string) ([][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	records := [][]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if fields[0] != "" {
+			records = append(records, fields)
+		}
+	}
+	return records, scanner.Err()
+}
+
+func readPasswd(path string) ([]UserInfo, error) {
+	records, err := readColonRecords(path)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]UserInfo, 0, len(records))
+	for _, f := range records {
+		user := UserInfo{Name: f[0]}
+		if len(f) >= 7 {
+			user.UID, user.GID, user.Home, user.Shell = f[2], f[3], f[5], f[6]
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func readGroups(path string) ([]GroupInfo, error) {
+	records, err := readColonRecords(path)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]GroupInfo, 0, len(records))
+	for _, f := range records {
+		group := GroupInfo{Name: f[0]}
+		if len(f) >= 4 {
+			group.GID = f[2]
+			for _, member := range strings.Split(f[3], ",") {
+				if member = strings.TrimSpace(member); member != "" {
+					group.Members = append(group.Members, member)
+				}
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// addPrimaryMembers adds the accounts whose primary group a group is, which
+// /etc/group does not list.
+func addPrimaryMembers(groups []GroupInfo, users []UserInfo) {
+	for i := range groups {
+		if groups[i].GID == "" {
+			continue
+		}
+		for _, u := range users {
+			if u.GID == groups[i].GID && !containsString(groups[i].Members, u.Name) {
+				groups[i].Members = append(groups[i].Members, u.Name)
+			}
+		}
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func applyPasswordStatus(users []UserInfo, path string) error {
+	records, err := readColonRecords(path)
+	if err != nil {
+		return err
+	}
+	status := make(map[string]string, len(records))
+	today := time.Now().Unix() / 86400
+	for _, f := range records {
+		if len(f) < 2 {
+			continue
+		}
+		status[f[0]] = passwordStatus(f, today)
+	}
+	for i := range users {
+		users[i].PasswordStatus = status[users[i].Name]
+	}
+	return nil
+}
+
+// passwordStatus reads a shadow entry. An empty hash logs in without a
+// password, one starting with "!" or "*" cannot be used, and an expiry
+// date, in days since 1970, that has passed disables the account.
+func passwordStatus(fields []string, today int64) string {
+	if len(fields) > 7 {
+		if expire, err := strconv.ParseInt(fields[7], 10, 64); err == nil && expire <= today {
+			return "expired"
+		}
+	}
+	switch hash := fields[1]; {
+	case hash == "":
+		return "empty"
+	case strings.HasPrefix(hash, "!"), strings.HasPrefix(hash, "*"):
+		return "locked"
+	}
+	return "set"
+}
+
+// applyLastLogins sets each account's most recent login from wtmp, lastlog
+// and lastlog2, whichever exist.
+func applyLastLogins(users []UserInfo) error {
+	latest := map[string]time.Time{}
+	note := func(name string, t time.Time) {
+		if t.After(latest[name]) {
+			latest[name] = t
+		}
+	}
+	var errs []error
+	for _, read := range []func(func(string, time.Time)) error{
+		func(fn func(string, time.Time)) error { return readWtmp(wtmpPath, fn) },
+		func(fn func(string, time.Time)) error { return readLastlog(lastlogPath, users, fn) },
+		func(fn func(string, time.Time)) error { return readLastlog2(lastlog2Path, fn) },
+	} {
+		if err := read(note); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	for i := range users {
+		users[i].LastLogin = formatTimestamp(latest[users[i].Name])
+	}
+	return errors.Join(errs...)
+}
+
+// wtmp holds glibc utmp records: 384 bytes, a USER_PROCESS type of 7 for
+// logins, the user name at byte 44 and the seconds of the time at 340.
+const (
+	utmpRecordSize  = 384
+	utmpUserProcess = 7
+	lastlogSize     = 292
+)
+
+func readWtmp(path string, fn func(string, time.Time)) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for off := 0; off+utmpRecordSize <= len(data); off += utmpRecordSize {
+		record := data[off : off+utmpRecordSize]
+		if binary.NativeEndian.Uint16(record) != utmpUserProcess {
+			continue
+		}
+		name := string(bytes.TrimRight(record[44:76], "\x00"))
+		if seconds := int32(binary.NativeEndian.Uint32(record[340:])); name != "" && seconds > 0 {
+			fn(name, time.Unix(int64(seconds), 0))
+		}
+	}
+	return nil
+}
+
+// readLastlog reads the lastlog entry of each account, found at its UID
+// times the 292 byte record size. The file is sparse and can be large, so
+// only those records are read.
+func readLastlog(path string, users []UserInfo, fn func(string, time.Time)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	record := make([]byte, 4)
+	for _, u := range users {
+		uid, err := strconv.ParseInt(u.UID, 10, 64)
+		if err != nil || uid < 0 {
+			continue
+		}
+		if _, err := f.ReadAt(record, uid*lastlogSize); err != nil {
+			continue
+		}
+		if seconds := int32(binary.NativeEndian.Uint32(record)); seconds > 0 {
+			fn(u.Name, time.Unix(int64(seconds), 0))
+		}
+	}
+	return nil
+}
+
+// readLastlog2 reads the SQLite database that replaces lastlog on recent
+// distributions.
+func readLastlog2(path string, fn func(string, time.Time)) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := openSQLiteReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT Name, Time FROM Lastlog2")
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var seconds int64
+		if err := rows.Scan(&name, &seconds); err != nil {
+			return err
+		}
+		if seconds > 0 {
+			fn(name, time.Unix(seconds, 0))
+		}
+	}
+	return rows.Err()
+}
+
+// sudoRule is a user specification from a sudoers file: the users it
+// applies to and the whole line, which says what they may run as whom.
+type sudoRule struct {
+	file  string
+	users []string
+	line  string
+}
+
+type sudoersPolicy struct {
+	aliases map[string][]string
+	rules   []sudoRule
+	loaded  map[string]bool
+}
+
+func newSudoersPolicy() *sudoersPolicy {
+	return &sudoersPolicy{aliases: map[string][]string{}, loaded: map[string]bool{}}
+}
+
+var sudoersListSeparator = regexp.MustCompile(`\s*,\s*`)
+
+// load reads a sudoers file and the files it includes. Errors reading an
+// included file are ignored, as sudo ignores missing ones.
+func (p *sudoersPolicy) load(path string, depth int) error {
+	if depth > 8 || p.loaded[path] {
+		return nil
+	}
+	p.loaded[path] = true
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	resolve := func(name string) string {
+		name = strings.Trim(name, `"`)
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return name
+	}
+	for _, line := range sudoersLines(data) {
+		directive, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		switch directive {
+		case "#include", "@include":
+			_ = p.load(resolve(arg), depth+1)
+			continue
+		case "#includedir", "@includedir":
+			entries, err := os.ReadDir(resolve(arg))
+			if err != nil {
+				continue
+			}
+			for _, e := range entries {
+				// sudo skips editor backups and files with a dot, such as
+				// package manager leftovers.
+				if e.IsDir() || strings.HasSuffix(e.Name(), "~") || strings.Contains(e.Name(), ".") {
+					continue
+				}
+				_ = p.load(filepath.Join(resolve(arg), e.Name()), depth+1)
+			}
+			continue
+		}
+		if line = stripSudoersComment(line); line == "" {
+			continue
+		}
+		keyword, rest, _ := strings.Cut(line, " ")
+		switch {
+		case strings.HasPrefix(keyword, "Defaults"), keyword == "Host_Alias", keyword == "Runas_Alias", keyword == "Cmnd_Alias", keyword == "Cmd_Alias":
+			continue
+		case keyword == "User_Alias":
+			for _, def := range strings.Split(rest, ":") {
+				name, members, ok := strings.Cut(def, "=")
+				if ok {
+					p.aliases[strings.TrimSpace(name)] = sudoersListSeparator.Split(strings.TrimSpace(members), -1)
+				}
+			}
+			continue
+		}
+		lhs, _, ok := strings.Cut(line, "=")
+		fields := strings.Fields(sudoersListSeparator.ReplaceAllString(lhs, ","))
+		if !ok || len(fields) < 2 {
+			continue
+		}
+		p.rules = append(p.rules, sudoRule{file: path, users: strings.Split(fields[0], ","), line: line})
+	}
+	return nil
+}
+
+// sudoersLines joins continued lines and drops blank ones.
+func sudoersLines(data []byte) []string {
+	var lines []string
+	var current strings.Builder
+	for _, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimSpace(raw)
+		if cont, ok := strings.CutSuffix(raw, `\`); ok {
+			current.WriteString(cont + " ")
+			continue
+		}
+		current.WriteString(raw)
+		if line := strings.Join(strings.Fields(current.String()), " "); line != "" {
+			lines = append(lines, line)
+		}
+		current.Reset()
+	}
+	return lines
+}
+
+// stripSudoersComment cuts a comment from a line. A "#" followed by digits
+// is a UID, not a comment.
+func stripSudoersComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] != '#' {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' {
+			continue
+		}
+		return strings.TrimSpace(line[:i])
+	}
+	return line
+}
+
+// resolve turns an item of a sudoers user list into account names: group
+// references become their members, UIDs names and aliases their contents.
+// Negated items are left out, and "ALL" is kept as is.
+func (p *sudoersPolicy) resolve(item string, users []UserInfo, groups []GroupInfo, depth int) []string {
+	item = strings.Trim(strings.TrimSpace(item), `"`)
+	switch {
+	case item == "" || strings.HasPrefix(item, "!") || depth > 8:
+		return nil
+	case strings.HasPrefix(item, "%#"):
+		for _, g := range groups {
+			if g.GID == item[2:] {
+				return g.Members
+			}
+		}
+		return nil
+	case strings.HasPrefix(item, "%:"), strings.HasPrefix(item, "+"):
+		// Non-Unix groups and netgroups cannot be resolved locally.
+		return []string{item}
+	case strings.HasPrefix(item, "%"):
+		for _, g := range groups {
+			if g.Name == item[1:] {
+				return g.Members
+			}
+		}
+		return nil
+	case strings.HasPrefix(item, "#"):
+		for _, u := range users {
+			if u.UID == item[1:] {
+				return []string{u.Name}
+			}
+		}
+		return []string{item}
+	}
+	if members, ok := p.aliases[item]; ok {
+		var names []string
+		for _, member := range members {
+			names = append(names, p.resolve(member, users, groups, depth+1)...)
+		}
+		return names
+	}
+	return []string{item}
+}
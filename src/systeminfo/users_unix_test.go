@@ -0,0 +1,164 @@
+//go:build !windows
+// +build !windows
+
+package systeminfo
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAccountSources points the account databases at a fixture directory.
+func useAccountSources(t *testing.T, dir string) {
+	t.Helper()
+	vars := []*string{&usersFilePath, &groupsFilePath, &shadowFilePath, &sudoersPath, &wtmpPath, &lastlogPath, &lastlog2Path}
+	names := []string{"passwd", "group", "shadow", "sudoers", "wtmp", "lastlog", "lastlog2.db"}
+	for i, v := range vars {
+		orig := *v
+		t.Cleanup(func() { *v = orig })
+		*v = filepath.Join(dir, names[i])
+	}
+}
+
+func writeAccountFixtures(t *testing.T, dir string) {
+	t.Helper()
+	writeFixture(t, dir, "passwd", "root:x:0:0:root:/root:/bin/bash\nalice:x:1000:1000::/home/alice:/bin/bash\nbob:x:1001:27::/home/bob:/bin/zsh\nsvc:x:998:998::/nonexistent:/usr/sbin/nologin\n")
+	writeFixture(t, dir, "group", "root:x:0:\nsudo:x:27:alice\nwheel:x:10:\nops:x:2000:carol\n")
+	writeFixture(t, dir, "shadow", "root:*:19000:0:99999:7:::\nalice:$6$abc$def:19000:0:99999:7:::\nbob::19000:0:99999:7:::\nsvc:$6$abc$def:19000:0:99999:7::1:\n")
+	writeFixture(t, dir, "sudoers", `Defaults env_reset
+User_Alias OPS = carol, #1001
+# User privilege specification
+root ALL=(ALL:ALL) ALL
+%sudo ALL=(ALL:ALL) ALL
+svc ALL=(root) \
+    /usr/bin/id
+#includedir sudoers.d
+`)
+	writeFixture(t, dir, "sudoers.d/ops", "OPS ALL=(root) NOPASSWD: /usr/bin/systemctl restart app # restart only\n")
+	writeFixture(t, dir, "sudoers.d/old.bak", "alice ALL=(ALL) NOPASSWD: ALL\n")
+}
+
+func TestGatherUsersGroupsAdminsWithInjectedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeAccountFixtures(t, dir)
+	useAccountSources(t, dir)
+
+	// alice logged in on a terminal after the login lastlog recorded, and
+	// bob's login is only in lastlog2.
+	utmp := make([]byte, 2*utmpRecordSize)
+	binary.NativeEndian.PutUint16(utmp, utmpUserProcess)
+	copy(utmp[44:], "alice")
+	binary.NativeEndian.PutUint32(utmp[340:], 1709290800)
+	binary.NativeEndian.PutUint16(utmp[utmpRecordSize:], 8)
+	copy(utmp[utmpRecordSize+44:], "root")
+	binary.NativeEndian.PutUint32(utmp[utmpRecordSize+340:], 1709290800)
+	writeFixture(t, dir, "wtmp", string(utmp))
+	lastlog, err := os.Create(filepath.Join(dir, "lastlog"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uid, seconds := range map[int64]uint32{0: 1709287200, 1000: 1709283600} {
+		if _, err := lastlog.WriteAt(binary.NativeEndian.AppendUint32(nil, seconds), uid*lastlogSize); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lastlog.Close()
+	db, err := sql.Open("sqlite", filepath.Join(dir, "lastlog2.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE Lastlog2 (Name TEXT PRIMARY KEY, Time INTEGER, TTY TEXT, RemoteHost TEXT, Service TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO Lastlog2 (Name, Time) VALUES ('bob', 1709294400)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	sys := &SystemInfo{}
+	if err := gatherUsers(sys); err != nil {
+		t.Fatalf("gatherUsers: %v", err)
+	}
+	if err := gatherGroups(sys); err != nil {
+		t.Fatalf("gatherGroups: %v", err)
+	}
+	if err := gatherAdmins(sys); err != nil {
+		t.Fatalf("gatherAdmins: %v", err)
+	}
+
+	wantUsers := []UserInfo{
+		{Name: "root", UID: "0", GID: "0", Home: "/root", Shell: "/bin/bash", PasswordStatus: "locked", LastLogin: "2024-03-01T10:00:00Z"},
+		{Name: "alice", UID: "1000", GID: "1000", Home: "/home/alice", Shell: "/bin/bash", PasswordStatus: "set", LastLogin: "2024-03-01T11:00:00Z"},
+		{Name: "bob", UID: "1001", GID: "27", Home: "/home/bob", Shell: "/bin/zsh", PasswordStatus: "empty", LastLogin: "2024-03-01T12:00:00Z"},
+		{Name: "svc", UID: "998", GID: "998", Home: "/nonexistent", Shell: "/usr/sbin/nologin", PasswordStatus: "expired"},
+	}
+	if !reflect.DeepEqual(sys.Users, wantUsers) {
+		t.Fatalf("unexpected users:\n got %+v\nwant %+v", sys.Users, wantUsers)
+	}
+	wantGroups := []GroupInfo{
+		{Name: "root", GID: "0", Members: []string{"root"}},
+		{Name: "sudo", GID: "27", Members: []string{"alice", "bob"}},
+		{Name: "wheel", GID: "10"},
+		{Name: "ops", GID: "2000", Members: []string{"carol"}},
+	}
+	if !reflect.DeepEqual(sys.Groups, wantGroups) {
+		t.Fatalf("unexpected groups:\n got %+v\nwant %+v", sys.Groups, wantGroups)
+	}
+	sudoers := filepath.Join(dir, "sudoers")
+	ops := filepath.Join(dir, "sudoers.d", "ops")
+	wantAdmins := []AdminInfo{
+		{Name: "root", Source: "uid 0"},
+		{Name: "root", Source: sudoers, Rule: "root ALL=(ALL:ALL) ALL"},
+		{Name: "alice", Source: sudoers, Rule: "%sudo ALL=(ALL:ALL) ALL"},
+		{Name: "bob", Source: sudoers, Rule: "%sudo ALL=(ALL:ALL) ALL"},
+		{Name: "svc", Source: sudoers, Rule: "svc ALL=(root) /usr/bin/id"},
+		{Name: "carol", Source: ops, Rule: "OPS ALL=(root) NOPASSWD: /usr/bin/systemctl restart app"},
+		{Name: "bob", Source: ops, Rule: "OPS ALL=(root) NOPASSWD: /usr/bin/systemctl restart app"},
+	}
+	if !reflect.DeepEqual(sys.Admins, wantAdmins) {
+		t.Fatalf("unexpected admins:\n got %+v\nwant %+v", sys.Admins, wantAdmins)
+	}
+}
+
+func TestGatherAdminsFallsBackToAdminGroups(t *testing.T) {
+	dir := t.TempDir()
+	writeAccountFixtures(t, dir)
+	useAccountSources(t, dir)
+	sudoersPath = filepath.Join(dir, "missing-sudoers")
+
+	sys := &SystemInfo{}
+	if err := gatherAdmins(sys); err != nil {
+		t.Fatalf("gatherAdmins: %v", err)
+	}
+	want := []AdminInfo{
+		{Name: "root", Source: "uid 0"},
+		{Name: "alice", Source: "group sudo"},
+		{Name: "bob", Source: "group sudo"},
+	}
+	if !reflect.DeepEqual(sys.Admins, want) {
+		t.Fatalf("unexpected admins: %+v", sys.Admins)
+	}
+}
+
+func TestPasswordStatus(t *testing.T) {
+	today := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	cases := map[string]string{
+		"u:$y$j9T$abc:19000:0:99999:7:::":      "set",
+		"u::19000:0:99999:7:::":                "empty",
+		"u:!$y$j9T$abc:19000:0:99999:7:::":     "locked",
+		"u:!!:19000::::::":                     "locked",
+		"u:$y$j9T$abc:19000:0:99999:7::19700:": "expired",
+		"u:$y$j9T$abc:19000:0:99999:7::19800:": "set",
+	}
+	for line, want := range cases {
+		if got := passwordStatus(strings.Split(line, ":"), today); got != want {
+			t.Errorf("passwordStatus(%q) = %q, want %q", line, got, want)
+		}
+	}
+}